@@ -16,11 +16,14 @@ package main
 
 import (
 	"context"
+	"flag"
 	"fmt"
 	"io/ioutil"
 	"net/http"
 	"os"
+	"os/signal"
 	"strings"
+	"syscall"
 	"time"
 
 	"github.com/evalphobia/logrus_sentry"
@@ -29,9 +32,12 @@ import (
 	"github.com/sirupsen/logrus"
 
 	"github.com/skygeario/skygear-server/pkg/server/asset"
+	"github.com/skygeario/skygear-server/pkg/server/asset/migrate"
 	"github.com/skygeario/skygear-server/pkg/server/audit"
 	"github.com/skygeario/skygear-server/pkg/server/authtoken"
 	"github.com/skygeario/skygear-server/pkg/server/handler"
+	"github.com/skygeario/skygear-server/pkg/server/job"
+	"github.com/skygeario/skygear-server/pkg/server/leader"
 	"github.com/skygeario/skygear-server/pkg/server/logging"
 	"github.com/skygeario/skygear-server/pkg/server/plugin"
 	pluginEvent "github.com/skygeario/skygear-server/pkg/server/plugin/event"
@@ -46,7 +52,7 @@ import (
 	"github.com/skygeario/skygear-server/pkg/server/router"
 	"github.com/skygeario/skygear-server/pkg/server/skyconfig"
 	"github.com/skygeario/skygear-server/pkg/server/skydb"
-	_ "github.com/skygeario/skygear-server/pkg/server/skydb/pq"
+	"github.com/skygeario/skygear-server/pkg/server/skydb/pq"
 	"github.com/skygeario/skygear-server/pkg/server/skyversion"
 	"github.com/skygeario/skygear-server/pkg/server/subscription"
 )
@@ -59,6 +65,9 @@ func main() {
 			fmt.Printf("%s\n", skyversion.Version())
 			os.Exit(0)
 		}
+		if os.Args[1] == "asset" {
+			os.Exit(runAssetCommand(os.Args[2:]))
+		}
 	}
 
 	config := skyconfig.NewConfiguration()
@@ -84,7 +93,18 @@ func main() {
 	r := router.NewRouter()
 	r.ResponseTimeout = time.Duration(config.App.ResponseTimeout) * time.Second
 	serveMux := http.NewServeMux()
-	pushSender := initPushSender(config, connOpener)
+	var pushMockSender *push.MockSender
+	if config.PushMock.Enable {
+		pushMockSender = initPushMockSender(config, connOpener)
+	}
+	pushSender := initPushSender(config, connOpener, pushMockSender)
+	pushDeliveryLog := &push.DeliveryLog{
+		ConnOpener: connOpener,
+		Sender:     pushSender,
+	}
+	pushBroadcaster := &push.Broadcaster{
+		ConnOpener: connOpener,
+	}
 
 	tokenStore := authtoken.InitTokenStore(authtoken.Configuration{
 		Implementation: config.TokenStore.ImplName,
@@ -126,23 +146,38 @@ func main() {
 	preprocessorRegistry := router.PreprocessorRegistry{}
 
 	var cronjob *cron.Cron
+	var elector *leader.Elector
 	if !config.App.Slave {
 		cronjob = cron.New()
+		elector = initLeaderElector(config)
+		elector.OnElected(cronjob.Start)
+		elector.OnDemoted(cronjob.Stop)
 	}
 	pluginContext := plugin.Context{
-		Router:           r,
-		Mux:              serveMux,
-		HookRegistry:     hook.NewRegistry(),
-		ProviderRegistry: provider.NewRegistry(),
-		Scheduler:        cronjob,
-		Config:           config,
+		Router:                   r,
+		Mux:                      serveMux,
+		HookRegistry:             hook.NewRegistry(),
+		ProviderRegistry:         provider.NewRegistry(),
+		PubSubAuthorizerRegistry: pubsub.NewAuthorizerRegistry(),
+		Scheduler:                cronjob,
+		Config:                   config,
 	}
 
+	assetStore := initAssetStore(config)
+
 	var internalHub *pubsub.Hub
 	if !config.App.Slave {
-		internalHub = pubsub.NewHub()
-		initSubscription(config, connOpener, internalHub, pushSender)
-		initDevice(config, connOpener)
+		internalHub = pubsub.NewHubWithBackend(initPubSubBackend(config, "internal"))
+		initSubscription(config, connOpener, internalHub, pushSender, assetStore, elector)
+		elector.OnElected(func() {
+			initDevice(config, connOpener)
+		})
+		go elector.Run()
+		initJobWorker(connOpener, r)
+		if config.AssetGC.Enable {
+			initAssetGC(config, connOpener, cronjob)
+		}
+		initPushRetryWorker(pushDeliveryLog)
 	}
 
 	// Preprocessor
@@ -230,15 +265,50 @@ func main() {
 			Name:     "TokenStore",
 		},
 		&inject.Object{
-			Value:    initAssetStore(config),
+			Value:    assetStore,
 			Complete: true,
 			Name:     "AssetStore",
 		},
+		&inject.Object{
+			Value:    initAssetUploadPolicy(config),
+			Complete: true,
+			Name:     "AssetUploadPolicy",
+		},
+		&inject.Object{
+			Value:    config.AssetStore.ContentAddressed,
+			Complete: true,
+			Name:     "AssetContentAddressed",
+		},
+		&inject.Object{
+			Value:    config.AssetScanner.ImplName != "",
+			Complete: true,
+			Name:     "AssetScanEnabled",
+		},
 		&inject.Object{
 			Value:    pushSender,
 			Complete: true,
 			Name:     "PushSender",
 		},
+		&inject.Object{
+			Value:    pushDeliveryLog,
+			Complete: true,
+			Name:     "PushDeliveryLog",
+		},
+		&inject.Object{
+			Value:    pushBroadcaster,
+			Complete: true,
+			Name:     "PushBroadcaster",
+		},
+		&inject.Object{
+			Value:    pushMockSender,
+			Complete: true,
+			Name:     "PushMockSender",
+		},
+		&inject.Object{
+			Value:    &pluginContext,
+			Complete: true,
+			Name:     "PluginContext",
+		},
 		&inject.Object{
 			Value:    pluginEvent.NewSender(&pluginContext),
 			Complete: true,
@@ -277,6 +347,7 @@ func main() {
 
 	r.Map("", "", &handler.HomeHandler{})
 	r.Map("_status:healthz", "", injector.Inject(&handler.HealthzHandler{}))
+	r.Map("_plugin:reload", "plugin", injector.Inject(&handler.PluginReloadHandler{}))
 
 	r.Map("auth:signup", "auth", injector.Inject(&handler.SignupHandler{}))
 	r.Map("auth:login", "auth", injector.Inject(&handler.LoginHandler{}))
@@ -293,6 +364,15 @@ func main() {
 	}))
 
 	r.Map("asset:put", "asset", injector.Inject(&handler.AssetUploadHandler{}))
+	r.Map("asset:exists", "asset", injector.Inject(&handler.AssetExistsHandler{}))
+	r.Map("asset:renew-upload", "asset", injector.Inject(&handler.AssetRenewUploadHandler{}))
+	r.Map("asset:transform", "asset", injector.Inject(&handler.AssetTransformHandler{}))
+	r.Map(handler.AssetGCAction, "asset", injector.Inject(&handler.AssetGCHandler{}))
+	if config.AssetScanner.ImplName != "" {
+		r.Map(handler.AssetScanAction, "asset", injector.Inject(&handler.AssetScanHandler{
+			Scanner: initAssetScanner(config, r),
+		}))
+	}
 
 	r.Map("record:fetch", "record", injector.Inject(&handler.RecordFetchHandler{}))
 	r.Map("record:query", "record", injector.Inject(&handler.RecordQueryHandler{}))
@@ -321,8 +401,20 @@ func main() {
 	r.Map("role:revoke", "role", injector.Inject(&handler.RoleRevokeHandler{}))
 	r.Map("role:get", "role", injector.Inject(&handler.RoleGetHandler{}))
 
+	r.Map("job:schedule", "job", injector.Inject(&handler.JobScheduleHandler{}))
+
 	r.Map("push:user", "push", injector.Inject(&handler.PushToUserHandler{}))
 	r.Map("push:device", "push", injector.Inject(&handler.PushToDeviceHandler{}))
+	r.Map("push:query", "push", injector.Inject(&handler.PushToQueryHandler{}))
+	r.Map("push:topic", "push", injector.Inject(&handler.PushToTopicHandler{}))
+	r.Map("push:schedule", "push", injector.Inject(&handler.PushScheduleHandler{}))
+	r.Map("push:schedule:run", "push", injector.Inject(&handler.PushScheduleRunHandler{}))
+	r.Map("push:schedule:cancel", "push", injector.Inject(&handler.PushScheduleCancelHandler{}))
+	r.Map("push:status", "push", injector.Inject(&handler.PushStatusHandler{}))
+	r.Map("push:template:save", "push", injector.Inject(&handler.PushTemplateSaveHandler{}))
+	r.Map("push:template:fetch", "push", injector.Inject(&handler.PushTemplateFetchHandler{}))
+	r.Map("push:template:delete", "push", injector.Inject(&handler.PushTemplateDeleteHandler{}))
+	r.Map("_dev:push:captured", "push", injector.Inject(&handler.PushCapturedHandler{}))
 
 	r.Map("schema:rename", "schema", injector.Inject(&handler.SchemaRenameHandler{}))
 	r.Map("schema:delete", "schema", injector.Inject(&handler.SchemaDeleteHandler{}))
@@ -337,13 +429,24 @@ func main() {
 
 	// Following section is for Gateway
 	if !config.App.Slave {
-		pubSub := pubsub.NewWsPubsub(nil)
+		pubSubAuthorizer := initPubSubAuthorizer(config, connOpener, pluginContext.PubSubAuthorizerRegistry)
+		pubSubHub := pubsub.NewHubWithBackend(initPubSubBackend(config, "pubsub"))
+		if history := initPubSubHistory(config); history != nil {
+			pubSubHub.SetHistory(history, config.PubSub.HistoryChannels)
+		}
+		pubSub := pubsub.NewWsPubsub(pubSubHub)
+		pubSub.Authorizer = pubSubAuthorizer
+		r.Map("pubsub:presence", "pubsub", injector.Inject(&handler.PubSubPresenceHandler{
+			Hub:        pubSubHub,
+			Authorizer: pubSubAuthorizer,
+		}))
 		pubSubGateway := router.NewGateway("", "/pubsub", "pubsub", serveMux)
 		pubSubGateway.GET(injector.InjectProcessors(&handler.PubSubHandler{
 			WebSocket: pubSub,
 		}))
 
 		internalPubSub := pubsub.NewWsPubsub(internalHub)
+		internalPubSub.Authorizer = pubSubAuthorizer
 		internalPubSubGateway := router.NewGateway("", "/_/pubsub", "pubsub", serveMux)
 		internalPubSubGateway.GET(injector.InjectProcessors(&handler.PubSubHandler{
 			WebSocket: internalPubSub,
@@ -358,6 +461,11 @@ func main() {
 	fileGateway.PUT(uploadFileHandler)
 	fileGateway.POST(uploadFileHandler)
 
+	resumableUploadHandler := injector.Inject(&handler.ResumableUploadHandler{})
+	fileGateway.Handle(http.MethodHead, resumableUploadHandler)
+	fileGateway.Handle(http.MethodPatch, resumableUploadHandler)
+	fileGateway.Handle(http.MethodDelete, resumableUploadHandler)
+
 	corsHost := config.App.CORSHost
 
 	var finalMux http.Handler
@@ -408,6 +516,105 @@ func main() {
 	}
 }
 
+// runAssetCommand runs the asset subcommand and returns the exit code.
+// The migrate subcommand copies the files of all assets from one asset
+// store to another, both configured by the ASSET_STORE_* environment
+// variables:
+//
+//  skygear-server asset migrate --from fs --to s3 [--dry-run] [--resume]
+//
+// The name of the last migrated asset is recorded in the state file, such
+// that an interrupted migration can be resumed with --resume. Assets whose
+// files do not exist, such as those never uploaded, are skipped and listed
+// at the end.
+func runAssetCommand(args []string) int {
+	if len(args) == 0 || args[0] != "migrate" {
+		fmt.Fprintln(os.Stderr, "usage: skygear-server asset migrate --from STORE --to STORE [options]")
+		return 2
+	}
+
+	flags := flag.NewFlagSet("asset migrate", flag.ContinueOnError)
+	from := flags.String("from", "", "asset store to migrate from: fs, s3 or cloud")
+	to := flags.String("to", "", "asset store to migrate to: fs, s3 or cloud")
+	dryRun := flags.Bool("dry-run", false, "list the assets to be migrated without copying them")
+	resume := flags.Bool("resume", false, "resume after the last migrated asset recorded in the state file")
+	statePath := flags.String("state", "asset-migrate.state", "file recording the last migrated asset")
+	batchSize := flags.Int("batch-size", migrate.DefaultBatchSize, "number of assets queried at a time")
+	if err := flags.Parse(args[1:]); err != nil {
+		return 2
+	}
+	if *from == "" || *to == "" || *from == *to {
+		fmt.Fprintln(os.Stderr, "--from and --to must be specified with different asset stores")
+		return 2
+	}
+
+	config := skyconfig.NewConfiguration()
+	config.ReadFromEnv()
+	if err := config.Validate(); err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		return 1
+	}
+	initLogger(config)
+
+	after := ""
+	if *resume {
+		data, err := ioutil.ReadFile(*statePath)
+		if err != nil && !os.IsNotExist(err) {
+			fmt.Fprintf(os.Stderr, "Failed to read state file: %v\n", err)
+			return 1
+		}
+		after = strings.TrimSpace(string(data))
+	}
+
+	conn, err := ensureDB(config)()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to connect to database: %v\n", err)
+		return 1
+	}
+	defer conn.Close()
+
+	m := migrate.Migrator{
+		Conn:      conn,
+		From:      initMigrationAssetStore(config, *from),
+		To:        initMigrationAssetStore(config, *to),
+		DryRun:    *dryRun,
+		BatchSize: *batchSize,
+		Checkpoint: func(name string) error {
+			return ioutil.WriteFile(*statePath, []byte(name+"\n"), 0644)
+		},
+		Logger: logging.LoggerEntry("asset"),
+	}
+	result, err := m.Migrate(after)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to migrate assets: %v\n", err)
+		fmt.Fprintf(os.Stderr, "Migrated %d assets, run again with --resume to continue\n", result.Assets)
+		return 1
+	}
+
+	if *dryRun {
+		fmt.Printf("Would migrate %d assets, copying %d files of %d bytes\n", result.Assets, result.Objects, result.Bytes)
+	} else {
+		fmt.Printf("Migrated %d assets, copied %d files of %d bytes\n", result.Assets, result.Objects, result.Bytes)
+	}
+	if len(result.Missing) > 0 {
+		fmt.Printf("Skipped %d assets whose files do not exist:\n", len(result.Missing))
+		for _, name := range result.Missing {
+			fmt.Printf("  %s\n", name)
+		}
+	}
+	return 0
+}
+
+// initMigrationAssetStore returns the asset store of the implementation
+// configured by the ASSET_STORE_* environment variables. Access control
+// does not apply to the migration, which reads and writes files directly.
+func initMigrationAssetStore(config skyconfig.Configuration, implName string) asset.Store {
+	config.AssetStore.ImplName = implName
+	config.AssetStore.RecordACL = false
+	config.AssetStore.S3Store.PresignUpload = false
+	return initAssetStore(config)
+}
+
 func baseDBConfig(config skyconfig.Configuration) skydb.DBConfig {
 	passwordHistoryEnabled := config.UserAudit.PwHistorySize > 0 ||
 		config.UserAudit.PwHistoryDays > 0
@@ -476,6 +683,14 @@ func initAssetStore(config skyconfig.Configuration) asset.Store {
 	default:
 		panic("unrecgonized asset store implementation: " + config.AssetStore.ImplName)
 	case "fs":
+		if config.AssetStore.RecordACL {
+			store = asset.NewRecordACLFileStore(
+				config.AssetStore.FileSystemStore.Path,
+				config.AssetStore.FileSystemStore.URLPrefix,
+				config.AssetStore.FileSystemStore.Secret,
+			)
+			break
+		}
 		store = asset.NewFileStore(
 			config.AssetStore.FileSystemStore.Path,
 			config.AssetStore.FileSystemStore.URLPrefix,
@@ -483,13 +698,25 @@ func initAssetStore(config skyconfig.Configuration) asset.Store {
 			config.AssetStore.Public,
 		)
 	case "s3":
-		s3Store, err := asset.NewS3Store(
+		if config.AssetStore.ContentAddressed && config.AssetStore.S3Store.PresignUpload {
+			panic("content addressing is not supported with presigned upload")
+		}
+		s3Store, err := asset.NewS3StoreWithOptions(
 			config.AssetStore.S3Store.AccessToken,
 			config.AssetStore.S3Store.SecretToken,
 			config.AssetStore.S3Store.Region,
 			config.AssetStore.S3Store.Bucket,
 			config.AssetStore.S3Store.URLPrefix,
 			config.AssetStore.Public,
+			asset.S3Options{
+				Endpoint:             config.AssetStore.S3Store.Endpoint,
+				ForcePathStyle:       config.AssetStore.S3Store.ForcePathStyle,
+				InsecureSkipVerify:   config.AssetStore.S3Store.InsecureSkipVerify,
+				ServerSideEncryption: config.AssetStore.S3Store.ServerSideEncryption,
+				SSEKMSKeyID:          config.AssetStore.S3Store.SSEKMSKeyID,
+				StorageClass:         config.AssetStore.S3Store.StorageClass,
+				PresignUpload:        config.AssetStore.S3Store.PresignUpload,
+			},
 		)
 		if err != nil {
 			panic("failed to initialize asset.S3Store: " + err.Error())
@@ -509,9 +736,63 @@ func initAssetStore(config skyconfig.Configuration) asset.Store {
 		}
 		store = cloudStore
 	}
+
+	if _, ok := store.(asset.ContentAddressedStore); config.AssetStore.ContentAddressed && !ok {
+		panic("content addressing is not supported by asset store: " + config.AssetStore.ImplName)
+	}
 	return store
 }
 
+func initAssetScanner(config skyconfig.Configuration, r *router.Router) asset.Scanner {
+	switch config.AssetScanner.ImplName {
+	case "clamd":
+		return asset.NewClamdScanner(
+			config.AssetScanner.Clamd.Address,
+			time.Duration(config.AssetScanner.Clamd.Timeout)*time.Second,
+		)
+	case "plugin":
+		return &plugin.LambdaScanner{
+			Router: r,
+			Lambda: config.AssetScanner.Plugin.Lambda,
+		}
+	default:
+		panic("unrecognized asset scanner: " + config.AssetScanner.ImplName)
+	}
+}
+
+func initAssetUploadPolicy(config skyconfig.Configuration) *asset.UploadPolicy {
+	policy := &asset.UploadPolicy{
+		FieldUploadPolicy: asset.FieldUploadPolicy{
+			MaxSize:      config.AssetPolicy.MaxSize,
+			ContentTypes: config.AssetPolicy.ContentTypes,
+		},
+		SniffContentType: config.AssetPolicy.SniffContentType,
+		StripEXIF:        asset.EXIFStripping(config.AssetPolicy.StripEXIF),
+		Fields:           map[string]asset.FieldUploadPolicy{},
+	}
+	for field, fieldConfig := range config.AssetPolicy.Fields {
+		policy.Fields[field] = asset.FieldUploadPolicy{
+			MaxSize:      fieldConfig.MaxSize,
+			ContentTypes: fieldConfig.ContentTypes,
+		}
+	}
+	return policy
+}
+
+func initLeaderElector(config skyconfig.Configuration) *leader.Elector {
+	logger := logging.LoggerEntryWithTag("main", "leader")
+	if !config.App.LeaderElection {
+		return leader.NewElector(leader.NewLocalLock())
+	}
+
+	lock, err := pq.NewAdvisoryLock(config.DB.Option, "skygear:"+config.App.Name+":leader")
+	if err != nil {
+		logger.Fatalf("Failed to create lock for leader election: %v", err)
+	}
+	logger.Infof("Leader election is enabled.")
+	return leader.NewElector(lock)
+}
+
 func initDevice(config skyconfig.Configuration, connOpener func() (skydb.Conn, error)) {
 	logger := logging.LoggerEntryWithTag("main", "device")
 	// TODO: Create a device service to check APNs to remove obsolete devices.
@@ -520,13 +801,20 @@ func initDevice(config skyconfig.Configuration, connOpener func() (skydb.Conn, e
 	conn, err := connOpener()
 	if err != nil {
 		logger.Warnf("Failed to delete outdated devices: %v", err)
+		return
 	}
 
 	conn.DeleteEmptyDevicesByTime(time.Now().AddDate(0, 0, -1))
 }
 
-func initPushSender(config skyconfig.Configuration, connOpener func() (skydb.Conn, error)) push.Sender {
+func initPushSender(config skyconfig.Configuration, connOpener func() (skydb.Conn, error), mockSender *push.MockSender) push.Sender {
 	routeSender := push.NewRouteSender()
+	if mockSender != nil {
+		for _, service := range []string{"aps", "ios", "gcm", "fcm", "android", "baidu-android", "web"} {
+			routeSender.Route(service, mockSender)
+		}
+		return routeSender
+	}
 	if config.APNS.Enable {
 		apns := initAPNSPusher(config, connOpener)
 		routeSender.Route("aps", apns)
@@ -542,6 +830,10 @@ func initPushSender(config skyconfig.Configuration, connOpener func() (skydb.Con
 		baidu := initBaiduPusher(config)
 		routeSender.Route("baidu-android", baidu)
 	}
+	if config.WebPush.Enable {
+		web := initWebPusher(config, connOpener)
+		routeSender.Route("web", web)
+	}
 	return routeSender
 }
 
@@ -675,7 +967,34 @@ func initBaiduPusher(config skyconfig.Configuration) *push.BaiduPusher {
 	return push.NewBaiduPusher(config.Baidu.APIKey, config.Baidu.SecretKey)
 }
 
-func initSubscription(config skyconfig.Configuration, connOpener func() (skydb.Conn, error), hub *pubsub.Hub, pushSender push.Sender) {
+func initPushMockSender(config skyconfig.Configuration, connOpener func() (skydb.Conn, error)) *push.MockSender {
+	logger := logging.LoggerEntryWithTag("main", "push")
+	rules, err := push.ParseMockFailureRules(config.PushMock.Failures)
+	if err != nil {
+		logger.Fatalf("Failed to set up mock push sender: %v", err)
+	}
+
+	logger.Warnln("Mock push sender is enabled, notifications are captured instead of sent")
+	return &push.MockSender{
+		ConnOpener:   connOpener,
+		FailureRules: rules,
+		CaptureLimit: config.PushMock.CaptureLimit,
+	}
+}
+
+func initWebPusher(config skyconfig.Configuration, connOpener func() (skydb.Conn, error)) push.Sender {
+	logger := logging.LoggerEntryWithTag("main", "push")
+	pusher, err := push.NewWebPusher(connOpener, config.WebPush.Subject, config.WebPush.PrivateKey)
+	if err != nil {
+		logger.Fatalf("Failed to set up web push sender: %v", err)
+	}
+	pusher.TTL = config.WebPush.TTL
+
+	logger.Infof("Web push enabled with VAPID public key = %s", pusher.PublicKey())
+	return pusher
+}
+
+func initSubscription(config skyconfig.Configuration, connOpener func() (skydb.Conn, error), hub *pubsub.Hub, pushSender push.Sender, assetStore asset.Store, elector *leader.Elector) {
 	logger := logging.LoggerEntryWithTag("main", "subscription")
 	notifiers := []subscription.Notifier{subscription.NewHubNotifier(hub)}
 	if pushSender != nil {
@@ -685,24 +1004,155 @@ func initSubscription(config skyconfig.Configuration, connOpener func() (skydb.C
 	subscriptionService := &subscription.Service{
 		ConnOpener: connOpener,
 		Notifier:   subscription.NewMultiNotifier(notifiers...),
+		IsLeader:   elector.IsLeader,
+		AssetStore: assetStore,
 	}
 	logger.Infoln("Subscription Service listening...")
 	go subscriptionService.Run()
 }
 
+// initPubSubBackend returns the backend relaying messages of the named hub
+// between skygear-servers, or nil if messages are delivered in memory.
+func initPubSubBackend(config skyconfig.Configuration, name string) pubsub.Backend {
+	logger := logging.LoggerEntryWithTag("main", "pubsub")
+	switch config.PubSub.Backend {
+	case "pq":
+		backend, err := pq.NewPubSubBackend(config.DB.Option, "skygear_"+config.App.Name+"_"+name)
+		if err != nil {
+			logger.Fatalf("Failed to initialize pubsub backend: %v", err)
+		}
+		return backend
+	case "redis":
+		return pubsub.NewRedisBackend(config.PubSub.RedisURL, "skygear:"+config.App.Name+":"+name)
+	default:
+		return nil
+	}
+}
+
+// initPubSubHistory returns the history retaining messages of pubsub
+// channels, or nil if messages are not retained.
+func initPubSubHistory(config skyconfig.Configuration) pubsub.History {
+	logger := logging.LoggerEntryWithTag("main", "pubsub")
+	ttl := time.Duration(config.PubSub.HistoryTTL) * time.Second
+	switch config.PubSub.History {
+	case "memory":
+		return pubsub.NewMemoryHistory(config.PubSub.HistorySize, ttl)
+	case "pq":
+		history, err := pq.NewPubSubHistory(config.DB.Option, config.App.Name, config.PubSub.HistorySize, ttl)
+		if err != nil {
+			logger.Fatalf("Failed to initialize pubsub history: %v", err)
+		}
+		return history
+	default:
+		return nil
+	}
+}
+
+func initPubSubAuthorizer(config skyconfig.Configuration, connOpener func() (skydb.Conn, error), registry *pubsub.AuthorizerRegistry) pubsub.Authorizer {
+	return &pubsub.ChannelAuthorizer{
+		User: pubsub.ChannelRule{
+			Subscribe: pubsub.Rule(config.PubSub.UserSubscribe),
+			Publish:   pubsub.Rule(config.PubSub.UserPublish),
+		},
+		Role: pubsub.ChannelRule{
+			Subscribe: pubsub.Rule(config.PubSub.RoleSubscribe),
+			Publish:   pubsub.Rule(config.PubSub.RolePublish),
+		},
+		Public: pubsub.ChannelRule{
+			Subscribe: pubsub.Rule(config.PubSub.PublicSubscribe),
+			Publish:   pubsub.Rule(config.PubSub.PublicPublish),
+		},
+		Default: pubsub.ChannelRule{
+			Subscribe: pubsub.Rule(config.PubSub.DefaultSubscribe),
+			Publish:   pubsub.Rule(config.PubSub.DefaultPublish),
+		},
+		DeviceOwner: func(deviceID string) (string, error) {
+			conn, err := connOpener()
+			if err != nil {
+				return "", err
+			}
+			defer conn.Close()
+
+			device := skydb.Device{}
+			err = conn.GetDevice(deviceID, &device)
+			if err == skydb.ErrDeviceNotFound {
+				return "", nil
+			} else if err != nil {
+				return "", err
+			}
+			return device.AuthInfoID, nil
+		},
+		Registry: registry,
+	}
+}
+
+func initJobWorker(connOpener func() (skydb.Conn, error), r *router.Router) {
+	logger := logging.LoggerEntryWithTag("main", "job")
+	worker := job.NewWorker(connOpener, &job.RouterRunner{Router: r})
+	logger.Infoln("Job worker polling for jobs...")
+	go worker.Run()
+}
+
+// initAssetGC schedules a job deleting orphaned assets periodically. The
+// job is executed by the job worker.
+func initAssetGC(config skyconfig.Configuration, connOpener func() (skydb.Conn, error), c *cron.Cron) {
+	logger := logging.LoggerEntryWithTag("main", "asset")
+	err := c.AddFunc(config.AssetGC.Schedule, func() {
+		conn, err := connOpener()
+		if err != nil {
+			logger.Warnf("Failed to schedule asset gc: %v", err)
+			return
+		}
+		defer conn.Close()
+
+		gcJob := skydb.Job{
+			Name: handler.AssetGCAction,
+			Args: map[string]interface{}{
+				"grace_period": config.AssetGC.GracePeriod,
+			},
+			Key:         handler.AssetGCAction,
+			RunAt:       time.Now().UTC(),
+			MaxAttempts: job.DefaultMaxAttempts,
+		}
+		if createErr := conn.CreateJob(&gcJob); createErr != nil && createErr != skydb.ErrJobDuplicated {
+			logger.Warnf("Failed to schedule asset gc: %v", createErr)
+		}
+	})
+	if err != nil {
+		logger.Fatalf("Failed to schedule asset gc with %s: %v", config.AssetGC.Schedule, err)
+	}
+	logger.Infof("Asset gc scheduled with %s", config.AssetGC.Schedule)
+}
+
+func initPushRetryWorker(deliveryLog *push.DeliveryLog) {
+	logger := logging.LoggerEntryWithTag("main", "push")
+	worker := push.NewRetryWorker(deliveryLog)
+	logger.Infoln("Push retry worker polling for push deliveries...")
+	go worker.Run()
+}
+
 func initPlugin(config skyconfig.Configuration, ctx *plugin.Context) {
 	logger := logging.LoggerEntryWithTag("main", "logger")
 	logger.Infof("Supported plugin transports: %s", strings.Join(plugin.SupportedTransports(), ", "))
 
-	if ctx.Scheduler != nil {
-		ctx.Scheduler.Start()
-	}
-
-	for _, pluginConfig := range config.Plugin {
-		ctx.AddPluginConfiguration(pluginConfig.Transport, pluginConfig.Path, pluginConfig.Args)
+	for name, pluginConfig := range config.Plugin {
+		ctx.AddPlugin(name, *pluginConfig)
 	}
 
 	ctx.InitPlugins()
+
+	// Reload plugins on SIGHUP, such that changes to plugins take effect
+	// without restarting the server.
+	sighup := make(chan os.Signal, 1)
+	signal.Notify(sighup, syscall.SIGHUP)
+	go func() {
+		for range sighup {
+			logger.Info("Received SIGHUP, reloading plugins")
+			if err := ctx.ReloadPlugins(); err != nil {
+				logger.WithError(err).Error("Fail to reload plugins")
+			}
+		}
+	}()
 }
 
 func initLogger(config skyconfig.Configuration) {
@@ -0,0 +1,65 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package asset
+
+import (
+	"time"
+)
+
+// UserURLExpiry is the validity period of URLs signed for a user, which
+// is shorter than other signed URLs as they are only used for the user's
+// immediate access
+const UserURLExpiry = 5 * time.Minute
+
+// UserURLSigner signs URLs accessible only to a user. If record ACL is
+// required, an asset is only accessible to the users who can read a
+// record referencing the asset, through a URL signed for the user.
+type UserURLSigner interface {
+	// SignedURLForUser returns a URL of the named file, transformed if
+	// transform is not nil, which is only valid for the user of userID.
+	// An empty userID is for a user not logged in.
+	SignedURLForUser(name string, transform *ImageTransform, userID string) (string, error)
+	IsRecordACLRequired() bool
+}
+
+// UserSigningName returns the string signed for the named asset with the
+// user, so that a URL signed for a user is not valid for other users
+func UserSigningName(name string, userID string) string {
+	return name + "\x00user_id=" + userID
+}
+
+// SignerForUser returns the URLSigner of the store signing URLs for the
+// user if record ACL is required, or the store itself otherwise
+func SignerForUser(store Store, userID string) (URLSigner, bool) {
+	if userSigner, ok := store.(UserURLSigner); ok && userSigner.IsRecordACLRequired() {
+		return userURLSigner{userSigner, userID}, true
+	}
+	signer, ok := store.(URLSigner)
+	return signer, ok
+}
+
+// userURLSigner is a URLSigner signing URLs for a user
+type userURLSigner struct {
+	signer UserURLSigner
+	userID string
+}
+
+func (s userURLSigner) SignedURL(name string) (string, error) {
+	return s.signer.SignedURLForUser(name, nil, s.userID)
+}
+
+func (s userURLSigner) IsSignatureRequired() bool {
+	return true
+}
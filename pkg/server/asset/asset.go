@@ -16,17 +16,39 @@ package asset
 
 import (
 	"io"
+	"os"
+	"strings"
 	"time"
 
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+
 	"github.com/skygeario/skygear-server/pkg/server/logging"
 )
 
 var log = logging.LoggerEntry("asset")
 
 // PostFileRequest models the POST request for upload asset file
+//
+// If PutRequest is not nil, the file can be uploaded directly to the asset
+// store with a PUT request instead.
 type PostFileRequest struct {
 	Action      string                 `json:"action"`
 	ExtraFields map[string]interface{} `json:"extra-fields,omitempty"`
+	PutRequest  *PutFileRequest        `json:"put-request,omitempty"`
+}
+
+// IsDirect returns whether the file is uploaded to the asset store
+// directly, instead of through the server
+func (r *PostFileRequest) IsDirect() bool {
+	return !strings.HasPrefix(r.Action, "/files/")
+}
+
+// PutFileRequest models the PUT request for uploading asset file, which
+// must be sent with the headers
+type PutFileRequest struct {
+	URL     string            `json:"url"`
+	Headers map[string]string `json:"headers,omitempty"`
 }
 
 // FileRange models a byte range of a file
@@ -47,6 +69,15 @@ type FileGetter interface {
 	GetFileReader(name string) (io.ReadCloser, error)
 }
 
+// IsNotExist returns whether the error returned by GetFileReader is
+// caused by the file not existing in the asset store
+func IsNotExist(err error) bool {
+	if aerr, ok := err.(awserr.Error); ok {
+		return aerr.Code() == s3.ErrCodeNoSuchKey
+	}
+	return os.IsNotExist(err)
+}
+
 // FileRangedGetter defines the interface of a getter for files supportting
 // getting file within a byte range
 type FileRangedGetter interface {
@@ -56,6 +87,12 @@ type FileRangedGetter interface {
 	) (*FileRangedGetResult, error)
 }
 
+// FileVersionGetter defines the interface of a getter of the version of
+// files, which changes whenever the file is stored again
+type FileVersionGetter interface {
+	GetFileVersion(name string) (string, error)
+}
+
 // FilePutter defines the interface of a putter for files
 type FilePutter interface {
 	PutFileReader(
@@ -66,6 +103,13 @@ type FilePutter interface {
 	) error
 }
 
+// FileDeleter defines the interface of a deleter for files
+type FileDeleter interface {
+	// Delete deletes the named file, together with the transformed
+	// images cached for it.
+	Delete(name string) error
+}
+
 // FilePostRequestGenerator defines the interface of a generator
 // for post file request
 type FilePostRequestGenerator interface {
@@ -76,10 +120,56 @@ type FilePostRequestGenerator interface {
 	) (*PostFileRequest, error)
 }
 
+// MultipartUploadRequest models the requests for uploading a file in parts
+// directly to the asset store. Each part is uploaded with a PUT request to
+// its URL, and the upload is completed by a POST request to Action with
+// the ETag returned for each part.
+type MultipartUploadRequest struct {
+	Action   string                `json:"action"`
+	UploadID string                `json:"upload-id"`
+	PartSize int64                 `json:"part-size"`
+	Parts    []MultipartUploadPart `json:"parts"`
+}
+
+// MultipartUploadPart models the request for uploading a part of a file
+type MultipartUploadPart struct {
+	PartNumber int    `json:"part-number"`
+	URL        string `json:"url"`
+}
+
+// CompletedPart models a part of a file uploaded to the asset store
+type CompletedPart struct {
+	PartNumber int    `mapstructure:"part-number"`
+	ETag       string `mapstructure:"etag"`
+}
+
+// FileMultipartUploader defines the interface of an asset store
+// accepting files uploaded in parts directly
+type FileMultipartUploader interface {
+	GenerateMultipartUploadRequest(
+		name string,
+		contentType string,
+		length int64,
+	) (*MultipartUploadRequest, error)
+	// RenewMultipartUploadRequest returns the request of a multipart
+	// upload initiated already, with the part URLs signed anew
+	RenewMultipartUploadRequest(
+		name string,
+		uploadID string,
+		length int64,
+	) (*MultipartUploadRequest, error)
+	// CompleteMultipartUpload assembles the parts into the named file.
+	// The file is deleted and MultipartUploadSizeError is returned if
+	// the file is not of length bytes.
+	CompleteMultipartUpload(name string, uploadID string, parts []CompletedPart, length int64) error
+	AbortMultipartUpload(name string, uploadID string) error
+}
+
 // Store specify the interfaces of an asset store
 type Store interface {
 	FileGetter
 	FilePutter
+	FileDeleter
 	FilePostRequestGenerator
 }
 
@@ -92,6 +182,18 @@ type URLSigner interface {
 	IsSignatureRequired() bool
 }
 
+// TransformURLSigner signs a URL to an image asset transformed on the fly.
+// The transform is part of what is signed.
+type TransformURLSigner interface {
+	SignedTransformURL(name string, transform ImageTransform) (string, error)
+}
+
+// TransformedImageCounter counts the transformed images cached for the
+// named asset, so that the number of variants can be capped.
+type TransformedImageCounter interface {
+	CountTransformedImages(name string) (int, error)
+}
+
 // URLSignerStore is an interface that is a union of Store and URLSigner.
 //go:generate mockgen -destination=mock_asset/mock_url_signer_store.go github.com/skygeario/skygear-server/pkg/server/asset URLSignerStore
 type URLSignerStore interface {
@@ -178,6 +178,13 @@ func (s cloudStore) PutFileReader(
 	)
 }
 
+// Delete deletes the file
+func (s cloudStore) Delete(name string) error {
+	return errors.New(
+		"Asset deletion for cloud-based asset store is not available",
+	)
+}
+
 // GeneratePostFileRequest return a PostFileRequest for uploading asset
 func (s cloudStore) GeneratePostFileRequest(name string, contentType string, length int64) (*PostFileRequest, error) {
 	log.
@@ -0,0 +1,79 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package asset
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"path"
+)
+
+// ContentAddressedPrefix is the prefix of the names under which files are
+// stored by the hash of their content
+const ContentAddressedPrefix = "_content"
+
+// ContentAddressedStore defines the interface of an asset store able to
+// store files by the SHA-256 hash of their content, such that identical
+// files are stored once however many assets they are uploaded as.
+type ContentAddressedStore interface {
+	// PutContentAddressedFileReader stores a file from reader under the
+	// name derived from the hash of its content, see ContentObjectName,
+	// and returns the hex-encoded hash. The content is hashed while it is
+	// stored.
+	//
+	// reference is called with the hash before the file is stored under
+	// the name, such that the file is referenced before it can be found
+	// by the hash. The file is not stored if reference returns an error.
+	PutContentAddressedFileReader(
+		src io.Reader,
+		length int64,
+		contentType string,
+		reference func(hash string) error,
+	) (hash string, err error)
+
+	// SignedContentURL returns a url with access to the named asset, of
+	// which the content is stored by the hash.
+	SignedContentURL(name string, hash string) (string, error)
+}
+
+// ContentObjectName returns the name under which the file of the content
+// hash is stored
+func ContentObjectName(hash string) string {
+	return path.Join(ContentAddressedPrefix, hash[:2], hash)
+}
+
+// IsValidContentHash returns whether hash is a hex-encoded SHA-256 hash
+// in lower case
+func IsValidContentHash(hash string) bool {
+	if len(hash) != sha256.Size*2 {
+		return false
+	}
+	for _, c := range hash {
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+// hashContent returns a reader of src, of which the content read is
+// hashed into the returned function
+func hashContent(src io.Reader) (io.Reader, func() string) {
+	h := sha256.New()
+	return io.TeeReader(src, h), func() string {
+		return hex.EncodeToString(h.Sum(nil))
+	}
+}
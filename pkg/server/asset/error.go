@@ -30,3 +30,48 @@ func (e FileRangeNotAcceptedError) Error() string {
 		e.Range.To,
 	)
 }
+
+// MultipartUploadSizeError defines the error of a completed multipart
+// upload of which the size differs from the declared length
+type MultipartUploadSizeError struct {
+	Length int64
+	Size   int64
+}
+
+func (e MultipartUploadSizeError) Error() string {
+	return fmt.Sprintf(
+		"Uploaded file of %d bytes does not match the upload length %d",
+		e.Size,
+		e.Length,
+	)
+}
+
+// InvalidImageTransformError defines the error of an invalid image
+// transform parameter
+type InvalidImageTransformError struct {
+	Param  string
+	Reason string
+}
+
+func (e InvalidImageTransformError) Error() string {
+	return fmt.Sprintf("Image transform %s %s", e.Param, e.Reason)
+}
+
+// UploadPolicyError defines the error of an asset violating the upload
+// policy
+type UploadPolicyError struct {
+	// Field is the record field of the violated policy, in the format of
+	// record_type.field, or empty for the global policy
+	Field string
+	// MaxSize is the maximum size of the violated policy if the asset is
+	// too large, or zero otherwise
+	MaxSize int64
+	Reason  string
+}
+
+func (e UploadPolicyError) Error() string {
+	if e.Field == "" {
+		return fmt.Sprintf("Asset %s", e.Reason)
+	}
+	return fmt.Sprintf("Asset of %s %s", e.Field, e.Reason)
+}
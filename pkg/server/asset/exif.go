@@ -0,0 +1,430 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package asset
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"strings"
+)
+
+// EXIFStripping defines the metadata stripped from uploaded JPEG images.
+// The GPS location is stripped if it is not specified.
+type EXIFStripping string
+
+const (
+	// EXIFStripNone keeps the metadata of uploaded images
+	EXIFStripNone EXIFStripping = "none"
+	// EXIFStripGPS removes the GPS location from the EXIF metadata,
+	// keeping the rest like the orientation of the image. XMP metadata
+	// is removed if it has GPS properties.
+	EXIFStripGPS EXIFStripping = "gps"
+	// EXIFStripAll removes all EXIF and XMP metadata
+	EXIFStripAll EXIFStripping = "all"
+)
+
+const (
+	jpegMarkerSOI  = 0xD8
+	jpegMarkerAPP0 = 0xE0
+	jpegMarkerAPP1 = 0xE1
+	jpegMarkerAPPF = 0xEF
+	jpegMarkerCOM  = 0xFE
+)
+
+// maxJPEGHeaderSize limits the metadata segments of a JPEG image buffered
+// in memory. The EXIF segment is at the beginning of an image.
+const maxJPEGHeaderSize = 1 << 20
+
+// errJPEGHeaderTooLarge is returned by readJPEGHeader if the metadata
+// segments exceed maxJPEGHeaderSize
+var errJPEGHeaderTooLarge = errors.New("jpeg metadata is too large")
+
+const exifIdentifier = "Exif\x00\x00"
+
+// identifiers of the APP1 segments of XMP metadata, where the extended
+// XMP carries the part of the metadata too large for a segment
+const (
+	xmpIdentifier         = "http://ns.adobe.com/xap/1.0/\x00"
+	extendedXMPIdentifier = "http://ns.adobe.com/xmp/extension/\x00"
+)
+
+const (
+	exifTagExifIFD = 0x8769
+	exifTagGPSIFD  = 0x8825
+)
+
+// exifTagNames are the names of the EXIF tags extracted, keyed by the IFD
+// pointer tag of the IFD they are in, where 0 is the first IFD
+var exifTagNames = map[uint16]map[uint16]string{
+	0: {
+		0x010F: "Make",
+		0x0110: "Model",
+		0x0112: "Orientation",
+		0x0131: "Software",
+		0x0132: "DateTime",
+		0x013B: "Artist",
+		0x8298: "Copyright",
+	},
+	exifTagExifIFD: {
+		0x829A: "ExposureTime",
+		0x829D: "FNumber",
+		0x8827: "ISOSpeedRatings",
+		0x9003: "DateTimeOriginal",
+		0x9004: "DateTimeDigitized",
+		0x9209: "Flash",
+		0x920A: "FocalLength",
+		0xA405: "FocalLengthIn35mmFilm",
+		0xA433: "LensMake",
+		0xA434: "LensModel",
+	},
+}
+
+// StripEXIF removes the metadata of a JPEG image read from src, and
+// returns a reader of the image with the metadata removed. The metadata
+// is overwritten with zeros such that the length of the image is not
+// changed. Content other than a JPEG image is read unchanged.
+//
+// stripped is true if any metadata is removed. UploadPolicyError is
+// returned if the metadata is too large to be stripped.
+func StripEXIF(src io.Reader, stripping EXIFStripping) (reader io.Reader, stripped bool, err error) {
+	if stripping == EXIFStripNone {
+		return src, false, nil
+	}
+
+	header, err := readJPEGHeader(src, func(marker byte, payload []byte) {
+		if marker != jpegMarkerAPP1 {
+			return
+		}
+		if stripping == EXIFStripAll {
+			zero(payload)
+			stripped = true
+			return
+		}
+		if bytes.HasPrefix(payload, []byte(exifIdentifier)) {
+			stripped = stripEXIFGPS(payload[len(exifIdentifier):]) || stripped
+		} else if isXMPWithGPS(payload) {
+			zero(payload)
+			stripped = true
+		}
+	})
+	if err == errJPEGHeaderTooLarge {
+		return nil, false, UploadPolicyError{
+			Reason: "has metadata too large to be stripped",
+		}
+	}
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return nil, false, err
+	}
+	return io.MultiReader(bytes.NewReader(header), src), stripped, nil
+}
+
+// isXMPWithGPS returns whether the APP1 payload is XMP metadata with GPS
+// properties, like exif:GPSLatitude. Extended XMP is always considered
+// to have GPS properties, because a property can be split across the
+// segments of extended XMP.
+func isXMPWithGPS(payload []byte) bool {
+	if bytes.HasPrefix(payload, []byte(extendedXMPIdentifier)) {
+		return true
+	}
+	return bytes.HasPrefix(payload, []byte(xmpIdentifier)) &&
+		bytes.Contains(payload[len(xmpIdentifier):], []byte(":GPS"))
+}
+
+// readJPEGEXIF returns the EXIF metadata of a JPEG image, which is nil
+// if the image has no EXIF metadata
+func readJPEGEXIF(src io.Reader) (map[string]interface{}, error) {
+	var exif map[string]interface{}
+	_, err := readJPEGHeader(src, func(marker byte, payload []byte) {
+		if exif != nil || marker != jpegMarkerAPP1 {
+			return
+		}
+		if bytes.HasPrefix(payload, []byte(exifIdentifier)) {
+			exif = parseEXIF(payload[len(exifIdentifier):])
+		}
+	})
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF && err != errJPEGHeaderTooLarge {
+		return nil, err
+	}
+	return exif, nil
+}
+
+// readJPEGHeader reads the APPn and COM segments at the beginning of
+// a JPEG image, calling fn with the payload of each of them, and returns
+// the bytes read from src. fn may modify the payload. Nothing more than
+// the SOI marker is read if src is not a JPEG image.
+// errJPEGHeaderTooLarge is returned with the bytes read if the segments
+// do not end within maxJPEGHeaderSize.
+func readJPEGHeader(src io.Reader, fn func(marker byte, payload []byte)) ([]byte, error) {
+	header := []byte{}
+	read := func(n int) ([]byte, error) {
+		start := len(header)
+		header = append(header, make([]byte, n)...)
+		read, err := io.ReadFull(src, header[start:])
+		header = header[:start+read]
+		return header[start:], err
+	}
+
+	soi, err := read(2)
+	if err != nil || soi[0] != 0xFF || soi[1] != jpegMarkerSOI {
+		return header, err
+	}
+
+	for len(header) < maxJPEGHeaderSize {
+		segment, err := read(4)
+		if err != nil {
+			return header, err
+		}
+		marker := segment[1]
+		isMetadata := marker >= jpegMarkerAPP0 && marker <= jpegMarkerAPPF ||
+			marker == jpegMarkerCOM
+		if segment[0] != 0xFF || !isMetadata {
+			return header, nil
+		}
+
+		length := int(binary.BigEndian.Uint16(segment[2:]))
+		if length < 2 {
+			return header, nil
+		}
+		payload, err := read(length - 2)
+		if err != nil {
+			return header, err
+		}
+		fn(marker, payload)
+	}
+	return header, errJPEGHeaderTooLarge
+}
+
+// tiffEntry is an entry of an IFD in TIFF structure
+type tiffEntry struct {
+	tag   uint16
+	typ   uint16
+	count uint32
+	// offset is where the entry is in the TIFF structure
+	offset int
+	// valueOffset is where the value of the entry is, which is within
+	// the entry if it fits into 4 bytes
+	valueOffset int
+}
+
+// tiffTypeSizes are the sizes of values of TIFF types
+var tiffTypeSizes = map[uint16]int{
+	1:  1, // BYTE
+	2:  1, // ASCII
+	3:  2, // SHORT
+	4:  4, // LONG
+	5:  8, // RATIONAL
+	7:  1, // UNDEFINED
+	9:  4, // SLONG
+	10: 8, // SRATIONAL
+}
+
+func (e tiffEntry) size() int {
+	return tiffTypeSizes[e.typ] * int(e.count)
+}
+
+// tiffData is the TIFF structure in which EXIF metadata is stored
+type tiffData struct {
+	data  []byte
+	order binary.ByteOrder
+}
+
+func newTIFFData(data []byte) (*tiffData, uint32, bool) {
+	if len(data) < 8 {
+		return nil, 0, false
+	}
+
+	var order binary.ByteOrder
+	switch string(data[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return nil, 0, false
+	}
+	if order.Uint16(data[2:]) != 42 {
+		return nil, 0, false
+	}
+	return &tiffData{data, order}, order.Uint32(data[4:]), true
+}
+
+// entries returns the entries of the IFD at offset, skipping those of
+// which the value is out of bound
+func (t *tiffData) entries(offset uint32) []tiffEntry {
+	if uint64(offset)+2 > uint64(len(t.data)) {
+		return nil
+	}
+	count := int(t.order.Uint16(t.data[offset:]))
+	entries := []tiffEntry{}
+	for i := 0; i < count; i++ {
+		entryOffset := int(offset) + 2 + i*12
+		if entryOffset+12 > len(t.data) {
+			break
+		}
+		e := tiffEntry{
+			tag:         t.order.Uint16(t.data[entryOffset:]),
+			typ:         t.order.Uint16(t.data[entryOffset+2:]),
+			count:       t.order.Uint32(t.data[entryOffset+4:]),
+			offset:      entryOffset,
+			valueOffset: entryOffset + 8,
+		}
+		if e.count > uint32(len(t.data)) {
+			continue
+		}
+		if e.size() > 4 {
+			e.valueOffset = int(t.order.Uint32(t.data[entryOffset+8:]))
+		}
+		if e.valueOffset < 0 || e.valueOffset+e.size() > len(t.data) {
+			continue
+		}
+		entries = append(entries, e)
+	}
+	return entries
+}
+
+// value returns the value of the entry, which is the first one if the
+// entry has multiple values. Values of unsupported types are nil.
+func (t *tiffData) value(e tiffEntry) interface{} {
+	if e.count == 0 {
+		return nil
+	}
+
+	v := t.data[e.valueOffset : e.valueOffset+e.size()]
+	switch e.typ {
+	case 1:
+		return int(v[0])
+	case 2:
+		return strings.TrimSpace(strings.SplitN(string(v), "\x00", 2)[0])
+	case 3:
+		return int(t.order.Uint16(v))
+	case 4:
+		return int(t.order.Uint32(v))
+	case 9:
+		return int(int32(t.order.Uint32(v)))
+	case 5, 10:
+		return t.rational(e, 0)
+	}
+	return nil
+}
+
+// rational returns the i-th value of a RATIONAL or SRATIONAL entry
+func (t *tiffData) rational(e tiffEntry, i int) interface{} {
+	if (e.typ != 5 && e.typ != 10) || uint32(i) >= e.count {
+		return nil
+	}
+
+	v := t.data[e.valueOffset+i*8:]
+	if e.typ == 10 {
+		num, denom := int32(t.order.Uint32(v)), int32(t.order.Uint32(v[4:]))
+		if denom == 0 {
+			return nil
+		}
+		return float64(num) / float64(denom)
+	}
+	num, denom := t.order.Uint32(v), t.order.Uint32(v[4:])
+	if denom == 0 {
+		return nil
+	}
+	return float64(num) / float64(denom)
+}
+
+// parseEXIF returns the values of the EXIF tags in exifTagNames. nil is
+// returned if none of the tags is found. The GPS IFD is never read, so
+// that the location of the uploader is not published with the asset even
+// if it is not stripped from the image.
+func parseEXIF(data []byte) map[string]interface{} {
+	t, offset, ok := newTIFFData(data)
+	if !ok {
+		return nil
+	}
+
+	exif := map[string]interface{}{}
+	ifds := map[uint16]uint32{0: offset}
+	for _, e := range t.entries(offset) {
+		if e.tag == exifTagExifIFD {
+			if pointer, ok := t.value(e).(int); ok {
+				ifds[e.tag] = uint32(pointer)
+			}
+		}
+	}
+
+	for ifd, names := range exifTagNames {
+		pointer, ok := ifds[ifd]
+		if !ok {
+			continue
+		}
+		for _, e := range t.entries(pointer) {
+			name, ok := names[e.tag]
+			if !ok {
+				continue
+			}
+			if v := t.value(e); v != nil {
+				exif[name] = v
+			}
+		}
+	}
+
+	if len(exif) == 0 {
+		return nil
+	}
+	return exif
+}
+
+// stripEXIFGPS empties the GPS IFD of the EXIF metadata in place, and
+// returns whether the IFD has any entries
+func stripEXIFGPS(data []byte) bool {
+	t, offset, ok := newTIFFData(data)
+	if !ok {
+		return false
+	}
+
+	pointer := -1
+	for _, e := range t.entries(offset) {
+		if e.tag == exifTagGPSIFD {
+			if v, ok := t.value(e).(int); ok {
+				pointer = v
+			}
+		}
+	}
+	if pointer < 0 || pointer+2 > len(data) {
+		return false
+	}
+
+	count := int(t.order.Uint16(data[pointer:]))
+	if count == 0 {
+		return false
+	}
+	for _, e := range t.entries(uint32(pointer)) {
+		if e.size() > 4 {
+			zero(data[e.valueOffset : e.valueOffset+e.size()])
+		}
+	}
+	// the IFD is read as empty and not followed by other IFDs once its
+	// entry count and entries are zeroed
+	end := pointer + 2 + count*12
+	if end > len(data) {
+		end = len(data)
+	}
+	zero(data[pointer:end])
+	return true
+}
+
+func zero(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+}
@@ -0,0 +1,268 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package asset
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/jpeg"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+type testTIFFEntry struct {
+	tag   uint16
+	typ   uint16
+	count uint32
+	value []byte
+}
+
+func testTIFFRational(values ...uint32) []byte {
+	b := make([]byte, 4*len(values))
+	for i, v := range values {
+		binary.LittleEndian.PutUint32(b[i*4:], v)
+	}
+	return b
+}
+
+// buildTestTIFF builds EXIF metadata in little endian TIFF structure,
+// with the GPS IFD if gps is not nil
+func buildTestTIFF(ifd0 []testTIFFEntry, gps []testTIFFEntry) []byte {
+	if gps != nil {
+		ifd0 = append(ifd0, testTIFFEntry{exifTagGPSIFD, 4, 1, nil})
+	}
+	gpsOffset := 8 + 2 + len(ifd0)*12 + 4
+	dataOffset := gpsOffset + 2 + len(gps)*12 + 4
+
+	order := binary.LittleEndian
+	ifds := []byte{}
+	data := []byte{}
+	writeIFD := func(entries []testTIFFEntry) {
+		ifd := make([]byte, 2+len(entries)*12+4)
+		order.PutUint16(ifd, uint16(len(entries)))
+		for i, e := range entries {
+			entry := ifd[2+i*12:]
+			order.PutUint16(entry, e.tag)
+			order.PutUint16(entry[2:], e.typ)
+			order.PutUint32(entry[4:], e.count)
+			switch {
+			case e.tag == exifTagGPSIFD:
+				order.PutUint32(entry[8:], uint32(gpsOffset))
+			case len(e.value) <= 4:
+				copy(entry[8:], e.value)
+			default:
+				order.PutUint32(entry[8:], uint32(dataOffset+len(data)))
+				data = append(data, e.value...)
+			}
+		}
+		ifds = append(ifds, ifd...)
+	}
+	writeIFD(ifd0)
+	writeIFD(gps)
+
+	tiff := []byte{'I', 'I', 42, 0, 8, 0, 0, 0}
+	tiff = append(tiff, ifds...)
+	return append(tiff, data...)
+}
+
+// encodeTestJPEG encodes an image with the TIFF structure as the EXIF
+// metadata
+func encodeTestJPEG(width int, height int, tiff []byte) []byte {
+	buf := bytes.Buffer{}
+	jpeg.Encode(&buf, image.NewGray(image.Rect(0, 0, width, height)), nil)
+	img := buf.Bytes()
+
+	payload := append([]byte(exifIdentifier), tiff...)
+	app1 := []byte{0xFF, jpegMarkerAPP1, 0, 0}
+	binary.BigEndian.PutUint16(app1[2:], uint16(len(payload)+2))
+	app1 = append(app1, payload...)
+
+	jpg := append([]byte{}, img[:2]...)
+	jpg = append(jpg, app1...)
+	return append(jpg, img[2:]...)
+}
+
+// insertTestSegment inserts a metadata segment after the SOI marker
+func insertTestSegment(jpg []byte, marker byte, payload []byte) []byte {
+	segment := []byte{0xFF, marker, 0, 0}
+	binary.BigEndian.PutUint16(segment[2:], uint16(len(payload)+2))
+	segment = append(segment, payload...)
+
+	inserted := append([]byte{}, jpg[:2]...)
+	inserted = append(inserted, segment...)
+	return append(inserted, jpg[2:]...)
+}
+
+func testEXIFJPEG() []byte {
+	return encodeTestJPEG(4, 3, buildTestTIFF([]testTIFFEntry{
+		{0x010F, 2, 8, []byte("Skygear\x00")},
+		{0x0112, 3, 1, []byte{6, 0}},
+	}, []testTIFFEntry{
+		{0x0001, 2, 2, []byte("N\x00")},
+		{0x0002, 5, 3, testTIFFRational(22, 1, 30, 1, 0, 1)},
+		{0x0003, 2, 2, []byte("W\x00")},
+		{0x0004, 5, 3, testTIFFRational(114, 1, 15, 1, 0, 1)},
+		{0x0005, 1, 1, []byte{0}},
+		{0x0006, 5, 1, testTIFFRational(10, 2)},
+	}))
+}
+
+func TestReadJPEGEXIF(t *testing.T) {
+	Convey("readJPEGEXIF", t, func() {
+		Convey("read tags without GPS location", func() {
+			exif, err := readJPEGEXIF(bytes.NewReader(testEXIFJPEG()))
+			So(err, ShouldBeNil)
+			So(exif, ShouldResemble, map[string]interface{}{
+				"Make":        "Skygear",
+				"Orientation": 6,
+			})
+		})
+
+		Convey("read image without EXIF", func() {
+			exif, err := readJPEGEXIF(bytes.NewReader(encodeTestPNG(1, 1)))
+			So(err, ShouldBeNil)
+			So(exif, ShouldBeNil)
+		})
+
+		Convey("ignore malformed EXIF", func() {
+			jpg := encodeTestJPEG(1, 1, []byte("MM\x00\x2a\xff\xff\xff\xff"))
+			exif, err := readJPEGEXIF(bytes.NewReader(jpg))
+			So(err, ShouldBeNil)
+			So(exif, ShouldBeNil)
+		})
+
+		Convey("read truncated image", func() {
+			exif, err := readJPEGEXIF(bytes.NewReader(testEXIFJPEG()[:20]))
+			So(err, ShouldBeNil)
+			So(exif, ShouldBeNil)
+		})
+	})
+}
+
+func TestStripEXIF(t *testing.T) {
+	Convey("StripEXIF", t, func() {
+		jpg := testEXIFJPEG()
+
+		strip := func(src []byte, stripping EXIFStripping) ([]byte, bool) {
+			reader, stripped, err := StripEXIF(bytes.NewReader(src), stripping)
+			So(err, ShouldBeNil)
+			data, err := ioutil.ReadAll(reader)
+			So(err, ShouldBeNil)
+			return data, stripped
+		}
+
+		Convey("strip GPS location", func() {
+			data, stripped := strip(jpg, EXIFStripGPS)
+			So(stripped, ShouldBeTrue)
+			So(len(data), ShouldEqual, len(jpg))
+
+			exif, err := readJPEGEXIF(bytes.NewReader(data))
+			So(err, ShouldBeNil)
+			So(exif, ShouldResemble, map[string]interface{}{
+				"Make":        "Skygear",
+				"Orientation": 6,
+			})
+			_, err = jpeg.Decode(bytes.NewReader(data))
+			So(err, ShouldBeNil)
+
+			_, stripped = strip(data, EXIFStripGPS)
+			So(stripped, ShouldBeFalse)
+		})
+
+		Convey("strip all metadata", func() {
+			data, stripped := strip(jpg, EXIFStripAll)
+			So(stripped, ShouldBeTrue)
+			So(len(data), ShouldEqual, len(jpg))
+
+			exif, err := readJPEGEXIF(bytes.NewReader(data))
+			So(err, ShouldBeNil)
+			So(exif, ShouldBeNil)
+			_, err = jpeg.Decode(bytes.NewReader(data))
+			So(err, ShouldBeNil)
+		})
+
+		Convey("strip XMP with GPS location", func() {
+			xmp := xmpIdentifier + `<x:xmpmeta xmlns:x="adobe:ns:meta/"><rdf:RDF>` +
+				`<rdf:Description exif:GPSLatitude="22,30.0N" exif:GPSLongitude="114,15.0E"/>` +
+				`</rdf:RDF></x:xmpmeta>`
+			src := insertTestSegment(jpg, jpegMarkerAPP1, []byte(xmp))
+			data, stripped := strip(src, EXIFStripGPS)
+			So(stripped, ShouldBeTrue)
+			So(len(data), ShouldEqual, len(src))
+			So(string(data), ShouldNotContainSubstring, "GPSLatitude")
+			_, err := jpeg.Decode(bytes.NewReader(data))
+			So(err, ShouldBeNil)
+		})
+
+		Convey("not strip XMP without GPS location", func() {
+			xmp := xmpIdentifier + `<x:xmpmeta xmlns:x="adobe:ns:meta/"><rdf:RDF>` +
+				`<rdf:Description xmp:Rating="5"/>` +
+				`</rdf:RDF></x:xmpmeta>`
+			src := encodeTestJPEG(1, 1, buildTestTIFF([]testTIFFEntry{
+				{0x0112, 3, 1, []byte{1, 0}},
+			}, nil))
+			src = insertTestSegment(src, jpegMarkerAPP1, []byte(xmp))
+			data, stripped := strip(src, EXIFStripGPS)
+			So(stripped, ShouldBeFalse)
+			So(data, ShouldResemble, src)
+		})
+
+		Convey("reject metadata too large to be stripped", func() {
+			src := jpg
+			for i := 0; i < 17; i++ {
+				src = insertTestSegment(src, jpegMarkerCOM, make([]byte, 65000))
+			}
+			_, _, err := StripEXIF(bytes.NewReader(src), EXIFStripGPS)
+			So(err, ShouldResemble, UploadPolicyError{
+				Reason: "has metadata too large to be stripped",
+			})
+
+			_, err = readJPEGEXIF(bytes.NewReader(src))
+			So(err, ShouldBeNil)
+		})
+
+		Convey("not strip without GPS location", func() {
+			src := encodeTestJPEG(1, 1, buildTestTIFF([]testTIFFEntry{
+				{0x0112, 3, 1, []byte{1, 0}},
+			}, nil))
+			data, stripped := strip(src, EXIFStripGPS)
+			So(stripped, ShouldBeFalse)
+			So(data, ShouldResemble, src)
+		})
+
+		Convey("not strip other content", func() {
+			src := encodeTestPNG(2, 2)
+			data, stripped := strip(src, EXIFStripAll)
+			So(stripped, ShouldBeFalse)
+			So(data, ShouldResemble, src)
+
+			data, stripped = strip([]byte("x"), EXIFStripAll)
+			So(stripped, ShouldBeFalse)
+			So(string(data), ShouldEqual, "x")
+		})
+
+		Convey("not strip if disabled", func() {
+			src := strings.NewReader("content")
+			reader, stripped, err := StripEXIF(src, EXIFStripNone)
+			So(err, ShouldBeNil)
+			So(stripped, ShouldBeFalse)
+			So(reader, ShouldEqual, src)
+		})
+	})
+}
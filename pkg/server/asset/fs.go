@@ -33,15 +33,22 @@ import (
 
 // fileStore implements Store by storing files on file system
 type fileStore struct {
-	dir    string
-	prefix string
-	secret string
-	public bool
+	dir       string
+	prefix    string
+	secret    string
+	public    bool
+	recordACL bool
 }
 
 // NewFileStore creates a new fileStore
 func NewFileStore(dir, prefix, secret string, public bool) Store {
-	return &fileStore{dir, prefix, secret, public}
+	return &fileStore{dir, prefix, secret, public, false}
+}
+
+// NewRecordACLFileStore creates a new fileStore requiring record ACL, see
+// UserURLSigner
+func NewRecordACLFileStore(dir, prefix, secret string) Store {
+	return &fileStore{dir, prefix, secret, false, true}
 }
 
 // GetFileReader returns a reader for reading files
@@ -120,6 +127,89 @@ func (s *fileStore) PutFileReader(name string, src io.Reader, length int64, cont
 	return nil
 }
 
+// PutContentAddressedFileReader stores a file from reader onto file system
+// by the hash of its content. The file is written to a temporary file
+// first, and moved to its name once the hash is known and referenced.
+func (s *fileStore) PutContentAddressedFileReader(
+	src io.Reader,
+	length int64,
+	contentType string,
+	reference func(hash string) error,
+) (string, error) {
+	dir := filepath.Join(s.dir, ContentAddressedPrefix)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+
+	f, err := ioutil.TempFile(dir, "upload-")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(f.Name())
+
+	reader, hash := hashContent(src)
+	written, err := io.Copy(f, reader)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return "", err
+	}
+
+	if written != length {
+		return "", fmt.Errorf("got written %d bytes, expect %d", written, length)
+	}
+
+	if err := reference(hash()); err != nil {
+		return "", err
+	}
+
+	path := filepath.Join(s.dir, ContentObjectName(hash()))
+	if _, err := os.Stat(path); err == nil {
+		// identical content is stored already
+		return hash(), nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return "", err
+	}
+	if err := os.Rename(f.Name(), path); err != nil {
+		return "", err
+	}
+	return hash(), nil
+}
+
+// SignedContentURL returns a signed url of the named asset, which is
+// served by name regardless of where its content is stored
+func (s *fileStore) SignedContentURL(name string, hash string) (string, error) {
+	return s.SignedURL(name)
+}
+
+// CountTransformedImages returns the number of transformed images cached
+// for the named asset
+func (s *fileStore) CountTransformedImages(name string) (int, error) {
+	files, err := ioutil.ReadDir(filepath.Join(s.dir, TransformedAssetPrefix, name))
+	if os.IsNotExist(err) {
+		return 0, nil
+	} else if err != nil {
+		return 0, err
+	}
+	return len(files), nil
+}
+
+// Delete removes the file and its transformed images from file system
+func (s *fileStore) Delete(name string) error {
+	if err := os.RemoveAll(filepath.Join(s.dir, TransformedAssetPrefix, name)); err != nil {
+		return err
+	}
+
+	err := os.Remove(filepath.Join(s.dir, name))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
 // GeneratePostFileRequest return a PostFileRequest for uploading asset
 func (s *fileStore) GeneratePostFileRequest(name string, contentType string, length int64) (*PostFileRequest, error) {
 	return &PostFileRequest{
@@ -129,26 +219,69 @@ func (s *fileStore) GeneratePostFileRequest(name string, contentType string, len
 
 // SignedURL returns a signed url with expiry date
 func (s *fileStore) SignedURL(name string) (string, error) {
-	if !s.IsSignatureRequired() {
-		return fmt.Sprintf("%s/%s", s.prefix, url.PathEscape(name)), nil
+	if s.recordACL {
+		return s.SignedURLForUser(name, nil, "")
 	}
+	return s.signedURL(name, nil, nil)
+}
 
-	expiredAt := time.Now().Add(time.Minute * time.Duration(15))
-	expiredAtStr := strconv.FormatInt(expiredAt.Unix(), 10)
+// SignedTransformURL returns a signed url of the transformed image with
+// expiry date
+func (s *fileStore) SignedTransformURL(name string, transform ImageTransform) (string, error) {
+	if s.recordACL {
+		return s.SignedURLForUser(name, &transform, "")
+	}
+	return s.signedURL(name, &transform, nil)
+}
 
-	h := hmac.New(sha256.New, []byte(s.secret))
-	io.WriteString(h, name)
-	io.WriteString(h, expiredAtStr)
+// SignedURLForUser returns a signed url only valid for the user, with
+// a shorter expiry date
+func (s *fileStore) SignedURLForUser(name string, transform *ImageTransform, userID string) (string, error) {
+	return s.signedURL(name, transform, &userID)
+}
+
+// IsRecordACLRequired indicates whether assets are only accessible
+// through URLs signed for users
+func (s *fileStore) IsRecordACLRequired() bool {
+	return s.recordACL
+}
+
+func (s *fileStore) signedURL(name string, transform *ImageTransform, userID *string) (string, error) {
+	query := url.Values{}
+	if transform != nil {
+		query = transform.Values()
+	}
+
+	signingName := TransformSigningName(name, transform)
+	expiry := time.Minute * time.Duration(15)
+	if userID != nil {
+		query.Set("user_id", *userID)
+		signingName = UserSigningName(signingName, *userID)
+		expiry = UserURLExpiry
+	}
+
+	if s.IsSignatureRequired() {
+		expiredAt := time.Now().Add(expiry)
+		expiredAtStr := strconv.FormatInt(expiredAt.Unix(), 10)
+
+		h := hmac.New(sha256.New, []byte(s.secret))
+		io.WriteString(h, signingName)
+		io.WriteString(h, expiredAtStr)
 
-	buf := bytes.Buffer{}
-	base64Encoder := base64.NewEncoder(base64.URLEncoding, &buf)
-	base64Encoder.Write(h.Sum(nil))
-	base64Encoder.Close()
+		buf := bytes.Buffer{}
+		base64Encoder := base64.NewEncoder(base64.URLEncoding, &buf)
+		base64Encoder.Write(h.Sum(nil))
+		base64Encoder.Close()
 
-	return fmt.Sprintf(
-		"%s/%s?expiredAt=%s&signature=%s",
-		s.prefix, url.PathEscape(name), expiredAtStr, buf.String(),
-	), nil
+		query.Set("expiredAt", expiredAtStr)
+		query.Set("signature", buf.String())
+	}
+
+	signedURL := fmt.Sprintf("%s/%s", s.prefix, url.PathEscape(name))
+	if len(query) == 0 {
+		return signedURL, nil
+	}
+	return signedURL + "?" + query.Encode(), nil
 }
 
 // ParseSignature tries to parse the asset signature
@@ -1,8 +1,13 @@
 package asset
 
 import (
+	"errors"
+	"io/ioutil"
 	"net/url"
+	"os"
+	"path/filepath"
 	"strconv"
+	"strings"
 	"testing"
 	"time"
 
@@ -17,6 +22,7 @@ func TestFileStore(t *testing.T) {
 			"http://skygear.dev/files",
 			"asset_secret",
 			false,
+			false,
 		}
 		Convey("Sign the Parse Signature correctly", func() {
 			s, err := fsStore.SignedURL("index.html")
@@ -36,6 +42,42 @@ func TestFileStore(t *testing.T) {
 			So(valid, ShouldBeTrue)
 		})
 
+		Convey("Sign the transform together with the name", func() {
+			s, err := fsStore.SignedTransformURL("index.png", ImageTransform{
+				Width:  200,
+				Format: ImageFormatWebP,
+			})
+			So(err, ShouldBeNil)
+			parsedURL, urlErr := url.Parse(s)
+			So(urlErr, ShouldBeNil)
+			So(parsedURL.Path, ShouldEqual, "/files/index.png")
+			qs := parsedURL.Query()
+			So(qs.Get("width"), ShouldEqual, "200")
+			So(qs.Get("format"), ShouldEqual, "webp")
+
+			transform, transformErr := ParseImageTransform(qs)
+			So(transformErr, ShouldBeNil)
+			expiredAtUnix, expiredErr := strconv.ParseInt(qs.Get("expiredAt"), 10, 64)
+			So(expiredErr, ShouldBeNil)
+			expiredAt := time.Unix(expiredAtUnix, 0)
+
+			valid, matchErr := fsStore.ParseSignature(
+				qs.Get("signature"),
+				TransformSigningName("index.png", transform),
+				expiredAt,
+			)
+			So(matchErr, ShouldBeNil)
+			So(valid, ShouldBeTrue)
+
+			valid, matchErr = fsStore.ParseSignature(
+				qs.Get("signature"),
+				"index.png",
+				expiredAt,
+			)
+			So(matchErr, ShouldBeNil)
+			So(valid, ShouldBeFalse)
+		})
+
 		Convey("Parse Signature correctly", func() {
 			expiredAt := time.Unix(1481096834, 0)
 			valid, matchErr := fsStore.ParseSignature(
@@ -60,3 +102,183 @@ func TestFileStore(t *testing.T) {
 
 	})
 }
+
+func TestRecordACLFileStore(t *testing.T) {
+	Convey("FS Asset Store requiring record ACL", t, func() {
+		fsStore := NewRecordACLFileStore(
+			"data/asset",
+			"http://skygear.dev/files",
+			"asset_secret",
+		).(*fileStore)
+		So(fsStore.IsSignatureRequired(), ShouldBeTrue)
+		So(fsStore.IsRecordACLRequired(), ShouldBeTrue)
+
+		parseURL := func(s string) (url.Values, time.Time) {
+			parsedURL, urlErr := url.Parse(s)
+			So(urlErr, ShouldBeNil)
+			qs := parsedURL.Query()
+			expiredAtUnix, expiredErr := strconv.ParseInt(qs.Get("expiredAt"), 10, 64)
+			So(expiredErr, ShouldBeNil)
+			return qs, time.Unix(expiredAtUnix, 0)
+		}
+
+		Convey("Sign the user together with the name", func() {
+			s, err := fsStore.SignedURLForUser("index.html", nil, "user-id")
+			So(err, ShouldBeNil)
+			qs, expiredAt := parseURL(s)
+			So(qs.Get("user_id"), ShouldEqual, "user-id")
+			So(expiredAt, ShouldHappenOnOrBefore, time.Now().Add(UserURLExpiry))
+
+			valid, matchErr := fsStore.ParseSignature(
+				qs.Get("signature"),
+				UserSigningName("index.html", "user-id"),
+				expiredAt,
+			)
+			So(matchErr, ShouldBeNil)
+			So(valid, ShouldBeTrue)
+
+			valid, matchErr = fsStore.ParseSignature(
+				qs.Get("signature"),
+				UserSigningName("index.html", "another-user-id"),
+				expiredAt,
+			)
+			So(matchErr, ShouldBeNil)
+			So(valid, ShouldBeFalse)
+		})
+
+		Convey("Sign URL for user not logged in", func() {
+			s, err := fsStore.SignedURL("index.html")
+			So(err, ShouldBeNil)
+			qs, expiredAt := parseURL(s)
+			So(qs["user_id"], ShouldResemble, []string{""})
+
+			valid, matchErr := fsStore.ParseSignature(
+				qs.Get("signature"),
+				UserSigningName("index.html", ""),
+				expiredAt,
+			)
+			So(matchErr, ShouldBeNil)
+			So(valid, ShouldBeTrue)
+		})
+
+		Convey("Returns signer for user", func() {
+			signer, ok := SignerForUser(fsStore, "user-id")
+			So(ok, ShouldBeTrue)
+			s, err := signer.SignedURL("index.html")
+			So(err, ShouldBeNil)
+			qs, _ := parseURL(s)
+			So(qs.Get("user_id"), ShouldEqual, "user-id")
+		})
+	})
+}
+
+func TestFileStoreDelete(t *testing.T) {
+	Convey("File Store", t, func() {
+		dir, err := ioutil.TempDir("", "skygear-asset")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		fsStore := NewFileStore(dir, "http://skygear.dev/files", "asset_secret", false)
+		So(fsStore.PutFileReader("index.png", strings.NewReader("image"), 5, "image/png"), ShouldBeNil)
+		transformedPath := filepath.Join(dir, TransformedAssetPrefix, "index.png", "thumbnail.png")
+		So(os.MkdirAll(filepath.Dir(transformedPath), 0755), ShouldBeNil)
+		So(ioutil.WriteFile(transformedPath, []byte("image"), 0644), ShouldBeNil)
+
+		Convey("deletes file and transformed images", func() {
+			So(fsStore.Delete("index.png"), ShouldBeNil)
+
+			_, statErr := os.Stat(filepath.Join(dir, "index.png"))
+			So(os.IsNotExist(statErr), ShouldBeTrue)
+			_, statErr = os.Stat(transformedPath)
+			So(os.IsNotExist(statErr), ShouldBeTrue)
+		})
+
+		Convey("deletes non-existing file", func() {
+			So(fsStore.Delete("notexist.png"), ShouldBeNil)
+		})
+	})
+}
+
+// noReference references nothing for PutContentAddressedFileReader
+func noReference(hash string) error {
+	return nil
+}
+
+func TestFileStoreContentAddressed(t *testing.T) {
+	Convey("FS Asset Store storing files by content", t, func() {
+		dir, err := ioutil.TempDir("", "skygear-asset")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		fsStore := &fileStore{dir, "http://skygear.dev/files", "asset_secret", false, false}
+		const helloHash = "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824"
+
+		Convey("stores file by hash", func() {
+			hash, err := fsStore.PutContentAddressedFileReader(strings.NewReader("hello"), 5, "text/plain", noReference)
+			So(err, ShouldBeNil)
+			So(hash, ShouldEqual, helloHash)
+
+			data, err := ioutil.ReadFile(filepath.Join(dir, ContentObjectName(hash)))
+			So(err, ShouldBeNil)
+			So(string(data), ShouldEqual, "hello")
+		})
+
+		Convey("stores identical content once", func() {
+			for i := 0; i < 2; i++ {
+				hash, err := fsStore.PutContentAddressedFileReader(strings.NewReader("hello"), 5, "text/plain", noReference)
+				So(err, ShouldBeNil)
+				So(hash, ShouldEqual, helloHash)
+			}
+
+			files, err := ioutil.ReadDir(filepath.Join(dir, ContentAddressedPrefix))
+			So(err, ShouldBeNil)
+			So(files, ShouldHaveLength, 1)
+			So(files[0].Name(), ShouldEqual, helloHash[:2])
+		})
+
+		Convey("references content before storing", func() {
+			referenced := ""
+			hash, err := fsStore.PutContentAddressedFileReader(strings.NewReader("hello"), 5, "text/plain", func(hash string) error {
+				_, statErr := os.Stat(filepath.Join(dir, ContentObjectName(hash)))
+				So(os.IsNotExist(statErr), ShouldBeTrue)
+				referenced = hash
+				return nil
+			})
+			So(err, ShouldBeNil)
+			So(referenced, ShouldEqual, hash)
+		})
+
+		Convey("does not store content failed to be referenced", func() {
+			_, err := fsStore.PutContentAddressedFileReader(strings.NewReader("hello"), 5, "text/plain", func(string) error {
+				return errors.New("reference failed")
+			})
+			So(err, ShouldNotBeNil)
+
+			_, err = os.Stat(filepath.Join(dir, ContentObjectName(helloHash)))
+			So(os.IsNotExist(err), ShouldBeTrue)
+		})
+
+		Convey("rejects content of unexpected length", func() {
+			_, err := fsStore.PutContentAddressedFileReader(strings.NewReader("hello"), 6, "text/plain", noReference)
+			So(err, ShouldNotBeNil)
+
+			_, err = os.Stat(filepath.Join(dir, ContentObjectName(helloHash)))
+			So(os.IsNotExist(err), ShouldBeTrue)
+		})
+
+		Convey("signs content url by asset name", func() {
+			s, err := fsStore.SignedContentURL("index.html", helloHash)
+			So(err, ShouldBeNil)
+			parsedURL, err := url.Parse(s)
+			So(err, ShouldBeNil)
+			So(parsedURL.Path, ShouldEqual, "/files/index.html")
+		})
+	})
+
+	Convey("IsValidContentHash", t, func() {
+		So(IsValidContentHash("2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824"), ShouldBeTrue)
+		So(IsValidContentHash("2CF24DBA5FB0A30E26E83B2AC5B9E29E1B161E5C1FA7425E73043362938B9824"), ShouldBeFalse)
+		So(IsValidContentHash("2cf24dba5fb0a30e26e83b2ac5b9e29e"), ShouldBeFalse)
+		So(IsValidContentHash("../../../../../../../../../../../../../../../../../../etc/passwd"), ShouldBeFalse)
+	})
+}
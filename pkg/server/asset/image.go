@@ -0,0 +1,408 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package asset
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"image"
+	// register gif decoder for image.Decode
+	_ "image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/chai2010/webp"
+	"golang.org/x/image/draw"
+)
+
+// TransformedAssetPrefix is the prefix of the names under which
+// transformed images are cached in the asset store
+const TransformedAssetPrefix = "_transformed"
+
+// MaxImageTransformDimension is the maximum width or height of a
+// transformed image
+const MaxImageTransformDimension = 4096
+
+// MaxImageTransformVariants is the maximum number of transformed images
+// cached for an asset, so that the asset store cannot be filled by
+// requesting every combination of transform parameters.
+const MaxImageTransformVariants = 20
+
+// maxImageTransformSourcePixels limits the size of images to be decoded,
+// so that a small compressed file cannot exhaust the memory
+const maxImageTransformSourcePixels = 50000000
+
+// maxImageTransformHeaderSize limits the size read to find the dimensions
+// of an image
+const maxImageTransformHeaderSize = 1 << 20
+
+const defaultImageTransformQuality = 85
+
+// ImageFit defines how an image is resized into the requested box
+type ImageFit string
+
+const (
+	// ImageFitContain scales the image to fit within the box, keeping
+	// its aspect ratio
+	ImageFitContain ImageFit = "contain"
+	// ImageFitCover scales the image to fill the box, keeping its aspect
+	// ratio and cropping the overflow from the center
+	ImageFitCover ImageFit = "cover"
+	// ImageFitFill stretches the image to the box
+	ImageFitFill ImageFit = "fill"
+)
+
+// Image formats a transformed image can be encoded in
+const (
+	ImageFormatJPEG = "jpeg"
+	ImageFormatPNG  = "png"
+	ImageFormatWebP = "webp"
+)
+
+var imageTransformParams = []string{
+	"width",
+	"height",
+	"fit",
+	"crop",
+	"format",
+	"quality",
+}
+
+// ErrNotImage is returned when the asset to be transformed cannot be
+// decoded as an image
+var ErrNotImage = errors.New("asset is not a supported image")
+
+// ImageTransform models the transformation applied on an image asset
+// before it is served, specified in the query string of the asset URL:
+//
+//  /files/photo.jpg?width=200&height=200&fit=cover&format=webp&quality=80
+//
+// crop is specified as `x,y,width,height` in pixels of the original image
+// and is applied before resizing.
+type ImageTransform struct {
+	Width   int
+	Height  int
+	Fit     ImageFit
+	Crop    image.Rectangle
+	Format  string
+	Quality int
+}
+
+// ParseImageTransform parses the image transform from the query string of
+// an asset URL. It returns nil if no transform is specified.
+func ParseImageTransform(values url.Values) (*ImageTransform, error) {
+	specified := false
+	for _, param := range imageTransformParams {
+		if values.Get(param) != "" {
+			specified = true
+			break
+		}
+	}
+	if !specified {
+		return nil, nil
+	}
+
+	t := ImageTransform{}
+	var err error
+	if t.Width, err = parseImageTransformInt(values, "width", 1, MaxImageTransformDimension); err != nil {
+		return nil, err
+	}
+	if t.Height, err = parseImageTransformInt(values, "height", 1, MaxImageTransformDimension); err != nil {
+		return nil, err
+	}
+	if t.Quality, err = parseImageTransformInt(values, "quality", 1, 100); err != nil {
+		return nil, err
+	}
+
+	if fit := values.Get("fit"); fit != "" {
+		switch ImageFit(fit) {
+		case ImageFitContain, ImageFitCover, ImageFitFill:
+			t.Fit = ImageFit(fit)
+		default:
+			return nil, InvalidImageTransformError{"fit", "must be one of contain, cover and fill"}
+		}
+		if t.Width == 0 && t.Height == 0 {
+			return nil, InvalidImageTransformError{"fit", "requires width or height"}
+		}
+		if t.Fit != ImageFitContain && (t.Width == 0 || t.Height == 0) {
+			return nil, InvalidImageTransformError{"fit", "requires both width and height"}
+		}
+	}
+
+	if crop := values.Get("crop"); crop != "" {
+		if t.Crop, err = parseImageTransformCrop(crop); err != nil {
+			return nil, err
+		}
+	}
+
+	if format := values.Get("format"); format != "" {
+		switch strings.ToLower(format) {
+		case "jpg", ImageFormatJPEG:
+			t.Format = ImageFormatJPEG
+		case ImageFormatPNG:
+			t.Format = ImageFormatPNG
+		case ImageFormatWebP:
+			t.Format = ImageFormatWebP
+		default:
+			return nil, InvalidImageTransformError{"format", "must be one of jpeg, png and webp"}
+		}
+	}
+
+	return &t, nil
+}
+
+func parseImageTransformInt(values url.Values, param string, min int, max int) (int, error) {
+	value := values.Get(param)
+	if value == "" {
+		return 0, nil
+	}
+
+	i, err := strconv.Atoi(value)
+	if err != nil || i < min || i > max {
+		return 0, InvalidImageTransformError{
+			param,
+			fmt.Sprintf("must be an integer between %d and %d", min, max),
+		}
+	}
+	return i, nil
+}
+
+func parseImageTransformCrop(crop string) (image.Rectangle, error) {
+	invalidErr := InvalidImageTransformError{"crop", "must be in the format of x,y,width,height"}
+
+	splits := strings.Split(crop, ",")
+	if len(splits) != 4 {
+		return image.Rectangle{}, invalidErr
+	}
+
+	ints := make([]int, 4)
+	for i, split := range splits {
+		v, err := strconv.Atoi(strings.TrimSpace(split))
+		if err != nil || v < 0 {
+			return image.Rectangle{}, invalidErr
+		}
+		ints[i] = v
+	}
+	if ints[2] == 0 || ints[3] == 0 {
+		return image.Rectangle{}, invalidErr
+	}
+
+	return image.Rect(ints[0], ints[1], ints[0]+ints[2], ints[1]+ints[3]), nil
+}
+
+// Values returns the query string parameters of the transform
+func (t ImageTransform) Values() url.Values {
+	values := url.Values{}
+	if t.Width != 0 {
+		values.Set("width", strconv.Itoa(t.Width))
+	}
+	if t.Height != 0 {
+		values.Set("height", strconv.Itoa(t.Height))
+	}
+	if t.Fit != "" {
+		values.Set("fit", string(t.Fit))
+	}
+	if !t.Crop.Empty() {
+		values.Set("crop", fmt.Sprintf(
+			"%d,%d,%d,%d",
+			t.Crop.Min.X, t.Crop.Min.Y, t.Crop.Dx(), t.Crop.Dy(),
+		))
+	}
+	if t.Format != "" {
+		values.Set("format", t.Format)
+	}
+	if t.Quality != 0 {
+		values.Set("quality", strconv.Itoa(t.Quality))
+	}
+	return values
+}
+
+// Encode returns the canonical query string of the transform, which is
+// signed together with the asset name.
+func (t ImageTransform) Encode() string {
+	return t.Values().Encode()
+}
+
+// ResolveFormat returns a copy of the transform with the output format
+// set to the one of the original image if it is not specified.
+func (t ImageTransform) ResolveFormat(contentType string) ImageTransform {
+	if t.Format != "" {
+		return t
+	}
+
+	switch contentType {
+	case "image/jpeg":
+		t.Format = ImageFormatJPEG
+	case "image/webp":
+		t.Format = ImageFormatWebP
+	default:
+		t.Format = ImageFormatPNG
+	}
+	return t
+}
+
+// ContentType returns the content type of the transformed image
+func (t ImageTransform) ContentType() string {
+	return "image/" + t.Format
+}
+
+// DerivedName returns the deterministic name under which the transformed
+// image of the named asset is cached in the asset store.
+func (t ImageTransform) DerivedName(name string) string {
+	sum := sha256.Sum256([]byte(t.Encode()))
+	return path.Join(
+		TransformedAssetPrefix,
+		name,
+		hex.EncodeToString(sum[:16])+"."+t.Format,
+	)
+}
+
+// TransformSigningName returns the string signed for the named asset
+// with the transform, so that the transform cannot be altered without
+// invalidating the signature. The name is returned unchanged if there
+// is no transform, keeping the existing signed URLs valid.
+func TransformSigningName(name string, transform *ImageTransform) string {
+	if transform == nil {
+		return name
+	}
+	return name + "\x00" + transform.Encode()
+}
+
+// TransformImage decodes the image from src and returns the transformed
+// image encoded in the format of the transform. The format of the
+// original image is used if the transform does not specify one.
+func TransformImage(src io.Reader, t ImageTransform) ([]byte, error) {
+	// the header read to decode the config is kept to be decoded again
+	// with the rest of the image, so that the image is only read after
+	// its size is checked
+	header := bytes.Buffer{}
+	config, _, err := image.DecodeConfig(io.TeeReader(
+		io.LimitReader(src, maxImageTransformHeaderSize),
+		&header,
+	))
+	if err != nil {
+		if header.Len() >= maxImageTransformHeaderSize {
+			return nil, errors.New("image header is too large to be transformed")
+		}
+		return nil, ErrNotImage
+	}
+	if config.Width*config.Height > maxImageTransformSourcePixels {
+		return nil, fmt.Errorf(
+			"image of %dx%d is too large to be transformed",
+			config.Width, config.Height,
+		)
+	}
+
+	img, sourceFormat, err := image.Decode(io.MultiReader(&header, src))
+	if err != nil {
+		return nil, ErrNotImage
+	}
+
+	if !t.Crop.Empty() {
+		bounds := img.Bounds()
+		cropRect := t.Crop.Add(bounds.Min).Intersect(bounds)
+		if cropRect.Empty() {
+			return nil, InvalidImageTransformError{"crop", "is outside of the image"}
+		}
+		cropped := image.NewRGBA(image.Rect(0, 0, cropRect.Dx(), cropRect.Dy()))
+		draw.Draw(cropped, cropped.Bounds(), img, cropRect.Min, draw.Src)
+		img = cropped
+	}
+	img = resizeImage(img, t)
+
+	format := t.Format
+	if format == "" {
+		format = sourceFormat
+	}
+
+	quality := t.Quality
+	if quality == 0 {
+		quality = defaultImageTransformQuality
+	}
+
+	buf := bytes.Buffer{}
+	switch format {
+	case ImageFormatJPEG:
+		err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: quality})
+	case ImageFormatWebP:
+		err = webp.Encode(&buf, img, &webp.Options{Quality: float32(quality)})
+	default:
+		err = png.Encode(&buf, img)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func resizeImage(img image.Image, t ImageTransform) image.Image {
+	if t.Width == 0 && t.Height == 0 {
+		return img
+	}
+
+	bounds := img.Bounds()
+	srcWidth, srcHeight := bounds.Dx(), bounds.Dy()
+	width, height := t.Width, t.Height
+	if width == 0 {
+		width = maxInt(1, srcWidth*height/srcHeight)
+	}
+	if height == 0 {
+		height = maxInt(1, srcHeight*width/srcWidth)
+	}
+
+	srcRect := bounds
+	switch t.Fit {
+	case ImageFitFill:
+	case ImageFitCover:
+		if srcWidth*height > srcHeight*width {
+			cropWidth := srcHeight * width / height
+			srcRect.Min.X += (srcWidth - cropWidth) / 2
+			srcRect.Max.X = srcRect.Min.X + cropWidth
+		} else {
+			cropHeight := srcWidth * height / width
+			srcRect.Min.Y += (srcHeight - cropHeight) / 2
+			srcRect.Max.Y = srcRect.Min.Y + cropHeight
+		}
+	default:
+		if srcWidth*height > srcHeight*width {
+			height = maxInt(1, srcHeight*width/srcWidth)
+		} else {
+			width = maxInt(1, srcWidth*height/srcHeight)
+		}
+	}
+
+	return scaleImage(img, srcRect, width, height)
+}
+
+func scaleImage(img image.Image, srcRect image.Rectangle, width int, height int) image.Image {
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), img, srcRect, draw.Src, nil)
+	return dst
+}
+
+func maxInt(a int, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
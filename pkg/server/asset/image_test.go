@@ -0,0 +1,255 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package asset
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"net/url"
+	"strings"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func encodeTestPNG(width int, height int) []byte {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for x := 0; x < width; x++ {
+		for y := 0; y < height; y++ {
+			img.Set(x, y, color.RGBA{uint8(x), uint8(y), 0, 255})
+		}
+	}
+
+	buf := bytes.Buffer{}
+	png.Encode(&buf, img)
+	return buf.Bytes()
+}
+
+func TestParseImageTransform(t *testing.T) {
+	Convey("ParseImageTransform", t, func() {
+		Convey("returns nil without transform params", func() {
+			transform, err := ParseImageTransform(url.Values{
+				"expiredAt": []string{"1481096834"},
+			})
+			So(err, ShouldBeNil)
+			So(transform, ShouldBeNil)
+		})
+
+		Convey("parses all params", func() {
+			transform, err := ParseImageTransform(url.Values{
+				"width":   []string{"200"},
+				"height":  []string{"100"},
+				"fit":     []string{"cover"},
+				"crop":    []string{"10,20,300,400"},
+				"format":  []string{"jpg"},
+				"quality": []string{"80"},
+			})
+			So(err, ShouldBeNil)
+			So(*transform, ShouldResemble, ImageTransform{
+				Width:   200,
+				Height:  100,
+				Fit:     ImageFitCover,
+				Crop:    image.Rect(10, 20, 310, 420),
+				Format:  ImageFormatJPEG,
+				Quality: 80,
+			})
+			So(
+				transform.Encode(),
+				ShouldEqual,
+				"crop=10%2C20%2C300%2C400&fit=cover&format=jpeg&height=100&quality=80&width=200",
+			)
+		})
+
+		Convey("encodes to the same transform", func() {
+			transform, err := ParseImageTransform(url.Values{
+				"width":  []string{"200"},
+				"format": []string{"webp"},
+			})
+			So(err, ShouldBeNil)
+
+			parsed, err := ParseImageTransform(transform.Values())
+			So(err, ShouldBeNil)
+			So(parsed, ShouldResemble, transform)
+		})
+
+		Convey("rejects invalid params", func() {
+			for _, values := range []url.Values{
+				{"width": []string{"abc"}},
+				{"width": []string{"0"}},
+				{"height": []string{"4097"}},
+				{"quality": []string{"101"}},
+				{"fit": []string{"stretch"}, "width": []string{"10"}},
+				{"fit": []string{"cover"}, "width": []string{"10"}},
+				{"fit": []string{"contain"}},
+				{"crop": []string{"1,2,3"}},
+				{"crop": []string{"1,2,0,4"}},
+				{"format": []string{"bmp"}},
+			} {
+				_, err := ParseImageTransform(values)
+				So(err, ShouldHaveSameTypeAs, InvalidImageTransformError{})
+			}
+		})
+	})
+}
+
+func TestImageTransformNames(t *testing.T) {
+	Convey("ImageTransform", t, func() {
+		transform := ImageTransform{Width: 200}
+
+		Convey("resolves format from content type", func() {
+			So(transform.ResolveFormat("image/jpeg").Format, ShouldEqual, ImageFormatJPEG)
+			So(transform.ResolveFormat("image/webp").Format, ShouldEqual, ImageFormatWebP)
+			So(transform.ResolveFormat("image/gif").Format, ShouldEqual, ImageFormatPNG)
+
+			transform.Format = ImageFormatWebP
+			So(transform.ResolveFormat("image/jpeg").Format, ShouldEqual, ImageFormatWebP)
+			So(transform.ContentType(), ShouldEqual, "image/webp")
+		})
+
+		Convey("derives deterministic name", func() {
+			transform.Format = ImageFormatPNG
+			name := transform.DerivedName("dir/photo.jpg")
+			So(strings.HasPrefix(name, "_transformed/dir/photo.jpg/"), ShouldBeTrue)
+			So(strings.HasSuffix(name, ".png"), ShouldBeTrue)
+			So(transform.DerivedName("dir/photo.jpg"), ShouldEqual, name)
+
+			transform.Width = 100
+			So(transform.DerivedName("dir/photo.jpg"), ShouldNotEqual, name)
+		})
+
+		Convey("signs transform with name", func() {
+			So(TransformSigningName("photo.jpg", nil), ShouldEqual, "photo.jpg")
+			So(
+				TransformSigningName("photo.jpg", &transform),
+				ShouldEqual,
+				"photo.jpg\x00width=200",
+			)
+		})
+	})
+}
+
+type readRecorder struct {
+	read bool
+}
+
+func (r *readRecorder) Read(p []byte) (int, error) {
+	r.read = true
+	return 0, io.EOF
+}
+
+func TestTransformImage(t *testing.T) {
+	Convey("TransformImage", t, func() {
+		src := encodeTestPNG(40, 20)
+
+		transformedSize := func(transform ImageTransform) (int, int, string) {
+			data, err := TransformImage(bytes.NewReader(src), transform)
+			So(err, ShouldBeNil)
+			config, format, err := image.DecodeConfig(bytes.NewReader(data))
+			So(err, ShouldBeNil)
+			return config.Width, config.Height, format
+		}
+
+		Convey("resizes keeping aspect ratio", func() {
+			width, height, format := transformedSize(ImageTransform{Width: 10})
+			So(width, ShouldEqual, 10)
+			So(height, ShouldEqual, 5)
+			So(format, ShouldEqual, "png")
+		})
+
+		Convey("resizes to fit in box", func() {
+			width, height, _ := transformedSize(ImageTransform{
+				Width:  10,
+				Height: 10,
+				Fit:    ImageFitContain,
+			})
+			So(width, ShouldEqual, 10)
+			So(height, ShouldEqual, 5)
+		})
+
+		Convey("resizes to cover box", func() {
+			width, height, _ := transformedSize(ImageTransform{
+				Width:  10,
+				Height: 10,
+				Fit:    ImageFitCover,
+			})
+			So(width, ShouldEqual, 10)
+			So(height, ShouldEqual, 10)
+		})
+
+		Convey("stretches to fill box", func() {
+			width, height, _ := transformedSize(ImageTransform{
+				Width:  5,
+				Height: 15,
+				Fit:    ImageFitFill,
+			})
+			So(width, ShouldEqual, 5)
+			So(height, ShouldEqual, 15)
+		})
+
+		Convey("crops before resizing", func() {
+			width, height, _ := transformedSize(ImageTransform{
+				Crop: image.Rect(5, 5, 15, 10),
+			})
+			So(width, ShouldEqual, 10)
+			So(height, ShouldEqual, 5)
+
+			width, height, _ = transformedSize(ImageTransform{
+				Crop:  image.Rect(30, 10, 50, 30),
+				Width: 5,
+			})
+			So(width, ShouldEqual, 5)
+			So(height, ShouldEqual, 5)
+		})
+
+		Convey("rejects crop outside of image", func() {
+			_, err := TransformImage(bytes.NewReader(src), ImageTransform{
+				Crop: image.Rect(40, 0, 50, 10),
+			})
+			So(err, ShouldHaveSameTypeAs, InvalidImageTransformError{})
+		})
+
+		Convey("encodes in requested format", func() {
+			_, _, format := transformedSize(ImageTransform{Width: 10, Format: ImageFormatJPEG, Quality: 50})
+			So(format, ShouldEqual, "jpeg")
+
+			_, _, format = transformedSize(ImageTransform{Width: 10, Format: ImageFormatWebP})
+			So(format, ShouldEqual, "webp")
+		})
+
+		Convey("rejects non-image", func() {
+			_, err := TransformImage(strings.NewReader("I am a boy"), ImageTransform{Width: 10})
+			So(err, ShouldEqual, ErrNotImage)
+		})
+
+		Convey("rejects large image before reading it", func() {
+			// patch the dimensions in IHDR to 10000x10000
+			large := encodeTestPNG(1, 1)
+			binary.BigEndian.PutUint32(large[16:20], 10000)
+			binary.BigEndian.PutUint32(large[20:24], 10000)
+			binary.BigEndian.PutUint32(large[29:33], crc32.ChecksumIEEE(large[12:29]))
+
+			rest := &readRecorder{}
+			_, err := TransformImage(io.MultiReader(bytes.NewReader(large), rest), ImageTransform{Width: 10})
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "too large")
+			So(rest.read, ShouldBeFalse)
+		})
+	})
+}
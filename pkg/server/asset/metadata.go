@@ -0,0 +1,289 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package asset
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image"
+	"io"
+)
+
+// Metadata is the metadata extracted from the content of an asset
+type Metadata struct {
+	// Width and Height are the dimensions of an image in pixels
+	Width  int `json:"width,omitempty"`
+	Height int `json:"height,omitempty"`
+	// Duration is the duration of an audio or video in seconds
+	Duration float64 `json:"duration,omitempty"`
+	// EXIF is the EXIF metadata of a JPEG image, keyed by tag name
+	EXIF map[string]interface{} `json:"exif,omitempty"`
+}
+
+// ExtractMetadata extracts the metadata of the content, which is
+// recognized by its format regardless of the declared content type.
+// Supported are the dimensions of GIF, JPEG, PNG and WebP images, the
+// EXIF metadata of JPEG images, and the duration of MP4, QuickTime, WAV
+// and FLAC media. nil is returned for content of other formats.
+func ExtractMetadata(src io.ReaderAt, size int64) (*Metadata, error) {
+	head := make([]byte, 12)
+	n, err := src.ReadAt(head, 0)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	head = head[:n]
+
+	if config, _, err := image.DecodeConfig(io.NewSectionReader(src, 0, size)); err == nil {
+		metadata := &Metadata{
+			Width:  config.Width,
+			Height: config.Height,
+		}
+		if bytes.HasPrefix(head, []byte{0xFF, jpegMarkerSOI}) {
+			metadata.EXIF, err = readJPEGEXIF(io.NewSectionReader(src, 0, size))
+			if err != nil {
+				return nil, err
+			}
+		}
+		return metadata, nil
+	}
+
+	var duration float64
+	switch {
+	case len(head) >= 8 && string(head[4:8]) == "ftyp":
+		duration, err = mp4Duration(src, size)
+	case len(head) >= 12 && string(head[:4]) == "RIFF" && string(head[8:12]) == "WAVE":
+		duration, err = wavDuration(src, size)
+	case len(head) >= 4 && string(head[:4]) == "fLaC":
+		duration, err = flacDuration(src)
+	default:
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &Metadata{Duration: duration}, nil
+}
+
+var errMalformedMedia = errors.New("malformed media")
+
+// readAt reads exactly len(p) bytes at offset
+func readAt(src io.ReaderAt, p []byte, offset int64) error {
+	n, err := src.ReadAt(p, offset)
+	if n == len(p) {
+		return nil
+	}
+	if err == nil || err == io.EOF {
+		return errMalformedMedia
+	}
+	return err
+}
+
+// mp4Duration reads the duration from the movie header box in the movie
+// box of ISO base media files, like MP4 and QuickTime files
+func mp4Duration(src io.ReaderAt, size int64) (float64, error) {
+	moov, moovSize, err := findMP4Box(src, 0, size, "moov")
+	if err != nil {
+		return 0, err
+	}
+	mvhd, mvhdSize, err := findMP4Box(src, moov, moovSize, "mvhd")
+	if err != nil {
+		return 0, err
+	}
+	if mvhdSize < 4 {
+		return 0, errMalformedMedia
+	}
+
+	version := make([]byte, 1)
+	if err := readAt(src, version, mvhd); err != nil {
+		return 0, err
+	}
+	var timescale uint32
+	var duration uint64
+	if version[0] == 1 {
+		// creation and modification time are 64-bit in version 1
+		b := make([]byte, 12)
+		if err := readAt(src, b, mvhd+20); err != nil {
+			return 0, err
+		}
+		timescale = binary.BigEndian.Uint32(b)
+		duration = binary.BigEndian.Uint64(b[4:])
+	} else {
+		b := make([]byte, 8)
+		if err := readAt(src, b, mvhd+12); err != nil {
+			return 0, err
+		}
+		timescale = binary.BigEndian.Uint32(b)
+		duration = uint64(binary.BigEndian.Uint32(b[4:]))
+	}
+	if timescale == 0 {
+		return 0, errMalformedMedia
+	}
+	return float64(duration) / float64(timescale), nil
+}
+
+// findMP4Box returns the offset and size of the content of the box of the
+// type, within the boxes in the range from offset of the size
+func findMP4Box(src io.ReaderAt, offset int64, size int64, boxType string) (int64, int64, error) {
+	end := offset + size
+	header := make([]byte, 16)
+	for offset+8 <= end {
+		if err := readAt(src, header[:8], offset); err != nil {
+			return 0, 0, err
+		}
+		boxSize := int64(binary.BigEndian.Uint32(header))
+		headerSize := int64(8)
+		switch boxSize {
+		case 0:
+			// the box extends to the end
+			boxSize = end - offset
+		case 1:
+			if err := readAt(src, header[8:], offset+8); err != nil {
+				return 0, 0, err
+			}
+			boxSize = int64(binary.BigEndian.Uint64(header[8:]))
+			headerSize = 16
+		}
+		if boxSize < headerSize || offset+boxSize > end {
+			return 0, 0, errMalformedMedia
+		}
+
+		if string(header[4:8]) == boxType {
+			return offset + headerSize, boxSize - headerSize, nil
+		}
+		offset += boxSize
+	}
+	return 0, 0, errMalformedMedia
+}
+
+// wavDuration reads the duration from the byte rate in the format chunk
+// and the size of the data chunk of WAV files
+func wavDuration(src io.ReaderAt, size int64) (float64, error) {
+	var byteRate uint32
+	offset := int64(12)
+	header := make([]byte, 8)
+	for offset+8 <= size {
+		if err := readAt(src, header, offset); err != nil {
+			return 0, err
+		}
+		chunkSize := int64(binary.LittleEndian.Uint32(header[4:]))
+		switch string(header[:4]) {
+		case "fmt ":
+			format := make([]byte, 12)
+			if err := readAt(src, format, offset+8); err != nil {
+				return 0, err
+			}
+			byteRate = binary.LittleEndian.Uint32(format[8:])
+		case "data":
+			if byteRate == 0 {
+				return 0, errMalformedMedia
+			}
+			// the size of data is unknown if the file was streamed
+			if offset+8+chunkSize > size {
+				chunkSize = size - offset - 8
+			}
+			return float64(chunkSize) / float64(byteRate), nil
+		}
+		// chunks are padded to even sizes
+		offset += 8 + chunkSize + chunkSize%2
+	}
+	return 0, errMalformedMedia
+}
+
+// flacDuration reads the duration from the sample rate and the number of
+// samples in the STREAMINFO block of FLAC files
+func flacDuration(src io.ReaderAt) (float64, error) {
+	// STREAMINFO is the first metadata block following the marker and
+	// the block header
+	info := make([]byte, 18)
+	if err := readAt(src, info, 8); err != nil {
+		return 0, err
+	}
+	sampleRate := uint32(info[10])<<12 | uint32(info[11])<<4 | uint32(info[12])>>4
+	samples := uint64(info[13]&0x0F)<<32 | uint64(binary.BigEndian.Uint32(info[14:]))
+	if sampleRate == 0 {
+		return 0, errMalformedMedia
+	}
+	return float64(samples) / float64(sampleRate), nil
+}
+
+// rangedFileReaderAt reads a file in the asset store by byte ranges.
+// Reads are done in blocks of at least rangedFileReadSize bytes, of which
+// the last one is cached, such that sequential small reads do not each
+// make a request to the asset store.
+type rangedFileReaderAt struct {
+	getter FileRangedGetter
+	name   string
+	block  []byte
+	offset int64
+}
+
+const rangedFileReadSize = 64 * 1024
+
+// NewFileReaderAt returns an io.ReaderAt of the named file in the asset
+// store, for reading parts of a large file without downloading all of it
+func NewFileReaderAt(getter FileRangedGetter, name string) io.ReaderAt {
+	return &rangedFileReaderAt{
+		getter: getter,
+		name:   name,
+	}
+}
+
+// ReadAt implements io.ReaderAt
+func (r *rangedFileReaderAt) ReadAt(p []byte, offset int64) (int, error) {
+	if offset < r.offset || offset+int64(len(p)) > r.offset+int64(len(r.block)) {
+		if err := r.readBlock(offset, len(p)); err != nil {
+			return 0, err
+		}
+	}
+
+	n := 0
+	if offset >= r.offset && offset < r.offset+int64(len(r.block)) {
+		n = copy(p, r.block[offset-r.offset:])
+	}
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+func (r *rangedFileReaderAt) readBlock(offset int64, length int) error {
+	if length < rangedFileReadSize {
+		length = rangedFileReadSize
+	}
+	r.offset = offset
+	r.block = r.block[:0]
+
+	result, err := r.getter.GetRangedFileReader(r.name, FileRange{
+		From: offset,
+		To:   offset + int64(length) - 1,
+	})
+	if _, ok := err.(FileRangeNotAcceptedError); ok {
+		// reading beyond the end of the file
+		return nil
+	} else if err != nil {
+		return err
+	}
+	defer result.ReadCloser.Close()
+
+	// the reader of some stores is not limited to the accepted range
+	accepted := result.AcceptedRange
+	block := bytes.Buffer{}
+	if _, err := io.CopyN(&block, result.ReadCloser, accepted.To-accepted.From+1); err != nil && err != io.EOF {
+		return err
+	}
+	r.block = block.Bytes()
+	return nil
+}
@@ -0,0 +1,179 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package asset
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func buildTestWAV(sampleRate uint32, bytesPerSample uint16, dataSize uint32) []byte {
+	order := binary.LittleEndian
+	wav := []byte("RIFF\x00\x00\x00\x00WAVEfmt \x10\x00\x00\x00")
+	format := make([]byte, 16)
+	order.PutUint16(format, 1)
+	order.PutUint16(format[2:], 1)
+	order.PutUint32(format[4:], sampleRate)
+	order.PutUint32(format[8:], sampleRate*uint32(bytesPerSample))
+	order.PutUint16(format[12:], bytesPerSample)
+	order.PutUint16(format[14:], bytesPerSample*8)
+	wav = append(wav, format...)
+
+	wav = append(wav, "LIST\x03\x00\x00\x00abc\x00"...)
+	wav = append(wav, "data\x00\x00\x00\x00"...)
+	order.PutUint32(wav[len(wav)-4:], dataSize)
+	wav = append(wav, make([]byte, dataSize)...)
+	order.PutUint32(wav[4:], uint32(len(wav)-8))
+	return wav
+}
+
+func buildTestFLAC(sampleRate uint32, samples uint64) []byte {
+	info := make([]byte, 34)
+	info[10] = byte(sampleRate >> 12)
+	info[11] = byte(sampleRate >> 4)
+	info[12] = byte(sampleRate<<4) | 0x02
+	info[13] = 0xF0 | byte(samples>>32)
+	binary.BigEndian.PutUint32(info[14:], uint32(samples))
+
+	flac := []byte("fLaC\x80\x00\x00\x22")
+	return append(flac, info...)
+}
+
+func testMP4Box(boxType string, content []byte) []byte {
+	box := make([]byte, 8)
+	binary.BigEndian.PutUint32(box, uint32(len(content)+8))
+	copy(box[4:], boxType)
+	return append(box, content...)
+}
+
+func buildTestMP4(timescale uint32, duration uint32) []byte {
+	mvhd := make([]byte, 100)
+	binary.BigEndian.PutUint32(mvhd[12:], timescale)
+	binary.BigEndian.PutUint32(mvhd[16:], duration)
+
+	mp4 := testMP4Box("ftyp", []byte("isom\x00\x00\x02\x00"))
+	mp4 = append(mp4, testMP4Box("free", nil)...)
+	mp4 = append(mp4, testMP4Box("mdat", make([]byte, 64))...)
+	moov := append(testMP4Box("trak", make([]byte, 16)), testMP4Box("mvhd", mvhd)...)
+	return append(mp4, testMP4Box("moov", moov)...)
+}
+
+func TestExtractMetadata(t *testing.T) {
+	Convey("ExtractMetadata", t, func() {
+		extract := func(content []byte) (*Metadata, error) {
+			return ExtractMetadata(bytes.NewReader(content), int64(len(content)))
+		}
+
+		Convey("extract dimensions of image", func() {
+			metadata, err := extract(encodeTestPNG(5, 7))
+			So(err, ShouldBeNil)
+			So(metadata, ShouldResemble, &Metadata{Width: 5, Height: 7})
+		})
+
+		Convey("extract dimensions and EXIF of JPEG image", func() {
+			metadata, err := extract(testEXIFJPEG())
+			So(err, ShouldBeNil)
+			So(metadata.Width, ShouldEqual, 4)
+			So(metadata.Height, ShouldEqual, 3)
+			So(metadata.EXIF["Make"], ShouldEqual, "Skygear")
+			So(metadata.EXIF, ShouldNotContainKey, "GPSLatitude")
+		})
+
+		Convey("extract duration of WAV", func() {
+			metadata, err := extract(buildTestWAV(8000, 2, 24000))
+			So(err, ShouldBeNil)
+			So(metadata, ShouldResemble, &Metadata{Duration: 1.5})
+		})
+
+		Convey("extract duration of FLAC", func() {
+			metadata, err := extract(buildTestFLAC(44100, 88200))
+			So(err, ShouldBeNil)
+			So(metadata, ShouldResemble, &Metadata{Duration: 2})
+		})
+
+		Convey("extract duration of MP4", func() {
+			metadata, err := extract(buildTestMP4(600, 1500))
+			So(err, ShouldBeNil)
+			So(metadata, ShouldResemble, &Metadata{Duration: 2.5})
+		})
+
+		Convey("return error for malformed media", func() {
+			mp4 := buildTestMP4(600, 1500)
+			_, err := extract(mp4[:len(mp4)-50])
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("return nil for other content", func() {
+			metadata, err := extract([]byte("hello world"))
+			So(err, ShouldBeNil)
+			So(metadata, ShouldBeNil)
+
+			metadata, err = extract([]byte{})
+			So(err, ShouldBeNil)
+			So(metadata, ShouldBeNil)
+		})
+	})
+}
+
+func TestFileReaderAt(t *testing.T) {
+	Convey("NewFileReaderAt", t, func() {
+		dir, err := ioutil.TempDir("", "skygear-asset-")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		store := NewFileStore(dir, "", "", true)
+		content := strings.Repeat("0123456789", rangedFileReadSize/5)
+		So(store.PutFileReader("file", strings.NewReader(content), int64(len(content)), "text/plain"), ShouldBeNil)
+		r := NewFileReaderAt(store.(FileRangedGetter), "file")
+
+		Convey("read at offsets", func() {
+			p := make([]byte, 5)
+			n, err := r.ReadAt(p, 3)
+			So(err, ShouldBeNil)
+			So(string(p[:n]), ShouldEqual, "34567")
+
+			n, err = r.ReadAt(p, rangedFileReadSize+8)
+			So(err, ShouldBeNil)
+			So(string(p[:n]), ShouldEqual, content[rangedFileReadSize+8:rangedFileReadSize+13])
+		})
+
+		Convey("read beyond the end", func() {
+			p := make([]byte, 5)
+			n, err := r.ReadAt(p, int64(len(content)-2))
+			So(err, ShouldEqual, io.EOF)
+			So(string(p[:n]), ShouldEqual, "89")
+
+			n, err = r.ReadAt(p, int64(len(content)+10))
+			So(err, ShouldEqual, io.EOF)
+			So(n, ShouldEqual, 0)
+		})
+
+		Convey("extract metadata of file in store", func() {
+			wav := buildTestWAV(8000, 1, 16000)
+			So(store.PutFileReader("audio.wav", bytes.NewReader(wav), int64(len(wav)), "audio/wav"), ShouldBeNil)
+
+			metadata, err := ExtractMetadata(NewFileReaderAt(store.(FileRangedGetter), "audio.wav"), int64(len(wav)))
+			So(err, ShouldBeNil)
+			So(metadata, ShouldResemble, &Metadata{Duration: 2})
+		})
+	})
+}
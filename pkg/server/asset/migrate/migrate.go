@@ -0,0 +1,192 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package migrate copies the files of assets from one asset store to
+// another.
+package migrate
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/skygeario/skygear-server/pkg/server/asset"
+	"github.com/skygeario/skygear-server/pkg/server/logging"
+	"github.com/skygeario/skygear-server/pkg/server/skydb"
+)
+
+// DefaultBatchSize is the number of assets queried at a time if
+// BatchSize is not specified
+const DefaultBatchSize = 100
+
+// Result is the summary of a migration
+type Result struct {
+	// Assets is the number of assets migrated, or to be migrated in
+	// a dry run
+	Assets int
+	// Objects is the number of files copied. It is fewer than Assets if
+	// assets of identical content are stored once by content hash.
+	Objects int
+	// Bytes is the number of bytes copied
+	Bytes int64
+	// Last is the name of the last migrated asset, from which an
+	// interrupted migration is resumed
+	Last string
+	// Missing is the names of the assets skipped because their files do
+	// not exist in the source store, such as assets created by asset:put
+	// but never uploaded
+	Missing []string
+}
+
+// errObjectMissing is returned by copyObject if the file of the asset
+// does not exist in the source store
+var errObjectMissing = errors.New("file does not exist in the source store")
+
+// Migrator copies the file of every asset in the database from one asset
+// store to another. Files are streamed without being buffered, and are
+// read back from the destination store to verify their SHA-256 checksum.
+//
+// Assets are migrated in the order of their names, such that a migration
+// can be resumed after the last migrated asset. Transformed images are
+// not migrated because they are generated again on request.
+type Migrator struct {
+	Conn skydb.Conn
+	From asset.Store
+	To   asset.Store
+
+	// DryRun lists the assets to be migrated without copying their files
+	DryRun bool
+
+	// BatchSize is the number of assets queried at a time
+	BatchSize int
+
+	// Checkpoint is called after each asset is migrated with its name,
+	// which is passed to Migrate to resume the migration. The migration
+	// is stopped if it returns an error.
+	Checkpoint func(name string) error
+
+	Logger *logrus.Entry
+}
+
+// Migrate migrates the assets named after the specified name, which is
+// empty to migrate all assets
+func (m *Migrator) Migrate(after string) (*Result, error) {
+	logger := m.Logger
+	if logger == nil {
+		logger = logging.LoggerEntry("asset")
+	}
+	batchSize := m.BatchSize
+	if batchSize <= 0 {
+		batchSize = DefaultBatchSize
+	}
+
+	result := &Result{Last: after}
+	// content-addressed files shared by assets are copied once
+	copied := map[string]bool{}
+	for {
+		assets, err := m.Conn.QueryAssets(result.Last, batchSize)
+		if err != nil {
+			return result, fmt.Errorf("failed to query assets: %v", err)
+		}
+		if len(assets) == 0 {
+			return result, nil
+		}
+
+		for i := range assets {
+			a := &assets[i]
+			objectName := a.ObjectName()
+			missing := false
+			if !copied[objectName] {
+				if m.DryRun {
+					logger.Infof("Would copy asset %s (%d bytes)", a.Name, a.Size)
+				} else if err := m.copyObject(a); err == errObjectMissing {
+					logger.Warnf("Skipped asset %s whose file does not exist", a.Name)
+					missing = true
+				} else if err != nil {
+					return result, fmt.Errorf("failed to migrate asset %s: %v", a.Name, err)
+				} else {
+					logger.Infof("Copied asset %s (%d bytes)", a.Name, a.Size)
+				}
+				if !missing {
+					copied[objectName] = true
+					result.Objects++
+					result.Bytes += a.Size
+				}
+			}
+
+			if missing {
+				result.Missing = append(result.Missing, a.Name)
+			} else {
+				result.Assets++
+			}
+			result.Last = a.Name
+			if m.DryRun || m.Checkpoint == nil {
+				continue
+			}
+			if err := m.Checkpoint(a.Name); err != nil {
+				return result, fmt.Errorf("failed to checkpoint asset %s: %v", a.Name, err)
+			}
+		}
+	}
+}
+
+// copyObject streams the file of the asset to the destination store, and
+// verifies the copied file by reading it back
+func (m *Migrator) copyObject(a *skydb.Asset) error {
+	objectName := a.ObjectName()
+	reader, err := m.From.GetFileReader(objectName)
+	if asset.IsNotExist(err) {
+		return errObjectMissing
+	} else if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	h := sha256.New()
+	if err := m.To.PutFileReader(
+		objectName,
+		io.TeeReader(reader, h),
+		a.Size,
+		a.ContentType,
+	); err != nil {
+		return err
+	}
+	checksum := hex.EncodeToString(h.Sum(nil))
+	if a.Hash != "" && checksum != a.Hash {
+		return fmt.Errorf("got checksum %s from source, expect %s", checksum, a.Hash)
+	}
+
+	copiedReader, err := m.To.GetFileReader(objectName)
+	if err != nil {
+		return err
+	}
+	defer copiedReader.Close()
+
+	h = sha256.New()
+	size, err := io.Copy(h, copiedReader)
+	if err != nil {
+		return err
+	}
+	if size != a.Size {
+		return fmt.Errorf("got %d bytes copied, expect %d", size, a.Size)
+	}
+	if copiedChecksum := hex.EncodeToString(h.Sum(nil)); copiedChecksum != checksum {
+		return fmt.Errorf("got checksum %s from destination, expect %s", copiedChecksum, checksum)
+	}
+	return nil
+}
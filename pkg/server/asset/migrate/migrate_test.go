@@ -0,0 +1,177 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package migrate
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/skygeario/skygear-server/pkg/server/asset"
+	"github.com/skygeario/skygear-server/pkg/server/skydb"
+	"github.com/skygeario/skygear-server/pkg/server/skydb/skydbtest"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestMigrator(t *testing.T) {
+	Convey("Migrator", t, func() {
+		fromDir, err := ioutil.TempDir("", "skygear-asset-from-")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(fromDir)
+		toDir, err := ioutil.TempDir("", "skygear-asset-to-")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(toDir)
+
+		from := asset.NewFileStore(fromDir, "", "", true)
+		to := asset.NewFileStore(toDir, "", "", true)
+		conn := skydbtest.NewMapConn()
+
+		putAsset := func(name string, content string, contentAddressed bool) string {
+			a := skydb.Asset{
+				Name:        name,
+				ContentType: "text/plain",
+				Size:        int64(len(content)),
+			}
+			if contentAddressed {
+				sum := sha256.Sum256([]byte(content))
+				a.Hash = hex.EncodeToString(sum[:])
+			}
+			So(from.PutFileReader(
+				a.ObjectName(),
+				strings.NewReader(content),
+				a.Size,
+				a.ContentType,
+			), ShouldBeNil)
+			conn.AssetMap[name] = a
+			return a.ObjectName()
+		}
+		readFile := func(dir string, name string) string {
+			data, err := ioutil.ReadFile(filepath.Join(dir, name))
+			So(err, ShouldBeNil)
+			return string(data)
+		}
+
+		putAsset("a.txt", "content a", false)
+		putAsset("b.txt", "content b", false)
+		putAsset("c.txt", "content c", false)
+
+		checkpoints := []string{}
+		m := &Migrator{
+			Conn:      conn,
+			From:      from,
+			To:        to,
+			BatchSize: 2,
+			Checkpoint: func(name string) error {
+				checkpoints = append(checkpoints, name)
+				return nil
+			},
+		}
+
+		Convey("copy all assets", func() {
+			result, err := m.Migrate("")
+			So(err, ShouldBeNil)
+			So(result, ShouldResemble, &Result{
+				Assets:  3,
+				Objects: 3,
+				Bytes:   27,
+				Last:    "c.txt",
+			})
+			So(checkpoints, ShouldResemble, []string{"a.txt", "b.txt", "c.txt"})
+			So(readFile(toDir, "a.txt"), ShouldEqual, "content a")
+			So(readFile(toDir, "b.txt"), ShouldEqual, "content b")
+			So(readFile(toDir, "c.txt"), ShouldEqual, "content c")
+		})
+
+		Convey("resume after the last migrated asset", func() {
+			result, err := m.Migrate("a.txt")
+			So(err, ShouldBeNil)
+			So(result.Assets, ShouldEqual, 2)
+			So(checkpoints, ShouldResemble, []string{"b.txt", "c.txt"})
+			_, err = os.Stat(filepath.Join(toDir, "a.txt"))
+			So(os.IsNotExist(err), ShouldBeTrue)
+		})
+
+		Convey("copy content-addressed file once", func() {
+			objectName := putAsset("d.txt", "shared", true)
+			putAsset("e.txt", "shared", true)
+
+			result, err := m.Migrate("c.txt")
+			So(err, ShouldBeNil)
+			So(result, ShouldResemble, &Result{
+				Assets:  2,
+				Objects: 1,
+				Bytes:   6,
+				Last:    "e.txt",
+			})
+			So(readFile(toDir, objectName), ShouldEqual, "shared")
+		})
+
+		Convey("not copy in dry run", func() {
+			m.DryRun = true
+			result, err := m.Migrate("")
+			So(err, ShouldBeNil)
+			So(result.Assets, ShouldEqual, 3)
+			So(result.Bytes, ShouldEqual, 27)
+			So(checkpoints, ShouldBeEmpty)
+			files, err := ioutil.ReadDir(toDir)
+			So(err, ShouldBeNil)
+			So(files, ShouldBeEmpty)
+		})
+
+		Convey("stop at checksum mismatch", func() {
+			objectName := putAsset("d.txt", "original", true)
+			So(ioutil.WriteFile(
+				filepath.Join(fromDir, objectName),
+				[]byte("modified"),
+				0644,
+			), ShouldBeNil)
+
+			result, err := m.Migrate("c.txt")
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "checksum")
+			So(result.Last, ShouldEqual, "c.txt")
+			So(checkpoints, ShouldBeEmpty)
+		})
+
+		Convey("skip assets with missing file", func() {
+			So(os.Remove(filepath.Join(fromDir, "b.txt")), ShouldBeNil)
+
+			result, err := m.Migrate("")
+			So(err, ShouldBeNil)
+			So(result.Assets, ShouldEqual, 2)
+			So(result.Objects, ShouldEqual, 2)
+			So(result.Missing, ShouldResemble, []string{"b.txt"})
+			So(result.Last, ShouldEqual, "c.txt")
+			So(checkpoints, ShouldResemble, []string{"a.txt", "b.txt", "c.txt"})
+			So(readFile(toDir, "c.txt"), ShouldEqual, "content c")
+			_, statErr := os.Stat(filepath.Join(toDir, "b.txt"))
+			So(os.IsNotExist(statErr), ShouldBeTrue)
+		})
+
+		Convey("stop at unreadable file", func() {
+			So(os.Remove(filepath.Join(fromDir, "b.txt")), ShouldBeNil)
+			So(os.Mkdir(filepath.Join(fromDir, "b.txt"), 0755), ShouldBeNil)
+
+			result, err := m.Migrate("")
+			So(err, ShouldNotBeNil)
+			So(result.Last, ShouldEqual, "a.txt")
+			So(checkpoints, ShouldResemble, []string{"a.txt"})
+		})
+	})
+}
@@ -33,6 +33,18 @@ func (_m *MockURLSignerStore) EXPECT() *MockURLSignerStoreMockRecorder {
 	return _m.recorder
 }
 
+// Delete mocks base method
+func (_m *MockURLSignerStore) Delete(_param0 string) error {
+	ret := _m.ctrl.Call(_m, "Delete", _param0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Delete indicates an expected call of Delete
+func (_mr *MockURLSignerStoreMockRecorder) Delete(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "Delete", reflect.TypeOf((*MockURLSignerStore)(nil).Delete), arg0)
+}
+
 // GeneratePostFileRequest mocks base method
 func (_m *MockURLSignerStore) GeneratePostFileRequest(_param0 string, _param1 string, _param2 int64) (*asset.PostFileRequest, error) {
 	ret := _m.ctrl.Call(_m, "GeneratePostFileRequest", _param0, _param1, _param2)
@@ -0,0 +1,194 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package asset
+
+import (
+	"fmt"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+// SniffLength is the number of bytes at the beginning of a file used to
+// detect its content type
+const SniffLength = 512
+
+// FieldUploadPolicy restricts the assets saved to a record field
+type FieldUploadPolicy struct {
+	// MaxSize is the maximum size in bytes, zero means no limit
+	MaxSize int64
+	// ContentTypes are the allowed content types, which can be a wildcard
+	// like image/*. Empty means all content types are allowed.
+	ContentTypes []string
+}
+
+func (p FieldUploadPolicy) validate(field string, contentType string, size int64) error {
+	if p.MaxSize > 0 && size > p.MaxSize {
+		return UploadPolicyError{
+			Field:   field,
+			MaxSize: p.MaxSize,
+			Reason:  fmt.Sprintf("is larger than %d bytes", p.MaxSize),
+		}
+	}
+
+	if len(p.ContentTypes) == 0 {
+		return nil
+	}
+	mediaType := parseMediaType(contentType)
+	for _, allowed := range p.ContentTypes {
+		allowed = strings.ToLower(allowed)
+		if allowed == mediaType || allowed == "*/*" {
+			return nil
+		}
+		if strings.HasSuffix(allowed, "/*") && strings.HasPrefix(mediaType, strings.TrimSuffix(allowed, "*")) {
+			return nil
+		}
+	}
+	return UploadPolicyError{
+		Field:  field,
+		Reason: fmt.Sprintf("of content type %s is not allowed", contentType),
+	}
+}
+
+// UploadPolicy restricts the size and content type of uploaded assets,
+// globally and per record field. A nil UploadPolicy allows everything.
+type UploadPolicy struct {
+	FieldUploadPolicy
+
+	// SniffContentType enables detecting the content type from the
+	// content, rejecting assets whose content does not match the declared
+	// content type
+	SniffContentType bool
+
+	// StripEXIF is the metadata stripped from uploaded JPEG images, which
+	// is the GPS location if not specified
+	StripEXIF EXIFStripping
+
+	// Fields are the policies of record fields, keyed by
+	// record_type.field. Assets saved to a field are subject to both the
+	// global policy and the policy of the field.
+	Fields map[string]FieldUploadPolicy
+}
+
+// Validate checks the declared content type and size of an asset against
+// the global policy
+func (p *UploadPolicy) Validate(contentType string, size int64) error {
+	if p == nil {
+		return nil
+	}
+	return p.FieldUploadPolicy.validate("", contentType, size)
+}
+
+// ValidateField checks the content type and size of an asset saved to the
+// record field against the global policy and the policy of the field
+func (p *UploadPolicy) ValidateField(recordType string, field string, contentType string, size int64) error {
+	if p == nil {
+		return nil
+	}
+	if err := p.Validate(contentType, size); err != nil {
+		return err
+	}
+
+	key := recordType + "." + field
+	fieldPolicy, ok := p.Fields[key]
+	if !ok {
+		return nil
+	}
+	return fieldPolicy.validate(key, contentType, size)
+}
+
+// ValidateContent checks the declared content type of an asset against
+// the one detected from the beginning of its content, if
+// SniffContentType is enabled
+func (p *UploadPolicy) ValidateContent(contentType string, head []byte) error {
+	if p == nil || !p.SniffContentType {
+		return nil
+	}
+
+	sniffed := http.DetectContentType(head)
+	if !ContentTypeMatches(contentType, sniffed) {
+		return UploadPolicyError{
+			Reason: fmt.Sprintf(
+				"of content type %s has content of %s",
+				contentType,
+				parseMediaType(sniffed),
+			),
+		}
+	}
+	return nil
+}
+
+// EXIFStripping returns the metadata stripped from uploaded JPEG images
+func (p *UploadPolicy) EXIFStripping() EXIFStripping {
+	if p == nil || p.StripEXIF == "" {
+		return EXIFStripGPS
+	}
+	return p.StripEXIF
+}
+
+// ContentTypeMatches reports whether content detected as sniffed can be
+// declared as contentType. As detection only recognizes a limited set of
+// formats, content is only rejected if it is detected as a different kind
+// of content, such as an HTML page declared as an image.
+func ContentTypeMatches(contentType string, sniffed string) bool {
+	declared := parseMediaType(contentType)
+	detected := parseMediaType(sniffed)
+	if declared == detected {
+		return true
+	}
+
+	switch detected {
+	case "application/octet-stream":
+		// unrecognized binary content
+		return true
+	case "text/plain":
+		// unrecognized text content, such as json and csv
+		return !isBinaryMedia(declared)
+	case "text/xml":
+		return strings.HasSuffix(declared, "+xml") || strings.HasSuffix(declared, "/xml")
+	case "application/zip":
+		// zip based formats, such as docx and epub
+		return strings.HasSuffix(declared, "+zip") ||
+			strings.HasPrefix(declared, "application/vnd.") ||
+			declared == "application/java-archive"
+	}
+
+	return contentTypeFamily(declared) == contentTypeFamily(detected)
+}
+
+// contentTypeFamily groups content types whose formats are commonly
+// detected as one another, such as audio stored in video containers
+func contentTypeFamily(mediaType string) string {
+	topLevel := strings.SplitN(mediaType, "/", 2)[0]
+	if topLevel == "audio" || topLevel == "video" {
+		return "media"
+	}
+	return topLevel
+}
+
+// isBinaryMedia reports whether the content type is of binary media
+// formats, which cannot be plain text
+func isBinaryMedia(mediaType string) bool {
+	family := contentTypeFamily(mediaType)
+	return family == "image" || family == "media"
+}
+
+func parseMediaType(contentType string) string {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return strings.ToLower(strings.TrimSpace(contentType))
+	}
+	return mediaType
+}
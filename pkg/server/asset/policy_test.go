@@ -0,0 +1,117 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package asset
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestUploadPolicy(t *testing.T) {
+	Convey("UploadPolicy", t, func() {
+		policy := &UploadPolicy{
+			FieldUploadPolicy: FieldUploadPolicy{
+				MaxSize:      100,
+				ContentTypes: []string{"image/*", "application/pdf"},
+			},
+			SniffContentType: true,
+			Fields: map[string]FieldUploadPolicy{
+				"user.avatar": {
+					MaxSize:      10,
+					ContentTypes: []string{"image/png"},
+				},
+			},
+		}
+
+		Convey("allows everything without policy", func() {
+			var nilPolicy *UploadPolicy
+			So(nilPolicy.Validate("text/html", 1000), ShouldBeNil)
+			So(nilPolicy.ValidateField("user", "avatar", "text/html", 1000), ShouldBeNil)
+			So(nilPolicy.ValidateContent("image/png", []byte("<html>")), ShouldBeNil)
+		})
+
+		Convey("strips GPS location by default", func() {
+			var nilPolicy *UploadPolicy
+			So(nilPolicy.EXIFStripping(), ShouldEqual, EXIFStripGPS)
+			So(policy.EXIFStripping(), ShouldEqual, EXIFStripGPS)
+
+			policy.StripEXIF = EXIFStripNone
+			So(policy.EXIFStripping(), ShouldEqual, EXIFStripNone)
+		})
+
+		Convey("validates size", func() {
+			So(policy.Validate("image/png", 100), ShouldBeNil)
+			So(policy.Validate("image/png", 101), ShouldResemble, UploadPolicyError{
+				MaxSize: 100,
+				Reason:  "is larger than 100 bytes",
+			})
+		})
+
+		Convey("validates content type", func() {
+			So(policy.Validate("image/jpeg", 10), ShouldBeNil)
+			So(policy.Validate("application/pdf; charset=binary", 10), ShouldBeNil)
+			err := policy.Validate("text/html", 10)
+			So(err, ShouldHaveSameTypeAs, UploadPolicyError{})
+			So(err.Error(), ShouldEqual, "Asset of content type text/html is not allowed")
+		})
+
+		Convey("validates field", func() {
+			So(policy.ValidateField("user", "avatar", "image/png", 10), ShouldBeNil)
+			So(policy.ValidateField("user", "avatar", "image/png", 11), ShouldResemble, UploadPolicyError{
+				Field:   "user.avatar",
+				MaxSize: 10,
+				Reason:  "is larger than 10 bytes",
+			})
+			So(policy.ValidateField("user", "avatar", "image/jpeg", 10), ShouldNotBeNil)
+			So(policy.ValidateField("user", "avatar", "text/html", 10), ShouldNotBeNil)
+			So(policy.ValidateField("note", "image", "image/jpeg", 100), ShouldBeNil)
+		})
+
+		Convey("validates content", func() {
+			So(policy.ValidateContent("image/png", encodeTestPNG(1, 1)), ShouldBeNil)
+			So(policy.ValidateContent("image/png", []byte("<html><script>")), ShouldNotBeNil)
+			So(policy.ValidateContent("image/png", []byte("plain text")), ShouldNotBeNil)
+
+			policy.SniffContentType = false
+			So(policy.ValidateContent("image/png", []byte("<html><script>")), ShouldBeNil)
+		})
+	})
+}
+
+func TestContentTypeMatches(t *testing.T) {
+	Convey("ContentTypeMatches", t, func() {
+		for _, c := range []struct {
+			declared string
+			sniffed  string
+			matches  bool
+		}{
+			{"image/png", "image/png", true},
+			{"image/jpg", "image/jpeg", true},
+			{"image/png", "text/html; charset=utf-8", false},
+			{"image/png", "text/plain; charset=utf-8", false},
+			{"application/json", "text/plain; charset=utf-8", true},
+			{"text/csv", "text/plain; charset=utf-8", true},
+			{"audio/mp4", "video/mp4", true},
+			{"video/mp4", "application/pdf", false},
+			{"application/x-custom", "application/octet-stream", true},
+			{"image/svg+xml", "text/xml; charset=utf-8", true},
+			{"application/vnd.openxmlformats-officedocument.wordprocessingml.document", "application/zip", true},
+			{"image/png", "application/zip", false},
+		} {
+			So(ContentTypeMatches(c.declared, c.sniffed), ShouldEqual, c.matches)
+		}
+	})
+}
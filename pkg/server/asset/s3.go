@@ -15,20 +15,68 @@
 package asset
 
 import (
+	"crypto/tls"
 	"errors"
 	"fmt"
 	"io"
+	"net/http"
+	"path"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/aws/credentials"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/s3"
 	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+
+	"github.com/skygeario/skygear-server/pkg/server/uuid"
 )
 
+// s3MaxMultipartParts is the maximum number of parts of a multipart
+// upload on s3
+const s3MaxMultipartParts = 10000
+
+// defaultMultipartPartSize is the part size of multipart upload if the
+// file can be uploaded within the maximum number of parts. It must not be
+// smaller than 5 MB, the minimum part size on s3.
+const defaultMultipartPartSize = 8 << 20
+
+// multipartUploadURLExpiry is the validity of the presigned part URLs
+const multipartUploadURLExpiry = time.Hour
+
+// defaultS3CompatibleRegion is the region of an S3-compatible storage if
+// not specified, which is required for signing requests
+const defaultS3CompatibleRegion = "us-east-1"
+
+// S3Options are the options of connecting to S3 or an S3-compatible
+// storage like MinIO, and of the objects stored
+type S3Options struct {
+	// Endpoint is the URL of an S3-compatible storage, empty means AWS S3
+	Endpoint string
+	// ForcePathStyle addresses the bucket in the URL path instead of the
+	// host name, which is required by most S3-compatible storages
+	ForcePathStyle bool
+	// InsecureSkipVerify skips verifying the TLS certificate of the
+	// endpoint, which should only be used for testing
+	InsecureSkipVerify bool
+	// ServerSideEncryption is the algorithm of encrypting stored objects,
+	// which is AES256 or aws:kms, empty means not encrypted
+	ServerSideEncryption string
+	// SSEKMSKeyID is the KMS key of aws:kms encryption, empty means the
+	// default key
+	SSEKMSKeyID string
+	// StorageClass is the storage class of stored objects like
+	// STANDARD_IA, empty means STANDARD
+	StorageClass string
+	// PresignUpload makes files uploaded directly to the bucket with
+	// presigned requests, instead of through the server. The content
+	// of such files is not sniffed, see UploadPolicy.
+	PresignUpload bool
+}
+
 // s3Store implements Store by storing files on S3
 type s3Store struct {
 	svc       *s3.S3
@@ -36,6 +84,7 @@ type s3Store struct {
 	bucket    *string
 	urlPrefix string
 	public    bool
+	options   S3Options
 }
 
 // NewS3Store returns a new s3Store
@@ -47,17 +96,61 @@ func NewS3Store(
 	urlPrefix string,
 	public bool,
 ) (Store, error) {
+	return NewS3StoreWithOptions(
+		accessKey,
+		secretKey,
+		regionName,
+		bucketName,
+		urlPrefix,
+		public,
+		S3Options{},
+	)
+}
+
+// NewS3StoreWithOptions returns a new s3Store connecting to S3 or an
+// S3-compatible storage with the options
+func NewS3StoreWithOptions(
+	accessKey string,
+	secretKey string,
+	regionName string,
+	bucketName string,
+	urlPrefix string,
+	public bool,
+	options S3Options,
+) (Store, error) {
 
 	creds := credentials.NewStaticCredentials(
 		accessKey,
 		secretKey,
 		"",
 	)
-	sess := session.Must(session.NewSession())
-	svc := s3.New(sess, &aws.Config{
+	config := &aws.Config{
 		Region:      aws.String(regionName),
 		Credentials: creds,
-	})
+	}
+	if options.Endpoint != "" {
+		config.Endpoint = aws.String(options.Endpoint)
+		if regionName == "" {
+			config.Region = aws.String(defaultS3CompatibleRegion)
+		}
+	}
+	if options.ForcePathStyle {
+		config.S3ForcePathStyle = aws.Bool(true)
+	}
+	if options.InsecureSkipVerify {
+		config.HTTPClient = &http.Client{
+			Transport: &http.Transport{
+				Proxy:           http.ProxyFromEnvironment,
+				TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+			},
+		}
+	}
+
+	sess, err := session.NewSession()
+	if err != nil {
+		return nil, err
+	}
+	svc := s3.New(sess, config)
 	uploader := s3manager.NewUploaderWithClient(svc)
 
 	bucket := aws.String(bucketName)
@@ -68,6 +161,7 @@ func NewS3Store(
 		bucket:    bucket,
 		urlPrefix: urlPrefix,
 		public:    public,
+		options:   options,
 	}, nil
 }
 
@@ -95,12 +189,25 @@ func (s *s3Store) GetRangedFileReader(
 	}
 
 	output, err := s.svc.GetObject(input)
-	if err != nil {
+	if aerr, ok := err.(awserr.Error); ok && aerr.Code() == "InvalidRange" {
+		return nil, FileRangeNotAcceptedError{fileRange}
+	} else if err != nil {
 		return nil, err
 	}
 
+	// some S3-compatible storages return the whole object if the range
+	// covers it
 	if output.ContentRange == nil {
-		return nil, errors.New("missing content ranges header")
+		if output.ContentLength == nil {
+			output.Body.Close()
+			return nil, errors.New("missing content ranges header")
+		}
+		totalSize := aws.Int64Value(output.ContentLength)
+		return &FileRangedGetResult{
+			ReadCloser:    output.Body,
+			AcceptedRange: FileRange{From: 0, To: totalSize - 1},
+			TotalSize:     totalSize,
+		}, nil
 	}
 
 	acceptedRange, totalSize, err := parseContentRange(*output.ContentRange)
@@ -124,22 +231,311 @@ func (s *s3Store) PutFileReader(
 ) error {
 	key := aws.String(name)
 	input := &s3manager.UploadInput{
-		Body:        src,
-		Bucket:      s.bucket,
-		Key:         key,
-		ContentType: aws.String(contentType),
+		Body:                 src,
+		Bucket:               s.bucket,
+		Key:                  key,
+		ContentType:          aws.String(contentType),
+		ServerSideEncryption: optionalString(s.options.ServerSideEncryption),
+		SSEKMSKeyId:          optionalString(s.options.SSEKMSKeyID),
+		StorageClass:         optionalString(s.options.StorageClass),
 	}
 	_, err := s.uploader.Upload(input)
 	return err
 }
 
-// GeneratePostFileRequest return a PostFileRequest for uploading asset
+// PutContentAddressedFileReader uploads a file to s3 by the hash of its
+// content. The file is uploaded to a temporary object first, and copied
+// to its name once the hash is known and referenced.
+func (s *s3Store) PutContentAddressedFileReader(
+	src io.Reader,
+	length int64,
+	contentType string,
+	reference func(hash string) error,
+) (string, error) {
+	tempName := path.Join(ContentAddressedPrefix, "upload-"+uuid.New())
+	reader, hash := hashContent(src)
+	if err := s.PutFileReader(tempName, reader, length, contentType); err != nil {
+		return "", err
+	}
+	defer s.svc.DeleteObject(&s3.DeleteObjectInput{
+		Bucket: s.bucket,
+		Key:    aws.String(tempName),
+	})
+
+	if err := reference(hash()); err != nil {
+		return "", err
+	}
+
+	name := ContentObjectName(hash())
+	if _, err := s.svc.HeadObject(&s3.HeadObjectInput{
+		Bucket: s.bucket,
+		Key:    aws.String(name),
+	}); err == nil {
+		// identical content is stored already
+		return hash(), nil
+	}
+
+	if _, err := s.svc.CopyObject(&s3.CopyObjectInput{
+		Bucket:               s.bucket,
+		Key:                  aws.String(name),
+		CopySource:           aws.String(aws.StringValue(s.bucket) + "/" + tempName),
+		ServerSideEncryption: optionalString(s.options.ServerSideEncryption),
+		SSEKMSKeyId:          optionalString(s.options.SSEKMSKeyID),
+		StorageClass:         optionalString(s.options.StorageClass),
+	}); err != nil {
+		return "", err
+	}
+	return hash(), nil
+}
+
+// SignedContentURL returns a signed s3 URL of the object storing the
+// content of the named asset
+func (s *s3Store) SignedContentURL(name string, hash string) (string, error) {
+	return s.SignedURL(ContentObjectName(hash))
+}
+
+// GetFileVersion returns the version ID of the object, or its ETag if the
+// bucket is not versioned
+func (s *s3Store) GetFileVersion(name string) (string, error) {
+	output, err := s.svc.HeadObject(&s3.HeadObjectInput{
+		Bucket: s.bucket,
+		Key:    aws.String(name),
+	})
+	if err != nil {
+		return "", err
+	}
+	if versionID := aws.StringValue(output.VersionId); versionID != "" && versionID != "null" {
+		return versionID, nil
+	}
+	return aws.StringValue(output.ETag), nil
+}
+
+// CountTransformedImages returns the number of transformed images cached
+// for the object, counting up to MaxImageTransformVariants
+func (s *s3Store) CountTransformedImages(name string) (int, error) {
+	output, err := s.svc.ListObjectsV2(&s3.ListObjectsV2Input{
+		Bucket:  s.bucket,
+		Prefix:  aws.String(path.Join(TransformedAssetPrefix, name) + "/"),
+		MaxKeys: aws.Int64(MaxImageTransformVariants),
+	})
+	if err != nil {
+		return 0, err
+	}
+	return len(output.Contents), nil
+}
+
+// Delete deletes the object and its transformed images from s3
+func (s *s3Store) Delete(name string) error {
+	keys := []*s3.ObjectIdentifier{
+		{Key: aws.String(name)},
+	}
+
+	listInput := &s3.ListObjectsV2Input{
+		Bucket: s.bucket,
+		Prefix: aws.String(path.Join(TransformedAssetPrefix, name) + "/"),
+	}
+	err := s.svc.ListObjectsV2Pages(listInput, func(output *s3.ListObjectsV2Output, lastPage bool) bool {
+		for _, object := range output.Contents {
+			keys = append(keys, &s3.ObjectIdentifier{Key: object.Key})
+		}
+		return true
+	})
+	if err != nil {
+		return err
+	}
+
+	// DeleteObjects accepts at most 1000 keys in a request
+	for len(keys) > 0 {
+		batch := keys
+		if len(batch) > 1000 {
+			batch = batch[:1000]
+		}
+		keys = keys[len(batch):]
+
+		output, deleteErr := s.svc.DeleteObjects(&s3.DeleteObjectsInput{
+			Bucket: s.bucket,
+			Delete: &s3.Delete{
+				Objects: batch,
+				Quiet:   aws.Bool(true),
+			},
+		})
+		if deleteErr != nil {
+			return deleteErr
+		}
+		if len(output.Errors) > 0 {
+			return fmt.Errorf(
+				"failed to delete %s: %s",
+				aws.StringValue(output.Errors[0].Key),
+				aws.StringValue(output.Errors[0].Message),
+			)
+		}
+	}
+
+	return nil
+}
+
+// GeneratePostFileRequest return a PostFileRequest for uploading asset,
+// which is presigned for uploading to the bucket directly if PresignUpload
+// is enabled
 func (s *s3Store) GeneratePostFileRequest(name string, contentType string, length int64) (*PostFileRequest, error) {
-	return &PostFileRequest{
-		Action: "/files/" + name,
+	if !s.options.PresignUpload {
+		return &PostFileRequest{
+			Action: "/files/" + name,
+		}, nil
+	}
+	return s.presignPostFileRequest(name, contentType, length)
+}
+
+// GenerateMultipartUploadRequest initiates a multipart upload on s3 and
+// returns the presigned URLs for uploading each part of the file
+func (s *s3Store) GenerateMultipartUploadRequest(
+	name string,
+	contentType string,
+	length int64,
+) (*MultipartUploadRequest, error) {
+	partSize := multipartPartSize(length)
+
+	output, err := s.svc.CreateMultipartUpload(&s3.CreateMultipartUploadInput{
+		Bucket:               s.bucket,
+		Key:                  aws.String(name),
+		ContentType:          aws.String(contentType),
+		ServerSideEncryption: optionalString(s.options.ServerSideEncryption),
+		SSEKMSKeyId:          optionalString(s.options.SSEKMSKeyID),
+		StorageClass:         optionalString(s.options.StorageClass),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	uploadID := aws.StringValue(output.UploadId)
+	parts, err := s.presignUploadParts(name, uploadID, partSize, length)
+	if err != nil {
+		s.AbortMultipartUpload(name, uploadID)
+		return nil, err
+	}
+
+	return &MultipartUploadRequest{
+		UploadID: uploadID,
+		PartSize: partSize,
+		Parts:    parts,
 	}, nil
 }
 
+// RenewMultipartUploadRequest signs the part URLs of a multipart upload
+// again, for uploads taking longer than the URLs are valid
+func (s *s3Store) RenewMultipartUploadRequest(
+	name string,
+	uploadID string,
+	length int64,
+) (*MultipartUploadRequest, error) {
+	partSize := multipartPartSize(length)
+	parts, err := s.presignUploadParts(name, uploadID, partSize, length)
+	if err != nil {
+		return nil, err
+	}
+
+	return &MultipartUploadRequest{
+		UploadID: uploadID,
+		PartSize: partSize,
+		Parts:    parts,
+	}, nil
+}
+
+func (s *s3Store) presignUploadParts(
+	name string,
+	uploadID string,
+	partSize int64,
+	length int64,
+) ([]MultipartUploadPart, error) {
+	parts := []MultipartUploadPart{}
+	for partNumber := 1; int64(partNumber-1)*partSize < length; partNumber++ {
+		// the length of the part is signed, so that the parts cannot add
+		// up to a file larger than the declared length
+		contentLength := length - int64(partNumber-1)*partSize
+		if contentLength > partSize {
+			contentLength = partSize
+		}
+		req, _ := s.svc.UploadPartRequest(&s3.UploadPartInput{
+			Bucket:        s.bucket,
+			Key:           aws.String(name),
+			UploadId:      aws.String(uploadID),
+			PartNumber:    aws.Int64(int64(partNumber)),
+			ContentLength: aws.Int64(contentLength),
+		})
+		url, err := req.Presign(multipartUploadURLExpiry)
+		if err != nil {
+			return nil, err
+		}
+		parts = append(parts, MultipartUploadPart{
+			PartNumber: partNumber,
+			URL:        url,
+		})
+	}
+	return parts, nil
+}
+
+// CompleteMultipartUpload assembles the uploaded parts into the object,
+// which is deleted if it is not of the declared length
+func (s *s3Store) CompleteMultipartUpload(name string, uploadID string, parts []CompletedPart, length int64) error {
+	completedParts := make([]*s3.CompletedPart, len(parts))
+	for i, part := range parts {
+		completedParts[i] = &s3.CompletedPart{
+			PartNumber: aws.Int64(int64(part.PartNumber)),
+			ETag:       aws.String(part.ETag),
+		}
+	}
+
+	_, err := s.svc.CompleteMultipartUpload(&s3.CompleteMultipartUploadInput{
+		Bucket:   s.bucket,
+		Key:      aws.String(name),
+		UploadId: aws.String(uploadID),
+		MultipartUpload: &s3.CompletedMultipartUpload{
+			Parts: completedParts,
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	output, err := s.svc.HeadObject(&s3.HeadObjectInput{
+		Bucket: s.bucket,
+		Key:    aws.String(name),
+	})
+	if err != nil {
+		return err
+	}
+	if size := aws.Int64Value(output.ContentLength); size != length {
+		if _, err := s.svc.DeleteObject(&s3.DeleteObjectInput{
+			Bucket: s.bucket,
+			Key:    aws.String(name),
+		}); err != nil {
+			return err
+		}
+		return MultipartUploadSizeError{Length: length, Size: size}
+	}
+	return nil
+}
+
+// AbortMultipartUpload discards the uploaded parts
+func (s *s3Store) AbortMultipartUpload(name string, uploadID string) error {
+	_, err := s.svc.AbortMultipartUpload(&s3.AbortMultipartUploadInput{
+		Bucket:   s.bucket,
+		Key:      aws.String(name),
+		UploadId: aws.String(uploadID),
+	})
+	return err
+}
+
+// multipartPartSize returns the part size such that the file of length
+// can be uploaded within the maximum number of parts
+func multipartPartSize(length int64) int64 {
+	partSize := int64(defaultMultipartPartSize)
+	if minPartSize := (length + s3MaxMultipartParts - 1) / s3MaxMultipartParts; minPartSize > partSize {
+		partSize = minPartSize
+	}
+	return partSize
+}
+
 // SignedURL return a signed s3 URL with expiry date
 func (s *s3Store) SignedURL(name string) (string, error) {
 	if !s.IsSignatureRequired() {
@@ -0,0 +1,183 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package asset
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// PresignedUploadExpiry is the validity of the presigned upload requests
+const PresignedUploadExpiry = 15 * time.Minute
+
+// presignPostFileRequest returns a PostFileRequest for uploading the file
+// directly to the bucket, with either a POST request of the form fields
+// signed by a policy, or a presigned PUT request. Both restrict the
+// content type and the size of the file.
+//
+// See https://docs.aws.amazon.com/AmazonS3/latest/API/sigv4-HTTPPOSTConstructPolicy.html
+func (s *s3Store) presignPostFileRequest(name string, contentType string, length int64) (*PostFileRequest, error) {
+	action, err := s.bucketURL()
+	if err != nil {
+		return nil, err
+	}
+
+	creds, err := s.svc.Config.Credentials.Get()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	date := now.Format("20060102")
+	region := aws.StringValue(s.svc.Config.Region)
+	fields := map[string]string{
+		"key":              name,
+		"Content-Type":     contentType,
+		"x-amz-algorithm":  "AWS4-HMAC-SHA256",
+		"x-amz-credential": strings.Join([]string{creds.AccessKeyID, date, region, "s3", "aws4_request"}, "/"),
+		"x-amz-date":       now.Format("20060102T150405Z"),
+	}
+	if creds.SessionToken != "" {
+		fields["x-amz-security-token"] = creds.SessionToken
+	}
+	if s.options.ServerSideEncryption != "" {
+		fields["x-amz-server-side-encryption"] = s.options.ServerSideEncryption
+	}
+	if s.options.SSEKMSKeyID != "" {
+		fields["x-amz-server-side-encryption-aws-kms-key-id"] = s.options.SSEKMSKeyID
+	}
+	if s.options.StorageClass != "" {
+		fields["x-amz-storage-class"] = s.options.StorageClass
+	}
+
+	// every field except the policy and the signature must be in the policy
+	conditions := []interface{}{
+		map[string]string{"bucket": aws.StringValue(s.bucket)},
+		[]interface{}{"content-length-range", length, length},
+	}
+	keys := []string{}
+	for key := range fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		conditions = append(conditions, map[string]string{key: fields[key]})
+	}
+
+	policy, err := json.Marshal(map[string]interface{}{
+		"expiration": now.Add(PresignedUploadExpiry).Format("2006-01-02T15:04:05.000Z"),
+		"conditions": conditions,
+	})
+	if err != nil {
+		return nil, err
+	}
+	encodedPolicy := base64.StdEncoding.EncodeToString(policy)
+	signingKey := s3SigningKey(creds.SecretAccessKey, date, region)
+
+	extraFields := map[string]interface{}{
+		"policy":          encodedPolicy,
+		"x-amz-signature": hex.EncodeToString(hmacSHA256(signingKey, encodedPolicy)),
+	}
+	for key, value := range fields {
+		extraFields[key] = value
+	}
+
+	putRequest, err := s.presignPutFileRequest(name, contentType, length)
+	if err != nil {
+		return nil, err
+	}
+
+	return &PostFileRequest{
+		Action:      action,
+		ExtraFields: extraFields,
+		PutRequest:  putRequest,
+	}, nil
+}
+
+// presignPutFileRequest returns a presigned PUT request for uploading the
+// file directly to the bucket
+func (s *s3Store) presignPutFileRequest(name string, contentType string, length int64) (*PutFileRequest, error) {
+	req, _ := s.svc.PutObjectRequest(&s3.PutObjectInput{
+		Bucket:               s.bucket,
+		Key:                  aws.String(name),
+		ContentType:          aws.String(contentType),
+		ContentLength:        aws.Int64(length),
+		ServerSideEncryption: optionalString(s.options.ServerSideEncryption),
+		SSEKMSKeyId:          optionalString(s.options.SSEKMSKeyID),
+		StorageClass:         optionalString(s.options.StorageClass),
+	})
+	url, header, err := req.PresignRequest(PresignedUploadExpiry)
+	if err != nil {
+		return nil, err
+	}
+
+	// the signed headers are not in canonical form
+	headers := map[string]string{}
+	for key, values := range header {
+		headers[http.CanonicalHeaderKey(key)] = strings.Join(values, ",")
+	}
+	return &PutFileRequest{
+		URL:     url,
+		Headers: headers,
+	}, nil
+}
+
+// bucketURL returns the URL of the bucket, which is addressed by the host
+// name or in the path depending on the configuration
+func (s *s3Store) bucketURL() (string, error) {
+	req, _ := s.svc.HeadBucketRequest(&s3.HeadBucketInput{
+		Bucket: s.bucket,
+	})
+	if err := req.Build(); err != nil {
+		return "", err
+	}
+
+	u := *req.HTTPRequest.URL
+	u.RawQuery = ""
+	return u.String(), nil
+}
+
+// s3SigningKey derives the AWS signature version 4 signing key of S3
+func s3SigningKey(secretKey string, date string, region string) []byte {
+	key := hmacSHA256([]byte("AWS4"+secretKey), date)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, "s3")
+	return hmacSHA256(key, "aws4_request")
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// optionalString returns nil for an empty string, such that the parameter
+// is omitted in the request
+func optionalString(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return aws.String(s)
+}
@@ -1,8 +1,22 @@
 package asset
 
 import (
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
 	"testing"
 
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
 	. "github.com/smartystreets/goconvey/convey"
 )
 
@@ -36,3 +50,383 @@ func TestS3Store(t *testing.T) {
 		})
 	})
 }
+
+func TestS3StoreMultipartUpload(t *testing.T) {
+	Convey("S3 Asset Store multipart upload", t, func() {
+		var requests []*http.Request
+		var bodies []string
+		completedSize := "20"
+		versionID := ""
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, _ := ioutil.ReadAll(r.Body)
+			requests = append(requests, r)
+			bodies = append(bodies, string(body))
+
+			switch {
+			case r.Method == "HEAD":
+				w.Header().Set("Content-Length", completedSize)
+				w.Header().Set("ETag", `"etag"`)
+				if versionID != "" {
+					w.Header().Set("X-Amz-Version-Id", versionID)
+				}
+			case r.Method == "POST" && r.URL.Query().Get("uploadId") != "":
+				w.Write([]byte(`<CompleteMultipartUploadResult><Key>movie.mp4</Key></CompleteMultipartUploadResult>`))
+			case r.Method == "POST":
+				w.Write([]byte(`<InitiateMultipartUploadResult><Key>movie.mp4</Key><UploadId>upload-id</UploadId></InitiateMultipartUploadResult>`))
+			case r.Method == "DELETE":
+				w.WriteHeader(http.StatusNoContent)
+			}
+		}))
+		defer server.Close()
+
+		svc := s3.New(session.Must(session.NewSession()), &aws.Config{
+			Region:           aws.String("us-east-1"),
+			Credentials:      credentials.NewStaticCredentials("access_key", "secret_key", ""),
+			Endpoint:         aws.String(server.URL),
+			S3ForcePathStyle: aws.Bool(true),
+		})
+		store := &s3Store{
+			svc:    svc,
+			bucket: aws.String("bucket"),
+		}
+
+		Convey("generates presigned part URLs", func() {
+			req, err := store.GenerateMultipartUploadRequest("movie.mp4", "video/mp4", 20<<20)
+			So(err, ShouldBeNil)
+			So(req.UploadID, ShouldEqual, "upload-id")
+			So(req.PartSize, ShouldEqual, 8<<20)
+			So(req.Parts, ShouldHaveLength, 3)
+
+			So(requests, ShouldHaveLength, 1)
+			So(requests[0].URL.Path, ShouldEqual, "/bucket/movie.mp4")
+			So(requests[0].Header.Get("Content-Type"), ShouldEqual, "video/mp4")
+
+			for i, part := range req.Parts {
+				So(part.PartNumber, ShouldEqual, i+1)
+				partURL, err := url.Parse(part.URL)
+				So(err, ShouldBeNil)
+				So(partURL.Path, ShouldEqual, "/bucket/movie.mp4")
+				So(partURL.Query().Get("uploadId"), ShouldEqual, "upload-id")
+				So(partURL.Query().Get("partNumber"), ShouldEqual, []string{"1", "2", "3"}[i])
+				So(partURL.Query().Get("X-Amz-Signature"), ShouldNotBeEmpty)
+				So(partURL.Query().Get("X-Amz-SignedHeaders"), ShouldContainSubstring, "content-length")
+			}
+		})
+
+		Convey("renews presigned part URLs", func() {
+			req, err := store.RenewMultipartUploadRequest("movie.mp4", "upload-id", 20<<20)
+			So(err, ShouldBeNil)
+			So(req.UploadID, ShouldEqual, "upload-id")
+			So(req.PartSize, ShouldEqual, 8<<20)
+			So(req.Parts, ShouldHaveLength, 3)
+			So(requests, ShouldBeEmpty)
+
+			partURL, err := url.Parse(req.Parts[2].URL)
+			So(err, ShouldBeNil)
+			So(partURL.Query().Get("uploadId"), ShouldEqual, "upload-id")
+			So(partURL.Query().Get("partNumber"), ShouldEqual, "3")
+			So(partURL.Query().Get("X-Amz-Signature"), ShouldNotBeEmpty)
+		})
+
+		Convey("completes multipart upload", func() {
+			err := store.CompleteMultipartUpload("movie.mp4", "upload-id", []CompletedPart{
+				{PartNumber: 1, ETag: `"etag-1"`},
+				{PartNumber: 2, ETag: `"etag-2"`},
+			}, 20)
+			So(err, ShouldBeNil)
+			So(requests, ShouldHaveLength, 2)
+			So(requests[0].URL.Query().Get("uploadId"), ShouldEqual, "upload-id")
+			So(strings.Count(bodies[0], "<Part>"), ShouldEqual, 2)
+			So(bodies[0], ShouldContainSubstring, "<PartNumber>2</PartNumber>")
+			So(requests[1].Method, ShouldEqual, "HEAD")
+		})
+
+		Convey("deletes completed upload of mismatched size", func() {
+			completedSize = "30"
+			err := store.CompleteMultipartUpload("movie.mp4", "upload-id", []CompletedPart{
+				{PartNumber: 1, ETag: `"etag-1"`},
+			}, 20)
+			So(err, ShouldResemble, MultipartUploadSizeError{Length: 20, Size: 30})
+			So(requests, ShouldHaveLength, 3)
+			So(requests[2].Method, ShouldEqual, "DELETE")
+			So(requests[2].URL.Path, ShouldEqual, "/bucket/movie.mp4")
+		})
+
+		Convey("gets ETag as file version", func() {
+			version, err := store.GetFileVersion("movie.mp4")
+			So(err, ShouldBeNil)
+			So(version, ShouldEqual, `"etag"`)
+		})
+
+		Convey("gets version ID as file version in versioned bucket", func() {
+			versionID = "version-id"
+			version, err := store.GetFileVersion("movie.mp4")
+			So(err, ShouldBeNil)
+			So(version, ShouldEqual, "version-id")
+		})
+
+		Convey("aborts multipart upload", func() {
+			So(store.AbortMultipartUpload("movie.mp4", "upload-id"), ShouldBeNil)
+			So(requests, ShouldHaveLength, 1)
+			So(requests[0].Method, ShouldEqual, "DELETE")
+		})
+	})
+
+	Convey("multipartPartSize", t, func() {
+		So(multipartPartSize(1), ShouldEqual, 8<<20)
+		So(multipartPartSize(10000*(8<<20)), ShouldEqual, 8<<20)
+		So(multipartPartSize(10000*(8<<20)+1), ShouldEqual, 8<<20+1)
+	})
+}
+
+func TestS3StoreContentAddressed(t *testing.T) {
+	Convey("S3 Asset Store storing files by content", t, func() {
+		const helloHash = "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824"
+		objects := map[string]string{}
+		var copySources []string
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, _ := ioutil.ReadAll(r.Body)
+			key := strings.TrimPrefix(r.URL.Path, "/bucket/")
+
+			switch r.Method {
+			case "PUT":
+				if source := r.Header.Get("X-Amz-Copy-Source"); source != "" {
+					copySources = append(copySources, source)
+					objects[key] = objects[strings.TrimPrefix(source, "bucket/")]
+					w.Write([]byte(`<CopyObjectResult><ETag>"etag"</ETag></CopyObjectResult>`))
+					return
+				}
+				objects[key] = string(body)
+			case "HEAD":
+				if _, ok := objects[key]; !ok {
+					w.WriteHeader(http.StatusNotFound)
+				}
+			case "DELETE":
+				delete(objects, key)
+				w.WriteHeader(http.StatusNoContent)
+			}
+		}))
+		defer server.Close()
+
+		svc := s3.New(session.Must(session.NewSession()), &aws.Config{
+			Region:           aws.String("us-east-1"),
+			Credentials:      credentials.NewStaticCredentials("access_key", "secret_key", ""),
+			Endpoint:         aws.String(server.URL),
+			S3ForcePathStyle: aws.Bool(true),
+		})
+		store := &s3Store{
+			svc:      svc,
+			uploader: s3manager.NewUploaderWithClient(svc),
+			bucket:   aws.String("bucket"),
+		}
+
+		Convey("uploads file by hash", func() {
+			hash, err := store.PutContentAddressedFileReader(strings.NewReader("hello"), 5, "text/plain", noReference)
+			So(err, ShouldBeNil)
+			So(hash, ShouldEqual, helloHash)
+			So(objects, ShouldResemble, map[string]string{
+				ContentObjectName(helloHash): "hello",
+			})
+			So(copySources, ShouldHaveLength, 1)
+		})
+
+		Convey("uploads identical content once", func() {
+			objects[ContentObjectName(helloHash)] = "hello"
+
+			hash, err := store.PutContentAddressedFileReader(strings.NewReader("hello"), 5, "text/plain", noReference)
+			So(err, ShouldBeNil)
+			So(hash, ShouldEqual, helloHash)
+			So(objects, ShouldHaveLength, 1)
+			So(copySources, ShouldBeEmpty)
+		})
+
+		Convey("does not copy content failed to be referenced", func() {
+			_, err := store.PutContentAddressedFileReader(strings.NewReader("hello"), 5, "text/plain", func(string) error {
+				return errors.New("reference failed")
+			})
+			So(err, ShouldNotBeNil)
+			So(objects, ShouldNotContainKey, ContentObjectName(helloHash))
+			So(copySources, ShouldBeEmpty)
+		})
+
+		Convey("signs content url by hash", func() {
+			s, err := store.SignedContentURL("index.html", helloHash)
+			So(err, ShouldBeNil)
+			parsedURL, err := url.Parse(s)
+			So(err, ShouldBeNil)
+			So(parsedURL.Path, ShouldEqual, "/bucket/"+ContentObjectName(helloHash))
+		})
+	})
+}
+
+func TestS3StoreWithOptions(t *testing.T) {
+	Convey("S3 Asset Store with S3-compatible endpoint", t, func() {
+		var requests []*http.Request
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ioutil.ReadAll(r.Body)
+			requests = append(requests, r)
+
+			switch {
+			case r.URL.Path == "/bucket/out-of-range.txt":
+				w.WriteHeader(http.StatusRequestedRangeNotSatisfiable)
+				w.Write([]byte(`<Error><Code>InvalidRange</Code><Message>The requested range is not satisfiable</Message></Error>`))
+			case r.URL.Path == "/bucket/missing.txt":
+				w.WriteHeader(http.StatusNotFound)
+				w.Write([]byte(`<Error><Code>NoSuchKey</Code><Message>The specified key does not exist.</Message></Error>`))
+			case r.URL.Path == "/bucket/whole.txt":
+				w.Header().Set("Content-Length", "5")
+				w.Write([]byte("hello"))
+			case r.URL.Query().Get("list-type") == "2":
+				w.Write([]byte(`<ListBucketResult><Contents><Key>_transformed/photo.png/a.jpeg</Key></Contents><Contents><Key>_transformed/photo.png/b.webp</Key></Contents></ListBucketResult>`))
+			case r.Method == "GET":
+				w.Header().Set("Content-Range", "bytes 1-3/5")
+				w.Header().Set("Content-Length", "3")
+				w.WriteHeader(http.StatusPartialContent)
+				w.Write([]byte("ell"))
+			}
+		}))
+		defer server.Close()
+
+		store, err := NewS3StoreWithOptions(
+			"access_key",
+			"secret_key",
+			"",
+			"bucket",
+			"",
+			false,
+			S3Options{
+				Endpoint:             server.URL,
+				ForcePathStyle:       true,
+				ServerSideEncryption: "AES256",
+				StorageClass:         "STANDARD_IA",
+				PresignUpload:        true,
+			},
+		)
+		So(err, ShouldBeNil)
+
+		Convey("uploads with encryption and storage class", func() {
+			So(store.PutFileReader("hello.txt", strings.NewReader("hello"), 5, "text/plain"), ShouldBeNil)
+			So(requests, ShouldHaveLength, 1)
+			So(requests[0].URL.Path, ShouldEqual, "/bucket/hello.txt")
+			So(requests[0].Header.Get("X-Amz-Server-Side-Encryption"), ShouldEqual, "AES256")
+			So(requests[0].Header.Get("X-Amz-Storage-Class"), ShouldEqual, "STANDARD_IA")
+		})
+
+		Convey("reads file in range", func() {
+			result, err := store.(FileRangedGetter).GetRangedFileReader("hello.txt", FileRange{From: 1, To: 3})
+			So(err, ShouldBeNil)
+			defer result.ReadCloser.Close()
+			data, _ := ioutil.ReadAll(result.ReadCloser)
+			So(string(data), ShouldEqual, "ell")
+			So(result.AcceptedRange, ShouldResemble, FileRange{From: 1, To: 3})
+			So(result.TotalSize, ShouldEqual, 5)
+			So(requests[0].Header.Get("Range"), ShouldEqual, "bytes=1-3")
+		})
+
+		Convey("reads whole file if range is ignored", func() {
+			result, err := store.(FileRangedGetter).GetRangedFileReader("whole.txt", FileRange{From: 0, To: 10})
+			So(err, ShouldBeNil)
+			defer result.ReadCloser.Close()
+			So(result.AcceptedRange, ShouldResemble, FileRange{From: 0, To: 4})
+			So(result.TotalSize, ShouldEqual, 5)
+		})
+
+		Convey("errors on range not satisfiable", func() {
+			_, err := store.(FileRangedGetter).GetRangedFileReader("out-of-range.txt", FileRange{From: 10, To: 20})
+			So(err, ShouldResemble, FileRangeNotAcceptedError{FileRange{From: 10, To: 20}})
+		})
+
+		Convey("errors on missing file", func() {
+			_, err := store.GetFileReader("missing.txt")
+			So(IsNotExist(err), ShouldBeTrue)
+
+			_, err = store.(FileRangedGetter).GetRangedFileReader("out-of-range.txt", FileRange{From: 10, To: 20})
+			So(IsNotExist(err), ShouldBeFalse)
+		})
+
+		Convey("generates presigned post file request", func() {
+			req, err := store.GeneratePostFileRequest("hello.txt", "text/plain", 5)
+			So(err, ShouldBeNil)
+			So(req.Action, ShouldEqual, server.URL+"/bucket")
+			So(req.ExtraFields["key"], ShouldEqual, "hello.txt")
+			So(req.ExtraFields["Content-Type"], ShouldEqual, "text/plain")
+			So(req.ExtraFields["x-amz-server-side-encryption"], ShouldEqual, "AES256")
+			So(req.ExtraFields["x-amz-storage-class"], ShouldEqual, "STANDARD_IA")
+			So(req.ExtraFields["x-amz-credential"], ShouldStartWith, "access_key/")
+			So(req.ExtraFields["x-amz-credential"], ShouldEndWith, "/us-east-1/s3/aws4_request")
+
+			encodedPolicy := req.ExtraFields["policy"].(string)
+			policyJSON, err := base64.StdEncoding.DecodeString(encodedPolicy)
+			So(err, ShouldBeNil)
+			policy := map[string]interface{}{}
+			So(json.Unmarshal(policyJSON, &policy), ShouldBeNil)
+			conditions := policy["conditions"].([]interface{})
+			So(conditions, ShouldContain, map[string]interface{}{"bucket": "bucket"})
+			So(conditions, ShouldContain, map[string]interface{}{"key": "hello.txt"})
+			So(conditions, ShouldContain, []interface{}{"content-length-range", 5.0, 5.0})
+
+			date := strings.Split(req.ExtraFields["x-amz-credential"].(string), "/")[1]
+			signature := hmacSHA256(s3SigningKey("secret_key", date, "us-east-1"), encodedPolicy)
+			So(req.ExtraFields["x-amz-signature"], ShouldEqual, hex.EncodeToString(signature))
+
+			So(req.PutRequest, ShouldNotBeNil)
+			putURL, err := url.Parse(req.PutRequest.URL)
+			So(err, ShouldBeNil)
+			So(putURL.Path, ShouldEqual, "/bucket/hello.txt")
+			So(putURL.Query().Get("X-Amz-Signature"), ShouldNotBeEmpty)
+			So(req.PutRequest.Headers["X-Amz-Storage-Class"], ShouldEqual, "STANDARD_IA")
+			So(req.PutRequest.Headers["Content-Type"], ShouldEqual, "text/plain")
+		})
+
+		Convey("counts transformed images", func() {
+			count, err := store.(TransformedImageCounter).CountTransformedImages("photo.png")
+			So(err, ShouldBeNil)
+			So(count, ShouldEqual, 2)
+			So(requests[0].URL.Query().Get("prefix"), ShouldEqual, "_transformed/photo.png/")
+			So(requests[0].URL.Query().Get("max-keys"), ShouldEqual, "20")
+		})
+
+		Convey("uploads through server without presigned upload", func() {
+			store.(*s3Store).options.PresignUpload = false
+			req, err := store.GeneratePostFileRequest("hello.txt", "text/plain", 5)
+			So(err, ShouldBeNil)
+			So(req, ShouldResemble, &PostFileRequest{
+				Action: "/files/hello.txt",
+			})
+		})
+	})
+
+	Convey("S3 Asset Store skipping TLS verification", t, func() {
+		server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("hello"))
+		}))
+		defer server.Close()
+
+		newStore := func(insecureSkipVerify bool) Store {
+			store, err := NewS3StoreWithOptions(
+				"access_key",
+				"secret_key",
+				"us-east-1",
+				"bucket",
+				"",
+				false,
+				S3Options{
+					Endpoint:           server.URL,
+					ForcePathStyle:     true,
+					InsecureSkipVerify: insecureSkipVerify,
+				},
+			)
+			So(err, ShouldBeNil)
+			return store
+		}
+
+		reader, err := newStore(true).GetFileReader("hello.txt")
+		So(err, ShouldBeNil)
+		data, _ := ioutil.ReadAll(reader)
+		reader.Close()
+		So(string(data), ShouldEqual, "hello")
+
+		_, err = newStore(false).GetFileReader("hello.txt")
+		So(err, ShouldNotBeNil)
+	})
+}
@@ -0,0 +1,143 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package asset
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+)
+
+// ScanResult is the result of scanning a file for malware
+type ScanResult struct {
+	Infected bool
+	// Signature is the name of the malware found, if any
+	Signature string
+}
+
+// Scanner scans the content of assets for malware
+type Scanner interface {
+	// Scan reads the content of the named asset from src, and returns an
+	// error if the content cannot be scanned.
+	Scan(name string, src io.Reader) (*ScanResult, error)
+}
+
+const clamdChunkSize = 32 * 1024
+
+// ClamdScanner scans files with clamd through its TCP socket, with the
+// INSTREAM command. The file is streamed to clamd in chunks, so the
+// StreamMaxLength of clamd must not be smaller than the largest asset.
+type ClamdScanner struct {
+	// Address is the host and port of the TCP socket of clamd
+	Address string
+	// Timeout is the time limit of scanning a file, including connecting
+	// to clamd
+	Timeout time.Duration
+}
+
+// NewClamdScanner creates a new ClamdScanner
+func NewClamdScanner(address string, timeout time.Duration) *ClamdScanner {
+	return &ClamdScanner{
+		Address: address,
+		Timeout: timeout,
+	}
+}
+
+// Scan streams the file to clamd, and parses the reply
+func (s *ClamdScanner) Scan(name string, src io.Reader) (*ScanResult, error) {
+	conn, err := net.DialTimeout("tcp", s.Address, s.Timeout)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	if err := conn.SetDeadline(time.Now().Add(s.Timeout)); err != nil {
+		return nil, err
+	}
+
+	// the z prefix makes the command and the reply null-terminated
+	if _, err := io.WriteString(conn, "zINSTREAM\x00"); err != nil {
+		return nil, err
+	}
+
+	writer := bufio.NewWriterSize(conn, clamdChunkSize+4)
+	chunk := make([]byte, clamdChunkSize)
+	for {
+		n, readErr := io.ReadFull(src, chunk)
+		if n > 0 {
+			if err := writeClamdChunk(writer, chunk[:n]); err != nil {
+				return nil, err
+			}
+		}
+		if readErr == io.EOF || readErr == io.ErrUnexpectedEOF {
+			break
+		}
+		if readErr != nil {
+			return nil, readErr
+		}
+	}
+
+	// a zero-length chunk marks the end of the stream
+	if err := writeClamdChunk(writer, nil); err != nil {
+		return nil, err
+	}
+	if err := writer.Flush(); err != nil {
+		return nil, err
+	}
+
+	reply, err := bufio.NewReader(conn).ReadString('\x00')
+	if err != nil {
+		return nil, fmt.Errorf("failed to read clamd reply: %v", err)
+	}
+	return parseClamdReply(strings.TrimSuffix(reply, "\x00"))
+}
+
+func writeClamdChunk(w io.Writer, chunk []byte) error {
+	size := make([]byte, 4)
+	binary.BigEndian.PutUint32(size, uint32(len(chunk)))
+	if _, err := w.Write(size); err != nil {
+		return err
+	}
+	_, err := w.Write(chunk)
+	return err
+}
+
+// parseClamdReply parses the reply of the INSTREAM command, which is one of
+//
+//  stream: OK
+//  stream: Eicar-Test-Signature FOUND
+//  INSTREAM size limit exceeded. ERROR
+func parseClamdReply(reply string) (*ScanResult, error) {
+	reply = strings.TrimSpace(reply)
+	switch {
+	case strings.HasSuffix(reply, " OK"):
+		return &ScanResult{}, nil
+	case strings.HasSuffix(reply, " FOUND"):
+		signature := strings.TrimSuffix(reply, " FOUND")
+		if i := strings.Index(signature, ": "); i >= 0 {
+			signature = signature[i+2:]
+		}
+		return &ScanResult{
+			Infected:  true,
+			Signature: signature,
+		}, nil
+	default:
+		return nil, fmt.Errorf("unexpected clamd reply: %s", reply)
+	}
+}
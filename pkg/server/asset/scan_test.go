@@ -0,0 +1,124 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package asset
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// fakeClamd accepts a connection at a time and replies the INSTREAM
+// command with the reply function of the received content
+func fakeClamd(t *testing.T, reply func(content []byte) string) net.Listener {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+
+			r := bufio.NewReader(conn)
+			command, _ := r.ReadString('\x00')
+			if command != "zINSTREAM\x00" {
+				io.WriteString(conn, "UNKNOWN COMMAND\x00")
+				conn.Close()
+				continue
+			}
+
+			content := []byte{}
+			for {
+				size := make([]byte, 4)
+				if _, err := io.ReadFull(r, size); err != nil {
+					break
+				}
+				n := binary.BigEndian.Uint32(size)
+				if n == 0 {
+					break
+				}
+				chunk := make([]byte, n)
+				if _, err := io.ReadFull(r, chunk); err != nil {
+					break
+				}
+				content = append(content, chunk...)
+			}
+			io.WriteString(conn, reply(content)+"\x00")
+			conn.Close()
+		}
+	}()
+	return l
+}
+
+func TestClamdScanner(t *testing.T) {
+	Convey("ClamdScanner", t, func() {
+		l := fakeClamd(t, func(content []byte) string {
+			if bytes.Contains(content, []byte("EICAR")) {
+				return "stream: Eicar-Test-Signature FOUND"
+			}
+			if len(content) > 64*1024 {
+				return "INSTREAM size limit exceeded. ERROR"
+			}
+			return "stream: OK"
+		})
+		defer l.Close()
+
+		scanner := NewClamdScanner(l.Addr().String(), time.Second)
+
+		Convey("scan clean file", func() {
+			result, err := scanner.Scan("clean.txt", strings.NewReader("hello world"))
+			So(err, ShouldBeNil)
+			So(result, ShouldResemble, &ScanResult{})
+		})
+
+		Convey("scan infected file in chunks", func() {
+			content := append(bytes.Repeat([]byte("a"), clamdChunkSize), []byte("EICAR")...)
+			result, err := scanner.Scan("infected.txt", bytes.NewReader(content))
+			So(err, ShouldBeNil)
+			So(result, ShouldResemble, &ScanResult{
+				Infected:  true,
+				Signature: "Eicar-Test-Signature",
+			})
+		})
+
+		Convey("return error on clamd error", func() {
+			content := bytes.Repeat([]byte("a"), 64*1024+1)
+			_, err := scanner.Scan("large.txt", bytes.NewReader(content))
+			So(err, ShouldNotBeNil)
+		})
+	})
+
+	Convey("ClamdScanner without clamd", t, func() {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		So(err, ShouldBeNil)
+		address := l.Addr().String()
+		l.Close()
+
+		scanner := NewClamdScanner(address, time.Second)
+		_, err = scanner.Scan("clean.txt", strings.NewReader("hello world"))
+		So(err, ShouldNotBeNil)
+	})
+}
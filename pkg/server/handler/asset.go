@@ -15,11 +15,16 @@
 package handler
 
 import (
+	"fmt"
+	"net/url"
 	"path/filepath"
 	"strings"
 
+	"github.com/mitchellh/mapstructure"
+
 	skyAsset "github.com/skygeario/skygear-server/pkg/server/asset"
 	"github.com/skygeario/skygear-server/pkg/server/logging"
+	"github.com/skygeario/skygear-server/pkg/server/recordutil"
 	"github.com/skygeario/skygear-server/pkg/server/router"
 	"github.com/skygeario/skygear-server/pkg/server/skydb"
 	"github.com/skygeario/skygear-server/pkg/server/skydb/skyconv"
@@ -27,18 +32,52 @@ import (
 )
 
 // AssetUploadHandler models the handler for asset upload request
+//
+// If multipart is true, the file is uploaded in parts directly to the
+// asset store and multipart-request is returned instead of post-request,
+// see asset.MultipartUploadRequest. Only the s3 asset store supports
+// multipart upload. The part URLs expire after an hour, and are renewed
+// by asset:renew-upload.
+//
+// The asset is rejected if its content type or size violates the upload
+// policy. If record-type and field are given, the policy of the record
+// field the asset is to be saved to is also checked.
+//
+// If the asset store is content-addressed, multipart upload is not
+// supported, because the file has to be hashed by the server as it is
+// uploaded. Use asset:exists to skip uploading a file stored already.
+//
+// If asset scanning is enabled, the asset is pending until it is uploaded
+// and scanned, see AssetScanHandler. A file uploaded to the asset store
+// directly is scanned after the upload request expires.
+//
+//  curl -X POST -H "Content-Type: application/json" \
+//    -d @- http://localhost:3000/ <<EOF
+//  {
+//      "action": "asset:put",
+//      "api_key": "API_KEY",
+//      "filename": "movie.mp4",
+//      "content-type": "video/mp4",
+//      "content-size": 104857600,
+//      "multipart": true
+//  }
+//  EOF
 type AssetUploadHandler struct {
-	AssetStore    skyAsset.Store   `inject:"AssetStore"`
-	AccessKey     router.Processor `preprocessor:"accesskey"`
-	DBConn        router.Processor `preprocessor:"dbconn"`
-	PluginReady   router.Processor `preprocessor:"plugin_ready"`
-	preprocessors []router.Processor
+	AssetStore            skyAsset.Store         `inject:"AssetStore"`
+	AssetUploadPolicy     *skyAsset.UploadPolicy `inject:"AssetUploadPolicy"`
+	AssetContentAddressed bool                   `inject:"AssetContentAddressed"`
+	AssetScanEnabled      bool                   `inject:"AssetScanEnabled"`
+	AccessKey             router.Processor       `preprocessor:"accesskey"`
+	DBConn                router.Processor       `preprocessor:"dbconn"`
+	PluginReady           router.Processor       `preprocessor:"plugin_ready"`
+	preprocessors         []router.Processor
 }
 
 // AssetUploadResponse models the response of asset upload request
 type AssetUploadResponse struct {
-	PostRequest *skyAsset.PostFileRequest `json:"post-request"`
-	Asset       *map[string]interface{}   `json:"asset"`
+	PostRequest      *skyAsset.PostFileRequest        `json:"post-request,omitempty"`
+	MultipartRequest *skyAsset.MultipartUploadRequest `json:"multipart-request,omitempty"`
+	Asset            *map[string]interface{}          `json:"asset"`
 }
 
 // Setup adds injected pre-processors to preprocessors array
@@ -88,47 +127,389 @@ func (h *AssetUploadHandler) Handle(
 	}
 	contentSize := int64(contentSizeFloat)
 
-	// Add UUID to Filename
-	dir, file := filepath.Split(filename)
-	file = strings.Join([]string{uuidNew(), file}, "-")
-	filename = filepath.Join(dir, file)
+	recordType, _ := payload.Data["record-type"].(string)
+	field, _ := payload.Data["field"].(string)
+	var policyErr error
+	if recordType != "" && field != "" {
+		policyErr = h.AssetUploadPolicy.ValidateField(recordType, field, contentType, contentSize)
+	} else {
+		policyErr = h.AssetUploadPolicy.Validate(contentType, contentSize)
+	}
+	if policyErr != nil {
+		response.Err = recordutil.MakeUploadPolicyError(policyErr)
+		return
+	}
+
+	filename = makeUniqueAssetName(filename)
 
-	// Generate POST File Request
 	assetStore := h.AssetStore
-	postRequest, err := assetStore.GeneratePostFileRequest(filename, contentType, contentSize)
-	if err != nil {
-		response.Err = skyerr.NewError(
-			skyerr.UnexpectedError,
-			"Fail to generate post file request",
+	conn := payload.DBConn
+	uploadResponse := &AssetUploadResponse{}
+	if multipart, _ := payload.Data["multipart"].(bool); multipart {
+		if h.AssetContentAddressed {
+			response.Err = skyerr.NewError(
+				skyerr.NotSupported,
+				"Multipart upload is not supported by content-addressed asset store",
+			)
+			return
+		}
+
+		multipartRequest, skyErr := generateMultipartUploadRequest(
+			assetStore, conn, filename, contentType, contentSize,
 		)
-		return
+		if skyErr != nil {
+			response.Err = skyErr
+			return
+		}
+		uploadResponse.MultipartRequest = multipartRequest
+	} else {
+		// Generate POST File Request
+		postRequest, err := assetStore.GeneratePostFileRequest(filename, contentType, contentSize)
+		if err != nil {
+			response.Err = skyerr.NewError(
+				skyerr.UnexpectedError,
+				"Fail to generate post file request",
+			)
+			return
+		}
+		uploadResponse.PostRequest = postRequest
 	}
 
 	// Save Asset to DB
-	conn := payload.DBConn
 	asset := skydb.Asset{
 		Name:        filename,
 		ContentType: contentType,
 		Size:        contentSize,
+		Status:      uploadedAssetStatus(h.AssetScanEnabled),
 	}
 	if err := conn.SaveAsset(&asset); err != nil {
 		response.Err = skyerr.NewResourceSaveFailureErrWithStringID("asset", asset.Name)
 		return
 	}
 
+	logger := logging.CreateLogger(payload.Context(), "handler")
+	if h.AssetScanEnabled && uploadResponse.PostRequest != nil && uploadResponse.PostRequest.IsDirect() {
+		// the file uploaded to the asset store directly is scanned after
+		// the upload request expires, so that it cannot be replaced after
+		// the scan. Files uploaded through the server or in parts are
+		// scanned when the upload is finalized.
+		runAt := timeNow().Add(skyAsset.PresignedUploadExpiry)
+		if skyErr := scheduleAssetScan(conn, asset.Name, runAt, logger); skyErr != nil {
+			response.Err = skyErr
+			return
+		}
+	}
+
 	// Add Signer to Asset for Serialization
 	if signer, ok := assetStore.(skyAsset.URLSigner); ok {
 		asset.Signer = signer
 	} else {
-		logger := logging.CreateLogger(payload.Context(), "handler")
 		logger.Warnf("Failed to acquire asset URLSigner, please check configuration")
 		response.Err = skyerr.NewError(skyerr.UnexpectedError, "Failed to sign the url")
 		return
 	}
 	assetMap := skyconv.ToMap((*skyconv.MapAsset)(&asset))
 
-	response.Result = &AssetUploadResponse{
-		PostRequest: postRequest,
-		Asset:       &assetMap,
+	uploadResponse.Asset = &assetMap
+	response.Result = uploadResponse
+}
+
+// makeUniqueAssetName adds UUID to the filename
+func makeUniqueAssetName(filename string) string {
+	dir, file := filepath.Split(filename)
+	file = strings.Join([]string{uuidNew(), file}, "-")
+	return filepath.Join(dir, file)
+}
+
+// generateMultipartUploadRequest initiates a multipart upload on the
+// asset store, which is finalized through the URL of the resumable upload
+func generateMultipartUploadRequest(
+	assetStore skyAsset.Store,
+	conn skydb.Conn,
+	filename string,
+	contentType string,
+	contentSize int64,
+) (*skyAsset.MultipartUploadRequest, skyerr.Error) {
+	uploader, ok := assetStore.(skyAsset.FileMultipartUploader)
+	if !ok {
+		return nil, skyerr.NewError(
+			skyerr.NotSupported,
+			"Multipart upload is not supported by the asset store",
+		)
+	}
+	if contentSize <= 0 {
+		return nil, skyerr.NewInvalidArgument(
+			"content size must be positive for multipart upload",
+			[]string{"content-size"},
+		)
+	}
+
+	multipartRequest, err := uploader.GenerateMultipartUploadRequest(filename, contentType, contentSize)
+	if err != nil {
+		return nil, skyerr.NewError(
+			skyerr.UnexpectedError,
+			"Fail to generate multipart upload request",
+		)
+	}
+
+	now := timeNow()
+	upload := skydb.AssetUpload{
+		ID:                uuidNew(),
+		Name:              filename,
+		ContentType:       contentType,
+		Length:            contentSize,
+		MultipartUploadID: multipartRequest.UploadID,
+		CreatedAt:         now,
+		UpdatedAt:         now,
+	}
+	if err := conn.CreateAssetUpload(&upload); err != nil {
+		return nil, skyerr.MakeError(err)
+	}
+
+	multipartRequest.Action = "/files/" + assetUploadPath(upload.ID)
+	return multipartRequest, nil
+}
+
+// AssetRenewUploadHandler signs the part URLs of a multipart upload
+// again. The part URLs returned by asset:put expire after an hour, so an
+// upload taking longer renews them with the action URL of the
+// multipart-request. Renewing also keeps the upload from being deleted
+// as abandoned by asset:gc.
+//
+//  curl -X POST -H "Content-Type: application/json" \
+//    -d @- http://localhost:3000/ <<EOF
+//  {
+//      "action": "asset:renew-upload",
+//      "api_key": "API_KEY",
+//      "url": "/files/_uploads/UPLOAD_ID"
+//  }
+//  EOF
+type AssetRenewUploadHandler struct {
+	AssetStore    skyAsset.Store   `inject:"AssetStore"`
+	AccessKey     router.Processor `preprocessor:"accesskey"`
+	DBConn        router.Processor `preprocessor:"dbconn"`
+	PluginReady   router.Processor `preprocessor:"plugin_ready"`
+	preprocessors []router.Processor
+}
+
+// Setup adds injected pre-processors to preprocessors array
+func (h *AssetRenewUploadHandler) Setup() {
+	h.preprocessors = []router.Processor{
+		h.AccessKey,
+		h.DBConn,
+		h.PluginReady,
+	}
+}
+
+// GetPreprocessors returns all pre-processors for the handler
+func (h *AssetRenewUploadHandler) GetPreprocessors() []router.Processor {
+	return h.preprocessors
+}
+
+// Handle is the handling method of the renew upload request
+func (h *AssetRenewUploadHandler) Handle(
+	payload *router.Payload,
+	response *router.Response,
+) {
+	uploadURL, ok := payload.Data["url"].(string)
+	if !ok || !strings.HasPrefix(uploadURL, "/files/") {
+		response.Err = skyerr.NewInvalidArgument(
+			"Missing url or url is invalid",
+			[]string{"url"},
+		)
+		return
+	}
+
+	conn := payload.DBConn
+	upload, skyErr := getAssetUpload(conn, clean(strings.TrimPrefix(uploadURL, "/files/")))
+	if skyErr != nil {
+		response.Err = skyErr
+		return
+	}
+
+	uploader, ok := h.AssetStore.(skyAsset.FileMultipartUploader)
+	if !ok || upload.MultipartUploadID == "" {
+		response.Err = skyerr.NewError(
+			skyerr.NotSupported,
+			"Only multipart uploads can be renewed",
+		)
+		return
+	}
+
+	multipartRequest, err := uploader.RenewMultipartUploadRequest(
+		upload.Name, upload.MultipartUploadID, upload.Length,
+	)
+	if err != nil {
+		response.Err = skyerr.NewError(
+			skyerr.UnexpectedError,
+			"Fail to renew multipart upload request",
+		)
+		return
+	}
+
+	if err := conn.TouchAssetUpload(upload.ID); err == skydb.ErrAssetUploadNotFound {
+		response.Err = makeAssetUploadNotFoundError(upload.ID)
+		return
+	} else if err != nil {
+		response.Err = skyerr.MakeError(err)
+		return
+	}
+
+	multipartRequest.Action = "/files/" + assetUploadPath(upload.ID)
+	response.Result = map[string]interface{}{
+		"multipart-request": multipartRequest,
+	}
+}
+
+type assetTransformPayload struct {
+	Name      string                 `mapstructure:"name"`
+	Transform map[string]interface{} `mapstructure:"transform"`
+	Signature string                 `mapstructure:"signature"`
+	ExpiredAt int64                  `mapstructure:"expired_at"`
+}
+
+func (payload *assetTransformPayload) Decode(data map[string]interface{}) skyerr.Error {
+	if err := mapstructure.Decode(data, payload); err != nil {
+		return skyerr.NewError(skyerr.BadRequest, "fails to decode the request payload")
+	}
+	return payload.Validate()
+}
+
+func (payload *assetTransformPayload) Validate() skyerr.Error {
+	if payload.Name == "" {
+		return skyerr.NewInvalidArgument("empty asset name", []string{"name"})
+	}
+	if len(payload.Transform) == 0 {
+		return skyerr.NewInvalidArgument("empty transform", []string{"transform"})
+	}
+	return nil
+}
+
+// ImageTransform parses the transform of the payload
+func (payload *assetTransformPayload) ImageTransform() (*skyAsset.ImageTransform, skyerr.Error) {
+	values := url.Values{}
+	for key, value := range payload.Transform {
+		values.Set(key, fmt.Sprint(value))
+	}
+
+	transform, err := skyAsset.ParseImageTransform(values)
+	if err != nil {
+		return nil, makeImageTransformError(err)
+	}
+	if transform == nil {
+		return nil, skyerr.NewInvalidArgument("empty transform", []string{"transform"})
+	}
+	return transform, nil
+}
+
+// AssetTransformHandler returns a signed URL of an image asset transformed
+// on the fly. The transform is signed together with the asset name, so
+// it cannot be altered by the client. If record ACL is required by the
+// asset store, the URL is signed for the requesting user.
+//
+// If the asset store requires signatures, the requester has to hold a
+// valid signature of the asset URL, as in the `signature` and
+// `expired_at` of the query string, or be able to read a record
+// referencing the asset. Otherwise the transform could be used to
+// access an asset without a signed URL.
+//
+//  curl -X POST -H "Content-Type: application/json" \
+//    -d @- http://localhost:3000/ <<EOF
+//  {
+//      "action": "asset:transform",
+//      "api_key": "API_KEY",
+//      "name": "77a2d9a4-5d8b-4bc8-9d7a-1d6e1f9a3f0e-photo.jpg",
+//      "transform": {
+//          "width": 200,
+//          "height": 200,
+//          "fit": "cover",
+//          "format": "webp",
+//          "quality": 80
+//      },
+//      "signature": "SIGNATURE",
+//      "expired_at": 1500000000
+//  }
+//  EOF
+type AssetTransformHandler struct {
+	AssetStore    skyAsset.Store   `inject:"AssetStore"`
+	Authenticator router.Processor `preprocessor:"authenticator"`
+	DBConn        router.Processor `preprocessor:"dbconn"`
+	preprocessors []router.Processor
+}
+
+// Setup adds injected pre-processors to preprocessors array
+func (h *AssetTransformHandler) Setup() {
+	h.preprocessors = []router.Processor{
+		h.Authenticator,
+		h.DBConn,
+	}
+}
+
+// GetPreprocessors returns all pre-processors for the handler
+func (h *AssetTransformHandler) GetPreprocessors() []router.Processor {
+	return h.preprocessors
+}
+
+// Handle is the handling method of the asset transform request
+func (h *AssetTransformHandler) Handle(
+	payload *router.Payload,
+	response *router.Response,
+) {
+	p := assetTransformPayload{}
+	if skyErr := p.Decode(payload.Data); skyErr != nil {
+		response.Err = skyErr
+		return
+	}
+
+	transform, skyErr := p.ImageTransform()
+	if skyErr != nil {
+		response.Err = skyErr
+		return
+	}
+
+	signer, ok := h.AssetStore.(skyAsset.TransformURLSigner)
+	if !ok {
+		response.Err = skyerr.NewError(
+			skyerr.NotSupported,
+			"Image transform is not supported by the asset store",
+		)
+		return
+	}
+
+	asset := skydb.Asset{}
+	if err := payload.DBConn.GetAsset(p.Name, &asset); err != nil {
+		response.Err = skyerr.NewErrorWithInfo(
+			skyerr.ResourceNotFound,
+			fmt.Sprintf(`cannot find asset "%s"`, p.Name),
+			map[string]interface{}{"name": p.Name},
+		)
+		return
+	}
+
+	var signedURL string
+	var err error
+	if userSigner, ok := h.AssetStore.(skyAsset.UserURLSigner); ok && userSigner.IsRecordACLRequired() {
+		signedURL, err = userSigner.SignedURLForUser(asset.Name, transform, payload.AuthInfoID)
+	} else {
+		if skyErr := checkAssetSignatureOrRecordACL(
+			h.AssetStore,
+			payload,
+			asset.Name,
+			p.ExpiredAt,
+			p.Signature,
+		); skyErr != nil {
+			response.Err = skyErr
+			return
+		}
+		signedURL, err = signer.SignedTransformURL(asset.Name, *transform)
+	}
+	if err != nil {
+		response.Err = skyerr.NewError(skyerr.UnexpectedError, "Failed to sign the url")
+		return
+	}
+
+	response.Result = map[string]interface{}{
+		"name": asset.Name,
+		"url":  signedURL,
 	}
 }
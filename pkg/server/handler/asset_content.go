@@ -0,0 +1,290 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"io"
+
+	"github.com/mitchellh/mapstructure"
+	"github.com/sirupsen/logrus"
+
+	skyAsset "github.com/skygeario/skygear-server/pkg/server/asset"
+	"github.com/skygeario/skygear-server/pkg/server/logging"
+	"github.com/skygeario/skygear-server/pkg/server/recordutil"
+	"github.com/skygeario/skygear-server/pkg/server/router"
+	"github.com/skygeario/skygear-server/pkg/server/skydb"
+	"github.com/skygeario/skygear-server/pkg/server/skydb/skyconv"
+	"github.com/skygeario/skygear-server/pkg/server/skyerr"
+)
+
+// putAssetContent stores the file by the hash of its content in the
+// content-addressed asset store. The content is referenced before the
+// file is stored by the hash, such that it cannot be deleted by a
+// concurrent release of the same content once stored.
+func putAssetContent(
+	assetStore skyAsset.Store,
+	conn skydb.Conn,
+	src io.Reader,
+	length int64,
+	contentType string,
+	logger *logrus.Entry,
+) (string, skyerr.Error) {
+	store, ok := assetStore.(skyAsset.ContentAddressedStore)
+	if !ok {
+		return "", skyerr.NewError(
+			skyerr.NotSupported,
+			"Content addressing is not supported by the asset store",
+		)
+	}
+
+	referencedHash := ""
+	hash, err := store.PutContentAddressedFileReader(src, length, contentType, func(hash string) error {
+		content := skydb.AssetContent{
+			Hash:        hash,
+			ContentType: contentType,
+			Size:        length,
+		}
+		if err := conn.ReferenceAssetContent(&content); err != nil {
+			return err
+		}
+		referencedHash = hash
+		return nil
+	})
+	if err != nil {
+		if referencedHash != "" {
+			releaseAssetContent(assetStore, conn, referencedHash, logger)
+		}
+		return "", skyerr.MakeError(err)
+	}
+	return hash, nil
+}
+
+// saveContentAddressedAsset saves the asset referencing the stored
+// content, and releases the content the asset referenced previously.
+func saveContentAddressedAsset(
+	assetStore skyAsset.Store,
+	conn skydb.Conn,
+	asset *skydb.Asset,
+	logger *logrus.Entry,
+) skyerr.Error {
+	// the file may have been uploaded to the asset before
+	prevHash := ""
+	prevAsset := skydb.Asset{}
+	if err := conn.GetAsset(asset.Name, &prevAsset); err == nil {
+		prevHash = prevAsset.Hash
+	}
+
+	if err := conn.SaveAsset(asset); err != nil {
+		releaseAssetContent(assetStore, conn, asset.Hash, logger)
+		return skyerr.NewResourceSaveFailureErrWithStringID("asset", asset.Name)
+	}
+
+	if prevHash != "" {
+		releaseAssetContent(assetStore, conn, prevHash, logger)
+	}
+	return nil
+}
+
+// releaseAssetContent dereferences the stored content, which is deleted
+// from the asset store once it is no longer referenced by any asset. The
+// content is kept if it is referenced again before it is deleted.
+func releaseAssetContent(
+	assetStore skyAsset.Store,
+	conn skydb.Conn,
+	hash string,
+	logger *logrus.Entry,
+) {
+	content := skydb.AssetContent{}
+	if err := conn.DereferenceAssetContent(hash, &content); err != nil {
+		logger.WithError(err).Warnf("Failed to dereference asset content %s", hash)
+		return
+	}
+	if content.RefCount > 0 {
+		return
+	}
+
+	err := conn.DeleteAssetContent(hash, func() error {
+		return assetStore.Delete(skyAsset.ContentObjectName(hash))
+	})
+	if err != nil && err != skydb.ErrAssetContentNotFound {
+		logger.WithError(err).Errorf("Failed to delete asset content %s", hash)
+	}
+}
+
+type assetExistsPayload struct {
+	Hash       string `mapstructure:"hash"`
+	Filename   string `mapstructure:"filename"`
+	RecordType string `mapstructure:"record-type"`
+	Field      string `mapstructure:"field"`
+}
+
+func (payload *assetExistsPayload) Decode(data map[string]interface{}) skyerr.Error {
+	if err := mapstructure.Decode(data, payload); err != nil {
+		return skyerr.NewError(skyerr.BadRequest, "fails to decode the request payload")
+	}
+	return payload.Validate()
+}
+
+func (payload *assetExistsPayload) Validate() skyerr.Error {
+	if !skyAsset.IsValidContentHash(payload.Hash) {
+		return skyerr.NewInvalidArgument(
+			"hash must be a hex-encoded SHA-256 hash in lower case",
+			[]string{"hash"},
+		)
+	}
+	if payload.Filename == "" {
+		return skyerr.NewInvalidArgument(
+			"Missing filename or filename is invalid",
+			[]string{"filename"},
+		)
+	}
+	return nil
+}
+
+// AssetExistsHandler checks whether a file of the SHA-256 hash is stored
+// in the content-addressed asset store already, such that it need not be
+// uploaded again. If so, an asset referencing the stored file is created
+// and returned, which can be saved to records like an uploaded asset.
+//
+// The asset is rejected if the stored file violates the upload policy. If
+// record-type and field are given, the policy of the record field the
+// asset is to be saved to is also checked.
+//
+// If asset scanning is enabled, the asset is pending until scanned like an
+// uploaded asset, see AssetScanHandler.
+//
+// As knowing the hash of a file is no proof of possessing the file, the
+// handler is not supported if record ACL is required by the asset store,
+// unless the master key is used. Otherwise the file would be accessible
+// without reading any record referencing it.
+//
+//  curl -X POST -H "Content-Type: application/json" \
+//    -d @- http://localhost:3000/ <<EOF
+//  {
+//      "action": "asset:exists",
+//      "api_key": "API_KEY",
+//      "hash": "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824",
+//      "filename": "hello.txt"
+//  }
+//  EOF
+type AssetExistsHandler struct {
+	AssetStore            skyAsset.Store         `inject:"AssetStore"`
+	AssetUploadPolicy     *skyAsset.UploadPolicy `inject:"AssetUploadPolicy"`
+	AssetContentAddressed bool                   `inject:"AssetContentAddressed"`
+	AssetScanEnabled      bool                   `inject:"AssetScanEnabled"`
+	AccessKey             router.Processor       `preprocessor:"accesskey"`
+	DBConn                router.Processor       `preprocessor:"dbconn"`
+	PluginReady           router.Processor       `preprocessor:"plugin_ready"`
+	preprocessors         []router.Processor
+}
+
+// Setup adds injected pre-processors to preprocessors array
+func (h *AssetExistsHandler) Setup() {
+	h.preprocessors = []router.Processor{
+		h.AccessKey,
+		h.DBConn,
+		h.PluginReady,
+	}
+}
+
+// GetPreprocessors returns all pre-processors for the handler
+func (h *AssetExistsHandler) GetPreprocessors() []router.Processor {
+	return h.preprocessors
+}
+
+// Handle is the handling method of the asset exists request
+func (h *AssetExistsHandler) Handle(
+	payload *router.Payload,
+	response *router.Response,
+) {
+	logger := logging.CreateLogger(payload.Context(), "handler")
+	if !h.AssetContentAddressed {
+		response.Err = skyerr.NewError(
+			skyerr.NotSupported,
+			"Asset store is not content-addressed",
+		)
+		return
+	}
+
+	if userSigner, ok := h.AssetStore.(skyAsset.UserURLSigner); ok &&
+		userSigner.IsRecordACLRequired() && !payload.HasMasterKey() {
+		response.Err = skyerr.NewError(
+			skyerr.NotSupported,
+			"Checking stored content is not supported with record ACL",
+		)
+		return
+	}
+
+	p := assetExistsPayload{}
+	if skyErr := p.Decode(payload.Data); skyErr != nil {
+		response.Err = skyErr
+		return
+	}
+
+	conn := payload.DBConn
+	content := skydb.AssetContent{}
+	if err := conn.ReferenceExistingAssetContent(p.Hash, &content); err == skydb.ErrAssetContentNotFound {
+		response.Result = map[string]interface{}{
+			"exists": false,
+		}
+		return
+	} else if err != nil {
+		response.Err = skyerr.MakeError(err)
+		return
+	}
+
+	var policyErr error
+	if p.RecordType != "" && p.Field != "" {
+		policyErr = h.AssetUploadPolicy.ValidateField(p.RecordType, p.Field, content.ContentType, content.Size)
+	} else {
+		policyErr = h.AssetUploadPolicy.Validate(content.ContentType, content.Size)
+	}
+	if policyErr != nil {
+		releaseAssetContent(h.AssetStore, conn, p.Hash, logger)
+		response.Err = recordutil.MakeUploadPolicyError(policyErr)
+		return
+	}
+
+	asset := skydb.Asset{
+		Name:        makeUniqueAssetName(p.Filename),
+		ContentType: content.ContentType,
+		Size:        content.Size,
+		Hash:        content.Hash,
+		Status:      uploadedAssetStatus(h.AssetScanEnabled),
+	}
+	extractStoredAssetMetadata(h.AssetStore, &asset, logger)
+	if skyErr := saveContentAddressedAsset(h.AssetStore, conn, &asset, logger); skyErr != nil {
+		response.Err = skyErr
+		return
+	}
+	if h.AssetScanEnabled {
+		if skyErr := scheduleAssetScan(conn, asset.Name, timeNow(), logger); skyErr != nil {
+			response.Err = skyErr
+			return
+		}
+	}
+
+	if signer, ok := h.AssetStore.(skyAsset.URLSigner); ok {
+		asset.Signer = signer
+	} else {
+		logger.Warnf("Failed to acquire asset URLSigner, please check configuration")
+		response.Err = skyerr.NewError(skyerr.UnexpectedError, "Failed to sign the url")
+		return
+	}
+	response.Result = map[string]interface{}{
+		"exists": true,
+		"asset":  skyconv.ToMap((*skyconv.MapAsset)(&asset)),
+	}
+}
@@ -0,0 +1,278 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/skygeario/skygear-server/pkg/server/asset"
+	"github.com/skygeario/skygear-server/pkg/server/handler/handlertest"
+	"github.com/skygeario/skygear-server/pkg/server/logging"
+	"github.com/skygeario/skygear-server/pkg/server/router"
+	"github.com/skygeario/skygear-server/pkg/server/skydb"
+	"github.com/skygeario/skygear-server/pkg/server/skydb/skydbtest"
+	. "github.com/skygeario/skygear-server/pkg/server/skytest"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// helloHash is the SHA-256 hash of "hello"
+const helloHash = "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824"
+
+func TestAssetExistsHandler(t *testing.T) {
+	Convey("AssetExistsHandler", t, func() {
+		realUUIDNew := uuidNew
+		uuidNew = func() string { return "uuid" }
+		defer func() {
+			uuidNew = realUUIDNew
+		}()
+
+		conn := skydbtest.NewMapConn()
+		store := asset.NewFileStore("data/asset", "http://skygear.test/files", "secret", true)
+		handler := &AssetExistsHandler{
+			AssetStore:            store,
+			AssetContentAddressed: true,
+		}
+		r := handlertest.NewSingleRouteRouter(handler, func(p *router.Payload) {
+			p.DBConn = conn
+		})
+
+		conn.AssetContentMap[helloHash] = skydb.AssetContent{
+			Hash:        helloHash,
+			ContentType: "text/plain",
+			Size:        5,
+			RefCount:    1,
+		}
+
+		Convey("creates asset referencing stored content", func() {
+			resp := r.POST(`{
+				"hash": "` + helloHash + `",
+				"filename": "hello.txt"
+			}`)
+			So(resp.Body.Bytes(), ShouldEqualJSON, `{
+				"result": {
+					"exists": true,
+					"asset": {
+						"$type": "asset",
+						"$name": "uuid-hello.txt",
+						"$url": "http://skygear.test/files/uuid-hello.txt",
+						"$content_type": "text/plain"
+					}
+				}
+			}`)
+
+			So(conn.AssetMap["uuid-hello.txt"], ShouldResemble, skydb.Asset{
+				Name:        "uuid-hello.txt",
+				ContentType: "text/plain",
+				Size:        5,
+				Hash:        helloHash,
+			})
+			So(conn.AssetContentMap[helloHash].RefCount, ShouldEqual, 2)
+		})
+
+		Convey("returns not exists for content not stored", func() {
+			resp := r.POST(`{
+				"hash": "` + strings.Repeat("0", 64) + `",
+				"filename": "hello.txt"
+			}`)
+			So(resp.Body.Bytes(), ShouldEqualJSON, `{
+				"result": {
+					"exists": false
+				}
+			}`)
+			So(conn.AssetMap, ShouldBeEmpty)
+		})
+
+		Convey("rejects stored content violating upload policy", func() {
+			handler.AssetUploadPolicy = &asset.UploadPolicy{
+				FieldUploadPolicy: asset.FieldUploadPolicy{
+					ContentTypes: []string{"image/*"},
+				},
+			}
+
+			resp := r.POST(`{
+				"hash": "` + helloHash + `",
+				"filename": "hello.txt"
+			}`)
+			So(resp.Code, ShouldEqual, 400)
+			So(conn.AssetMap, ShouldBeEmpty)
+			So(conn.AssetContentMap[helloHash].RefCount, ShouldEqual, 1)
+		})
+
+		Convey("rejects invalid hash", func() {
+			resp := r.POST(`{
+				"hash": "hello",
+				"filename": "hello.txt"
+			}`)
+			So(resp.Body.Bytes(), ShouldEqualJSON, `{
+				"error": {
+					"code": 108,
+					"name": "InvalidArgument",
+					"message": "hash must be a hex-encoded SHA-256 hash in lower case",
+					"info": {
+						"arguments": ["hash"]
+					}
+				}
+			}`)
+		})
+
+		Convey("errors if asset store is not content-addressed", func() {
+			handler.AssetContentAddressed = false
+
+			resp := r.POST(`{
+				"hash": "` + helloHash + `",
+				"filename": "hello.txt"
+			}`)
+			So(resp.Body.Bytes(), ShouldEqualJSON, `{
+				"error": {
+					"code": 111,
+					"name": "NotSupported",
+					"message": "Asset store is not content-addressed"
+				}
+			}`)
+		})
+
+		Convey("errors if record ACL is required", func() {
+			handler.AssetStore = asset.NewRecordACLFileStore("data/asset", "http://skygear.test/files", "secret")
+
+			resp := r.POST(`{
+				"hash": "` + helloHash + `",
+				"filename": "hello.txt"
+			}`)
+			So(resp.Body.Bytes(), ShouldEqualJSON, `{
+				"error": {
+					"code": 111,
+					"name": "NotSupported",
+					"message": "Checking stored content is not supported with record ACL"
+				}
+			}`)
+			So(conn.AssetContentMap[helloHash].RefCount, ShouldEqual, 1)
+			So(conn.AssetMap, ShouldBeEmpty)
+		})
+	})
+}
+
+func TestUploadFileHandlerContentAddressed(t *testing.T) {
+	Convey("UploadFileHandler with content-addressed asset store", t, func() {
+		dir, err := ioutil.TempDir("", "skygear-asset")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+		store := asset.NewFileStore(dir, "http://skygear.test/files", "secret", true)
+
+		conn := skydbtest.NewMapConn()
+		r := newmodGateway("(.+)")
+		r.Handle("PUT", &UploadFileHandler{
+			AssetStore:            store,
+			AssetContentAddressed: true,
+		}, func(p *router.Payload) {
+			p.DBConn = conn
+		})
+
+		upload := func(name string, body string) {
+			if _, ok := conn.AssetMap[name]; !ok {
+				conn.AssetMap[name] = skydb.Asset{
+					Name:        name,
+					ContentType: "text/plain",
+				}
+			}
+			req, _ := http.NewRequest("PUT", "http://skygear.test/"+name, strings.NewReader(body))
+			req.Header.Set("Content-Type", "text/plain")
+			resp := r.Do(req)
+			So(resp.Code, ShouldEqual, 200)
+		}
+
+		Convey("stores identical files once", func() {
+			upload("uuid1-hello.txt", "hello")
+			upload("uuid2-hello.txt", "hello")
+
+			So(conn.AssetMap["uuid1-hello.txt"].Hash, ShouldEqual, helloHash)
+			So(conn.AssetMap["uuid2-hello.txt"].Hash, ShouldEqual, helloHash)
+			So(conn.AssetContentMap[helloHash].RefCount, ShouldEqual, 2)
+
+			data, err := ioutil.ReadFile(filepath.Join(dir, asset.ContentObjectName(helloHash)))
+			So(err, ShouldBeNil)
+			So(string(data), ShouldEqual, "hello")
+			_, err = os.Stat(filepath.Join(dir, "uuid1-hello.txt"))
+			So(os.IsNotExist(err), ShouldBeTrue)
+		})
+
+		Convey("releases content replaced by another upload", func() {
+			upload("uuid1-hello.txt", "hello")
+			upload("uuid1-hello.txt", "world")
+
+			So(conn.AssetMap["uuid1-hello.txt"].Hash, ShouldNotEqual, helloHash)
+			So(conn.AssetContentMap, ShouldNotContainKey, helloHash)
+			So(conn.AssetContentMap, ShouldHaveLength, 1)
+
+			_, err := os.Stat(filepath.Join(dir, asset.ContentObjectName(helloHash)))
+			So(os.IsNotExist(err), ShouldBeTrue)
+		})
+	})
+}
+
+func TestPutAndReleaseAssetContent(t *testing.T) {
+	Convey("putAssetContent and releaseAssetContent", t, func() {
+		dir, err := ioutil.TempDir("", "skygear-asset")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+		store := asset.NewFileStore(dir, "http://skygear.test/files", "secret", true)
+		conn := skydbtest.NewMapConn()
+		logger := logging.LoggerEntry("handler")
+		contentPath := filepath.Join(dir, asset.ContentObjectName(helloHash))
+
+		put := func() {
+			hash, skyErr := putAssetContent(store, conn, strings.NewReader("hello"), 5, "text/plain", logger)
+			So(skyErr, ShouldBeNil)
+			So(hash, ShouldEqual, helloHash)
+		}
+
+		Convey("deletes content no longer referenced", func() {
+			put()
+			releaseAssetContent(store, conn, helloHash, logger)
+
+			So(conn.AssetContentMap, ShouldBeEmpty)
+			_, err := os.Stat(contentPath)
+			So(os.IsNotExist(err), ShouldBeTrue)
+		})
+
+		Convey("keeps content referenced again", func() {
+			put()
+			put()
+			releaseAssetContent(store, conn, helloHash, logger)
+
+			So(conn.AssetContentMap[helloHash].RefCount, ShouldEqual, 1)
+			_, err := os.Stat(contentPath)
+			So(err, ShouldBeNil)
+		})
+
+		Convey("stores content released but not yet deleted again", func() {
+			conn.AssetContentMap[helloHash] = skydb.AssetContent{
+				Hash:        helloHash,
+				ContentType: "text/plain",
+				Size:        5,
+			}
+			put()
+
+			So(conn.AssetContentMap[helloHash].RefCount, ShouldEqual, 1)
+			data, err := ioutil.ReadFile(contentPath)
+			So(err, ShouldBeNil)
+			So(string(data), ShouldEqual, "hello")
+		})
+	})
+}
@@ -0,0 +1,233 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"sort"
+	"time"
+
+	"github.com/mitchellh/mapstructure"
+	"github.com/sirupsen/logrus"
+
+	skyAsset "github.com/skygeario/skygear-server/pkg/server/asset"
+	"github.com/skygeario/skygear-server/pkg/server/logging"
+	"github.com/skygeario/skygear-server/pkg/server/router"
+	"github.com/skygeario/skygear-server/pkg/server/skydb"
+	"github.com/skygeario/skygear-server/pkg/server/skyerr"
+)
+
+// AssetGCAction is the action name of AssetGCHandler, which is also the
+// name of the job scheduled periodically to delete orphaned assets.
+const AssetGCAction = "asset:gc"
+
+const defaultAssetGCGracePeriod = 86400
+const defaultAssetGCLimit = 1000
+
+type assetGCPayload struct {
+	GracePeriod *int `mapstructure:"grace_period"`
+	Limit       int  `mapstructure:"limit"`
+	DryRun      bool `mapstructure:"dry_run"`
+}
+
+func (payload *assetGCPayload) Decode(data map[string]interface{}) skyerr.Error {
+	// the payload is in args when the action is executed as a job
+	if args, ok := data["args"].(map[string]interface{}); ok {
+		data = args
+	}
+	if err := mapstructure.Decode(data, payload); err != nil {
+		return skyerr.NewError(skyerr.BadRequest, "fails to decode the request payload")
+	}
+	if payload.GracePeriod == nil {
+		gracePeriod := defaultAssetGCGracePeriod
+		payload.GracePeriod = &gracePeriod
+	}
+	if payload.Limit == 0 {
+		payload.Limit = defaultAssetGCLimit
+	}
+	return payload.Validate()
+}
+
+func (payload *assetGCPayload) Validate() skyerr.Error {
+	if *payload.GracePeriod < 0 {
+		return skyerr.NewInvalidArgument("grace period cannot be negative", []string{"grace_period"})
+	}
+	if payload.Limit < 0 {
+		return skyerr.NewInvalidArgument("limit cannot be negative", []string{"limit"})
+	}
+	return nil
+}
+
+// AssetGCHandler deletes assets not referenced by any asset fields of
+// records. Assets created within the grace period (in seconds, default to
+// one day) are kept, because they may have been uploaded but not yet saved
+// to a record.
+//
+// Both the asset information and the file in the asset store are deleted.
+// A file stored by the hash of its content is only deleted when it is no
+// longer referenced by any asset.
+//
+// Resumable uploads abandoned for a week are also deleted, together with
+// the uploaded chunks or the multipart upload to the asset store.
+//
+// At most limit assets and limit uploads are deleted in a request, the
+// remaining ones are deleted in subsequent requests. With dry_run, the
+// orphaned assets and the IDs of abandoned uploads are returned without
+// being deleted.
+//
+//  curl -X POST -H "Content-Type: application/json" \
+//    -d @- http://localhost:3000/ <<EOF
+//  {
+//      "action": "asset:gc",
+//      "api_key": "MASTER_KEY",
+//      "grace_period": 86400,
+//      "dry_run": true
+//  }
+//  EOF
+type AssetGCHandler struct {
+	AssetStore       skyAsset.Store   `inject:"AssetStore"`
+	AccessKey        router.Processor `preprocessor:"accesskey"`
+	RequireMasterKey router.Processor `preprocessor:"require_master_key"`
+	DBConn           router.Processor `preprocessor:"dbconn"`
+	preprocessors    []router.Processor
+}
+
+// Setup adds injected pre-processors to preprocessors array
+func (h *AssetGCHandler) Setup() {
+	h.preprocessors = []router.Processor{
+		h.AccessKey,
+		h.RequireMasterKey,
+		h.DBConn,
+	}
+}
+
+// GetPreprocessors returns all pre-processors for the handler
+func (h *AssetGCHandler) GetPreprocessors() []router.Processor {
+	return h.preprocessors
+}
+
+// Handle is the handling method of the asset gc request
+func (h *AssetGCHandler) Handle(payload *router.Payload, response *router.Response) {
+	logger := logging.CreateLogger(payload.Context(), "handler")
+
+	p := assetGCPayload{}
+	if skyErr := p.Decode(payload.Data); skyErr != nil {
+		response.Err = skyErr
+		return
+	}
+
+	conn := payload.DBConn
+	assetColumns, err := queryAssetColumns(conn.PublicDB())
+	if err != nil {
+		response.Err = skyerr.MakeError(err)
+		return
+	}
+
+	createdBefore := timeNow().Add(-time.Duration(*p.GracePeriod) * time.Second)
+	assets, err := conn.QueryOrphanedAssets(assetColumns, createdBefore, p.Limit)
+	if err != nil {
+		response.Err = skyerr.MakeError(err)
+		return
+	}
+
+	names := []string{}
+	for _, asset := range assets {
+		if p.DryRun {
+			names = append(names, asset.Name)
+			continue
+		}
+
+		// the asset information is deleted first, which fails if the
+		// asset is referenced by a record saved after the query
+		if deleteErr := conn.DeleteAsset(asset.Name); deleteErr != nil {
+			logger.WithError(deleteErr).Warnf("Failed to delete orphaned asset %s", asset.Name)
+			continue
+		}
+		if asset.Hash != "" {
+			releaseAssetContent(h.AssetStore, conn, asset.Hash, logger)
+		} else if deleteErr := h.AssetStore.Delete(asset.Name); deleteErr != nil {
+			logger.WithError(deleteErr).Errorf("Failed to delete file of orphaned asset %s", asset.Name)
+		}
+		names = append(names, asset.Name)
+	}
+
+	uploadIDs, skyErr := h.deleteExpiredUploads(conn, p.Limit, p.DryRun, logger)
+	if skyErr != nil {
+		response.Err = skyErr
+		return
+	}
+
+	if !p.DryRun {
+		logger.Infof("Deleted %d orphaned assets and %d abandoned uploads", len(names), len(uploadIDs))
+	}
+	response.Result = map[string]interface{}{
+		"assets":  names,
+		"uploads": uploadIDs,
+		"dry_run": p.DryRun,
+	}
+}
+
+// deleteExpiredUploads deletes the resumable uploads not updated within
+// assetUploadExpiry, and returns their IDs
+func (h *AssetGCHandler) deleteExpiredUploads(
+	conn skydb.Conn,
+	limit int,
+	dryRun bool,
+	logger *logrus.Entry,
+) ([]string, skyerr.Error) {
+	uploads, err := conn.QueryExpiredAssetUploads(timeNow().Add(-assetUploadExpiry), limit)
+	if err != nil {
+		return nil, skyerr.MakeError(err)
+	}
+
+	ids := []string{}
+	for i := range uploads {
+		upload := &uploads[i]
+		if dryRun {
+			ids = append(ids, upload.ID)
+			continue
+		}
+
+		if deleteErr := conn.DeleteAssetUpload(upload.ID); deleteErr != nil {
+			logger.WithError(deleteErr).Warnf("Failed to delete abandoned upload %s", upload.ID)
+			continue
+		}
+		discardAssetUpload(h.AssetStore, upload, logger)
+		ids = append(ids, upload.ID)
+	}
+	return ids, nil
+}
+
+// queryAssetColumns returns the asset columns of all record types
+func queryAssetColumns(db skydb.Database) (map[string][]string, error) {
+	schemas, err := db.GetRecordSchemas()
+	if err != nil {
+		return nil, err
+	}
+
+	assetColumns := map[string][]string{}
+	for recordType, schema := range schemas {
+		columns := []string{}
+		for column, fieldType := range schema {
+			if fieldType.Type == skydb.TypeAsset {
+				columns = append(columns, column)
+			}
+		}
+		if len(columns) > 0 {
+			sort.Strings(columns)
+			assetColumns[recordType] = columns
+		}
+	}
+	return assetColumns, nil
+}
@@ -0,0 +1,231 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/skygeario/skygear-server/pkg/server/asset"
+	"github.com/skygeario/skygear-server/pkg/server/handler/handlertest"
+	"github.com/skygeario/skygear-server/pkg/server/router"
+	"github.com/skygeario/skygear-server/pkg/server/skydb"
+	"github.com/skygeario/skygear-server/pkg/server/skydb/skydbtest"
+	. "github.com/skygeario/skygear-server/pkg/server/skytest"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// orphanedAssetConn returns assets in AssetMap which are not referenced
+// as orphaned assets
+type orphanedAssetConn struct {
+	*skydbtest.MapConn
+	referenced    map[string]bool
+	assetColumns  map[string][]string
+	createdBefore time.Time
+	limit         int
+}
+
+func (c *orphanedAssetConn) QueryOrphanedAssets(assetColumns map[string][]string, createdBefore time.Time, limit int) ([]skydb.Asset, error) {
+	c.assetColumns = assetColumns
+	c.createdBefore = createdBefore
+	c.limit = limit
+
+	assets := []skydb.Asset{}
+	for name, a := range c.AssetMap {
+		if !c.referenced[name] {
+			assets = append(assets, a)
+		}
+	}
+	return assets, nil
+}
+
+func TestAssetGCHandler(t *testing.T) {
+	Convey("AssetGCHandler", t, func() {
+		realTimeNow := timeNow
+		timeNow = func() time.Time { return time.Date(2017, 7, 1, 0, 0, 0, 0, time.UTC) }
+		defer func() {
+			timeNow = realTimeNow
+		}()
+
+		dir, err := ioutil.TempDir("", "skygear-asset")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+		store := asset.NewFileStore(dir, "http://skygear.test/files", "secret", false)
+
+		db := skydbtest.NewMapDB()
+		db.RecordSchemaMap["note"] = skydb.RecordSchema{
+			"title":      skydb.FieldType{Type: skydb.TypeString},
+			"image":      skydb.FieldType{Type: skydb.TypeAsset},
+			"attachment": skydb.FieldType{Type: skydb.TypeAsset},
+		}
+		db.RecordSchemaMap["comment"] = skydb.RecordSchema{
+			"content": skydb.FieldType{Type: skydb.TypeString},
+		}
+
+		conn := &orphanedAssetConn{
+			MapConn:    skydbtest.NewMapConn(),
+			referenced: map[string]bool{"used.png": true},
+		}
+		conn.InternalPublicDB = db
+		for _, name := range []string{"used.png", "orphan.png"} {
+			conn.AssetMap[name] = skydb.Asset{Name: name, ContentType: "image/png", Size: 5}
+			So(store.PutFileReader(name, strings.NewReader("image"), 5, "image/png"), ShouldBeNil)
+		}
+		transformedPath := filepath.Join(dir, asset.TransformedAssetPrefix, "orphan.png", "thumbnail.png")
+		So(os.MkdirAll(filepath.Dir(transformedPath), 0755), ShouldBeNil)
+		So(ioutil.WriteFile(transformedPath, []byte("image"), 0644), ShouldBeNil)
+
+		r := handlertest.NewSingleRouteRouter(&AssetGCHandler{
+			AssetStore: store,
+		}, func(p *router.Payload) {
+			p.DBConn = conn
+		})
+
+		Convey("deletes orphaned assets", func() {
+			resp := r.POST(`{}`)
+			So(resp.Body.Bytes(), ShouldEqualJSON, `{
+				"result": {
+					"assets": ["orphan.png"],
+					"uploads": [],
+					"dry_run": false
+				}
+			}`)
+
+			So(conn.assetColumns, ShouldResemble, map[string][]string{
+				"note": []string{"attachment", "image"},
+			})
+			So(conn.createdBefore, ShouldResemble, time.Date(2017, 6, 30, 0, 0, 0, 0, time.UTC))
+			So(conn.limit, ShouldEqual, 1000)
+
+			So(conn.AssetMap, ShouldContainKey, "used.png")
+			So(conn.AssetMap, ShouldNotContainKey, "orphan.png")
+
+			_, statErr := os.Stat(filepath.Join(dir, "used.png"))
+			So(statErr, ShouldBeNil)
+			_, statErr = os.Stat(filepath.Join(dir, "orphan.png"))
+			So(os.IsNotExist(statErr), ShouldBeTrue)
+			_, statErr = os.Stat(transformedPath)
+			So(os.IsNotExist(statErr), ShouldBeTrue)
+		})
+
+		Convey("returns orphaned assets in dry run", func() {
+			resp := r.POST(`{"dry_run": true, "grace_period": 3600, "limit": 10}`)
+			So(resp.Body.Bytes(), ShouldEqualJSON, `{
+				"result": {
+					"assets": ["orphan.png"],
+					"uploads": [],
+					"dry_run": true
+				}
+			}`)
+
+			So(conn.createdBefore, ShouldResemble, time.Date(2017, 6, 30, 23, 0, 0, 0, time.UTC))
+			So(conn.limit, ShouldEqual, 10)
+			So(conn.AssetMap, ShouldContainKey, "orphan.png")
+			_, statErr := os.Stat(filepath.Join(dir, "orphan.png"))
+			So(statErr, ShouldBeNil)
+		})
+
+		Convey("reads args when executed as job", func() {
+			resp := r.POST(`{"args": {"grace_period": 0}}`)
+			So(resp.Code, ShouldEqual, 200)
+			So(conn.createdBefore, ShouldResemble, time.Date(2017, 7, 1, 0, 0, 0, 0, time.UTC))
+			So(conn.AssetMap, ShouldNotContainKey, "orphan.png")
+		})
+
+		Convey("deletes content of orphaned assets no longer referenced", func() {
+			hash, putErr := store.(asset.ContentAddressedStore).PutContentAddressedFileReader(
+				strings.NewReader("image"), 5, "image/png", func(string) error { return nil },
+			)
+			So(putErr, ShouldBeNil)
+			for _, name := range []string{"used.png", "orphan.png"} {
+				conn.AssetMap[name] = skydb.Asset{Name: name, ContentType: "image/png", Size: 5, Hash: hash}
+			}
+			conn.AssetContentMap[hash] = skydb.AssetContent{Hash: hash, RefCount: 2}
+			contentPath := filepath.Join(dir, asset.ContentObjectName(hash))
+
+			resp := r.POST(`{}`)
+			So(resp.Code, ShouldEqual, 200)
+			So(conn.AssetMap, ShouldNotContainKey, "orphan.png")
+			So(conn.AssetContentMap[hash].RefCount, ShouldEqual, 1)
+			_, statErr := os.Stat(contentPath)
+			So(statErr, ShouldBeNil)
+
+			conn.referenced = map[string]bool{}
+			resp = r.POST(`{}`)
+			So(resp.Code, ShouldEqual, 200)
+			So(conn.AssetMap, ShouldBeEmpty)
+			So(conn.AssetContentMap, ShouldBeEmpty)
+			_, statErr = os.Stat(contentPath)
+			So(os.IsNotExist(statErr), ShouldBeTrue)
+		})
+
+		Convey("deletes abandoned uploads", func() {
+			chunk := "_uploads/abandoned/0"
+			So(store.PutFileReader(chunk, strings.NewReader("chunk"), 5, "video/mp4"), ShouldBeNil)
+			conn.AssetUploadMap["abandoned"] = skydb.AssetUpload{
+				ID:        "abandoned",
+				Name:      "video.mp4",
+				Chunks:    []string{chunk},
+				UpdatedAt: time.Date(2017, 6, 23, 0, 0, 0, 0, time.UTC),
+			}
+			conn.AssetUploadMap["active"] = skydb.AssetUpload{
+				ID:        "active",
+				Name:      "movie.mp4",
+				UpdatedAt: time.Date(2017, 6, 25, 0, 0, 0, 0, time.UTC),
+			}
+
+			resp := r.POST(`{"dry_run": true}`)
+			So(resp.Body.Bytes(), ShouldEqualJSON, `{
+				"result": {
+					"assets": ["orphan.png"],
+					"uploads": ["abandoned"],
+					"dry_run": true
+				}
+			}`)
+			So(conn.AssetUploadMap, ShouldContainKey, "abandoned")
+
+			resp = r.POST(`{}`)
+			So(resp.Body.Bytes(), ShouldEqualJSON, `{
+				"result": {
+					"assets": ["orphan.png"],
+					"uploads": ["abandoned"],
+					"dry_run": false
+				}
+			}`)
+			So(conn.AssetUploadMap, ShouldNotContainKey, "abandoned")
+			So(conn.AssetUploadMap, ShouldContainKey, "active")
+			_, statErr := os.Stat(filepath.Join(dir, chunk))
+			So(os.IsNotExist(statErr), ShouldBeTrue)
+		})
+
+		Convey("errors on negative grace period", func() {
+			resp := r.POST(`{"grace_period": -1}`)
+			So(resp.Body.Bytes(), ShouldEqualJSON, `{
+				"error": {
+					"code": 108,
+					"name": "InvalidArgument",
+					"message": "grace period cannot be negative",
+					"info": {
+						"arguments": ["grace_period"]
+					}
+				}
+			}`)
+		})
+	})
+}
@@ -0,0 +1,130 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"io"
+	"os"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+
+	skyAsset "github.com/skygeario/skygear-server/pkg/server/asset"
+	"github.com/skygeario/skygear-server/pkg/server/recordutil"
+	"github.com/skygeario/skygear-server/pkg/server/skydb"
+	"github.com/skygeario/skygear-server/pkg/server/skyerr"
+)
+
+// extractAssetMetadata extracts the metadata of the asset from its
+// content. The asset is saved without metadata if it cannot be extracted,
+// which does not fail the upload.
+func extractAssetMetadata(src io.ReaderAt, asset *skydb.Asset, logger *logrus.Entry) {
+	metadata, err := skyAsset.ExtractMetadata(src, asset.Size)
+	if err != nil {
+		logger.WithError(err).Warnf("Failed to extract metadata of asset %s", asset.Name)
+	}
+	asset.Metadata = metadata
+}
+
+// extractStoredAssetMetadata extracts the metadata of the asset from its
+// stored content. Stores supporting ranged reads are read only at where
+// the metadata is, otherwise the content is downloaded to a temp file.
+func extractStoredAssetMetadata(
+	assetStore skyAsset.Store,
+	asset *skydb.Asset,
+	logger *logrus.Entry,
+) {
+	if getter, ok := assetStore.(skyAsset.FileRangedGetter); ok {
+		extractAssetMetadata(skyAsset.NewFileReaderAt(getter, asset.ObjectName()), asset, logger)
+		return
+	}
+
+	asset.Metadata = nil
+	reader, err := assetStore.GetFileReader(asset.ObjectName())
+	if err != nil {
+		logger.WithError(err).Warnf("Failed to get asset %s for extracting metadata", asset.Name)
+		return
+	}
+	_, tempFile, err := copyToTempFile(reader)
+	reader.Close()
+	if err != nil {
+		logger.WithError(err).Warnf("Failed to get asset %s for extracting metadata", asset.Name)
+		return
+	}
+	defer func() {
+		tempFile.Close()
+		os.Remove(tempFile.Name())
+	}()
+	extractAssetMetadata(tempFile, asset, logger)
+}
+
+// stripUploadedEXIF strips the metadata of an image uploaded directly to
+// the asset store, which is stored again if any metadata is stripped.
+// Images uploaded through the server are stripped before they are stored,
+// see skyAsset.StripEXIF.
+//
+// The uploaded file is deleted if it cannot be stripped, so that the
+// metadata is not left accessible. Only images are downloaded to be
+// stripped.
+func stripUploadedEXIF(
+	assetStore skyAsset.Store,
+	stripping skyAsset.EXIFStripping,
+	asset *skydb.Asset,
+	logger *logrus.Entry,
+) skyerr.Error {
+	if stripping == skyAsset.EXIFStripNone || !strings.HasPrefix(asset.ContentType, "image/") {
+		return nil
+	}
+
+	if err := storeStrippedFile(assetStore, stripping, asset); err != nil {
+		logger.WithError(err).Errorf("Failed to strip EXIF of asset %s", asset.Name)
+		if deleteErr := assetStore.Delete(asset.Name); deleteErr != nil {
+			logger.WithError(deleteErr).Warnf("Failed to delete unstripped asset %s", asset.Name)
+		}
+		if _, ok := err.(skyAsset.UploadPolicyError); ok {
+			return recordutil.MakeUploadPolicyError(err)
+		}
+		return skyerr.NewError(skyerr.UnexpectedError, "Failed to strip EXIF of asset")
+	}
+	return nil
+}
+
+// storeStrippedFile strips the stored file of the asset, which is
+// downloaded to a temp file before being stored again
+func storeStrippedFile(
+	assetStore skyAsset.Store,
+	stripping skyAsset.EXIFStripping,
+	asset *skydb.Asset,
+) error {
+	reader, err := assetStore.GetFileReader(asset.Name)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	src, stripped, err := skyAsset.StripEXIF(reader, stripping)
+	if err != nil || !stripped {
+		return err
+	}
+	written, tempFile, err := copyToTempFile(src)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		tempFile.Close()
+		os.Remove(tempFile.Name())
+	}()
+	return assetStore.PutFileReader(asset.Name, tempFile, written, asset.ContentType)
+}
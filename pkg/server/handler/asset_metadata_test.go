@@ -0,0 +1,220 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/jpeg"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/skygeario/skygear-server/pkg/server/asset"
+	"github.com/skygeario/skygear-server/pkg/server/logging"
+	"github.com/skygeario/skygear-server/pkg/server/router"
+	"github.com/skygeario/skygear-server/pkg/server/skydb"
+	. "github.com/skygeario/skygear-server/pkg/server/skytest"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// encodeTestGPSJPEG encodes a JPEG image with the GPS location of latitude
+// 22.5 in its EXIF metadata
+func encodeTestGPSJPEG(width int, height int) []byte {
+	tiff := []byte{
+		'I', 'I', 42, 0, 8, 0, 0, 0,
+		// IFD0 with the GPS IFD pointer
+		1, 0, 0x25, 0x88, 4, 0, 1, 0, 0, 0, 26, 0, 0, 0, 0, 0, 0, 0,
+		// GPS IFD with the latitude
+		2, 0,
+		1, 0, 2, 0, 2, 0, 0, 0, 'N', 0, 0, 0,
+		2, 0, 5, 0, 3, 0, 0, 0, 56, 0, 0, 0,
+		0, 0, 0, 0,
+		22, 0, 0, 0, 1, 0, 0, 0, 30, 0, 0, 0, 1, 0, 0, 0, 0, 0, 0, 0, 1, 0, 0, 0,
+	}
+	payload := append([]byte("Exif\x00\x00"), tiff...)
+	app1 := []byte{0xFF, 0xE1, 0, 0}
+	binary.BigEndian.PutUint16(app1[2:], uint16(len(payload)+2))
+
+	buf := bytes.Buffer{}
+	jpeg.Encode(&buf, image.NewGray(image.Rect(0, 0, width, height)), nil)
+	img := buf.Bytes()
+
+	jpg := append([]byte{}, img[:2]...)
+	jpg = append(jpg, app1...)
+	jpg = append(jpg, payload...)
+	return append(jpg, img[2:]...)
+}
+
+func TestUploadFileHandlerWithMetadata(t *testing.T) {
+	Convey("UploadFileHandler", t, func() {
+		assetConn := &naiveAssetConn{}
+		assetConn.savedAsset = map[string]*skydb.Asset{
+			"photo.jpg": &skydb.Asset{
+				Name:        "photo.jpg",
+				ContentType: "image/jpeg",
+			},
+		}
+		store := newBufferedStore()
+		policy := &asset.UploadPolicy{}
+
+		r := newmodGateway("(.+)")
+		r.Handle("PUT", &UploadFileHandler{
+			AssetStore:        store,
+			AssetUploadPolicy: policy,
+		}, func(p *router.Payload) {
+			p.DBConn = assetConn
+		})
+
+		jpg := encodeTestGPSJPEG(4, 3)
+		upload := func() *httptest.ResponseRecorder {
+			req, _ := http.NewRequest("PUT", "http://skygear.test/photo.jpg", bytes.NewReader(jpg))
+			req.Header.Set("Content-Type", "image/jpeg")
+			return r.Do(req)
+		}
+
+		Convey("extract metadata without GPS location if not stripping", func() {
+			policy.StripEXIF = asset.EXIFStripNone
+
+			resp := upload()
+			So(resp.Code, ShouldEqual, http.StatusOK)
+			So(assetConn.savedAsset["photo.jpg"].Metadata, ShouldResemble, &asset.Metadata{
+				Width:  4,
+				Height: 3,
+			})
+			So(store.buf.Bytes(), ShouldResemble, jpg)
+		})
+
+		Convey("strip GPS location by default", func() {
+			resp := upload()
+			So(resp.Body.String(), ShouldEqualJSON, `{
+				"result": {
+					"$type": "asset",
+					"$name": "photo.jpg",
+					"$url": "photo.jpg?signedurl=true",
+					"$content_type": "image/jpeg",
+					"$metadata": {
+						"width": 4,
+						"height": 3
+					}
+				}
+			}`)
+			So(assetConn.savedAsset["photo.jpg"].Metadata, ShouldResemble, &asset.Metadata{
+				Width:  4,
+				Height: 3,
+			})
+
+			stored := store.buf.Bytes()
+			So(len(stored), ShouldEqual, len(jpg))
+			So(stored, ShouldNotResemble, jpg)
+		})
+	})
+}
+
+func TestExtractStoredAssetMetadata(t *testing.T) {
+	Convey("extractStoredAssetMetadata", t, func() {
+		logger := logging.LoggerEntry("handler")
+		content := encodeTestGPSJPEG(4, 3)
+		a := skydb.Asset{
+			Name:        "photo.jpg",
+			ContentType: "image/jpeg",
+			Size:        int64(len(content)),
+		}
+
+		Convey("extract from store supporting ranged reads", func() {
+			dir, err := ioutil.TempDir("", "skygear-asset-")
+			So(err, ShouldBeNil)
+			defer os.RemoveAll(dir)
+			So(ioutil.WriteFile(filepath.Join(dir, "photo.jpg"), content, 0644), ShouldBeNil)
+
+			extractStoredAssetMetadata(asset.NewFileStore(dir, "", "", true), &a, logger)
+			So(a.Metadata.Width, ShouldEqual, 4)
+			So(a.Metadata.Height, ShouldEqual, 3)
+		})
+
+		Convey("extract from other store", func() {
+			store := newBufferedStore()
+			store.buf.Write(content)
+
+			extractStoredAssetMetadata(store, &a, logger)
+			So(a.Metadata.Width, ShouldEqual, 4)
+			So(a.Metadata.Height, ShouldEqual, 3)
+		})
+
+		Convey("save no metadata of missing file", func() {
+			dir, err := ioutil.TempDir("", "skygear-asset-")
+			So(err, ShouldBeNil)
+			defer os.RemoveAll(dir)
+
+			a.Metadata = &asset.Metadata{Width: 1}
+			extractStoredAssetMetadata(asset.NewFileStore(dir, "", "", true), &a, logger)
+			So(a.Metadata, ShouldBeNil)
+		})
+	})
+}
+
+func TestStripUploadedEXIF(t *testing.T) {
+	Convey("stripUploadedEXIF", t, func() {
+		logger := logging.LoggerEntry("handler")
+		dir, err := ioutil.TempDir("", "skygear-asset-")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		store := asset.NewFileStore(dir, "", "", true)
+		path := filepath.Join(dir, "photo.jpg")
+		content := encodeTestGPSJPEG(4, 3)
+		So(ioutil.WriteFile(path, content, 0644), ShouldBeNil)
+		a := skydb.Asset{
+			Name:        "photo.jpg",
+			ContentType: "image/jpeg",
+			Size:        int64(len(content)),
+		}
+
+		Convey("store the stripped image", func() {
+			So(stripUploadedEXIF(store, asset.EXIFStripGPS, &a, logger), ShouldBeNil)
+
+			stripped, err := ioutil.ReadFile(path)
+			So(err, ShouldBeNil)
+			So(len(stripped), ShouldEqual, len(content))
+			So(stripped, ShouldNotResemble, content)
+		})
+
+		Convey("not strip non-image", func() {
+			a.ContentType = "application/octet-stream"
+			So(stripUploadedEXIF(store, asset.EXIFStripGPS, &a, logger), ShouldBeNil)
+
+			stored, err := ioutil.ReadFile(path)
+			So(err, ShouldBeNil)
+			So(stored, ShouldResemble, content)
+		})
+
+		Convey("not strip if disabled", func() {
+			So(stripUploadedEXIF(store, asset.EXIFStripNone, &a, logger), ShouldBeNil)
+
+			stored, err := ioutil.ReadFile(path)
+			So(err, ShouldBeNil)
+			So(stored, ShouldResemble, content)
+		})
+
+		Convey("return error for missing file", func() {
+			a.Name = "missing.jpg"
+			So(stripUploadedEXIF(store, asset.EXIFStripGPS, &a, logger), ShouldNotBeNil)
+		})
+	})
+}
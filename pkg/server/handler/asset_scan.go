@@ -0,0 +1,227 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/mitchellh/mapstructure"
+	"github.com/sirupsen/logrus"
+
+	skyAsset "github.com/skygeario/skygear-server/pkg/server/asset"
+	"github.com/skygeario/skygear-server/pkg/server/job"
+	"github.com/skygeario/skygear-server/pkg/server/logging"
+	"github.com/skygeario/skygear-server/pkg/server/router"
+	"github.com/skygeario/skygear-server/pkg/server/skydb"
+	"github.com/skygeario/skygear-server/pkg/server/skyerr"
+)
+
+// AssetScanAction is the action name of AssetScanHandler, which is also the
+// name of the job scheduled to scan an uploaded asset.
+const AssetScanAction = "asset:scan"
+
+// uploadedAssetStatus returns the status of an uploaded asset, which is
+// pending until scanned if scanning is enabled
+func uploadedAssetStatus(scanEnabled bool) skydb.AssetStatus {
+	if scanEnabled {
+		return skydb.AssetStatusPending
+	}
+	return ""
+}
+
+// scheduleAssetScan schedules a job scanning the asset at runAt. The job
+// is not scheduled again if it is scheduled already, because the latest
+// content of the asset is scanned when the job is executed.
+func scheduleAssetScan(conn skydb.Conn, name string, runAt time.Time, logger *logrus.Entry) skyerr.Error {
+	now := timeNow()
+	j := skydb.Job{
+		Name: AssetScanAction,
+		Args: map[string]interface{}{
+			"name": name,
+		},
+		Key:         AssetScanAction + ":" + name,
+		RunAt:       runAt.UTC(),
+		MaxAttempts: job.DefaultMaxAttempts,
+		CreatedAt:   now,
+	}
+	if err := conn.CreateJob(&j); err != nil && err != skydb.ErrJobDuplicated {
+		logger.WithError(err).Errorf("Failed to schedule scanning of asset %s", name)
+		return skyerr.MakeError(err)
+	}
+	return nil
+}
+
+type assetScanPayload struct {
+	Name string `mapstructure:"name"`
+}
+
+func (payload *assetScanPayload) Decode(data map[string]interface{}) skyerr.Error {
+	// the payload is in args when the action is executed as a job
+	if args, ok := data["args"].(map[string]interface{}); ok {
+		data = args
+	}
+	if err := mapstructure.Decode(data, payload); err != nil {
+		return skyerr.NewError(skyerr.BadRequest, "fails to decode the request payload")
+	}
+	return payload.Validate()
+}
+
+func (payload *assetScanPayload) Validate() skyerr.Error {
+	if payload.Name == "" {
+		return skyerr.NewInvalidArgument("empty asset name", []string{"name"})
+	}
+	return nil
+}
+
+// AssetScanHandler scans the content of an uploaded asset for malware, and
+// marks the asset clean or infected. Uploaded assets are pending until
+// scanned, and are not served unless marked clean, see GetFileHandler.
+// URLs are not signed for assets not marked clean, as files in asset
+// stores like S3 are served by the asset store directly.
+//
+// The handler is executed by the job worker, which retries the scan if
+// the scanner fails, for example, when the file is not yet uploaded
+// to the asset store. The scan is also retried if the file is stored
+// again during the scan, which is detected by the version of the file if
+// the asset store is a skyAsset.FileVersionGetter.
+//
+//  curl -X POST -H "Content-Type: application/json" \
+//    -d @- http://localhost:3000/ <<EOF
+//  {
+//      "action": "asset:scan",
+//      "api_key": "MASTER_KEY",
+//      "name": "asset-name"
+//  }
+//  EOF
+type AssetScanHandler struct {
+	Scanner          skyAsset.Scanner
+	AssetStore       skyAsset.Store   `inject:"AssetStore"`
+	AccessKey        router.Processor `preprocessor:"accesskey"`
+	RequireMasterKey router.Processor `preprocessor:"require_master_key"`
+	DBConn           router.Processor `preprocessor:"dbconn"`
+	preprocessors    []router.Processor
+}
+
+// Setup adds injected pre-processors to preprocessors array
+func (h *AssetScanHandler) Setup() {
+	h.preprocessors = []router.Processor{
+		h.AccessKey,
+		h.RequireMasterKey,
+		h.DBConn,
+	}
+}
+
+// GetPreprocessors returns all pre-processors for the handler
+func (h *AssetScanHandler) GetPreprocessors() []router.Processor {
+	return h.preprocessors
+}
+
+// Handle is the handling method of the asset scan request
+func (h *AssetScanHandler) Handle(payload *router.Payload, response *router.Response) {
+	logger := logging.CreateLogger(payload.Context(), "handler")
+
+	p := assetScanPayload{}
+	if skyErr := p.Decode(payload.Data); skyErr != nil {
+		response.Err = skyErr
+		return
+	}
+
+	conn := payload.DBConn
+	asset := skydb.Asset{}
+	if err := conn.GetAsset(p.Name, &asset); err != nil {
+		response.Err = skyerr.NewErrorWithInfo(
+			skyerr.ResourceNotFound,
+			fmt.Sprintf(`cannot find asset "%s"`, p.Name),
+			map[string]interface{}{"name": p.Name},
+		)
+		return
+	}
+
+	version, skyErr := h.getFileVersion(&asset, logger)
+	if skyErr != nil {
+		response.Err = skyErr
+		return
+	}
+
+	reader, err := h.AssetStore.GetFileReader(asset.ObjectName())
+	if err != nil {
+		logger.WithError(err).Warnf("Failed to get asset %s for scanning", asset.Name)
+		response.Err = skyerr.NewResourceFetchFailureErr("asset", asset.Name)
+		return
+	}
+	result, err := h.Scanner.Scan(asset.Name, reader)
+	reader.Close()
+	if err != nil {
+		logger.WithError(err).Errorf("Failed to scan asset %s", asset.Name)
+		response.Err = skyerr.NewError(skyerr.UnexpectedError, "Failed to scan asset")
+		return
+	}
+
+	// the file scanned is the version got before the scan only if the
+	// version is unchanged after the scan
+	scannedVersion, skyErr := h.getFileVersion(&asset, logger)
+	if skyErr != nil {
+		response.Err = skyErr
+		return
+	}
+	if scannedVersion != version {
+		response.Err = skyerr.NewError(skyerr.UnexpectedError, "Asset is uploaded again during the scan")
+		return
+	}
+
+	// the scan is retried if the asset is uploaded again during the scan,
+	// because the job is not scheduled again while it is executed
+	current := skydb.Asset{}
+	if err := conn.GetAsset(asset.Name, &current); err != nil {
+		response.Err = skyerr.NewResourceFetchFailureErr("asset", asset.Name)
+		return
+	}
+	if current.Hash != asset.Hash || current.Size != asset.Size {
+		response.Err = skyerr.NewError(skyerr.UnexpectedError, "Asset is uploaded again during the scan")
+		return
+	}
+
+	asset.Status = skydb.AssetStatusClean
+	if result.Infected {
+		logger.Warnf("Found %s in asset %s", result.Signature, asset.Name)
+		asset.Status = skydb.AssetStatusInfected
+	}
+	if err := conn.SaveAsset(&asset); err != nil {
+		response.Err = skyerr.NewResourceSaveFailureErrWithStringID("asset", asset.Name)
+		return
+	}
+
+	response.Result = map[string]interface{}{
+		"name":      asset.Name,
+		"status":    asset.Status,
+		"signature": result.Signature,
+	}
+}
+
+// getFileVersion returns the version of the file of the asset, which is
+// empty if the asset store does not version files
+func (h *AssetScanHandler) getFileVersion(asset *skydb.Asset, logger *logrus.Entry) (string, skyerr.Error) {
+	versionGetter, ok := h.AssetStore.(skyAsset.FileVersionGetter)
+	if !ok {
+		return "", nil
+	}
+	version, err := versionGetter.GetFileVersion(asset.ObjectName())
+	if err != nil {
+		logger.WithError(err).Warnf("Failed to get version of asset %s for scanning", asset.Name)
+		return "", skyerr.NewResourceFetchFailureErr("asset", asset.Name)
+	}
+	return version, nil
+}
@@ -0,0 +1,313 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/skygeario/skygear-server/pkg/server/asset"
+	"github.com/skygeario/skygear-server/pkg/server/handler/handlertest"
+	"github.com/skygeario/skygear-server/pkg/server/router"
+	"github.com/skygeario/skygear-server/pkg/server/skydb"
+	"github.com/skygeario/skygear-server/pkg/server/skydb/skydbtest"
+	. "github.com/skygeario/skygear-server/pkg/server/skytest"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+type fakeScanner struct {
+	scanned string
+	result  *asset.ScanResult
+	err     error
+}
+
+func (s *fakeScanner) Scan(name string, src io.Reader) (*asset.ScanResult, error) {
+	data, err := ioutil.ReadAll(src)
+	if err != nil {
+		return nil, err
+	}
+	s.scanned = string(data)
+	return s.result, s.err
+}
+
+// versionedAssetStore returns the versions in order as the version of
+// the file
+type versionedAssetStore struct {
+	*bufferedAssetStore
+	versions []string
+}
+
+func (s *versionedAssetStore) GetFileVersion(name string) (string, error) {
+	version := s.versions[0]
+	s.versions = s.versions[1:]
+	return version, nil
+}
+
+func TestAssetScanHandler(t *testing.T) {
+	Convey("AssetScanHandler", t, func() {
+		conn := skydbtest.NewMapConn()
+		store := newBufferedStore()
+		scanner := &fakeScanner{result: &asset.ScanResult{}}
+		r := handlertest.NewSingleRouteRouter(&AssetScanHandler{
+			AssetStore: store,
+			Scanner:    scanner,
+		}, func(p *router.Payload) {
+			p.DBConn = conn
+		})
+
+		conn.AssetMap["asset-name"] = skydb.Asset{
+			Name:        "asset-name",
+			ContentType: "text/plain",
+			Size:        10,
+			Status:      skydb.AssetStatusPending,
+		}
+		io.WriteString(store.buf, "I am a boy")
+
+		Convey("marks clean asset", func() {
+			resp := r.POST(`{"args": {"name": "asset-name"}}`)
+			So(resp.Body.Bytes(), ShouldEqualJSON, `{
+				"result": {
+					"name": "asset-name",
+					"status": "clean",
+					"signature": ""
+				}
+			}`)
+			So(scanner.scanned, ShouldEqual, "I am a boy")
+			So(conn.AssetMap["asset-name"].Status, ShouldEqual, skydb.AssetStatusClean)
+		})
+
+		Convey("marks infected asset", func() {
+			scanner.result = &asset.ScanResult{
+				Infected:  true,
+				Signature: "Eicar-Test-Signature",
+			}
+
+			resp := r.POST(`{"name": "asset-name"}`)
+			So(resp.Body.Bytes(), ShouldEqualJSON, `{
+				"result": {
+					"name": "asset-name",
+					"status": "infected",
+					"signature": "Eicar-Test-Signature"
+				}
+			}`)
+			So(conn.AssetMap["asset-name"].Status, ShouldEqual, skydb.AssetStatusInfected)
+		})
+
+		Convey("keeps asset pending if scanner fails", func() {
+			scanner.err = errors.New("clamd is down")
+
+			resp := r.POST(`{"name": "asset-name"}`)
+			So(resp.Code, ShouldEqual, 500)
+			So(conn.AssetMap["asset-name"].Status, ShouldEqual, skydb.AssetStatusPending)
+		})
+
+		Convey("with versioned asset store", func() {
+			versionedStore := &versionedAssetStore{bufferedAssetStore: store}
+			r := handlertest.NewSingleRouteRouter(&AssetScanHandler{
+				AssetStore: versionedStore,
+				Scanner:    scanner,
+			}, func(p *router.Payload) {
+				p.DBConn = conn
+			})
+
+			Convey("marks asset of unchanged version", func() {
+				versionedStore.versions = []string{`"etag-1"`, `"etag-1"`}
+				resp := r.POST(`{"name": "asset-name"}`)
+				So(resp.Code, ShouldEqual, 200)
+				So(conn.AssetMap["asset-name"].Status, ShouldEqual, skydb.AssetStatusClean)
+			})
+
+			Convey("keeps asset pending if file is stored again during the scan", func() {
+				versionedStore.versions = []string{`"etag-1"`, `"etag-2"`}
+				resp := r.POST(`{"name": "asset-name"}`)
+				So(resp.Code, ShouldEqual, 500)
+				So(conn.AssetMap["asset-name"].Status, ShouldEqual, skydb.AssetStatusPending)
+			})
+		})
+
+		Convey("errors if asset not found", func() {
+			resp := r.POST(`{"name": "not-exist"}`)
+			So(resp.Code, ShouldEqual, 404)
+		})
+
+		Convey("errors without asset name", func() {
+			resp := r.POST(`{}`)
+			So(resp.Code, ShouldEqual, 400)
+		})
+	})
+}
+
+func TestAssetScanScheduling(t *testing.T) {
+	Convey("UploadFileHandler with asset scanning", t, func() {
+		realTimeNow := timeNow
+		timeNow = func() time.Time {
+			return time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC)
+		}
+		defer func() {
+			timeNow = realTimeNow
+		}()
+
+		conn := skydbtest.NewMapConn()
+		store := newBufferedStore()
+		r := newmodGateway("(.+)")
+		r.Handle("PUT", &UploadFileHandler{
+			AssetStore:       store,
+			AssetScanEnabled: true,
+		}, func(p *router.Payload) {
+			p.DBConn = conn
+		})
+
+		conn.AssetMap["asset-name"] = skydb.Asset{
+			Name:        "asset-name",
+			ContentType: "text/plain",
+		}
+
+		req, _ := http.NewRequest(
+			"PUT",
+			"http://skygear.test/asset-name",
+			strings.NewReader("I am a boy"),
+		)
+		req.Header.Set("Content-Type", "text/plain")
+
+		Convey("marks uploaded asset pending and schedules scan", func() {
+			resp := r.Do(req)
+			So(resp.Code, ShouldEqual, 200)
+			So(conn.AssetMap["asset-name"].Status, ShouldEqual, skydb.AssetStatusPending)
+			So(conn.JobMap, ShouldHaveLength, 1)
+			for _, j := range conn.JobMap {
+				So(j.Name, ShouldEqual, AssetScanAction)
+				So(j.Key, ShouldEqual, "asset:scan:asset-name")
+				So(j.Args, ShouldResemble, map[string]interface{}{"name": "asset-name"})
+				So(j.RunAt, ShouldResemble, timeNow())
+			}
+		})
+
+		Convey("does not schedule scan scheduled already", func() {
+			conn.JobMap["job-0"] = skydb.Job{
+				ID:   "job-0",
+				Name: AssetScanAction,
+				Key:  "asset:scan:asset-name",
+			}
+
+			resp := r.Do(req)
+			So(resp.Code, ShouldEqual, 200)
+			So(conn.JobMap, ShouldHaveLength, 1)
+		})
+	})
+}
+
+func TestAssetUploadScanScheduling(t *testing.T) {
+	Convey("AssetUploadHandler with asset scanning", t, func() {
+		realTimeNow := timeNow
+		timeNow = func() time.Time {
+			return time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC)
+		}
+		defer func() {
+			timeNow = realTimeNow
+		}()
+
+		conn := skydbtest.NewMapConn()
+		put := func(store asset.Store, multipart bool) {
+			r := handlertest.NewSingleRouteRouter(&AssetUploadHandler{
+				AssetStore:       store,
+				AssetScanEnabled: true,
+			}, func(p *router.Payload) {
+				p.DBConn = conn
+			})
+			resp := r.POST(fmt.Sprintf(`{
+				"filename": "movie.mp4",
+				"content-type": "video/mp4",
+				"content-size": 10,
+				"multipart": %v
+			}`, multipart))
+			So(resp.Code, ShouldEqual, 200)
+		}
+		fileStore := &multipartAssetStore{
+			URLSignerStore: asset.NewFileStore("data/asset", "http://skygear.test/files", "secret", true).(asset.URLSignerStore),
+		}
+
+		Convey("schedules scan after direct upload request expires", func() {
+			put(generatePostFileRequestAssetStore{}, false)
+			So(conn.JobMap, ShouldHaveLength, 1)
+			for _, j := range conn.JobMap {
+				So(j.Name, ShouldEqual, AssetScanAction)
+				So(j.RunAt, ShouldResemble, timeNow().Add(asset.PresignedUploadExpiry))
+			}
+		})
+
+		Convey("does not schedule scan of upload through server", func() {
+			put(fileStore, false)
+			So(conn.JobMap, ShouldBeEmpty)
+		})
+
+		Convey("does not schedule scan of multipart upload", func() {
+			put(fileStore, true)
+			So(conn.JobMap, ShouldBeEmpty)
+		})
+	})
+}
+
+func TestGetFileHandlerWithAssetScan(t *testing.T) {
+	Convey("GetFileHandler with asset scanning", t, func() {
+		conn := skydbtest.NewMapConn()
+		store := asset.NewFileStore("data/asset", "http://skygear.test/files", "secret", true)
+		r := newmodGateway("(.+)")
+		r.Handle("GET", &GetFileHandler{
+			AssetStore: store,
+		}, func(p *router.Payload) {
+			p.DBConn = conn
+		})
+
+		Convey("refuses asset pending to be scanned", func() {
+			conn.AssetMap["pending.txt"] = skydb.Asset{
+				Name:   "pending.txt",
+				Status: skydb.AssetStatusPending,
+			}
+
+			resp := r.GET("pending.txt")
+			So(resp.Body.String(), ShouldEqualJSON, `{
+				"error": {
+					"code": 102,
+					"name": "PermissionDenied",
+					"message": "Asset is pending to be scanned",
+					"info": {"status": "pending"}
+				}
+			}`)
+		})
+
+		Convey("refuses infected asset", func() {
+			conn.AssetMap["infected.txt"] = skydb.Asset{
+				Name:   "infected.txt",
+				Status: skydb.AssetStatusInfected,
+			}
+
+			resp := r.GET("infected.txt")
+			So(resp.Body.String(), ShouldEqualJSON, `{
+				"error": {
+					"code": 102,
+					"name": "PermissionDenied",
+					"message": "Asset is infected",
+					"info": {"status": "infected"}
+				}
+			}`)
+		})
+	})
+}
@@ -16,8 +16,10 @@ package handler
 
 import (
 	"encoding/json"
+	"fmt"
 	"io"
 	"net/http"
+	"net/url"
 	"strings"
 	"testing"
 
@@ -25,6 +27,8 @@ import (
 	"github.com/skygeario/skygear-server/pkg/server/handler/handlertest"
 	"github.com/skygeario/skygear-server/pkg/server/router"
 	"github.com/skygeario/skygear-server/pkg/server/skydb"
+	"github.com/skygeario/skygear-server/pkg/server/skydb/skydbtest"
+	. "github.com/skygeario/skygear-server/pkg/server/skytest"
 	. "github.com/smartystreets/goconvey/convey"
 )
 
@@ -45,6 +49,10 @@ func (s generatePostFileRequestAssetStore) PutFileReader(
 	panic("Not Implemented")
 }
 
+func (s generatePostFileRequestAssetStore) Delete(name string) error {
+	panic("Not Implemented")
+}
+
 func (s generatePostFileRequestAssetStore) GeneratePostFileRequest(
 	name string,
 	contentType string,
@@ -169,5 +177,380 @@ func TestAssetUploadHandler(t *testing.T) {
 
 			So(res.Code, ShouldEqual, http.StatusBadRequest)
 		})
+
+		Convey("Fail on multipart upload with unsupported store", func() {
+			res := assetRouter.POST(`{
+        "filename": "file001",
+        "content-type": "text/plain",
+        "content-size": 2384571,
+        "multipart": true
+      }`)
+
+			So(res.Code, ShouldEqual, http.StatusNotImplemented)
+		})
+	})
+
+	Convey("Asset Upload Handler with upload policy", t, func() {
+		assetDBConn := &saveAssetDBConn{}
+		assetDBConn.savedAsset = map[string]*skydb.Asset{}
+
+		assetRouter := handlertest.NewSingleRouteRouter(
+			&AssetUploadHandler{
+				AssetStore: generatePostFileRequestAssetStore{},
+				AssetUploadPolicy: &asset.UploadPolicy{
+					FieldUploadPolicy: asset.FieldUploadPolicy{
+						MaxSize: 1048576,
+					},
+					Fields: map[string]asset.FieldUploadPolicy{
+						"user.avatar": asset.FieldUploadPolicy{
+							ContentTypes: []string{"image/*"},
+						},
+					},
+				},
+			},
+			func(p *router.Payload) {
+				p.DBConn = assetDBConn
+			},
+		)
+
+		Convey("Fail when content size exceeds the limit", func() {
+			res := assetRouter.POST(`{
+				"filename": "file001",
+				"content-type": "text/plain",
+				"content-size": 2384571
+			}`)
+
+			So(res.Code, ShouldEqual, http.StatusRequestEntityTooLarge)
+			So(res.Body.Bytes(), ShouldEqualJSON, `{
+				"error": {
+					"code": 129,
+					"name": "AssetSizeTooLarge",
+					"message": "Asset is larger than 1048576 bytes",
+					"info": {
+						"max_size": 1048576
+					}
+				}
+			}`)
+			So(assetDBConn.savedAsset, ShouldBeEmpty)
+		})
+
+		Convey("Fail when content type is not allowed by the field", func() {
+			res := assetRouter.POST(`{
+				"filename": "file001",
+				"content-type": "text/plain",
+				"content-size": 1024,
+				"record-type": "user",
+				"field": "avatar"
+			}`)
+
+			So(res.Body.Bytes(), ShouldEqualJSON, `{
+				"error": {
+					"code": 108,
+					"name": "InvalidArgument",
+					"message": "Asset of user.avatar of content type text/plain is not allowed",
+					"info": {
+						"field": "user.avatar"
+					}
+				}
+			}`)
+			So(assetDBConn.savedAsset, ShouldBeEmpty)
+		})
+
+		Convey("Success when conforming to the field policy", func() {
+			res := assetRouter.POST(`{
+				"filename": "avatar.png",
+				"content-type": "image/png",
+				"content-size": 1024,
+				"record-type": "user",
+				"field": "avatar"
+			}`)
+
+			So(res.Code, ShouldEqual, http.StatusOK)
+			So(assetDBConn.savedAsset, ShouldHaveLength, 1)
+		})
+	})
+
+	Convey("Asset Upload Handler with multipart", t, func() {
+		realUUIDNew := uuidNew
+		uuidNew = func() string { return "uuid" }
+		defer func() {
+			uuidNew = realUUIDNew
+		}()
+
+		conn := skydbtest.NewMapConn()
+		r := handlertest.NewSingleRouteRouter(&AssetUploadHandler{
+			AssetStore: &multipartAssetStore{
+				URLSignerStore: asset.NewFileStore("data/asset", "http://skygear.test/files", "secret", true).(asset.URLSignerStore),
+			},
+		}, func(p *router.Payload) {
+			p.DBConn = conn
+		})
+
+		res := r.POST(`{
+			"filename": "movie.mp4",
+			"content-type": "video/mp4",
+			"content-size": 10,
+			"multipart": true
+		}`)
+		So(res.Body.Bytes(), ShouldEqualJSON, `{
+			"result": {
+				"multipart-request": {
+					"action": "/files/_uploads/uuid",
+					"upload-id": "multipart-upload-id",
+					"part-size": 10,
+					"parts": [{
+						"part-number": 1,
+						"url": "http://s3.test/uuid-movie.mp4?partNumber=1"
+					}]
+				},
+				"asset": {
+					"$type": "asset",
+					"$name": "uuid-movie.mp4",
+					"$content_type": "video/mp4",
+					"$url": "http://skygear.test/files/uuid-movie.mp4"
+				}
+			}
+		}`)
+		So(conn.AssetUploadMap["uuid"].MultipartUploadID, ShouldEqual, "multipart-upload-id")
+		So(conn.AssetUploadMap["uuid"].Name, ShouldEqual, "uuid-movie.mp4")
+	})
+}
+
+func TestAssetRenewUploadHandler(t *testing.T) {
+	Convey("AssetRenewUploadHandler", t, func() {
+		conn := skydbtest.NewMapConn()
+		conn.AssetUploadMap["multipart"] = skydb.AssetUpload{
+			ID:                "multipart",
+			Name:              "movie.mp4",
+			ContentType:       "video/mp4",
+			Length:            10,
+			MultipartUploadID: "multipart-upload-id",
+		}
+		conn.AssetUploadMap["chunked"] = skydb.AssetUpload{
+			ID:          "chunked",
+			Name:        "movie.mp4",
+			ContentType: "video/mp4",
+			Length:      10,
+		}
+
+		r := handlertest.NewSingleRouteRouter(&AssetRenewUploadHandler{
+			AssetStore: &multipartAssetStore{
+				URLSignerStore: asset.NewFileStore("data/asset", "http://skygear.test/files", "secret", true).(asset.URLSignerStore),
+			},
+		}, func(p *router.Payload) {
+			p.DBConn = conn
+		})
+
+		Convey("renews part URLs of multipart upload", func() {
+			res := r.POST(`{"url": "/files/_uploads/multipart"}`)
+			So(res.Body.Bytes(), ShouldEqualJSON, `{
+				"result": {
+					"multipart-request": {
+						"action": "/files/_uploads/multipart",
+						"upload-id": "multipart-upload-id",
+						"part-size": 10,
+						"parts": [{
+							"part-number": 1,
+							"url": "http://s3.test/movie.mp4?partNumber=1&renewed=1"
+						}]
+					}
+				}
+			}`)
+			So(conn.AssetUploadMap["multipart"].UpdatedAt.IsZero(), ShouldBeFalse)
+		})
+
+		Convey("errors on upload not multipart", func() {
+			res := r.POST(`{"url": "/files/_uploads/chunked"}`)
+			So(res.Body.Bytes(), ShouldEqualJSON, `{
+				"error": {
+					"code": 111,
+					"message": "Only multipart uploads can be renewed",
+					"name": "NotSupported"
+				}
+			}`)
+		})
+
+		Convey("errors on upload not found", func() {
+			res := r.POST(`{"url": "/files/_uploads/notexist"}`)
+			So(res.Body.Bytes(), ShouldEqualJSON, `{
+				"error": {
+					"code": 110,
+					"message": "cannot find upload \"notexist\"",
+					"name": "ResourceNotFound",
+					"info": {"id": "notexist"}
+				}
+			}`)
+		})
+
+		Convey("errors on missing url", func() {
+			res := r.POST(`{}`)
+			So(res.Code, ShouldEqual, 400)
+		})
+	})
+}
+
+func TestAssetTransformHandler(t *testing.T) {
+	Convey("AssetTransformHandler", t, func() {
+		conn := skydbtest.NewMapConn()
+		conn.AssetMap["photo.png"] = skydb.Asset{
+			Name:        "photo.png",
+			ContentType: "image/png",
+			Size:        1024,
+		}
+
+		store := asset.NewFileStore("data/asset", "http://skygear.dev/files", "secret", false)
+		r := handlertest.NewSingleRouteRouter(&AssetTransformHandler{
+			AssetStore: store,
+		}, func(p *router.Payload) {
+			p.DBConn = conn
+			p.AccessKey = router.MasterAccessKey
+		})
+
+		Convey("returns signed url of transformed image", func() {
+			res := r.POST(`{
+				"name": "photo.png",
+				"transform": {
+					"width": 200,
+					"fit": "contain",
+					"format": "webp"
+				}
+			}`)
+			So(res.Code, ShouldEqual, http.StatusOK)
+
+			resJSON := struct {
+				Result map[string]string `json:"result"`
+			}{}
+			So(json.Unmarshal(res.Body.Bytes(), &resJSON), ShouldBeNil)
+			So(resJSON.Result["name"], ShouldEqual, "photo.png")
+
+			signedURL, err := url.Parse(resJSON.Result["url"])
+			So(err, ShouldBeNil)
+			So(signedURL.Path, ShouldEqual, "/files/photo.png")
+			query := signedURL.Query()
+			So(query.Get("width"), ShouldEqual, "200")
+			So(query.Get("fit"), ShouldEqual, "contain")
+			So(query.Get("format"), ShouldEqual, "webp")
+			So(query.Get("signature"), ShouldNotBeEmpty)
+		})
+
+		Convey("errors on invalid transform", func() {
+			res := r.POST(`{
+				"name": "photo.png",
+				"transform": {
+					"fit": "stretch",
+					"width": 200
+				}
+			}`)
+			So(res.Body.Bytes(), ShouldEqualJSON, `{
+				"error": {
+					"code": 108,
+					"name": "InvalidArgument",
+					"message": "Image transform fit must be one of contain, cover and fill",
+					"info": {
+						"arguments": ["fit"]
+					}
+				}
+			}`)
+		})
+
+		Convey("errors on missing asset", func() {
+			res := r.POST(`{
+				"name": "missing.png",
+				"transform": {
+					"width": 200
+				}
+			}`)
+			So(res.Body.Bytes(), ShouldEqualJSON, `{
+				"error": {
+					"code": 110,
+					"name": "ResourceNotFound",
+					"message": "cannot find asset \"missing.png\"",
+					"info": {
+						"name": "missing.png"
+					}
+				}
+			}`)
+		})
+	})
+}
+
+func TestAssetTransformHandlerAccess(t *testing.T) {
+	Convey("AssetTransformHandler of asset store requiring signatures", t, func() {
+		store := asset.NewFileStore("data/asset", "http://skygear.dev/files", "secret", false)
+		schemas := map[string]skydb.RecordSchema{
+			"note": skydb.RecordSchema{
+				"attachment": skydb.FieldType{Type: skydb.TypeAsset},
+			},
+		}
+		conn := &aclAssetConn{
+			publicDB: &aclAssetDatabase{
+				schemas: schemas,
+				readers: map[string]bool{},
+			},
+			privateDB: &aclAssetDatabase{
+				schemas: schemas,
+				readers: map[string]bool{},
+			},
+		}
+
+		authInfo := &skydb.AuthInfo{ID: "user-id"}
+		r := handlertest.NewSingleRouteRouter(&AssetTransformHandler{
+			AssetStore: store,
+		}, func(p *router.Payload) {
+			p.DBConn = conn
+			p.AuthInfo = authInfo
+			p.AccessKey = router.ClientAccessKey
+		})
+
+		accessDenied := `{
+			"error": {
+				"code": 102,
+				"name": "PermissionDenied",
+				"message": "Access denied"
+			}
+		}`
+
+		Convey("signs transform of asset of record readable by the user", func() {
+			conn.publicDB.readers["user-id"] = true
+
+			res := r.POST(`{
+				"name": "photo.png",
+				"transform": {"width": 200}
+			}`)
+			So(res.Code, ShouldEqual, http.StatusOK)
+		})
+
+		Convey("signs transform with a valid signature of the asset", func() {
+			signedURL, err := store.(asset.URLSigner).SignedURL("photo.png")
+			So(err, ShouldBeNil)
+			parsedURL, err := url.Parse(signedURL)
+			So(err, ShouldBeNil)
+
+			res := r.POST(fmt.Sprintf(`{
+				"name": "photo.png",
+				"transform": {"width": 200},
+				"signature": "%s",
+				"expired_at": %s
+			}`, parsedURL.Query().Get("signature"), parsedURL.Query().Get("expiredAt")))
+			So(res.Code, ShouldEqual, http.StatusOK)
+		})
+
+		Convey("errors on expired signature", func() {
+			res := r.POST(`{
+				"name": "photo.png",
+				"transform": {"width": 200},
+				"signature": "c2lnbmF0dXJl",
+				"expired_at": 1000
+			}`)
+			So(res.Body.Bytes(), ShouldEqualJSON, accessDenied)
+		})
+
+		Convey("errors on asset not referenced by readable records", func() {
+			res := r.POST(`{
+				"name": "photo.png",
+				"transform": {"width": 200}
+			}`)
+			So(res.Body.Bytes(), ShouldEqualJSON, accessDenied)
+		})
 	})
 }
@@ -21,6 +21,7 @@ import (
 	"github.com/sirupsen/logrus"
 
 	"github.com/skygeario/skygear-server/pkg/server/logging"
+	"github.com/skygeario/skygear-server/pkg/server/push"
 	"github.com/skygeario/skygear-server/pkg/server/router"
 	"github.com/skygeario/skygear-server/pkg/server/skydb"
 	"github.com/skygeario/skygear-server/pkg/server/skyerr"
@@ -44,10 +45,17 @@ func (payload *deviceRegisterPayload) Decode(data map[string]interface{}) skyerr
 func (payload *deviceRegisterPayload) Validate() skyerr.Error {
 	if payload.Type == "" {
 		return skyerr.NewInvalidArgument("empty device type", []string{"type"})
-	} else if payload.Type != "ios" && payload.Type != "android" && payload.Type != "baidu-android" {
+	} else if payload.Type != "ios" && payload.Type != "android" && payload.Type != "baidu-android" && payload.Type != "web" {
 		return skyerr.NewInvalidArgument(fmt.Sprintf("unknown device type = %v", payload.Type), []string{"type"})
 	}
 
+	// the token of a web device is the push subscription of the browser
+	if payload.Type == "web" && payload.DeviceToken != "" {
+		if _, err := push.ParseWebPushSubscription(payload.DeviceToken); err != nil {
+			return skyerr.NewInvalidArgument(err.Error(), []string{"device_token"})
+		}
+	}
+
 	return nil
 }
 
@@ -78,6 +86,10 @@ type DeviceReigsterResult struct {
 
 // DeviceRegisterHandler creates or updates a device and associates it to a user
 //
+// The type of a device is one of ios, android, baidu-android and web. The
+// device token of a web device is the JSON of the push subscription of
+// the browser, as returned by PushSubscription.toJSON().
+//
 // Example to create a new device:
 //
 //	curl -X POST -H "Content-Type: application/json" \
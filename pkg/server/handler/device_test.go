@@ -264,6 +264,35 @@ func TestDeviceRegisterHandler(t *testing.T) {
 			))
 		})
 
+		Convey("creates new web device with push subscription", func() {
+			subscription := `{"endpoint":"https://push.example.com/send/abc","keys":{"p256dh":"BCVxsr7N_eNgVRqvHtD0zTZsEc6-VV-JvLexhqUzORcxaOzi6-AYWXvTBHm4bjyPjs7Vd8pZGH6SRpkNtoIAiw4","auth":"BTBZMqHH6r4Tts7J_aSIgg"}}`
+			payload.Data = map[string]interface{}{
+				"type":         "web",
+				"device_token": subscription,
+			}
+
+			handler := &DeviceRegisterHandler{}
+			handler.Handle(&payload, &resp)
+
+			result := resp.Result.(DeviceReigsterResult)
+			So(conn.devices[result.ID].Type, ShouldEqual, "web")
+			So(conn.devices[result.ID].Token, ShouldEqual, subscription)
+		})
+
+		Convey("complains on web device with invalid push subscription", func() {
+			payload.Data = map[string]interface{}{
+				"type":         "web",
+				"device_token": `{"endpoint":"https://push.example.com/send/abc","keys":{}}`,
+			}
+
+			handler := &DeviceRegisterHandler{}
+			handler.Handle(&payload, &resp)
+
+			err := resp.Err.(skyerr.Error)
+			So(err.Code(), ShouldEqual, skyerr.InvalidArgument)
+			So(conn.devices, ShouldBeEmpty)
+		})
+
 		Convey("complains on unknown device type", func() {
 			conn.mockGetError = skydb.ErrDeviceNotFound
 
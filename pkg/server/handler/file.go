@@ -15,6 +15,7 @@
 package handler
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
 	"io"
@@ -32,6 +33,7 @@ import (
 
 	skyAsset "github.com/skygeario/skygear-server/pkg/server/asset"
 	"github.com/skygeario/skygear-server/pkg/server/logging"
+	"github.com/skygeario/skygear-server/pkg/server/recordutil"
 	"github.com/skygeario/skygear-server/pkg/server/router"
 	"github.com/skygeario/skygear-server/pkg/server/skydb"
 	"github.com/skygeario/skygear-server/pkg/server/skydb/skyconv"
@@ -104,16 +106,32 @@ func parseRangeHeader(rangeHeader string) (skyAsset.FileRange, error) {
 }
 
 // GetFileHandler models the handler for getting asset file
+//
+// Image asset is transformed on the fly if transform parameters are
+// specified in the query string, see asset.ImageTransform. The transform
+// parameters are signed together with the asset name, see asset:transform.
+//
+// If record ACL is required by the asset store, the asset is only
+// accessible to users who can read a record referencing it. The URL is
+// signed for the user, who has to make the request with the access token,
+// see asset.UserURLSigner.
+//
+// Assets pending to be scanned or found infected are not served, see
+// AssetScanHandler.
 type GetFileHandler struct {
 	AssetStore    skyAsset.Store   `inject:"AssetStore"`
+	Authenticator router.Processor `preprocessor:"inject_auth_id"`
 	DBConn        router.Processor `preprocessor:"dbconn"`
+	InjectAuth    router.Processor `preprocessor:"inject_auth"`
 	preprocessors []router.Processor
 }
 
 // Setup sets preprocessors being used
 func (h *GetFileHandler) Setup() {
 	h.preprocessors = []router.Processor{
+		h.Authenticator,
 		h.DBConn,
+		h.InjectAuth,
 	}
 }
 
@@ -129,6 +147,20 @@ func (h *GetFileHandler) Handle(payload *router.Payload, response *router.Respon
 
 	store := h.AssetStore
 	fileName := clean(payload.Params[0])
+	transform, transformErr := skyAsset.ParseImageTransform(payload.Req.Form)
+	if transformErr != nil {
+		response.Err = makeImageTransformError(transformErr)
+		return
+	}
+
+	userSigner, recordACLRequired := store.(skyAsset.UserURLSigner)
+	recordACLRequired = recordACLRequired && userSigner.IsRecordACLRequired()
+	userIDs, signedForUser := payload.Req.Form["user_id"]
+	if recordACLRequired && !signedForUser {
+		response.Err = skyerr.NewError(skyerr.PermissionDenied, "Access denied")
+		return
+	}
+
 	if store.(skyAsset.URLSigner).IsSignatureRequired() {
 		expiredAtUnix, err := strconv.ParseInt(payload.Req.Form.Get("expiredAt"), 10, 64)
 		if err != nil {
@@ -136,8 +168,18 @@ func (h *GetFileHandler) Handle(payload *router.Payload, response *router.Respon
 			return
 		}
 
+		signingName := skyAsset.TransformSigningName(fileName, transform)
+		if signedForUser {
+			signingName = skyAsset.UserSigningName(signingName, userIDs[0])
+		}
+
 		signature := payload.Req.Form.Get("signature")
-		requestErr := validateAssetGetRequest(h.AssetStore, fileName, expiredAtUnix, signature)
+		requestErr := validateAssetGetRequest(
+			h.AssetStore,
+			signingName,
+			expiredAtUnix,
+			signature,
+		)
 		if requestErr != nil {
 			response.Err = requestErr
 			return
@@ -153,6 +195,23 @@ func (h *GetFileHandler) Handle(payload *router.Payload, response *router.Respon
 		return
 	}
 
+	if recordACLRequired {
+		if skyErr := checkAssetRecordACL(payload, asset.Name, userIDs[0]); skyErr != nil {
+			response.Err = skyErr
+			return
+		}
+	}
+
+	if !asset.IsServable() {
+		response.Err = makeAssetNotServableError(asset)
+		return
+	}
+
+	if transform != nil {
+		h.handleTransformRequest(asset, *transform, response, logger)
+		return
+	}
+
 	rangeHeader := payload.Req.Header.Get("Range")
 	if rangeHeader != "" {
 		byteRange, err := parseRangeHeader(payload.Req.Header.Get("Range"))
@@ -187,7 +246,7 @@ func (h *GetFileHandler) handlePartialRangedRequest(
 	}
 
 	writer := response.Writer()
-	result, err := fileRangedGetter.GetRangedFileReader(fileName, byteRange)
+	result, err := fileRangedGetter.GetRangedFileReader(asset.ObjectName(), byteRange)
 	if err != nil {
 		notAcceptedError, isNotAccepted := err.(skyAsset.FileRangeNotAcceptedError)
 		if isNotAccepted {
@@ -236,7 +295,7 @@ func (h *GetFileHandler) handleFullRangedRequest(
 ) {
 	store := h.AssetStore
 	fileName := asset.Name
-	reader, err := store.GetFileReader(fileName)
+	reader, err := store.GetFileReader(asset.ObjectName())
 	if err != nil {
 		logger.WithError(err).Errorf("Failed to get file reader")
 
@@ -261,6 +320,161 @@ func (h *GetFileHandler) handleFullRangedRequest(
 	}
 }
 
+// handleTransformRequest serves the transformed image of the asset. The
+// transformed image is cached in the asset store under a name derived from
+// the transform, so that the image is only transformed once.
+func (h *GetFileHandler) handleTransformRequest(
+	asset *skydb.Asset,
+	transform skyAsset.ImageTransform,
+	response *router.Response,
+	logger *logrus.Entry,
+) {
+	store := h.AssetStore
+	fileName := asset.Name
+	if !strings.HasPrefix(asset.ContentType, "image/") {
+		response.Err = skyerr.NewError(
+			skyerr.NotSupported,
+			"Only image asset can be transformed",
+		)
+		return
+	}
+
+	// the transformed image is cached for the content, which is shared
+	// by assets of identical content in a content-addressed asset store
+	transform = transform.ResolveFormat(asset.ContentType)
+	derivedName := transform.DerivedName(asset.ObjectName())
+
+	var data []byte
+	if cachedReader, cacheErr := store.GetFileReader(derivedName); cacheErr == nil {
+		data, cacheErr = ioutil.ReadAll(cachedReader)
+		cachedReader.Close()
+		if cacheErr != nil {
+			logger.WithError(cacheErr).Warnf("Failed to read cached transformed image")
+			data = nil
+		}
+	}
+
+	if data == nil {
+		if skyErr := checkImageTransformVariants(store, asset.ObjectName()); skyErr != nil {
+			logger.WithError(skyErr).Warnf("Refused to transform image")
+
+			response.Err = skyErr
+			return
+		}
+
+		reader, err := store.GetFileReader(asset.ObjectName())
+		if err != nil {
+			logger.WithError(err).Errorf("Failed to get file reader")
+
+			response.Err = skyerr.NewResourceFetchFailureErr("asset", fileName)
+			return
+		}
+
+		data, err = skyAsset.TransformImage(reader, transform)
+		reader.Close()
+		if err != nil {
+			logger.WithError(err).Errorf("Failed to transform image")
+
+			response.Err = makeImageTransformError(err)
+			return
+		}
+
+		if putErr := store.PutFileReader(
+			derivedName,
+			bytes.NewReader(data),
+			int64(len(data)),
+			transform.ContentType(),
+		); putErr != nil {
+			logger.WithError(putErr).Warnf("Failed to cache transformed image")
+		}
+	}
+
+	writer := response.Writer()
+	if writer == nil {
+		// The response is already written.
+		return
+	}
+
+	writer.Header().Set("Content-Type", transform.ContentType())
+	writer.Header().Set("Content-Length", strconv.Itoa(len(data)))
+
+	if _, err := writer.Write(data); err != nil {
+		logger.WithError(err).Errorf("Error writing file to response")
+	}
+}
+
+// checkImageTransformVariants returns an error if the maximum number of
+// transformed images are already cached for the named object, refusing
+// to transform the image in yet another way. Images are not transformed
+// in asset stores which cannot count the transformed images.
+func checkImageTransformVariants(store skyAsset.Store, name string) skyerr.Error {
+	counter, ok := store.(skyAsset.TransformedImageCounter)
+	if !ok {
+		return skyerr.NewError(
+			skyerr.NotSupported,
+			"Image transform is not supported by the asset store",
+		)
+	}
+
+	count, err := counter.CountTransformedImages(name)
+	if err != nil {
+		return skyerr.MakeError(err)
+	}
+	if count >= skyAsset.MaxImageTransformVariants {
+		return skyerr.NewErrorWithInfo(
+			skyerr.ConstraintViolated,
+			"Too many transformed images of the asset",
+			map[string]interface{}{"max": skyAsset.MaxImageTransformVariants},
+		)
+	}
+	return nil
+}
+
+// makeAssetNotServableError returns the error of serving an asset pending
+// to be scanned or found infected
+func makeAssetNotServableError(asset *skydb.Asset) skyerr.Error {
+	if asset.Status == skydb.AssetStatusInfected {
+		return skyerr.NewErrorWithInfo(
+			skyerr.PermissionDenied,
+			"Asset is infected",
+			map[string]interface{}{"status": string(asset.Status)},
+		)
+	}
+	return skyerr.NewErrorWithInfo(
+		skyerr.PermissionDenied,
+		"Asset is pending to be scanned",
+		map[string]interface{}{"status": string(asset.Status)},
+	)
+}
+
+func makeImageTransformError(err error) skyerr.Error {
+	if transformErr, ok := err.(skyAsset.InvalidImageTransformError); ok {
+		return skyerr.NewInvalidArgument(
+			transformErr.Error(),
+			[]string{transformErr.Param},
+		)
+	}
+	if err == skyAsset.ErrNotImage {
+		return skyerr.NewError(skyerr.NotSupported, "Asset cannot be transformed as an image")
+	}
+	return skyerr.NewError(skyerr.UnexpectedError, "Failed to transform image")
+}
+
+// validateContent checks the declared content type against the one
+// detected from the beginning of the content read from src
+func validateContent(policy *skyAsset.UploadPolicy, contentType string, src io.Reader) error {
+	if policy == nil || !policy.SniffContentType {
+		return nil
+	}
+
+	head := make([]byte, skyAsset.SniffLength)
+	n, err := io.ReadFull(src, head)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return err
+	}
+	return policy.ValidateContent(contentType, head[:n])
+}
+
 // UploadFileHandler receives and persists a file to be associated by Record.
 //
 // Example curl (PUT):
@@ -276,17 +490,36 @@ func (h *GetFileHandler) handleFullRangedRequest(
 //    -F 'file=@file.txt' \
 //    http://localhost:3000/files/filename
 //
+// A POST request with the Upload-Length header creates a resumable upload
+// instead, and a POST request to the URL of a resumable upload finalizes
+// it, see ResumableUploadHandler.
+//
+// The uploaded file is rejected if it violates the upload policy, see
+// asset.UploadPolicy.
+//
+// If the asset store is content-addressed, the file is stored by the hash
+// of its content, and shared by assets of identical content, see
+// asset.ContentAddressedStore.
+//
+// If asset scanning is enabled, the asset is pending until scanned, see
+// AssetScanHandler.
 type UploadFileHandler struct {
-	AssetStore    skyAsset.Store   `inject:"AssetStore"`
-	AccessKey     router.Processor `preprocessor:"accesskey"`
-	DBConn        router.Processor `preprocessor:"dbconn"`
-	preprocessors []router.Processor
+	AssetStore            skyAsset.Store         `inject:"AssetStore"`
+	AssetUploadPolicy     *skyAsset.UploadPolicy `inject:"AssetUploadPolicy"`
+	AssetContentAddressed bool                   `inject:"AssetContentAddressed"`
+	AssetScanEnabled      bool                   `inject:"AssetScanEnabled"`
+	AccessKey             router.Processor       `preprocessor:"accesskey"`
+	DBConn                router.Processor       `preprocessor:"dbconn"`
+	preprocessors         []router.Processor
 }
 
 type uploadFileRequest struct {
 	filename    string
 	contentType string
 	fileReader  io.Reader
+	// size is the size of the file declared by the client, or -1 if
+	// it is unknown
+	size int64
 }
 
 // Setup sets preprocessors being used
@@ -308,6 +541,17 @@ func (h *UploadFileHandler) Handle(
 	response *router.Response,
 ) {
 
+	if payload.Req.Method == http.MethodPost {
+		if _, ok := parseAssetUploadID(clean(payload.Params[0])); ok {
+			finalizeAssetUpload(h.AssetStore, h.AssetUploadPolicy, h.AssetContentAddressed, h.AssetScanEnabled, payload, response)
+			return
+		}
+		if isAssetUploadCreation(payload.Req) {
+			createAssetUpload(h.AssetUploadPolicy, payload, response)
+			return
+		}
+	}
+
 	logger := logging.CreateLogger(payload.Context(), "handler")
 	uploadRequest, err := parseUploadFileRequest(payload)
 	if err != nil {
@@ -323,7 +567,35 @@ func (h *UploadFileHandler) Handle(
 		return
 	}
 
-	written, tempFile, err := copyToTempFile(uploadRequest.fileReader)
+	asset := skydb.Asset{}
+	conn := payload.DBConn
+	if err := conn.GetAsset(uploadRequest.filename, &asset); err != nil {
+		// compatible with SDK <= v0.15
+		dir, file := filepath.Split(uploadRequest.filename)
+		file = strings.Join([]string{uuidNew(), file}, "-")
+
+		asset.Name = filepath.Join(dir, file)
+		asset.ContentType = uploadRequest.contentType
+	}
+
+	// the declared size is checked before the file is read, and no more
+	// than one byte over the maximum size is read otherwise
+	if uploadRequest.size >= 0 {
+		if err := h.AssetUploadPolicy.Validate(asset.ContentType, uploadRequest.size); err != nil {
+			response.Err = recordutil.MakeUploadPolicyError(err)
+			return
+		}
+	}
+	src := uploadRequest.fileReader
+	if h.AssetUploadPolicy != nil && h.AssetUploadPolicy.MaxSize > 0 {
+		src = io.LimitReader(src, h.AssetUploadPolicy.MaxSize+1)
+	}
+	src, _, err = skyAsset.StripEXIF(src, h.AssetUploadPolicy.EXIFStripping())
+	if err != nil {
+		response.Err = recordutil.MakeUploadPolicyError(err)
+		return
+	}
+	written, tempFile, err := copyToTempFile(src)
 	if err != nil {
 		response.Err = skyerr.MakeError(err)
 		return
@@ -338,33 +610,58 @@ func (h *UploadFileHandler) Handle(
 		return
 	}
 
-	asset := skydb.Asset{}
-	conn := payload.DBConn
-	if err := conn.GetAsset(uploadRequest.filename, &asset); err != nil {
-		// compatible with SDK <= v0.15
-		dir, file := filepath.Split(uploadRequest.filename)
-		file = strings.Join([]string{uuidNew(), file}, "-")
-
-		asset.Name = filepath.Join(dir, file)
-		asset.ContentType = uploadRequest.contentType
+	if err := h.AssetUploadPolicy.Validate(asset.ContentType, written); err != nil {
+		response.Err = recordutil.MakeUploadPolicyError(err)
+		return
 	}
-
-	assetStore := h.AssetStore
-	if err := assetStore.PutFileReader(
-		asset.Name,
-		tempFile,
-		written,
-		asset.ContentType,
-	); err != nil {
-
+	if err := validateContent(h.AssetUploadPolicy, asset.ContentType, tempFile); err != nil {
+		response.Err = recordutil.MakeUploadPolicyError(err)
+		return
+	}
+	if _, err := tempFile.Seek(0, io.SeekStart); err != nil {
 		response.Err = skyerr.MakeError(err)
 		return
 	}
 
+	assetStore := h.AssetStore
 	asset.Size = written
-	if err := conn.SaveAsset(&asset); err != nil {
-		response.Err = skyerr.NewResourceSaveFailureErrWithStringID("asset", asset.Name)
-		return
+	asset.Status = uploadedAssetStatus(h.AssetScanEnabled)
+	extractAssetMetadata(tempFile, &asset, logger)
+	if h.AssetContentAddressed {
+		hash, skyErr := putAssetContent(assetStore, conn, tempFile, written, asset.ContentType, logger)
+		if skyErr != nil {
+			response.Err = skyErr
+			return
+		}
+
+		asset.Hash = hash
+		if skyErr := saveContentAddressedAsset(assetStore, conn, &asset, logger); skyErr != nil {
+			response.Err = skyErr
+			return
+		}
+	} else {
+		if err := assetStore.PutFileReader(
+			asset.Name,
+			tempFile,
+			written,
+			asset.ContentType,
+		); err != nil {
+
+			response.Err = skyerr.MakeError(err)
+			return
+		}
+
+		if err := conn.SaveAsset(&asset); err != nil {
+			response.Err = skyerr.NewResourceSaveFailureErrWithStringID("asset", asset.Name)
+			return
+		}
+	}
+
+	if h.AssetScanEnabled {
+		if skyErr := scheduleAssetScan(conn, asset.Name, timeNow(), logger); skyErr != nil {
+			response.Err = skyErr
+			return
+		}
 	}
 
 	if signer, ok := h.AssetStore.(skyAsset.URLSigner); ok {
@@ -387,6 +684,7 @@ func parseUploadFileRequest(payload *router.Payload) (*uploadFileRequest, error)
 	var (
 		filename, contentType string
 		fileReader            io.ReadCloser
+		size                  int64
 	)
 
 	if method == http.MethodPost {
@@ -412,6 +710,7 @@ func parseUploadFileRequest(payload *router.Payload) (*uploadFileRequest, error)
 
 		filename = clean(payload.Params[0])
 		contentType = firstFileHeader.Header["Content-Type"][0]
+		size = firstFileHeader.Size
 		fileReader, err = firstFileHeader.Open()
 		if err != nil {
 			return nil, err
@@ -420,6 +719,7 @@ func parseUploadFileRequest(payload *router.Payload) (*uploadFileRequest, error)
 		filename = clean(payload.Params[0])
 		contentType = httpRequest.Header.Get("Content-Type")
 		fileReader = httpRequest.Body
+		size = httpRequest.ContentLength
 	} else {
 		return nil, errors.New(
 			"Method " + method + " is not supported",
@@ -430,6 +730,7 @@ func parseUploadFileRequest(payload *router.Payload) (*uploadFileRequest, error)
 		filename:    filename,
 		contentType: contentType,
 		fileReader:  fileReader,
+		size:        size,
 	}, nil
 }
 
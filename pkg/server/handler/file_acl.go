@@ -0,0 +1,215 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"reflect"
+	"sort"
+	"sync"
+
+	skyAsset "github.com/skygeario/skygear-server/pkg/server/asset"
+	"github.com/skygeario/skygear-server/pkg/server/router"
+	"github.com/skygeario/skygear-server/pkg/server/skydb"
+	"github.com/skygeario/skygear-server/pkg/server/skyerr"
+)
+
+// checkAssetRecordACL checks whether the requester can read a record
+// referencing the asset, if record ACL is required by the asset store.
+// The URL of the asset is signed for userID, which has to be the
+// requester, see asset.UserURLSigner.
+func checkAssetRecordACL(payload *router.Payload, name string, userID string) skyerr.Error {
+	if payload.HasMasterKey() {
+		return nil
+	}
+
+	// the URL signed for a user is not valid for other users, so that
+	// an asset cannot be shared by copying its URL
+	authInfo := payload.AuthInfo
+	requesterID := ""
+	if authInfo != nil {
+		requesterID = authInfo.ID
+	}
+	if requesterID != userID {
+		return skyerr.NewError(skyerr.PermissionDenied, "Access denied")
+	}
+
+	accessible, err := isAssetAccessible(payload.DBConn, name, authInfo)
+	if err != nil {
+		return skyerr.MakeError(err)
+	}
+	if !accessible {
+		return skyerr.NewError(skyerr.PermissionDenied, "Access denied")
+	}
+	return nil
+}
+
+// checkAssetSignatureOrRecordACL checks whether the requester has access
+// to the asset in an asset store requiring signatures, by holding a valid
+// signature of the asset URL, or by reading a record referencing the
+// asset. Assets in a public asset store are accessible to everyone.
+func checkAssetSignatureOrRecordACL(
+	assetStore skyAsset.Store,
+	payload *router.Payload,
+	name string,
+	expiredAtUnix int64,
+	signature string,
+) skyerr.Error {
+	if payload.HasMasterKey() {
+		return nil
+	}
+
+	signer, ok := assetStore.(skyAsset.URLSigner)
+	if !ok || !signer.IsSignatureRequired() {
+		return nil
+	}
+
+	if signature != "" {
+		return validateAssetGetRequest(assetStore, name, expiredAtUnix, signature)
+	}
+
+	accessible, err := isAssetAccessible(payload.DBConn, name, payload.AuthInfo)
+	if err != nil {
+		return skyerr.MakeError(err)
+	}
+	if !accessible {
+		return skyerr.NewError(skyerr.PermissionDenied, "Access denied")
+	}
+	return nil
+}
+
+// assetColumnsCache caches the asset columns of the record types, so that
+// the record schemas are not resolved on every asset request. The record
+// schemas are shared by the public and private databases.
+type assetColumnsCache struct {
+	mutex   sync.Mutex
+	columns map[string][]string
+}
+
+var cachedAssetColumns = &assetColumnsCache{}
+
+// get returns the cached asset columns, resolving them if not cached.
+func (c *assetColumnsCache) get(db skydb.Database) (map[string][]string, error) {
+	c.mutex.Lock()
+	columns := c.columns
+	c.mutex.Unlock()
+	if columns != nil {
+		return columns, nil
+	}
+
+	columns, _, err := c.refresh(db)
+	return columns, err
+}
+
+// refresh resolves the asset columns again, and reports whether they
+// changed since last resolved.
+func (c *assetColumnsCache) refresh(db skydb.Database) (map[string][]string, bool, error) {
+	columns, err := queryAssetColumns(db)
+	if err != nil {
+		return nil, false, err
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	changed := !reflect.DeepEqual(c.columns, columns)
+	c.columns = columns
+	return columns, changed, nil
+}
+
+// isAssetAccessible returns whether the named asset is referenced by a
+// record readable by the user, which is either a public record permitted
+// by its ACL, or a private record of the user. A nil authInfo is for a
+// user not logged in.
+//
+// The asset columns are cached. They are resolved again if the asset is
+// not found with the cached columns, in case the record schemas have
+// changed since.
+func isAssetAccessible(conn skydb.Conn, name string, authInfo *skydb.AuthInfo) (bool, error) {
+	dbs := []skydb.Database{conn.PublicDB()}
+	if authInfo != nil {
+		dbs = append(dbs, conn.PrivateDB(authInfo.ID))
+	}
+
+	assetColumns, err := cachedAssetColumns.get(conn.PublicDB())
+	if err != nil {
+		return false, err
+	}
+
+	accessible, err := queryAssetReferenced(dbs, assetColumns, name, authInfo)
+	if accessible {
+		return true, nil
+	}
+
+	assetColumns, changed, refreshErr := cachedAssetColumns.refresh(conn.PublicDB())
+	if refreshErr != nil {
+		return false, refreshErr
+	}
+	if !changed {
+		return false, err
+	}
+	return queryAssetReferenced(dbs, assetColumns, name, authInfo)
+}
+
+// queryAssetReferenced returns whether the named asset is referenced in
+// the asset columns by a record in the databases readable by the user.
+func queryAssetReferenced(dbs []skydb.Database, assetColumns map[string][]string, name string, authInfo *skydb.AuthInfo) (bool, error) {
+	recordTypes := []string{}
+	for recordType := range assetColumns {
+		recordTypes = append(recordTypes, recordType)
+	}
+	sort.Strings(recordTypes)
+
+	accessControlOptions := &skydb.AccessControlOptions{
+		ViewAsUser: authInfo,
+	}
+	for _, db := range dbs {
+		for _, recordType := range recordTypes {
+			query := skydb.Query{
+				Type:      recordType,
+				Predicate: assetReferencePredicate(assetColumns[recordType], name),
+			}
+			count, err := db.QueryCount(&query, accessControlOptions)
+			if err != nil {
+				return false, err
+			}
+			if count > 0 {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+// assetReferencePredicate returns the predicate of records referencing
+// the named asset in any of the asset columns
+func assetReferencePredicate(columns []string, name string) skydb.Predicate {
+	predicates := []interface{}{}
+	for _, column := range columns {
+		predicates = append(predicates, skydb.Predicate{
+			Operator: skydb.Equal,
+			Children: []interface{}{
+				skydb.Expression{Type: skydb.KeyPath, Value: column},
+				skydb.Expression{Type: skydb.Literal, Value: name},
+			},
+		})
+	}
+
+	if len(predicates) == 1 {
+		return predicates[0].(skydb.Predicate)
+	}
+	return skydb.Predicate{
+		Operator: skydb.Or,
+		Children: predicates,
+	}
+}
@@ -0,0 +1,235 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/skygeario/skygear-server/pkg/server/asset"
+	"github.com/skygeario/skygear-server/pkg/server/router"
+	"github.com/skygeario/skygear-server/pkg/server/skydb"
+	. "github.com/skygeario/skygear-server/pkg/server/skytest"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// aclAssetDatabase counts the records referencing assets as readable by
+// the users in readers, simulating the record ACL
+type aclAssetDatabase struct {
+	skydb.Database
+	schemas       map[string]skydb.RecordSchema
+	schemaQueries int
+	readers       map[string]bool
+	queries       []skydb.Query
+}
+
+func (db *aclAssetDatabase) GetRecordSchemas() (map[string]skydb.RecordSchema, error) {
+	db.schemaQueries++
+	return db.schemas, nil
+}
+
+func (db *aclAssetDatabase) QueryCount(query *skydb.Query, accessControlOptions *skydb.AccessControlOptions) (uint64, error) {
+	db.queries = append(db.queries, *query)
+	if _, ok := db.schemas[query.Type]; !ok {
+		return 0, errors.New("record type not found")
+	}
+	userID := ""
+	if accessControlOptions.ViewAsUser != nil {
+		userID = accessControlOptions.ViewAsUser.ID
+	}
+	if db.readers[userID] {
+		return 1, nil
+	}
+	return 0, nil
+}
+
+type aclAssetConn struct {
+	skydb.Conn
+	publicDB  *aclAssetDatabase
+	privateDB *aclAssetDatabase
+}
+
+func (c *aclAssetConn) GetAsset(name string, asset *skydb.Asset) error {
+	*asset = skydb.Asset{
+		Name:        name,
+		ContentType: "text/plain",
+		Size:        10,
+	}
+	return nil
+}
+
+func (c *aclAssetConn) PublicDB() skydb.Database {
+	return c.publicDB
+}
+
+func (c *aclAssetConn) PrivateDB(userKey string) skydb.Database {
+	return c.privateDB
+}
+
+func TestGetFileHandlerWithRecordACL(t *testing.T) {
+	Convey("GetFileHandler with record ACL", t, func() {
+		dir, err := ioutil.TempDir("", "skygear-asset")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		store := asset.NewRecordACLFileStore(dir, "http://skygear.test", "secret")
+		So(store.PutFileReader("note.txt", strings.NewReader("I am a boy"), 10, "text/plain"), ShouldBeNil)
+		userSigner := store.(asset.UserURLSigner)
+
+		schemas := map[string]skydb.RecordSchema{
+			"note": skydb.RecordSchema{
+				"attachment": skydb.FieldType{Type: skydb.TypeAsset},
+				"content":    skydb.FieldType{Type: skydb.TypeString},
+			},
+		}
+		conn := &aclAssetConn{
+			publicDB: &aclAssetDatabase{
+				schemas: schemas,
+				readers: map[string]bool{},
+			},
+			privateDB: &aclAssetDatabase{
+				schemas: schemas,
+				readers: map[string]bool{},
+			},
+		}
+
+		cachedAssetColumns = &assetColumnsCache{}
+
+		var authInfo *skydb.AuthInfo
+		accessKey := router.ClientAccessKey
+		r := newmodGateway("(.+)")
+		r.Handle("GET", &GetFileHandler{
+			AssetStore: store,
+		}, func(p *router.Payload) {
+			p.DBConn = conn
+			p.AuthInfo = authInfo
+			p.AccessKey = accessKey
+		})
+
+		get := func(userID string) string {
+			signedURL, signErr := userSigner.SignedURLForUser("note.txt", nil, userID)
+			So(signErr, ShouldBeNil)
+			req, _ := http.NewRequest("GET", signedURL, nil)
+			resp := r.Do(req)
+			return resp.Body.String()
+		}
+		accessDenied := `{
+			"error": {
+				"code": 102,
+				"name": "PermissionDenied",
+				"message": "Access denied"
+			}
+		}`
+
+		Convey("serves asset of record readable by the user", func() {
+			authInfo = &skydb.AuthInfo{ID: "user-id"}
+			conn.publicDB.readers["user-id"] = true
+
+			So(get("user-id"), ShouldEqual, "I am a boy")
+			So(conn.publicDB.queries, ShouldResemble, []skydb.Query{{
+				Type: "note",
+				Predicate: skydb.Predicate{
+					Operator: skydb.Equal,
+					Children: []interface{}{
+						skydb.Expression{Type: skydb.KeyPath, Value: "attachment"},
+						skydb.Expression{Type: skydb.Literal, Value: "note.txt"},
+					},
+				},
+			}})
+		})
+
+		Convey("serves asset of private record of the user", func() {
+			authInfo = &skydb.AuthInfo{ID: "user-id"}
+			conn.privateDB.readers["user-id"] = true
+
+			So(get("user-id"), ShouldEqual, "I am a boy")
+		})
+
+		Convey("serves asset of public record to user not logged in", func() {
+			conn.publicDB.readers[""] = true
+
+			So(get(""), ShouldEqual, "I am a boy")
+			So(conn.privateDB.queries, ShouldBeEmpty)
+		})
+
+		Convey("serves asset to master key", func() {
+			accessKey = router.MasterAccessKey
+
+			So(get(""), ShouldEqual, "I am a boy")
+			So(conn.publicDB.queries, ShouldBeEmpty)
+		})
+
+		Convey("errors if no record is readable by the user", func() {
+			authInfo = &skydb.AuthInfo{ID: "user-id"}
+			conn.publicDB.readers["another-user-id"] = true
+
+			So(get("user-id"), ShouldEqualJSON, accessDenied)
+			So(conn.privateDB.queries, ShouldHaveLength, 1)
+		})
+
+		Convey("resolves asset columns once", func() {
+			conn.publicDB.readers[""] = true
+
+			So(get(""), ShouldEqual, "I am a boy")
+			So(get(""), ShouldEqual, "I am a boy")
+			So(conn.publicDB.schemaQueries, ShouldEqual, 1)
+		})
+
+		Convey("resolves asset columns again if record schemas changed", func() {
+			conn.publicDB.readers[""] = true
+			So(get(""), ShouldEqual, "I am a boy")
+
+			conn.publicDB.schemas = map[string]skydb.RecordSchema{
+				"photo": skydb.RecordSchema{
+					"image": skydb.FieldType{Type: skydb.TypeAsset},
+				},
+			}
+			conn.publicDB.queries = nil
+
+			So(get(""), ShouldEqual, "I am a boy")
+			So(conn.publicDB.schemaQueries, ShouldEqual, 2)
+			So(conn.publicDB.queries, ShouldHaveLength, 2)
+			So(conn.publicDB.queries[1].Type, ShouldEqual, "photo")
+		})
+
+		Convey("errors if URL is signed for another user", func() {
+			authInfo = &skydb.AuthInfo{ID: "another-user-id"}
+			conn.publicDB.readers["user-id"] = true
+			conn.publicDB.readers["another-user-id"] = true
+
+			So(get("user-id"), ShouldEqualJSON, accessDenied)
+		})
+
+		Convey("errors if URL signed for user is requested without token", func() {
+			conn.publicDB.readers["user-id"] = true
+
+			So(get("user-id"), ShouldEqualJSON, accessDenied)
+		})
+
+		Convey("errors if URL is not signed for user", func() {
+			conn.publicDB.readers[""] = true
+			signedURL, signErr := userSigner.SignedURLForUser("note.txt", nil, "")
+			So(signErr, ShouldBeNil)
+
+			req, _ := http.NewRequest("GET", strings.Replace(signedURL, "&user_id=", "", 1), nil)
+			resp := r.Do(req)
+			So(resp.Body.String(), ShouldEqualJSON, accessDenied)
+		})
+	})
+}
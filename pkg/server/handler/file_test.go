@@ -17,10 +17,15 @@ package handler
 import (
 	"bytes"
 	"fmt"
+	"image"
+	"image/png"
 	"io"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
 	"strings"
 	"testing"
 	"time"
@@ -129,6 +134,10 @@ func (store *bufferedAssetStore) PutFileReader(name string, src io.Reader, lengt
 	return nil
 }
 
+func (store *bufferedAssetStore) Delete(name string) error {
+	panic("not implemented")
+}
+
 func (store *bufferedAssetStore) GeneratePostFileRequest(name string, contentType string, length int64) (*asset.PostFileRequest, error) {
 	return &asset.PostFileRequest{
 		Action: "http://skygear.test/files/" + name,
@@ -248,6 +257,28 @@ func TestUploadFileHandler(t *testing.T) {
 			}`)
 		})
 
+		Convey("errors on JPEG metadata too large to be stripped", func() {
+			// SOI followed by comment segments of 65000 bytes
+			body := bytes.Buffer{}
+			body.Write([]byte{0xFF, 0xD8})
+			for i := 0; i < 17; i++ {
+				body.Write([]byte{0xFF, 0xFE, 0xFD, 0xEA})
+				body.Write(make([]byte, 65000))
+			}
+			req, _ := http.NewRequest("PUT", "http://skygear.test/asset", &body)
+			req.Header.Set("Content-Type", "image/jpeg")
+			resp := r.Do(req)
+
+			So(resp.Body.String(), ShouldEqualJSON, `{
+				"error": {
+					"code": 108,
+					"name": "InvalidArgument",
+					"message": "Asset has metadata too large to be stripped"
+				}
+			}`)
+			So(store.name, ShouldEqual, "")
+		})
+
 		Convey("errors reading zero-byte body", func() {
 			req, _ := http.NewRequest("PUT", "http://skygear.test/asset", strings.NewReader(``))
 			req.Header.Set("Content-Type", "plain/text")
@@ -262,6 +293,121 @@ func TestUploadFileHandler(t *testing.T) {
 			}`)
 		})
 	})
+
+	Convey("UploadFileHandler with upload policy", t, func() {
+		assetConn := &naiveAssetConn{}
+		assetConn.savedAsset = map[string]*skydb.Asset{}
+
+		store := newBufferedStore()
+
+		r := newmodGateway("(.+)")
+		r.Handle("PUT", &UploadFileHandler{
+			AssetStore: store,
+			AssetUploadPolicy: &asset.UploadPolicy{
+				FieldUploadPolicy: asset.FieldUploadPolicy{
+					MaxSize:      16,
+					ContentTypes: []string{"text/*", "image/png"},
+				},
+				SniffContentType: true,
+			},
+		}, func(p *router.Payload) {
+			p.DBConn = assetConn
+		})
+
+		upload := func(contentType string, body string) *httptest.ResponseRecorder {
+			assetConn.savedAsset["asset"] = &skydb.Asset{
+				Name:        "asset",
+				ContentType: contentType,
+			}
+			req, _ := http.NewRequest("PUT", "http://skygear.test/asset", strings.NewReader(body))
+			req.Header.Set("Content-Type", contentType)
+			return r.Do(req)
+		}
+
+		Convey("uploads a file conforming to the policy", func() {
+			resp := upload("text/plain", "I am a boy")
+			So(resp.Code, ShouldEqual, http.StatusOK)
+			So(store.buf.String(), ShouldEqual, "I am a boy")
+		})
+
+		Convey("errors on file too large", func() {
+			resp := upload("text/plain", "I am a boy and I am reading")
+			So(resp.Code, ShouldEqual, http.StatusRequestEntityTooLarge)
+			So(resp.Body.String(), ShouldEqualJSON, `{
+				"error": {
+					"code": 129,
+					"name": "AssetSizeTooLarge",
+					"message": "Asset is larger than 16 bytes",
+					"info": {
+						"max_size": 16
+					}
+				}
+			}`)
+			So(store.name, ShouldEqual, "")
+		})
+
+		Convey("errors on file too large without reading it", func() {
+			assetConn.savedAsset["asset"] = &skydb.Asset{
+				Name:        "asset",
+				ContentType: "text/plain",
+			}
+			body := &countingReader{Reader: strings.NewReader(strings.Repeat("I am a boy. ", 100))}
+			req, _ := http.NewRequest("PUT", "http://skygear.test/asset", body)
+			req.Header.Set("Content-Type", "text/plain")
+
+			Convey("of declared length", func() {
+				req.ContentLength = 1200
+				resp := r.Do(req)
+				So(resp.Code, ShouldEqual, http.StatusRequestEntityTooLarge)
+				So(body.read, ShouldEqual, 0)
+				So(store.name, ShouldEqual, "")
+			})
+
+			Convey("of unknown length", func() {
+				req.ContentLength = -1
+				resp := r.Do(req)
+				So(resp.Code, ShouldEqual, http.StatusRequestEntityTooLarge)
+				So(body.read, ShouldBeLessThanOrEqualTo, 17)
+				So(store.name, ShouldEqual, "")
+			})
+		})
+
+		Convey("errors on content type not allowed", func() {
+			resp := upload("application/pdf", "%PDF-1.4")
+			So(resp.Body.String(), ShouldEqualJSON, `{
+				"error": {
+					"code": 108,
+					"name": "InvalidArgument",
+					"message": "Asset of content type application/pdf is not allowed"
+				}
+			}`)
+			So(store.name, ShouldEqual, "")
+		})
+
+		Convey("errors on content not matching the content type", func() {
+			resp := upload("image/png", "<html></html>")
+			So(resp.Body.String(), ShouldEqualJSON, `{
+				"error": {
+					"code": 108,
+					"name": "InvalidArgument",
+					"message": "Asset of content type image/png has content of text/html"
+				}
+			}`)
+			So(store.name, ShouldEqual, "")
+		})
+	})
+}
+
+// countingReader counts the bytes read from the reader
+type countingReader struct {
+	io.Reader
+	read int
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.Reader.Read(p)
+	r.read += n
+	return n, err
 }
 
 type naiveStoreSignatureParser struct {
@@ -374,3 +520,158 @@ func TestGetFileHandler(t *testing.T) {
 		})
 	})
 }
+
+func encodeTestPNG(width int, height int) []byte {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	buf := bytes.Buffer{}
+	png.Encode(&buf, img)
+	return buf.Bytes()
+}
+
+func TestGetFileHandlerWithTransform(t *testing.T) {
+	Convey("GetFileHandler with image transform", t, func() {
+		dir, err := ioutil.TempDir("", "skygear-asset")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		store := asset.NewFileStore(dir, "http://skygear.test/files", "secret", false)
+		signer := store.(asset.TransformURLSigner)
+		signedPath := func(name string, transform asset.ImageTransform) string {
+			signedURL, signErr := signer.SignedTransformURL(name, transform)
+			So(signErr, ShouldBeNil)
+			return strings.TrimPrefix(signedURL, "http://skygear.test/files/")
+		}
+
+		src := encodeTestPNG(40, 20)
+		So(store.PutFileReader("photo.png", bytes.NewReader(src), int64(len(src)), "image/png"), ShouldBeNil)
+		So(store.PutFileReader("note.txt", strings.NewReader("I am a boy"), 10, "text/plain"), ShouldBeNil)
+
+		assetConn := &naiveAssetConn{}
+		assetConn.savedAsset = map[string]*skydb.Asset{
+			"photo.png": &skydb.Asset{
+				Name:        "photo.png",
+				ContentType: "image/png",
+				Size:        int64(len(src)),
+			},
+			"note.txt": &skydb.Asset{
+				Name:        "note.txt",
+				ContentType: "text/plain",
+				Size:        10,
+			},
+		}
+
+		r := newmodGateway("(.+)")
+		r.Handle("GET", &GetFileHandler{
+			AssetStore: store,
+		}, func(p *router.Payload) {
+			p.DBConn = assetConn
+		})
+
+		Convey("serves and caches transformed image", func() {
+			transform := asset.ImageTransform{Width: 10, Format: asset.ImageFormatJPEG}
+			resp := r.GET(signedPath("photo.png", transform))
+			So(resp.Code, ShouldEqual, http.StatusOK)
+			So(resp.Header().Get("Content-Type"), ShouldEqual, "image/jpeg")
+			So(resp.Header().Get("Content-Length"), ShouldEqual, strconv.Itoa(resp.Body.Len()))
+
+			config, format, decodeErr := image.DecodeConfig(resp.Body)
+			So(decodeErr, ShouldBeNil)
+			So(format, ShouldEqual, "jpeg")
+			So(config.Width, ShouldEqual, 10)
+			So(config.Height, ShouldEqual, 5)
+
+			cached, readErr := ioutil.ReadFile(filepath.Join(dir, transform.DerivedName("photo.png")))
+			So(readErr, ShouldBeNil)
+
+			resp = r.GET(signedPath("photo.png", transform))
+			So(resp.Code, ShouldEqual, http.StatusOK)
+			So(resp.Body.Bytes(), ShouldResemble, cached)
+		})
+
+		Convey("keeps original format if not specified", func() {
+			resp := r.GET(signedPath("photo.png", asset.ImageTransform{Height: 10}))
+			So(resp.Code, ShouldEqual, http.StatusOK)
+			So(resp.Header().Get("Content-Type"), ShouldEqual, "image/png")
+		})
+
+		Convey("errors if transform is altered", func() {
+			path := signedPath("photo.png", asset.ImageTransform{Width: 10})
+			resp := r.GET(strings.Replace(path, "width=10", "width=400", 1))
+			So(resp.Body.String(), ShouldEqualJSON, `{
+				"error": {
+					"code": 106,
+					"name": "InvalidSignature",
+					"message": "Invalid signature"
+				}
+			}`)
+		})
+
+		Convey("errors on invalid transform", func() {
+			resp := r.GET("photo.png?width=abc")
+			So(resp.Body.String(), ShouldEqualJSON, `{
+				"error": {
+					"code": 108,
+					"name": "InvalidArgument",
+					"message": "Image transform width must be an integer between 1 and 4096",
+					"info": {
+						"arguments": ["width"]
+					}
+				}
+			}`)
+		})
+
+		Convey("errors if too many transformed images are cached", func() {
+			for width := 1; width <= asset.MaxImageTransformVariants; width++ {
+				resp := r.GET(signedPath("photo.png", asset.ImageTransform{Width: width}))
+				So(resp.Code, ShouldEqual, http.StatusOK)
+			}
+
+			resp := r.GET(signedPath("photo.png", asset.ImageTransform{Width: 30}))
+			So(resp.Body.String(), ShouldEqualJSON, `{
+				"error": {
+					"code": 113,
+					"name": "ConstraintViolated",
+					"message": "Too many transformed images of the asset",
+					"info": {
+						"max": 20
+					}
+				}
+			}`)
+
+			resp = r.GET(signedPath("photo.png", asset.ImageTransform{Width: 1}))
+			So(resp.Code, ShouldEqual, http.StatusOK)
+		})
+
+		Convey("errors if asset store cannot count transformed images", func() {
+			r := newmodGateway("(.+)")
+			r.Handle("GET", &GetFileHandler{
+				AssetStore: struct {
+					asset.URLSignerStore
+					asset.SignatureParser
+				}{store.(asset.URLSignerStore), store.(asset.SignatureParser)},
+			}, func(p *router.Payload) {
+				p.DBConn = assetConn
+			})
+
+			resp := r.GET(signedPath("photo.png", asset.ImageTransform{Width: 10}))
+			So(resp.Body.String(), ShouldEqualJSON, `{
+				"error": {
+					"code": 111,
+					"name": "NotSupported",
+					"message": "Image transform is not supported by the asset store"
+				}
+			}`)
+		})
+
+		Convey("errors on transforming non-image", func() {
+			resp := r.GET(signedPath("note.txt", asset.ImageTransform{Width: 10}))
+			So(resp.Body.String(), ShouldEqualJSON, `{
+				"error": {
+					"code": 111,
+					"name": "NotSupported",
+					"message": "Only image asset can be transformed"
+				}
+			}`)
+		})
+	})
+}
@@ -0,0 +1,671 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mitchellh/mapstructure"
+	"github.com/sirupsen/logrus"
+
+	skyAsset "github.com/skygeario/skygear-server/pkg/server/asset"
+	"github.com/skygeario/skygear-server/pkg/server/logging"
+	"github.com/skygeario/skygear-server/pkg/server/recordutil"
+	"github.com/skygeario/skygear-server/pkg/server/router"
+	"github.com/skygeario/skygear-server/pkg/server/skydb"
+	"github.com/skygeario/skygear-server/pkg/server/skydb/skyconv"
+	"github.com/skygeario/skygear-server/pkg/server/skyerr"
+)
+
+// assetUploadExpiry is the period after which a resumable upload not
+// updated is abandoned, and deleted by the asset gc
+const assetUploadExpiry = 7 * 24 * time.Hour
+
+// assetUploadPrefix is the path under /files/ of the resumable uploads,
+// which is also the prefix of the names of the uploaded chunks in the
+// asset store
+const assetUploadPrefix = "_uploads"
+
+// assetUploadPath returns the path under /files/ of the resumable upload
+func assetUploadPath(id string) string {
+	return path.Join(assetUploadPrefix, id)
+}
+
+// parseAssetUploadID returns the ID of the resumable upload if the path
+// under /files/ is the one of a resumable upload
+func parseAssetUploadID(filePath string) (string, bool) {
+	dir, id := path.Split(filePath)
+	if dir != assetUploadPrefix+"/" || id == "" {
+		return "", false
+	}
+	return id, true
+}
+
+func isAssetUploadCreation(req *http.Request) bool {
+	return req.Header.Get("Upload-Length") != ""
+}
+
+func assetUploadToMap(upload *skydb.AssetUpload) map[string]interface{} {
+	return map[string]interface{}{
+		"id":           upload.ID,
+		"name":         upload.Name,
+		"content_type": upload.ContentType,
+		"length":       upload.Length,
+		"offset":       upload.Offset,
+		"url":          "/files/" + assetUploadPath(upload.ID),
+	}
+}
+
+func makeAssetUploadNotFoundError(id string) skyerr.Error {
+	return skyerr.NewErrorWithInfo(
+		skyerr.ResourceNotFound,
+		fmt.Sprintf(`cannot find upload "%s"`, id),
+		map[string]interface{}{"id": id},
+	)
+}
+
+func makeAssetUploadOffsetError(offset int64) skyerr.Error {
+	return skyerr.NewErrorWithInfo(
+		skyerr.ConstraintViolated,
+		"upload offset does not match",
+		map[string]interface{}{"offset": offset},
+	)
+}
+
+// getAssetUpload returns the resumable upload at the path under /files/
+func getAssetUpload(conn skydb.Conn, filePath string) (*skydb.AssetUpload, skyerr.Error) {
+	id, ok := parseAssetUploadID(filePath)
+	if !ok {
+		return nil, makeAssetUploadNotFoundError(filePath)
+	}
+
+	upload := skydb.AssetUpload{}
+	if err := conn.GetAssetUpload(id, &upload); err == skydb.ErrAssetUploadNotFound {
+		return nil, makeAssetUploadNotFoundError(id)
+	} else if err != nil {
+		return nil, skyerr.MakeError(err)
+	}
+	return &upload, nil
+}
+
+// createAssetUpload creates a resumable upload of the file of length
+// specified in the Upload-Length header.
+func createAssetUpload(
+	policy *skyAsset.UploadPolicy,
+	payload *router.Payload,
+	response *router.Response,
+) {
+	req := payload.Req
+	length, err := strconv.ParseInt(req.Header.Get("Upload-Length"), 10, 64)
+	if err != nil || length <= 0 {
+		response.Err = skyerr.NewError(
+			skyerr.InvalidArgument,
+			"Upload-Length must be a positive integer",
+		)
+		return
+	}
+
+	contentType := req.Header.Get("Content-Type")
+	if contentType == "" {
+		response.Err = skyerr.NewError(
+			skyerr.InvalidArgument,
+			"Content-Type cannot be empty",
+		)
+		return
+	}
+
+	if policyErr := policy.Validate(contentType, length); policyErr != nil {
+		response.Err = recordutil.MakeUploadPolicyError(policyErr)
+		return
+	}
+
+	dir, file := filepath.Split(clean(payload.Params[0]))
+	file = strings.Join([]string{uuidNew(), file}, "-")
+
+	now := timeNow()
+	upload := skydb.AssetUpload{
+		ID:          uuidNew(),
+		Name:        filepath.Join(dir, file),
+		ContentType: contentType,
+		Length:      length,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	if err := payload.DBConn.CreateAssetUpload(&upload); err != nil {
+		response.Err = skyerr.MakeError(err)
+		return
+	}
+
+	response.Result = assetUploadToMap(&upload)
+}
+
+type completedPartsPayload struct {
+	Parts []skyAsset.CompletedPart `mapstructure:"parts"`
+}
+
+func (payload *completedPartsPayload) Decode(data map[string]interface{}) skyerr.Error {
+	if err := mapstructure.Decode(data, payload); err != nil {
+		return skyerr.NewError(skyerr.BadRequest, "fails to decode the request payload")
+	}
+	return payload.Validate()
+}
+
+func (payload *completedPartsPayload) Validate() skyerr.Error {
+	if len(payload.Parts) == 0 {
+		return skyerr.NewInvalidArgument("empty parts", []string{"parts"})
+	}
+	for _, part := range payload.Parts {
+		if part.PartNumber <= 0 || part.ETag == "" {
+			return skyerr.NewInvalidArgument(
+				"part must have part-number and etag",
+				[]string{"parts"},
+			)
+		}
+	}
+	return nil
+}
+
+// finalizeAssetUpload saves the file of a completed resumable upload as
+// an asset. For an upload done directly to the asset store in parts, the
+// ETags of the parts are read from the request body.
+func finalizeAssetUpload(
+	assetStore skyAsset.Store,
+	policy *skyAsset.UploadPolicy,
+	contentAddressed bool,
+	scanEnabled bool,
+	payload *router.Payload,
+	response *router.Response,
+) {
+	logger := logging.CreateLogger(payload.Context(), "handler")
+	conn := payload.DBConn
+	upload, skyErr := getAssetUpload(conn, clean(payload.Params[0]))
+	if skyErr != nil {
+		response.Err = skyErr
+		return
+	}
+
+	hash := ""
+	if upload.MultipartUploadID != "" {
+		skyErr = completeMultipartUpload(assetStore, conn, upload, payload.Req.Body, logger)
+	} else {
+		hash, skyErr = assembleAssetUploadChunks(assetStore, conn, upload, contentAddressed, policy.EXIFStripping(), logger)
+	}
+	if skyErr != nil {
+		response.Err = skyErr
+		return
+	}
+
+	asset := skydb.Asset{
+		Name:        upload.Name,
+		ContentType: upload.ContentType,
+		Size:        upload.Length,
+		Hash:        hash,
+		Status:      uploadedAssetStatus(scanEnabled),
+	}
+	if skyErr = validateStoredContent(assetStore, conn, policy, &asset, logger); skyErr != nil {
+		if err := conn.DeleteAssetUpload(upload.ID); err != nil {
+			logger.WithError(err).Warnf("Failed to delete rejected upload %s", upload.ID)
+		}
+		response.Err = skyErr
+		return
+	}
+	if upload.MultipartUploadID != "" {
+		if skyErr = stripUploadedEXIF(assetStore, policy.EXIFStripping(), &asset, logger); skyErr != nil {
+			if err := conn.DeleteAssetUpload(upload.ID); err != nil {
+				logger.WithError(err).Warnf("Failed to delete unstripped upload %s", upload.ID)
+			}
+			response.Err = skyErr
+			return
+		}
+	}
+	extractStoredAssetMetadata(assetStore, &asset, logger)
+
+	if hash != "" {
+		skyErr = saveContentAddressedAsset(assetStore, conn, &asset, logger)
+	} else if err := conn.SaveAsset(&asset); err != nil {
+		skyErr = skyerr.NewResourceSaveFailureErrWithStringID("asset", asset.Name)
+	}
+	if skyErr != nil {
+		response.Err = skyErr
+		return
+	}
+	if err := conn.DeleteAssetUpload(upload.ID); err != nil {
+		logger.WithError(err).Warnf("Failed to delete finalized upload %s", upload.ID)
+	}
+	if scanEnabled {
+		if skyErr := scheduleAssetScan(conn, asset.Name, timeNow(), logger); skyErr != nil {
+			response.Err = skyErr
+			return
+		}
+	}
+
+	if signer, ok := assetStore.(skyAsset.URLSigner); ok {
+		asset.Signer = signer
+	} else {
+		logger.Warnf("Failed to acquire asset URLSigner, please check configuration")
+		response.Err = skyerr.NewError(skyerr.UnexpectedError, "Failed to sign the url")
+		return
+	}
+	response.Result = skyconv.ToMap((*skyconv.MapAsset)(&asset))
+}
+
+// validateStoredContent sniffs the stored content of the asset, which is
+// deleted if it violates the upload policy. Content stored by hash is
+// only deleted if it is not referenced by other assets.
+func validateStoredContent(
+	assetStore skyAsset.Store,
+	conn skydb.Conn,
+	policy *skyAsset.UploadPolicy,
+	asset *skydb.Asset,
+	logger *logrus.Entry,
+) skyerr.Error {
+	if policy == nil || !policy.SniffContentType {
+		return nil
+	}
+
+	reader, err := assetStore.GetFileReader(asset.ObjectName())
+	if err != nil {
+		logger.WithError(err).Errorf("Failed to get asset %s", asset.Name)
+		return skyerr.NewResourceFetchFailureErr("asset", asset.Name)
+	}
+	err = validateContent(policy, asset.ContentType, reader)
+	reader.Close()
+	if err == nil {
+		return nil
+	}
+
+	if asset.Hash != "" {
+		releaseAssetContent(assetStore, conn, asset.Hash, logger)
+	} else if deleteErr := assetStore.Delete(asset.Name); deleteErr != nil {
+		logger.WithError(deleteErr).Warnf("Failed to delete rejected asset %s", asset.Name)
+	}
+	return recordutil.MakeUploadPolicyError(err)
+}
+
+func completeMultipartUpload(
+	assetStore skyAsset.Store,
+	conn skydb.Conn,
+	upload *skydb.AssetUpload,
+	body io.Reader,
+	logger *logrus.Entry,
+) skyerr.Error {
+	uploader, ok := assetStore.(skyAsset.FileMultipartUploader)
+	if !ok {
+		return skyerr.NewError(
+			skyerr.NotSupported,
+			"Multipart upload is not supported by the asset store",
+		)
+	}
+
+	data := map[string]interface{}{}
+	if err := json.NewDecoder(body).Decode(&data); err != nil {
+		return skyerr.NewError(skyerr.BadRequest, "fails to decode the request payload")
+	}
+	p := completedPartsPayload{}
+	if skyErr := p.Decode(data); skyErr != nil {
+		return skyErr
+	}
+
+	err := uploader.CompleteMultipartUpload(
+		upload.Name,
+		upload.MultipartUploadID,
+		p.Parts,
+		upload.Length,
+	)
+	if sizeErr, ok := err.(skyAsset.MultipartUploadSizeError); ok {
+		// the parts are discarded together with the assembled file
+		if err := conn.DeleteAssetUpload(upload.ID); err != nil {
+			logger.WithError(err).Warnf("Failed to delete mismatched upload %s", upload.ID)
+		}
+		return skyerr.NewErrorWithInfo(
+			skyerr.InvalidArgument,
+			sizeErr.Error(),
+			map[string]interface{}{
+				"length": sizeErr.Length,
+				"size":   sizeErr.Size,
+			},
+		)
+	} else if err != nil {
+		logger.WithError(err).Errorf("Failed to complete multipart upload %s", upload.ID)
+		return skyerr.NewError(skyerr.UnexpectedError, "Failed to complete multipart upload")
+	}
+	return nil
+}
+
+// assembleAssetUploadChunks puts the chunks of the upload to the asset
+// store as a single file, and removes the chunks afterwards. If the asset
+// store is content-addressed, the file is stored by the returned hash.
+func assembleAssetUploadChunks(
+	assetStore skyAsset.Store,
+	conn skydb.Conn,
+	upload *skydb.AssetUpload,
+	contentAddressed bool,
+	stripping skyAsset.EXIFStripping,
+	logger *logrus.Entry,
+) (string, skyerr.Error) {
+	if upload.Offset != upload.Length {
+		return "", skyerr.NewErrorWithInfo(
+			skyerr.InvalidArgument,
+			"upload is not complete",
+			map[string]interface{}{
+				"offset": upload.Offset,
+				"length": upload.Length,
+			},
+		)
+	}
+
+	readers := []io.Reader{}
+	for _, chunk := range upload.Chunks {
+		reader, err := assetStore.GetFileReader(chunk)
+		if err != nil {
+			logger.WithError(err).Errorf("Failed to get chunk %s", chunk)
+			return "", skyerr.NewResourceFetchFailureErr("chunk", chunk)
+		}
+		defer reader.Close()
+		readers = append(readers, reader)
+	}
+
+	src, _, err := skyAsset.StripEXIF(io.MultiReader(readers...), stripping)
+	if err != nil {
+		return "", recordutil.MakeUploadPolicyError(err)
+	}
+
+	hash := ""
+	if contentAddressed {
+		var skyErr skyerr.Error
+		hash, skyErr = putAssetContent(
+			assetStore,
+			conn,
+			src,
+			upload.Length,
+			upload.ContentType,
+			logger,
+		)
+		if skyErr != nil {
+			return "", skyErr
+		}
+	} else if err := assetStore.PutFileReader(
+		upload.Name,
+		src,
+		upload.Length,
+		upload.ContentType,
+	); err != nil {
+		return "", skyerr.MakeError(err)
+	}
+
+	deleteAssetUploadChunks(assetStore, upload, logger)
+	return hash, nil
+}
+
+func deleteAssetUploadChunks(
+	assetStore skyAsset.Store,
+	upload *skydb.AssetUpload,
+	logger *logrus.Entry,
+) {
+	for _, chunk := range upload.Chunks {
+		if err := assetStore.Delete(chunk); err != nil {
+			logger.WithError(err).Warnf("Failed to delete chunk %s", chunk)
+		}
+	}
+}
+
+// ResumableUploadHandler receives the chunks of a resumable upload,
+// following the semantics of the tus protocol. The upload is created by
+// a POST request with the Upload-Length header to /files/, which returns
+// the URL of the upload:
+//
+//	curl -XPOST \
+//		-H 'X-Skygear-API-Key: apiKey' \
+//		-H 'Content-Type: video/mp4' \
+//		-H 'Upload-Length: 104857600' \
+//		http://localhost:3000/files/movie.mp4
+//
+// The offset of the upload is returned in the Upload-Offset header of
+// a HEAD request to the URL of the upload:
+//
+//	curl -I \
+//		-H 'X-Skygear-API-Key: apiKey' \
+//		http://localhost:3000/files/_uploads/UPLOAD_ID
+//
+// A chunk is uploaded by a PATCH request with the Upload-Offset header,
+// which must be the current offset of the upload. If the request is
+// interrupted, the bytes received are kept and the upload is resumed
+// from the new offset:
+//
+//	curl -XPATCH \
+//		-H 'X-Skygear-API-Key: apiKey' \
+//		-H 'Content-Type: application/offset+octet-stream' \
+//		-H 'Upload-Offset: 0' \
+//		--data-binary '@chunk' \
+//		http://localhost:3000/files/_uploads/UPLOAD_ID
+//
+// After all chunks are uploaded, the upload is finalized by a POST
+// request to the URL of the upload, which returns the saved asset. A
+// DELETE request to the URL of the upload discards it.
+//
+// Chunks are kept in the asset store until the upload is finalized, so
+// that an upload can be resumed through any server instance. An upload
+// not updated for a week is abandoned, and deleted by the asset gc.
+type ResumableUploadHandler struct {
+	AssetStore    skyAsset.Store   `inject:"AssetStore"`
+	AccessKey     router.Processor `preprocessor:"accesskey"`
+	DBConn        router.Processor `preprocessor:"dbconn"`
+	preprocessors []router.Processor
+}
+
+// Setup sets preprocessors being used
+func (h *ResumableUploadHandler) Setup() {
+	h.preprocessors = []router.Processor{
+		h.AccessKey,
+		h.DBConn,
+	}
+}
+
+// GetPreprocessors returns all preprocessors
+func (h *ResumableUploadHandler) GetPreprocessors() []router.Processor {
+	return h.preprocessors
+}
+
+// Handle handles the HEAD, PATCH and DELETE requests of resumable upload
+func (h *ResumableUploadHandler) Handle(
+	payload *router.Payload,
+	response *router.Response,
+) {
+	logger := logging.CreateLogger(payload.Context(), "handler")
+	upload, skyErr := getAssetUpload(payload.DBConn, clean(payload.Params[0]))
+	if skyErr != nil {
+		response.Err = skyErr
+		return
+	}
+
+	switch payload.Req.Method {
+	case http.MethodHead:
+		writeAssetUploadOffset(response, upload, http.StatusOK)
+	case http.MethodPatch:
+		h.handleChunk(upload, payload, response, logger)
+	case http.MethodDelete:
+		h.handleAbort(upload, payload, response, logger)
+	default:
+		response.Err = skyerr.NewError(
+			skyerr.NotSupported,
+			"Method "+payload.Req.Method+" is not supported",
+		)
+	}
+}
+
+func (h *ResumableUploadHandler) handleChunk(
+	upload *skydb.AssetUpload,
+	payload *router.Payload,
+	response *router.Response,
+	logger *logrus.Entry,
+) {
+	if upload.MultipartUploadID != "" {
+		response.Err = skyerr.NewError(
+			skyerr.NotSupported,
+			"Parts of multipart upload are uploaded to the asset store",
+		)
+		return
+	}
+
+	offset, err := strconv.ParseInt(payload.Req.Header.Get("Upload-Offset"), 10, 64)
+	if err != nil || offset < 0 {
+		response.Err = skyerr.NewError(
+			skyerr.InvalidArgument,
+			"Upload-Offset must be a non-negative integer",
+		)
+		return
+	}
+	if offset != upload.Offset {
+		response.Err = makeAssetUploadOffsetError(upload.Offset)
+		return
+	}
+
+	remaining := upload.Length - upload.Offset
+	written, tempFile, err := copyChunkToTempFile(payload.Req.Body, remaining+1)
+	if err != nil {
+		response.Err = skyerr.MakeError(err)
+		return
+	}
+	defer cleanupFile(tempFile)
+
+	if written > remaining {
+		response.Err = skyerr.NewErrorWithInfo(
+			skyerr.InvalidArgument,
+			"chunk exceeds the upload length",
+			map[string]interface{}{
+				"offset": upload.Offset,
+				"length": upload.Length,
+			},
+		)
+		return
+	}
+	if written == 0 {
+		writeAssetUploadOffset(response, upload, http.StatusNoContent)
+		return
+	}
+
+	store := h.AssetStore
+	chunk := path.Join(assetUploadPrefix, upload.ID, uuidNew())
+	if err := store.PutFileReader(
+		chunk,
+		tempFile,
+		written,
+		"application/offset+octet-stream",
+	); err != nil {
+		response.Err = skyerr.MakeError(err)
+		return
+	}
+
+	if err := payload.DBConn.AppendAssetUploadChunk(upload.ID, offset, chunk, written); err != nil {
+		if deleteErr := store.Delete(chunk); deleteErr != nil {
+			logger.WithError(deleteErr).Warnf("Failed to delete chunk %s", chunk)
+		}
+		if err == skydb.ErrAssetUploadOffsetMismatch {
+			// another chunk is appended concurrently
+			response.Err = makeAssetUploadOffsetError(upload.Offset)
+			return
+		}
+		response.Err = skyerr.MakeError(err)
+		return
+	}
+
+	upload.Offset += written
+	writeAssetUploadOffset(response, upload, http.StatusNoContent)
+}
+
+func (h *ResumableUploadHandler) handleAbort(
+	upload *skydb.AssetUpload,
+	payload *router.Payload,
+	response *router.Response,
+	logger *logrus.Entry,
+) {
+	if err := payload.DBConn.DeleteAssetUpload(upload.ID); err != nil {
+		response.Err = skyerr.MakeError(err)
+		return
+	}
+	discardAssetUpload(h.AssetStore, upload, logger)
+
+	writer := response.Writer()
+	if writer == nil {
+		// The response is already written.
+		return
+	}
+	writer.WriteHeader(http.StatusNoContent)
+}
+
+// discardAssetUpload aborts the multipart upload to the asset store, or
+// deletes the chunks uploaded, of a resumable upload deleted
+func discardAssetUpload(
+	assetStore skyAsset.Store,
+	upload *skydb.AssetUpload,
+	logger *logrus.Entry,
+) {
+	if upload.MultipartUploadID == "" {
+		deleteAssetUploadChunks(assetStore, upload, logger)
+		return
+	}
+
+	if uploader, ok := assetStore.(skyAsset.FileMultipartUploader); ok {
+		if err := uploader.AbortMultipartUpload(upload.Name, upload.MultipartUploadID); err != nil {
+			logger.WithError(err).Warnf("Failed to abort multipart upload %s", upload.ID)
+		}
+	}
+}
+
+func writeAssetUploadOffset(response *router.Response, upload *skydb.AssetUpload, status int) {
+	writer := response.Writer()
+	if writer == nil {
+		// The response is already written.
+		return
+	}
+
+	writer.Header().Set("Upload-Offset", strconv.FormatInt(upload.Offset, 10))
+	writer.Header().Set("Upload-Length", strconv.FormatInt(upload.Length, 10))
+	writer.Header().Set("Cache-Control", "no-store")
+	writer.Header().Set("Access-Control-Expose-Headers", "Upload-Offset, Upload-Length")
+	writer.WriteHeader(status)
+}
+
+// copyChunkToTempFile copies at most limit bytes of the chunk to a temp
+// file. Bytes received before the request is interrupted are kept, so
+// that the upload can be resumed after them.
+func copyChunkToTempFile(src io.Reader, limit int64) (written int64, tempFile *os.File, err error) {
+	tempFile, err = ioutil.TempFile("", "")
+	if err != nil {
+		return
+	}
+
+	written, copyErr := io.Copy(tempFile, io.LimitReader(src, limit))
+	if copyErr != nil {
+		logrus.WithError(copyErr).Warnf("Chunk is interrupted after %d bytes", written)
+	}
+
+	if _, err = tempFile.Seek(0, 0); err != nil {
+		cleanupFile(tempFile)
+		tempFile = nil
+		return
+	}
+	return
+}
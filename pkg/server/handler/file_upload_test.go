@@ -0,0 +1,331 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/skygeario/skygear-server/pkg/server/asset"
+	"github.com/skygeario/skygear-server/pkg/server/router"
+	"github.com/skygeario/skygear-server/pkg/server/skydb"
+	"github.com/skygeario/skygear-server/pkg/server/skydb/skydbtest"
+	. "github.com/skygeario/skygear-server/pkg/server/skytest"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// multipartAssetStore records the multipart uploads completed or aborted
+type multipartAssetStore struct {
+	asset.URLSignerStore
+	completedParts []asset.CompletedPart
+	completedSize  int64
+	aborted        bool
+}
+
+func (s *multipartAssetStore) GenerateMultipartUploadRequest(name string, contentType string, length int64) (*asset.MultipartUploadRequest, error) {
+	return &asset.MultipartUploadRequest{
+		UploadID: "multipart-upload-id",
+		PartSize: length,
+		Parts: []asset.MultipartUploadPart{
+			{PartNumber: 1, URL: "http://s3.test/" + name + "?partNumber=1"},
+		},
+	}, nil
+}
+
+func (s *multipartAssetStore) RenewMultipartUploadRequest(name string, uploadID string, length int64) (*asset.MultipartUploadRequest, error) {
+	return &asset.MultipartUploadRequest{
+		UploadID: uploadID,
+		PartSize: length,
+		Parts: []asset.MultipartUploadPart{
+			{PartNumber: 1, URL: "http://s3.test/" + name + "?partNumber=1&renewed=1"},
+		},
+	}, nil
+}
+
+func (s *multipartAssetStore) CompleteMultipartUpload(name string, uploadID string, parts []asset.CompletedPart, length int64) error {
+	s.completedParts = parts
+	if s.completedSize != 0 && s.completedSize != length {
+		return asset.MultipartUploadSizeError{Length: length, Size: s.completedSize}
+	}
+	return nil
+}
+
+func (s *multipartAssetStore) AbortMultipartUpload(name string, uploadID string) error {
+	s.aborted = true
+	return nil
+}
+
+func TestResumableUpload(t *testing.T) {
+	Convey("Resumable upload", t, func() {
+		realUUIDNew := uuidNew
+		uuidCount := 0
+		uuidNew = func() string {
+			uuidCount++
+			return fmt.Sprintf("uuid-%d", uuidCount)
+		}
+		defer func() {
+			uuidNew = realUUIDNew
+		}()
+
+		dir, err := ioutil.TempDir("", "skygear-asset")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+		store := &multipartAssetStore{
+			URLSignerStore: asset.NewFileStore(dir, "http://skygear.test/files", "secret", true).(asset.URLSignerStore),
+		}
+
+		conn := skydbtest.NewMapConn()
+		prepareFunc := func(p *router.Payload) {
+			p.DBConn = conn
+		}
+
+		r := newmodGateway("(.+)")
+		uploadFileHandler := &UploadFileHandler{AssetStore: store}
+		r.Handle("POST", uploadFileHandler, prepareFunc)
+		resumableUploadHandler := &ResumableUploadHandler{AssetStore: store}
+		r.Handle("HEAD", resumableUploadHandler, prepareFunc)
+		r.Handle("PATCH", resumableUploadHandler, prepareFunc)
+		r.Handle("DELETE", resumableUploadHandler, prepareFunc)
+
+		request := func(method string, path string, body string, header map[string]string) *httptest.ResponseRecorder {
+			req, _ := http.NewRequest(method, "http://skygear.test/"+path, strings.NewReader(body))
+			for key, value := range header {
+				req.Header.Set(key, value)
+			}
+			return r.Do(req)
+		}
+		patch := func(offset string, body string) *httptest.ResponseRecorder {
+			return request("PATCH", "_uploads/uuid-2", body, map[string]string{
+				"Content-Type":  "application/offset+octet-stream",
+				"Upload-Offset": offset,
+			})
+		}
+
+		Convey("creates upload", func() {
+			resp := request("POST", "dir/movie.mp4", "", map[string]string{
+				"Content-Type":  "video/mp4",
+				"Upload-Length": "10",
+			})
+			So(resp.Body.Bytes(), ShouldEqualJSON, `{
+				"result": {
+					"id": "uuid-2",
+					"name": "dir/uuid-1-movie.mp4",
+					"content_type": "video/mp4",
+					"length": 10,
+					"offset": 0,
+					"url": "/files/_uploads/uuid-2"
+				}
+			}`)
+			So(conn.AssetUploadMap, ShouldContainKey, "uuid-2")
+
+			Convey("returns offset", func() {
+				resp := request("HEAD", "_uploads/uuid-2", "", nil)
+				So(resp.Code, ShouldEqual, http.StatusOK)
+				So(resp.Header().Get("Upload-Offset"), ShouldEqual, "0")
+				So(resp.Header().Get("Upload-Length"), ShouldEqual, "10")
+			})
+
+			Convey("uploads chunks and finalizes", func() {
+				resp := patch("0", "hello")
+				So(resp.Code, ShouldEqual, http.StatusNoContent)
+				So(resp.Header().Get("Upload-Offset"), ShouldEqual, "5")
+
+				resp = patch("5", "world")
+				So(resp.Code, ShouldEqual, http.StatusNoContent)
+				So(resp.Header().Get("Upload-Offset"), ShouldEqual, "10")
+
+				upload := conn.AssetUploadMap["uuid-2"]
+				So(upload.Chunks, ShouldResemble, []string{
+					"_uploads/uuid-2/uuid-3",
+					"_uploads/uuid-2/uuid-4",
+				})
+
+				resp = request("POST", "_uploads/uuid-2", "", nil)
+				So(resp.Body.Bytes(), ShouldEqualJSON, `{
+					"result": {
+						"$type": "asset",
+						"$name": "dir/uuid-1-movie.mp4",
+						"$content_type": "video/mp4",
+						"$url": "http://skygear.test/files/dir%2Fuuid-1-movie.mp4"
+					}
+				}`)
+
+				data, err := ioutil.ReadFile(filepath.Join(dir, "dir", "uuid-1-movie.mp4"))
+				So(err, ShouldBeNil)
+				So(string(data), ShouldEqual, "helloworld")
+				So(conn.AssetMap["dir/uuid-1-movie.mp4"].Size, ShouldEqual, 10)
+				So(conn.AssetUploadMap, ShouldNotContainKey, "uuid-2")
+
+				_, statErr := os.Stat(filepath.Join(dir, "_uploads", "uuid-2", "uuid-3"))
+				So(os.IsNotExist(statErr), ShouldBeTrue)
+			})
+
+			Convey("rejects chunk at wrong offset", func() {
+				resp := patch("3", "hello")
+				So(resp.Code, ShouldEqual, http.StatusConflict)
+				So(resp.Body.Bytes(), ShouldEqualJSON, `{
+					"error": {
+						"code": 113,
+						"name": "ConstraintViolated",
+						"message": "upload offset does not match",
+						"info": {
+							"offset": 0
+						}
+					}
+				}`)
+			})
+
+			Convey("rejects chunk exceeding length", func() {
+				resp := patch("0", "hello world")
+				So(resp.Code, ShouldEqual, http.StatusBadRequest)
+				So(conn.AssetUploadMap["uuid-2"].Offset, ShouldEqual, 0)
+			})
+
+			Convey("rejects finalizing incomplete upload", func() {
+				patch("0", "hello")
+				resp := request("POST", "_uploads/uuid-2", "", nil)
+				So(resp.Body.Bytes(), ShouldEqualJSON, `{
+					"error": {
+						"code": 108,
+						"name": "InvalidArgument",
+						"message": "upload is not complete",
+						"info": {
+							"offset": 5,
+							"length": 10
+						}
+					}
+				}`)
+			})
+
+			Convey("aborts upload", func() {
+				patch("0", "hello")
+				resp := request("DELETE", "_uploads/uuid-2", "", nil)
+				So(resp.Code, ShouldEqual, http.StatusNoContent)
+				So(conn.AssetUploadMap, ShouldNotContainKey, "uuid-2")
+
+				_, statErr := os.Stat(filepath.Join(dir, "_uploads", "uuid-2", "uuid-3"))
+				So(os.IsNotExist(statErr), ShouldBeTrue)
+			})
+		})
+
+		Convey("rejects upload without length", func() {
+			resp := request("POST", "movie.mp4", "", map[string]string{
+				"Content-Type":  "video/mp4",
+				"Upload-Length": "0",
+			})
+			So(resp.Code, ShouldEqual, http.StatusBadRequest)
+			So(conn.AssetUploadMap, ShouldBeEmpty)
+		})
+
+		Convey("returns not found for unknown upload", func() {
+			resp := request("HEAD", "_uploads/unknown", "", nil)
+			So(resp.Code, ShouldEqual, http.StatusNotFound)
+		})
+
+		Convey("completes multipart upload", func() {
+			conn.AssetUploadMap["multipart"] = skydb.AssetUpload{
+				ID:                "multipart",
+				Name:              "movie.mp4",
+				ContentType:       "video/mp4",
+				Length:            10,
+				MultipartUploadID: "multipart-upload-id",
+			}
+
+			resp := request("POST", "_uploads/multipart", `{
+				"parts": [{"part-number": 1, "etag": "\"etag\""}]
+			}`, map[string]string{"Content-Type": "application/json"})
+			So(resp.Code, ShouldEqual, http.StatusOK)
+			So(store.completedParts, ShouldResemble, []asset.CompletedPart{
+				{PartNumber: 1, ETag: `"etag"`},
+			})
+			So(conn.AssetMap["movie.mp4"].Size, ShouldEqual, 10)
+			So(conn.AssetUploadMap, ShouldNotContainKey, "multipart")
+		})
+
+		Convey("rejects multipart upload of mismatched size", func() {
+			conn.AssetUploadMap["multipart"] = skydb.AssetUpload{
+				ID:                "multipart",
+				Name:              "movie.mp4",
+				ContentType:       "video/mp4",
+				Length:            10,
+				MultipartUploadID: "multipart-upload-id",
+			}
+			store.completedSize = 20
+
+			resp := request("POST", "_uploads/multipart", `{
+				"parts": [{"part-number": 1, "etag": "\"etag\""}]
+			}`, map[string]string{"Content-Type": "application/json"})
+			So(resp.Body.String(), ShouldEqualJSON, `{
+				"error": {
+					"code": 108,
+					"name": "InvalidArgument",
+					"message": "Uploaded file of 20 bytes does not match the upload length 10",
+					"info": {
+						"length": 10,
+						"size": 20
+					}
+				}
+			}`)
+			So(conn.AssetMap, ShouldNotContainKey, "movie.mp4")
+			So(conn.AssetUploadMap, ShouldNotContainKey, "multipart")
+		})
+
+		Convey("with upload policy", func() {
+			uploadFileHandler.AssetUploadPolicy = &asset.UploadPolicy{
+				FieldUploadPolicy: asset.FieldUploadPolicy{
+					MaxSize: 10,
+				},
+				SniffContentType: true,
+			}
+
+			Convey("rejects upload too large", func() {
+				resp := request("POST", "movie.mp4", "", map[string]string{
+					"Content-Type":  "video/mp4",
+					"Upload-Length": "11",
+				})
+				So(resp.Code, ShouldEqual, http.StatusRequestEntityTooLarge)
+				So(conn.AssetUploadMap, ShouldBeEmpty)
+			})
+
+			Convey("rejects finalizing upload of mismatched content", func() {
+				request("POST", "movie.mp4", "", map[string]string{
+					"Content-Type":  "video/mp4",
+					"Upload-Length": "6",
+				})
+				So(patch("0", "<html>").Code, ShouldEqual, http.StatusNoContent)
+
+				resp := request("POST", "_uploads/uuid-2", "", nil)
+				So(resp.Body.Bytes(), ShouldEqualJSON, `{
+					"error": {
+						"code": 108,
+						"name": "InvalidArgument",
+						"message": "Asset of content type video/mp4 has content of text/html"
+					}
+				}`)
+				So(conn.AssetMap, ShouldBeEmpty)
+				So(conn.AssetUploadMap, ShouldBeEmpty)
+
+				_, err := store.GetFileReader("uuid-1-movie.mp4")
+				So(err, ShouldNotBeNil)
+			})
+		})
+	})
+}
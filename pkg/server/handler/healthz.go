@@ -15,15 +15,23 @@
 package handler
 
 import (
+	"github.com/skygeario/skygear-server/pkg/server/plugin"
 	"github.com/skygeario/skygear-server/pkg/server/router"
 )
 
+// PluginStateProvider provides the state of each plugin by name.
+type PluginStateProvider interface {
+	PluginStates() map[string]plugin.TransportState
+}
+
 type healthStatusResponse struct {
-	Status string `json:"status,omitempty"`
+	Status  string            `json:"status,omitempty"`
+	Plugins map[string]string `json:"plugins,omitempty"`
 }
 
 type HealthzHandler struct {
-	PluginReady   router.Processor `preprocessor:"plugin_ready"`
+	PluginContext PluginStateProvider `inject:"PluginContext"`
+	PluginReady   router.Processor    `preprocessor:"plugin_ready"`
 	preprocessors []router.Processor
 }
 
@@ -42,6 +50,31 @@ func (h *HealthzHandler) Handle(playload *router.Payload, response *router.Respo
 		rep healthStatusResponse
 	)
 	rep.Status = "OK"
+	if h.PluginContext != nil {
+		rep.Plugins = map[string]string{}
+		for name, state := range h.PluginContext.PluginStates() {
+			rep.Plugins[name] = pluginStateString(state)
+		}
+	}
 	response.Result = rep
 	return
 }
+
+func pluginStateString(state plugin.TransportState) string {
+	switch state {
+	case plugin.TransportStateUninitialized:
+		return "uninitialized"
+	case plugin.TransportStateInitialized:
+		return "initialized"
+	case plugin.TransportStateReady:
+		return "ready"
+	case plugin.TransportStateWorkerUnavailable:
+		return "worker_unavailable"
+	case plugin.TransportStateError:
+		return "error"
+	case plugin.TransportStateCircuitOpen:
+		return "circuit_open"
+	default:
+		return state.String()
+	}
+}
@@ -17,6 +17,7 @@ package handler
 import (
 	"testing"
 
+	"github.com/skygeario/skygear-server/pkg/server/plugin"
 	"github.com/skygeario/skygear-server/pkg/server/router"
 	. "github.com/smartystreets/goconvey/convey"
 )
@@ -32,4 +33,29 @@ func TestHealthzHandler(t *testing.T) {
 		s := resp.Result.(healthStatusResponse)
 		So(s.Status, ShouldEqual, "OK")
 	})
+
+	Convey("HealthzHandler with plugins", t, func() {
+		req := router.Payload{}
+		resp := router.Response{}
+
+		handler := &HealthzHandler{
+			PluginContext: fakePluginStateProvider{
+				"CAT": plugin.TransportStateReady,
+				"BUG": plugin.TransportStateCircuitOpen,
+			},
+		}
+		handler.Handle(&req, &resp)
+		s := resp.Result.(healthStatusResponse)
+		So(s.Status, ShouldEqual, "OK")
+		So(s.Plugins, ShouldResemble, map[string]string{
+			"CAT": "ready",
+			"BUG": "circuit_open",
+		})
+	})
+}
+
+type fakePluginStateProvider map[string]plugin.TransportState
+
+func (p fakePluginStateProvider) PluginStates() map[string]plugin.TransportState {
+	return p
 }
@@ -0,0 +1,173 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"time"
+
+	"github.com/mitchellh/mapstructure"
+
+	"github.com/skygeario/skygear-server/pkg/server/job"
+	"github.com/skygeario/skygear-server/pkg/server/router"
+	"github.com/skygeario/skygear-server/pkg/server/skydb"
+	"github.com/skygeario/skygear-server/pkg/server/skyerr"
+)
+
+type jobSchedulePayload struct {
+	Name        string      `mapstructure:"name"`
+	Args        interface{} `mapstructure:"args"`
+	Key         string      `mapstructure:"key"`
+	AtString    string      `mapstructure:"at"`
+	Delay       int         `mapstructure:"delay"`
+	MaxAttempts int         `mapstructure:"max_attempts"`
+	at          time.Time
+}
+
+func (payload *jobSchedulePayload) Decode(data map[string]interface{}) skyerr.Error {
+	if err := mapstructure.Decode(data, payload); err != nil {
+		return skyerr.NewError(skyerr.BadRequest, "fails to decode the request payload")
+	}
+
+	if payload.AtString != "" {
+		at, err := time.Parse(time.RFC3339, payload.AtString)
+		if err != nil {
+			return skyerr.NewInvalidArgument("invalid at", []string{"at"})
+		}
+		payload.at = at
+	}
+	return payload.Validate()
+}
+
+func (payload *jobSchedulePayload) Validate() skyerr.Error {
+	if payload.Name == "" {
+		return skyerr.NewInvalidArgument("empty job name", []string{"name"})
+	}
+	if payload.AtString != "" && payload.Delay != 0 {
+		return skyerr.NewInvalidArgument("at and delay cannot be both specified", []string{"at", "delay"})
+	}
+	if payload.Delay < 0 {
+		return skyerr.NewInvalidArgument("delay must not be negative", []string{"delay"})
+	}
+	if payload.MaxAttempts < 0 {
+		return skyerr.NewInvalidArgument("max_attempts must not be negative", []string{"max_attempts"})
+	}
+	return nil
+}
+
+type jobScheduleResponse struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	Key         string `json:"key,omitempty"`
+	RunAt       string `json:"run_at"`
+	MaxAttempts int    `json:"max_attempts"`
+}
+
+// JobScheduleHandler schedules a lambda to be executed at a later time.
+// Scheduled jobs are persisted and executed by the job worker running on
+// non-slave instances, and failed jobs are retried up to max_attempts times.
+//
+// Plugins can schedule jobs by calling this action through the plugin
+// transport, which is authenticated with master key.
+//
+// JobScheduleHandler receives these parameters:
+//
+// * name (string, required) - name of the lambda to be executed
+// * args (object or array, optional) - arguments to the lambda
+// * at (date/time, optional) - time to execute the lambda
+// * delay (integer, optional) - seconds to wait before executing the lambda
+// * key (string, optional) - unique key of the job, scheduling a job with
+//   the key of a pending job results in a Duplicated error
+// * max_attempts (integer, optional) - number of attempts before giving up
+//
+// The lambda is executed as soon as possible if neither at nor delay
+// is specified.
+//
+//  curl -X POST -H "Content-Type: application/json" \
+//    -d @- http://localhost:3000/ <<EOF
+//  {
+//      "action": "job:schedule",
+//      "api_key": "MASTER_KEY",
+//      "name": "send_reminder",
+//      "args": {"user_id": "77FA8BCF-CD6C-4A22-A170-CECC2667654F"},
+//      "delay": 3600,
+//      "key": "reminder-77FA8BCF-CD6C-4A22-A170-CECC2667654F"
+//  }
+//  EOF
+type JobScheduleHandler struct {
+	AccessKey        router.Processor `preprocessor:"accesskey"`
+	RequireMasterKey router.Processor `preprocessor:"require_master_key"`
+	DBConn           router.Processor `preprocessor:"dbconn"`
+	preprocessors    []router.Processor
+}
+
+func (h *JobScheduleHandler) Setup() {
+	h.preprocessors = []router.Processor{
+		h.AccessKey,
+		h.RequireMasterKey,
+		h.DBConn,
+	}
+}
+
+func (h *JobScheduleHandler) GetPreprocessors() []router.Processor {
+	return h.preprocessors
+}
+
+func (h *JobScheduleHandler) Handle(rpayload *router.Payload, response *router.Response) {
+	payload := jobSchedulePayload{}
+	if skyErr := payload.Decode(rpayload.Data); skyErr != nil {
+		response.Err = skyErr
+		return
+	}
+
+	now := timeNow()
+	runAt := payload.at
+	if runAt.IsZero() {
+		runAt = now.Add(time.Duration(payload.Delay) * time.Second)
+	}
+
+	maxAttempts := payload.MaxAttempts
+	if maxAttempts == 0 {
+		maxAttempts = job.DefaultMaxAttempts
+	}
+
+	j := skydb.Job{
+		Name:        payload.Name,
+		Args:        payload.Args,
+		Key:         payload.Key,
+		RunAt:       runAt.UTC(),
+		MaxAttempts: maxAttempts,
+		CreatedAt:   now,
+	}
+
+	if err := rpayload.DBConn.CreateJob(&j); err == skydb.ErrJobDuplicated {
+		response.Err = skyerr.NewErrorWithInfo(
+			skyerr.Duplicated,
+			"job with the same key is already scheduled",
+			map[string]interface{}{"key": payload.Key},
+		)
+		return
+	} else if err != nil {
+		response.Err = skyerr.MakeError(err)
+		return
+	}
+
+	response.Result = jobScheduleResponse{
+		ID:          j.ID,
+		Name:        j.Name,
+		Key:         j.Key,
+		RunAt:       j.RunAt.Format(time.RFC3339),
+		MaxAttempts: j.MaxAttempts,
+	}
+}
@@ -0,0 +1,117 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"testing"
+	"time"
+
+	"github.com/skygeario/skygear-server/pkg/server/handler/handlertest"
+	"github.com/skygeario/skygear-server/pkg/server/router"
+	"github.com/skygeario/skygear-server/pkg/server/skydb"
+	"github.com/skygeario/skygear-server/pkg/server/skydb/skydbtest"
+	. "github.com/skygeario/skygear-server/pkg/server/skytest"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestJobScheduleHandler(t *testing.T) {
+	Convey("JobScheduleHandler", t, func() {
+		realTime := timeNow
+		timeNow = func() time.Time { return time.Date(2006, 1, 2, 15, 4, 5, 0, time.UTC) }
+		defer func() {
+			timeNow = realTime
+		}()
+
+		conn := skydbtest.NewMapConn()
+		r := handlertest.NewSingleRouteRouter(&JobScheduleHandler{}, func(p *router.Payload) {
+			p.DBConn = conn
+		})
+
+		Convey("schedules job with delay", func() {
+			resp := r.POST(`{
+				"name": "send_reminder",
+				"args": {"user_id": "faseng"},
+				"delay": 3600,
+				"key": "reminder-faseng"
+			}`)
+			So(resp.Body.Bytes(), ShouldEqualJSON, `{
+				"result": {
+					"id": "job-0",
+					"name": "send_reminder",
+					"key": "reminder-faseng",
+					"run_at": "2006-01-02T16:04:05Z",
+					"max_attempts": 5
+				}
+			}`)
+
+			job := conn.JobMap["job-0"]
+			So(job.Name, ShouldEqual, "send_reminder")
+			So(job.Args, ShouldResemble, map[string]interface{}{"user_id": "faseng"})
+			So(job.RunAt, ShouldResemble, time.Date(2006, 1, 2, 16, 4, 5, 0, time.UTC))
+		})
+
+		Convey("schedules job at specified time", func() {
+			resp := r.POST(`{
+				"name": "send_reminder",
+				"at": "2006-01-03T00:00:00Z",
+				"max_attempts": 1
+			}`)
+			So(resp.Body.Bytes(), ShouldEqualJSON, `{
+				"result": {
+					"id": "job-0",
+					"name": "send_reminder",
+					"run_at": "2006-01-03T00:00:00Z",
+					"max_attempts": 1
+				}
+			}`)
+		})
+
+		Convey("rejects job with duplicated key", func() {
+			conn.JobMap["job-1"] = skydb.Job{
+				ID:  "job-1",
+				Key: "reminder-faseng",
+			}
+
+			resp := r.POST(`{
+				"name": "send_reminder",
+				"key": "reminder-faseng"
+			}`)
+			So(resp.Body.Bytes(), ShouldEqualJSON, `{
+				"error": {
+					"code": 109,
+					"message": "job with the same key is already scheduled",
+					"name": "Duplicated",
+					"info": {"key": "reminder-faseng"}
+				}
+			}`)
+		})
+
+		Convey("rejects job without name", func() {
+			resp := r.POST(`{"delay": 10}`)
+			So(resp.Code, ShouldEqual, 400)
+			So(conn.JobMap, ShouldBeEmpty)
+		})
+
+		Convey("rejects job with both at and delay", func() {
+			resp := r.POST(`{
+				"name": "send_reminder",
+				"at": "2006-01-03T00:00:00Z",
+				"delay": 10
+			}`)
+			So(resp.Code, ShouldEqual, 400)
+			So(conn.JobMap, ShouldBeEmpty)
+		})
+	})
+}
@@ -0,0 +1,71 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"github.com/skygeario/skygear-server/pkg/server/router"
+	"github.com/skygeario/skygear-server/pkg/server/skyerr"
+)
+
+// PluginReloader reloads registration of plugins.
+type PluginReloader interface {
+	ReloadPlugins() error
+}
+
+type pluginReloadResponse struct {
+	Status string `json:"status,omitempty"`
+}
+
+// PluginReloadHandler requests plugins to send registration info again,
+// such that changes to lambdas, handlers, hooks, timers and providers
+// take effect without restarting the server.
+//
+// Master key is required to reload plugins.
+//
+//  curl -X POST -H "Content-Type: application/json" \
+//    -d @- http://localhost:3000/ <<EOF
+//  {
+//      "action": "_plugin:reload",
+//      "api_key": "MASTER_KEY"
+//  }
+//  EOF
+type PluginReloadHandler struct {
+	PluginReloader   PluginReloader   `inject:"PluginContext"`
+	AccessKey        router.Processor `preprocessor:"accesskey"`
+	RequireMasterKey router.Processor `preprocessor:"require_master_key"`
+	preprocessors    []router.Processor
+}
+
+func (h *PluginReloadHandler) Setup() {
+	h.preprocessors = []router.Processor{
+		h.AccessKey,
+		h.RequireMasterKey,
+	}
+}
+
+func (h *PluginReloadHandler) GetPreprocessors() []router.Processor {
+	return h.preprocessors
+}
+
+func (h *PluginReloadHandler) Handle(payload *router.Payload, response *router.Response) {
+	if err := h.PluginReloader.ReloadPlugins(); err != nil {
+		response.Err = skyerr.NewError(skyerr.PluginUnavailable, err.Error())
+		return
+	}
+
+	response.Result = pluginReloadResponse{
+		Status: "OK",
+	}
+}
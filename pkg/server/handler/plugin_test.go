@@ -0,0 +1,67 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/skygeario/skygear-server/pkg/server/handler/handlertest"
+	"github.com/skygeario/skygear-server/pkg/server/router"
+	. "github.com/skygeario/skygear-server/pkg/server/skytest"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+type fakePluginReloader struct {
+	reloaded int
+	err      error
+}
+
+func (r *fakePluginReloader) ReloadPlugins() error {
+	r.reloaded++
+	return r.err
+}
+
+func TestPluginReloadHandler(t *testing.T) {
+	Convey("PluginReloadHandler", t, func() {
+		reloader := &fakePluginReloader{}
+		r := handlertest.NewSingleRouteRouter(&PluginReloadHandler{
+			PluginReloader: reloader,
+		}, func(p *router.Payload) {})
+
+		Convey("reloads plugins", func() {
+			resp := r.POST(`{}`)
+			So(resp.Body.Bytes(), ShouldEqualJSON, `{
+				"result": {
+					"status": "OK"
+				}
+			}`)
+			So(reloader.reloaded, ShouldEqual, 1)
+		})
+
+		Convey("returns error when plugins fail to reload", func() {
+			reloader.err = errors.New("fail to reload plugins: plugin unavailable")
+
+			resp := r.POST(`{}`)
+			So(resp.Body.Bytes(), ShouldEqualJSON, `{
+				"error": {
+					"code": 118,
+					"message": "fail to reload plugins: plugin unavailable",
+					"name": "PluginUnavailable"
+				}
+			}`)
+		})
+	})
+}
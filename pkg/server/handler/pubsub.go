@@ -15,19 +15,33 @@
 package handler
 
 import (
+	"github.com/mitchellh/mapstructure"
+
 	"github.com/skygeario/skygear-server/pkg/server/pubsub"
 	"github.com/skygeario/skygear-server/pkg/server/router"
+	"github.com/skygeario/skygear-server/pkg/server/skyerr"
 )
 
+// PubSubHandler upgrades the request to a websocket connection of pubsub.
+//
+// The connection is authenticated by the access token of the request, if
+// any. Subscribing and publishing on the connection are authorized against
+// the user and roles of the access token.
 type PubSubHandler struct {
 	WebSocket     *pubsub.WsPubSub
 	AccessKey     router.Processor `preprocessor:"accesskey"`
+	InjectAuthID  router.Processor `preprocessor:"inject_auth_id"`
+	DBConn        router.Processor `preprocessor:"dbconn"`
+	InjectAuth    router.Processor `preprocessor:"inject_auth"`
 	preprocessors []router.Processor
 }
 
 func (h *PubSubHandler) Setup() {
 	h.preprocessors = []router.Processor{
 		h.AccessKey,
+		h.InjectAuthID,
+		h.DBConn,
+		h.InjectAuth,
 	}
 }
 
@@ -42,5 +56,105 @@ func (h *PubSubHandler) Handle(payload *router.Payload, response *router.Respons
 		return
 	}
 
-	h.WebSocket.Handle(writer, payload.Req)
+	h.WebSocket.Handle(writer, payload.Req, pubsubClient(payload))
+}
+
+func pubsubClient(payload *router.Payload) pubsub.Client {
+	client := pubsub.Client{
+		MasterKey: payload.HasMasterKey(),
+	}
+	if payload.AuthInfo != nil {
+		client.UserID = payload.AuthInfo.ID
+		client.Roles = payload.AuthInfo.Roles
+	}
+	return client
+}
+
+type pubsubPresencePayload struct {
+	Channel string `mapstructure:"channel"`
+}
+
+func (payload *pubsubPresencePayload) Decode(data map[string]interface{}) skyerr.Error {
+	if err := mapstructure.Decode(data, payload); err != nil {
+		return skyerr.NewError(skyerr.BadRequest, "fails to decode the request payload")
+	}
+	return payload.Validate()
+}
+
+func (payload *pubsubPresencePayload) Validate() skyerr.Error {
+	if payload.Channel == "" {
+		return skyerr.NewInvalidArgument("empty channel", []string{"channel"})
+	}
+	return nil
+}
+
+// PubSubPresenceHandler returns the users subscribed to a pubsub channel.
+// Users subscribed to the channel on any skygear-server sharing the pubsub
+// backend are returned. The channel must be allowed to be subscribed by
+// the requesting user.
+//
+//  curl -X POST -H "Content-Type: application/json" \
+//    -d @- http://localhost:3000/ <<EOF
+//  {
+//      "action": "pubsub:presence",
+//      "api_key": "API_KEY",
+//      "access_token": "ACCESS_TOKEN",
+//      "channel": "public:chat"
+//  }
+//  EOF
+//
+// Response:
+//
+//  {
+//      "result": {
+//          "channel": "public:chat",
+//          "user_ids": ["alice", "bob"]
+//      }
+//  }
+type PubSubPresenceHandler struct {
+	Hub           *pubsub.Hub
+	Authorizer    pubsub.Authorizer
+	AccessKey     router.Processor `preprocessor:"accesskey"`
+	InjectAuthID  router.Processor `preprocessor:"inject_auth_id"`
+	DBConn        router.Processor `preprocessor:"dbconn"`
+	InjectAuth    router.Processor `preprocessor:"inject_auth"`
+	preprocessors []router.Processor
+}
+
+func (h *PubSubPresenceHandler) Setup() {
+	h.preprocessors = []router.Processor{
+		h.AccessKey,
+		h.InjectAuthID,
+		h.DBConn,
+		h.InjectAuth,
+	}
+}
+
+func (h *PubSubPresenceHandler) GetPreprocessors() []router.Processor {
+	return h.preprocessors
+}
+
+func (h *PubSubPresenceHandler) Handle(payload *router.Payload, response *router.Response) {
+	p := &pubsubPresencePayload{}
+	if err := p.Decode(payload.Data); err != nil {
+		response.Err = err
+		return
+	}
+
+	if h.Authorizer != nil {
+		allowed, err := h.Authorizer.Authorize(payload.Context(), pubsubClient(payload), pubsub.ActionSubscribe, p.Channel)
+		if err != nil {
+			response.Err = skyerr.MakeError(err)
+			return
+		}
+		if !allowed {
+			response.Err = skyerr.NewErrorf(skyerr.PermissionDenied, `not authorized to access presence of channel "%s"`, p.Channel)
+			return
+		}
+	}
+
+	response.Result = struct {
+		Channel string   `json:"channel"`
+		UserIDs []string `json:"user_ids"`
+	}{p.Channel, h.Hub.Members(p.Channel)}
 }
@@ -0,0 +1,72 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"testing"
+
+	"github.com/skygeario/skygear-server/pkg/server/handler/handlertest"
+	"github.com/skygeario/skygear-server/pkg/server/pubsub"
+	"github.com/skygeario/skygear-server/pkg/server/router"
+	"github.com/skygeario/skygear-server/pkg/server/skydb"
+	. "github.com/skygeario/skygear-server/pkg/server/skytest"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestPubSubPresenceHandler(t *testing.T) {
+	Convey("PubSubPresenceHandler", t, func() {
+		hub := pubsub.NewHub()
+		pubsub.NewWsPubsub(hub)
+
+		authorizer := &pubsub.ChannelAuthorizer{
+			User:    pubsub.ChannelRule{Subscribe: pubsub.RuleOwner, Publish: pubsub.RuleMaster},
+			Default: pubsub.ChannelRule{Subscribe: pubsub.RuleAnyone, Publish: pubsub.RuleAnyone},
+		}
+		r := handlertest.NewSingleRouteRouter(&PubSubPresenceHandler{
+			Hub:        hub,
+			Authorizer: authorizer,
+		}, func(p *router.Payload) {
+			p.AuthInfo = &skydb.AuthInfo{ID: "alice"}
+		})
+
+		Convey("returns members of channel", func() {
+			resp := r.POST(`{"channel": "user:alice"}`)
+			So(resp.Body.Bytes(), ShouldEqualJSON, `{
+				"result": {
+					"channel": "user:alice",
+					"user_ids": []
+				}
+			}`)
+		})
+
+		Convey("rejects channel not allowed to subscribe", func() {
+			resp := r.POST(`{"channel": "user:bob"}`)
+			So(resp.Code, ShouldEqual, 403)
+			So(resp.Body.String(), ShouldContainSubstring, `"name":"PermissionDenied"`)
+		})
+
+		Convey("rejects empty channel", func() {
+			resp := r.POST(`{}`)
+			So(resp.Body.Bytes(), ShouldEqualJSON, `{
+				"error": {
+					"code": 108,
+					"message": "empty channel",
+					"name": "InvalidArgument",
+					"info": {"arguments": ["channel"]}
+				}
+			}`)
+		})
+	})
+}
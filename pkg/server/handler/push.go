@@ -41,6 +41,18 @@ var sendPushNotification = func(sender push.Sender, device skydb.Device, m push.
 	}()
 }
 
+// Remarks: this variable is for mocking in test cases
+var broadcastPushNotification = func(broadcaster *push.Broadcaster, sender push.Sender, topic string, content *pushContent) {
+	go func() {
+		count, err := broadcaster.Broadcast(sender, topic, content.mapperFunc())
+		if err != nil {
+			logrus.Warnf("Failed to broadcast notification to topic = %s: %v", topic, err)
+		} else {
+			logrus.Infof("Broadcasted notification to %d devices of topic = %s", count, topic)
+		}
+	}()
+}
+
 type sendPushResponseItem struct {
 	id  string
 	err *error
@@ -70,10 +82,193 @@ func (e *sendPushResponseItem) MarshalJSON() ([]byte, error) {
 	}{e.id})
 }
 
-type pushToUserPayload struct {
-	UserIDs      []string               `mapstructure:"user_ids"`
-	Topic        string                 `mapstructure:"topic"`
+// pushContentPayload specifies the content of a push notification, which
+// is either a raw notification or the name of a push template rendered
+// with data.
+type pushContentPayload struct {
 	Notification map[string]interface{} `mapstructure:"notification"`
+	Template     string                 `mapstructure:"template"`
+	Data         map[string]interface{} `mapstructure:"data"`
+	Locale       string                 `mapstructure:"locale"`
+}
+
+func (payload *pushContentPayload) Validate() skyerr.Error {
+	if payload.Notification == nil && payload.Template == "" {
+		return skyerr.NewInvalidArgument("no notification specified", []string{"notification"})
+	}
+	if payload.Notification != nil && payload.Template != "" {
+		return skyerr.NewInvalidArgument("notification and template cannot be both specified", []string{"notification", "template"})
+	}
+	return nil
+}
+
+// pushContent creates the push.Mapper sent to each recipient.
+type pushContent struct {
+	payload  pushContentPayload
+	template *skydb.PushTemplate
+	db       skydb.Database
+	rendered map[string]push.Mapper
+}
+
+func newPushContent(conn skydb.Conn, payload pushContentPayload) (*pushContent, skyerr.Error) {
+	content := &pushContent{
+		payload:  payload,
+		rendered: map[string]push.Mapper{},
+	}
+	if payload.Template == "" {
+		return content, nil
+	}
+
+	template := skydb.PushTemplate{}
+	if err := conn.GetPushTemplate(payload.Template, &template); err == skydb.ErrPushTemplateNotFound {
+		return nil, pushTemplateNotFoundError(payload.Template)
+	} else if err != nil {
+		return nil, skyerr.MakeError(err)
+	}
+	content.template = &template
+	content.db = conn.PublicDB()
+	return content, nil
+}
+
+// MapperForUser returns the notification for the user. If a template is
+// used and the payload does not specify a locale, the template is
+// rendered in the locale of the user record.
+func (c *pushContent) MapperForUser(userID string) (push.Mapper, error) {
+	if c.template == nil {
+		return push.MapMapper(c.payload.Notification), nil
+	}
+
+	locale := c.payload.Locale
+	if locale == "" && userID != "" {
+		locale = c.userLocale(userID)
+	}
+	if mapper, ok := c.rendered[locale]; ok {
+		return mapper, nil
+	}
+
+	content, ok := c.template.Content(locale)
+	if !ok {
+		return nil, skyerr.NewErrorf(skyerr.UnexpectedError, `push template "%s" has no content in locale %s`, c.template.Name, locale)
+	}
+	mapper, err := push.RenderTemplate(content, c.payload.Data)
+	if err != nil {
+		return nil, skyerr.NewErrorWithInfo(
+			skyerr.InvalidArgument,
+			fmt.Sprintf("fails to render push template: %v", err),
+			map[string]interface{}{"template": c.template.Name},
+		)
+	}
+	c.rendered[locale] = mapper
+	return mapper, nil
+}
+
+func (c *pushContent) userLocale(userID string) string {
+	if c.db == nil {
+		return ""
+	}
+
+	record := skydb.Record{}
+	if err := c.db.Get(skydb.NewRecordID(c.db.UserRecordType(), userID), &record); err != nil {
+		return ""
+	}
+	locale, _ := record.Get("locale").(string)
+	return locale
+}
+
+// sendToUser sends the notification to the devices of the user, returning
+// the error encountered.
+func sendToUser(sender push.Sender, conn skydb.Conn, userID string, topic string, content *pushContent) error {
+	var devices []skydb.Device
+	var err error
+
+	if topic != "" {
+		devices, err = conn.QueryDevicesByUserAndTopic(userID, topic)
+	} else {
+		devices, err = conn.QueryDevicesByUser(userID)
+	}
+	if err != nil {
+		return err
+	}
+
+	pushMap, err := content.MapperForUser(userID)
+	if err != nil {
+		return err
+	}
+
+	// FIXME: The deduplication should be done at device register.
+	deviceIDs := map[string]bool{}
+	for i := range devices {
+		device := devices[i]
+		if _, ok := deviceIDs[device.Token]; !ok {
+			deviceIDs[device.Token] = true
+			sendPushNotification(recordPushDelivery(sender, device, pushMap), device, pushMap)
+		}
+	}
+	return nil
+}
+
+// mapperFunc returns the push.MapperFunc broadcasting the content. User
+// locales are looked up with the conn of the broadcast, as the conn of
+// the request may have been closed when the broadcast runs.
+func (c *pushContent) mapperFunc() push.MapperFunc {
+	return func(conn skydb.Conn, device skydb.Device) (push.Mapper, error) {
+		if c.template != nil {
+			c.db = conn.PublicDB()
+		}
+		return c.MapperForUser(device.AuthInfoID)
+	}
+}
+
+// newPushSender returns the Sender of a push request. If the delivery log
+// is enabled, the deliveries of the request are recorded under the
+// returned push ID.
+func newPushSender(sender push.Sender, deliveryLog *push.DeliveryLog) (push.Sender, string) {
+	if deliveryLog == nil {
+		return sender, ""
+	}
+	pushID := uuidNew()
+	return deliveryLog.PushSender(pushID), pushID
+}
+
+// pushSenderWithID is like newPushSender, except that the deliveries are
+// recorded under the supplied push ID.
+func pushSenderWithID(sender push.Sender, deliveryLog *push.DeliveryLog, pushID string) (push.Sender, string) {
+	if deliveryLog == nil {
+		return sender, ""
+	}
+	return deliveryLog.PushSender(pushID), pushID
+}
+
+// recordPushDelivery records the delivery of the notification if the
+// sender records deliveries, such that the delivery can be queried with
+// push:status as soon as the push ID is returned, before the notification
+// is sent asynchronously.
+func recordPushDelivery(sender push.Sender, device skydb.Device, m push.Mapper) push.Sender {
+	recorder, ok := sender.(push.DeliveryRecorder)
+	if !ok {
+		return sender
+	}
+
+	recorded, err := recorder.Record(m, device)
+	if err != nil {
+		logrus.Warnf("Failed to record push delivery to device %s: %v", device.ID, err)
+		return sender
+	}
+	return recorded
+}
+
+// pushInfo returns the info of the response of a push request.
+func pushInfo(pushID string) interface{} {
+	if pushID == "" {
+		return nil
+	}
+	return map[string]interface{}{"push_id": pushID}
+}
+
+type pushToUserPayload struct {
+	UserIDs            []string `mapstructure:"user_ids"`
+	Topic              string   `mapstructure:"topic"`
+	pushContentPayload `mapstructure:",squash"`
 }
 
 func (payload *pushToUserPayload) Decode(data map[string]interface{}) skyerr.Error {
@@ -87,19 +282,17 @@ func (payload *pushToUserPayload) Validate() skyerr.Error {
 	if len(payload.UserIDs) == 0 {
 		return skyerr.NewInvalidArgument("empty user ids", []string{"user_ids"})
 	}
-	if payload.Notification == nil {
-		return skyerr.NewInvalidArgument("no notification specified", []string{"notification"})
-	}
-	return nil
+	return payload.pushContentPayload.Validate()
 }
 
 type PushToUserHandler struct {
-	NotificationSender push.Sender      `inject:"PushSender"`
-	AccessKey          router.Processor `preprocessor:"accesskey"`
-	DBConn             router.Processor `preprocessor:"dbconn"`
-	InjectDB           router.Processor `preprocessor:"inject_db"`
-	Notification       router.Processor `preprocessor:"notification"`
-	PluginReady        router.Processor `preprocessor:"plugin_ready"`
+	NotificationSender push.Sender       `inject:"PushSender"`
+	DeliveryLog        *push.DeliveryLog `inject:"PushDeliveryLog"`
+	AccessKey          router.Processor  `preprocessor:"accesskey"`
+	DBConn             router.Processor  `preprocessor:"dbconn"`
+	InjectDB           router.Processor  `preprocessor:"inject_db"`
+	Notification       router.Processor  `preprocessor:"notification"`
+	PluginReady        router.Processor  `preprocessor:"plugin_ready"`
 	preprocessors      []router.Processor
 }
 
@@ -125,41 +318,38 @@ func (h *PushToUserHandler) Handle(rpayload *router.Payload, response *router.Re
 		return
 	}
 
-	conn := rpayload.DBConn
+	sender, pushID := newPushSender(h.NotificationSender, h.DeliveryLog)
+	resultItems, skyErr := pushToUsers(sender, rpayload.DBConn, &payload)
+	if skyErr != nil {
+		response.Err = skyErr
+		return
+	}
+	response.Info = pushInfo(pushID)
+	response.Result = resultItems
+}
+
+// pushToUsers sends the notification of the payload to the devices of the
+// users, returning the result of each user.
+func pushToUsers(sender push.Sender, conn skydb.Conn, payload *pushToUserPayload) ([]sendPushResponseItem, skyerr.Error) {
+	content, skyErr := newPushContent(conn, payload.pushContentPayload)
+	if skyErr != nil {
+		return nil, skyErr
+	}
+
 	resultItems := make([]sendPushResponseItem, len(payload.UserIDs))
 	for i, userID := range payload.UserIDs {
 		resultItems[i].id = userID
-		var devices []skydb.Device
-		var err error
-
-		if payload.Topic != "" {
-			devices, err = conn.QueryDevicesByUserAndTopic(userID, payload.Topic)
-		} else {
-			devices, err = conn.QueryDevicesByUser(userID)
-		}
-
-		if err != nil {
+		if err := sendToUser(sender, conn, userID, payload.Topic, content); err != nil {
 			resultItems[i].err = &err
-		} else {
-			// FIXME: The deduplication should be done at device register.
-			deviceIDs := map[string]bool{}
-			for i := range devices {
-				device := devices[i]
-				if _, ok := deviceIDs[device.Token]; !ok {
-					deviceIDs[device.Token] = true
-					pushMap := push.MapMapper(payload.Notification)
-					sendPushNotification(h.NotificationSender, device, pushMap)
-				}
-			}
 		}
 	}
-	response.Result = resultItems
+	return resultItems, nil
 }
 
 type pushToDevicePayload struct {
-	DeviceIDs    []string               `mapstructure:"device_ids"`
-	Topic        string                 `mapstructure:"topic"`
-	Notification map[string]interface{} `mapstructure:"notification"`
+	DeviceIDs          []string `mapstructure:"device_ids"`
+	Topic              string   `mapstructure:"topic"`
+	pushContentPayload `mapstructure:",squash"`
 }
 
 func (payload *pushToDevicePayload) Decode(data map[string]interface{}) skyerr.Error {
@@ -173,19 +363,17 @@ func (payload *pushToDevicePayload) Validate() skyerr.Error {
 	if len(payload.DeviceIDs) == 0 {
 		return skyerr.NewInvalidArgument("empty device ids", []string{"device_ids"})
 	}
-	if payload.Notification == nil {
-		return skyerr.NewInvalidArgument("no notification specified", []string{"notification"})
-	}
-	return nil
+	return payload.pushContentPayload.Validate()
 }
 
 type PushToDeviceHandler struct {
-	NotificationSender push.Sender      `inject:"PushSender"`
-	AccessKey          router.Processor `preprocessor:"accesskey"`
-	DBConn             router.Processor `preprocessor:"dbconn"`
-	InjectDB           router.Processor `preprocessor:"inject_db"`
-	Notification       router.Processor `preprocessor:"notification"`
-	PluginReady        router.Processor `preprocessor:"plugin_ready"`
+	NotificationSender push.Sender       `inject:"PushSender"`
+	DeliveryLog        *push.DeliveryLog `inject:"PushDeliveryLog"`
+	AccessKey          router.Processor  `preprocessor:"accesskey"`
+	DBConn             router.Processor  `preprocessor:"dbconn"`
+	InjectDB           router.Processor  `preprocessor:"inject_db"`
+	Notification       router.Processor  `preprocessor:"notification"`
+	PluginReady        router.Processor  `preprocessor:"plugin_ready"`
 	preprocessors      []router.Processor
 }
 
@@ -211,7 +399,24 @@ func (h *PushToDeviceHandler) Handle(rpayload *router.Payload, response *router.
 		return
 	}
 
-	conn := rpayload.DBConn
+	sender, pushID := newPushSender(h.NotificationSender, h.DeliveryLog)
+	resultItems, skyErr := pushToDevices(sender, rpayload.DBConn, payload)
+	if skyErr != nil {
+		response.Err = skyErr
+		return
+	}
+	response.Info = pushInfo(pushID)
+	response.Result = resultItems
+}
+
+// pushToDevices sends the notification of the payload to the devices,
+// returning the result of each device.
+func pushToDevices(sender push.Sender, conn skydb.Conn, payload *pushToDevicePayload) ([]sendPushResponseItem, skyerr.Error) {
+	content, skyErr := newPushContent(conn, payload.pushContentPayload)
+	if skyErr != nil {
+		return nil, skyErr
+	}
+
 	resultItems := []sendPushResponseItem{}
 	for _, deviceID := range payload.DeviceIDs {
 		device := skydb.Device{}
@@ -221,12 +426,251 @@ func (h *PushToDeviceHandler) Handle(rpayload *router.Payload, response *router.
 				err: &err,
 			})
 		} else if payload.Topic == "" || payload.Topic == device.Topic {
-			pushMap := push.MapMapper(payload.Notification)
-			sendPushNotification(h.NotificationSender, device, pushMap)
+			pushMap, err := content.MapperForUser(device.AuthInfoID)
+			if err != nil {
+				resultItems = append(resultItems, sendPushResponseItem{
+					id:  deviceID,
+					err: &err,
+				})
+				continue
+			}
+			sendPushNotification(recordPushDelivery(sender, device, pushMap), device, pushMap)
 			resultItems = append(resultItems, sendPushResponseItem{
 				id: deviceID,
 			})
 		}
 	}
+	return resultItems, nil
+}
+
+type pushToQueryPayload struct {
+	RawQuery           map[string]interface{} `mapstructure:"query"`
+	Topic              string                 `mapstructure:"topic"`
+	pushContentPayload `mapstructure:",squash"`
+}
+
+func (payload *pushToQueryPayload) Decode(data map[string]interface{}) skyerr.Error {
+	if err := mapstructure.Decode(data, payload); err != nil {
+		return skyerr.NewError(skyerr.BadRequest, "fails to decode the request payload")
+	}
+	return payload.Validate()
+}
+
+func (payload *pushToQueryPayload) Validate() skyerr.Error {
+	if payload.RawQuery == nil {
+		return skyerr.NewInvalidArgument("no query specified", []string{"query"})
+	}
+	return payload.pushContentPayload.Validate()
+}
+
+// Query parses the query of the payload, which must be on the user record
+// type of db.
+func (payload *pushToQueryPayload) Query(db skydb.Database, authInfoID string) (skydb.Query, skyerr.Error) {
+	rawQuery := map[string]interface{}{}
+	for key, value := range payload.RawQuery {
+		rawQuery[key] = value
+	}
+	if _, ok := rawQuery["record_type"]; !ok {
+		rawQuery["record_type"] = db.UserRecordType()
+	}
+
+	query := skydb.Query{}
+	parser := QueryParser{UserID: authInfoID}
+	if skyErr := parser.queryFromRaw(rawQuery, &query); skyErr != nil {
+		return query, skyErr
+	}
+	if query.Type != db.UserRecordType() {
+		return query, skyerr.NewInvalidArgument(
+			fmt.Sprintf("query must be on record type %s", db.UserRecordType()),
+			[]string{"query"},
+		)
+	}
+	return query, nil
+}
+
+// PushToQueryHandler sends a push notification to the devices of all users
+// matched by a query on the user record type. The query has the same
+// format as the one of record:query, and record_type defaults to the user
+// record type. Access control is not applied to the query.
+//
+// The notification is either specified in `notification`, or rendered
+// from the push template named in `template` with `data`. The template is
+// rendered in `locale`, or the `locale` field of each user record if
+// not specified.
+//
+//  curl -X POST -H "Content-Type: application/json" \
+//    -d @- http://localhost:3000/ <<EOF
+//  {
+//      "action": "push:query",
+//      "api_key": "MASTER_KEY",
+//      "query": {
+//          "record_type": "user",
+//          "predicate": ["eq", {"$type": "keypath", "$val": "plan"}, "premium"]
+//      },
+//      "template": "welcome",
+//      "data": {"name": "Skygear"}
+//  }
+//  EOF
+type PushToQueryHandler struct {
+	NotificationSender push.Sender       `inject:"PushSender"`
+	DeliveryLog        *push.DeliveryLog `inject:"PushDeliveryLog"`
+	AccessKey          router.Processor  `preprocessor:"accesskey"`
+	RequireMasterKey   router.Processor  `preprocessor:"require_master_key"`
+	DBConn             router.Processor  `preprocessor:"dbconn"`
+	Notification       router.Processor  `preprocessor:"notification"`
+	PluginReady        router.Processor  `preprocessor:"plugin_ready"`
+	preprocessors      []router.Processor
+}
+
+func (h *PushToQueryHandler) Setup() {
+	h.preprocessors = []router.Processor{
+		h.AccessKey,
+		h.RequireMasterKey,
+		h.DBConn,
+		h.Notification,
+		h.PluginReady,
+	}
+}
+
+func (h *PushToQueryHandler) GetPreprocessors() []router.Processor {
+	return h.preprocessors
+}
+
+func (h *PushToQueryHandler) Handle(rpayload *router.Payload, response *router.Response) {
+	payload := pushToQueryPayload{}
+	if skyErr := payload.Decode(rpayload.Data); skyErr != nil {
+		response.Err = skyErr
+		return
+	}
+
+	sender, pushID := newPushSender(h.NotificationSender, h.DeliveryLog)
+	resultItems, skyErr := pushToQuery(sender, rpayload.DBConn, rpayload.AuthInfoID, &payload)
+	if skyErr != nil {
+		response.Err = skyErr
+		return
+	}
+	response.Info = pushInfo(pushID)
 	response.Result = resultItems
 }
+
+// pushToQuery sends the notification of the payload to the devices of
+// the users matched by the query, returning the result of each user.
+func pushToQuery(sender push.Sender, conn skydb.Conn, authInfoID string, payload *pushToQueryPayload) ([]sendPushResponseItem, skyerr.Error) {
+	db := conn.PublicDB()
+	query, skyErr := payload.Query(db, authInfoID)
+	if skyErr != nil {
+		return nil, skyErr
+	}
+
+	content, skyErr := newPushContent(conn, payload.pushContentPayload)
+	if skyErr != nil {
+		return nil, skyErr
+	}
+
+	results, err := db.Query(&query, &skydb.AccessControlOptions{
+		BypassAccessControl: true,
+	})
+	if err != nil {
+		return nil, skyerr.MakeError(err)
+	}
+	defer results.Close()
+
+	resultItems := []sendPushResponseItem{}
+	for results.Scan() {
+		userID := results.Record().ID.Key
+		item := sendPushResponseItem{id: userID}
+		if sendErr := sendToUser(sender, conn, userID, payload.Topic, content); sendErr != nil {
+			item.err = &sendErr
+		}
+		resultItems = append(resultItems, item)
+	}
+	if err = results.Err(); err != nil {
+		return nil, skyerr.MakeError(err)
+	}
+	return resultItems, nil
+}
+
+type pushToTopicPayload struct {
+	Topic              string `mapstructure:"topic"`
+	pushContentPayload `mapstructure:",squash"`
+}
+
+func (payload *pushToTopicPayload) Decode(data map[string]interface{}) skyerr.Error {
+	if err := mapstructure.Decode(data, payload); err != nil {
+		return skyerr.NewError(skyerr.BadRequest, "fails to decode the request payload")
+	}
+	return payload.Validate()
+}
+
+func (payload *pushToTopicPayload) Validate() skyerr.Error {
+	if payload.Topic == "" {
+		return skyerr.NewInvalidArgument("empty topic", []string{"topic"})
+	}
+	return payload.pushContentPayload.Validate()
+}
+
+// PushToTopicHandler sends a push notification to all devices subscribed
+// to a topic, regardless of the user who registered the device.
+//
+// The devices are queried in batches and the notifications are sent in
+// the background with bounded concurrency, so the response is returned
+// before the notifications are sent. With the push delivery log enabled,
+// the progress can be checked with push:status using the push_id in the
+// info of the response.
+//
+//  curl -X POST -H "Content-Type: application/json" \
+//    -d @- http://localhost:3000/ <<EOF
+//  {
+//      "action": "push:topic",
+//      "api_key": "MASTER_KEY",
+//      "topic": "breaking-news",
+//      "template": "breaking",
+//      "data": {"headline": "Skygear released"}
+//  }
+//  EOF
+type PushToTopicHandler struct {
+	NotificationSender push.Sender       `inject:"PushSender"`
+	DeliveryLog        *push.DeliveryLog `inject:"PushDeliveryLog"`
+	Broadcaster        *push.Broadcaster `inject:"PushBroadcaster"`
+	AccessKey          router.Processor  `preprocessor:"accesskey"`
+	RequireMasterKey   router.Processor  `preprocessor:"require_master_key"`
+	DBConn             router.Processor  `preprocessor:"dbconn"`
+	Notification       router.Processor  `preprocessor:"notification"`
+	PluginReady        router.Processor  `preprocessor:"plugin_ready"`
+	preprocessors      []router.Processor
+}
+
+func (h *PushToTopicHandler) Setup() {
+	h.preprocessors = []router.Processor{
+		h.AccessKey,
+		h.RequireMasterKey,
+		h.DBConn,
+		h.Notification,
+		h.PluginReady,
+	}
+}
+
+func (h *PushToTopicHandler) GetPreprocessors() []router.Processor {
+	return h.preprocessors
+}
+
+func (h *PushToTopicHandler) Handle(rpayload *router.Payload, response *router.Response) {
+	payload := pushToTopicPayload{}
+	if skyErr := payload.Decode(rpayload.Data); skyErr != nil {
+		response.Err = skyErr
+		return
+	}
+
+	content, skyErr := newPushContent(rpayload.DBConn, payload.pushContentPayload)
+	if skyErr != nil {
+		response.Err = skyErr
+		return
+	}
+	sender, pushID := newPushSender(h.NotificationSender, h.DeliveryLog)
+
+	broadcastPushNotification(h.Broadcaster, sender, payload.Topic, content)
+	response.Info = pushInfo(pushID)
+	response.Result = map[string]interface{}{
+		"topic": payload.Topic,
+	}
+}
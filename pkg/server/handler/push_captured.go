@@ -0,0 +1,115 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"time"
+
+	"github.com/mitchellh/mapstructure"
+
+	"github.com/skygeario/skygear-server/pkg/server/push"
+	"github.com/skygeario/skygear-server/pkg/server/router"
+	"github.com/skygeario/skygear-server/pkg/server/skyerr"
+)
+
+type pushCapturedPayload struct {
+	Clear bool `mapstructure:"clear"`
+}
+
+func (payload *pushCapturedPayload) Decode(data map[string]interface{}) skyerr.Error {
+	if err := mapstructure.Decode(data, payload); err != nil {
+		return skyerr.NewError(skyerr.BadRequest, "fails to decode the request payload")
+	}
+	return nil
+}
+
+type capturedNotificationResponse struct {
+	DeviceID    string                 `json:"device_id"`
+	DeviceType  string                 `json:"device_type"`
+	DeviceToken string                 `json:"device_token"`
+	UserID      string                 `json:"user_id,omitempty"`
+	Topic       string                 `json:"topic,omitempty"`
+	Payload     map[string]interface{} `json:"payload"`
+	Error       string                 `json:"error,omitempty"`
+	CapturedAt  string                 `json:"captured_at"`
+}
+
+// PushCapturedHandler lists the notifications captured by the mock push
+// sender, which is enabled with PUSH_MOCK_ENABLE for testing push flows
+// without credentials of the push services. The captured notifications
+// are removed after listed if `clear` is true.
+//
+//  curl -X POST -H "Content-Type: application/json" \
+//    -d @- http://localhost:3000/ <<EOF
+//  {
+//      "action": "_dev:push:captured",
+//      "api_key": "API_KEY",
+//      "clear": true
+//  }
+//  EOF
+type PushCapturedHandler struct {
+	MockSender    *push.MockSender `inject:"PushMockSender"`
+	AccessKey     router.Processor `preprocessor:"accesskey"`
+	DevOnly       router.Processor `preprocessor:"dev_only"`
+	preprocessors []router.Processor
+}
+
+func (h *PushCapturedHandler) Setup() {
+	h.preprocessors = []router.Processor{
+		h.AccessKey,
+		h.DevOnly,
+	}
+}
+
+func (h *PushCapturedHandler) GetPreprocessors() []router.Processor {
+	return h.preprocessors
+}
+
+func (h *PushCapturedHandler) Handle(rpayload *router.Payload, response *router.Response) {
+	payload := pushCapturedPayload{}
+	if skyErr := payload.Decode(rpayload.Data); skyErr != nil {
+		response.Err = skyErr
+		return
+	}
+
+	if h.MockSender == nil {
+		response.Err = skyerr.NewError(skyerr.NotConfigured, "mock push sender is not enabled")
+		return
+	}
+
+	var captured []push.CapturedNotification
+	if payload.Clear {
+		captured = h.MockSender.TakeCaptured()
+	} else {
+		captured = h.MockSender.Captured()
+	}
+
+	notifications := make([]capturedNotificationResponse, len(captured))
+	for i, notification := range captured {
+		notifications[i] = capturedNotificationResponse{
+			DeviceID:    notification.Device.ID,
+			DeviceType:  notification.Device.Type,
+			DeviceToken: notification.Device.Token,
+			UserID:      notification.Device.AuthInfoID,
+			Topic:       notification.Device.Topic,
+			Payload:     notification.Payload,
+			Error:       notification.Error,
+			CapturedAt:  notification.CapturedAt.Format(time.RFC3339),
+		}
+	}
+	response.Result = map[string]interface{}{
+		"notifications": notifications,
+	}
+}
@@ -0,0 +1,107 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/skygeario/skygear-server/pkg/server/handler/handlertest"
+	"github.com/skygeario/skygear-server/pkg/server/push"
+	"github.com/skygeario/skygear-server/pkg/server/router"
+	"github.com/skygeario/skygear-server/pkg/server/skydb"
+	. "github.com/skygeario/skygear-server/pkg/server/skytest"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestPushCapturedHandler(t *testing.T) {
+	Convey("PushCapturedHandler", t, func() {
+		sender := &push.MockSender{
+			FailureRules: []push.MockFailureRule{
+				{TokenPattern: "throttled-*", Failure: push.MockRateLimited},
+			},
+		}
+		sender.Send(push.MapMapper{"apns": map[string]interface{}{"aps": map[string]interface{}{"alert": "Hello"}}}, skydb.Device{
+			ID:         "device1",
+			Type:       "ios",
+			Token:      "token1",
+			AuthInfoID: "johndoe",
+		})
+		sender.Send(push.MapMapper{"fcm": map[string]interface{}{}}, skydb.Device{
+			ID:    "device2",
+			Type:  "android",
+			Token: "throttled-1",
+			Topic: "news",
+		})
+
+		handler := &PushCapturedHandler{MockSender: sender}
+		r := handlertest.NewSingleRouteRouter(handler, func(p *router.Payload) {})
+
+		Convey("lists captured notifications", func() {
+			resp := r.POST(`{}`)
+			So(resp.Code, ShouldEqual, 200)
+
+			body := struct {
+				Result struct {
+					Notifications []map[string]interface{} `json:"notifications"`
+				} `json:"result"`
+			}{}
+			So(json.Unmarshal(resp.Body.Bytes(), &body), ShouldBeNil)
+			notifications := body.Result.Notifications
+			So(len(notifications), ShouldEqual, 2)
+			So(notifications[0]["captured_at"], ShouldNotBeEmpty)
+			delete(notifications[0], "captured_at")
+			delete(notifications[1], "captured_at")
+
+			data, _ := json.Marshal(notifications)
+			So(data, ShouldEqualJSON, `[
+				{
+					"device_id": "device1",
+					"device_type": "ios",
+					"device_token": "token1",
+					"user_id": "johndoe",
+					"payload": {"apns": {"aps": {"alert": "Hello"}}}
+				},
+				{
+					"device_id": "device2",
+					"device_type": "android",
+					"device_token": "throttled-1",
+					"topic": "news",
+					"payload": {"fcm": {}},
+					"error": "push/mock: Too Many Requests"
+				}
+			]`)
+			So(len(sender.Captured()), ShouldEqual, 2)
+		})
+
+		Convey("clears captured notifications", func() {
+			resp := r.POST(`{"clear": true}`)
+			So(resp.Code, ShouldEqual, 200)
+			So(sender.Captured(), ShouldBeEmpty)
+		})
+
+		Convey("returns error if mock sender is not enabled", func() {
+			handler.MockSender = nil
+			resp := r.POST(`{}`)
+			So(resp.Body.Bytes(), ShouldEqualJSON, `{
+				"error": {
+					"code": 125,
+					"name": "NotConfigured",
+					"message": "mock push sender is not enabled"
+				}
+			}`)
+		})
+	})
+}
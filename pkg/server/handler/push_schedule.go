@@ -0,0 +1,549 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/mitchellh/mapstructure"
+	"github.com/sirupsen/logrus"
+
+	"github.com/skygeario/skygear-server/pkg/server/job"
+	"github.com/skygeario/skygear-server/pkg/server/push"
+	"github.com/skygeario/skygear-server/pkg/server/router"
+	"github.com/skygeario/skygear-server/pkg/server/skydb"
+	"github.com/skygeario/skygear-server/pkg/server/skyerr"
+)
+
+// pushScheduleRunAction is the action executed by the jobs of a push
+// schedule.
+const pushScheduleRunAction = "push:schedule:run"
+
+// localTimeLayout is the layout of local_time of push:schedule, which is
+// a date and time without time zone.
+const localTimeLayout = "2006-01-02T15:04:05"
+
+// pushScheduleJobKeyPrefix returns the prefix of the keys of the jobs of
+// a push schedule, so that all jobs of the schedule can be cancelled
+// together.
+func pushScheduleJobKeyPrefix(scheduleID string) string {
+	return fmt.Sprintf("push:%s:", scheduleID)
+}
+
+// pushRequest is the payload of a push action which can be scheduled.
+type pushRequest interface {
+	Decode(data map[string]interface{}) skyerr.Error
+}
+
+// decodePushRequest decodes the payload of the push action named in the
+// action field of data.
+func decodePushRequest(data map[string]interface{}) (string, pushRequest, skyerr.Error) {
+	action, _ := data["action"].(string)
+
+	var request pushRequest
+	switch action {
+	case "push:user":
+		request = &pushToUserPayload{}
+	case "push:device":
+		request = &pushToDevicePayload{}
+	case "push:query":
+		request = &pushToQueryPayload{}
+	case "push:topic":
+		request = &pushToTopicPayload{}
+	default:
+		return "", nil, skyerr.NewInvalidArgument(
+			fmt.Sprintf(`push action "%s" cannot be scheduled`, action),
+			[]string{"push"},
+		)
+	}
+
+	if skyErr := request.Decode(data); skyErr != nil {
+		return "", nil, skyErr
+	}
+	return action, request, nil
+}
+
+type pushSchedulePayload struct {
+	Push            map[string]interface{} `mapstructure:"push"`
+	AtString        string                 `mapstructure:"at"`
+	LocalTimeString string                 `mapstructure:"local_time"`
+	DefaultTimezone string                 `mapstructure:"default_timezone"`
+	action          string
+	request         pushRequest
+	at              time.Time
+	localTime       time.Time
+	defaultLocation *time.Location
+}
+
+func (payload *pushSchedulePayload) Decode(data map[string]interface{}) skyerr.Error {
+	if err := mapstructure.Decode(data, payload); err != nil {
+		return skyerr.NewError(skyerr.BadRequest, "fails to decode the request payload")
+	}
+
+	if payload.AtString != "" {
+		at, err := time.Parse(time.RFC3339, payload.AtString)
+		if err != nil {
+			return skyerr.NewInvalidArgument("invalid at", []string{"at"})
+		}
+		payload.at = at
+	}
+	if payload.LocalTimeString != "" {
+		localTime, err := time.Parse(localTimeLayout, payload.LocalTimeString)
+		if err != nil {
+			return skyerr.NewInvalidArgument("invalid local_time", []string{"local_time"})
+		}
+		payload.localTime = localTime
+	}
+
+	payload.defaultLocation = time.UTC
+	if payload.DefaultTimezone != "" {
+		location, err := time.LoadLocation(payload.DefaultTimezone)
+		if err != nil {
+			return skyerr.NewInvalidArgument("invalid default_timezone", []string{"default_timezone"})
+		}
+		payload.defaultLocation = location
+	}
+
+	if skyErr := payload.Validate(); skyErr != nil {
+		return skyErr
+	}
+
+	var skyErr skyerr.Error
+	payload.action, payload.request, skyErr = decodePushRequest(payload.Push)
+	if skyErr != nil {
+		return skyErr
+	}
+	if payload.LocalTimeString != "" && payload.action != "push:user" && payload.action != "push:query" {
+		return skyerr.NewInvalidArgument(
+			"local_time is only supported by push:user and push:query",
+			[]string{"local_time"},
+		)
+	}
+	return nil
+}
+
+func (payload *pushSchedulePayload) Validate() skyerr.Error {
+	if payload.Push == nil {
+		return skyerr.NewInvalidArgument("no push specified", []string{"push"})
+	}
+	if (payload.AtString == "") == (payload.LocalTimeString == "") {
+		return skyerr.NewInvalidArgument("either at or local_time must be specified", []string{"at", "local_time"})
+	}
+	return nil
+}
+
+// pushScheduleGroup is the push request of a job of a push schedule.
+type pushScheduleGroup struct {
+	runAt    time.Time
+	timezone string
+	userIDs  []string
+	push     map[string]interface{}
+}
+
+type pushScheduleJobResponse struct {
+	ID       string `json:"id"`
+	RunAt    string `json:"run_at"`
+	Timezone string `json:"timezone,omitempty"`
+}
+
+type pushScheduleResponse struct {
+	ID   string                    `json:"id"`
+	Jobs []pushScheduleJobResponse `json:"jobs"`
+}
+
+// PushScheduleHandler schedules a push notification to be sent at a later
+// time. The push is one of push:user, push:device, push:query and
+// push:topic, specified with the same payload as the action in `push`.
+//
+// The push is sent either at `at`, or at `local_time` in the time zone of
+// each recipient for push:user and push:query. The time zone of a user
+// is read from the `timezone` field of the user record, which is an IANA
+// time zone name such as "Asia/Hong_Kong". Users without a valid time zone
+// receive the push at `local_time` in `default_timezone`, which defaults
+// to UTC. For push:query, the query is run when the push is scheduled.
+//
+// The push is scheduled as one job for each time zone. The ID of the
+// schedule is also the push_id of the notifications sent, and can be
+// used to cancel the jobs not yet run with push:schedule:cancel.
+//
+//  curl -X POST -H "Content-Type: application/json" \
+//    -d @- http://localhost:3000/ <<EOF
+//  {
+//      "action": "push:schedule",
+//      "api_key": "MASTER_KEY",
+//      "local_time": "2017-01-01T09:00:00",
+//      "default_timezone": "Asia/Hong_Kong",
+//      "push": {
+//          "action": "push:query",
+//          "query": {"record_type": "user"},
+//          "template": "new-year"
+//      }
+//  }
+//  EOF
+type PushScheduleHandler struct {
+	AccessKey        router.Processor `preprocessor:"accesskey"`
+	RequireMasterKey router.Processor `preprocessor:"require_master_key"`
+	DBConn           router.Processor `preprocessor:"dbconn"`
+	Notification     router.Processor `preprocessor:"notification"`
+	preprocessors    []router.Processor
+}
+
+func (h *PushScheduleHandler) Setup() {
+	h.preprocessors = []router.Processor{
+		h.AccessKey,
+		h.RequireMasterKey,
+		h.DBConn,
+		h.Notification,
+	}
+}
+
+func (h *PushScheduleHandler) GetPreprocessors() []router.Processor {
+	return h.preprocessors
+}
+
+func (h *PushScheduleHandler) Handle(rpayload *router.Payload, response *router.Response) {
+	payload := pushSchedulePayload{}
+	if skyErr := payload.Decode(rpayload.Data); skyErr != nil {
+		response.Err = skyErr
+		return
+	}
+
+	conn := rpayload.DBConn
+	var groups []pushScheduleGroup
+	if payload.LocalTimeString == "" {
+		groups = []pushScheduleGroup{{
+			runAt: payload.at,
+			push:  payload.Push,
+		}}
+	} else {
+		var skyErr skyerr.Error
+		groups, skyErr = localTimeGroups(conn, rpayload.AuthInfoID, &payload)
+		if skyErr != nil {
+			response.Err = skyErr
+			return
+		}
+	}
+
+	scheduleID := uuidNew()
+	keyPrefix := pushScheduleJobKeyPrefix(scheduleID)
+	now := timeNow()
+	jobs := []pushScheduleJobResponse{}
+	for i, group := range groups {
+		j := skydb.Job{
+			Name: pushScheduleRunAction,
+			Args: map[string]interface{}{
+				"push_id": scheduleID,
+				"push":    group.push,
+			},
+			Key:         fmt.Sprintf("%s%d", keyPrefix, i),
+			RunAt:       group.runAt.UTC(),
+			MaxAttempts: job.DefaultMaxAttempts,
+			CreatedAt:   now,
+		}
+		if err := conn.CreateJob(&j); err != nil {
+			// remove the jobs created so that the push is not partially
+			// scheduled
+			if _, deleteErr := conn.DeleteJobsByKeyPrefix(keyPrefix); deleteErr != nil {
+				logrus.Errorf("Failed to remove jobs of push schedule = %s: %v", scheduleID, deleteErr)
+			}
+			response.Err = skyerr.MakeError(err)
+			return
+		}
+
+		jobs = append(jobs, pushScheduleJobResponse{
+			ID:       j.ID,
+			RunAt:    j.RunAt.Format(time.RFC3339),
+			Timezone: group.timezone,
+		})
+	}
+
+	response.Result = pushScheduleResponse{
+		ID:   scheduleID,
+		Jobs: jobs,
+	}
+}
+
+// localTimeGroups groups the users receiving the push of the payload by
+// their time zones, returning a push:user request for each time zone.
+func localTimeGroups(conn skydb.Conn, authInfoID string, payload *pushSchedulePayload) ([]pushScheduleGroup, skyerr.Error) {
+	db := conn.PublicDB()
+	userRecords := []skydb.Record{}
+
+	switch request := payload.request.(type) {
+	case *pushToUserPayload:
+		for _, userID := range request.UserIDs {
+			record := skydb.Record{
+				ID: skydb.NewRecordID(db.UserRecordType(), userID),
+			}
+			if err := db.Get(record.ID, &record); err != nil && err != skydb.ErrRecordNotFound {
+				return nil, skyerr.MakeError(err)
+			}
+			userRecords = append(userRecords, record)
+		}
+	case *pushToQueryPayload:
+		query, skyErr := request.Query(db, authInfoID)
+		if skyErr != nil {
+			return nil, skyErr
+		}
+		results, err := db.Query(&query, &skydb.AccessControlOptions{
+			BypassAccessControl: true,
+		})
+		if err != nil {
+			return nil, skyerr.MakeError(err)
+		}
+		defer results.Close()
+		for results.Scan() {
+			userRecords = append(userRecords, results.Record())
+		}
+		if err = results.Err(); err != nil {
+			return nil, skyerr.MakeError(err)
+		}
+	}
+
+	groups := []pushScheduleGroup{}
+	groupIndexes := map[string]int{}
+	for _, record := range userRecords {
+		location := payload.defaultLocation
+		if timezone, _ := record.Get("timezone").(string); timezone != "" {
+			if userLocation, err := time.LoadLocation(timezone); err == nil {
+				location = userLocation
+			}
+		}
+
+		i, ok := groupIndexes[location.String()]
+		if !ok {
+			t := payload.localTime
+			groups = append(groups, pushScheduleGroup{
+				runAt:    time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), 0, location),
+				timezone: location.String(),
+			})
+			i = len(groups) - 1
+			groupIndexes[location.String()] = i
+		}
+		groups[i].userIDs = append(groups[i].userIDs, record.ID.Key)
+	}
+
+	for i := range groups {
+		pushData := map[string]interface{}{}
+		for key, value := range payload.Push {
+			if key != "query" {
+				pushData[key] = value
+			}
+		}
+		pushData["action"] = "push:user"
+		pushData["user_ids"] = groups[i].userIDs
+		groups[i].push = pushData
+	}
+	return groups, nil
+}
+
+type pushScheduleRunPayload struct {
+	PushID  string                 `mapstructure:"push_id"`
+	Push    map[string]interface{} `mapstructure:"push"`
+	request pushRequest
+}
+
+func (payload *pushScheduleRunPayload) Decode(data map[string]interface{}) skyerr.Error {
+	args, _ := data["args"].(map[string]interface{})
+	if err := mapstructure.Decode(args, payload); err != nil {
+		return skyerr.NewError(skyerr.BadRequest, "fails to decode the request payload")
+	}
+	if skyErr := payload.Validate(); skyErr != nil {
+		return skyErr
+	}
+
+	var skyErr skyerr.Error
+	_, payload.request, skyErr = decodePushRequest(payload.Push)
+	return skyErr
+}
+
+func (payload *pushScheduleRunPayload) Validate() skyerr.Error {
+	if payload.PushID == "" {
+		return skyerr.NewInvalidArgument("empty push id", []string{"push_id"})
+	}
+	if payload.Push == nil {
+		return skyerr.NewInvalidArgument("no push specified", []string{"push"})
+	}
+	return nil
+}
+
+// PushScheduleRunHandler sends a push scheduled by push:schedule. It is
+// called by the job worker with the job args in `args`, and is not meant
+// to be called directly.
+type PushScheduleRunHandler struct {
+	NotificationSender push.Sender       `inject:"PushSender"`
+	DeliveryLog        *push.DeliveryLog `inject:"PushDeliveryLog"`
+	Broadcaster        *push.Broadcaster `inject:"PushBroadcaster"`
+	AccessKey          router.Processor  `preprocessor:"accesskey"`
+	RequireMasterKey   router.Processor  `preprocessor:"require_master_key"`
+	DBConn             router.Processor  `preprocessor:"dbconn"`
+	Notification       router.Processor  `preprocessor:"notification"`
+	PluginReady        router.Processor  `preprocessor:"plugin_ready"`
+	preprocessors      []router.Processor
+}
+
+func (h *PushScheduleRunHandler) Setup() {
+	h.preprocessors = []router.Processor{
+		h.AccessKey,
+		h.RequireMasterKey,
+		h.DBConn,
+		h.Notification,
+		h.PluginReady,
+	}
+}
+
+func (h *PushScheduleRunHandler) GetPreprocessors() []router.Processor {
+	return h.preprocessors
+}
+
+func (h *PushScheduleRunHandler) Handle(rpayload *router.Payload, response *router.Response) {
+	payload := pushScheduleRunPayload{}
+	if skyErr := payload.Decode(rpayload.Data); skyErr != nil {
+		response.Err = skyErr
+		return
+	}
+
+	conn := rpayload.DBConn
+	sender, pushID := pushSenderWithID(h.NotificationSender, h.DeliveryLog, payload.PushID)
+
+	var result interface{}
+	var skyErr skyerr.Error
+	switch request := payload.request.(type) {
+	case *pushToUserPayload:
+		result, skyErr = pushToUsers(sender, conn, request)
+	case *pushToDevicePayload:
+		result, skyErr = pushToDevices(sender, conn, request)
+	case *pushToQueryPayload:
+		result, skyErr = pushToQuery(sender, conn, "", request)
+	case *pushToTopicPayload:
+		result, skyErr = h.broadcast(sender, conn, request)
+	}
+	if skyErr != nil {
+		response.Err = skyErr
+		return
+	}
+	response.Info = pushInfo(pushID)
+	response.Result = result
+}
+
+// broadcast sends the push to the topic and waits for the notifications
+// to be sent, so that the job is completed after the broadcast.
+func (h *PushScheduleRunHandler) broadcast(sender push.Sender, conn skydb.Conn, request *pushToTopicPayload) (interface{}, skyerr.Error) {
+	content, skyErr := newPushContent(conn, request.pushContentPayload)
+	if skyErr != nil {
+		return nil, skyErr
+	}
+
+	count, err := h.Broadcaster.Broadcast(sender, request.Topic, content.mapperFunc())
+	if err != nil {
+		// failing the job after some notifications are sent would send
+		// them again when the job is retried
+		if count == 0 {
+			return nil, skyerr.MakeError(err)
+		}
+		logrus.Warnf("Failed to broadcast notification to topic = %s: %v", request.Topic, err)
+	}
+	return map[string]interface{}{
+		"topic": request.Topic,
+		"count": count,
+	}, nil
+}
+
+type pushScheduleCancelPayload struct {
+	ID string `mapstructure:"id"`
+}
+
+func (payload *pushScheduleCancelPayload) Decode(data map[string]interface{}) skyerr.Error {
+	if err := mapstructure.Decode(data, payload); err != nil {
+		return skyerr.NewError(skyerr.BadRequest, "fails to decode the request payload")
+	}
+	return payload.Validate()
+}
+
+func (payload *pushScheduleCancelPayload) Validate() skyerr.Error {
+	if payload.ID == "" {
+		return skyerr.NewInvalidArgument("empty push schedule id", []string{"id"})
+	}
+	return nil
+}
+
+// PushScheduleCancelHandler cancels the jobs of a push schedule which are
+// not yet run. Jobs of other time zones are cancelled even if the push
+// has been sent to some time zones. Jobs being run cannot be cancelled,
+// and are reported as running_jobs.
+//
+//  curl -X POST -H "Content-Type: application/json" \
+//    -d @- http://localhost:3000/ <<EOF
+//  {
+//      "action": "push:schedule:cancel",
+//      "api_key": "MASTER_KEY",
+//      "id": "1E8E6E46-0A8B-4A9A-9C8B-2B3A6C1F4D3E"
+//  }
+//  EOF
+type PushScheduleCancelHandler struct {
+	AccessKey        router.Processor `preprocessor:"accesskey"`
+	RequireMasterKey router.Processor `preprocessor:"require_master_key"`
+	DBConn           router.Processor `preprocessor:"dbconn"`
+	preprocessors    []router.Processor
+}
+
+func (h *PushScheduleCancelHandler) Setup() {
+	h.preprocessors = []router.Processor{
+		h.AccessKey,
+		h.RequireMasterKey,
+		h.DBConn,
+	}
+}
+
+func (h *PushScheduleCancelHandler) GetPreprocessors() []router.Processor {
+	return h.preprocessors
+}
+
+func (h *PushScheduleCancelHandler) Handle(rpayload *router.Payload, response *router.Response) {
+	payload := pushScheduleCancelPayload{}
+	if skyErr := payload.Decode(rpayload.Data); skyErr != nil {
+		response.Err = skyErr
+		return
+	}
+
+	count, running, err := rpayload.DBConn.CancelJobsByKeyPrefix(pushScheduleJobKeyPrefix(payload.ID), timeNow())
+	if err != nil {
+		response.Err = skyerr.MakeError(err)
+		return
+	}
+	if count == 0 && running > 0 {
+		response.Err = skyerr.NewErrorWithInfo(
+			skyerr.NotSupported,
+			fmt.Sprintf(`push schedule "%s" is being sent and cannot be cancelled`, payload.ID),
+			map[string]interface{}{"id": payload.ID, "running_jobs": running},
+		)
+		return
+	}
+	if count == 0 {
+		response.Err = skyerr.NewErrorWithInfo(
+			skyerr.ResourceNotFound,
+			fmt.Sprintf(`cannot find pending push schedule "%s"`, payload.ID),
+			map[string]interface{}{"id": payload.ID},
+		)
+		return
+	}
+
+	response.Result = map[string]interface{}{
+		"id":             payload.ID,
+		"cancelled_jobs": count,
+		"running_jobs":   running,
+	}
+}
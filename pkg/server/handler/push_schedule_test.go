@@ -0,0 +1,388 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"testing"
+	"time"
+
+	"github.com/skygeario/skygear-server/pkg/server/handler/handlertest"
+	. "github.com/skygeario/skygear-server/pkg/server/skytest"
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/skygeario/skygear-server/pkg/server/push"
+	"github.com/skygeario/skygear-server/pkg/server/router"
+	"github.com/skygeario/skygear-server/pkg/server/skydb"
+	"github.com/skygeario/skygear-server/pkg/server/skydb/skydbtest"
+)
+
+func TestPushScheduleHandler(t *testing.T) {
+	Convey("PushScheduleHandler", t, func() {
+		realTime := timeNow
+		timeNow = func() time.Time { return time.Date(2016, 12, 31, 0, 0, 0, 0, time.UTC) }
+		realUUIDNew := uuidNew
+		uuidNew = func() string { return "schedule-id" }
+		defer func() {
+			timeNow = realTime
+			uuidNew = realUUIDNew
+		}()
+
+		db := &userQueryDB{
+			MapDB: skydbtest.NewMapDB(),
+			users: []skydb.Record{
+				{
+					ID:   skydb.NewRecordID("user", "johndoe"),
+					Data: map[string]interface{}{"timezone": "America/New_York"},
+				},
+				{
+					ID: skydb.NewRecordID("user", "janedoe"),
+				},
+			},
+		}
+		db.RecordMap["user/faseng"] = skydb.Record{
+			ID:   skydb.NewRecordID("user", "faseng"),
+			Data: map[string]interface{}{"timezone": "Asia/Hong_Kong"},
+		}
+		db.RecordMap["user/chima"] = skydb.Record{
+			ID:   skydb.NewRecordID("user", "chima"),
+			Data: map[string]interface{}{"timezone": "Invalid/Zone"},
+		}
+		conn := skydbtest.NewMapConn()
+		conn.InternalPublicDB = db
+
+		r := handlertest.NewSingleRouteRouter(&PushScheduleHandler{}, func(p *router.Payload) {
+			p.DBConn = conn
+		})
+
+		Convey("schedules push at specified time", func() {
+			resp := r.POST(`{
+				"at": "2017-01-01T00:00:00Z",
+				"push": {
+					"action": "push:topic",
+					"topic": "news",
+					"notification": {"aps": {"alert": "Happy new year"}}
+				}
+			}`)
+			So(resp.Body.Bytes(), ShouldEqualJSON, `{
+				"result": {
+					"id": "schedule-id",
+					"jobs": [{"id": "job-0", "run_at": "2017-01-01T00:00:00Z"}]
+				}
+			}`)
+
+			j := conn.JobMap["job-0"]
+			So(j.Name, ShouldEqual, "push:schedule:run")
+			So(j.Key, ShouldEqual, "push:schedule-id:0")
+			So(j.RunAt, ShouldResemble, time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC))
+			So(j.Args, ShouldResemble, map[string]interface{}{
+				"push_id": "schedule-id",
+				"push": map[string]interface{}{
+					"action":       "push:topic",
+					"topic":        "news",
+					"notification": map[string]interface{}{"aps": map[string]interface{}{"alert": "Happy new year"}},
+				},
+			})
+		})
+
+		Convey("schedules push to users at local time of each time zone", func() {
+			resp := r.POST(`{
+				"local_time": "2017-01-01T09:00:00",
+				"push": {
+					"action": "push:user",
+					"user_ids": ["faseng", "chima", "notexist"],
+					"template": "new-year"
+				}
+			}`)
+			So(resp.Body.Bytes(), ShouldEqualJSON, `{
+				"result": {
+					"id": "schedule-id",
+					"jobs": [
+						{"id": "job-0", "run_at": "2017-01-01T01:00:00Z", "timezone": "Asia/Hong_Kong"},
+						{"id": "job-1", "run_at": "2017-01-01T09:00:00Z", "timezone": "UTC"}
+					]
+				}
+			}`)
+
+			args := conn.JobMap["job-1"].Args.(map[string]interface{})
+			So(args["push"], ShouldResemble, map[string]interface{}{
+				"action":   "push:user",
+				"user_ids": []string{"chima", "notexist"},
+				"template": "new-year",
+			})
+		})
+
+		Convey("schedules push to users matched by query at local time", func() {
+			resp := r.POST(`{
+				"local_time": "2017-01-01T09:00:00",
+				"default_timezone": "Asia/Tokyo",
+				"push": {
+					"action": "push:query",
+					"query": {"record_type": "user"},
+					"topic": "greetings",
+					"notification": {"aps": {"alert": "Happy new year"}}
+				}
+			}`)
+			So(resp.Body.Bytes(), ShouldEqualJSON, `{
+				"result": {
+					"id": "schedule-id",
+					"jobs": [
+						{"id": "job-0", "run_at": "2017-01-01T14:00:00Z", "timezone": "America/New_York"},
+						{"id": "job-1", "run_at": "2017-01-01T00:00:00Z", "timezone": "Asia/Tokyo"}
+					]
+				}
+			}`)
+			So(db.accessControlOptions.BypassAccessControl, ShouldBeTrue)
+
+			args := conn.JobMap["job-0"].Args.(map[string]interface{})
+			So(args["push"], ShouldResemble, map[string]interface{}{
+				"action":       "push:user",
+				"user_ids":     []string{"johndoe"},
+				"topic":        "greetings",
+				"notification": map[string]interface{}{"aps": map[string]interface{}{"alert": "Happy new year"}},
+			})
+		})
+
+		Convey("rejects local time for push to topic", func() {
+			resp := r.POST(`{
+				"local_time": "2017-01-01T09:00:00",
+				"push": {
+					"action": "push:topic",
+					"topic": "news",
+					"notification": {"aps": {"alert": "Happy new year"}}
+				}
+			}`)
+			So(resp.Code, ShouldEqual, 400)
+			So(resp.Body.String(), ShouldContainSubstring, "local_time is only supported")
+			So(conn.JobMap, ShouldBeEmpty)
+		})
+
+		Convey("rejects push with both at and local time", func() {
+			resp := r.POST(`{
+				"at": "2017-01-01T00:00:00Z",
+				"local_time": "2017-01-01T09:00:00",
+				"push": {
+					"action": "push:topic",
+					"topic": "news",
+					"notification": {"aps": {"alert": "Happy new year"}}
+				}
+			}`)
+			So(resp.Body.Bytes(), ShouldEqualJSON, `{
+				"error": {
+					"code": 108,
+					"name": "InvalidArgument",
+					"message": "either at or local_time must be specified",
+					"info": {"arguments": ["at", "local_time"]}
+				}
+			}`)
+		})
+
+		Convey("rejects push action which cannot be scheduled", func() {
+			resp := r.POST(`{
+				"at": "2017-01-01T00:00:00Z",
+				"push": {"action": "push:status", "push_id": "push-id"}
+			}`)
+			So(resp.Code, ShouldEqual, 400)
+			So(resp.Body.String(), ShouldContainSubstring, `push action \"push:status\" cannot be scheduled`)
+		})
+
+		Convey("rejects invalid push payload", func() {
+			resp := r.POST(`{
+				"at": "2017-01-01T00:00:00Z",
+				"push": {"action": "push:user", "user_ids": ["faseng"]}
+			}`)
+			So(resp.Code, ShouldEqual, 400)
+			So(resp.Body.String(), ShouldContainSubstring, "no notification specified")
+		})
+	})
+}
+
+func TestPushScheduleRunHandler(t *testing.T) {
+	Convey("PushScheduleRunHandler", t, func() {
+		testdevice1 := skydb.Device{
+			ID:         "device1",
+			Type:       "ios",
+			Token:      "token1",
+			Topic:      "news",
+			AuthInfoID: "johndoe",
+		}
+		testdevice2 := skydb.Device{
+			ID:         "device2",
+			Type:       "ios",
+			Token:      "token2",
+			Topic:      "news",
+			AuthInfoID: "janedoe",
+		}
+		mapConn := skydbtest.NewMapConn()
+		conn := simpleDeviceConn{
+			devices: []skydb.Device{testdevice1, testdevice2},
+			Conn:    mapConn,
+		}
+
+		sentDevices := []string{}
+		r := handlertest.NewSingleRouteRouter(&PushScheduleRunHandler{
+			DeliveryLog: &push.DeliveryLog{
+				ConnOpener: func() (skydb.Conn, error) { return mapConn, nil },
+				Sender: senderFunc(func(m push.Mapper, device skydb.Device) error {
+					sentDevices = append(sentDevices, device.ID)
+					return nil
+				}),
+			},
+			Broadcaster: &push.Broadcaster{
+				ConnOpener:  func() (skydb.Conn, error) { return &conn, nil },
+				Concurrency: 1,
+			},
+		}, func(p *router.Payload) {
+			p.DBConn = &conn
+		})
+
+		originalSendFunc := sendPushNotification
+		defer func() {
+			sendPushNotification = originalSendFunc
+		}()
+		sendPushNotification = func(sender push.Sender, device skydb.Device, m push.Mapper) {
+			sender.Send(m, device)
+		}
+
+		Convey("sends push to users under the push id", func() {
+			resp := r.POST(`{
+				"args": {
+					"push_id": "schedule-id",
+					"push": {
+						"action": "push:user",
+						"user_ids": ["johndoe"],
+						"notification": {"aps": {"alert": "Hello"}}
+					}
+				}
+			}`)
+			So(resp.Body.Bytes(), ShouldEqualJSON, `{
+				"info": {"push_id": "schedule-id"},
+				"result": [{"_id": "johndoe"}]
+			}`)
+			So(sentDevices, ShouldResemble, []string{"device1"})
+
+			deliveries, _ := mapConn.QueryPushDeliveries("schedule-id")
+			So(len(deliveries), ShouldEqual, 1)
+		})
+
+		Convey("broadcasts push to topic", func() {
+			resp := r.POST(`{
+				"args": {
+					"push_id": "schedule-id",
+					"push": {
+						"action": "push:topic",
+						"topic": "news",
+						"notification": {"aps": {"alert": "Hello"}}
+					}
+				}
+			}`)
+			So(resp.Body.Bytes(), ShouldEqualJSON, `{
+				"info": {"push_id": "schedule-id"},
+				"result": {"topic": "news", "count": 2}
+			}`)
+			So(sentDevices, ShouldResemble, []string{"device1", "device2"})
+		})
+
+		Convey("rejects args without push id", func() {
+			resp := r.POST(`{
+				"args": {
+					"push": {
+						"action": "push:topic",
+						"topic": "news",
+						"notification": {"aps": {"alert": "Hello"}}
+					}
+				}
+			}`)
+			So(resp.Code, ShouldEqual, 400)
+			So(sentDevices, ShouldBeEmpty)
+		})
+	})
+}
+
+func TestPushScheduleCancelHandler(t *testing.T) {
+	Convey("PushScheduleCancelHandler", t, func() {
+		conn := skydbtest.NewMapConn()
+		conn.JobMap["job-0"] = skydb.Job{ID: "job-0", Key: "push:schedule-id:0"}
+		conn.JobMap["job-1"] = skydb.Job{ID: "job-1", Key: "push:schedule-id:1"}
+		conn.JobMap["job-2"] = skydb.Job{ID: "job-2", Key: "push:other-id:0"}
+
+		r := handlertest.NewSingleRouteRouter(&PushScheduleCancelHandler{}, func(p *router.Payload) {
+			p.DBConn = conn
+		})
+
+		Convey("cancels jobs of the schedule", func() {
+			resp := r.POST(`{"id": "schedule-id"}`)
+			So(resp.Body.Bytes(), ShouldEqualJSON, `{
+				"result": {"id": "schedule-id", "cancelled_jobs": 2, "running_jobs": 0}
+			}`)
+			So(conn.JobMap, ShouldContainKey, "job-2")
+			So(len(conn.JobMap), ShouldEqual, 1)
+		})
+
+		Convey("does not cancel jobs being run", func() {
+			job := conn.JobMap["job-1"]
+			job.ClaimedUntil = time.Now().Add(time.Minute)
+			conn.JobMap["job-1"] = job
+
+			resp := r.POST(`{"id": "schedule-id"}`)
+			So(resp.Body.Bytes(), ShouldEqualJSON, `{
+				"result": {"id": "schedule-id", "cancelled_jobs": 1, "running_jobs": 1}
+			}`)
+			So(conn.JobMap, ShouldContainKey, "job-1")
+			So(len(conn.JobMap), ShouldEqual, 2)
+		})
+
+		Convey("cancels jobs of expired claim", func() {
+			job := conn.JobMap["job-1"]
+			job.ClaimedUntil = time.Now().Add(-time.Minute)
+			conn.JobMap["job-1"] = job
+
+			resp := r.POST(`{"id": "schedule-id"}`)
+			So(resp.Body.Bytes(), ShouldEqualJSON, `{
+				"result": {"id": "schedule-id", "cancelled_jobs": 2, "running_jobs": 0}
+			}`)
+		})
+
+		Convey("errors if all jobs are being run", func() {
+			for _, id := range []string{"job-0", "job-1"} {
+				job := conn.JobMap[id]
+				job.ClaimedUntil = time.Now().Add(time.Minute)
+				conn.JobMap[id] = job
+			}
+
+			resp := r.POST(`{"id": "schedule-id"}`)
+			So(resp.Body.Bytes(), ShouldEqualJSON, `{
+				"error": {
+					"code": 111,
+					"name": "NotSupported",
+					"message": "push schedule \"schedule-id\" is being sent and cannot be cancelled",
+					"info": {"id": "schedule-id", "running_jobs": 2}
+				}
+			}`)
+			So(len(conn.JobMap), ShouldEqual, 3)
+		})
+
+		Convey("returns not found for schedule without pending jobs", func() {
+			resp := r.POST(`{"id": "notexist"}`)
+			So(resp.Body.Bytes(), ShouldEqualJSON, `{
+				"error": {
+					"code": 110,
+					"name": "ResourceNotFound",
+					"message": "cannot find pending push schedule \"notexist\"",
+					"info": {"id": "notexist"}
+				}
+			}`)
+		})
+	})
+}
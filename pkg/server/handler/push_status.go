@@ -0,0 +1,150 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/mitchellh/mapstructure"
+
+	"github.com/skygeario/skygear-server/pkg/server/router"
+	"github.com/skygeario/skygear-server/pkg/server/skydb"
+	"github.com/skygeario/skygear-server/pkg/server/skyerr"
+)
+
+type pushStatusPayload struct {
+	PushID string `mapstructure:"push_id"`
+}
+
+func (payload *pushStatusPayload) Decode(data map[string]interface{}) skyerr.Error {
+	if err := mapstructure.Decode(data, payload); err != nil {
+		return skyerr.NewError(skyerr.BadRequest, "fails to decode the request payload")
+	}
+	return payload.Validate()
+}
+
+func (payload *pushStatusPayload) Validate() skyerr.Error {
+	if payload.PushID == "" {
+		return skyerr.NewInvalidArgument("empty push id", []string{"push_id"})
+	}
+	return nil
+}
+
+type pushDeliveryResponse struct {
+	ID            string `json:"id"`
+	DeviceID      string `json:"device_id"`
+	UserID        string `json:"user_id,omitempty"`
+	PayloadHash   string `json:"payload_hash"`
+	Status        string `json:"status"`
+	Attempts      int    `json:"attempts"`
+	Response      string `json:"response,omitempty"`
+	NextAttemptAt string `json:"next_attempt_at,omitempty"`
+	CreatedAt     string `json:"created_at"`
+	UpdatedAt     string `json:"updated_at"`
+}
+
+type pushStatusResponse struct {
+	PushID     string                 `json:"push_id"`
+	Summary    map[string]int         `json:"summary"`
+	Deliveries []pushDeliveryResponse `json:"deliveries"`
+}
+
+// PushStatusHandler returns the delivery status of a push notification
+// sent by push:user, push:device, push:query, push:topic or push:schedule,
+// identified by the push_id in the info of their response.
+//
+// The status of each device is one of pending, sent, retrying and failed.
+// Notifications failed with transient errors of the push services are
+// retried with exponential backoff. Deliveries not retrying are kept for
+// a week.
+//
+//  curl -X POST -H "Content-Type: application/json" \
+//    -d @- http://localhost:3000/ <<EOF
+//  {
+//      "action": "push:status",
+//      "api_key": "MASTER_KEY",
+//      "push_id": "1E8E6E46-0A8B-4A9A-9C8B-2B3A6C1F4D3E"
+//  }
+//  EOF
+type PushStatusHandler struct {
+	AccessKey        router.Processor `preprocessor:"accesskey"`
+	RequireMasterKey router.Processor `preprocessor:"require_master_key"`
+	DBConn           router.Processor `preprocessor:"dbconn"`
+	preprocessors    []router.Processor
+}
+
+func (h *PushStatusHandler) Setup() {
+	h.preprocessors = []router.Processor{
+		h.AccessKey,
+		h.RequireMasterKey,
+		h.DBConn,
+	}
+}
+
+func (h *PushStatusHandler) GetPreprocessors() []router.Processor {
+	return h.preprocessors
+}
+
+func (h *PushStatusHandler) Handle(rpayload *router.Payload, response *router.Response) {
+	payload := pushStatusPayload{}
+	if skyErr := payload.Decode(rpayload.Data); skyErr != nil {
+		response.Err = skyErr
+		return
+	}
+
+	deliveries, err := rpayload.DBConn.QueryPushDeliveries(payload.PushID)
+	if err != nil {
+		response.Err = skyerr.MakeError(err)
+		return
+	}
+	if len(deliveries) == 0 {
+		response.Err = skyerr.NewErrorWithInfo(
+			skyerr.ResourceNotFound,
+			fmt.Sprintf(`cannot find push "%s"`, payload.PushID),
+			map[string]interface{}{"push_id": payload.PushID},
+		)
+		return
+	}
+
+	result := pushStatusResponse{
+		PushID: payload.PushID,
+		Summary: map[string]int{
+			string(skydb.PushDeliveryPending):  0,
+			string(skydb.PushDeliverySent):     0,
+			string(skydb.PushDeliveryRetrying): 0,
+			string(skydb.PushDeliveryFailed):   0,
+		},
+		Deliveries: make([]pushDeliveryResponse, len(deliveries)),
+	}
+	for i, delivery := range deliveries {
+		result.Summary[string(delivery.Status)]++
+		result.Deliveries[i] = pushDeliveryResponse{
+			ID:          delivery.ID,
+			DeviceID:    delivery.DeviceID,
+			UserID:      delivery.UserID,
+			PayloadHash: delivery.PayloadHash,
+			Status:      string(delivery.Status),
+			Attempts:    delivery.Attempts,
+			Response:    delivery.Response,
+			CreatedAt:   delivery.CreatedAt.Format(time.RFC3339),
+			UpdatedAt:   delivery.UpdatedAt.Format(time.RFC3339),
+		}
+		if !delivery.NextAttemptAt.IsZero() {
+			result.Deliveries[i].NextAttemptAt = delivery.NextAttemptAt.Format(time.RFC3339)
+		}
+	}
+	response.Result = result
+}
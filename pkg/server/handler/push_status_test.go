@@ -0,0 +1,108 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"testing"
+	"time"
+
+	"github.com/skygeario/skygear-server/pkg/server/handler/handlertest"
+	"github.com/skygeario/skygear-server/pkg/server/router"
+	"github.com/skygeario/skygear-server/pkg/server/skydb"
+	"github.com/skygeario/skygear-server/pkg/server/skydb/skydbtest"
+	. "github.com/skygeario/skygear-server/pkg/server/skytest"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestPushStatusHandler(t *testing.T) {
+	Convey("PushStatusHandler", t, func() {
+		createdAt := time.Date(2006, 1, 2, 15, 4, 5, 0, time.UTC)
+		conn := skydbtest.NewMapConn()
+		conn.PushDeliveryMap["delivery-0"] = skydb.PushDelivery{
+			ID:          "delivery-0",
+			PushID:      "push",
+			DeviceID:    "device1",
+			UserID:      "johndoe",
+			PayloadHash: "hash",
+			Status:      skydb.PushDeliverySent,
+			Attempts:    1,
+			CreatedAt:   createdAt,
+			UpdatedAt:   createdAt,
+		}
+		conn.PushDeliveryMap["delivery-1"] = skydb.PushDelivery{
+			ID:            "delivery-1",
+			PushID:        "push",
+			DeviceID:      "device2",
+			UserID:        "johndoe",
+			PayloadHash:   "hash",
+			Status:        skydb.PushDeliveryRetrying,
+			Attempts:      1,
+			Response:      "503 status code",
+			NextAttemptAt: createdAt.Add(30 * time.Second),
+			CreatedAt:     createdAt,
+			UpdatedAt:     createdAt,
+		}
+
+		r := handlertest.NewSingleRouteRouter(&PushStatusHandler{}, func(p *router.Payload) {
+			p.DBConn = conn
+		})
+
+		Convey("returns status of push", func() {
+			resp := r.POST(`{"push_id": "push"}`)
+			So(resp.Body.Bytes(), ShouldEqualJSON, `{
+				"result": {
+					"push_id": "push",
+					"summary": {
+						"pending": 0,
+						"sent": 1,
+						"retrying": 1,
+						"failed": 0
+					},
+					"deliveries": [{
+						"id": "delivery-0",
+						"device_id": "device1",
+						"user_id": "johndoe",
+						"payload_hash": "hash",
+						"status": "sent",
+						"attempts": 1,
+						"created_at": "2006-01-02T15:04:05Z",
+						"updated_at": "2006-01-02T15:04:05Z"
+					}, {
+						"id": "delivery-1",
+						"device_id": "device2",
+						"user_id": "johndoe",
+						"payload_hash": "hash",
+						"status": "retrying",
+						"attempts": 1,
+						"response": "503 status code",
+						"next_attempt_at": "2006-01-02T15:04:35Z",
+						"created_at": "2006-01-02T15:04:05Z",
+						"updated_at": "2006-01-02T15:04:05Z"
+					}]
+				}
+			}`)
+		})
+
+		Convey("returns error for non-existent push", func() {
+			resp := r.POST(`{"push_id": "nonexistent"}`)
+			So(resp.Code, ShouldEqual, 404)
+		})
+
+		Convey("returns error without push id", func() {
+			resp := r.POST(`{}`)
+			So(resp.Code, ShouldEqual, 400)
+		})
+	})
+}
@@ -0,0 +1,260 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"fmt"
+
+	"github.com/mitchellh/mapstructure"
+
+	"github.com/skygeario/skygear-server/pkg/server/push"
+	"github.com/skygeario/skygear-server/pkg/server/router"
+	"github.com/skygeario/skygear-server/pkg/server/skydb"
+	"github.com/skygeario/skygear-server/pkg/server/skyerr"
+)
+
+type pushTemplateSavePayload struct {
+	Template skydb.PushTemplate `mapstructure:"template"`
+}
+
+func (payload *pushTemplateSavePayload) Decode(data map[string]interface{}) skyerr.Error {
+	decoder, err := mapstructure.NewDecoder(&mapstructure.DecoderConfig{
+		TagName: "json",
+		Result:  payload,
+	})
+	if err != nil {
+		panic(err)
+	}
+
+	if err = decoder.Decode(data); err != nil {
+		return skyerr.NewError(skyerr.BadRequest, "fails to decode the request payload")
+	}
+	return payload.Validate()
+}
+
+func (payload *pushTemplateSavePayload) Validate() skyerr.Error {
+	if payload.Template.Name == "" {
+		return skyerr.NewInvalidArgument("empty template name", []string{"template"})
+	}
+	if err := push.ValidateTemplate(payload.Template); err != nil {
+		return skyerr.NewInvalidArgument(err.Error(), []string{"template"})
+	}
+	return nil
+}
+
+// PushTemplateSaveHandler creates or replaces a push template.
+//
+// A push template contains content in one or more locales. Title, body
+// and strings in data and the platform dictionaries (apns, fcm and
+// baidu-android) are rendered with text/template syntax, where the data
+// supplied in push:user, push:device or push:query is available.
+//
+//  curl -X POST -H "Content-Type: application/json" \
+//    -d @- http://localhost:3000/ <<EOF
+//  {
+//      "action": "push:template:save",
+//      "api_key": "MASTER_KEY",
+//      "template": {
+//          "name": "welcome",
+//          "default_locale": "en",
+//          "locales": {
+//              "en": {"title": "Welcome", "body": "Hello {{.name}}"},
+//              "zh-HK": {"title": "歡迎", "body": "{{.name}}你好"}
+//          }
+//      }
+//  }
+//  EOF
+type PushTemplateSaveHandler struct {
+	AccessKey        router.Processor `preprocessor:"accesskey"`
+	RequireMasterKey router.Processor `preprocessor:"require_master_key"`
+	DBConn           router.Processor `preprocessor:"dbconn"`
+	preprocessors    []router.Processor
+}
+
+func (h *PushTemplateSaveHandler) Setup() {
+	h.preprocessors = []router.Processor{
+		h.AccessKey,
+		h.RequireMasterKey,
+		h.DBConn,
+	}
+}
+
+func (h *PushTemplateSaveHandler) GetPreprocessors() []router.Processor {
+	return h.preprocessors
+}
+
+func (h *PushTemplateSaveHandler) Handle(rpayload *router.Payload, response *router.Response) {
+	payload := pushTemplateSavePayload{}
+	if skyErr := payload.Decode(rpayload.Data); skyErr != nil {
+		response.Err = skyErr
+		return
+	}
+
+	template := payload.Template
+	template.UpdatedAt = timeNow()
+	if err := rpayload.DBConn.SavePushTemplate(&template); err != nil {
+		response.Err = skyerr.MakeError(err)
+		return
+	}
+	response.Result = template
+}
+
+type pushTemplateFetchPayload struct {
+	Names []string `mapstructure:"names"`
+}
+
+func (payload *pushTemplateFetchPayload) Decode(data map[string]interface{}) skyerr.Error {
+	if err := mapstructure.Decode(data, payload); err != nil {
+		return skyerr.NewError(skyerr.BadRequest, "fails to decode the request payload")
+	}
+	return nil
+}
+
+// PushTemplateFetchHandler returns the push templates of the specified
+// names, or all push templates if no names are specified.
+//
+//  curl -X POST -H "Content-Type: application/json" \
+//    -d @- http://localhost:3000/ <<EOF
+//  {
+//      "action": "push:template:fetch",
+//      "api_key": "MASTER_KEY",
+//      "names": ["welcome"]
+//  }
+//  EOF
+type PushTemplateFetchHandler struct {
+	AccessKey        router.Processor `preprocessor:"accesskey"`
+	RequireMasterKey router.Processor `preprocessor:"require_master_key"`
+	DBConn           router.Processor `preprocessor:"dbconn"`
+	preprocessors    []router.Processor
+}
+
+func (h *PushTemplateFetchHandler) Setup() {
+	h.preprocessors = []router.Processor{
+		h.AccessKey,
+		h.RequireMasterKey,
+		h.DBConn,
+	}
+}
+
+func (h *PushTemplateFetchHandler) GetPreprocessors() []router.Processor {
+	return h.preprocessors
+}
+
+func (h *PushTemplateFetchHandler) Handle(rpayload *router.Payload, response *router.Response) {
+	payload := pushTemplateFetchPayload{}
+	if skyErr := payload.Decode(rpayload.Data); skyErr != nil {
+		response.Err = skyErr
+		return
+	}
+
+	conn := rpayload.DBConn
+	if len(payload.Names) == 0 {
+		templates, err := conn.QueryPushTemplates()
+		if err != nil {
+			response.Err = skyerr.MakeError(err)
+			return
+		}
+		response.Result = templates
+		return
+	}
+
+	templates := []skydb.PushTemplate{}
+	for _, name := range payload.Names {
+		template := skydb.PushTemplate{}
+		if err := conn.GetPushTemplate(name, &template); err == skydb.ErrPushTemplateNotFound {
+			response.Err = pushTemplateNotFoundError(name)
+			return
+		} else if err != nil {
+			response.Err = skyerr.MakeError(err)
+			return
+		}
+		templates = append(templates, template)
+	}
+	response.Result = templates
+}
+
+type pushTemplateDeletePayload struct {
+	Name string `mapstructure:"name"`
+}
+
+func (payload *pushTemplateDeletePayload) Decode(data map[string]interface{}) skyerr.Error {
+	if err := mapstructure.Decode(data, payload); err != nil {
+		return skyerr.NewError(skyerr.BadRequest, "fails to decode the request payload")
+	}
+	return payload.Validate()
+}
+
+func (payload *pushTemplateDeletePayload) Validate() skyerr.Error {
+	if payload.Name == "" {
+		return skyerr.NewInvalidArgument("empty template name", []string{"name"})
+	}
+	return nil
+}
+
+// PushTemplateDeleteHandler deletes a push template.
+//
+//  curl -X POST -H "Content-Type: application/json" \
+//    -d @- http://localhost:3000/ <<EOF
+//  {
+//      "action": "push:template:delete",
+//      "api_key": "MASTER_KEY",
+//      "name": "welcome"
+//  }
+//  EOF
+type PushTemplateDeleteHandler struct {
+	AccessKey        router.Processor `preprocessor:"accesskey"`
+	RequireMasterKey router.Processor `preprocessor:"require_master_key"`
+	DBConn           router.Processor `preprocessor:"dbconn"`
+	preprocessors    []router.Processor
+}
+
+func (h *PushTemplateDeleteHandler) Setup() {
+	h.preprocessors = []router.Processor{
+		h.AccessKey,
+		h.RequireMasterKey,
+		h.DBConn,
+	}
+}
+
+func (h *PushTemplateDeleteHandler) GetPreprocessors() []router.Processor {
+	return h.preprocessors
+}
+
+func (h *PushTemplateDeleteHandler) Handle(rpayload *router.Payload, response *router.Response) {
+	payload := pushTemplateDeletePayload{}
+	if skyErr := payload.Decode(rpayload.Data); skyErr != nil {
+		response.Err = skyErr
+		return
+	}
+
+	if err := rpayload.DBConn.DeletePushTemplate(payload.Name); err == skydb.ErrPushTemplateNotFound {
+		response.Err = pushTemplateNotFoundError(payload.Name)
+		return
+	} else if err != nil {
+		response.Err = skyerr.MakeError(err)
+		return
+	}
+	response.Result = struct {
+		Name string `json:"name"`
+	}{payload.Name}
+}
+
+func pushTemplateNotFoundError(name string) skyerr.Error {
+	return skyerr.NewErrorWithInfo(
+		skyerr.ResourceNotFound,
+		fmt.Sprintf(`cannot find push template "%s"`, name),
+		map[string]interface{}{"name": name},
+	)
+}
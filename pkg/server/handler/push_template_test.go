@@ -0,0 +1,202 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"testing"
+	"time"
+
+	"github.com/skygeario/skygear-server/pkg/server/handler/handlertest"
+	"github.com/skygeario/skygear-server/pkg/server/router"
+	"github.com/skygeario/skygear-server/pkg/server/skydb"
+	"github.com/skygeario/skygear-server/pkg/server/skydb/skydbtest"
+	. "github.com/skygeario/skygear-server/pkg/server/skytest"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestPushTemplateSaveHandler(t *testing.T) {
+	Convey("PushTemplateSaveHandler", t, func() {
+		realTime := timeNow
+		timeNow = func() time.Time { return time.Date(2006, 1, 2, 15, 4, 5, 0, time.UTC) }
+		defer func() {
+			timeNow = realTime
+		}()
+
+		conn := skydbtest.NewMapConn()
+		r := handlertest.NewSingleRouteRouter(&PushTemplateSaveHandler{}, func(p *router.Payload) {
+			p.DBConn = conn
+		})
+
+		Convey("saves template", func() {
+			resp := r.POST(`{
+				"template": {
+					"name": "welcome",
+					"default_locale": "en",
+					"locales": {
+						"en": {"title": "Welcome", "body": "Hello {{.name}}", "badge": 1},
+						"zh-HK": {"body": "{{.name}}你好"}
+					}
+				}
+			}`)
+			So(resp.Body.Bytes(), ShouldEqualJSON, `{
+				"result": {
+					"name": "welcome",
+					"default_locale": "en",
+					"locales": {
+						"en": {"title": "Welcome", "body": "Hello {{.name}}", "badge": 1},
+						"zh-HK": {"body": "{{.name}}你好"}
+					},
+					"updated_at": "2006-01-02T15:04:05Z"
+				}
+			}`)
+
+			template := conn.PushTemplateMap["welcome"]
+			So(template.DefaultLocale, ShouldEqual, "en")
+			So(*template.Locales["en"].Badge, ShouldEqual, 1)
+		})
+
+		Convey("rejects template without content in default locale", func() {
+			resp := r.POST(`{
+				"template": {
+					"name": "welcome",
+					"default_locale": "fr",
+					"locales": {
+						"en": {"body": "Hello"}
+					}
+				}
+			}`)
+			So(resp.Code, ShouldEqual, 400)
+			So(conn.PushTemplateMap, ShouldBeEmpty)
+		})
+
+		Convey("rejects template with syntax error", func() {
+			resp := r.POST(`{
+				"template": {
+					"name": "welcome",
+					"default_locale": "en",
+					"locales": {
+						"en": {"body": "Hello {{.name"}
+					}
+				}
+			}`)
+			So(resp.Code, ShouldEqual, 400)
+			So(conn.PushTemplateMap, ShouldBeEmpty)
+		})
+
+		Convey("rejects template without name", func() {
+			resp := r.POST(`{
+				"template": {
+					"default_locale": "en",
+					"locales": {
+						"en": {"body": "Hello"}
+					}
+				}
+			}`)
+			So(resp.Code, ShouldEqual, 400)
+		})
+	})
+}
+
+func TestPushTemplateFetchHandler(t *testing.T) {
+	Convey("PushTemplateFetchHandler", t, func() {
+		conn := skydbtest.NewMapConn()
+		conn.PushTemplateMap["welcome"] = skydb.PushTemplate{
+			Name:          "welcome",
+			DefaultLocale: "en",
+			Locales: map[string]skydb.PushTemplateContent{
+				"en": {Body: "Hello"},
+			},
+			UpdatedAt: time.Date(2006, 1, 2, 15, 4, 5, 0, time.UTC),
+		}
+		conn.PushTemplateMap["reminder"] = skydb.PushTemplate{
+			Name:          "reminder",
+			DefaultLocale: "en",
+			Locales: map[string]skydb.PushTemplateContent{
+				"en": {Body: "Remember"},
+			},
+			UpdatedAt: time.Date(2006, 1, 2, 15, 4, 5, 0, time.UTC),
+		}
+		r := handlertest.NewSingleRouteRouter(&PushTemplateFetchHandler{}, func(p *router.Payload) {
+			p.DBConn = conn
+		})
+
+		Convey("fetches templates by name", func() {
+			resp := r.POST(`{"names": ["welcome"]}`)
+			So(resp.Body.Bytes(), ShouldEqualJSON, `{
+				"result": [{
+					"name": "welcome",
+					"default_locale": "en",
+					"locales": {"en": {"body": "Hello"}},
+					"updated_at": "2006-01-02T15:04:05Z"
+				}]
+			}`)
+		})
+
+		Convey("fetches all templates", func() {
+			resp := r.POST(`{}`)
+			So(resp.Body.Bytes(), ShouldEqualJSON, `{
+				"result": [{
+					"name": "reminder",
+					"default_locale": "en",
+					"locales": {"en": {"body": "Remember"}},
+					"updated_at": "2006-01-02T15:04:05Z"
+				}, {
+					"name": "welcome",
+					"default_locale": "en",
+					"locales": {"en": {"body": "Hello"}},
+					"updated_at": "2006-01-02T15:04:05Z"
+				}]
+			}`)
+		})
+
+		Convey("returns error for non-existent template", func() {
+			resp := r.POST(`{"names": ["nonexistent"]}`)
+			So(resp.Body.Bytes(), ShouldEqualJSON, `{
+				"error": {
+					"name": "ResourceNotFound",
+					"code": 110,
+					"message": "cannot find push template \"nonexistent\"",
+					"info": {"name": "nonexistent"}
+				}
+			}`)
+		})
+	})
+}
+
+func TestPushTemplateDeleteHandler(t *testing.T) {
+	Convey("PushTemplateDeleteHandler", t, func() {
+		conn := skydbtest.NewMapConn()
+		conn.PushTemplateMap["welcome"] = skydb.PushTemplate{
+			Name:          "welcome",
+			DefaultLocale: "en",
+		}
+		r := handlertest.NewSingleRouteRouter(&PushTemplateDeleteHandler{}, func(p *router.Payload) {
+			p.DBConn = conn
+		})
+
+		Convey("deletes template", func() {
+			resp := r.POST(`{"name": "welcome"}`)
+			So(resp.Body.Bytes(), ShouldEqualJSON, `{
+				"result": {"name": "welcome"}
+			}`)
+			So(conn.PushTemplateMap, ShouldBeEmpty)
+		})
+
+		Convey("returns error for non-existent template", func() {
+			resp := r.POST(`{"name": "nonexistent"}`)
+			So(resp.Code, ShouldEqual, 404)
+		})
+	})
+}
@@ -24,6 +24,7 @@ import (
 	"github.com/skygeario/skygear-server/pkg/server/push"
 	"github.com/skygeario/skygear-server/pkg/server/router"
 	"github.com/skygeario/skygear-server/pkg/server/skydb"
+	"github.com/skygeario/skygear-server/pkg/server/skydb/skydbtest"
 )
 
 func TestPushToDevice(t *testing.T) {
@@ -210,6 +211,416 @@ func TestPushToUser(t *testing.T) {
 
 }
 
+func TestPushWithTemplate(t *testing.T) {
+	Convey("push with template", t, func() {
+		testdevice1 := skydb.Device{
+			ID:         "device1",
+			Type:       "ios",
+			Token:      "token1",
+			AuthInfoID: "johndoe",
+		}
+		testdevice2 := skydb.Device{
+			ID:         "device2",
+			Type:       "android",
+			Token:      "token2",
+			AuthInfoID: "janedoe",
+		}
+
+		db := skydbtest.NewMapDB()
+		db.RecordMap["user/janedoe"] = skydb.Record{
+			ID:   skydb.NewRecordID("user", "janedoe"),
+			Data: map[string]interface{}{"locale": "zh-HK"},
+		}
+		mapConn := skydbtest.NewMapConn()
+		mapConn.InternalPublicDB = db
+		mapConn.PushTemplateMap["welcome"] = skydb.PushTemplate{
+			Name:          "welcome",
+			DefaultLocale: "en",
+			Locales: map[string]skydb.PushTemplateContent{
+				"en": {Body: "Hello {{.name}}"},
+				"zh": {Body: "{{.name}}你好"},
+			},
+		}
+		conn := simpleDeviceConn{
+			devices: []skydb.Device{testdevice1, testdevice2},
+			Conn:    mapConn,
+		}
+
+		originalSendFunc := sendPushNotification
+		defer func() {
+			sendPushNotification = originalSendFunc
+		}()
+
+		bodies := map[string]interface{}{}
+		sendPushNotification = func(sender push.Sender, device skydb.Device, m push.Mapper) {
+			apns := m.Map()["apns"].(map[string]interface{})
+			alert := apns["aps"].(map[string]interface{})["alert"].(map[string]interface{})
+			bodies[device.ID] = alert["body"]
+		}
+
+		Convey("push to user in locale of user record", func() {
+			r := handlertest.NewSingleRouteRouter(&PushToUserHandler{}, func(p *router.Payload) {
+				p.DBConn = &conn
+			})
+			resp := r.POST(`{
+				"user_ids": ["johndoe", "janedoe"],
+				"template": "welcome",
+				"data": {"name": "Faseng"}
+			}`)
+			So(resp.Body.Bytes(), ShouldEqualJSON, `{
+				"result": [{"_id": "johndoe"}, {"_id": "janedoe"}]
+			}`)
+			So(bodies, ShouldResemble, map[string]interface{}{
+				"device1": "Hello Faseng",
+				"device2": "Faseng你好",
+			})
+		})
+
+		Convey("push to device in specified locale", func() {
+			r := handlertest.NewSingleRouteRouter(&PushToDeviceHandler{}, func(p *router.Payload) {
+				p.DBConn = &conn
+			})
+			resp := r.POST(`{
+				"device_ids": ["device1", "device2"],
+				"template": "welcome",
+				"locale": "zh-TW",
+				"data": {"name": "Faseng"}
+			}`)
+			So(resp.Body.Bytes(), ShouldEqualJSON, `{
+				"result": [{"_id": "device1"}, {"_id": "device2"}]
+			}`)
+			So(bodies, ShouldResemble, map[string]interface{}{
+				"device1": "Faseng你好",
+				"device2": "Faseng你好",
+			})
+		})
+
+		Convey("push with missing template data", func() {
+			r := handlertest.NewSingleRouteRouter(&PushToDeviceHandler{}, func(p *router.Payload) {
+				p.DBConn = &conn
+			})
+			resp := r.POST(`{
+				"device_ids": ["device1"],
+				"template": "welcome"
+			}`)
+			So(resp.Code, ShouldEqual, 200)
+			So(resp.Body.String(), ShouldContainSubstring, `"name":"InvalidArgument"`)
+			So(bodies, ShouldBeEmpty)
+		})
+
+		Convey("push with non-existent template", func() {
+			r := handlertest.NewSingleRouteRouter(&PushToUserHandler{}, func(p *router.Payload) {
+				p.DBConn = &conn
+			})
+			resp := r.POST(`{
+				"user_ids": ["johndoe"],
+				"template": "nonexistent"
+			}`)
+			So(resp.Code, ShouldEqual, 404)
+			So(bodies, ShouldBeEmpty)
+		})
+
+		Convey("push with both notification and template", func() {
+			r := handlertest.NewSingleRouteRouter(&PushToUserHandler{}, func(p *router.Payload) {
+				p.DBConn = &conn
+			})
+			resp := r.POST(`{
+				"user_ids": ["johndoe"],
+				"notification": {"aps": {"alert": "Hello"}},
+				"template": "welcome"
+			}`)
+			So(resp.Code, ShouldEqual, 400)
+			So(bodies, ShouldBeEmpty)
+		})
+	})
+}
+
+func TestPushWithDeliveryLog(t *testing.T) {
+	Convey("push with delivery log", t, func() {
+		realUUIDNew := uuidNew
+		uuidNew = func() string { return "push-id" }
+		defer func() {
+			uuidNew = realUUIDNew
+		}()
+
+		testdevice := skydb.Device{
+			ID:         "device",
+			Type:       "ios",
+			Token:      "token",
+			AuthInfoID: "johndoe",
+		}
+		mapConn := skydbtest.NewMapConn()
+		conn := simpleDeviceConn{
+			devices: []skydb.Device{testdevice},
+			Conn:    mapConn,
+		}
+
+		sentDevices := []skydb.Device{}
+		r := handlertest.NewSingleRouteRouter(&PushToUserHandler{
+			DeliveryLog: &push.DeliveryLog{
+				ConnOpener: func() (skydb.Conn, error) { return mapConn, nil },
+				Sender: senderFunc(func(m push.Mapper, device skydb.Device) error {
+					sentDevices = append(sentDevices, device)
+					return nil
+				}),
+			},
+		}, func(p *router.Payload) {
+			p.DBConn = &conn
+		})
+
+		originalSendFunc := sendPushNotification
+		defer func() {
+			sendPushNotification = originalSendFunc
+		}()
+		sendPushNotification = func(sender push.Sender, device skydb.Device, m push.Mapper) {
+			sender.Send(m, device)
+		}
+
+		resp := r.POST(`{
+			"user_ids": ["johndoe"],
+			"notification": {"aps": {"alert": "Hello"}}
+		}`)
+		So(resp.Body.Bytes(), ShouldEqualJSON, `{
+			"info": {"push_id": "push-id"},
+			"result": [{"_id": "johndoe"}]
+		}`)
+		So(sentDevices, ShouldResemble, []skydb.Device{testdevice})
+
+		deliveries, _ := mapConn.QueryPushDeliveries("push-id")
+		So(len(deliveries), ShouldEqual, 1)
+		So(deliveries[0].DeviceID, ShouldEqual, "device")
+		So(deliveries[0].UserID, ShouldEqual, "johndoe")
+		So(deliveries[0].Status, ShouldEqual, skydb.PushDeliverySent)
+
+		// the delivery is recorded before the notification is sent
+		sendPushNotification = func(sender push.Sender, device skydb.Device, m push.Mapper) {}
+		resp = r.POST(`{
+			"user_ids": ["johndoe"],
+			"notification": {"aps": {"alert": "Hello"}}
+		}`)
+		So(resp.Code, ShouldEqual, 200)
+		deliveries, _ = mapConn.QueryPushDeliveries("push-id")
+		So(len(deliveries), ShouldEqual, 2)
+		So(len(sentDevices), ShouldEqual, 1)
+	})
+}
+
+func TestPushToTopic(t *testing.T) {
+	Convey("push to topic", t, func() {
+		testdevice1 := skydb.Device{
+			ID:         "device1",
+			Type:       "ios",
+			Token:      "token1",
+			Topic:      "news",
+			AuthInfoID: "johndoe",
+		}
+		testdevice2 := skydb.Device{
+			ID:         "device2",
+			Type:       "ios",
+			Token:      "token2",
+			Topic:      "news",
+			AuthInfoID: "janedoe",
+		}
+		testdevice3 := skydb.Device{
+			ID:         "device3",
+			Type:       "ios",
+			Token:      "token3",
+			Topic:      "sports",
+			AuthInfoID: "johndoe",
+		}
+
+		db := skydbtest.NewMapDB()
+		db.RecordMap["user/janedoe"] = skydb.Record{
+			ID:   skydb.NewRecordID("user", "janedoe"),
+			Data: map[string]interface{}{"locale": "zh-HK"},
+		}
+		mapConn := skydbtest.NewMapConn()
+		mapConn.InternalPublicDB = db
+		mapConn.PushTemplateMap["breaking"] = skydb.PushTemplate{
+			Name:          "breaking",
+			DefaultLocale: "en",
+			Locales: map[string]skydb.PushTemplateContent{
+				"en": {Body: "Breaking: {{.headline}}"},
+				"zh": {Body: "突發：{{.headline}}"},
+			},
+		}
+		conn := simpleDeviceConn{
+			devices: []skydb.Device{testdevice1, testdevice2, testdevice3},
+			Conn:    mapConn,
+		}
+
+		bodies := map[string]interface{}{}
+		r := handlertest.NewSingleRouteRouter(&PushToTopicHandler{
+			NotificationSender: senderFunc(func(m push.Mapper, device skydb.Device) error {
+				apns := m.Map()["apns"].(map[string]interface{})
+				alert := apns["aps"].(map[string]interface{})["alert"].(map[string]interface{})
+				bodies[device.ID] = alert["body"]
+				return nil
+			}),
+			Broadcaster: &push.Broadcaster{
+				ConnOpener:  func() (skydb.Conn, error) { return &conn, nil },
+				BatchSize:   1,
+				Concurrency: 1,
+			},
+		}, func(p *router.Payload) {
+			p.DBConn = &conn
+		})
+
+		originalBroadcastFunc := broadcastPushNotification
+		defer func() {
+			broadcastPushNotification = originalBroadcastFunc
+		}()
+		broadcastPushNotification = func(broadcaster *push.Broadcaster, sender push.Sender, topic string, content *pushContent) {
+			broadcaster.Broadcast(sender, topic, content.mapperFunc())
+		}
+
+		Convey("push to devices of topic in locale of users", func() {
+			resp := r.POST(`{
+				"topic": "news",
+				"template": "breaking",
+				"data": {"headline": "Skygear"}
+			}`)
+			So(resp.Body.Bytes(), ShouldEqualJSON, `{
+				"result": {"topic": "news"}
+			}`)
+			So(bodies, ShouldResemble, map[string]interface{}{
+				"device1": "Breaking: Skygear",
+				"device2": "突發：Skygear",
+			})
+		})
+
+		Convey("push with non-existent template", func() {
+			resp := r.POST(`{
+				"topic": "news",
+				"template": "notexist"
+			}`)
+			So(resp.Code, ShouldEqual, 404)
+			So(bodies, ShouldBeEmpty)
+		})
+
+		Convey("rejects payload without topic", func() {
+			resp := r.POST(`{
+				"notification": {"aps": {"alert": "Hello"}}
+			}`)
+			So(resp.Body.Bytes(), ShouldEqualJSON, `{
+				"error": {
+					"code": 108,
+					"name": "InvalidArgument",
+					"message": "empty topic",
+					"info": {"arguments": ["topic"]}
+				}
+			}`)
+		})
+	})
+}
+
+type senderFunc func(m push.Mapper, device skydb.Device) error
+
+func (f senderFunc) Send(m push.Mapper, device skydb.Device) error {
+	return f(m, device)
+}
+
+func TestPushToQuery(t *testing.T) {
+	Convey("push to query", t, func() {
+		testdevice1 := skydb.Device{
+			ID:         "device1",
+			Type:       "ios",
+			Token:      "token1",
+			AuthInfoID: "johndoe",
+		}
+		testdevice2 := skydb.Device{
+			ID:         "device2",
+			Type:       "ios",
+			Token:      "token2",
+			AuthInfoID: "janedoe",
+		}
+
+		db := &userQueryDB{
+			MapDB: skydbtest.NewMapDB(),
+			users: []skydb.Record{
+				{ID: skydb.NewRecordID("user", "johndoe")},
+				{ID: skydb.NewRecordID("user", "nodevice")},
+			},
+		}
+		mapConn := skydbtest.NewMapConn()
+		mapConn.InternalPublicDB = db
+		conn := simpleDeviceConn{
+			devices: []skydb.Device{testdevice1, testdevice2},
+			Conn:    mapConn,
+		}
+
+		r := handlertest.NewSingleRouteRouter(&PushToQueryHandler{}, func(p *router.Payload) {
+			p.DBConn = &conn
+		})
+
+		originalSendFunc := sendPushNotification
+		defer func() {
+			sendPushNotification = originalSendFunc
+		}()
+
+		sentDevices := []skydb.Device{}
+		sendPushNotification = func(sender push.Sender, device skydb.Device, m push.Mapper) {
+			sentDevices = append(sentDevices, device)
+		}
+
+		Convey("push to users matching query", func() {
+			resp := r.POST(`{
+				"query": {
+					"predicate": ["eq", {"$type": "keypath", "$val": "plan"}, "premium"]
+				},
+				"notification": {"aps": {"alert": "Hello"}}
+			}`)
+			So(resp.Body.Bytes(), ShouldEqualJSON, `{
+				"result": [{
+					"_id": "johndoe"
+				}, {
+					"_id": "nodevice",
+					"_type": "error",
+					"message": "cannot find user \"nodevice\"",
+					"name": "ResourceNotFound",
+					"code": 110,
+					"info": {"id": "nodevice"}
+				}]
+			}`)
+			So(sentDevices, ShouldResemble, []skydb.Device{testdevice1})
+
+			So(db.query.Type, ShouldEqual, "user")
+			So(db.query.Predicate.Operator, ShouldEqual, skydb.Equal)
+			So(db.accessControlOptions.BypassAccessControl, ShouldBeTrue)
+		})
+
+		Convey("rejects query on other record type", func() {
+			resp := r.POST(`{
+				"query": {"record_type": "note"},
+				"notification": {"aps": {"alert": "Hello"}}
+			}`)
+			So(resp.Code, ShouldEqual, 400)
+			So(sentDevices, ShouldBeEmpty)
+		})
+
+		Convey("rejects payload without query", func() {
+			resp := r.POST(`{
+				"notification": {"aps": {"alert": "Hello"}}
+			}`)
+			So(resp.Code, ShouldEqual, 400)
+			So(sentDevices, ShouldBeEmpty)
+		})
+	})
+}
+
+type userQueryDB struct {
+	*skydbtest.MapDB
+	users                []skydb.Record
+	query                skydb.Query
+	accessControlOptions skydb.AccessControlOptions
+}
+
+func (db *userQueryDB) Query(query *skydb.Query, accessControlOptions *skydb.AccessControlOptions) (*skydb.Rows, error) {
+	db.query = *query
+	db.accessControlOptions = *accessControlOptions
+	return skydb.NewRows(skydb.NewMemoryRows(db.users)), nil
+}
+
 type simpleDeviceConn struct {
 	devices []skydb.Device
 	skydb.Conn
@@ -237,3 +648,13 @@ func (conn *simpleDeviceConn) QueryDevicesByUser(user string) ([]skydb.Device, e
 	}
 	return result, nil
 }
+
+func (conn *simpleDeviceConn) QueryDevicesByTopic(topic string, afterID string, limit int) ([]skydb.Device, error) {
+	result := []skydb.Device{}
+	for _, prospectiveDevice := range conn.devices {
+		if prospectiveDevice.Topic == topic && prospectiveDevice.ID > afterID && len(result) < limit {
+			result = append(result, prospectiveDevice)
+		}
+	}
+	return result, nil
+}
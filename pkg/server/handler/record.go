@@ -190,18 +190,19 @@ curl -X POST -H "Content-Type: application/json" \
 EOF
 */
 type RecordSaveHandler struct {
-	HookRegistry   *hook.Registry     `inject:"HookRegistry"`
-	AssetStore     asset.Store        `inject:"AssetStore"`
-	AccessModel    skydb.AccessModel  `inject:"AccessModel"`
-	EventSender    pluginEvent.Sender `inject:"PluginEventSender"`
-	AuthRecordKeys [][]string         `inject:"AuthRecordKeys"`
-	Authenticator  router.Processor   `preprocessor:"authenticator"`
-	DBConn         router.Processor   `preprocessor:"dbconn"`
-	InjectAuth     router.Processor   `preprocessor:"require_auth"`
-	InjectDB       router.Processor   `preprocessor:"inject_db"`
-	CheckUser      router.Processor   `preprocessor:"check_user"`
-	PluginReady    router.Processor   `preprocessor:"plugin_ready"`
-	preprocessors  []router.Processor
+	HookRegistry      *hook.Registry      `inject:"HookRegistry"`
+	AssetStore        asset.Store         `inject:"AssetStore"`
+	AssetUploadPolicy *asset.UploadPolicy `inject:"AssetUploadPolicy"`
+	AccessModel       skydb.AccessModel   `inject:"AccessModel"`
+	EventSender       pluginEvent.Sender  `inject:"PluginEventSender"`
+	AuthRecordKeys    [][]string          `inject:"AuthRecordKeys"`
+	Authenticator     router.Processor    `preprocessor:"authenticator"`
+	DBConn            router.Processor    `preprocessor:"dbconn"`
+	InjectAuth        router.Processor    `preprocessor:"require_auth"`
+	InjectDB          router.Processor    `preprocessor:"inject_db"`
+	CheckUser         router.Processor    `preprocessor:"check_user"`
+	PluginReady       router.Processor    `preprocessor:"plugin_ready"`
+	preprocessors     []router.Processor
 }
 
 func (h *RecordSaveHandler) Setup() {
@@ -247,16 +248,17 @@ func (h *RecordSaveHandler) Handle(payload *router.Payload, response *router.Res
 	logger.Debugf("Working with accessModel %v", h.AccessModel)
 
 	req := recordutil.RecordModifyRequest{
-		Db:            payload.Database,
-		Conn:          payload.DBConn,
-		AssetStore:    h.AssetStore,
-		HookRegistry:  h.HookRegistry,
-		AuthInfo:      payload.AuthInfo,
-		RecordsToSave: p.Records,
-		Atomic:        p.Atomic,
-		WithMasterKey: payload.HasMasterKey(),
-		Context:       payload.Context(),
-		ModifyAt:      timeNow(),
+		Db:                payload.Database,
+		Conn:              payload.DBConn,
+		AssetStore:        h.AssetStore,
+		AssetUploadPolicy: h.AssetUploadPolicy,
+		HookRegistry:      h.HookRegistry,
+		AuthInfo:          payload.AuthInfo,
+		RecordsToSave:     p.Records,
+		Atomic:            p.Atomic,
+		WithMasterKey:     payload.HasMasterKey(),
+		Context:           payload.Context(),
+		ModifyAt:          timeNow(),
 	}
 	resp := recordutil.RecordModifyResponse{
 		ErrMap: map[skydb.RecordID]skyerr.Error{},
@@ -390,6 +392,7 @@ curl -X POST -H "Content-Type: application/json" \
 EOF
 */
 type RecordFetchHandler struct {
+	HookRegistry  *hook.Registry    `inject:"HookRegistry"`
 	AssetStore    asset.Store       `inject:"AssetStore"`
 	AccessModel   skydb.AccessModel `inject:"AccessModel"`
 	Authenticator router.Processor  `preprocessor:"authenticator"`
@@ -439,6 +442,8 @@ func (h *RecordFetchHandler) Handle(payload *router.Payload, response *router.Re
 	fetcher := recordutil.NewRecordFetcher(payload.Context(), db, payload.DBConn, payload.HasMasterKey())
 
 	results := make([]interface{}, p.ItemLen(), p.ItemLen())
+	records := make([]*skydb.Record, p.ItemLen(), p.ItemLen())
+	fetchedRecords := []*skydb.Record{}
 	for i, recordID := range p.RecordIDs {
 		record, err := fetcher.FetchRecord(recordID, payload.AuthInfo, skydb.ReadLevel)
 		if err != nil {
@@ -448,6 +453,35 @@ func (h *RecordFetchHandler) Handle(payload *router.Payload, response *router.Re
 			)
 			continue
 		}
+		records[i] = record
+		fetchedRecords = append(fetchedRecords, record)
+	}
+
+	fetchedRecords, skyErr = recordutil.ExecuteFetchHooks(payload.Context(), h.HookRegistry, fetchedRecords)
+	if skyErr != nil {
+		response.Err = skyErr
+		return
+	}
+
+	recordsByID := map[skydb.RecordID]*skydb.Record{}
+	for _, record := range fetchedRecords {
+		recordsByID[record.ID] = record
+	}
+
+	for i, recordID := range p.RecordIDs {
+		if records[i] == nil {
+			continue
+		}
+
+		record, ok := recordsByID[records[i].ID]
+		if !ok {
+			// the record is dropped by afterFetch hooks
+			results[i] = newSerializedError(
+				recordID.String(),
+				skyerr.NewError(skyerr.ResourceNotFound, "record not found"),
+			)
+			continue
+		}
 		results[i] = resultFilter.JSONResult(record)
 	}
 
@@ -491,6 +525,7 @@ curl -X POST -H "Content-Type: application/json" \
 EOF
 */
 type RecordQueryHandler struct {
+	HookRegistry  *hook.Registry    `inject:"HookRegistry"`
 	AssetStore    asset.Store       `inject:"AssetStore"`
 	AccessModel   skydb.AccessModel `inject:"AccessModel"`
 	Authenticator router.Processor  `preprocessor:"authenticator"`
@@ -558,6 +593,13 @@ func (h *RecordQueryHandler) Handle(payload *router.Payload, response *router.Re
 		}
 	}
 
+	if h.HookRegistry != nil {
+		if err := h.HookRegistry.ExecuteQueryHooks(payload.Context(), &p.Query); err != nil {
+			response.Err = err
+			return
+		}
+	}
+
 	db := payload.Database
 
 	results, err := db.Query(&p.Query, accessControlOptions)
@@ -583,7 +625,30 @@ func (h *RecordQueryHandler) Handle(payload *router.Payload, response *router.Re
 	// so we replace them with some complete assets.
 	recordutil.MakeAssetsComplete(db, payload.DBConn, records)
 
+	if h.HookRegistry != nil {
+		recordPtrs := make([]*skydb.Record, len(records))
+		for i := range records {
+			recordPtrs[i] = &records[i]
+		}
+
+		recordPtrs, skyErr = recordutil.ExecuteFetchHooks(payload.Context(), h.HookRegistry, recordPtrs)
+		if skyErr != nil {
+			response.Err = skyErr
+			return
+		}
+
+		records = make([]skydb.Record, len(recordPtrs))
+		for i, record := range recordPtrs {
+			records[i] = *record
+		}
+	}
+
 	eagerRecords := recordutil.DoQueryEager(payload.Context(), db, recordutil.EagerIDs(db, records, p.Query), accessControlOptions)
+	eagerRecords, skyErr = recordutil.ExecuteEagerFetchHooks(payload.Context(), h.HookRegistry, eagerRecords)
+	if skyErr != nil {
+		response.Err = skyErr
+		return
+	}
 
 	recordResultFilter, err := recordutil.NewRecordResultFilter(
 		payload.DBConn,
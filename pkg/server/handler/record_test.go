@@ -1032,6 +1032,176 @@ func (db *noExtendDatabase) Extend(recordType string, schema skydb.RecordSchema)
 	return false, errors.New("You shalt not call Extend")
 }
 
+func TestRecordSaveAssetUploadPolicy(t *testing.T) {
+	Convey("RecordSaveHandler with asset upload policy", t, func() {
+		db := skydbtest.NewMapDB()
+		conn := skydbtest.NewMapConn()
+		conn.AssetMap = map[string]skydb.Asset{
+			"avatar.png": skydb.Asset{
+				Name:        "avatar.png",
+				ContentType: "image/png",
+				Size:        512,
+			},
+			"large.png": skydb.Asset{
+				Name:        "large.png",
+				ContentType: "image/png",
+				Size:        2048,
+			},
+			"note.txt": skydb.Asset{
+				Name:        "note.txt",
+				ContentType: "text/plain",
+				Size:        10,
+			},
+		}
+
+		r := handlertest.NewSingleRouteRouter(&RecordSaveHandler{
+			AssetStore: &urlOnlyAssetStore{},
+			AssetUploadPolicy: &asset.UploadPolicy{
+				Fields: map[string]asset.FieldUploadPolicy{
+					"user.avatar": asset.FieldUploadPolicy{
+						MaxSize:      1024,
+						ContentTypes: []string{"image/*"},
+					},
+				},
+			},
+		}, func(p *router.Payload) {
+			p.DBConn = conn
+			p.Database = db
+			p.AuthInfo = &skydb.AuthInfo{
+				ID: "user0",
+			}
+		})
+
+		Convey("saves asset conforming to the field policy", func() {
+			resp := r.POST(`{
+				"records": [{
+					"_recordType": "user",
+					"_recordID": "id",
+					"avatar": {"$type": "asset", "$name": "avatar.png"}
+				}]
+			}`)
+			So(resp.Code, ShouldEqual, 200)
+
+			record := skydb.Record{}
+			So(db.Get(skydb.NewRecordID("user", "id"), &record), ShouldBeNil)
+			So(record.Data["avatar"].(*skydb.Asset).Name, ShouldEqual, "avatar.png")
+		})
+
+		Convey("saves asset to field without policy", func() {
+			resp := r.POST(`{
+				"records": [{
+					"_recordType": "user",
+					"_recordID": "id",
+					"attachment": {"$type": "asset", "$name": "note.txt"}
+				}]
+			}`)
+			So(resp.Code, ShouldEqual, 200)
+		})
+
+		Convey("errors on asset larger than the field allows", func() {
+			resp := r.POST(`{
+				"records": [{
+					"_recordType": "user",
+					"_recordID": "id",
+					"avatar": {"$type": "asset", "$name": "large.png"}
+				}]
+			}`)
+			So(resp.Body.Bytes(), ShouldEqualJSON, `{
+				"result": [{
+					"_id": "user/id",
+					"_recordType": "user",
+					"_recordID": "id",
+					"_type": "error",
+					"code": 129,
+					"name": "AssetSizeTooLarge",
+					"message": "Asset of user.avatar is larger than 1024 bytes",
+					"info": {
+						"field": "user.avatar",
+						"max_size": 1024
+					}
+				}]
+			}`)
+
+			record := skydb.Record{}
+			So(db.Get(skydb.NewRecordID("user", "id"), &record), ShouldEqual, skydb.ErrRecordNotFound)
+		})
+
+		Convey("validates stored asset regardless of the asset sent", func() {
+			resp := r.POST(`{
+				"records": [{
+					"_recordType": "user",
+					"_recordID": "id",
+					"avatar": {
+						"$type": "asset",
+						"$name": "large.png",
+						"$content_type": "image/png",
+						"$size": 512
+					}
+				}]
+			}`)
+			So(resp.Body.Bytes(), ShouldEqualJSON, `{
+				"result": [{
+					"_id": "user/id",
+					"_recordType": "user",
+					"_recordID": "id",
+					"_type": "error",
+					"code": 129,
+					"name": "AssetSizeTooLarge",
+					"message": "Asset of user.avatar is larger than 1024 bytes",
+					"info": {
+						"field": "user.avatar",
+						"max_size": 1024
+					}
+				}]
+			}`)
+		})
+
+		Convey("errors on asset of content type not allowed by the field", func() {
+			resp := r.POST(`{
+				"records": [{
+					"_recordType": "user",
+					"_recordID": "id",
+					"avatar": {"$type": "asset", "$name": "note.txt"}
+				}]
+			}`)
+			So(resp.Body.Bytes(), ShouldEqualJSON, `{
+				"result": [{
+					"_id": "user/id",
+					"_recordType": "user",
+					"_recordID": "id",
+					"_type": "error",
+					"code": 108,
+					"name": "InvalidArgument",
+					"message": "Asset of user.avatar of content type text/plain is not allowed",
+					"info": {
+						"field": "user.avatar"
+					}
+				}]
+			}`)
+		})
+
+		Convey("does not check asset unchanged", func() {
+			db.Save(&skydb.Record{
+				ID:      skydb.NewRecordID("user", "id"),
+				OwnerID: "user0",
+				Data: map[string]interface{}{
+					"avatar": &skydb.Asset{Name: "large.png"},
+				},
+			})
+
+			resp := r.POST(`{
+				"records": [{
+					"_recordType": "user",
+					"_recordID": "id",
+					"avatar": {"$type": "asset", "$name": "large.png"},
+					"name": "john"
+				}]
+			}`)
+			So(resp.Code, ShouldEqual, 200)
+		})
+	})
+}
+
 func TestRecordSaveNoExtendIfRecordMalformed(t *testing.T) {
 	Convey("RecordSaveHandler", t, func() {
 		noExtendDB := &noExtendDatabase{}
@@ -2148,6 +2318,10 @@ func (s *urlOnlyAssetStore) PutFileReader(name string, src io.Reader, length int
 	panic("not implemented")
 }
 
+func (s *urlOnlyAssetStore) Delete(name string) error {
+	panic("not implemented")
+}
+
 func (s *urlOnlyAssetStore) GeneratePostFileRequest(name string, contentType string, length int64) (*asset.PostFileRequest, error) {
 	panic("not implemented")
 }
@@ -2160,6 +2334,19 @@ func (s *urlOnlyAssetStore) IsSignatureRequired() bool {
 	return true
 }
 
+// userURLOnlyAssetStore requires record ACL, signing URLs for users
+type userURLOnlyAssetStore struct {
+	urlOnlyAssetStore
+}
+
+func (s *userURLOnlyAssetStore) SignedURLForUser(name string, transform *asset.ImageTransform, userID string) (string, error) {
+	return fmt.Sprintf("http://skygear.test/asset/%s?expiredAt=1997-07-01T00:00:00&user_id=%s", name, userID), nil
+}
+
+func (s *userURLOnlyAssetStore) IsRecordACLRequired() bool {
+	return true
+}
+
 func TestRecordAssetSerialization(t *testing.T) {
 	Convey("RecordAssetSerialization for fetch", t, func() {
 		conn := skydbtest.NewMapConn()
@@ -2205,6 +2392,51 @@ func TestRecordAssetSerialization(t *testing.T) {
 		})
 	})
 
+	Convey("RecordAssetSerialization for fetch with record ACL", t, func() {
+		conn := skydbtest.NewMapConn()
+		db := skydbtest.NewMapDB()
+		db.Save(&skydb.Record{
+			ID: skydb.NewRecordID("record", "id"),
+			Data: map[string]interface{}{
+				"asset": &skydb.Asset{
+					Name:        "asset-name",
+					ContentType: "plain/text",
+				},
+			},
+		})
+
+		r := handlertest.NewSingleRouteRouter(&RecordFetchHandler{
+			AssetStore: &userURLOnlyAssetStore{},
+		}, func(p *router.Payload) {
+			p.DBConn = conn
+			p.Database = db
+			p.AuthInfo = &skydb.AuthInfo{
+				ID: "user0",
+			}
+		})
+
+		Convey("serialize with $url signed for the user", func() {
+			resp := r.POST(`{
+				"ids": ["record/id"]
+			}`)
+			So(resp.Body.Bytes(), ShouldEqualJSON, `{
+				"result": [{
+					"_id": "record/id",
+					"_recordType": "record",
+					"_recordID": "id",
+					"_type": "record",
+					"_access": null,
+					"asset": {
+						"$type": "asset",
+						"$name": "asset-name",
+						"$url": "http://skygear.test/asset/asset-name?expiredAt=1997-07-01T00:00:00&user_id=user0",
+						"$content_type":"plain/text"
+					}
+				}]
+			}`)
+		})
+	})
+
 	Convey("RecordAssetSerialization for query", t, func() {
 		record0 := skydb.Record{
 			ID: skydb.NewRecordID("record", "id"),
@@ -3007,6 +3239,201 @@ func (db *selectiveDatabase) Rollback() error {
 	return db.Database.(skydb.TxDatabase).Rollback()
 }
 
+func TestQueryHookExecution(t *testing.T) {
+	Convey("RecordQueryHandler", t, func() {
+		registry := hook.NewRegistry()
+		conn := skydbtest.NewMapConn()
+
+		Convey("executes beforeQuery hooks", func() {
+			db := &queryDatabase{}
+			registry.RegisterQueryHook("note", func(ctx context.Context, query *skydb.Query) skyerr.Error {
+				query.Predicate = skydb.Predicate{
+					Operator: skydb.Equal,
+					Children: []interface{}{
+						skydb.Expression{
+							Type:  skydb.KeyPath,
+							Value: "deleted",
+						},
+						skydb.Expression{
+							Type:  skydb.Literal,
+							Value: false,
+						},
+					},
+				}
+				return nil
+			})
+
+			r := handlertest.NewSingleRouteRouter(&RecordQueryHandler{
+				HookRegistry: registry,
+			}, func(p *router.Payload) {
+				p.DBConn = conn
+				p.Database = db
+			})
+
+			resp := r.POST(`{"record_type": "note"}`)
+			So(resp.Code, ShouldEqual, 200)
+			So(db.lastquery.Predicate, ShouldResemble, skydb.Predicate{
+				Operator: skydb.Equal,
+				Children: []interface{}{
+					skydb.Expression{
+						Type:  skydb.KeyPath,
+						Value: "deleted",
+					},
+					skydb.Expression{
+						Type:  skydb.Literal,
+						Value: false,
+					},
+				},
+			})
+		})
+
+		Convey("returns error from beforeQuery hooks", func() {
+			db := &queryDatabase{}
+			registry.RegisterQueryHook("note", func(ctx context.Context, query *skydb.Query) skyerr.Error {
+				return skyerr.NewError(skyerr.PermissionDenied, "query not allowed")
+			})
+
+			r := handlertest.NewSingleRouteRouter(&RecordQueryHandler{
+				HookRegistry: registry,
+			}, func(p *router.Payload) {
+				p.DBConn = conn
+				p.Database = db
+			})
+
+			resp := r.POST(`{"record_type": "note"}`)
+			So(resp.Body.Bytes(), ShouldEqualJSON, `{
+				"error": {
+					"code": 102,
+					"message": "query not allowed",
+					"name": "PermissionDenied"
+				}
+			}`)
+			So(db.lastquery, ShouldBeNil)
+		})
+
+		Convey("executes afterFetch hooks", func() {
+			db := &queryResultsDatabase{}
+			db.records = []skydb.Record{
+				{
+					ID:   skydb.NewRecordID("note", "0"),
+					Data: skydb.Data{"secret": "s3cr3t"},
+				},
+				{
+					ID:   skydb.NewRecordID("note", "1"),
+					Data: skydb.Data{"secret": "s3cr3t"},
+				},
+			}
+			hookRecordCount := 0
+			registry.RegisterFetchHook("note", func(ctx context.Context, records []*skydb.Record) ([]*skydb.Record, skyerr.Error) {
+				hookRecordCount = len(records)
+				record := *records[1]
+				record.Data = skydb.Data{}
+				return []*skydb.Record{&record}, nil
+			})
+
+			r := handlertest.NewSingleRouteRouter(&RecordQueryHandler{
+				HookRegistry: registry,
+			}, func(p *router.Payload) {
+				p.DBConn = conn
+				p.Database = db
+			})
+
+			resp := r.POST(`{"record_type": "note"}`)
+			So(hookRecordCount, ShouldEqual, 2)
+			So(resp.Body.Bytes(), ShouldEqualJSON, `{
+				"result": [{
+					"_type": "record",
+					"_id": "note/1",
+					"_recordType": "note",
+					"_recordID": "1",
+					"_access": null
+				}]
+			}`)
+		})
+	})
+
+	Convey("RecordFetchHandler", t, func() {
+		registry := hook.NewRegistry()
+		db := skydbtest.NewMapDB()
+		conn := skydbtest.NewMapConn()
+
+		db.Save(&skydb.Record{
+			ID:      skydb.NewRecordID("note", "0"),
+			OwnerID: "user0",
+			Data:    skydb.Data{"secret": "s3cr3t"},
+		})
+		db.Save(&skydb.Record{
+			ID:      skydb.NewRecordID("note", "1"),
+			OwnerID: "user0",
+			Data:    skydb.Data{"secret": "s3cr3t"},
+		})
+
+		r := handlertest.NewSingleRouteRouter(&RecordFetchHandler{
+			HookRegistry: registry,
+		}, func(p *router.Payload) {
+			p.DBConn = conn
+			p.Database = db
+			p.AuthInfo = &skydb.AuthInfo{
+				ID: "user0",
+			}
+		})
+
+		Convey("executes afterFetch hooks", func() {
+			hookRecordCount := 0
+			registry.RegisterFetchHook("note", func(ctx context.Context, records []*skydb.Record) ([]*skydb.Record, skyerr.Error) {
+				hookRecordCount = len(records)
+				record := *records[0]
+				record.Data = skydb.Data{}
+				return []*skydb.Record{&record}, nil
+			})
+
+			resp := r.POST(`{"ids": ["note/0", "note/1", "note/2"]}`)
+			So(hookRecordCount, ShouldEqual, 2)
+			So(resp.Body.Bytes(), ShouldEqualJSON, `{
+				"result": [{
+					"_type": "record",
+					"_id": "note/0",
+					"_recordType": "note",
+					"_recordID": "0",
+					"_access": null,
+					"_ownerID": "user0"
+				}, {
+					"_type": "error",
+					"_id": "note/1",
+					"_recordType": "note",
+					"_recordID": "1",
+					"code": 110,
+					"message": "record not found",
+					"name": "ResourceNotFound"
+				}, {
+					"_type": "error",
+					"_id": "note/2",
+					"_recordType": "note",
+					"_recordID": "2",
+					"code": 110,
+					"message": "record not found",
+					"name": "ResourceNotFound"
+				}]
+			}`)
+		})
+
+		Convey("returns error from afterFetch hooks", func() {
+			registry.RegisterFetchHook("note", func(ctx context.Context, records []*skydb.Record) ([]*skydb.Record, skyerr.Error) {
+				return nil, skyerr.NewError(skyerr.UnexpectedError, "hook failed")
+			})
+
+			resp := r.POST(`{"ids": ["note/0"]}`)
+			So(resp.Body.Bytes(), ShouldEqualJSON, `{
+				"error": {
+					"code": 10000,
+					"message": "hook failed",
+					"name": "UnexpectedError"
+				}
+			}`)
+		})
+	})
+}
+
 func TestAtomicOperation(t *testing.T) {
 	realTime := timeNow
 	timeNow = func() time.Time { return ZeroTime }
@@ -403,6 +403,15 @@ func (payload *subscriptionSavePayload) Validate() skyerr.Error {
 	for i := range payload.Subscriptions {
 		subscription := &payload.Subscriptions[i]
 		subscription.DeviceID = payload.DeviceID
+
+		switch subscription.Type {
+		case "", skydb.QuerySubscriptionType, skydb.LiveQuerySubscriptionType:
+		default:
+			return skyerr.NewInvalidArgument(
+				fmt.Sprintf("unknown subscription type %s", subscription.Type),
+				[]string{"subscriptions"},
+			)
+		}
 	}
 
 	return nil
@@ -411,6 +420,10 @@ func (payload *subscriptionSavePayload) Validate() skyerr.Error {
 // SubscriptionSaveHandler saves one or more subscriptions associate with
 // a database.
 //
+// The type of a subscription is either "query" or "live_query". A device
+// subscribed with "live_query" receives the changed record and whether
+// it is added, updated or removed from the query results over pubsub.
+//
 // Example curl:
 //	curl -X POST -H "Content-Type: application/json" \
 //	  -d @- http://localhost:3000/ <<EOF
@@ -361,6 +361,42 @@ func TestSubscriptionSaveHandler(t *testing.T) {
 			So(resp.Code, ShouldEqual, 400)
 			So(resp.Body.Bytes(), ShouldEqualJSON, `{"error":{"code":108,"message":"empty subscriptions","name":"InvalidArgument","info":{"arguments":["subscriptions"]}}}`)
 		})
+
+		Convey("saves live query subscription", func() {
+			resp := r.POST(`
+{
+	"device_id": "somedeviceid",
+	"subscriptions": [{
+		"id": "sub0",
+		"type": "live_query",
+		"query": {
+			"record_type": "recordtype0"
+		}
+	}]
+}`)
+			So(resp.Code, ShouldEqual, 200)
+
+			var sub0 skydb.Subscription
+			So(db.GetSubscription("sub0", "somedeviceid", &sub0), ShouldBeNil)
+			So(sub0.Type, ShouldEqual, skydb.LiveQuerySubscriptionType)
+		})
+
+		Convey("errors with unknown subscription type", func() {
+			resp := r.POST(`
+{
+	"device_id": "somedeviceid",
+	"subscriptions": [{
+		"id": "sub0",
+		"type": "unknown",
+		"query": {
+			"record_type": "recordtype0"
+		}
+	}]
+}`)
+
+			So(resp.Code, ShouldEqual, 400)
+			So(resp.Body.Bytes(), ShouldEqualJSON, `{"error":{"code":108,"message":"unknown subscription type unknown","name":"InvalidArgument","info":{"arguments":["subscriptions"]}}}`)
+		})
 	})
 }
 
@@ -0,0 +1,30 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package job executes lambdas scheduled to run at a later time.
+//
+// Jobs are persisted in the database by skydb.JobConn, such that scheduled
+// jobs survive server restarts. A Worker polls for jobs due and executes
+// them with a Runner, retrying failed jobs with exponential backoff.
+package job
+
+import (
+	"github.com/skygeario/skygear-server/pkg/server/logging"
+)
+
+var log = logging.LoggerEntry("job")
+
+// DefaultMaxAttempts is the number of attempts to execute a job if
+// not specified when the job is scheduled.
+const DefaultMaxAttempts = 5
@@ -0,0 +1,75 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package job
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/skygeario/skygear-server/pkg/server/router"
+	"github.com/skygeario/skygear-server/pkg/server/skydb"
+)
+
+// Runner executes a job.
+type Runner interface {
+	RunJob(ctx context.Context, job skydb.Job) error
+}
+
+// RouterRunner executes a job by calling the lambda of the job name
+// through the router with master key, as if the lambda is called by
+// a plugin.
+type RouterRunner struct {
+	Router *router.Router
+}
+
+// RunJob calls the lambda of the job name with the job args, and returns
+// the error in the response, if any.
+func (r *RouterRunner) RunJob(ctx context.Context, job skydb.Job) error {
+	payload := &router.Payload{
+		Meta: map[string]interface{}{
+			"method": "POST",
+			"path":   strings.Replace(job.Name, ":", "/", -1),
+		},
+		Data: map[string]interface{}{
+			"action": job.Name,
+			"args":   job.Args,
+		},
+		AccessKey: router.MasterAccessKey,
+	}
+	payload.SetContext(ctx)
+
+	resp := router.NewResponse(discardResponseWriter{})
+	r.Router.HandlePayload(payload, resp)
+	if resp.Err != nil {
+		return resp.Err
+	}
+	return nil
+}
+
+// discardResponseWriter discards the response written by the router,
+// because the result of a job is not returned to anyone.
+type discardResponseWriter struct{}
+
+func (w discardResponseWriter) Header() http.Header {
+	return http.Header{}
+}
+
+func (w discardResponseWriter) Write(body []byte) (int, error) {
+	return len(body), nil
+}
+
+func (w discardResponseWriter) WriteHeader(status int) {
+}
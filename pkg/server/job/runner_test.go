@@ -0,0 +1,79 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package job
+
+import (
+	"context"
+	"testing"
+
+	"github.com/skygeario/skygear-server/pkg/server/router"
+	"github.com/skygeario/skygear-server/pkg/server/skydb"
+	"github.com/skygeario/skygear-server/pkg/server/skyerr"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+type lambdaHandler struct {
+	payload *router.Payload
+	err     skyerr.Error
+}
+
+func (h *lambdaHandler) Setup() {}
+
+func (h *lambdaHandler) GetPreprocessors() []router.Processor {
+	return nil
+}
+
+func (h *lambdaHandler) Handle(payload *router.Payload, response *router.Response) {
+	h.payload = payload
+	if h.err != nil {
+		response.Err = h.err
+		return
+	}
+	response.Result = "OK"
+}
+
+func TestRouterRunner(t *testing.T) {
+	Convey("RouterRunner", t, func() {
+		r := router.NewRouter()
+		handler := &lambdaHandler{}
+		r.Map("send_reminder", "plugin", handler)
+		runner := &RouterRunner{Router: r}
+
+		job := skydb.Job{
+			ID:   "job-1",
+			Name: "send_reminder",
+			Args: map[string]interface{}{"user_id": "faseng"},
+		}
+
+		Convey("calls lambda with master key", func() {
+			err := runner.RunJob(context.Background(), job)
+			So(err, ShouldBeNil)
+			So(handler.payload.Data["args"], ShouldResemble, map[string]interface{}{"user_id": "faseng"})
+			So(handler.payload.HasMasterKey(), ShouldBeTrue)
+		})
+
+		Convey("returns error of lambda", func() {
+			handler.err = skyerr.NewError(skyerr.UnexpectedError, "lambda failed")
+			err := runner.RunJob(context.Background(), job)
+			So(err, ShouldResemble, handler.err)
+		})
+
+		Convey("returns error if lambda does not exist", func() {
+			job.Name = "not_exist"
+			err := runner.RunJob(context.Background(), job)
+			So(err.(skyerr.Error).Code(), ShouldEqual, skyerr.UndefinedOperation)
+		})
+	})
+}
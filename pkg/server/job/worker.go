@@ -0,0 +1,177 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package job
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/skygeario/skygear-server/pkg/server/skydb"
+)
+
+var timeNow = time.Now
+
+const (
+	defaultPollInterval = 5 * time.Second
+	defaultBatchSize    = 10
+	defaultLease        = 5 * time.Minute
+	defaultRetryDelay   = 10 * time.Second
+	maxRetryDelay       = time.Hour
+)
+
+// Worker polls the database for jobs due and executes them.
+//
+// A job claimed by the worker is locked for the lease duration. If the
+// server stops before the job is finished, the job is executed again
+// after the lease expires.
+//
+// A failed job is retried with exponential backoff starting from
+// RetryDelay, until it has been attempted MaxAttempts times.
+type Worker struct {
+	ConnOpener   func() (skydb.Conn, error)
+	Runner       Runner
+	PollInterval time.Duration
+	BatchSize    int
+	Lease        time.Duration
+	RetryDelay   time.Duration
+	stop         chan struct{}
+	stopOnce     sync.Once
+}
+
+// NewWorker returns a Worker executing jobs with the Runner.
+func NewWorker(connOpener func() (skydb.Conn, error), runner Runner) *Worker {
+	return &Worker{
+		ConnOpener: connOpener,
+		Runner:     runner,
+		stop:       make(chan struct{}),
+	}
+}
+
+// Run polls for jobs due until the worker is stopped.
+func (w *Worker) Run() {
+	pollInterval := w.PollInterval
+	if pollInterval <= 0 {
+		pollInterval = defaultPollInterval
+	}
+
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			w.runDueJobs()
+		case <-w.stop:
+			log.Infoln("job: stopping the worker")
+			return
+		}
+	}
+}
+
+// Stop stops the worker. Run returns immediately if the worker is
+// stopped before it runs.
+func (w *Worker) Stop() {
+	w.stopOnce.Do(func() {
+		close(w.stop)
+	})
+}
+
+// runDueJobs claims and executes jobs due until no more jobs are due.
+func (w *Worker) runDueJobs() {
+	batchSize := w.BatchSize
+	if batchSize <= 0 {
+		batchSize = defaultBatchSize
+	}
+	lease := w.Lease
+	if lease <= 0 {
+		lease = defaultLease
+	}
+
+	conn, err := w.ConnOpener()
+	if err != nil {
+		log.WithField("err", err).Errorln("job: failed to open skydb.Conn")
+		return
+	}
+	defer conn.Close()
+
+	for {
+		now := timeNow()
+		var jobs []skydb.Job
+		jobs, err = conn.ClaimDueJobs(now, now.Add(lease), batchSize)
+		if err != nil {
+			log.WithField("err", err).Errorln("job: failed to claim jobs")
+			return
+		}
+
+		for _, job := range jobs {
+			w.runJob(conn, job)
+		}
+
+		if len(jobs) < batchSize {
+			return
+		}
+	}
+}
+
+func (w *Worker) runJob(conn skydb.Conn, job skydb.Job) {
+	logger := log.WithFields(logrus.Fields{
+		"id":      job.ID,
+		"name":    job.Name,
+		"attempt": job.Attempts,
+	})
+
+	err := w.Runner.RunJob(context.Background(), job)
+	if err == nil {
+		logger.Debugln("job: executed job")
+		if deleteErr := conn.DeleteJob(job.ID); deleteErr != nil {
+			logger.WithField("err", deleteErr).Errorln("job: failed to delete executed job")
+		}
+		return
+	}
+
+	if job.Attempts >= job.MaxAttempts {
+		logger.WithField("err", err).Errorln("job: giving up job after too many failed attempts")
+		if deleteErr := conn.DeleteJob(job.ID); deleteErr != nil {
+			logger.WithField("err", deleteErr).Errorln("job: failed to delete failed job")
+		}
+		return
+	}
+
+	logger.WithField("err", err).Warnln("job: failed to execute job, will retry")
+	job.RunAt = timeNow().Add(w.retryDelay(job.Attempts))
+	job.LastError = err.Error()
+	if updateErr := conn.UpdateJob(&job); updateErr != nil {
+		logger.WithField("err", updateErr).Errorln("job: failed to reschedule failed job")
+	}
+}
+
+// retryDelay returns the delay before a job is retried after the
+// specified number of failed attempts.
+func (w *Worker) retryDelay(attempts int) time.Duration {
+	delay := w.RetryDelay
+	if delay <= 0 {
+		delay = defaultRetryDelay
+	}
+
+	for i := 1; i < attempts && delay < maxRetryDelay; i++ {
+		delay *= 2
+	}
+	if delay > maxRetryDelay {
+		delay = maxRetryDelay
+	}
+	return delay
+}
@@ -0,0 +1,128 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package job
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/skygeario/skygear-server/pkg/server/skydb"
+	"github.com/skygeario/skygear-server/pkg/server/skydb/skydbtest"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+type fakeRunner struct {
+	jobs []skydb.Job
+	err  error
+}
+
+func (r *fakeRunner) RunJob(ctx context.Context, job skydb.Job) error {
+	r.jobs = append(r.jobs, job)
+	return r.err
+}
+
+func TestWorker(t *testing.T) {
+	Convey("Worker", t, func() {
+		now := time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC)
+		realTime := timeNow
+		timeNow = func() time.Time { return now }
+		defer func() {
+			timeNow = realTime
+		}()
+
+		conn := skydbtest.NewMapConn()
+		runner := &fakeRunner{}
+		worker := NewWorker(func() (skydb.Conn, error) { return conn, nil }, runner)
+		worker.RetryDelay = 10 * time.Second
+
+		conn.JobMap["job-1"] = skydb.Job{
+			ID:          "job-1",
+			Name:        "send_reminder",
+			Args:        []interface{}{"faseng"},
+			RunAt:       now.Add(-time.Minute),
+			MaxAttempts: 3,
+		}
+		conn.JobMap["job-2"] = skydb.Job{
+			ID:          "job-2",
+			Name:        "send_reminder",
+			RunAt:       now.Add(time.Minute),
+			MaxAttempts: 3,
+		}
+
+		Convey("executes and deletes jobs due", func() {
+			worker.runDueJobs()
+
+			So(len(runner.jobs), ShouldEqual, 1)
+			So(runner.jobs[0].ID, ShouldEqual, "job-1")
+			So(runner.jobs[0].Args, ShouldResemble, []interface{}{"faseng"})
+			So(conn.JobMap, ShouldContainKey, "job-2")
+			So(conn.JobMap, ShouldNotContainKey, "job-1")
+		})
+
+		Convey("reschedules failed jobs", func() {
+			runner.err = errors.New("plugin unavailable")
+			worker.runDueJobs()
+
+			job := conn.JobMap["job-1"]
+			So(job.Attempts, ShouldEqual, 1)
+			So(job.LastError, ShouldEqual, "plugin unavailable")
+			So(job.RunAt, ShouldResemble, now.Add(10*time.Second))
+		})
+
+		Convey("gives up failed jobs after max attempts", func() {
+			job := conn.JobMap["job-1"]
+			job.Attempts = 2
+			conn.JobMap["job-1"] = job
+
+			runner.err = errors.New("plugin unavailable")
+			worker.runDueJobs()
+
+			So(len(runner.jobs), ShouldEqual, 1)
+			So(conn.JobMap, ShouldNotContainKey, "job-1")
+		})
+	})
+}
+
+func TestWorkerStop(t *testing.T) {
+	Convey("Worker stopped before running", t, func() {
+		worker := NewWorker(nil, &fakeRunner{})
+		worker.Stop()
+		worker.Stop()
+
+		done := make(chan struct{})
+		go func() {
+			worker.Run()
+			close(done)
+		}()
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Fatal("Worker does not stop")
+		}
+	})
+}
+
+func TestWorkerRetryDelay(t *testing.T) {
+	Convey("Worker retry delay", t, func() {
+		worker := &Worker{RetryDelay: 10 * time.Second}
+
+		So(worker.retryDelay(1), ShouldEqual, 10*time.Second)
+		So(worker.retryDelay(2), ShouldEqual, 20*time.Second)
+		So(worker.retryDelay(4), ShouldEqual, 80*time.Second)
+		So(worker.retryDelay(100), ShouldEqual, time.Hour)
+	})
+}
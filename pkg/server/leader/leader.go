@@ -0,0 +1,206 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package leader elects a leader among instances of Skygear Server, such
+// that services which must not run concurrently are run by one instance
+// at a time.
+package leader
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/skygeario/skygear-server/pkg/server/logging"
+)
+
+var log = logging.LoggerEntry("leader")
+
+const defaultInterval = 10 * time.Second
+
+// Lock is a lock held by at most one instance at a time.
+type Lock interface {
+	// TryLock acquires the lock without waiting, and returns whether
+	// the lock is acquired.
+	TryLock() (bool, error)
+
+	// Ping returns an error if the acquired lock is no longer held.
+	Ping() error
+
+	// Unlock releases the acquired lock.
+	Unlock() error
+}
+
+// Elector elects the instance as the leader when it acquires the Lock.
+//
+// The instance which is not the leader tries to acquire the lock every
+// Interval, such that another instance is elected when the leader stops.
+// The leader checks that the lock is still held every Interval, and steps
+// down if it is not.
+type Elector struct {
+	Lock     Lock
+	Interval time.Duration
+
+	mutex     sync.Mutex
+	isLeader  int32
+	onElected []func()
+	onDemoted []func()
+	stop      chan struct{}
+	stopOnce  sync.Once
+}
+
+// NewElector returns an Elector which elects the instance when the
+// supplied lock is acquired.
+func NewElector(lock Lock) *Elector {
+	return &Elector{
+		Lock:     lock,
+		Interval: defaultInterval,
+		stop:     make(chan struct{}),
+	}
+}
+
+// OnElected registers a function to be called when the instance is
+// elected as the leader.
+func (e *Elector) OnElected(f func()) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	e.onElected = append(e.onElected, f)
+}
+
+// OnDemoted registers a function to be called when the instance is no
+// longer the leader.
+func (e *Elector) OnDemoted(f func()) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	e.onDemoted = append(e.onDemoted, f)
+}
+
+// IsLeader returns whether the instance is the leader.
+func (e *Elector) IsLeader() bool {
+	return atomic.LoadInt32(&e.isLeader) == 1
+}
+
+// Run takes part in the election until the elector is stopped.
+func (e *Elector) Run() {
+	interval := e.Interval
+	if interval <= 0 {
+		interval = defaultInterval
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	select {
+	case <-e.stop:
+		return
+	default:
+	}
+
+	e.elect()
+	for {
+		select {
+		case <-ticker.C:
+			e.elect()
+		case <-e.stop:
+			log.Infoln("leader: stopping the elector")
+			e.resign()
+			return
+		}
+	}
+}
+
+// Stop stops the elector, releasing the lock if the instance is the
+// leader. Run returns immediately if the elector is stopped before it
+// runs.
+func (e *Elector) Stop() {
+	e.stopOnce.Do(func() {
+		close(e.stop)
+	})
+}
+
+func (e *Elector) elect() {
+	if e.IsLeader() {
+		if err := e.Lock.Ping(); err != nil {
+			log.WithField("err", err).Errorln("leader: lost leadership")
+			e.demote()
+		}
+		return
+	}
+
+	acquired, err := e.Lock.TryLock()
+	if err != nil {
+		log.WithField("err", err).Errorln("leader: failed to acquire lock")
+		return
+	}
+	if acquired {
+		log.Infoln("leader: elected as leader")
+		e.setLeader(true)
+	}
+}
+
+func (e *Elector) demote() {
+	e.setLeader(false)
+
+	// Release the lock in case the lock is still held, such that another
+	// instance can be elected.
+	if err := e.Lock.Unlock(); err != nil {
+		log.WithField("err", err).Warnln("leader: failed to release lock")
+	}
+}
+
+func (e *Elector) resign() {
+	if e.IsLeader() {
+		log.Infoln("leader: resigning from leader")
+		e.demote()
+	}
+}
+
+func (e *Elector) setLeader(isLeader bool) {
+	var callbacks []func()
+
+	e.mutex.Lock()
+	if isLeader {
+		atomic.StoreInt32(&e.isLeader, 1)
+		callbacks = append(callbacks, e.onElected...)
+	} else {
+		atomic.StoreInt32(&e.isLeader, 0)
+		callbacks = append(callbacks, e.onDemoted...)
+	}
+	e.mutex.Unlock()
+
+	for _, f := range callbacks {
+		f()
+	}
+}
+
+// localLock is a Lock that is always acquired.
+type localLock struct{}
+
+// NewLocalLock returns a Lock that is always acquired, for a single
+// instance which is always the leader.
+func NewLocalLock() Lock {
+	return localLock{}
+}
+
+func (l localLock) TryLock() (bool, error) {
+	return true, nil
+}
+
+func (l localLock) Ping() error {
+	return nil
+}
+
+func (l localLock) Unlock() error {
+	return nil
+}
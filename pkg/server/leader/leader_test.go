@@ -0,0 +1,127 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package leader
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+type fakeLock struct {
+	acquirable bool
+	held       bool
+	pingErr    error
+	unlocked   int
+}
+
+func (l *fakeLock) TryLock() (bool, error) {
+	if !l.acquirable {
+		return false, nil
+	}
+	l.held = true
+	return true, nil
+}
+
+func (l *fakeLock) Ping() error {
+	return l.pingErr
+}
+
+func (l *fakeLock) Unlock() error {
+	l.held = false
+	l.unlocked++
+	return nil
+}
+
+func TestElector(t *testing.T) {
+	Convey("Elector", t, func() {
+		lock := &fakeLock{}
+		elector := NewElector(lock)
+
+		elected := 0
+		demoted := 0
+		elector.OnElected(func() { elected++ })
+		elector.OnDemoted(func() { demoted++ })
+
+		Convey("is not elected if the lock is held by others", func() {
+			elector.elect()
+			So(elector.IsLeader(), ShouldBeFalse)
+			So(elected, ShouldEqual, 0)
+		})
+
+		Convey("is elected when the lock is acquired", func() {
+			elector.elect()
+			lock.acquirable = true
+			elector.elect()
+			So(elector.IsLeader(), ShouldBeTrue)
+			So(elected, ShouldEqual, 1)
+
+			elector.elect()
+			So(elected, ShouldEqual, 1)
+		})
+
+		Convey("is demoted when the lock is lost", func() {
+			lock.acquirable = true
+			elector.elect()
+
+			lock.pingErr = errors.New("connection reset by peer")
+			elector.elect()
+			So(elector.IsLeader(), ShouldBeFalse)
+			So(demoted, ShouldEqual, 1)
+			So(lock.unlocked, ShouldEqual, 1)
+
+			lock.pingErr = nil
+			elector.elect()
+			So(elector.IsLeader(), ShouldBeTrue)
+			So(elected, ShouldEqual, 2)
+		})
+
+		Convey("releases the lock when resigned", func() {
+			lock.acquirable = true
+			elector.elect()
+			elector.resign()
+			So(elector.IsLeader(), ShouldBeFalse)
+			So(demoted, ShouldEqual, 1)
+			So(lock.held, ShouldBeFalse)
+		})
+
+		Convey("is always elected with local lock", func() {
+			elector := NewElector(NewLocalLock())
+			elector.elect()
+			So(elector.IsLeader(), ShouldBeTrue)
+		})
+
+		Convey("is not elected if stopped before running", func() {
+			lock.acquirable = true
+			elector.Stop()
+			elector.Stop()
+
+			done := make(chan struct{})
+			go func() {
+				elector.Run()
+				close(done)
+			}()
+			select {
+			case <-done:
+			case <-time.After(time.Second):
+				t.Fatal("Elector does not stop")
+			}
+			So(elector.IsLeader(), ShouldBeFalse)
+			So(lock.held, ShouldBeFalse)
+		})
+	})
+}
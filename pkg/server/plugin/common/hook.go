@@ -0,0 +1,63 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package common
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/skygeario/skygear-server/pkg/server/router"
+	"github.com/skygeario/skygear-server/pkg/server/skydb"
+	"github.com/skygeario/skygear-server/pkg/server/skydb/skyconv"
+)
+
+// DecodeQuery decodes the query returned by a beforeQuery hook. The query
+// is parsed in the same way as a query specified in a request payload.
+func DecodeQuery(ctx context.Context, data []byte) (*skydb.Query, error) {
+	var rawQuery map[string]interface{}
+	if err := json.Unmarshal(data, &rawQuery); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal query: %v", err)
+	}
+
+	var userID string
+	if ctx != nil {
+		userID, _ = ctx.Value(router.UserIDContextKey).(string)
+	}
+
+	query := skydb.Query{}
+	parser := skyconv.QueryParser{UserID: userID}
+	if err := parser.QueryFromRaw(rawQuery, &query); err != nil {
+		return nil, err
+	}
+	return &query, nil
+}
+
+// DecodeRecords decodes the records returned by an afterFetch hook.
+func DecodeRecords(data []byte) ([]*skydb.Record, error) {
+	var jsonRecords []*skyconv.JSONRecord
+	if err := json.Unmarshal(data, &jsonRecords); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal records: %v", err)
+	}
+
+	records := make([]*skydb.Record, 0, len(jsonRecords))
+	for _, jsonRecord := range jsonRecords {
+		if jsonRecord == nil {
+			continue
+		}
+		records = append(records, (*skydb.Record)(jsonRecord))
+	}
+	return records, nil
+}
@@ -235,6 +235,61 @@ func (p *execTransport) RunHook(ctx context.Context, hookName string, record *sk
 	return &recordout, nil
 }
 
+func (p *execTransport) RunQueryHook(ctx context.Context, hookName string, query *skydb.Query) (*skydb.Query, error) {
+	param := map[string]interface{}{
+		"query": skyconv.ToMap((*skyconv.MapQuery)(query)),
+	}
+	out, err := p.runHookProc(ctx, hookName, param)
+	if err != nil {
+		return nil, err
+	}
+
+	queryout, err := common.DecodeQuery(ctx, out)
+	if err != nil {
+		log.WithField("data", string(out)).Error("failed to unmarshal query")
+		return nil, err
+	}
+	return queryout, nil
+}
+
+func (p *execTransport) RunFetchHook(ctx context.Context, hookName string, records []*skydb.Record) ([]*skydb.Record, error) {
+	jsonRecords := make([]*skyconv.JSONRecord, len(records))
+	for i, record := range records {
+		jsonRecords[i] = (*skyconv.JSONRecord)(record)
+	}
+	param := map[string]interface{}{
+		"records": jsonRecords,
+	}
+	out, err := p.runHookProc(ctx, hookName, param)
+	if err != nil {
+		return nil, err
+	}
+
+	recordsout, err := common.DecodeRecords(out)
+	if err != nil {
+		log.WithField("data", string(out)).Error("failed to unmarshal records")
+		return nil, err
+	}
+	return recordsout, nil
+}
+
+func (p *execTransport) runHookProc(ctx context.Context, hookName string, param interface{}) ([]byte, error) {
+	in, err := json.Marshal(param)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal hook param: %v", err)
+	}
+
+	pluginCtx := skyplugin.ContextMap(ctx)
+	encodedCtx, err := common.EncodeBase64JSON(pluginCtx)
+	if err != nil {
+		return nil, err
+	}
+	env := []string{
+		fmt.Sprintf("SKYGEAR_CONTEXT=%s", encodedCtx),
+	}
+	return p.runProc([]string{"hook", hookName}, env, in)
+}
+
 func (p *execTransport) RunTimer(name string, in []byte) (out []byte, err error) {
 	out, err = p.runProc([]string{"timer", name}, []string{}, in)
 	return
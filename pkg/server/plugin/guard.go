@@ -0,0 +1,350 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package plugin
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/skygeario/skygear-server/pkg/server/router"
+	"github.com/skygeario/skygear-server/pkg/server/skyconfig"
+	"github.com/skygeario/skygear-server/pkg/server/skydb"
+	"github.com/skygeario/skygear-server/pkg/server/skyerr"
+)
+
+const (
+	defaultCircuitBreakerMinRequests = 10
+	defaultCircuitBreakerCooldown    = 30 * time.Second
+)
+
+type circuitBreakerState int
+
+const (
+	circuitBreakerClosed circuitBreakerState = iota
+	circuitBreakerOpen
+	circuitBreakerHalfOpen
+)
+
+// circuitBreaker keeps track of failed calls to a plugin. The breaker opens
+// when the ratio of failed calls within a window of cooldown duration
+// reaches errorRate, and calls are rejected until cooldown has passed.
+// Then a single trial call is allowed, which closes the breaker if
+// it succeeds, or opens the breaker again otherwise.
+type circuitBreaker struct {
+	errorRate   float64
+	minRequests int
+	cooldown    time.Duration
+
+	mutex       sync.Mutex
+	state       circuitBreakerState
+	requests    int
+	failures    int
+	windowStart time.Time
+	openedAt    time.Time
+	timeNow     func() time.Time
+}
+
+func newCircuitBreaker(errorRate float64, minRequests int, cooldown time.Duration) *circuitBreaker {
+	if minRequests <= 0 {
+		minRequests = defaultCircuitBreakerMinRequests
+	}
+	if cooldown <= 0 {
+		cooldown = defaultCircuitBreakerCooldown
+	}
+	return &circuitBreaker{
+		errorRate:   errorRate,
+		minRequests: minRequests,
+		cooldown:    cooldown,
+		timeNow:     time.Now,
+	}
+}
+
+// allow returns whether a call is allowed to be made.
+func (b *circuitBreaker) allow() bool {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	switch b.state {
+	case circuitBreakerOpen:
+		if b.timeNow().Sub(b.openedAt) < b.cooldown {
+			return false
+		}
+		b.state = circuitBreakerHalfOpen
+		return true
+	case circuitBreakerHalfOpen:
+		// only a single trial call is allowed when half open
+		return false
+	default:
+		return true
+	}
+}
+
+// record records the result of a call allowed by the breaker.
+func (b *circuitBreaker) record(failed bool) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	now := b.timeNow()
+	switch b.state {
+	case circuitBreakerHalfOpen:
+		if failed {
+			b.state = circuitBreakerOpen
+			b.openedAt = now
+		} else {
+			b.state = circuitBreakerClosed
+			b.requests = 0
+			b.failures = 0
+			b.windowStart = now
+		}
+	case circuitBreakerClosed:
+		if now.Sub(b.windowStart) >= b.cooldown {
+			b.requests = 0
+			b.failures = 0
+			b.windowStart = now
+		}
+
+		b.requests++
+		if failed {
+			b.failures++
+		}
+
+		if b.requests >= b.minRequests &&
+			float64(b.failures)/float64(b.requests) >= b.errorRate {
+			b.state = circuitBreakerOpen
+			b.openedAt = now
+			log.Warnf("Circuit breaker opens after %d of %d calls to plugin failed", b.failures, b.requests)
+		}
+	}
+}
+
+func (b *circuitBreaker) isOpen() bool {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.state != circuitBreakerClosed
+}
+
+// guardedTransport wraps a Transport such that calls to the plugin are
+// limited by a timeout, a maximum number of calls in flight and
+// a circuit breaker.
+type guardedTransport struct {
+	Transport
+	timeout time.Duration
+	slots   chan struct{}
+	breaker *circuitBreaker
+}
+
+// newGuardedTransport returns a Transport that limits calls to the supplied
+// transport as specified in the plugin config. The supplied transport
+// is returned untouched if no limits are specified.
+func newGuardedTransport(transport Transport, config skyconfig.PluginConfig) Transport {
+	if config.Timeout <= 0 && config.MaxConcurrency <= 0 && config.CircuitBreakerErrorRate <= 0 {
+		return transport
+	}
+
+	t := &guardedTransport{
+		Transport: transport,
+		timeout:   time.Duration(config.Timeout) * time.Second,
+	}
+	if config.MaxConcurrency > 0 {
+		t.slots = make(chan struct{}, config.MaxConcurrency)
+	}
+	if config.CircuitBreakerErrorRate > 0 {
+		t.breaker = newCircuitBreaker(
+			config.CircuitBreakerErrorRate,
+			config.CircuitBreakerMinRequests,
+			time.Duration(config.CircuitBreakerCooldown)*time.Second,
+		)
+	}
+	return t
+}
+
+// State returns TransportStateCircuitOpen if the transport is ready but
+// the circuit breaker is open, and the state of the wrapped transport
+// otherwise.
+func (t *guardedTransport) State() TransportState {
+	state := t.Transport.State()
+	if state == TransportStateReady && t.breaker != nil && t.breaker.isOpen() {
+		return TransportStateCircuitOpen
+	}
+	return state
+}
+
+// SetRouter sets the router of the wrapped transport if it is
+// a BidirectionalTransport.
+func (t *guardedTransport) SetRouter(r *router.Router) {
+	if bidirectional, ok := t.Transport.(BidirectionalTransport); ok {
+		bidirectional.SetRouter(r)
+	}
+}
+
+// isPluginFailure returns whether the error is caused by the plugin
+// failing to respond. Errors returned by the plugin itself are not
+// considered failures.
+func isPluginFailure(err error) bool {
+	if err == nil || err == context.Canceled {
+		return false
+	}
+
+	skyErr, ok := err.(skyerr.Error)
+	if !ok {
+		return true
+	}
+
+	switch skyErr.Code() {
+	case skyerr.PluginUnavailable, skyerr.PluginTimeout:
+		return true
+	default:
+		return false
+	}
+}
+
+type guardedCallResult struct {
+	out interface{}
+	err error
+}
+
+func (t *guardedTransport) call(ctx context.Context, f func(context.Context) (interface{}, error)) (interface{}, error) {
+	if t.breaker != nil && !t.breaker.allow() {
+		return nil, skyerr.NewError(
+			skyerr.PluginCircuitOpen,
+			"calls to plugin are suspended because the plugin is failing",
+		)
+	}
+
+	out, err := t.callWithLimits(ctx, f)
+	if t.breaker != nil {
+		t.breaker.record(isPluginFailure(err))
+	}
+	return out, err
+}
+
+func (t *guardedTransport) callWithLimits(ctx context.Context, f func(context.Context) (interface{}, error)) (interface{}, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	if t.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, t.timeout)
+		defer cancel()
+	}
+
+	if t.slots != nil {
+		select {
+		case t.slots <- struct{}{}:
+		case <-ctx.Done():
+			return nil, t.contextError(ctx)
+		}
+	}
+
+	if t.timeout <= 0 {
+		defer t.releaseSlot()
+		return f(ctx)
+	}
+
+	// The call is made in a separate goroutine so that the caller returns
+	// when the call times out. The slot is released only after the call
+	// returns, so that the plugin is not overloaded by calls timed out.
+	resultChan := make(chan guardedCallResult, 1)
+	go func() {
+		defer t.releaseSlot()
+		defer func() {
+			if r := recover(); r != nil {
+				resultChan <- guardedCallResult{nil, fmt.Errorf("panic occurred while calling plugin: %v", r)}
+			}
+		}()
+
+		out, err := f(ctx)
+		resultChan <- guardedCallResult{out, err}
+	}()
+
+	select {
+	case result := <-resultChan:
+		return result.out, result.err
+	case <-ctx.Done():
+		return nil, t.contextError(ctx)
+	}
+}
+
+func (t *guardedTransport) releaseSlot() {
+	if t.slots != nil {
+		<-t.slots
+	}
+}
+
+func (t *guardedTransport) contextError(ctx context.Context) error {
+	if ctx.Err() == context.DeadlineExceeded {
+		return skyerr.NewError(skyerr.PluginTimeout, "calling plugin has timed out")
+	}
+	return ctx.Err()
+}
+
+func (t *guardedTransport) RunLambda(ctx context.Context, name string, in []byte) ([]byte, error) {
+	out, err := t.call(ctx, func(ctx context.Context) (interface{}, error) {
+		return t.Transport.RunLambda(ctx, name, in)
+	})
+	bytes, _ := out.([]byte)
+	return bytes, err
+}
+
+func (t *guardedTransport) RunHandler(ctx context.Context, name string, in []byte) ([]byte, error) {
+	out, err := t.call(ctx, func(ctx context.Context) (interface{}, error) {
+		return t.Transport.RunHandler(ctx, name, in)
+	})
+	bytes, _ := out.([]byte)
+	return bytes, err
+}
+
+func (t *guardedTransport) RunHook(ctx context.Context, hookName string, record *skydb.Record, oldRecord *skydb.Record, async bool) (*skydb.Record, error) {
+	out, err := t.call(ctx, func(ctx context.Context) (interface{}, error) {
+		return t.Transport.RunHook(ctx, hookName, record, oldRecord, async)
+	})
+	recordout, _ := out.(*skydb.Record)
+	return recordout, err
+}
+
+func (t *guardedTransport) RunQueryHook(ctx context.Context, hookName string, query *skydb.Query) (*skydb.Query, error) {
+	out, err := t.call(ctx, func(ctx context.Context) (interface{}, error) {
+		return t.Transport.RunQueryHook(ctx, hookName, query)
+	})
+	queryout, _ := out.(*skydb.Query)
+	return queryout, err
+}
+
+func (t *guardedTransport) RunFetchHook(ctx context.Context, hookName string, records []*skydb.Record) ([]*skydb.Record, error) {
+	out, err := t.call(ctx, func(ctx context.Context) (interface{}, error) {
+		return t.Transport.RunFetchHook(ctx, hookName, records)
+	})
+	recordsout, _ := out.([]*skydb.Record)
+	return recordsout, err
+}
+
+func (t *guardedTransport) RunTimer(name string, in []byte) ([]byte, error) {
+	out, err := t.call(context.Background(), func(ctx context.Context) (interface{}, error) {
+		return t.Transport.RunTimer(name, in)
+	})
+	bytes, _ := out.([]byte)
+	return bytes, err
+}
+
+func (t *guardedTransport) RunProvider(ctx context.Context, request *AuthRequest) (*AuthResponse, error) {
+	out, err := t.call(ctx, func(ctx context.Context) (interface{}, error) {
+		return t.Transport.RunProvider(ctx, request)
+	})
+	response, _ := out.(*AuthResponse)
+	return response, err
+}
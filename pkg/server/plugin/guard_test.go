@@ -0,0 +1,196 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package plugin
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/skygeario/skygear-server/pkg/server/skyconfig"
+	"github.com/skygeario/skygear-server/pkg/server/skyerr"
+)
+
+type lambdaFuncTransport struct {
+	nullTransport
+	lambdaFunc func(ctx context.Context) ([]byte, error)
+}
+
+func (t *lambdaFuncTransport) RunLambda(ctx context.Context, name string, in []byte) ([]byte, error) {
+	return t.lambdaFunc(ctx)
+}
+
+func TestNewGuardedTransport(t *testing.T) {
+	Convey("newGuardedTransport", t, func() {
+		transport := &nullTransport{}
+
+		Convey("returns the transport untouched without limits", func() {
+			So(newGuardedTransport(transport, skyconfig.PluginConfig{}), ShouldEqual, transport)
+		})
+
+		Convey("wraps the transport with limits", func() {
+			guarded := newGuardedTransport(transport, skyconfig.PluginConfig{
+				Timeout: 5,
+			})
+			So(guarded, ShouldHaveSameTypeAs, &guardedTransport{})
+		})
+	})
+}
+
+func TestGuardedTransport(t *testing.T) {
+	Convey("guardedTransport", t, func() {
+		transport := &lambdaFuncTransport{
+			nullTransport: nullTransport{state: TransportStateReady},
+			lambdaFunc: func(ctx context.Context) ([]byte, error) {
+				return []byte("OK"), nil
+			},
+		}
+
+		Convey("returns PluginTimeout when the call times out", func() {
+			guarded := &guardedTransport{
+				Transport: transport,
+				timeout:   10 * time.Millisecond,
+			}
+			transport.lambdaFunc = func(ctx context.Context) ([]byte, error) {
+				time.Sleep(100 * time.Millisecond)
+				return []byte("OK"), nil
+			}
+
+			_, err := guarded.RunLambda(context.Background(), "hello", nil)
+			So(err, ShouldNotBeNil)
+			So(err.(skyerr.Error).Code(), ShouldEqual, skyerr.PluginTimeout)
+		})
+
+		Convey("returns result within timeout", func() {
+			guarded := &guardedTransport{
+				Transport: transport,
+				timeout:   time.Second,
+			}
+
+			out, err := guarded.RunLambda(context.Background(), "hello", nil)
+			So(err, ShouldBeNil)
+			So(out, ShouldResemble, []byte("OK"))
+		})
+
+		Convey("limits calls in flight", func() {
+			guarded := &guardedTransport{
+				Transport: transport,
+				timeout:   time.Second,
+				slots:     make(chan struct{}, 1),
+			}
+			release := make(chan struct{})
+			started := make(chan struct{})
+			transport.lambdaFunc = func(ctx context.Context) ([]byte, error) {
+				close(started)
+				<-release
+				return []byte("OK"), nil
+			}
+
+			done := make(chan error, 1)
+			go func() {
+				_, err := guarded.RunLambda(context.Background(), "hello", nil)
+				done <- err
+			}()
+			<-started
+
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+			defer cancel()
+			_, err := guarded.RunLambda(ctx, "hello", nil)
+			So(err, ShouldNotBeNil)
+
+			close(release)
+			So(<-done, ShouldBeNil)
+		})
+
+		Convey("with circuit breaker", func() {
+			now := time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC)
+			breaker := newCircuitBreaker(0.5, 4, 30*time.Second)
+			breaker.timeNow = func() time.Time { return now }
+			guarded := &guardedTransport{
+				Transport: transport,
+				breaker:   breaker,
+			}
+
+			failing := true
+			transport.lambdaFunc = func(ctx context.Context) ([]byte, error) {
+				if failing {
+					return nil, errors.New("connection refused")
+				}
+				return []byte("OK"), nil
+			}
+
+			openBreaker := func() {
+				for i := 0; i < 4; i++ {
+					guarded.RunLambda(context.Background(), "hello", nil)
+				}
+			}
+
+			Convey("opens when the error rate is reached", func() {
+				openBreaker()
+				So(guarded.State(), ShouldEqual, TransportStateCircuitOpen)
+
+				_, err := guarded.RunLambda(context.Background(), "hello", nil)
+				So(err, ShouldNotBeNil)
+				So(err.(skyerr.Error).Code(), ShouldEqual, skyerr.PluginCircuitOpen)
+			})
+
+			Convey("does not open before min requests", func() {
+				guarded.RunLambda(context.Background(), "hello", nil)
+				guarded.RunLambda(context.Background(), "hello", nil)
+				So(guarded.State(), ShouldEqual, TransportStateReady)
+			})
+
+			Convey("does not count errors returned by the plugin", func() {
+				transport.lambdaFunc = func(ctx context.Context) ([]byte, error) {
+					return nil, skyerr.NewError(skyerr.InvalidArgument, "invalid")
+				}
+				openBreaker()
+				So(guarded.State(), ShouldEqual, TransportStateReady)
+			})
+
+			Convey("closes after a successful trial call", func() {
+				openBreaker()
+				now = now.Add(31 * time.Second)
+				failing = false
+
+				out, err := guarded.RunLambda(context.Background(), "hello", nil)
+				So(err, ShouldBeNil)
+				So(out, ShouldResemble, []byte("OK"))
+				So(guarded.State(), ShouldEqual, TransportStateReady)
+			})
+
+			Convey("opens again after a failed trial call", func() {
+				openBreaker()
+				now = now.Add(31 * time.Second)
+
+				_, err := guarded.RunLambda(context.Background(), "hello", nil)
+				So(err.Error(), ShouldContainSubstring, "connection refused")
+				So(guarded.State(), ShouldEqual, TransportStateCircuitOpen)
+
+				_, err = guarded.RunLambda(context.Background(), "hello", nil)
+				So(err.(skyerr.Error).Code(), ShouldEqual, skyerr.PluginCircuitOpen)
+			})
+
+			Convey("reports the state of the wrapped transport if not ready", func() {
+				openBreaker()
+				transport.state = TransportStateWorkerUnavailable
+				So(guarded.State(), ShouldEqual, TransportStateWorkerUnavailable)
+			})
+		})
+	})
+}
@@ -67,3 +67,74 @@ func CreateHookFunc(p *Plugin, hookInfo pluginHookInfo) hook.Func {
 
 	return hookFunc
 }
+
+// CreateQueryHookFunc returns a hook.QueryFunc that run the beforeQuery hook
+// registered by a plugin
+func CreateQueryHookFunc(p *Plugin, hookInfo pluginHookInfo) hook.QueryFunc {
+	return func(ctx context.Context, query *skydb.Query) skyerr.Error {
+		queryout, err := p.transport.RunQueryHook(ctx, hookInfo.Name, query)
+		if err != nil {
+			return makeHookError(err)
+		}
+
+		if queryout.Type != query.Type {
+			return skyerr.NewErrorf(
+				skyerr.UnexpectedError,
+				`beforeQuery hook "%s" is not allowed to change the record type`,
+				hookInfo.Name,
+			)
+		}
+
+		*query = *queryout
+		return nil
+	}
+}
+
+// CreateFetchHookFunc returns a hook.FetchFunc that run the afterFetch hook
+// registered by a plugin
+func CreateFetchHookFunc(p *Plugin, hookInfo pluginHookInfo) hook.FetchFunc {
+	return func(ctx context.Context, records []*skydb.Record) ([]*skydb.Record, skyerr.Error) {
+		if len(records) == 0 {
+			return records, nil
+		}
+
+		recordsout, err := p.transport.RunFetchHook(ctx, hookInfo.Name, records)
+		if err != nil {
+			return nil, makeHookError(err)
+		}
+
+		recordMap := map[skydb.RecordID]*skydb.Record{}
+		for _, record := range records {
+			recordMap[record.ID] = record
+		}
+
+		// Plugin can only transform or drop the records passed in,
+		// metadata of the fetched records are retained.
+		result := make([]*skydb.Record, 0, len(recordsout))
+		for _, recordout := range recordsout {
+			record, ok := recordMap[recordout.ID]
+			if !ok {
+				log.WithField("hook", hookInfo.Name).
+					Warnf("Ignoring record %s not passed to afterFetch hook", recordout.ID)
+				continue
+			}
+
+			recordout.OwnerID = record.OwnerID
+			recordout.CreatedAt = record.CreatedAt
+			recordout.CreatorID = record.CreatorID
+			recordout.UpdatedAt = record.UpdatedAt
+			recordout.UpdaterID = record.UpdaterID
+			recordout.DatabaseID = record.DatabaseID
+			result = append(result, recordout)
+		}
+		return result, nil
+	}
+}
+
+func makeHookError(err error) skyerr.Error {
+	if pluginError, ok := err.(skyerr.Error); ok {
+		return pluginError
+	}
+
+	return skyerr.MakeError(err)
+}
@@ -34,13 +34,42 @@ const (
 	AfterDelete  Kind = "afterDelete"
 )
 
+// The two kind of hooks executed on record query and fetch.
+const (
+	BeforeQuery Kind = "beforeQuery"
+	AfterFetch  Kind = "afterFetch"
+)
+
 // Func defines the interface of a function that can be hooked.
 //
 // The supplied record is fully fetched for all four kind of hooks.
 type Func func(context.Context, *skydb.Record, *skydb.Record) skyerr.Error
 
+// QueryFunc defines the interface of a function that is executed before
+// a query is performed.
+//
+// The supplied query can be modified in place, and the modified query is
+// used to query the database.
+type QueryFunc func(context.Context, *skydb.Query) skyerr.Error
+
+// FetchFunc defines the interface of a function that is executed on the
+// records fetched from the database before they are returned to the client.
+//
+// The returned records replace the supplied records. A record is dropped
+// from the result if it is not returned.
+type FetchFunc func(context.Context, []*skydb.Record) ([]*skydb.Record, skyerr.Error)
+
 type recordTypeHookMap map[string][]Func
 
+type recordTypeQueryHookMap map[string][]QueryFunc
+
+type recordTypeFetchHookMap map[string][]FetchFunc
+
+type mountedRegistry struct {
+	key      interface{}
+	registry *Registry
+}
+
 // Registry is a registry of hooks by record type.
 //
 // It provides method to execute hooks but is not responsible to execute
@@ -54,6 +83,9 @@ type Registry struct {
 	afterSaveHooks    recordTypeHookMap
 	beforeDeleteHooks recordTypeHookMap
 	afterDeleteHooks  recordTypeHookMap
+	beforeQueryHooks  recordTypeQueryHookMap
+	afterFetchHooks   recordTypeFetchHookMap
+	mounted           []mountedRegistry
 }
 
 // NewRegistry returns a Registry ready for use.
@@ -64,6 +96,9 @@ func NewRegistry() *Registry {
 		recordTypeHookMap{},
 		recordTypeHookMap{},
 		recordTypeHookMap{},
+		recordTypeQueryHookMap{},
+		recordTypeFetchHookMap{},
+		nil,
 	}
 }
 
@@ -101,6 +136,85 @@ func (r *Registry) ExecuteHooks(ctx context.Context, kind Kind, record *skydb.Re
 	return nil
 }
 
+// Mount makes hooks registered in the supplied registry executed as if they
+// are registered in this registry. Hooks of a mounted registry are executed
+// after hooks registered directly, in the order the registries are mounted.
+//
+// Mounting a registry with a key that is already mounted replaces the
+// registry previously mounted in place, such that all hooks of the
+// key are swapped at once. Mounting nil unmounts the registry of the key.
+func (r *Registry) Mount(key interface{}, registry *Registry) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	for i, mounted := range r.mounted {
+		if mounted.key != key {
+			continue
+		}
+
+		if registry == nil {
+			r.mounted = append(r.mounted[:i:i], r.mounted[i+1:]...)
+		} else {
+			r.mounted[i].registry = registry
+		}
+		return
+	}
+
+	if registry != nil {
+		r.mounted = append(r.mounted, mountedRegistry{key, registry})
+	}
+}
+
+// RegisterQueryHook adds the specific hook to be executed before a query
+// on the supplied recordType is performed.
+func (r *Registry) RegisterQueryHook(recordType string, hook QueryFunc) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.beforeQueryHooks[recordType] = append(r.beforeQueryHooks[recordType], hook)
+}
+
+// RegisterFetchHook adds the specific hook to be executed on records of the
+// supplied recordType after they are fetched.
+func (r *Registry) RegisterFetchHook(recordType string, hook FetchFunc) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.afterFetchHooks[recordType] = append(r.afterFetchHooks[recordType], hook)
+}
+
+// ExecuteQueryHooks executes registered beforeQuery hooks for the record
+// type of the supplied query. Hooks are executed in order, each receiving
+// the query modified by the previous one.
+//
+// If one of the hooks returns an error, it halts execution of other hooks and
+// returns that error untouched.
+func (r *Registry) ExecuteQueryHooks(ctx context.Context, query *skydb.Query) skyerr.Error {
+	for _, hook := range r.queryHooks(query.Type) {
+		if err := hook(ctx, query); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ExecuteFetchHooks executes registered afterFetch hooks for the supplied
+// records of the specified record type, and returns the records resulted.
+// Hooks are executed in order, each receiving the records returned by the
+// previous one.
+//
+// If one of the hooks returns an error, it halts execution of other hooks and
+// returns that error untouched.
+func (r *Registry) ExecuteFetchHooks(ctx context.Context, recordType string, records []*skydb.Record) ([]*skydb.Record, skyerr.Error) {
+	for _, hook := range r.fetchHooks(recordType) {
+		var err skyerr.Error
+		if records, err = hook(ctx, records); err != nil {
+			return nil, err
+		}
+	}
+
+	return records, nil
+}
+
 func (r *Registry) hooks(kind Kind, recordType string) (m []Func, err error) {
 	r.mutex.RLock()
 	defer r.mutex.RUnlock()
@@ -112,9 +226,40 @@ func (r *Registry) hooks(kind Kind, recordType string) (m []Func, err error) {
 
 	hooks := make([]Func, len(recordTypeHookMap[recordType]))
 	copy(hooks, recordTypeHookMap[recordType])
+	for _, mounted := range r.mounted {
+		mountedHooks, err := mounted.registry.hooks(kind, recordType)
+		if err != nil {
+			return nil, err
+		}
+		hooks = append(hooks, mountedHooks...)
+	}
 	return hooks, nil
 }
 
+func (r *Registry) queryHooks(recordType string) []QueryFunc {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	hooks := make([]QueryFunc, len(r.beforeQueryHooks[recordType]))
+	copy(hooks, r.beforeQueryHooks[recordType])
+	for _, mounted := range r.mounted {
+		hooks = append(hooks, mounted.registry.queryHooks(recordType)...)
+	}
+	return hooks
+}
+
+func (r *Registry) fetchHooks(recordType string) []FetchFunc {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	hooks := make([]FetchFunc, len(r.afterFetchHooks[recordType]))
+	copy(hooks, r.afterFetchHooks[recordType])
+	for _, mounted := range r.mounted {
+		hooks = append(hooks, mounted.registry.fetchHooks(recordType)...)
+	}
+	return hooks
+}
+
 func (r *Registry) recordTypeHookMap(kind Kind) (m recordTypeHookMap, err error) {
 	// Note: do not acquire read lock here
 	// acquire lock before calling this function
@@ -20,6 +20,7 @@ import (
 
 	"github.com/skygeario/skygear-server/pkg/server/plugin/hook/hooktest"
 	"github.com/skygeario/skygear-server/pkg/server/skydb"
+	"github.com/skygeario/skygear-server/pkg/server/skyerr"
 	. "github.com/smartystreets/goconvey/convey"
 )
 
@@ -141,3 +142,166 @@ func TestHookRegistry(t *testing.T) {
 		})
 	})
 }
+
+func TestQueryHookRegistry(t *testing.T) {
+	Convey("Registry", t, func() {
+		ctx := context.WithValue(context.Background(), HelloContextKey, "world")
+		registry := NewRegistry()
+
+		Convey("executes query hooks in order", func() {
+			registry.RegisterQueryHook("note", func(ctx context.Context, query *skydb.Query) skyerr.Error {
+				So(ctx.Value(HelloContextKey), ShouldEqual, "world")
+				limit := uint64(10)
+				query.Limit = &limit
+				return nil
+			})
+			registry.RegisterQueryHook("note", func(ctx context.Context, query *skydb.Query) skyerr.Error {
+				So(*query.Limit, ShouldEqual, 10)
+				query.Offset = 5
+				return nil
+			})
+
+			query := skydb.Query{Type: "note"}
+			err := registry.ExecuteQueryHooks(ctx, &query)
+			So(err, ShouldBeNil)
+			So(*query.Limit, ShouldEqual, 10)
+			So(query.Offset, ShouldEqual, 5)
+		})
+
+		Convey("executes query hooks of matching record type only", func() {
+			called := false
+			registry.RegisterQueryHook("secret", func(ctx context.Context, query *skydb.Query) skyerr.Error {
+				called = true
+				return nil
+			})
+
+			err := registry.ExecuteQueryHooks(ctx, &skydb.Query{Type: "note"})
+			So(err, ShouldBeNil)
+			So(called, ShouldBeFalse)
+		})
+
+		Convey("halts query hooks on error", func() {
+			called := false
+			registry.RegisterQueryHook("note", func(ctx context.Context, query *skydb.Query) skyerr.Error {
+				return skyerr.NewError(skyerr.PermissionDenied, "no query")
+			})
+			registry.RegisterQueryHook("note", func(ctx context.Context, query *skydb.Query) skyerr.Error {
+				called = true
+				return nil
+			})
+
+			err := registry.ExecuteQueryHooks(ctx, &skydb.Query{Type: "note"})
+			So(err, ShouldResemble, skyerr.NewError(skyerr.PermissionDenied, "no query"))
+			So(called, ShouldBeFalse)
+		})
+
+		Convey("executes fetch hooks in order", func() {
+			record1 := &skydb.Record{ID: skydb.NewRecordID("note", "1")}
+			record2 := &skydb.Record{ID: skydb.NewRecordID("note", "2")}
+
+			registry.RegisterFetchHook("note", func(ctx context.Context, records []*skydb.Record) ([]*skydb.Record, skyerr.Error) {
+				So(ctx.Value(HelloContextKey), ShouldEqual, "world")
+				return records[1:], nil
+			})
+			registry.RegisterFetchHook("note", func(ctx context.Context, records []*skydb.Record) ([]*skydb.Record, skyerr.Error) {
+				So(records, ShouldResemble, []*skydb.Record{record2})
+				return records, nil
+			})
+
+			records, err := registry.ExecuteFetchHooks(ctx, "note", []*skydb.Record{record1, record2})
+			So(err, ShouldBeNil)
+			So(records, ShouldResemble, []*skydb.Record{record2})
+		})
+
+		Convey("executes no fetch hooks", func() {
+			record := &skydb.Record{ID: skydb.NewRecordID("note", "1")}
+
+			records, err := registry.ExecuteFetchHooks(ctx, "note", []*skydb.Record{record})
+			So(err, ShouldBeNil)
+			So(records, ShouldResemble, []*skydb.Record{record})
+		})
+
+		Convey("halts fetch hooks on error", func() {
+			registry.RegisterFetchHook("note", func(ctx context.Context, records []*skydb.Record) ([]*skydb.Record, skyerr.Error) {
+				return nil, skyerr.NewError(skyerr.UnexpectedError, "failed")
+			})
+
+			records, err := registry.ExecuteFetchHooks(ctx, "note", []*skydb.Record{})
+			So(err, ShouldResemble, skyerr.NewError(skyerr.UnexpectedError, "failed"))
+			So(records, ShouldBeNil)
+		})
+	})
+}
+
+func TestMountedHookRegistry(t *testing.T) {
+	Convey("Registry", t, func() {
+		ctx := context.Background()
+		registry := NewRegistry()
+		parentHook := hooktest.StackingHook{}
+		registry.Register(BeforeSave, "record", parentHook.Func)
+
+		record := &skydb.Record{
+			ID: skydb.NewRecordID("record", "id"),
+		}
+
+		Convey("executes hooks of mounted registry", func() {
+			mountedHook := hooktest.StackingHook{}
+			mounted := NewRegistry()
+			mounted.Register(BeforeSave, "record", mountedHook.Func)
+			registry.Mount("plugin", mounted)
+
+			registry.ExecuteHooks(ctx, BeforeSave, record, nil)
+			So(parentHook.Records, ShouldResemble, []*skydb.Record{record})
+			So(mountedHook.Records, ShouldResemble, []*skydb.Record{record})
+		})
+
+		Convey("executes query and fetch hooks of mounted registry", func() {
+			queryCalled := false
+			fetchCalled := false
+			mounted := NewRegistry()
+			mounted.RegisterQueryHook("record", func(ctx context.Context, query *skydb.Query) skyerr.Error {
+				queryCalled = true
+				return nil
+			})
+			mounted.RegisterFetchHook("record", func(ctx context.Context, records []*skydb.Record) ([]*skydb.Record, skyerr.Error) {
+				fetchCalled = true
+				return records, nil
+			})
+			registry.Mount("plugin", mounted)
+
+			So(registry.ExecuteQueryHooks(ctx, &skydb.Query{Type: "record"}), ShouldBeNil)
+			_, err := registry.ExecuteFetchHooks(ctx, "record", []*skydb.Record{record})
+			So(err, ShouldBeNil)
+			So(queryCalled, ShouldBeTrue)
+			So(fetchCalled, ShouldBeTrue)
+		})
+
+		Convey("replaces registry mounted with the same key", func() {
+			oldHook := hooktest.StackingHook{}
+			oldMounted := NewRegistry()
+			oldMounted.Register(BeforeSave, "record", oldHook.Func)
+			registry.Mount("plugin", oldMounted)
+
+			newHook := hooktest.StackingHook{}
+			newMounted := NewRegistry()
+			newMounted.Register(BeforeSave, "record", newHook.Func)
+			registry.Mount("plugin", newMounted)
+
+			registry.ExecuteHooks(ctx, BeforeSave, record, nil)
+			So(oldHook.Records, ShouldBeEmpty)
+			So(newHook.Records, ShouldResemble, []*skydb.Record{record})
+		})
+
+		Convey("unmounts registry", func() {
+			mountedHook := hooktest.StackingHook{}
+			mounted := NewRegistry()
+			mounted.Register(BeforeSave, "record", mountedHook.Func)
+			registry.Mount("plugin", mounted)
+			registry.Mount("plugin", nil)
+
+			registry.ExecuteHooks(ctx, BeforeSave, record, nil)
+			So(parentHook.Records, ShouldResemble, []*skydb.Record{record})
+			So(mountedHook.Records, ShouldBeEmpty)
+		})
+	})
+}
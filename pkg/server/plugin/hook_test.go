@@ -33,6 +33,20 @@ func (t *hookOnlyTransport) RunHook(ctx context.Context, hookName string, record
 	return t.RunHookFunc(ctx, hookName, record, originalRecord)
 }
 
+type queryHookOnlyTransport struct {
+	RunQueryHookFunc func(context.Context, string, *skydb.Query) (*skydb.Query, error)
+	RunFetchHookFunc func(context.Context, string, []*skydb.Record) ([]*skydb.Record, error)
+	Transport
+}
+
+func (t *queryHookOnlyTransport) RunQueryHook(ctx context.Context, hookName string, query *skydb.Query) (*skydb.Query, error) {
+	return t.RunQueryHookFunc(ctx, hookName, query)
+}
+
+func (t *queryHookOnlyTransport) RunFetchHook(ctx context.Context, hookName string, records []*skydb.Record) ([]*skydb.Record, error) {
+	return t.RunFetchHookFunc(ctx, hookName, records)
+}
+
 func TestCreateHookFunc(t *testing.T) {
 	Convey("CreateHookFunc", t, func() {
 		transport := &hookOnlyTransport{}
@@ -119,3 +133,153 @@ func TestCreateHookFunc(t *testing.T) {
 		})
 	})
 }
+
+func TestCreateQueryHookFunc(t *testing.T) {
+	Convey("CreateQueryHookFunc", t, func() {
+		transport := &queryHookOnlyTransport{}
+		plugin := Plugin{transport: transport}
+
+		hookFunc := CreateQueryHookFunc(&plugin, pluginHookInfo{
+			Trigger: string(hook.BeforeQuery),
+			Type:    "note",
+			Name:    "note_beforeQuery",
+		})
+
+		query := skydb.Query{
+			Type:  "note",
+			Limit: new(uint64),
+		}
+
+		Convey("replaces query", func() {
+			called := false
+			transport.RunQueryHookFunc = func(ctx context.Context, hookName string, queryin *skydb.Query) (*skydb.Query, error) {
+				called = true
+				So(hookName, ShouldEqual, "note_beforeQuery")
+				So(queryin.Type, ShouldEqual, "note")
+
+				return &skydb.Query{
+					Type: "note",
+					Predicate: skydb.Predicate{
+						Operator: skydb.Equal,
+						Children: []interface{}{
+							skydb.Expression{
+								Type:  skydb.KeyPath,
+								Value: "deleted",
+							},
+							skydb.Expression{
+								Type:  skydb.Literal,
+								Value: false,
+							},
+						},
+					},
+				}, nil
+			}
+
+			err := hookFunc(nil, &query)
+			So(called, ShouldBeTrue)
+			So(err, ShouldBeNil)
+			So(query.Limit, ShouldBeNil)
+			So(query.Predicate.Operator, ShouldEqual, skydb.Equal)
+		})
+
+		Convey("rejects changing record type", func() {
+			transport.RunQueryHookFunc = func(ctx context.Context, hookName string, queryin *skydb.Query) (*skydb.Query, error) {
+				return &skydb.Query{Type: "secret"}, nil
+			}
+
+			err := hookFunc(nil, &query)
+			So(err, ShouldNotBeNil)
+			So(query.Type, ShouldEqual, "note")
+			So(query.Limit, ShouldNotBeNil)
+		})
+
+		Convey("returns error", func() {
+			transport.RunQueryHookFunc = func(ctx context.Context, hookName string, queryin *skydb.Query) (*skydb.Query, error) {
+				return nil, errors.New("exit status 1")
+			}
+
+			err := hookFunc(nil, &query)
+			So(err.Error(), ShouldEqual, "UnexpectedError: exit status 1")
+		})
+	})
+}
+
+func TestCreateFetchHookFunc(t *testing.T) {
+	Convey("CreateFetchHookFunc", t, func() {
+		transport := &queryHookOnlyTransport{}
+		plugin := Plugin{transport: transport}
+
+		hookFunc := CreateFetchHookFunc(&plugin, pluginHookInfo{
+			Trigger: string(hook.AfterFetch),
+			Type:    "note",
+			Name:    "note_afterFetch",
+		})
+
+		record1 := skydb.Record{
+			ID:      skydb.NewRecordID("note", "1"),
+			OwnerID: "owner",
+			Data: skydb.Data{
+				"content": "hello",
+				"secret":  "s3cr3t",
+			},
+		}
+		record2 := skydb.Record{
+			ID:      skydb.NewRecordID("note", "2"),
+			OwnerID: "owner",
+		}
+
+		Convey("transforms and drops records", func() {
+			called := false
+			transport.RunFetchHookFunc = func(ctx context.Context, hookName string, records []*skydb.Record) ([]*skydb.Record, error) {
+				called = true
+				So(hookName, ShouldEqual, "note_afterFetch")
+				So(len(records), ShouldEqual, 2)
+
+				return []*skydb.Record{
+					{
+						ID:      skydb.NewRecordID("note", "1"),
+						OwnerID: "hacker",
+						Data: skydb.Data{
+							"content": "hello",
+						},
+					},
+				}, nil
+			}
+
+			records, err := hookFunc(nil, []*skydb.Record{&record1, &record2})
+			So(called, ShouldBeTrue)
+			So(err, ShouldBeNil)
+			So(records, ShouldResemble, []*skydb.Record{
+				{
+					ID:      skydb.NewRecordID("note", "1"),
+					OwnerID: "owner",
+					Data: skydb.Data{
+						"content": "hello",
+					},
+				},
+			})
+		})
+
+		Convey("ignores records not passed in", func() {
+			transport.RunFetchHookFunc = func(ctx context.Context, hookName string, records []*skydb.Record) ([]*skydb.Record, error) {
+				return []*skydb.Record{
+					{ID: skydb.NewRecordID("note", "3")},
+				}, nil
+			}
+
+			records, err := hookFunc(nil, []*skydb.Record{&record1})
+			So(err, ShouldBeNil)
+			So(records, ShouldBeEmpty)
+		})
+
+		Convey("does not call plugin without records", func() {
+			transport.RunFetchHookFunc = func(ctx context.Context, hookName string, records []*skydb.Record) ([]*skydb.Record, error) {
+				panic("should not be called")
+			}
+
+			records, err := hookFunc(nil, []*skydb.Record{})
+			So(err, ShouldBeNil)
+			So(records, ShouldBeEmpty)
+		})
+	})
+}
@@ -151,6 +151,34 @@ func (p *httpTransport) RunHook(ctx context.Context, hookName string, record *sk
 	return &recordout, nil
 }
 
+func (p *httpTransport) RunQueryHook(ctx context.Context, hookName string, query *skydb.Query) (*skydb.Query, error) {
+	out, err := p.rpc(pluginrequest.NewQueryHookRequest(ctx, hookName, query))
+	if err != nil {
+		return nil, err
+	}
+
+	queryout, err := common.DecodeQuery(ctx, out)
+	if err != nil {
+		log.WithField("data", string(out)).Error("failed to unmarshal query")
+		return nil, err
+	}
+	return queryout, nil
+}
+
+func (p *httpTransport) RunFetchHook(ctx context.Context, hookName string, records []*skydb.Record) ([]*skydb.Record, error) {
+	out, err := p.rpc(pluginrequest.NewFetchHookRequest(ctx, hookName, records))
+	if err != nil {
+		return nil, err
+	}
+
+	recordsout, err := common.DecodeRecords(out)
+	if err != nil {
+		log.WithField("data", string(out)).Error("failed to unmarshal records")
+		return nil, err
+	}
+	return recordsout, nil
+}
+
 func (p *httpTransport) RunTimer(name string, in []byte) (out []byte, err error) {
 	req := pluginrequest.NewTimerRequest(name)
 	out, err = p.rpc(req)
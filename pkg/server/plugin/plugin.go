@@ -16,10 +16,12 @@ package plugin
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/sirupsen/logrus"
@@ -28,6 +30,7 @@ import (
 	"github.com/skygeario/skygear-server/pkg/server/logging"
 	"github.com/skygeario/skygear-server/pkg/server/plugin/hook"
 	"github.com/skygeario/skygear-server/pkg/server/plugin/provider"
+	"github.com/skygeario/skygear-server/pkg/server/pubsub"
 	"github.com/skygeario/skygear-server/pkg/server/router"
 	"github.com/skygeario/skygear-server/pkg/server/skyconfig"
 )
@@ -42,9 +45,12 @@ const (
 // Plugin represents a collection of handlers, hooks and lambda functions
 // that extends or modifies functionality provided by skygear.
 type Plugin struct {
+	name           string
 	initRetryCount int
 	transport      Transport
 	gatewayMap     map[string]*router.Gateway
+	timers         map[string]*pluginTimer
+	regInfo        registrationInfo
 }
 
 type pluginHandlerInfo struct {
@@ -72,12 +78,55 @@ type providerInfo struct {
 	Name string `json:"id"`
 }
 
+type pubsubAuthorizerInfo struct {
+	Name string `json:"name"`
+}
+
 type registrationInfo struct {
-	Handlers  []pluginHandlerInfo      `json:"handler"`
-	Hooks     []pluginHookInfo         `json:"hook"`
-	Lambdas   []map[string]interface{} `json:"op"`
-	Timers    []timerInfo              `json:"timer"`
-	Providers []providerInfo           `json:"provider"`
+	Handlers          []pluginHandlerInfo      `json:"handler"`
+	Hooks             []pluginHookInfo         `json:"hook"`
+	Lambdas           []map[string]interface{} `json:"op"`
+	Timers            []timerInfo              `json:"timer"`
+	Providers         []providerInfo           `json:"provider"`
+	PubSubAuthorizers []pubsubAuthorizerInfo   `json:"pubsub_authorizer"`
+}
+
+func (regInfo *registrationInfo) validate() error {
+	for _, lambda := range regInfo.Lambdas {
+		if name, _ := lambda["name"].(string); name == "" {
+			return errors.New("lambda without name")
+		}
+	}
+
+	for _, authorizerInfo := range regInfo.PubSubAuthorizers {
+		if authorizerInfo.Name == "" {
+			return errors.New("pubsub authorizer without name")
+		}
+	}
+
+	for _, timerInfo := range regInfo.Timers {
+		if _, err := cron.Parse(timerInfo.Spec); err != nil {
+			return fmt.Errorf(`invalid spec for timer "%s": %s`, timerInfo.Name, err)
+		}
+	}
+
+	return nil
+}
+
+// pluginTimer is a timer registered with the cron scheduler. Since a job
+// cannot be removed from the scheduler once added, a timer that is no longer
+// registered by the plugin is disabled instead.
+type pluginTimer struct {
+	spec     string
+	disabled int32
+}
+
+func (t *pluginTimer) disable() {
+	atomic.StoreInt32(&t.disabled, 1)
+}
+
+func (t *pluginTimer) isDisabled() bool {
+	return atomic.LoadInt32(&t.disabled) != 0
 }
 
 var transportFactories = map[string]TransportFactory{}
@@ -115,15 +164,20 @@ func NewPlugin(name string, path string, args []string, config skyconfig.Configu
 
 // Context contains reference to structs that will be initialized by plugin.
 type Context struct {
-	plugins          []*Plugin
-	Router           *router.Router
-	Mux              *http.ServeMux
-	HandlerInjector  router.HandlerInjector
-	HookRegistry     *hook.Registry
-	ProviderRegistry *provider.Registry
-	Scheduler        *cron.Cron
-	Config           skyconfig.Configuration
+	plugins                  []*Plugin
+	Router                   *router.Router
+	Mux                      *http.ServeMux
+	HandlerInjector          router.HandlerInjector
+	HookRegistry             *hook.Registry
+	ProviderRegistry         *provider.Registry
+	PubSubAuthorizerRegistry *pubsub.AuthorizerRegistry
+	Scheduler                *cron.Cron
+	Config                   skyconfig.Configuration
 	sync.Mutex
+
+	// registrationMutex guards the registration info and timers of the
+	// plugins, which are replaced when a plugin is initialized or reloaded.
+	registrationMutex sync.RWMutex
 }
 
 // AddPluginConfiguration creates and appends a plugin
@@ -133,6 +187,36 @@ func (c *Context) AddPluginConfiguration(name string, path string, args []string
 	return &plug
 }
 
+// AddPlugin creates and appends a plugin of the name by the plugin
+// configuration. Calls to the plugin are limited by the timeout,
+// concurrency and circuit breaker settings in the configuration.
+func (c *Context) AddPlugin(name string, pluginConfig skyconfig.PluginConfig) *Plugin {
+	plug := c.AddPluginConfiguration(pluginConfig.Transport, pluginConfig.Path, pluginConfig.Args)
+	plug.name = name
+	plug.transport = newGuardedTransport(plug.transport, pluginConfig)
+	return plug
+}
+
+// PluginStates returns the state of each plugin by name.
+func (c *Context) PluginStates() map[string]TransportState {
+	states := map[string]TransportState{}
+	for i, eachPlugin := range c.plugins {
+		name := eachPlugin.name
+		if name == "" {
+			name = fmt.Sprintf("plugin%d", i)
+		}
+		states[name] = eachPlugin.State()
+	}
+	return states
+}
+
+// pluginTimers returns the timers currently registered by the plugin.
+func (c *Context) pluginTimers(p *Plugin) map[string]*pluginTimer {
+	c.registrationMutex.RLock()
+	defer c.registrationMutex.RUnlock()
+	return p.timers
+}
+
 func (c *Context) getInitPayload() ([]byte, error) {
 	payload := struct {
 		Config skyconfig.Configuration `json:"config"`
@@ -175,6 +259,26 @@ func (c *Context) InitPlugins() {
 	}()
 }
 
+// ReloadPlugins requests all plugins to send their registration info again,
+// and replaces what each plugin registered with the new registration info.
+//
+// A plugin that fails to reload keeps its previous registration. An error
+// is returned if any of the plugins fails to reload.
+func (c *Context) ReloadPlugins() error {
+	failed := []string{}
+	for _, eachPlugin := range c.plugins {
+		if err := eachPlugin.Reload(c); err != nil {
+			log.WithError(err).Error("Fail to reload plugin")
+			failed = append(failed, err.Error())
+		}
+	}
+
+	if len(failed) > 0 {
+		return fmt.Errorf("fail to reload plugins: %s", strings.Join(failed, "; "))
+	}
+	return nil
+}
+
 // IsInitialized returns true if all the plugins have been initialized
 func (c *Context) IsInitialized() bool {
 	for _, eachPlugin := range c.plugins {
@@ -252,12 +356,43 @@ func (p *Plugin) Init(context *Context) {
 	transport.SendEvent("after-config", data)
 }
 
+// Reload sends the init event to the plugin again, and replaces handlers,
+// lambdas, hooks, timers and providers registered by the plugin with
+// those in the new registration info. Those no longer in the registration
+// info are unregistered.
+//
+// Registration of the plugin is left untouched if the plugin fails
+// to respond with valid registration info.
+func (p *Plugin) Reload(context *Context) error {
+	if !p.IsInitialized() {
+		return errors.New("plugin is not initialized")
+	}
+
+	data, err := context.getInitPayload()
+	if err != nil {
+		return err
+	}
+
+	log.Info("Sending init event to plugin for reload")
+	regInfo, err := p.requestInit(data)
+	if err != nil {
+		return err
+	}
+
+	if err := regInfo.validate(); err != nil {
+		return fmt.Errorf("Invalid plugin registration info. Error: %v", err)
+	}
+
+	p.processRegistrationInfo(context, regInfo)
+	return nil
+}
+
 func (p *Plugin) requestInit(data []byte) (regInfo registrationInfo, initErr error) {
 	out, err := p.transport.SendEvent("init", data)
 	log.WithFields(logrus.Fields{
 		"out":    string(out),
 		"err":    err,
-		"plugin": p,
+		"plugin": p.name,
 	}).Info("Get response from init")
 
 	if err != nil {
@@ -277,17 +412,28 @@ func (p *Plugin) requestInit(data []byte) (regInfo registrationInfo, initErr err
 func (p *Plugin) IsInitialized() bool {
 	transportState := p.transport.State()
 	return transportState == TransportStateInitialized ||
-		transportState == TransportStateReady
+		transportState == TransportStateReady ||
+		transportState == TransportStateCircuitOpen
 }
 
 // IsReady returns true if the plugin is ready for client request
+//
+// A plugin with its circuit breaker open is considered ready, calls
+// to such plugin fail individually.
 func (p *Plugin) IsReady() bool {
-	return p.transport.State() == TransportStateReady
+	transportState := p.transport.State()
+	return transportState == TransportStateReady ||
+		transportState == TransportStateCircuitOpen
+}
+
+// State returns the state of the plugin transport.
+func (p *Plugin) State() TransportState {
+	return p.transport.State()
 }
 
 func (p *Plugin) processRegistrationInfo(context *Context, regInfo registrationInfo) {
-	context.Lock()
-	defer context.Unlock()
+	context.registrationMutex.Lock()
+	defer context.registrationMutex.Unlock()
 	log.WithFields(logrus.Fields{
 		"regInfo":   regInfo,
 		"transport": p.transport,
@@ -301,55 +447,130 @@ func (p *Plugin) processRegistrationInfo(context *Context, regInfo registrationI
 		log.Info("Ignoring scheduled cron jobs because server is in slave mode.")
 	}
 	p.initProvider(context.ProviderRegistry, regInfo.Providers)
+	p.removeProvider(context.ProviderRegistry, regInfo.Providers)
+	if context.PubSubAuthorizerRegistry != nil {
+		p.initPubSubAuthorizer(context.PubSubAuthorizerRegistry, regInfo.PubSubAuthorizers)
+	}
+	p.regInfo = regInfo
+}
+
+func handlerPath(name string) string {
+	path := strings.Replace(name, ":", "/", -1)
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+	return path
 }
 
+// initHandler registers handlers of the plugin with the serveMux,
+// replacing handlers previously registered by the plugin. Handlers of
+// each path are replaced in one step.
 func (p *Plugin) initHandler(mux *http.ServeMux, injector router.HandlerInjector, handlers []pluginHandlerInfo, config skyconfig.Configuration) {
+	pathHandlers := map[string]map[string]router.Handler{}
 	for _, handler := range handlers {
 		h := NewPluginHandler(handler, p)
 		injector.Inject(h)
 		h.Setup()
-		name := h.Name
-		name = strings.Replace(name, ":", "/", -1)
-		if !strings.HasPrefix(name, "/") {
-			name = "/" + name
-		}
-		var handlerGateway *router.Gateway
-		handlerGateway, ok := p.gatewayMap[name]
-		if !ok {
-			handlerGateway = router.NewGateway("", name, "plugin", mux)
+		name := handlerPath(h.Name)
+		if _, ok := p.gatewayMap[name]; !ok {
+			handlerGateway := router.NewGateway("", name, "plugin", mux)
 			handlerGateway.ResponseTimeout = time.Duration(config.App.ResponseTimeout) * time.Second
 			p.gatewayMap[name] = handlerGateway
 		}
+		if pathHandlers[name] == nil {
+			pathHandlers[name] = map[string]router.Handler{}
+		}
 		for _, method := range handler.Methods {
-			handlerGateway.Handle(method, h)
+			pathHandlers[name][method] = h
 		}
 		log.Debugf(`Registered handler "%s" with serveMux at path "%s"`, h.Name, name)
 	}
+
+	for name, handlerGateway := range p.gatewayMap {
+		handlerGateway.Replace(pathHandlers[name])
+	}
 }
 
+// initLambda maps lambdas of the plugin with the router, and unmaps
+// lambdas previously registered by the plugin that are not in the
+// supplied lambdas, in one step.
 func (p *Plugin) initLambda(r *router.Router, injector router.HandlerInjector, lambdas []map[string]interface{}) {
+	routes := []router.Route{}
+	registered := map[string]bool{}
 	for _, lambda := range lambdas {
 		handler := NewLambdaHandler(lambda, p)
 		injector.Inject(handler)
 		handler.Setup()
-		r.Map(handler.Name, "plugin", handler)
+		routes = append(routes, router.Route{
+			Action:  handler.Name,
+			Tag:     "plugin",
+			Handler: handler,
+		})
+		registered[handler.Name] = true
 		log.Debugf(`Registered lambda "%s" with router.`, handler.Name)
 	}
+
+	unmapped := []string{}
+	for _, lambda := range p.regInfo.Lambdas {
+		name, _ := lambda["name"].(string)
+		if registered[name] {
+			continue
+		}
+		unmapped = append(unmapped, name)
+		log.Debugf(`Unregistered lambda "%s" from router.`, name)
+	}
+
+	r.Replace(unmapped, routes)
 }
 
-func (p *Plugin) initHook(registry *hook.Registry, hookInfos []pluginHookInfo) {
+// initHook registers hooks of the plugin. Hooks are registered with a
+// registry owned by the plugin, which is mounted to the supplied registry
+// replacing hooks previously registered by the plugin.
+func (p *Plugin) initHook(parentRegistry *hook.Registry, hookInfos []pluginHookInfo) {
+	registry := hook.NewRegistry()
 	for _, hookInfo := range hookInfos {
 		kind := hook.Kind(hookInfo.Trigger)
 		recordType := hookInfo.Type
 
-		registry.Register(kind, recordType, CreateHookFunc(p, hookInfo))
+		switch kind {
+		case hook.BeforeQuery:
+			registry.RegisterQueryHook(recordType, CreateQueryHookFunc(p, hookInfo))
+		case hook.AfterFetch:
+			registry.RegisterFetchHook(recordType, CreateFetchHookFunc(p, hookInfo))
+		default:
+			registry.Register(kind, recordType, CreateHookFunc(p, hookInfo))
+		}
 	}
+	parentRegistry.Mount(p, registry)
 }
 
+// initPubSubAuthorizer mounts the pubsub authorizers of the plugin to the
+// registry, replacing the authorizers previously mounted by the plugin.
+func (p *Plugin) initPubSubAuthorizer(registry *pubsub.AuthorizerRegistry, authorizerInfos []pubsubAuthorizerInfo) {
+	funcs := []pubsub.AuthorizeFunc{}
+	for _, authorizerInfo := range authorizerInfos {
+		funcs = append(funcs, CreatePubSubAuthorizeFunc(p, authorizerInfo))
+	}
+	registry.Mount(p, funcs)
+}
+
+// initTimer adds timers of the plugin to the cron scheduler. Timers
+// previously added by the plugin are kept if the spec is unchanged, and are
+// disabled otherwise.
 func (p *Plugin) initTimer(c *cron.Cron, timerInfos []timerInfo) {
+	timers := map[string]*pluginTimer{}
 	for _, timerInfo := range timerInfos {
 		timerName := timerInfo.Name
+		if timer, ok := p.timers[timerName]; ok && timer.spec == timerInfo.Spec {
+			timers[timerName] = timer
+			continue
+		}
+
+		timer := &pluginTimer{spec: timerInfo.Spec}
 		err := c.AddFunc(timerInfo.Spec, func() {
+			if timer.isDisabled() {
+				return
+			}
 			output, _ := p.transport.RunTimer(timerName, []byte{})
 			log.Debugf("Executed a timer{%v} with result: %s", timerName, output)
 		})
@@ -357,7 +578,16 @@ func (p *Plugin) initTimer(c *cron.Cron, timerInfos []timerInfo) {
 		if err != nil {
 			panic(fmt.Errorf(`unable to add timer for "%s": %s`, timerName, err))
 		}
+		timers[timerName] = timer
 	}
+
+	for timerName, timer := range p.timers {
+		if timers[timerName] != timer {
+			timer.disable()
+			log.Debugf(`Disabled timer "%s"`, timerName)
+		}
+	}
+	p.timers = timers
 }
 
 func (p *Plugin) initProvider(registry *provider.Registry, providerInfos []providerInfo) {
@@ -366,3 +596,20 @@ func (p *Plugin) initProvider(registry *provider.Registry, providerInfos []provi
 		registry.RegisterAuthProvider(providerInfo.Name, provider)
 	}
 }
+
+// removeProvider removes providers previously registered by the plugin that
+// are not in the supplied providers.
+func (p *Plugin) removeProvider(registry *provider.Registry, providerInfos []providerInfo) {
+	registered := map[string]bool{}
+	for _, providerInfo := range providerInfos {
+		registered[providerInfo.Name] = true
+	}
+
+	for _, providerInfo := range p.regInfo.Providers {
+		if registered[providerInfo.Name] {
+			continue
+		}
+		registry.UnregisterAuthProvider(providerInfo.Name)
+		log.Debugf(`Unregistered provider "%s"`, providerInfo.Name)
+	}
+}
@@ -15,15 +15,25 @@
 package plugin
 
 import (
+	"context"
+	"errors"
 	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
 	"testing"
 
 	"github.com/facebookgo/inject"
+	"github.com/golang/mock/gomock"
 	"github.com/robfig/cron"
 	. "github.com/smartystreets/goconvey/convey"
 
+	"github.com/skygeario/skygear-server/pkg/server/asset/mock_asset"
+	"github.com/skygeario/skygear-server/pkg/server/plugin/hook"
+	"github.com/skygeario/skygear-server/pkg/server/plugin/provider"
 	"github.com/skygeario/skygear-server/pkg/server/router"
 	"github.com/skygeario/skygear-server/pkg/server/skyconfig"
+	"github.com/skygeario/skygear-server/pkg/server/skydb"
 )
 
 type ContextKey string
@@ -144,5 +154,178 @@ func TestPlugin(t *testing.T) {
 			So(plugin.gatewayMap, ShouldContainKey, "/faseng/location")
 		})
 	})
+}
+
+type initTransport struct {
+	nullTransport
+	initOut    []byte
+	initErr    error
+	hookCalled int
+}
+
+func (t *initTransport) RunHook(ctx context.Context, hookName string, record *skydb.Record, oldRecord *skydb.Record, async bool) (*skydb.Record, error) {
+	t.hookCalled++
+	return record, nil
+}
+
+func (t *initTransport) SendEvent(name string, in []byte) ([]byte, error) {
+	if name == "init" {
+		return t.initOut, t.initErr
+	}
+	return in, nil
+}
+
+func isActionMapped(r *router.Router, action string) bool {
+	req, _ := http.NewRequest(
+		"POST",
+		"http://skygear.dev/",
+		strings.NewReader(`{"action": "`+action+`"}`),
+	)
+	req.Header.Set("Content-Type", "application/json")
+	resp := httptest.NewRecorder()
+	r.ServeHTTP(resp, req)
+	return !strings.Contains(resp.Body.String(), "route unmatched")
+}
+
+func TestPluginReload(t *testing.T) {
+	config := skyconfig.Configuration{}
+	Convey("reload plugin", t, func() {
+		transport := &initTransport{}
+		transport.state = TransportStateReady
+		plugin := &Plugin{
+			transport:  transport,
+			gatewayMap: map[string]*router.Gateway{},
+		}
+
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		serviceGraph := &inject.Graph{}
+		serviceGraph.Provide(&inject.Object{
+			Value:    mock_asset.NewMockURLSignerStore(ctrl),
+			Complete: true,
+			Name:     "AssetStore",
+		})
+
+		pluginContext := &Context{
+			plugins: []*Plugin{plugin},
+			Router:  router.NewRouter(),
+			Mux:     http.NewServeMux(),
+			HandlerInjector: router.HandlerInjector{
+				ServiceGraph: serviceGraph,
+				PreprocessorMap: &router.PreprocessorRegistry{
+					"inject_auth_id": MockInjectAuthIDPreprocessor{},
+					"plugin_ready":   MockPluginReadyPreprocessor{},
+					"authenticator":  MockNullPreprocessor{},
+					"dbconn":         MockNullPreprocessor{},
+					"require_auth":   MockNullPreprocessor{},
+					"check_user":     MockNullPreprocessor{},
+				},
+			},
+			HookRegistry:     hook.NewRegistry(),
+			ProviderRegistry: provider.NewRegistry(),
+			Scheduler:        cron.New(),
+			Config:           config,
+		}
 
+		transport.initOut = []byte(`{
+			"op": [{"name": "hello"}, {"name": "bye"}],
+			"handler": [{"name": "chima:echo", "methods": ["GET", "POST"]}],
+			"hook": [{"trigger": "beforeSave", "type": "note", "name": "note_beforeSave"}],
+			"timer": [{"name": "every_minute", "spec": "0 * * * * *"}, {"name": "every_hour", "spec": "0 0 * * * *"}],
+			"provider": [{"type": "auth", "id": "com.example"}]
+		}`)
+		So(pluginContext.ReloadPlugins(), ShouldBeNil)
+
+		everyMinute := pluginContext.pluginTimers(plugin)["every_minute"]
+		everyHour := pluginContext.pluginTimers(plugin)["every_hour"]
+		So(everyMinute, ShouldNotBeNil)
+		So(everyHour, ShouldNotBeNil)
+		So(len(pluginContext.Scheduler.Entries()), ShouldEqual, 2)
+
+		record := &skydb.Record{
+			ID: skydb.NewRecordID("note", "id"),
+		}
+		So(pluginContext.HookRegistry.ExecuteHooks(context.Background(), hook.BeforeSave, record, nil), ShouldBeNil)
+		So(transport.hookCalled, ShouldEqual, 1)
+
+		Convey("unregisters removed entries", func() {
+			transport.initOut = []byte(`{
+				"op": [{"name": "hello"}],
+				"handler": [{"name": "chima:echo", "methods": ["GET"]}],
+				"hook": [],
+				"timer": [{"name": "every_minute", "spec": "0 * * * * *"}],
+				"provider": []
+			}`)
+			So(pluginContext.ReloadPlugins(), ShouldBeNil)
+
+			So(isActionMapped(pluginContext.Router, "hello"), ShouldBeTrue)
+			So(isActionMapped(pluginContext.Router, "bye"), ShouldBeFalse)
+
+			So(pluginContext.pluginTimers(plugin)["every_minute"], ShouldEqual, everyMinute)
+			So(everyMinute.isDisabled(), ShouldBeFalse)
+			So(everyHour.isDisabled(), ShouldBeTrue)
+			So(len(pluginContext.Scheduler.Entries()), ShouldEqual, 2)
+
+			_, err := pluginContext.ProviderRegistry.GetAuthProvider("com.example")
+			So(err, ShouldNotBeNil)
+
+			So(pluginContext.HookRegistry.ExecuteHooks(context.Background(), hook.BeforeSave, record, nil), ShouldBeNil)
+			So(transport.hookCalled, ShouldEqual, 1)
+		})
+
+		Convey("replaces timer with changed spec", func() {
+			transport.initOut = []byte(`{
+				"timer": [{"name": "every_minute", "spec": "30 * * * * *"}]
+			}`)
+			So(pluginContext.ReloadPlugins(), ShouldBeNil)
+
+			So(pluginContext.pluginTimers(plugin)["every_minute"], ShouldNotEqual, everyMinute)
+			So(everyMinute.isDisabled(), ShouldBeTrue)
+			So(len(pluginContext.Scheduler.Entries()), ShouldEqual, 3)
+		})
+
+		Convey("keeps registration if plugin fails to reload", func() {
+			transport.initErr = errors.New("plugin unavailable")
+			So(pluginContext.ReloadPlugins(), ShouldNotBeNil)
+
+			So(isActionMapped(pluginContext.Router, "bye"), ShouldBeTrue)
+			So(everyHour.isDisabled(), ShouldBeFalse)
+			_, err := pluginContext.ProviderRegistry.GetAuthProvider("com.example")
+			So(err, ShouldBeNil)
+		})
+
+		Convey("keeps registration if registration info is invalid", func() {
+			transport.initOut = []byte(`{
+				"timer": [{"name": "every_minute", "spec": "incorrect-spec"}]
+			}`)
+			So(pluginContext.ReloadPlugins(), ShouldNotBeNil)
+
+			So(isActionMapped(pluginContext.Router, "bye"), ShouldBeTrue)
+			So(everyMinute.isDisabled(), ShouldBeFalse)
+		})
+
+		Convey("reloads concurrently", func() {
+			var wg sync.WaitGroup
+			for i := 0; i < 10; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					pluginContext.ReloadPlugins()
+				}()
+			}
+			wg.Wait()
+
+			So(pluginContext.pluginTimers(plugin)["every_minute"], ShouldEqual, everyMinute)
+			So(len(pluginContext.pluginTimers(plugin)), ShouldEqual, 2)
+			So(len(pluginContext.Scheduler.Entries()), ShouldEqual, 2)
+		})
+	})
+
+	Convey("does not reload uninitialized plugin", t, func() {
+		transport := &initTransport{}
+		transport.state = TransportStateUninitialized
+		plugin := &Plugin{transport: transport}
+		So(plugin.Reload(&Context{}), ShouldNotBeNil)
+	})
 }
@@ -41,6 +41,14 @@ func (r *Registry) RegisterAuthProvider(name string, p AuthProvider) {
 	r.authProviders[name] = p
 }
 
+// UnregisterAuthProvider removes the AuthProvider of the name from the
+// registry.
+func (r *Registry) UnregisterAuthProvider(name string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	delete(r.authProviders, name)
+}
+
 // GetAuthProvider gets an AuthProvider from the registry.
 func (r *Registry) GetAuthProvider(name string) (AuthProvider, error) {
 	r.mutex.RLock()
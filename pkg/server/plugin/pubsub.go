@@ -0,0 +1,74 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/skygeario/skygear-server/pkg/server/pubsub"
+	"github.com/skygeario/skygear-server/pkg/server/router"
+	"github.com/skygeario/skygear-server/pkg/server/skyerr"
+)
+
+// CreatePubSubAuthorizeFunc returns a pubsub.AuthorizeFunc that run the
+// pubsub authorizer registered by a plugin.
+//
+// The authorizer is called as a lambda with the action, the channel,
+// the user and roles of the client and the decision made so far. It returns
+// an object with a boolean `allowed`.
+func CreatePubSubAuthorizeFunc(p *Plugin, authorizerInfo pubsubAuthorizerInfo) pubsub.AuthorizeFunc {
+	return func(ctx context.Context, client pubsub.Client, action string, channel string, allowed bool) (bool, error) {
+		if client.UserID != "" {
+			ctx = context.WithValue(ctx, router.UserIDContextKey, client.UserID)
+		}
+		ctx = context.WithValue(ctx, router.AccessKeyTypeContextKey, router.ClientAccessKey)
+
+		roles := client.Roles
+		if roles == nil {
+			roles = []string{}
+		}
+		in, err := json.Marshal(map[string]interface{}{
+			"args": map[string]interface{}{
+				"action":  action,
+				"channel": channel,
+				"user_id": client.UserID,
+				"roles":   roles,
+				"allowed": allowed,
+			},
+		})
+		if err != nil {
+			return false, err
+		}
+
+		out, err := p.transport.RunLambda(ctx, authorizerInfo.Name, in)
+		if err != nil {
+			return false, err
+		}
+
+		var result struct {
+			Allowed *bool `json:"allowed"`
+		}
+		if jsonErr := json.Unmarshal(out, &result); jsonErr != nil || result.Allowed == nil {
+			return false, skyerr.NewErrorf(
+				skyerr.UnexpectedError,
+				`pubsub authorizer "%s" returns malformed result: %s`,
+				authorizerInfo.Name,
+				out,
+			)
+		}
+		return *result.Allowed, nil
+	}
+}
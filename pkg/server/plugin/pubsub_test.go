@@ -0,0 +1,103 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package plugin
+
+import (
+	"context"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/skygeario/skygear-server/pkg/server/pubsub"
+	"github.com/skygeario/skygear-server/pkg/server/router"
+	. "github.com/skygeario/skygear-server/pkg/server/skytest"
+)
+
+type authorizerTransport struct {
+	nullTransport
+	name   string
+	in     []byte
+	userID interface{}
+	out    []byte
+}
+
+func (t *authorizerTransport) RunLambda(ctx context.Context, name string, in []byte) ([]byte, error) {
+	t.name = name
+	t.in = in
+	t.userID = ctx.Value(router.UserIDContextKey)
+	return t.out, nil
+}
+
+func TestCreatePubSubAuthorizeFunc(t *testing.T) {
+	Convey("pubsub authorizer", t, func() {
+		transport := &authorizerTransport{}
+		plugin := &Plugin{transport: transport}
+		authorize := CreatePubSubAuthorizeFunc(plugin, pubsubAuthorizerInfo{Name: "authorize_channel"})
+		client := pubsub.Client{
+			UserID: "user-id",
+			Roles:  []string{"admin"},
+		}
+
+		Convey("calls the plugin with the request", func() {
+			transport.out = []byte(`{"allowed": false}`)
+			allowed, err := authorize(context.Background(), client, "sub", "public:chat", true)
+			So(err, ShouldBeNil)
+			So(allowed, ShouldBeFalse)
+
+			So(transport.name, ShouldEqual, "authorize_channel")
+			So(transport.userID, ShouldEqual, "user-id")
+			So(transport.in, ShouldEqualJSON, `{
+				"args": {
+					"action": "sub",
+					"channel": "public:chat",
+					"user_id": "user-id",
+					"roles": ["admin"],
+					"allowed": true
+				}
+			}`)
+		})
+
+		Convey("allows by the plugin", func() {
+			transport.out = []byte(`{"allowed": true}`)
+			allowed, err := authorize(context.Background(), client, "pub", "public:chat", false)
+			So(err, ShouldBeNil)
+			So(allowed, ShouldBeTrue)
+		})
+
+		Convey("returns error on malformed result", func() {
+			transport.out = []byte(`{}`)
+			_, err := authorize(context.Background(), client, "pub", "public:chat", true)
+			So(err, ShouldNotBeNil)
+		})
+	})
+
+	Convey("init pubsub authorizer", t, func() {
+		transport := &authorizerTransport{out: []byte(`{"allowed": true}`)}
+		plugin := &Plugin{transport: transport}
+		registry := pubsub.NewAuthorizerRegistry()
+
+		plugin.initPubSubAuthorizer(registry, []pubsubAuthorizerInfo{{Name: "authorize_channel"}})
+		allowed, err := registry.Authorize(context.Background(), pubsub.Client{}, "sub", "chat", false)
+		So(err, ShouldBeNil)
+		So(allowed, ShouldBeTrue)
+
+		plugin.initPubSubAuthorizer(registry, []pubsubAuthorizerInfo{})
+		transport.name = ""
+		allowed, err = registry.Authorize(context.Background(), pubsub.Client{}, "sub", "chat", false)
+		So(err, ShouldBeNil)
+		So(allowed, ShouldBeFalse)
+		So(transport.name, ShouldEqual, "")
+	})
+}
@@ -38,6 +38,16 @@ type HookRequest struct {
 	Original interface{} `json:"original"`
 }
 
+// QueryHookRequest contains the query involved in a beforeQuery hook.
+type QueryHookRequest struct {
+	Query interface{} `json:"query"`
+}
+
+// FetchHookRequest contains records involved in an afterFetch hook.
+type FetchHookRequest struct {
+	Records []interface{} `json:"records"`
+}
+
 // NewLambdaRequest creates a new lambda request.
 func NewLambdaRequest(ctx context.Context, name string, args json.RawMessage) *Request {
 	return &Request{Kind: "op", Name: name, Param: args, Context: ctx}
@@ -62,6 +72,25 @@ func NewHookRequest(ctx context.Context, hookName string, record *skydb.Record,
 	return &Request{Kind: "hook", Name: hookName, Param: param, Context: ctx, Async: async}
 }
 
+// NewQueryHookRequest creates a new beforeQuery hook request.
+func NewQueryHookRequest(ctx context.Context, hookName string, query *skydb.Query) *Request {
+	param := QueryHookRequest{
+		Query: skyconv.ToMap((*skyconv.MapQuery)(query)),
+	}
+	return &Request{Kind: "hook", Name: hookName, Param: param, Context: ctx}
+}
+
+// NewFetchHookRequest creates a new afterFetch hook request.
+func NewFetchHookRequest(ctx context.Context, hookName string, records []*skydb.Record) *Request {
+	param := FetchHookRequest{
+		Records: make([]interface{}, len(records)),
+	}
+	for i, record := range records {
+		param.Records[i] = (*skyconv.JSONRecord)(record)
+	}
+	return &Request{Kind: "hook", Name: hookName, Param: param, Context: ctx}
+}
+
 // NewAuthRequest creates a new auth request.
 func NewAuthRequest(ctx context.Context, authReq *skyplugin.AuthRequest) *Request {
 	return &Request{
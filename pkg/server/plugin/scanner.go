@@ -0,0 +1,101 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package plugin
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http/httptest"
+	"strings"
+
+	"github.com/skygeario/skygear-server/pkg/server/asset"
+	"github.com/skygeario/skygear-server/pkg/server/router"
+)
+
+// LambdaScanner scans assets by calling a plugin lambda through the router
+// with master key. The lambda is called with the asset name and the
+// base64-encoded content in args:
+//
+//  {"name": "asset-name", "data": "aGVsbG8gd29ybGQ="}
+//
+// and returns the scan result:
+//
+//  {"infected": true, "signature": "Eicar-Test-Signature"}
+//
+// Because the whole file is sent to the plugin, this is only suitable for
+// small assets. Files larger than MaxSize are not scanned, and stay
+// pending to be scanned.
+type LambdaScanner struct {
+	Router *router.Router
+	Lambda string
+	// MaxSize is the maximum size of files scanned, which is
+	// DefaultLambdaScanMaxSize if zero
+	MaxSize int64
+}
+
+// DefaultLambdaScanMaxSize is the maximum size of files scanned by
+// LambdaScanner by default
+const DefaultLambdaScanMaxSize = 10 << 20
+
+// Scan calls the lambda with the content read from src
+func (s *LambdaScanner) Scan(name string, src io.Reader) (*asset.ScanResult, error) {
+	maxSize := s.MaxSize
+	if maxSize <= 0 {
+		maxSize = DefaultLambdaScanMaxSize
+	}
+	data, err := ioutil.ReadAll(io.LimitReader(src, maxSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > maxSize {
+		return nil, fmt.Errorf("asset %s is larger than %d bytes to be scanned by lambda", name, maxSize)
+	}
+
+	payload := &router.Payload{
+		Meta: map[string]interface{}{
+			"method": "POST",
+			"path":   strings.Replace(s.Lambda, ":", "/", -1),
+		},
+		Data: map[string]interface{}{
+			"action": s.Lambda,
+			"args": map[string]interface{}{
+				"name": name,
+				"data": base64.StdEncoding.EncodeToString(data),
+			},
+		},
+		AccessKey: router.MasterAccessKey,
+	}
+	payload.SetContext(context.Background())
+
+	resp := router.NewResponse(httptest.NewRecorder())
+	s.Router.HandlePayload(payload, resp)
+	if resp.Err != nil {
+		return nil, resp.Err
+	}
+
+	result, ok := resp.Result.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("unexpected result of lambda %s: %v", s.Lambda, resp.Result)
+	}
+	infected, _ := result["infected"].(bool)
+	signature, _ := result["signature"].(string)
+	return &asset.ScanResult{
+		Infected:  infected,
+		Signature: signature,
+	}, nil
+}
@@ -0,0 +1,94 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package plugin
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+
+	"github.com/skygeario/skygear-server/pkg/server/asset"
+	"github.com/skygeario/skygear-server/pkg/server/router"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+type scanLambdaHandler struct {
+	payload *router.Payload
+	result  interface{}
+}
+
+func (h *scanLambdaHandler) Setup() {}
+
+func (h *scanLambdaHandler) GetPreprocessors() []router.Processor {
+	return nil
+}
+
+func (h *scanLambdaHandler) Handle(payload *router.Payload, response *router.Response) {
+	h.payload = payload
+	response.Result = h.result
+}
+
+func TestLambdaScanner(t *testing.T) {
+	Convey("LambdaScanner", t, func() {
+		r := router.NewRouter()
+		handler := &scanLambdaHandler{}
+		r.Map("scan_asset", "plugin", handler)
+		scanner := &LambdaScanner{Router: r, Lambda: "scan_asset"}
+
+		Convey("calls lambda with the content", func() {
+			handler.result = map[string]interface{}{
+				"infected":  true,
+				"signature": "Eicar-Test-Signature",
+			}
+			result, err := scanner.Scan("asset-name", strings.NewReader("hello world"))
+			So(err, ShouldBeNil)
+			So(result, ShouldResemble, &asset.ScanResult{
+				Infected:  true,
+				Signature: "Eicar-Test-Signature",
+			})
+			So(handler.payload.HasMasterKey(), ShouldBeTrue)
+			So(handler.payload.Data["args"], ShouldResemble, map[string]interface{}{
+				"name": "asset-name",
+				"data": base64.StdEncoding.EncodeToString([]byte("hello world")),
+			})
+		})
+
+		Convey("returns clean result", func() {
+			handler.result = map[string]interface{}{"infected": false}
+			result, err := scanner.Scan("asset-name", strings.NewReader("hello world"))
+			So(err, ShouldBeNil)
+			So(result, ShouldResemble, &asset.ScanResult{})
+		})
+
+		Convey("returns error on unexpected result", func() {
+			handler.result = "OK"
+			_, err := scanner.Scan("asset-name", strings.NewReader("hello world"))
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("returns error if file is too large", func() {
+			scanner.MaxSize = 5
+			_, err := scanner.Scan("asset-name", strings.NewReader("hello world"))
+			So(err, ShouldNotBeNil)
+			So(handler.payload, ShouldBeNil)
+		})
+
+		Convey("returns error if lambda does not exist", func() {
+			scanner.Lambda = "not_exist"
+			_, err := scanner.Scan("asset-name", strings.NewReader("hello world"))
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
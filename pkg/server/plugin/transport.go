@@ -60,6 +60,11 @@ const (
 	// TransportStateError is the state when an error has occurred
 	// in the transport and it is not able to serve requests
 	TransportStateError
+
+	// TransportStateCircuitOpen is the state when the transport is ready
+	// but calls to the plugin are rejected because the plugin
+	// has been failing
+	TransportStateCircuitOpen
 )
 
 // TransportInitHandler models the handler for transport init
@@ -85,6 +90,20 @@ type Transport interface {
 	// in any of its memebers with the record being passed in.
 	RunHook(ctx context.Context, hookName string, record *skydb.Record, oldRecord *skydb.Record, async bool) (*skydb.Record, error)
 
+	// RunQueryHook runs the beforeQuery hook with a name recognized by
+	// plugin, passing in the query to be performed.
+	//
+	// A skydb.Query is returned as a result of invocation, which replaces
+	// the query being passed in.
+	RunQueryHook(ctx context.Context, hookName string, query *skydb.Query) (*skydb.Query, error)
+
+	// RunFetchHook runs the afterFetch hook with a name recognized by
+	// plugin, passing in the records fetched.
+	//
+	// The records returned are newly allocated instances. Records not
+	// returned by the plugin are dropped from the result.
+	RunFetchHook(ctx context.Context, hookName string, records []*skydb.Record) ([]*skydb.Record, error)
+
 	RunTimer(name string, in []byte) ([]byte, error)
 
 	// RunProvider runs the auth provider with the specified AuthRequest.
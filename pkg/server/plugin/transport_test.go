@@ -54,6 +54,14 @@ func (t *nullTransport) RunHook(ctx context.Context, hookName string, reocrd *sk
 	t.lastContext = ctx
 	return
 }
+func (t *nullTransport) RunQueryHook(ctx context.Context, hookName string, query *skydb.Query) (*skydb.Query, error) {
+	t.lastContext = ctx
+	return query, nil
+}
+func (t *nullTransport) RunFetchHook(ctx context.Context, hookName string, records []*skydb.Record) ([]*skydb.Record, error) {
+	t.lastContext = ctx
+	return records, nil
+}
 func (t *nullTransport) RunTimer(name string, in []byte) (out []byte, err error) {
 	out = in
 	return
@@ -4,9 +4,9 @@ package plugin
 
 import "strconv"
 
-const _TransportState_name = "TransportStateUninitializedTransportStateInitializedTransportStateReadyTransportStateWorkerUnavailableTransportStateError"
+const _TransportState_name = "TransportStateUninitializedTransportStateInitializedTransportStateReadyTransportStateWorkerUnavailableTransportStateErrorTransportStateCircuitOpen"
 
-var _TransportState_index = [...]uint8{0, 27, 52, 71, 102, 121}
+var _TransportState_index = [...]uint8{0, 27, 52, 71, 102, 121, 146}
 
 func (i TransportState) String() string {
 	if i < 0 || i >= TransportState(len(_TransportState_index)-1) {
@@ -98,6 +98,34 @@ func (p *zmqTransport) RunHook(ctx context.Context, hookName string, record *sky
 	return &recordout, nil
 }
 
+func (p *zmqTransport) RunQueryHook(ctx context.Context, hookName string, query *skydb.Query) (*skydb.Query, error) {
+	out, err := p.rpc(pluginrequest.NewQueryHookRequest(ctx, hookName, query))
+	if err != nil {
+		return nil, err
+	}
+
+	queryout, err := common.DecodeQuery(ctx, out)
+	if err != nil {
+		p.logger.WithField("data", string(out)).Error("failed to unmarshal query")
+		return nil, err
+	}
+	return queryout, nil
+}
+
+func (p *zmqTransport) RunFetchHook(ctx context.Context, hookName string, records []*skydb.Record) ([]*skydb.Record, error) {
+	out, err := p.rpc(pluginrequest.NewFetchHookRequest(ctx, hookName, records))
+	if err != nil {
+		return nil, err
+	}
+
+	recordsout, err := common.DecodeRecords(out)
+	if err != nil {
+		p.logger.WithField("data", string(out)).Error("failed to unmarshal records")
+		return nil, err
+	}
+	return recordsout, nil
+}
+
 func (p *zmqTransport) RunTimer(name string, in []byte) (out []byte, err error) {
 	return p.rpc(pluginrequest.NewTimerRequest(name))
 }
@@ -0,0 +1,240 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pubsub
+
+import (
+	"context"
+	"strings"
+	"sync"
+)
+
+// Actions of a client on a channel that are subject to authorization.
+const (
+	ActionSubscribe = "sub"
+	ActionPublish   = "pub"
+)
+
+// Prefixes of the channel namespaces.
+const (
+	UserChannelPrefix   = "user:"
+	RoleChannelPrefix   = "role:"
+	PublicChannelPrefix = "public:"
+
+	// DeviceChannelPrefix is the prefix of channels on which notices of
+	// subscriptions are sent to a device.
+	DeviceChannelPrefix = "_sub_"
+)
+
+// Client is the identity of a websocket connection, as authenticated by
+// the access token and the access key of the connecting request.
+type Client struct {
+	UserID    string
+	Roles     []string
+	MasterKey bool
+}
+
+func (c Client) hasRole(role string) bool {
+	for _, r := range c.Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// Authorizer decides whether a client is allowed to perform an action on
+// a channel.
+type Authorizer interface {
+	Authorize(ctx context.Context, client Client, action string, channel string) (bool, error)
+}
+
+// Rule specifies which clients are allowed to perform an action on the
+// channels of a namespace.
+type Rule string
+
+const (
+	// RuleAnyone allows any client.
+	RuleAnyone Rule = "anyone"
+	// RuleAuthenticated allows clients with a user.
+	RuleAuthenticated Rule = "authenticated"
+	// RuleOwner allows the user of a `user:<id>` channel, or users having
+	// the role of a `role:<name>` channel.
+	RuleOwner Rule = "owner"
+	// RuleMaster allows only clients with the master key.
+	RuleMaster Rule = "master"
+)
+
+func (r Rule) allows(client Client, owned bool) bool {
+	switch r {
+	case RuleAnyone:
+		return true
+	case RuleAuthenticated:
+		return client.UserID != ""
+	case RuleOwner:
+		return client.UserID != "" && owned
+	default:
+		return false
+	}
+}
+
+// ChannelRule is the rules for subscribing and publishing to the channels
+// of a namespace.
+type ChannelRule struct {
+	Subscribe Rule
+	Publish   Rule
+}
+
+func (r ChannelRule) allows(client Client, action string, owned bool) bool {
+	switch action {
+	case ActionSubscribe:
+		return r.Subscribe.allows(client, owned)
+	case ActionPublish:
+		return r.Publish.allows(client, owned)
+	default:
+		return false
+	}
+}
+
+// AuthorizeFunc decides whether a client is allowed to perform an action
+// on a channel. allowed is the decision made so far, which the func
+// returns untouched if it has no opinion on the action.
+type AuthorizeFunc func(ctx context.Context, client Client, action string, channel string, allowed bool) (bool, error)
+
+type mountedAuthorizeFuncs struct {
+	key   interface{}
+	funcs []AuthorizeFunc
+}
+
+// AuthorizerRegistry holds AuthorizeFuncs registered by plugins.
+type AuthorizerRegistry struct {
+	mounted []mountedAuthorizeFuncs
+	mutex   sync.RWMutex
+}
+
+// NewAuthorizerRegistry returns an empty AuthorizerRegistry.
+func NewAuthorizerRegistry() *AuthorizerRegistry {
+	return &AuthorizerRegistry{}
+}
+
+// Mount registers the funcs under the key. Mounting funcs with a key that
+// is already mounted replaces the funcs previously mounted in place.
+// Mounting no funcs unmounts the funcs of the key.
+func (r *AuthorizerRegistry) Mount(key interface{}, funcs []AuthorizeFunc) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	for i, mounted := range r.mounted {
+		if mounted.key != key {
+			continue
+		}
+
+		if len(funcs) == 0 {
+			r.mounted = append(r.mounted[:i:i], r.mounted[i+1:]...)
+		} else {
+			r.mounted[i].funcs = funcs
+		}
+		return
+	}
+
+	if len(funcs) > 0 {
+		r.mounted = append(r.mounted, mountedAuthorizeFuncs{key, funcs})
+	}
+}
+
+// Authorize passes the decision through each of the registered funcs in
+// the order they are mounted, and returns the final decision.
+func (r *AuthorizerRegistry) Authorize(ctx context.Context, client Client, action string, channel string, allowed bool) (bool, error) {
+	r.mutex.RLock()
+	funcs := []AuthorizeFunc{}
+	for _, mounted := range r.mounted {
+		funcs = append(funcs, mounted.funcs...)
+	}
+	r.mutex.RUnlock()
+
+	var err error
+	for _, f := range funcs {
+		allowed, err = f(ctx, client, action, channel, allowed)
+		if err != nil {
+			return false, err
+		}
+	}
+	return allowed, nil
+}
+
+// ChannelAuthorizer authorizes actions by the rules of the namespace
+// of the channel, and then by the funcs in Registry.
+//
+// Clients with the master key are always allowed. The subscription notices
+// channel of a device can only be subscribed by the owner of the device,
+// and can only be published with the master key. The presence channel of
+// a channel can be subscribed by clients allowed to subscribe the channel,
+// and can only be published with the master key.
+type ChannelAuthorizer struct {
+	User    ChannelRule
+	Role    ChannelRule
+	Public  ChannelRule
+	Default ChannelRule
+
+	// DeviceOwner returns the user ID of the owner of the device.
+	DeviceOwner func(deviceID string) (string, error)
+
+	Registry *AuthorizerRegistry
+}
+
+// Authorize implements the Authorizer interface.
+func (a *ChannelAuthorizer) Authorize(ctx context.Context, client Client, action string, channel string) (bool, error) {
+	if client.MasterKey {
+		return true, nil
+	}
+
+	allowed, err := a.authorizeByRule(client, action, channel)
+	if err != nil {
+		return false, err
+	}
+
+	if a.Registry == nil {
+		return allowed, nil
+	}
+	return a.Registry.Authorize(ctx, client, action, channel, allowed)
+}
+
+func (a *ChannelAuthorizer) authorizeByRule(client Client, action string, channel string) (bool, error) {
+	switch {
+	case strings.HasPrefix(channel, PresenceChannelPrefix):
+		if action != ActionSubscribe {
+			return false, nil
+		}
+		return a.authorizeByRule(client, action, strings.TrimPrefix(channel, PresenceChannelPrefix))
+	case strings.HasPrefix(channel, UserChannelPrefix):
+		userID := strings.TrimPrefix(channel, UserChannelPrefix)
+		return a.User.allows(client, action, userID == client.UserID), nil
+	case strings.HasPrefix(channel, RoleChannelPrefix):
+		role := strings.TrimPrefix(channel, RoleChannelPrefix)
+		return a.Role.allows(client, action, client.hasRole(role)), nil
+	case strings.HasPrefix(channel, PublicChannelPrefix):
+		return a.Public.allows(client, action, false), nil
+	case strings.HasPrefix(channel, DeviceChannelPrefix):
+		if action != ActionSubscribe || client.UserID == "" || a.DeviceOwner == nil {
+			return false, nil
+		}
+		ownerID, err := a.DeviceOwner(strings.TrimPrefix(channel, DeviceChannelPrefix))
+		if err != nil {
+			return false, err
+		}
+		return ownerID == client.UserID, nil
+	default:
+		return a.Default.allows(client, action, false), nil
+	}
+}
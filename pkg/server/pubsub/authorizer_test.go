@@ -0,0 +1,130 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pubsub
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestChannelAuthorizer(t *testing.T) {
+	Convey("ChannelAuthorizer", t, func() {
+		authorizer := &ChannelAuthorizer{
+			User:    ChannelRule{Subscribe: RuleOwner, Publish: RuleMaster},
+			Role:    ChannelRule{Subscribe: RuleOwner, Publish: RuleAuthenticated},
+			Public:  ChannelRule{Subscribe: RuleAnyone, Publish: RuleAuthenticated},
+			Default: ChannelRule{Subscribe: RuleAnyone, Publish: RuleAnyone},
+			DeviceOwner: func(deviceID string) (string, error) {
+				if deviceID == "device" {
+					return "alice", nil
+				}
+				return "", nil
+			},
+		}
+		anonymous := Client{}
+		alice := Client{UserID: "alice", Roles: []string{"admin"}}
+		bob := Client{UserID: "bob"}
+		master := Client{MasterKey: true}
+
+		authorize := func(client Client, action string, channel string) bool {
+			allowed, err := authorizer.Authorize(context.Background(), client, action, channel)
+			if err != nil {
+				return false
+			}
+			return allowed
+		}
+
+		Convey("authorizes user channels", func() {
+			So(authorize(alice, ActionSubscribe, "user:alice"), ShouldBeTrue)
+			So(authorize(bob, ActionSubscribe, "user:alice"), ShouldBeFalse)
+			So(authorize(anonymous, ActionSubscribe, "user:"), ShouldBeFalse)
+			So(authorize(alice, ActionPublish, "user:alice"), ShouldBeFalse)
+			So(authorize(master, ActionPublish, "user:alice"), ShouldBeTrue)
+		})
+
+		Convey("authorizes role channels", func() {
+			So(authorize(alice, ActionSubscribe, "role:admin"), ShouldBeTrue)
+			So(authorize(bob, ActionSubscribe, "role:admin"), ShouldBeFalse)
+			So(authorize(bob, ActionPublish, "role:admin"), ShouldBeTrue)
+			So(authorize(anonymous, ActionPublish, "role:admin"), ShouldBeFalse)
+		})
+
+		Convey("authorizes public channels", func() {
+			So(authorize(anonymous, ActionSubscribe, "public:chat"), ShouldBeTrue)
+			So(authorize(anonymous, ActionPublish, "public:chat"), ShouldBeFalse)
+			So(authorize(bob, ActionPublish, "public:chat"), ShouldBeTrue)
+		})
+
+		Convey("authorizes other channels by default rule", func() {
+			So(authorize(anonymous, ActionSubscribe, "chat"), ShouldBeTrue)
+			So(authorize(anonymous, ActionPublish, "chat"), ShouldBeTrue)
+		})
+
+		Convey("authorizes device channels by device owner", func() {
+			So(authorize(alice, ActionSubscribe, "_sub_device"), ShouldBeTrue)
+			So(authorize(bob, ActionSubscribe, "_sub_device"), ShouldBeFalse)
+			So(authorize(anonymous, ActionSubscribe, "_sub_device"), ShouldBeFalse)
+			So(authorize(alice, ActionPublish, "_sub_device"), ShouldBeFalse)
+			So(authorize(master, ActionPublish, "_sub_device"), ShouldBeTrue)
+		})
+
+		Convey("authorizes presence channels by the channel", func() {
+			So(authorize(alice, ActionSubscribe, "_presence:user:alice"), ShouldBeTrue)
+			So(authorize(bob, ActionSubscribe, "_presence:user:alice"), ShouldBeFalse)
+			So(authorize(anonymous, ActionSubscribe, "_presence:public:chat"), ShouldBeTrue)
+			So(authorize(bob, ActionPublish, "_presence:public:chat"), ShouldBeFalse)
+		})
+
+		Convey("passes the decision through registered funcs", func() {
+			registry := NewAuthorizerRegistry()
+			authorizer.Registry = registry
+
+			var gotAllowed bool
+			registry.Mount("plugin", []AuthorizeFunc{
+				func(ctx context.Context, client Client, action string, channel string, allowed bool) (bool, error) {
+					gotAllowed = allowed
+					return channel == "user:bob", nil
+				},
+			})
+
+			So(authorize(alice, ActionSubscribe, "user:alice"), ShouldBeFalse)
+			So(gotAllowed, ShouldBeTrue)
+			So(authorize(alice, ActionSubscribe, "user:bob"), ShouldBeTrue)
+			So(gotAllowed, ShouldBeFalse)
+
+			Convey("except for master key", func() {
+				So(authorize(master, ActionSubscribe, "user:alice"), ShouldBeTrue)
+			})
+
+			Convey("denies on error", func() {
+				registry.Mount("plugin", []AuthorizeFunc{
+					func(ctx context.Context, client Client, action string, channel string, allowed bool) (bool, error) {
+						return true, errors.New("plugin unavailable")
+					},
+				})
+				_, err := authorizer.Authorize(context.Background(), alice, ActionSubscribe, "chat")
+				So(err, ShouldNotBeNil)
+			})
+
+			Convey("unmounts funcs", func() {
+				registry.Mount("plugin", nil)
+				So(authorize(alice, ActionSubscribe, "user:alice"), ShouldBeTrue)
+			})
+		})
+	})
+}
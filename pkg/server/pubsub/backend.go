@@ -0,0 +1,58 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pubsub
+
+import (
+	"encoding/json"
+)
+
+// Backend relays messages broadcast on a Hub to the hubs of all
+// skygear-server instances sharing the backend, such that subscribers
+// connected to any instance receive the messages.
+//
+// Messages are opaque to the backend. A Hub without a Backend delivers
+// messages to its own subscribers only.
+type Backend interface {
+	// Publish sends the message to all instances listening on the backend,
+	// including this one.
+	Publish(message []byte) error
+
+	// Listen calls the handler with each message published on the
+	// backend. It blocks until the backend is closed.
+	Listen(handler func(message []byte)) error
+
+	// Close stops listening on the backend and releases its resources.
+	Close() error
+}
+
+// backendMessage is the message of a parcel, or the presence of users
+// on a hub, relayed through a Backend. Data is kept as raw JSON instead
+// of base64, so that messages fit in backends limiting the message size.
+type backendMessage struct {
+	Channel  string           `json:"channel,omitempty"`
+	Data     json.RawMessage  `json:"data,omitempty"`
+	ID       int64            `json:"id,omitempty"`
+	Presence *presenceMessage `json:"presence,omitempty"`
+}
+
+func encodeBackendMessage(m backendMessage) ([]byte, error) {
+	return json.Marshal(m)
+}
+
+func decodeBackendMessage(message []byte) (backendMessage, error) {
+	m := backendMessage{}
+	err := json.Unmarshal(message, &m)
+	return m, err
+}
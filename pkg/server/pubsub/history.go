@@ -0,0 +1,351 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pubsub
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+// Message is a message in the history of a channel.
+type Message struct {
+	ID      int64
+	Channel string
+	Data    []byte
+}
+
+// History retains messages of channels, such that a client can replay
+// messages it missed when it subscribes again.
+//
+// IDs of messages are monotonically increasing.
+type History interface {
+	// Append retains the message of the channel and returns its ID.
+	Append(channel string, data []byte) (int64, error)
+
+	// Since returns the retained messages of the channel with ID after the
+	// specified ID, in the order of their IDs.
+	Since(channel string, id int64) ([]Message, error)
+}
+
+// SetHistory makes the Hub retain messages of channels having one of the
+// prefixes in the history. Messages of all channels are retained if no
+// prefixes are specified. Messages of presence channels are never retained.
+//
+// SetHistory must be called before the Hub is run.
+func (h *Hub) SetHistory(history History, prefixes []string) {
+	h.history = history
+	h.historyPrefixes = prefixes
+}
+
+func (h *Hub) retains(channel string) bool {
+	if h.history == nil || strings.HasPrefix(channel, PresenceChannelPrefix) {
+		return false
+	}
+	if len(h.historyPrefixes) == 0 {
+		return true
+	}
+	for _, prefix := range h.historyPrefixes {
+		if strings.HasPrefix(channel, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// historyQueueSize is the number of broadcast messages queued to be
+// appended to the history.
+const historyQueueSize = 1000
+
+// replay is the state of a connection replaying messages of a channel.
+//
+// Messages published while the history is loading or the connection is
+// replaying are deferred until the replay finishes, such that messages
+// are received in order. Messages with ID not after the last message
+// received are dropped, as they have been replayed. The state is removed
+// when the replay finishes.
+type replay struct {
+	loading   bool
+	replaying bool
+	lastID    int64
+	pending   []Parcel
+}
+
+// historyLoaded is the messages loaded from the history for a replay.
+type historyLoaded struct {
+	channel    string
+	connection *connection
+	replay     *replay
+	messages   []Message
+}
+
+// subscribeSince subscribes the connection to the channel, and sends the
+// messages of the channel after the message of the ID to the connection
+// before any new messages. The messages are loaded from the history
+// outside the run loop.
+func (h *Hub) subscribeSince(channel string, c *connection, since int64) {
+	h.subscribe(channel, c)
+
+	r := &replay{
+		loading:   true,
+		replaying: true,
+		lastID:    since,
+	}
+	if h.replays[c] == nil {
+		h.replays[c] = map[string]*replay{}
+	}
+	h.replays[c][channel] = r
+
+	go func() {
+		messages, err := h.history.Since(channel, since)
+		if err != nil {
+			log.Errorf("Can't replay history of %v: %v", channel, err)
+		}
+
+		select {
+		case h.historyLoaded <- historyLoaded{channel, c, r, messages}:
+		case <-h.stopped:
+		}
+	}()
+}
+
+// startReplay sends the messages loaded from the history to the
+// connection, followed by the messages deferred while loading.
+func (h *Hub) startReplay(loaded historyLoaded) {
+	c := loaded.connection
+	r := h.replays[c][loaded.channel]
+	if r == nil || r != loaded.replay {
+		// unsubscribed while loading
+		return
+	}
+
+	parcels := make([]Parcel, len(loaded.messages))
+	for i, m := range loaded.messages {
+		parcels[i] = Parcel{
+			Channel: m.Channel,
+			Data:    m.Data,
+			ID:      m.ID,
+		}
+		r.lastID = m.ID
+	}
+
+	deferred := r.pending
+	r.pending = nil
+	r.loading = false
+	for _, parcel := range deferred {
+		h.deferToReplay(c, parcel)
+	}
+	go h.sendReplay(loaded.channel, c, parcels)
+}
+
+// appendHistory appends the queued parcels to the history, and passes
+// them with the IDs in the history to the run loop for delivery.
+func (h *Hub) appendHistory() {
+	for {
+		select {
+		case p := <-h.appendQueue:
+			id, err := h.history.Append(p.Channel, p.Data)
+			if err != nil {
+				log.Errorf("Can't append %v:%s to history: %v", p.Channel, p.Data, err)
+			}
+			p.ID = id
+
+			select {
+			case h.appended <- p:
+			case <-h.stopped:
+				return
+			}
+		case <-h.stopped:
+			return
+		}
+	}
+}
+
+// sendReplay sends the parcels to the connection in order, and notifies
+// the run loop afterwards.
+func (h *Hub) sendReplay(channel string, c *connection, parcels []Parcel) {
+	for _, parcel := range parcels {
+		select {
+		case c.Send <- parcel:
+		case <-h.timeOut():
+			log.Warnf("Can't replay, %p, %v:%s", c, parcel.Channel, parcel.Data)
+		case <-h.stopped:
+			return
+		}
+	}
+
+	select {
+	case h.replayDone <- Parcel{Channel: channel, Connection: c}:
+	case <-h.stopped:
+	}
+}
+
+// finishReplay sends messages deferred during the replay, or ends the
+// replay if there are none.
+func (h *Hub) finishReplay(channel string, c *connection) {
+	r := h.replays[c][channel]
+	if r == nil {
+		return
+	}
+
+	if len(r.pending) == 0 {
+		h.removeReplay(channel, c)
+		return
+	}
+
+	parcels := r.pending
+	r.pending = nil
+	go h.sendReplay(channel, c, parcels)
+}
+
+// deferToReplay returns true if the parcel is not to be sent to the
+// connection right away, because the connection is loading or replaying
+// the channel, or has received the parcel in the replay.
+func (h *Hub) deferToReplay(c *connection, parcel Parcel) bool {
+	r := h.replays[c][parcel.Channel]
+	if r == nil {
+		return false
+	}
+
+	if r.loading {
+		r.pending = append(r.pending, parcel)
+		return true
+	}
+
+	if parcel.ID != 0 {
+		if parcel.ID <= r.lastID {
+			return true
+		}
+		r.lastID = parcel.ID
+	}
+
+	if r.replaying {
+		r.pending = append(r.pending, parcel)
+		return true
+	}
+	return false
+}
+
+func (h *Hub) removeReplay(channel string, c *connection) {
+	delete(h.replays[c], channel)
+	if len(h.replays[c]) == 0 {
+		delete(h.replays, c)
+	}
+}
+
+type memoryMessage struct {
+	Message
+	createdAt time.Time
+}
+
+// MemoryHistory is a History retaining messages in memory. It retains up
+// to the specified number of messages for each channel, and drops messages
+// older than the TTL. Channels without messages within the TTL are
+// removed, at most once a minute.
+//
+// MemoryHistory is only suitable for a single skygear-server, as messages
+// published on other skygear-servers are not retained.
+type MemoryHistory struct {
+	size       int
+	ttl        time.Duration
+	lastID     int64
+	channels   map[string][]memoryMessage
+	timeNow    func() time.Time
+	mutex      sync.Mutex
+	lastPruned time.Time
+}
+
+// NewMemoryHistory returns a MemoryHistory retaining up to size messages
+// for each channel for the duration of ttl, which must be positive.
+func NewMemoryHistory(size int, ttl time.Duration) *MemoryHistory {
+	return &MemoryHistory{
+		size:     size,
+		ttl:      ttl,
+		channels: map[string][]memoryMessage{},
+		timeNow:  time.Now,
+	}
+}
+
+// Append implements the History interface. IDs are derived from the
+// current time, such that they keep increasing after a restart.
+func (h *MemoryHistory) Append(channel string, data []byte) (int64, error) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	now := h.timeNow()
+	h.prune(now)
+
+	id := now.UnixNano() / int64(time.Microsecond)
+	if id <= h.lastID {
+		id = h.lastID + 1
+	}
+	h.lastID = id
+
+	messages := append(h.channels[channel], memoryMessage{
+		Message: Message{
+			ID:      id,
+			Channel: channel,
+			Data:    data,
+		},
+		createdAt: now,
+	})
+	if len(messages) > h.size {
+		messages = append([]memoryMessage{}, messages[len(messages)-h.size:]...)
+	}
+	h.channels[channel] = messages
+	return id, nil
+}
+
+// Since implements the History interface.
+func (h *MemoryHistory) Since(channel string, id int64) ([]Message, error) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	now := h.timeNow()
+	messages := []Message{}
+	for _, m := range h.channels[channel] {
+		if m.ID <= id || h.isExpired(m, now) {
+			continue
+		}
+		messages = append(messages, m.Message)
+	}
+	return messages, nil
+}
+
+func (h *MemoryHistory) isExpired(m memoryMessage, now time.Time) bool {
+	return m.createdAt.Add(h.ttl).Before(now)
+}
+
+// prune removes messages older than the TTL, and channels without
+// messages, at most once a minute. It must be called with the mutex held.
+func (h *MemoryHistory) prune(now time.Time) {
+	if now.Sub(h.lastPruned) < time.Minute {
+		return
+	}
+	h.lastPruned = now
+
+	for channel, messages := range h.channels {
+		// messages are in the order of creation
+		i := 0
+		for i < len(messages) && h.isExpired(messages[i], now) {
+			i++
+		}
+		if i == len(messages) {
+			delete(h.channels, channel)
+		} else if i > 0 {
+			h.channels[channel] = append([]memoryMessage{}, messages[i:]...)
+		}
+	}
+}
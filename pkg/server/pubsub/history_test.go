@@ -0,0 +1,209 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pubsub
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestMemoryHistory(t *testing.T) {
+	Convey("MemoryHistory", t, func() {
+		now := time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC)
+		history := NewMemoryHistory(2, time.Minute)
+		history.timeNow = func() time.Time { return now }
+
+		Convey("appends messages with increasing IDs", func() {
+			id1, err := history.Append("chat", []byte("1"))
+			So(err, ShouldBeNil)
+			id2, _ := history.Append("chat", []byte("2"))
+			So(id1, ShouldEqual, now.UnixNano()/int64(time.Microsecond))
+			So(id2, ShouldEqual, id1+1)
+
+			messages, err := history.Since("chat", id1)
+			So(err, ShouldBeNil)
+			So(messages, ShouldResemble, []Message{
+				{ID: id2, Channel: "chat", Data: []byte("2")},
+			})
+		})
+
+		Convey("retains up to size messages of each channel", func() {
+			history.Append("chat", []byte("1"))
+			history.Append("chat", []byte("2"))
+			history.Append("chat", []byte("3"))
+			history.Append("other", []byte("other"))
+
+			messages, _ := history.Since("chat", 0)
+			So(len(messages), ShouldEqual, 2)
+			So(messages[0].Data, ShouldResemble, []byte("2"))
+			So(messages[1].Data, ShouldResemble, []byte("3"))
+		})
+
+		Convey("drops messages older than ttl", func() {
+			history.Append("chat", []byte("1"))
+			now = now.Add(2 * time.Minute)
+			history.Append("chat", []byte("2"))
+
+			messages, _ := history.Since("chat", 0)
+			So(len(messages), ShouldEqual, 1)
+			So(messages[0].Data, ShouldResemble, []byte("2"))
+		})
+
+		Convey("removes expired messages and channels", func() {
+			history.Append("chat", []byte("1"))
+			history.Append("other", []byte("other"))
+			now = now.Add(30 * time.Second)
+			history.Append("chat", []byte("2"))
+
+			now = now.Add(45 * time.Second)
+			history.Append("new", []byte("new"))
+			So(history.channels, ShouldNotContainKey, "other")
+			So(history.channels["chat"], ShouldHaveLength, 1)
+			So(history.channels["chat"][0].Data, ShouldResemble, []byte("2"))
+			So(history.channels, ShouldContainKey, "new")
+		})
+	})
+}
+
+func TestHubHistory(t *testing.T) {
+	Convey("Hub with history", t, func() {
+		history := NewMemoryHistory(10, time.Hour)
+		hub := NewHub()
+		hub.SetHistory(history, []string{"public:"})
+		go hub.run()
+		defer func() {
+			hub.stop <- 1
+		}()
+
+		Convey("retains channels with prefixes", func() {
+			So(hub.retains("public:chat"), ShouldBeTrue)
+			So(hub.retains("chat"), ShouldBeFalse)
+			So(hub.retains("_presence:public:chat"), ShouldBeFalse)
+		})
+
+		hub.Broadcast <- Parcel{Channel: "public:chat", Data: []byte("1")}
+		hub.Broadcast <- Parcel{Channel: "public:chat", Data: []byte("2")}
+		// wait for the hub to append the broadcasts to the history
+		var messages []Message
+		for i := 0; i < 100 && len(messages) < 2; i++ {
+			time.Sleep(time.Millisecond)
+			messages, _ = history.Since("public:chat", 0)
+		}
+		So(len(messages), ShouldEqual, 2)
+
+		conn := &connection{
+			Send: make(chan Parcel),
+		}
+
+		Convey("replays messages since ID before new messages", func() {
+			since := messages[0].ID
+			hub.Subscribe <- Parcel{Channel: "public:chat", Since: &since, Connection: conn}
+			hub.Broadcast <- Parcel{Channel: "public:chat", Data: []byte("3")}
+
+			p, ok := receiveParcel(conn)
+			So(ok, ShouldBeTrue)
+			So(p.Data, ShouldResemble, []byte("2"))
+			So(p.ID, ShouldEqual, messages[1].ID)
+
+			p, ok = receiveParcel(conn)
+			So(ok, ShouldBeTrue)
+			So(p.Data, ShouldResemble, []byte("3"))
+			So(p.ID, ShouldBeGreaterThan, messages[1].ID)
+		})
+
+		Convey("does not replay without since", func() {
+			hub.Subscribe <- Parcel{Channel: "public:chat", Connection: conn}
+			hub.Broadcast <- Parcel{Channel: "public:chat", Data: []byte("3")}
+
+			p, ok := receiveParcel(conn)
+			So(ok, ShouldBeTrue)
+			So(p.Data, ShouldResemble, []byte("3"))
+		})
+
+		Convey("drops messages already replayed", func() {
+			since := int64(0)
+			hub.Subscribe <- Parcel{Channel: "public:chat", Since: &since, Connection: conn}
+			hub.received <- Parcel{Channel: "public:chat", Data: []byte("2"), ID: messages[1].ID}
+
+			p, _ := receiveParcel(conn)
+			So(p.Data, ShouldResemble, []byte("1"))
+			p, _ = receiveParcel(conn)
+			So(p.Data, ShouldResemble, []byte("2"))
+			_, ok := receiveParcel(conn)
+			So(ok, ShouldBeFalse)
+		})
+
+		Convey("delivers messages out of order after replay", func() {
+			since := messages[0].ID
+			hub.Subscribe <- Parcel{Channel: "public:chat", Since: &since, Connection: conn}
+			p, _ := receiveParcel(conn)
+			So(p.Data, ShouldResemble, []byte("2"))
+
+			// the replay finishes after the run loop handles it
+			late := Parcel{Channel: "public:chat", Data: []byte("1"), ID: messages[0].ID}
+			delivered := false
+			for i := 0; i < 10 && !delivered; i++ {
+				hub.received <- late
+				p, delivered = receiveParcel(conn)
+			}
+			So(delivered, ShouldBeTrue)
+			So(p.Data, ShouldResemble, []byte("1"))
+		})
+	})
+}
+
+// stalledHistory blocks until released, like a slow database.
+type stalledHistory struct {
+	released chan struct{}
+}
+
+func (h *stalledHistory) Append(channel string, data []byte) (int64, error) {
+	<-h.released
+	return 1, nil
+}
+
+func (h *stalledHistory) Since(channel string, id int64) ([]Message, error) {
+	<-h.released
+	return nil, nil
+}
+
+func TestHubWithStalledHistory(t *testing.T) {
+	Convey("Hub with stalled history", t, func() {
+		history := &stalledHistory{released: make(chan struct{})}
+		hub := NewHub()
+		hub.SetHistory(history, nil)
+		go hub.run()
+		defer func() {
+			close(history.released)
+			hub.stop <- 1
+		}()
+
+		Convey("delivers other channels while loading history", func() {
+			since := int64(0)
+			hub.Subscribe <- Parcel{Channel: "chat", Since: &since, Connection: &connection{Send: make(chan Parcel)}}
+			hub.Broadcast <- Parcel{Channel: "chat", Data: []byte(`"Hello"`)}
+
+			conn := &connection{Send: make(chan Parcel)}
+			hub.Subscribe <- Parcel{Channel: "_presence:chat", Connection: conn}
+			hub.Broadcast <- Parcel{Channel: "_presence:chat", Data: []byte(`"Hello"`)}
+
+			p, ok := receiveParcel(conn)
+			So(ok, ShouldBeTrue)
+			So(p.Data, ShouldResemble, []byte(`"Hello"`))
+		})
+	})
+}
@@ -16,59 +16,240 @@ package pubsub
 
 import (
 	"time"
+
+	"github.com/skygeario/skygear-server/pkg/server/uuid"
 )
 
 // Parcel is the protocol that Hub talk with
+//
+// ID is the ID of the message in the history of the channel, or 0 if the
+// channel has no history. Since is set on a Subscribe parcel to replay
+// messages in the history after the message of the ID.
 type Parcel struct {
 	Channel    string
 	Data       []byte
+	ID         int64
+	Since      *int64
 	Connection *connection
 }
 
+// relayQueueSize is the number of messages queued to be published through
+// the backend.
+const relayQueueSize = 1000
+
 // Hub is the struct that hold the subscription and do the broadcast logic
+//
+// If the Hub has a Backend, broadcast messages are relayed through the
+// backend, and messages received from the backend are delivered to the
+// subscribers of the Hub. Hubs sharing a backend also share the presence
+// of users on channels.
 type Hub struct {
-	Subscribe    chan Parcel
-	Unsubscribe  chan Parcel
-	Broadcast    chan Parcel
-	stop         chan int
-	subscription map[string][]*connection
-	channels     map[string]chan []byte
-	timeout      time.Duration
+	Subscribe        chan Parcel
+	Unsubscribe      chan Parcel
+	Broadcast        chan Parcel
+	stop             chan int
+	stopped          chan struct{}
+	received         chan Parcel
+	receivedPresence chan presenceMessage
+	presenceQuery    chan presenceQuery
+	backend          Backend
+	relayQueue       chan []byte
+	instanceID       string
+	presence         *presence
+	presenceInterval time.Duration
+	history          History
+	historyPrefixes  []string
+	replays          map[*connection]map[string]*replay
+	replayDone       chan Parcel
+	historyLoaded    chan historyLoaded
+	appendQueue      chan Parcel
+	appended         chan Parcel
+	subscription     map[string][]*connection
+	channels         map[string]chan []byte
+	timeout          time.Duration
 }
 
 // NewHub is factory for Hub
 func NewHub() *Hub {
+	return NewHubWithBackend(nil)
+}
+
+// NewHubWithBackend returns a Hub relaying broadcast messages through the
+// backend. If backend is nil, the Hub delivers messages in memory.
+func NewHubWithBackend(backend Backend) *Hub {
 	return &Hub{
-		Subscribe:    make(chan Parcel),
-		Unsubscribe:  make(chan Parcel),
-		Broadcast:    make(chan Parcel),
-		stop:         make(chan int),
-		subscription: map[string][]*connection{},
-		channels:     map[string]chan []byte{},
-		timeout:      1,
+		Subscribe:        make(chan Parcel),
+		Unsubscribe:      make(chan Parcel),
+		Broadcast:        make(chan Parcel),
+		stop:             make(chan int),
+		stopped:          make(chan struct{}),
+		received:         make(chan Parcel),
+		receivedPresence: make(chan presenceMessage),
+		presenceQuery:    make(chan presenceQuery),
+		backend:          backend,
+		relayQueue:       make(chan []byte, relayQueueSize),
+		instanceID:       uuid.New(),
+		presence:         newPresence(),
+		presenceInterval: 30 * time.Second,
+		replays:          map[*connection]map[string]*replay{},
+		replayDone:       make(chan Parcel),
+		historyLoaded:    make(chan historyLoaded),
+		appendQueue:      make(chan Parcel, historyQueueSize),
+		appended:         make(chan Parcel),
+		subscription:     map[string][]*connection{},
+		channels:         map[string]chan []byte{},
+		timeout:          1,
 	}
 }
 
 func (h *Hub) run() {
 	log.Debugf("Hub running %p", h)
 	defer func() {
+		close(h.stopped)
+		if h.backend != nil {
+			h.backend.Close()
+		}
 		log.Info("Hub stopped %p!", h)
 	}()
+
+	var presenceTick <-chan time.Time
+	if h.backend != nil {
+		go h.listen()
+		go h.publishRelayed()
+		ticker := time.NewTicker(h.presenceInterval)
+		defer ticker.Stop()
+		presenceTick = ticker.C
+	}
+	if h.history != nil {
+		go h.appendHistory()
+	}
 	for {
 		select {
 		case p := <-h.Subscribe:
-			h.subscribe(p.Channel, p.Connection)
+			if p.Since != nil && h.retains(p.Channel) {
+				h.subscribeSince(p.Channel, p.Connection, *p.Since)
+			} else {
+				h.subscribe(p.Channel, p.Connection)
+			}
+		case loaded := <-h.historyLoaded:
+			h.startReplay(loaded)
+		case p := <-h.replayDone:
+			h.finishReplay(p.Channel, p.Connection)
 		case p := <-h.Unsubscribe:
 			h.unsubscribe(p.Channel, p.Connection)
 		case p := <-h.Broadcast:
 			log.Warnf("Broadcast %v:%s", p.Channel, p.Data)
-			h.publish(p.Channel, p.Data)
+			h.broadcast(p)
+		case p := <-h.appended:
+			h.deliver(p)
+		case p := <-h.received:
+			h.publish(p)
+		case m := <-h.receivedPresence:
+			if m.InstanceID != h.instanceID {
+				h.presence.update(m, time.Now())
+			}
+		case q := <-h.presenceQuery:
+			q.reply <- h.presence.members(q.channel, time.Now(), h.presenceTTL())
+		case <-presenceTick:
+			h.presence.expire(time.Now(), h.presenceTTL())
+			for _, channel := range h.presence.localChannels() {
+				h.relayPresence(channel)
+			}
 		case <-h.stop:
 			return
 		}
 	}
 }
 
+// listen passes messages received from the backend to the run loop.
+func (h *Hub) listen() {
+	err := h.backend.Listen(func(message []byte) {
+		m, err := decodeBackendMessage(message)
+		if err != nil {
+			log.Warnf("Can't decode message from backend: %v", err)
+			return
+		}
+
+		if m.Presence != nil {
+			select {
+			case h.receivedPresence <- *m.Presence:
+			case <-h.stopped:
+			}
+			return
+		}
+
+		select {
+		case h.received <- Parcel{Channel: m.Channel, Data: []byte(m.Data), ID: m.ID}:
+		case <-h.stopped:
+		}
+	})
+	if err != nil {
+		log.Errorf("Hub stopped listening on backend %p: %v", h, err)
+	}
+}
+
+// broadcast delivers the parcel to subscribers of all hubs sharing the
+// backend. If the channel is retained, the parcel is appended to the
+// history outside the run loop before delivery.
+func (h *Hub) broadcast(p Parcel) {
+	if h.retains(p.Channel) {
+		select {
+		case h.appendQueue <- p:
+			return
+		default:
+			log.Errorf("Can't append %v:%s to history: history queue is full", p.Channel, p.Data)
+		}
+	}
+
+	h.deliver(p)
+}
+
+// deliver delivers the parcel to subscribers of all hubs sharing the
+// backend.
+func (h *Hub) deliver(p Parcel) {
+	if h.backend == nil {
+		h.publish(p)
+	} else {
+		h.relay(backendMessage{
+			Channel: p.Channel,
+			Data:    p.Data,
+			ID:      p.ID,
+		})
+	}
+}
+
+// relay queues the message to be published through the backend, so that
+// a slow backend does not block the run loop. The message is dropped if
+// the queue is full.
+func (h *Hub) relay(m backendMessage) {
+	message, err := encodeBackendMessage(m)
+	if err != nil {
+		log.Errorf("Can't relay %v:%s through backend: %v", m.Channel, m.Data, err)
+		return
+	}
+
+	select {
+	case h.relayQueue <- message:
+	default:
+		log.Errorf("Can't relay %v:%s through backend: relay queue is full", m.Channel, m.Data)
+	}
+}
+
+// publishRelayed publishes the queued messages through the backend in
+// order, until the hub is stopped.
+func (h *Hub) publishRelayed() {
+	for {
+		select {
+		case message := <-h.relayQueue:
+			if err := h.backend.Publish(message); err != nil {
+				log.Errorf("Can't publish %s through backend: %v", message, err)
+			}
+		case <-h.stopped:
+			return
+		}
+	}
+}
+
 func (h *Hub) timeOut() <-chan time.Time {
 	return time.After(h.timeout * time.Second)
 }
@@ -81,33 +262,46 @@ func (h *Hub) subscribe(channel string, c *connection) {
 	}
 	log.Debugf("subscribe %v, %p", channel, c)
 	h.subscription[channel] = append(h.subscription[channel], c)
+	h.join(channel, c)
 }
 
 func (h *Hub) unsubscribe(channel string, c *connection) {
 	log.Debugf("unsubscribe %v, %p", channel, c)
+	subscribed := false
 	newSubscription := []*connection{}
 	for _, conn := range h.subscription[channel] {
 		if conn != c {
 			newSubscription = append(newSubscription, conn)
+		} else {
+			subscribed = true
 		}
 	}
 	h.subscription[channel] = newSubscription
+	h.removeReplay(channel, c)
+	if subscribed {
+		h.leave(channel, c)
+	}
 }
 
-func (h *Hub) publish(channel string, data []byte) {
-	log.Debugf("publish %v, %s", channel, data)
+func (h *Hub) publish(p Parcel) {
+	log.Debugf("publish %v, %s", p.Channel, p.Data)
 	parcel := Parcel{
-		Channel: channel,
-		Data:    data,
+		Channel: p.Channel,
+		Data:    p.Data,
+		ID:      p.ID,
 	}
-	for _, c := range h.subscription[channel] {
+	for _, c := range h.subscription[p.Channel] {
+		if h.deferToReplay(c, parcel) {
+			continue
+		}
+
 		c := c
 		go func() {
 			select {
 			case c.Send <- parcel:
 				log.Debugf("Published to %p", c)
 			case <-h.timeOut():
-				log.Warnf("Can't publish, %p, %v:%s", c, channel, data)
+				log.Warnf("Can't publish, %p, %v:%s", c, parcel.Channel, parcel.Data)
 			}
 		}()
 	}
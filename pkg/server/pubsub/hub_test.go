@@ -176,3 +176,139 @@ func TestNormalSubscription(t *testing.T) {
 		})
 	})
 }
+
+type loopbackBackend struct {
+	published chan []byte
+	closed    chan struct{}
+}
+
+func (b *loopbackBackend) Publish(message []byte) error {
+	b.published <- message
+	return nil
+}
+
+func (b *loopbackBackend) Listen(handler func(message []byte)) error {
+	for {
+		select {
+		case message := <-b.published:
+			handler(message)
+		case <-b.closed:
+			return nil
+		}
+	}
+}
+
+func (b *loopbackBackend) Close() error {
+	close(b.closed)
+	return nil
+}
+
+func TestHubWithBackend(t *testing.T) {
+	Convey("Hub with backend", t, func() {
+		backend := &loopbackBackend{
+			published: make(chan []byte, 1),
+			closed:    make(chan struct{}),
+		}
+		hub := NewHubWithBackend(backend)
+		go hub.run()
+		conn := connection{
+			Send: make(chan Parcel),
+		}
+		hub.Subscribe <- Parcel{
+			Channel:    "correct",
+			Connection: &conn,
+		}
+
+		Convey("delivers messages received from backend", func() {
+			backend.published <- []byte(`{"channel":"correct","data":"Hello"}`)
+
+			var recv Parcel
+			select {
+			case recv = <-conn.Send:
+			case <-time.After(100 * time.Millisecond):
+				t.Fatal("did not receive message from backend")
+			}
+			So(recv.Channel, ShouldEqual, "correct")
+			So(recv.Data, ShouldResemble, []byte(`"Hello"`))
+		})
+
+		Convey("relays broadcast through backend", func() {
+			hub.Broadcast <- Parcel{
+				Channel: "correct",
+				Data:    []byte(`{"text":"Hello"}`),
+			}
+
+			var recv Parcel
+			select {
+			case recv = <-conn.Send:
+			case <-time.After(100 * time.Millisecond):
+				t.Fatal("did not receive message relayed by backend")
+			}
+			So(recv.Data, ShouldResemble, []byte(`{"text":"Hello"}`))
+		})
+
+		hub.stop <- 1
+		select {
+		case <-backend.closed:
+		case <-time.After(100 * time.Millisecond):
+			t.Fatal("backend is not closed after hub stopped")
+		}
+	})
+}
+
+// stalledBackend blocks publishing until closed, like a backend that is
+// down.
+type stalledBackend struct {
+	closed chan struct{}
+}
+
+func (b *stalledBackend) Publish(message []byte) error {
+	<-b.closed
+	return nil
+}
+
+func (b *stalledBackend) Listen(handler func(message []byte)) error {
+	<-b.closed
+	return nil
+}
+
+func (b *stalledBackend) Close() error {
+	close(b.closed)
+	return nil
+}
+
+func TestHubWithStalledBackend(t *testing.T) {
+	Convey("Hub with stalled backend", t, func() {
+		hub := NewHubWithBackend(&stalledBackend{
+			closed: make(chan struct{}),
+		})
+		go hub.run()
+		defer func() {
+			hub.stop <- 1
+		}()
+
+		Convey("handles subscriptions while relaying", func() {
+			for i := 0; i < 3; i++ {
+				hub.Broadcast <- Parcel{
+					Channel: "chat",
+					Data:    []byte(`"Hello"`),
+				}
+			}
+
+			subscribed := make(chan struct{})
+			go func() {
+				hub.Subscribe <- Parcel{
+					Channel:    "chat",
+					Connection: &connection{Send: make(chan Parcel)},
+				}
+				close(subscribed)
+			}()
+
+			select {
+			case <-subscribed:
+			case <-time.After(100 * time.Millisecond):
+				t.Fatal("hub is blocked by backend")
+			}
+		})
+	})
+}
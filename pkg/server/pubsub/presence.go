@@ -0,0 +1,351 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pubsub
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+	"time"
+)
+
+// PresenceChannelPrefix is the prefix of the companion channel of a
+// channel, on which presence events of the channel are sent.
+//
+// A presence event is sent when a user joins a channel by subscribing it
+// with the first connection, or leaves a channel by unsubscribing it with
+// the last connection:
+//
+//  {"event": "join", "channel": "public:chat", "user_id": "alice"}
+//  {"event": "leave", "channel": "public:chat", "user_id": "alice"}
+const PresenceChannelPrefix = "_presence:"
+
+// Presence events sent on the presence channel.
+const (
+	PresenceJoin  = "join"
+	PresenceLeave = "leave"
+)
+
+type presenceEvent struct {
+	Event   string `json:"event"`
+	Channel string `json:"channel"`
+	UserID  string `json:"user_id"`
+}
+
+// presenceChunkSize is the approximate size in bytes of the user IDs in
+// a presence message, such that a message fits in the payload limit of
+// the backend, like the 8000 bytes of the pq backend.
+const presenceChunkSize = 4000
+
+// presenceMessage is the users on a channel of a hub, relayed to other
+// hubs sharing the backend. An empty list of users means the hub has no
+// users on the channel.
+//
+// The users are split into Chunks messages if there are many of them,
+// each of which is refreshed and expired on its own.
+type presenceMessage struct {
+	InstanceID string   `json:"instance_id"`
+	Channel    string   `json:"channel"`
+	UserIDs    []string `json:"user_ids"`
+	Chunk      int      `json:"chunk,omitempty"`
+	Chunks     int      `json:"chunks,omitempty"`
+}
+
+type presenceQuery struct {
+	channel string
+	reply   chan []string
+}
+
+type remotePresence struct {
+	userIDs []string
+	seenAt  time.Time
+}
+
+func (r remotePresence) isExpired(now time.Time, ttl time.Duration) bool {
+	return r.seenAt.Add(ttl).Before(now)
+}
+
+// presence tracks users on channels of a hub, and those of other hubs
+// sharing the backend, by chunk of the presence messages. Presence of
+// other hubs expires if it is not refreshed within the TTL, such that
+// users of a hub that is gone are eventually removed.
+type presence struct {
+	local  map[string]map[string]int
+	remote map[string]map[string][]remotePresence
+}
+
+func newPresence() *presence {
+	return &presence{
+		local:  map[string]map[string]int{},
+		remote: map[string]map[string][]remotePresence{},
+	}
+}
+
+// join adds a connection of the user to the channel. It returns whether
+// the user is not on the channel before.
+func (p *presence) join(channel string, userID string, now time.Time, ttl time.Duration) bool {
+	joined := !p.isMember(channel, userID, now, ttl)
+	if p.local[channel] == nil {
+		p.local[channel] = map[string]int{}
+	}
+	p.local[channel][userID]++
+	return joined
+}
+
+// leave removes a connection of the user from the channel. It returns
+// whether the user is no longer on the channel.
+func (p *presence) leave(channel string, userID string, now time.Time, ttl time.Duration) bool {
+	users := p.local[channel]
+	if users[userID] == 0 {
+		return false
+	}
+
+	users[userID]--
+	if users[userID] == 0 {
+		delete(users, userID)
+	}
+	if len(users) == 0 {
+		delete(p.local, channel)
+	}
+	return !p.isMember(channel, userID, now, ttl)
+}
+
+func (p *presence) isMember(channel string, userID string, now time.Time, ttl time.Duration) bool {
+	for _, member := range p.members(channel, now, ttl) {
+		if member == userID {
+			return true
+		}
+	}
+	return false
+}
+
+// members returns the sorted IDs of users on the channel of all hubs.
+func (p *presence) members(channel string, now time.Time, ttl time.Duration) []string {
+	memberSet := map[string]bool{}
+	for userID := range p.local[channel] {
+		memberSet[userID] = true
+	}
+	for _, channels := range p.remote {
+		for _, remote := range channels[channel] {
+			if remote.isExpired(now, ttl) {
+				continue
+			}
+			for _, userID := range remote.userIDs {
+				memberSet[userID] = true
+			}
+		}
+	}
+
+	members := make([]string, 0, len(memberSet))
+	for userID := range memberSet {
+		members = append(members, userID)
+	}
+	sort.Strings(members)
+	return members
+}
+
+func (p *presence) localMembers(channel string) []string {
+	members := make([]string, 0, len(p.local[channel]))
+	for userID := range p.local[channel] {
+		members = append(members, userID)
+	}
+	sort.Strings(members)
+	return members
+}
+
+func (p *presence) localChannels() []string {
+	channels := make([]string, 0, len(p.local))
+	for channel := range p.local {
+		channels = append(channels, channel)
+	}
+	return channels
+}
+
+// update replaces the users in a chunk on a channel of another hub. The
+// chunks beyond the number of chunks in the message are removed.
+func (p *presence) update(m presenceMessage, now time.Time) {
+	if len(m.UserIDs) == 0 {
+		delete(p.remote[m.InstanceID], m.Channel)
+		if len(p.remote[m.InstanceID]) == 0 {
+			delete(p.remote, m.InstanceID)
+		}
+		return
+	}
+
+	chunks := m.Chunks
+	if chunks == 0 {
+		chunks = 1
+	}
+	if m.Chunk < 0 || m.Chunk >= chunks {
+		log.Warnf("Ignored presence chunk %d of %d on channel %s", m.Chunk, chunks, m.Channel)
+		return
+	}
+
+	if p.remote[m.InstanceID] == nil {
+		p.remote[m.InstanceID] = map[string][]remotePresence{}
+	}
+	remotes := p.remote[m.InstanceID][m.Channel]
+	if len(remotes) != chunks {
+		resized := make([]remotePresence, chunks)
+		copy(resized, remotes)
+		remotes = resized
+	}
+	remotes[m.Chunk] = remotePresence{
+		userIDs: m.UserIDs,
+		seenAt:  now,
+	}
+	p.remote[m.InstanceID][m.Channel] = remotes
+}
+
+// expire removes presence of other hubs not refreshed within the TTL.
+func (p *presence) expire(now time.Time, ttl time.Duration) {
+	for instanceID, channels := range p.remote {
+		for channel, remotes := range channels {
+			expired := true
+			for _, remote := range remotes {
+				if !remote.isExpired(now, ttl) {
+					expired = false
+					break
+				}
+			}
+			if expired {
+				delete(channels, channel)
+			}
+		}
+		if len(channels) == 0 {
+			delete(p.remote, instanceID)
+		}
+	}
+}
+
+// isPresenceTracked returns whether users on the channel are tracked.
+// Internal channels, like presence channels and the channels of devices,
+// are not tracked.
+func isPresenceTracked(channel string) bool {
+	return !strings.HasPrefix(channel, PresenceChannelPrefix) &&
+		!strings.HasPrefix(channel, DeviceChannelPrefix)
+}
+
+// chunkPresence splits the user IDs into chunks of approximately at most
+// size bytes when encoded. A user ID larger than size is a chunk itself.
+func chunkPresence(userIDs []string, size int) [][]string {
+	chunks := [][]string{}
+	chunk := []string{}
+	chunkSize := 0
+	for _, userID := range userIDs {
+		// the quotes and the comma around the user ID
+		userIDSize := len(userID) + 3
+		if len(chunk) > 0 && chunkSize+userIDSize > size {
+			chunks = append(chunks, chunk)
+			chunk = []string{}
+			chunkSize = 0
+		}
+		chunk = append(chunk, userID)
+		chunkSize += userIDSize
+	}
+	if len(chunk) > 0 {
+		chunks = append(chunks, chunk)
+	}
+	return chunks
+}
+
+// Members returns the IDs of users subscribed to the channel, on this hub
+// and on other hubs sharing the backend.
+func (h *Hub) Members(channel string) []string {
+	reply := make(chan []string, 1)
+	select {
+	case h.presenceQuery <- presenceQuery{channel, reply}:
+		return <-reply
+	case <-h.stopped:
+		return []string{}
+	}
+}
+
+func (h *Hub) presenceTTL() time.Duration {
+	return 3 * h.presenceInterval
+}
+
+func (h *Hub) join(channel string, c *connection) {
+	userID := c.client.UserID
+	if userID == "" || !isPresenceTracked(channel) {
+		return
+	}
+
+	if h.presence.join(channel, userID, time.Now(), h.presenceTTL()) {
+		h.broadcastPresenceEvent(PresenceJoin, channel, userID)
+	}
+	h.relayPresence(channel)
+}
+
+func (h *Hub) leave(channel string, c *connection) {
+	userID := c.client.UserID
+	if userID == "" || !isPresenceTracked(channel) {
+		return
+	}
+
+	if h.presence.leave(channel, userID, time.Now(), h.presenceTTL()) {
+		h.broadcastPresenceEvent(PresenceLeave, channel, userID)
+	}
+	h.relayPresence(channel)
+}
+
+func (h *Hub) broadcastPresenceEvent(event string, channel string, userID string) {
+	data, err := json.Marshal(presenceEvent{
+		Event:   event,
+		Channel: channel,
+		UserID:  userID,
+	})
+	if err != nil {
+		log.Warnf("Can't encode presence event: %v", err)
+		return
+	}
+
+	h.broadcast(Parcel{
+		Channel: PresenceChannelPrefix + channel,
+		Data:    data,
+	})
+}
+
+// relayPresence sends the users on the channel of this hub to other hubs
+// sharing the backend, in chunks fitting in a backend message.
+func (h *Hub) relayPresence(channel string) {
+	if h.backend == nil {
+		return
+	}
+
+	chunks := chunkPresence(h.presence.localMembers(channel), presenceChunkSize-len(channel))
+	if len(chunks) == 0 {
+		h.relay(backendMessage{
+			Presence: &presenceMessage{
+				InstanceID: h.instanceID,
+				Channel:    channel,
+				UserIDs:    []string{},
+			},
+		})
+		return
+	}
+
+	for i, chunk := range chunks {
+		h.relay(backendMessage{
+			Presence: &presenceMessage{
+				InstanceID: h.instanceID,
+				Channel:    channel,
+				UserIDs:    chunk,
+				Chunk:      i,
+				Chunks:     len(chunks),
+			},
+		})
+	}
+}
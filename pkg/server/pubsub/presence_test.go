@@ -0,0 +1,270 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pubsub
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/skygeario/skygear-server/pkg/server/skytest"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// bus connects backends of hubs in memory, as if they are separate
+// skygear-servers sharing a backend.
+type bus struct {
+	mutex    sync.Mutex
+	backends []*busBackend
+}
+
+func (b *bus) newBackend() *busBackend {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	backend := &busBackend{
+		bus:    b,
+		inbox:  make(chan []byte, 100),
+		closed: make(chan struct{}),
+	}
+	b.backends = append(b.backends, backend)
+	return backend
+}
+
+type busBackend struct {
+	bus    *bus
+	inbox  chan []byte
+	closed chan struct{}
+}
+
+func (b *busBackend) Publish(message []byte) error {
+	b.bus.mutex.Lock()
+	defer b.bus.mutex.Unlock()
+	for _, backend := range b.bus.backends {
+		backend.inbox <- message
+	}
+	return nil
+}
+
+func (b *busBackend) Listen(handler func(message []byte)) error {
+	for {
+		select {
+		case message := <-b.inbox:
+			handler(message)
+		case <-b.closed:
+			return nil
+		}
+	}
+}
+
+func (b *busBackend) Close() error {
+	close(b.closed)
+	return nil
+}
+
+func TestPresence(t *testing.T) {
+	Convey("presence", t, func() {
+		now := time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC)
+		ttl := 90 * time.Second
+		p := newPresence()
+
+		Convey("joins and leaves by connections", func() {
+			So(p.join("chat", "alice", now, ttl), ShouldBeTrue)
+			So(p.join("chat", "alice", now, ttl), ShouldBeFalse)
+			So(p.join("chat", "bob", now, ttl), ShouldBeTrue)
+			So(p.members("chat", now, ttl), ShouldResemble, []string{"alice", "bob"})
+
+			So(p.leave("chat", "alice", now, ttl), ShouldBeFalse)
+			So(p.leave("chat", "alice", now, ttl), ShouldBeTrue)
+			So(p.leave("chat", "alice", now, ttl), ShouldBeFalse)
+			So(p.members("chat", now, ttl), ShouldResemble, []string{"bob"})
+			So(p.localChannels(), ShouldResemble, []string{"chat"})
+
+			So(p.leave("chat", "bob", now, ttl), ShouldBeTrue)
+			So(p.localChannels(), ShouldBeEmpty)
+		})
+
+		Convey("includes members of other hubs", func() {
+			p.update(presenceMessage{InstanceID: "other", Channel: "chat", UserIDs: []string{"carol"}}, now)
+			So(p.join("chat", "carol", now, ttl), ShouldBeFalse)
+			So(p.join("chat", "alice", now, ttl), ShouldBeTrue)
+			So(p.members("chat", now, ttl), ShouldResemble, []string{"alice", "carol"})
+			So(p.leave("chat", "carol", now, ttl), ShouldBeFalse)
+
+			p.update(presenceMessage{InstanceID: "other", Channel: "chat", UserIDs: []string{}}, now)
+			So(p.members("chat", now, ttl), ShouldResemble, []string{"alice"})
+			So(p.remote, ShouldBeEmpty)
+		})
+
+		Convey("expires members of other hubs", func() {
+			p.update(presenceMessage{InstanceID: "other", Channel: "chat", UserIDs: []string{"carol"}}, now)
+			So(p.members("chat", now.Add(ttl), ttl), ShouldResemble, []string{"carol"})
+			So(p.members("chat", now.Add(ttl+time.Second), ttl), ShouldBeEmpty)
+
+			p.expire(now.Add(ttl+time.Second), ttl)
+			So(p.remote, ShouldBeEmpty)
+		})
+
+		Convey("includes members of other hubs in chunks", func() {
+			p.update(presenceMessage{InstanceID: "other", Channel: "chat", UserIDs: []string{"carol"}, Chunk: 0, Chunks: 2}, now)
+			p.update(presenceMessage{InstanceID: "other", Channel: "chat", UserIDs: []string{"dave"}, Chunk: 1, Chunks: 2}, now.Add(time.Second))
+			So(p.members("chat", now, ttl), ShouldResemble, []string{"carol", "dave"})
+
+			Convey("expires chunks not refreshed", func() {
+				So(p.members("chat", now.Add(ttl+time.Second), ttl), ShouldResemble, []string{"dave"})
+				p.expire(now.Add(ttl+time.Second), ttl)
+				So(p.remote["other"], ShouldContainKey, "chat")
+				p.expire(now.Add(ttl+2*time.Second), ttl)
+				So(p.remote, ShouldBeEmpty)
+			})
+
+			Convey("removes chunks beyond the number of chunks", func() {
+				p.update(presenceMessage{InstanceID: "other", Channel: "chat", UserIDs: []string{"carol"}, Chunk: 0, Chunks: 1}, now)
+				So(p.members("chat", now, ttl), ShouldResemble, []string{"carol"})
+			})
+
+			Convey("ignores chunk out of range", func() {
+				p.update(presenceMessage{InstanceID: "other", Channel: "chat", UserIDs: []string{"eve"}, Chunk: 2, Chunks: 2}, now)
+				So(p.members("chat", now, ttl), ShouldResemble, []string{"carol", "dave"})
+			})
+		})
+	})
+}
+
+func TestChunkPresence(t *testing.T) {
+	Convey("chunkPresence", t, func() {
+		So(chunkPresence([]string{}, 10), ShouldBeEmpty)
+		So(chunkPresence([]string{"alice", "bob"}, 10), ShouldResemble, [][]string{{"alice"}, {"bob"}})
+		So(chunkPresence([]string{"al", "bo", "ca"}, 10), ShouldResemble, [][]string{{"al", "bo"}, {"ca"}})
+		So(chunkPresence([]string{"a-very-long-user-id"}, 10), ShouldResemble, [][]string{{"a-very-long-user-id"}})
+	})
+}
+
+func receiveParcel(c *connection) (Parcel, bool) {
+	select {
+	case p := <-c.Send:
+		return p, true
+	case <-time.After(500 * time.Millisecond):
+		return Parcel{}, false
+	}
+}
+
+func waitMembers(h *Hub, channel string, count int) []string {
+	var members []string
+	for i := 0; i < 50; i++ {
+		members = h.Members(channel)
+		if len(members) == count {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return members
+}
+
+func TestHubPresence(t *testing.T) {
+	Convey("Hub presence", t, func() {
+		b := &bus{}
+		hubA := NewHubWithBackend(b.newBackend())
+		hubB := NewHubWithBackend(b.newBackend())
+		go hubA.run()
+		go hubB.run()
+		defer func() {
+			hubA.stop <- 1
+			hubB.stop <- 1
+		}()
+
+		alice := &connection{
+			client: Client{UserID: "alice"},
+			Send:   make(chan Parcel),
+		}
+		observer := &connection{
+			Send: make(chan Parcel),
+		}
+		hubB.Subscribe <- Parcel{Channel: "_presence:chat", Connection: observer}
+
+		Convey("tracks members on all hubs", func() {
+			hubA.Subscribe <- Parcel{Channel: "chat", Connection: alice}
+
+			p, ok := receiveParcel(observer)
+			So(ok, ShouldBeTrue)
+			So(p.Channel, ShouldEqual, "_presence:chat")
+			So(p.Data, ShouldEqualJSON, `{"event": "join", "channel": "chat", "user_id": "alice"}`)
+			So(waitMembers(hubB, "chat", 1), ShouldResemble, []string{"alice"})
+			So(hubA.Members("chat"), ShouldResemble, []string{"alice"})
+
+			hubA.Unsubscribe <- Parcel{Channel: "chat", Connection: alice}
+
+			p, ok = receiveParcel(observer)
+			So(ok, ShouldBeTrue)
+			So(p.Data, ShouldEqualJSON, `{"event": "leave", "channel": "chat", "user_id": "alice"}`)
+			So(waitMembers(hubB, "chat", 0), ShouldBeEmpty)
+		})
+
+		Convey("does not track device channels", func() {
+			hubA.Subscribe <- Parcel{Channel: "_sub_device", Connection: alice}
+			So(hubA.Members("_sub_device"), ShouldBeEmpty)
+		})
+
+		Convey("does not track anonymous connections", func() {
+			anonymous := &connection{
+				Send: make(chan Parcel),
+			}
+			hubA.Subscribe <- Parcel{Channel: "chat", Connection: anonymous}
+			So(hubA.Members("chat"), ShouldBeEmpty)
+		})
+	})
+
+	Convey("Hub presence of many members", t, func() {
+		backend := &loopbackBackend{
+			published: make(chan []byte, 100),
+			closed:    make(chan struct{}),
+		}
+		hub := NewHubWithBackend(backend)
+		now := time.Now()
+		for i := 0; i < 500; i++ {
+			hub.presence.join("chat", fmt.Sprintf("user-%036d", i), now, hub.presenceTTL())
+		}
+
+		hub.relayPresence("chat")
+		close(hub.relayQueue)
+
+		other := newPresence()
+		for message := range hub.relayQueue {
+			So(len(message), ShouldBeLessThan, 8000)
+			m, err := decodeBackendMessage(message)
+			So(err, ShouldBeNil)
+			other.update(*m.Presence, now)
+		}
+		So(other.members("chat", now, hub.presenceTTL()), ShouldHaveLength, 500)
+	})
+
+	Convey("Hub presence without backend", t, func() {
+		hub := NewHub()
+		go hub.run()
+		defer func() {
+			hub.stop <- 1
+		}()
+
+		alice := &connection{
+			client: Client{UserID: "alice"},
+			Send:   make(chan Parcel),
+		}
+		hub.Subscribe <- Parcel{Channel: "chat", Connection: alice}
+		So(hub.Members("chat"), ShouldResemble, []string{"alice"})
+
+		hub.Unsubscribe <- Parcel{Channel: "chat", Connection: alice}
+		So(hub.Members("chat"), ShouldBeEmpty)
+	})
+}
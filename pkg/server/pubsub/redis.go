@@ -0,0 +1,131 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pubsub
+
+import (
+	"sync"
+	"time"
+
+	"github.com/garyburd/redigo/redis"
+)
+
+// RedisBackend is a Backend relaying messages through redis pub/sub.
+type RedisBackend struct {
+	pool    *redis.Pool
+	channel string
+
+	mutex  sync.Mutex
+	psc    *redis.PubSubConn
+	closed bool
+}
+
+// NewRedisBackend returns a RedisBackend relaying messages on the
+// redis channel of the server at the url.
+func NewRedisBackend(url string, channel string) *RedisBackend {
+	return &RedisBackend{
+		pool: &redis.Pool{
+			MaxIdle: 10,
+			Dial: func() (redis.Conn, error) {
+				return redis.DialURL(url)
+			},
+			TestOnBorrow: func(c redis.Conn, t time.Time) error {
+				_, err := c.Do("PING")
+				return err
+			},
+		},
+		channel: channel,
+	}
+}
+
+// Publish implements the Backend interface.
+func (b *RedisBackend) Publish(message []byte) error {
+	c := b.pool.Get()
+	defer c.Close()
+
+	_, err := c.Do("PUBLISH", b.channel, message)
+	return err
+}
+
+// Listen implements the Backend interface. The subscription is
+// re-established if the connection to redis is lost.
+func (b *RedisBackend) Listen(handler func(message []byte)) error {
+	for {
+		psc, err := b.subscribe()
+		if err == nil && psc == nil {
+			return nil
+		}
+		if err == nil {
+			err = b.receive(psc, handler)
+		}
+		if b.isClosed() {
+			return nil
+		}
+
+		log.Warnf("pubsub/redis: lost subscription to %s: %v", b.channel, err)
+		time.Sleep(time.Second)
+	}
+}
+
+// subscribe returns a connection subscribed to the channel, or nil if
+// the backend is closed.
+func (b *RedisBackend) subscribe() (*redis.PubSubConn, error) {
+	c := b.pool.Get()
+	psc := &redis.PubSubConn{Conn: c}
+	if err := psc.Subscribe(b.channel); err != nil {
+		c.Close()
+		return nil, err
+	}
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if b.closed {
+		psc.Close()
+		return nil, nil
+	}
+	b.psc = psc
+	return psc, nil
+}
+
+func (b *RedisBackend) receive(psc *redis.PubSubConn, handler func(message []byte)) error {
+	defer psc.Close()
+	for {
+		switch v := psc.Receive().(type) {
+		case redis.Message:
+			handler(v.Data)
+		case error:
+			return v
+		}
+	}
+}
+
+func (b *RedisBackend) isClosed() bool {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.closed
+}
+
+// Close implements the Backend interface.
+func (b *RedisBackend) Close() error {
+	b.mutex.Lock()
+	b.closed = true
+	psc := b.psc
+	b.mutex.Unlock()
+
+	if psc != nil {
+		psc.Unsubscribe()
+		psc.Close()
+	}
+	return b.pool.Close()
+}
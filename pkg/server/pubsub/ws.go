@@ -15,31 +15,71 @@
 package pubsub
 
 import (
+	"context"
 	"encoding/json"
+	"fmt"
 	"net/http"
+	"time"
 
 	"github.com/gorilla/websocket"
 )
 
 type connection struct {
 	ws       *websocket.Conn
+	client   Client
 	channels []string
 	Send     chan Parcel
+	errors   chan wsError
 	done     chan bool
 }
 
+// wsError is an error message written to the client by the writer
+// goroutine, which is the only goroutine writing to the websocket.
+type wsError struct {
+	message string
+	closing bool
+}
+
+// sendError sends the error message to the client. If closing is true,
+// a close message is sent after the error message.
+func (c *connection) sendError(message string, closing bool) {
+	c.errors <- wsError{message, closing}
+}
+
+func (c *connection) removeChannel(channel string) {
+	channels := []string{}
+	for _, existing := range c.channels {
+		if existing != channel {
+			channels = append(channels, existing)
+		}
+	}
+	c.channels = channels
+}
+
 type wsPayload struct {
 	Action  string           `json:"action,omitempty"`
 	Channel string           `json:"channel"`
 	Data    *json.RawMessage `json:"data,omitempty"`
+	ID      int64            `json:"id,omitempty"`
+	Since   *int64           `json:"since,omitempty"`
 }
 
 // WsPubSub is a websocket trsnaport of pubsub
 // Protocol: {"action": "sub", "channel": "royuen"}
 // {"action": "pub", "channel": "royuen", "data": {"any":"thing"}}
+//
+// If the channel has history, messages received carry the ID of the
+// message: {"channel": "royuen", "data": {"any":"thing"}, "id": 42}
+// Subscribing with since replays messages after the message of the ID
+// before new messages: {"action": "sub", "channel": "royuen", "since": 42}
+//
+// If Authorizer is set, each sub and pub is authorized against the client
+// of the connection. Unauthorized actions are answered with an error
+// message and are not performed.
 type WsPubSub struct {
-	upgrader websocket.Upgrader
-	hub      *Hub
+	upgrader   websocket.Upgrader
+	hub        *Hub
+	Authorizer Authorizer
 }
 
 // NewWsPubsub is factory for WsPubSub
@@ -56,24 +96,27 @@ func NewWsPubsub(hub *Hub) *WsPubSub {
 		},
 	}
 	ws := WsPubSub{
-		upgrader,
-		hub,
+		upgrader: upgrader,
+		hub:      hub,
 	}
 	go hub.run()
 	return &ws
 }
 
-// Handle will hijack the http responseWriter and req.
-func (w *WsPubSub) Handle(writer http.ResponseWriter, req *http.Request) {
+// Handle will hijack the http responseWriter and req. Actions on the
+// connection are performed on behalf of the client.
+func (w *WsPubSub) Handle(writer http.ResponseWriter, req *http.Request, client Client) {
 	conn, err := w.upgrader.Upgrade(writer, req, nil)
 	if err != nil {
 		log.Println(err)
 		return
 	}
 	c := &connection{
-		ws:   conn,
-		Send: make(chan Parcel),
-		done: make(chan bool),
+		ws:     conn,
+		client: client,
+		Send:   make(chan Parcel),
+		errors: make(chan wsError),
+		done:   make(chan bool),
 	}
 	go w.writer(c)
 	go w.reader(c)
@@ -89,19 +132,25 @@ writer:
 			message, _ := json.Marshal(wsPayload{
 				Channel: parcel.Channel,
 				Data:    &d,
+				ID:      parcel.ID,
 			})
 			c.ws.WriteMessage(websocket.TextMessage, message)
+		case e := <-c.errors:
+			c.ws.WriteMessage(websocket.TextMessage, []byte(e.message))
+			if e.closing {
+				c.ws.WriteMessage(websocket.CloseMessage, nil)
+			}
 		case <-c.done:
 			break writer
 		}
 	}
 	log.Debugf("Close ws writer goroutine %p", c.ws)
+	c.ws.Close()
 }
 
 func (w *WsPubSub) reader(c *connection) {
 	defer func() {
 		log.Debugf("Close ws reader connection %p", c.ws)
-		c.ws.Close()
 		for _, channel := range c.channels {
 			w.hub.Unsubscribe <- Parcel{
 				Channel:    channel,
@@ -122,25 +171,23 @@ func (w *WsPubSub) reader(c *connection) {
 		err = json.Unmarshal(p, &payload)
 		if err != nil {
 			log.Debugf("Can't decode Ws message %v", err)
-			c.ws.WriteMessage(
-				websocket.TextMessage,
-				[]byte("Error: "+err.Error()+" \nClosing Connection"))
-			c.ws.WriteMessage(websocket.CloseMessage, nil)
+			c.sendError("Error: "+err.Error()+" \nClosing Connection", true)
 			return
 		}
 		if payload.Channel == "" {
 			log.Debugf("Got empty channel.")
-			c.ws.WriteMessage(
-				websocket.TextMessage,
-				[]byte("Error: channel should not be empty. Closing Connection"),
-			)
-			c.ws.WriteMessage(websocket.CloseMessage, nil)
+			c.sendError("Error: channel should not be empty. Closing Connection", true)
 			return
 		}
+		if !w.authorize(c, payload.Action, payload.Channel) {
+			c.sendError(fmt.Sprintf(`Error: not authorized to %s channel "%s"`, payload.Action, payload.Channel), false)
+			continue
+		}
 		switch payload.Action {
 		case "sub":
 			w.hub.Subscribe <- Parcel{
 				Channel:    payload.Channel,
+				Since:      payload.Since,
 				Connection: c,
 			}
 			c.channels = append(c.channels, payload.Channel)
@@ -149,15 +196,11 @@ func (w *WsPubSub) reader(c *connection) {
 				Channel:    payload.Channel,
 				Connection: c,
 			}
-			c.channels = append(c.channels, payload.Channel)
+			c.removeChannel(payload.Channel)
 		case "pub":
 			if payload.Data == nil {
 				log.Debugf("Got nil pub data.")
-				c.ws.WriteMessage(
-					websocket.TextMessage,
-					[]byte("Error: missing data to publish. Closing Connection"),
-				)
-				c.ws.WriteMessage(websocket.CloseMessage, nil)
+				c.sendError("Error: missing data to publish. Closing Connection", true)
 				return
 			}
 			w.hub.Broadcast <- Parcel{
@@ -165,9 +208,25 @@ func (w *WsPubSub) reader(c *connection) {
 				Data:    []byte(*payload.Data),
 			}
 		default:
-			c.ws.WriteMessage(
-				websocket.TextMessage,
-				[]byte("Unknow action"))
+			c.sendError("Unknow action", false)
 		}
 	}
 }
+
+// authorize returns whether the client of the connection is allowed to
+// perform the action on the channel. Actions other than sub and pub are
+// always allowed.
+func (w *WsPubSub) authorize(c *connection, action string, channel string) bool {
+	if w.Authorizer == nil || (action != ActionSubscribe && action != ActionPublish) {
+		return true
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	allowed, err := w.Authorizer.Authorize(ctx, c.client, action, channel)
+	if err != nil {
+		log.Warnf("Failed to authorize %s on channel %s: %v", action, channel, err)
+		return false
+	}
+	return allowed
+}
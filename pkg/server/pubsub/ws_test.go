@@ -0,0 +1,75 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pubsub
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestWsPubSub(t *testing.T) {
+	Convey("WsPubSub", t, func() {
+		hub := NewHub()
+		defer func() {
+			hub.stop <- 1
+		}()
+
+		wsPubSub := NewWsPubsub(hub)
+		wsPubSub.Authorizer = &ChannelAuthorizer{
+			User:    ChannelRule{Subscribe: RuleOwner, Publish: RuleMaster},
+			Default: ChannelRule{Subscribe: RuleAnyone, Publish: RuleAnyone},
+		}
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			wsPubSub.Handle(w, r, Client{})
+		}))
+		defer server.Close()
+
+		conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+		So(err, ShouldBeNil)
+		defer conn.Close()
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+		readMessage := func() string {
+			_, message, err := conn.ReadMessage()
+			So(err, ShouldBeNil)
+			return string(message)
+		}
+
+		Convey("answers unauthorized action with error", func() {
+			conn.WriteMessage(websocket.TextMessage, []byte(`{"action": "sub", "channel": "user:alice"}`))
+			So(readMessage(), ShouldEqual, `Error: not authorized to sub channel "user:alice"`)
+
+			conn.WriteMessage(websocket.TextMessage, []byte(`{"action": "sub", "channel": "chat"}`))
+			conn.WriteMessage(websocket.TextMessage, []byte(`{"action": "pub", "channel": "chat", "data": {"text": "hello"}}`))
+			So(readMessage(), ShouldEqual, `{"channel":"chat","data":{"text":"hello"}}`)
+		})
+
+		Convey("answers invalid message with error and closes connection", func() {
+			conn.WriteMessage(websocket.TextMessage, []byte(`{"action": "pub"}`))
+			So(readMessage(), ShouldEqual, "Error: channel should not be empty. Closing Connection")
+
+			_, _, err := conn.ReadMessage()
+			closeErr, ok := err.(*websocket.CloseError)
+			So(ok, ShouldBeTrue)
+			So(closeErr.Code, ShouldEqual, websocket.CloseNoStatusReceived)
+		})
+	})
+}
@@ -0,0 +1,120 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package push
+
+import (
+	"sync"
+
+	"github.com/sirupsen/logrus"
+	"github.com/skygeario/skygear-server/pkg/server/skydb"
+)
+
+const (
+	defaultBroadcastBatchSize   = 500
+	defaultBroadcastConcurrency = 10
+)
+
+// MapperFunc returns the notification to be sent to device. The conn
+// is the one used by the Broadcaster to query devices.
+type MapperFunc func(conn skydb.Conn, device skydb.Device) (Mapper, error)
+
+// Broadcaster sends a notification to all devices subscribed to a topic.
+//
+// Devices are queried in batches of BatchSize, and at most Concurrency
+// notifications are being sent at the same time.
+type Broadcaster struct {
+	ConnOpener  func() (skydb.Conn, error)
+	BatchSize   int
+	Concurrency int
+}
+
+// Broadcast sends the notification returned by mapperFunc to all devices
+// subscribed to topic with sender. Devices sharing the same token receive
+// the notification once. If mapperFunc returns an error for a device, the
+// device is skipped.
+//
+// Broadcast returns after all notifications are sent, with the number of
+// devices the notification is sent to. Failing to send to a device is
+// logged but does not stop the broadcast.
+func (b *Broadcaster) Broadcast(sender Sender, topic string, mapperFunc MapperFunc) (int, error) {
+	conn, err := b.ConnOpener()
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+
+	batchSize := b.BatchSize
+	if batchSize <= 0 {
+		batchSize = defaultBroadcastBatchSize
+	}
+	concurrency := b.Concurrency
+	if concurrency <= 0 {
+		concurrency = defaultBroadcastConcurrency
+	}
+
+	logger := log.WithField("topic", topic)
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	sentTokens := map[string]bool{}
+	count := 0
+	afterID := ""
+	for {
+		devices, queryErr := conn.QueryDevicesByTopic(topic, afterID, batchSize)
+		if queryErr != nil {
+			return count, queryErr
+		}
+
+		for _, device := range devices {
+			afterID = device.ID
+			if device.Token == "" || sentTokens[device.Token] {
+				continue
+			}
+			sentTokens[device.Token] = true
+
+			// mapperFunc is called sequentially so that it need not be
+			// safe for concurrent use
+			m, mapErr := mapperFunc(conn, device)
+			if mapErr != nil {
+				logger.WithFields(logrus.Fields{
+					"deviceID": device.ID,
+					"error":    mapErr,
+				}).Warnln("push: skip device in broadcast")
+				continue
+			}
+
+			count++
+			sem <- struct{}{}
+			wg.Add(1)
+			go func(device skydb.Device) {
+				defer func() {
+					<-sem
+					wg.Done()
+				}()
+				if sendErr := sender.Send(m, device); sendErr != nil {
+					logger.WithFields(logrus.Fields{
+						"deviceID": device.ID,
+						"error":    sendErr,
+					}).Warnln("push: failed to send notification to device in broadcast")
+				}
+			}(device)
+		}
+
+		if len(devices) < batchSize {
+			return count, nil
+		}
+	}
+}
@@ -0,0 +1,121 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package push
+
+import (
+	"errors"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/skygeario/skygear-server/pkg/server/skydb"
+	"github.com/skygeario/skygear-server/pkg/server/skydb/skydbtest"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+type topicMapConn struct {
+	*skydbtest.MapConn
+	devices []skydb.Device
+	queries int
+}
+
+func (conn *topicMapConn) QueryDevicesByTopic(topic string, afterID string, limit int) ([]skydb.Device, error) {
+	conn.queries++
+	results := []skydb.Device{}
+	for _, device := range conn.devices {
+		if device.Topic == topic && device.ID > afterID && len(results) < limit {
+			results = append(results, device)
+		}
+	}
+	return results, nil
+}
+
+type concurrentSender struct {
+	mutex    sync.Mutex
+	sent     []string
+	inFlight int
+	maxIn    int
+}
+
+func (s *concurrentSender) Send(m Mapper, device skydb.Device) error {
+	s.mutex.Lock()
+	s.inFlight++
+	if s.inFlight > s.maxIn {
+		s.maxIn = s.inFlight
+	}
+	s.mutex.Unlock()
+
+	time.Sleep(time.Millisecond)
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.inFlight--
+	s.sent = append(s.sent, m.Map()["device"].(string))
+	return nil
+}
+
+func TestBroadcaster(t *testing.T) {
+	Convey("Broadcaster", t, func() {
+		conn := &topicMapConn{MapConn: skydbtest.NewMapConn()}
+		for _, id := range []string{"a", "b", "c", "d", "e", "f", "g"} {
+			conn.devices = append(conn.devices, skydb.Device{
+				ID:    id,
+				Topic: "news",
+				Token: "token-" + id,
+			})
+		}
+		conn.devices = append(conn.devices,
+			skydb.Device{ID: "h", Topic: "news", Token: "token-a"},
+			skydb.Device{ID: "i", Topic: "news"},
+			skydb.Device{ID: "j", Topic: "sports", Token: "token-j"},
+		)
+
+		broadcaster := &Broadcaster{
+			ConnOpener: func() (skydb.Conn, error) {
+				return conn, nil
+			},
+			BatchSize:   3,
+			Concurrency: 2,
+		}
+		sender := &concurrentSender{}
+		mapperFunc := func(conn skydb.Conn, device skydb.Device) (Mapper, error) {
+			if device.ID == "c" {
+				return nil, errors.New("cannot render")
+			}
+			return MapMapper{"device": device.ID}, nil
+		}
+
+		Convey("sends to devices of the topic in batches", func() {
+			count, err := broadcaster.Broadcast(sender, "news", mapperFunc)
+			So(err, ShouldBeNil)
+			So(count, ShouldEqual, 6)
+
+			sort.Strings(sender.sent)
+			So(sender.sent, ShouldResemble, []string{"a", "b", "d", "e", "f", "g"})
+			So(conn.queries, ShouldEqual, 4)
+			So(sender.maxIn, ShouldBeLessThanOrEqualTo, 2)
+		})
+
+		Convey("returns error if conn cannot be opened", func() {
+			broadcaster.ConnOpener = func() (skydb.Conn, error) {
+				return nil, errors.New("no conn")
+			}
+			count, err := broadcaster.Broadcast(sender, "news", mapperFunc)
+			So(err, ShouldNotBeNil)
+			So(count, ShouldEqual, 0)
+		})
+	})
+}
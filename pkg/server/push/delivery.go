@@ -0,0 +1,253 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package push
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net"
+	"net/http"
+	"time"
+
+	"firebase.google.com/go/messaging"
+	"github.com/sirupsen/logrus"
+	"github.com/skygeario/buford/push"
+	"github.com/skygeario/skygear-server/pkg/server/skydb"
+)
+
+var timeNow = time.Now
+
+const (
+	defaultDeliveryMaxAttempts = 5
+	defaultDeliveryRetryDelay  = 30 * time.Second
+	maxDeliveryRetryDelay      = time.Hour
+)
+
+// TransientError wraps an error returned by a push service, which may
+// not occur if the notification is sent again later.
+type TransientError struct {
+	Err error
+}
+
+func (e *TransientError) Error() string {
+	return e.Err.Error()
+}
+
+// IsTransientError returns whether the error returned by a Sender is
+// transient, such as rate limiting (HTTP 429) and server errors (HTTP 5xx)
+// of the push services, and network timeouts.
+func IsTransientError(err error) bool {
+	switch e := err.(type) {
+	case nil:
+		return false
+	case *TransientError:
+		return true
+	case *push.Error:
+		return isTransientStatus(e.Status)
+	case net.Error:
+		return e.Timeout() || e.Temporary()
+	}
+
+	return messaging.IsInternal(err) ||
+		messaging.IsServerUnavailable(err) ||
+		messaging.IsMessageRateExceeded(err)
+}
+
+func isTransientStatus(status int) bool {
+	return status == http.StatusTooManyRequests || status >= http.StatusInternalServerError
+}
+
+// DeliveryLog records the delivery of push notifications with
+// skydb.PushDeliveryConn.
+//
+// Notifications sent with the Sender returned by DeliveryLog.PushSender
+// are recorded under a push ID. A notification failed with a transient error
+// is marked for retry with exponential backoff starting from RetryDelay,
+// until it has been attempted MaxAttempts times. The retries are sent by
+// RetryWorker.
+type DeliveryLog struct {
+	ConnOpener  func() (skydb.Conn, error)
+	Sender      Sender
+	MaxAttempts int
+	RetryDelay  time.Duration
+}
+
+// PushSender returns a Sender which sends notifications with the Sender
+// of the DeliveryLog and records the deliveries under pushID.
+func (l *DeliveryLog) PushSender(pushID string) Sender {
+	return &deliverySender{
+		log:    l,
+		pushID: pushID,
+	}
+}
+
+// attempt sends the notification of the delivery to device and records
+// the result of the attempt.
+func (l *DeliveryLog) attempt(conn skydb.Conn, delivery *skydb.PushDelivery, m Mapper, device skydb.Device) error {
+	err := l.Sender.Send(m, device)
+
+	now := timeNow().UTC()
+	delivery.Attempts++
+	delivery.UpdatedAt = now
+	delivery.NextAttemptAt = time.Time{}
+	if err == nil {
+		delivery.Status = skydb.PushDeliverySent
+		delivery.Response = ""
+	} else if IsTransientError(err) && delivery.Attempts < l.maxAttempts() {
+		delivery.Status = skydb.PushDeliveryRetrying
+		delivery.Response = err.Error()
+		delivery.NextAttemptAt = now.Add(l.retryDelay(delivery.Attempts))
+	} else {
+		delivery.Status = skydb.PushDeliveryFailed
+		delivery.Response = err.Error()
+	}
+
+	if updateErr := conn.UpdatePushDelivery(delivery); updateErr != nil {
+		log.WithFields(logrus.Fields{
+			"id":    delivery.ID,
+			"error": updateErr,
+		}).Errorln("push: failed to update push delivery")
+	}
+	return err
+}
+
+func (l *DeliveryLog) maxAttempts() int {
+	if l.MaxAttempts <= 0 {
+		return defaultDeliveryMaxAttempts
+	}
+	return l.MaxAttempts
+}
+
+// retryDelay returns the delay before a delivery is retried after the
+// specified number of failed attempts.
+func (l *DeliveryLog) retryDelay(attempts int) time.Duration {
+	delay := l.RetryDelay
+	if delay <= 0 {
+		delay = defaultDeliveryRetryDelay
+	}
+
+	for i := 1; i < attempts && delay < maxDeliveryRetryDelay; i++ {
+		delay *= 2
+	}
+	if delay > maxDeliveryRetryDelay {
+		delay = maxDeliveryRetryDelay
+	}
+	return delay
+}
+
+type deliverySender struct {
+	log    *DeliveryLog
+	pushID string
+}
+
+// DeliveryRecorder is a Sender recording the deliveries of notifications,
+// like the Sender returned by DeliveryLog.PushSender.
+type DeliveryRecorder interface {
+	Sender
+
+	// Record records a new delivery of the notification to the device,
+	// and returns the Sender sending the notification as the recorded
+	// delivery. It allows the delivery to be queried before the
+	// notification is sent, such as when it is sent asynchronously.
+	Record(m Mapper, device skydb.Device) (Sender, error)
+}
+
+// Send records a new delivery and sends the notification. The
+// notification is sent even if it cannot be recorded.
+func (s *deliverySender) Send(m Mapper, device skydb.Device) error {
+	sender, err := s.Record(m, device)
+	if err != nil {
+		return err
+	}
+	return sender.Send(m, device)
+}
+
+// Record implements DeliveryRecorder. If the delivery cannot be
+// recorded, the returned Sender sends the notification without recording.
+func (s *deliverySender) Record(m Mapper, device skydb.Device) (Sender, error) {
+	logger := log.WithFields(logrus.Fields{
+		"pushID":   s.pushID,
+		"deviceID": device.ID,
+	})
+
+	payload := m.Map()
+	hash, err := payloadHash(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := s.log.ConnOpener()
+	if err != nil {
+		logger.WithField("error", err).Errorln("push: failed to open skydb.Conn")
+		return s.log.Sender, nil
+	}
+	defer conn.Close()
+
+	now := timeNow().UTC()
+	delivery := skydb.PushDelivery{
+		PushID:      s.pushID,
+		DeviceID:    device.ID,
+		UserID:      device.AuthInfoID,
+		Payload:     payload,
+		PayloadHash: hash,
+		Status:      skydb.PushDeliveryPending,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	if err = conn.CreatePushDelivery(&delivery); err != nil {
+		logger.WithField("error", err).Errorln("push: failed to create push delivery")
+		return s.log.Sender, nil
+	}
+
+	return &recordedSender{
+		log:      s.log,
+		delivery: delivery,
+	}, nil
+}
+
+// recordedSender sends the notification of a recorded delivery.
+type recordedSender struct {
+	log      *DeliveryLog
+	delivery skydb.PushDelivery
+}
+
+// Send attempts the delivery and records the result. The notification
+// is sent even if the result cannot be recorded.
+func (s *recordedSender) Send(m Mapper, device skydb.Device) error {
+	conn, err := s.log.ConnOpener()
+	if err != nil {
+		log.WithFields(logrus.Fields{
+			"id":    s.delivery.ID,
+			"error": err,
+		}).Errorln("push: failed to open skydb.Conn")
+		return s.log.Sender.Send(m, device)
+	}
+	defer conn.Close()
+
+	delivery := s.delivery
+	return s.log.attempt(conn, &delivery, m, device)
+}
+
+// payloadHash returns the hex-encoded SHA-256 digest of the JSON-encoded
+// payload.
+func payloadHash(payload map[string]interface{}) (string, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
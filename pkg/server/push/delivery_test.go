@@ -0,0 +1,244 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package push
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/skygeario/buford/push"
+	"github.com/skygeario/skygear-server/pkg/server/skydb"
+	"github.com/skygeario/skygear-server/pkg/server/skydb/skydbtest"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+type deviceMapConn struct {
+	*skydbtest.MapConn
+	devices map[string]skydb.Device
+}
+
+func (conn *deviceMapConn) GetDevice(id string, device *skydb.Device) error {
+	d, ok := conn.devices[id]
+	if !ok {
+		return skydb.ErrDeviceNotFound
+	}
+	*device = d
+	return nil
+}
+
+type resultSender struct {
+	errs []error
+	sent []skydb.Device
+}
+
+func (s *resultSender) Send(m Mapper, device skydb.Device) error {
+	s.sent = append(s.sent, device)
+	if len(s.errs) == 0 {
+		return nil
+	}
+	err := s.errs[0]
+	s.errs = s.errs[1:]
+	return err
+}
+
+func TestIsTransientError(t *testing.T) {
+	Convey("IsTransientError", t, func() {
+		So(IsTransientError(nil), ShouldBeFalse)
+		So(IsTransientError(errors.New("error")), ShouldBeFalse)
+		So(IsTransientError(&TransientError{Err: errors.New("error")}), ShouldBeTrue)
+		So(IsTransientError(&push.Error{
+			Reason: errors.New("TooManyRequests"),
+			Status: http.StatusTooManyRequests,
+		}), ShouldBeTrue)
+		So(IsTransientError(&push.Error{
+			Reason: errors.New("ServiceUnavailable"),
+			Status: http.StatusServiceUnavailable,
+		}), ShouldBeTrue)
+		So(IsTransientError(&push.Error{
+			Reason: errors.New("BadDeviceToken"),
+			Status: http.StatusBadRequest,
+		}), ShouldBeFalse)
+	})
+}
+
+func TestDeliveryLog(t *testing.T) {
+	Convey("DeliveryLog", t, func() {
+		realTime := timeNow
+		now := time.Date(2006, 1, 2, 15, 4, 5, 0, time.UTC)
+		timeNow = func() time.Time { return now }
+		defer func() {
+			timeNow = realTime
+		}()
+
+		device := skydb.Device{
+			ID:         "device",
+			Type:       "ios",
+			Token:      "token",
+			AuthInfoID: "user",
+		}
+		conn := &deviceMapConn{
+			MapConn: skydbtest.NewMapConn(),
+			devices: map[string]skydb.Device{"device": device},
+		}
+		sender := &resultSender{}
+		deliveryLog := &DeliveryLog{
+			ConnOpener: func() (skydb.Conn, error) { return conn, nil },
+			Sender:     sender,
+			RetryDelay: time.Minute,
+		}
+		m := MapMapper{"apns": map[string]interface{}{"aps": map[string]interface{}{}}}
+
+		Convey("records sent delivery", func() {
+			err := deliveryLog.PushSender("push").Send(m, device)
+			So(err, ShouldBeNil)
+
+			deliveries, _ := conn.QueryPushDeliveries("push")
+			So(deliveries, ShouldResemble, []skydb.PushDelivery{{
+				ID:          "delivery-0",
+				PushID:      "push",
+				DeviceID:    "device",
+				UserID:      "user",
+				Payload:     m.Map(),
+				PayloadHash: "ce1d93fe93bf07b229e80b786da2db282f3f7aa326d12c9203476ae010f50034",
+				Status:      skydb.PushDeliverySent,
+				Attempts:    1,
+				CreatedAt:   now,
+				UpdatedAt:   now,
+			}})
+		})
+
+		Convey("records pending delivery before sending", func() {
+			recorded, err := deliveryLog.PushSender("push").(DeliveryRecorder).Record(m, device)
+			So(err, ShouldBeNil)
+			So(sender.sent, ShouldBeEmpty)
+			So(conn.PushDeliveryMap["delivery-0"].Status, ShouldEqual, skydb.PushDeliveryPending)
+
+			So(recorded.Send(m, device), ShouldBeNil)
+			So(len(sender.sent), ShouldEqual, 1)
+			So(conn.PushDeliveryMap, ShouldHaveLength, 1)
+			So(conn.PushDeliveryMap["delivery-0"].Status, ShouldEqual, skydb.PushDeliverySent)
+		})
+
+		Convey("marks delivery with transient error for retry", func() {
+			sender.errs = []error{&TransientError{Err: errors.New("503 status code")}}
+			err := deliveryLog.PushSender("push").Send(m, device)
+			So(err, ShouldNotBeNil)
+
+			delivery := conn.PushDeliveryMap["delivery-0"]
+			So(delivery.Status, ShouldEqual, skydb.PushDeliveryRetrying)
+			So(delivery.Response, ShouldEqual, "503 status code")
+			So(delivery.NextAttemptAt, ShouldResemble, now.Add(time.Minute))
+		})
+
+		Convey("marks delivery with permanent error as failed", func() {
+			sender.errs = []error{errors.New("BadDeviceToken")}
+			deliveryLog.PushSender("push").Send(m, device)
+
+			delivery := conn.PushDeliveryMap["delivery-0"]
+			So(delivery.Status, ShouldEqual, skydb.PushDeliveryFailed)
+			So(delivery.Response, ShouldEqual, "BadDeviceToken")
+			So(delivery.NextAttemptAt.IsZero(), ShouldBeTrue)
+		})
+
+		Convey("gives up after max attempts", func() {
+			deliveryLog.MaxAttempts = 2
+			sender.errs = []error{
+				&TransientError{Err: errors.New("503 status code")},
+				&TransientError{Err: errors.New("503 status code")},
+			}
+			deliveryLog.PushSender("push").Send(m, device)
+
+			now = now.Add(time.Minute)
+			worker := NewRetryWorker(deliveryLog)
+			worker.retryDueDeliveries()
+
+			delivery := conn.PushDeliveryMap["delivery-0"]
+			So(delivery.Status, ShouldEqual, skydb.PushDeliveryFailed)
+			So(delivery.Attempts, ShouldEqual, 2)
+			So(len(sender.sent), ShouldEqual, 2)
+		})
+
+		Convey("RetryWorker", func() {
+			sender.errs = []error{&TransientError{Err: errors.New("503 status code")}}
+			deliveryLog.PushSender("push").Send(m, device)
+			worker := NewRetryWorker(deliveryLog)
+
+			Convey("does not retry delivery before next attempt", func() {
+				worker.retryDueDeliveries()
+				So(len(sender.sent), ShouldEqual, 1)
+			})
+
+			Convey("retries due delivery", func() {
+				now = now.Add(time.Minute)
+				worker.retryDueDeliveries()
+
+				So(len(sender.sent), ShouldEqual, 2)
+				So(sender.sent[1], ShouldResemble, device)
+				delivery := conn.PushDeliveryMap["delivery-0"]
+				So(delivery.Status, ShouldEqual, skydb.PushDeliverySent)
+				So(delivery.Attempts, ShouldEqual, 2)
+				So(delivery.Response, ShouldEqual, "")
+			})
+
+			Convey("backs off exponentially", func() {
+				sender.errs = []error{&TransientError{Err: errors.New("503 status code")}}
+				now = now.Add(time.Minute)
+				worker.retryDueDeliveries()
+
+				delivery := conn.PushDeliveryMap["delivery-0"]
+				So(delivery.Status, ShouldEqual, skydb.PushDeliveryRetrying)
+				So(delivery.NextAttemptAt, ShouldResemble, now.Add(2*time.Minute))
+			})
+
+			Convey("fails delivery to unregistered device", func() {
+				delete(conn.devices, "device")
+				now = now.Add(time.Minute)
+				worker.retryDueDeliveries()
+
+				So(len(sender.sent), ShouldEqual, 1)
+				delivery := conn.PushDeliveryMap["delivery-0"]
+				So(delivery.Status, ShouldEqual, skydb.PushDeliveryFailed)
+			})
+
+			Convey("deletes deliveries older than retention", func() {
+				deliveryLog.PushSender("other-push").Send(m, device)
+				worker.Retention = time.Hour
+
+				now = now.Add(2 * time.Hour)
+				worker.pruneDeliveries()
+				So(conn.PushDeliveryMap, ShouldContainKey, "delivery-0")
+				So(conn.PushDeliveryMap, ShouldNotContainKey, "delivery-1")
+			})
+
+			Convey("stops before running", func() {
+				worker.Stop()
+				worker.Stop()
+
+				done := make(chan struct{})
+				go func() {
+					worker.Run()
+					close(done)
+				}()
+				select {
+				case <-done:
+				case <-time.After(time.Second):
+					t.Fatal("RetryWorker does not stop")
+				}
+			})
+		})
+	})
+}
@@ -58,10 +58,27 @@ func (p *LegacyFCMPusher) Send(m Mapper, device skydb.Device) error {
 	message.RegistrationIDs = []string{device.Token}
 
 	c, _ := createFCMLegacyHTTPPushClient(p.APIKey)
-	if _, err := c.Send(message); err != nil {
+	if response, err := c.Send(message); err != nil {
 		log.Errorf("fcm/key: failed to send fcm Notification: %v", err)
+		if r, ok := response.(fcm.Response); ok && isTransientFCMResponse(r) {
+			return &TransientError{Err: err}
+		}
 		return err
 	}
 
 	return nil
 }
+
+// isTransientFCMResponse returns whether the failed response indicates
+// the message may be sent successfully later.
+func isTransientFCMResponse(response fcm.Response) bool {
+	if isTransientStatus(response.StatusCode) {
+		return true
+	}
+	for _, result := range response.Results {
+		if result.Error == "Unavailable" || result.Error == "InternalServerError" {
+			return true
+		}
+	}
+	return false
+}
@@ -15,6 +15,7 @@
 package push
 
 import (
+	"errors"
 	"testing"
 
 	"github.com/skygeario/skygear-server/pkg/server/skydb"
@@ -31,6 +32,15 @@ func (c *mockFCMLegacyHTTPPushClient) Send(message interface{}) (interface{}, er
 	return nil, nil
 }
 
+type failingFCMLegacyHTTPPushClient struct {
+	response fcm.Response
+	err      error
+}
+
+func (c *failingFCMLegacyHTTPPushClient) Send(message interface{}) (interface{}, error) {
+	return c.response, c.err
+}
+
 func TestLegacyFCMSend(t *testing.T) {
 	Convey("LegacyFCMPusher", t, func() {
 		mockClient := &mockFCMHTTPPushClient{}
@@ -112,6 +122,51 @@ func TestLegacyFCMSend(t *testing.T) {
 			})
 		})
 
+		Convey("returns transient error for server error", func() {
+			createFCMLegacyHTTPPushClient = func(serverKey string) (fcmPushClient, error) {
+				return &failingFCMLegacyHTTPPushClient{
+					response: fcm.Response{StatusCode: 503},
+					err:      errors.New("503 status code"),
+				}, nil
+			}
+
+			err := pusher.Send(MapMapper{
+				"fcm": map[string]interface{}{},
+			}, device)
+			So(IsTransientError(err), ShouldBeTrue)
+		})
+
+		Convey("returns transient error for unavailable result", func() {
+			createFCMLegacyHTTPPushClient = func(serverKey string) (fcmPushClient, error) {
+				return &failingFCMLegacyHTTPPushClient{
+					response: fcm.Response{
+						StatusCode: 200,
+						Results:    []fcm.Result{{Error: "Unavailable"}},
+					},
+					err: errors.New("Failed Unavailable"),
+				}, nil
+			}
+
+			err := pusher.Send(MapMapper{
+				"fcm": map[string]interface{}{},
+			}, device)
+			So(IsTransientError(err), ShouldBeTrue)
+		})
+
+		Convey("returns error for invalid registration", func() {
+			createFCMLegacyHTTPPushClient = func(serverKey string) (fcmPushClient, error) {
+				return &failingFCMLegacyHTTPPushClient{
+					response: fcm.Response{StatusCode: 401},
+					err:      errors.New("401 status code"),
+				}, nil
+			}
+
+			err := pusher.Send(MapMapper{
+				"fcm": map[string]interface{}{},
+			}, device)
+			So(err, ShouldNotBeNil)
+			So(IsTransientError(err), ShouldBeFalse)
+		})
 	})
 
 }
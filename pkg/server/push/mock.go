@@ -0,0 +1,212 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package push
+
+import (
+	"fmt"
+	"net/http"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/skygeario/skygear-server/pkg/server/skydb"
+)
+
+// defaultMockCaptureLimit is the default number of notifications kept
+// by MockSender.
+const defaultMockCaptureLimit = 1000
+
+// MockFailure is a failure simulated by MockSender.
+type MockFailure string
+
+// Failures that can be simulated by MockSender.
+const (
+	// MockInvalidToken fails the notification as a token rejected by the
+	// push service, and deletes the devices of the token like APNS.
+	MockInvalidToken MockFailure = "invalid_token"
+	// MockRateLimited fails the notification with a transient error as
+	// if the push service is rate limiting requests.
+	MockRateLimited MockFailure = "rate_limited"
+	// MockUnavailable fails the notification with a transient error as
+	// if the push service is unavailable.
+	MockUnavailable MockFailure = "unavailable"
+)
+
+// MockFailureRule simulates Failure for devices with token matching
+// TokenPattern, which is a pattern in the syntax of path.Match.
+type MockFailureRule struct {
+	TokenPattern string
+	Failure      MockFailure
+}
+
+// ParseMockFailureRules parses comma-separated rules in the format of
+// "pattern:failure", e.g. "invalid-*:invalid_token,throttled-*:rate_limited".
+func ParseMockFailureRules(s string) ([]MockFailureRule, error) {
+	rules := []MockFailureRule{}
+	for _, rule := range strings.Split(s, ",") {
+		rule = strings.TrimSpace(rule)
+		if rule == "" {
+			continue
+		}
+
+		i := strings.LastIndex(rule, ":")
+		if i <= 0 {
+			return nil, fmt.Errorf("push/mock: invalid failure rule %s", rule)
+		}
+		pattern, failure := rule[:i], MockFailure(rule[i+1:])
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("push/mock: invalid token pattern %s", pattern)
+		}
+		switch failure {
+		case MockInvalidToken, MockRateLimited, MockUnavailable:
+		default:
+			return nil, fmt.Errorf("push/mock: unknown failure %s", failure)
+		}
+
+		rules = append(rules, MockFailureRule{
+			TokenPattern: pattern,
+			Failure:      failure,
+		})
+	}
+	return rules, nil
+}
+
+// CapturedNotification is a notification received by MockSender.
+type CapturedNotification struct {
+	Device     skydb.Device
+	Payload    map[string]interface{}
+	Error      string
+	CapturedAt time.Time
+}
+
+// MockSender is a Sender for testing, which captures the notifications in
+// memory instead of sending them to a push service.
+//
+// Failures are simulated for devices matching the FailureRules, so that
+// device cleanup and retry can be tested without real credentials. Failed
+// notifications are captured with the error.
+type MockSender struct {
+	ConnOpener   func() (skydb.Conn, error)
+	FailureRules []MockFailureRule
+	// CaptureLimit is the number of latest notifications kept.
+	CaptureLimit int
+
+	mutex    sync.Mutex
+	captured []CapturedNotification
+}
+
+// Send captures the notification and returns the simulated failure for
+// the device, if any.
+func (s *MockSender) Send(m Mapper, device skydb.Device) error {
+	err := s.simulate(device)
+
+	notification := CapturedNotification{
+		Device:     device,
+		Payload:    m.Map(),
+		CapturedAt: timeNow().UTC(),
+	}
+	if err != nil {
+		notification.Error = err.Error()
+	}
+	s.capture(notification)
+
+	return err
+}
+
+func (s *MockSender) simulate(device skydb.Device) error {
+	for _, rule := range s.FailureRules {
+		if matched, _ := path.Match(rule.TokenPattern, device.Token); !matched {
+			continue
+		}
+
+		switch rule.Failure {
+		case MockInvalidToken:
+			s.unregisterDevice(device)
+			return fmt.Errorf("push/mock: invalid device token %s", device.Token)
+		case MockRateLimited:
+			return &TransientError{Err: fmt.Errorf("push/mock: %s", http.StatusText(http.StatusTooManyRequests))}
+		case MockUnavailable:
+			return &TransientError{Err: fmt.Errorf("push/mock: %s", http.StatusText(http.StatusServiceUnavailable))}
+		}
+	}
+	return nil
+}
+
+func (s *MockSender) capture(notification CapturedNotification) {
+	limit := s.CaptureLimit
+	if limit <= 0 {
+		limit = defaultMockCaptureLimit
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.captured = append(s.captured, notification)
+	if len(s.captured) > limit {
+		s.captured = append([]CapturedNotification{}, s.captured[len(s.captured)-limit:]...)
+	}
+}
+
+// Captured returns the notifications captured, oldest first.
+func (s *MockSender) Captured() []CapturedNotification {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return append([]CapturedNotification{}, s.captured...)
+}
+
+// Clear removes all notifications captured.
+func (s *MockSender) Clear() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.captured = nil
+}
+
+// TakeCaptured returns the notifications captured, oldest first, and
+// removes them, so that notifications captured meanwhile are not lost.
+func (s *MockSender) TakeCaptured() []CapturedNotification {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	captured := append([]CapturedNotification{}, s.captured...)
+	s.captured = nil
+	return captured
+}
+
+// unregisterDevice deletes the devices of an invalid token, like the
+// devices of invalid tokens reported by APNS.
+func (s *MockSender) unregisterDevice(device skydb.Device) {
+	logger := log.WithFields(logrus.Fields{
+		"deviceID": device.ID,
+	})
+
+	if s.ConnOpener == nil {
+		return
+	}
+	conn, err := s.ConnOpener()
+	if err != nil {
+		logger.Errorf("push/mock: failed to open conn to delete device: %v", err)
+		return
+	}
+	defer conn.Close()
+
+	if deleteErr := conn.DeleteDevicesByToken(device.Token, skydb.ZeroTime); deleteErr != nil && deleteErr != skydb.ErrDeviceNotFound {
+		logger.Errorf("push/mock: failed to delete device of invalid token: %v", deleteErr)
+		return
+	}
+
+	logger.Info("Unregistered device of invalid token from skydb")
+}
+
+var _ Sender = &MockSender{}
@@ -0,0 +1,128 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package push
+
+import (
+	"testing"
+	"time"
+
+	"github.com/skygeario/skygear-server/pkg/server/skydb"
+	"github.com/skygeario/skygear-server/pkg/server/skydb/skydbtest"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestParseMockFailureRules(t *testing.T) {
+	Convey("ParseMockFailureRules", t, func() {
+		Convey("parses rules", func() {
+			rules, err := ParseMockFailureRules("invalid-*:invalid_token, throttled-*:rate_limited,")
+			So(err, ShouldBeNil)
+			So(rules, ShouldResemble, []MockFailureRule{
+				{TokenPattern: "invalid-*", Failure: MockInvalidToken},
+				{TokenPattern: "throttled-*", Failure: MockRateLimited},
+			})
+		})
+
+		Convey("parses empty rules", func() {
+			rules, err := ParseMockFailureRules("")
+			So(err, ShouldBeNil)
+			So(rules, ShouldBeEmpty)
+		})
+
+		Convey("rejects invalid rules", func() {
+			_, err := ParseMockFailureRules("invalid-*")
+			So(err, ShouldNotBeNil)
+			_, err = ParseMockFailureRules("invalid-*:crash")
+			So(err, ShouldNotBeNil)
+			_, err = ParseMockFailureRules("[:invalid_token")
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
+
+func TestMockSender(t *testing.T) {
+	Convey("MockSender", t, func() {
+		realTime := timeNow
+		timeNow = func() time.Time { return time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC) }
+		defer func() {
+			timeNow = realTime
+		}()
+
+		conn := &deleteTokenConn{MapConn: skydbtest.NewMapConn()}
+		sender := &MockSender{
+			ConnOpener: func() (skydb.Conn, error) {
+				return conn, nil
+			},
+			FailureRules: []MockFailureRule{
+				{TokenPattern: "invalid-*", Failure: MockInvalidToken},
+				{TokenPattern: "throttled-*", Failure: MockRateLimited},
+				{TokenPattern: "down-*", Failure: MockUnavailable},
+			},
+		}
+		m := MapMapper{"apns": map[string]interface{}{"aps": map[string]interface{}{"alert": "Hello"}}}
+
+		Convey("captures notifications", func() {
+			device := skydb.Device{ID: "device", Type: "ios", Token: "token"}
+			So(sender.Send(m, device), ShouldBeNil)
+			So(sender.Captured(), ShouldResemble, []CapturedNotification{
+				{
+					Device:     device,
+					Payload:    m.Map(),
+					CapturedAt: time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC),
+				},
+			})
+
+			sender.Clear()
+			So(sender.Captured(), ShouldBeEmpty)
+		})
+
+		Convey("takes captured notifications", func() {
+			sender.Send(m, skydb.Device{ID: "device1", Token: "token"})
+			sender.Send(m, skydb.Device{ID: "device2", Token: "token"})
+
+			captured := sender.TakeCaptured()
+			So(captured, ShouldHaveLength, 2)
+			So(captured[0].Device.ID, ShouldEqual, "device1")
+			So(sender.Captured(), ShouldBeEmpty)
+
+			sender.Send(m, skydb.Device{ID: "device3", Token: "token"})
+			So(sender.TakeCaptured(), ShouldHaveLength, 1)
+		})
+
+		Convey("keeps latest notifications up to limit", func() {
+			sender.CaptureLimit = 2
+			for _, id := range []string{"device1", "device2", "device3"} {
+				sender.Send(m, skydb.Device{ID: id, Token: "token"})
+			}
+			captured := sender.Captured()
+			So(len(captured), ShouldEqual, 2)
+			So(captured[0].Device.ID, ShouldEqual, "device2")
+			So(captured[1].Device.ID, ShouldEqual, "device3")
+		})
+
+		Convey("simulates invalid token", func() {
+			err := sender.Send(m, skydb.Device{ID: "device", Token: "invalid-1"})
+			So(err, ShouldNotBeNil)
+			So(IsTransientError(err), ShouldBeFalse)
+			So(conn.deletedTokens, ShouldResemble, []string{"invalid-1"})
+			So(sender.Captured()[0].Error, ShouldEqual, "push/mock: invalid device token invalid-1")
+		})
+
+		Convey("simulates rate limit and unavailability", func() {
+			So(IsTransientError(sender.Send(m, skydb.Device{ID: "device", Token: "throttled-1"})), ShouldBeTrue)
+			So(IsTransientError(sender.Send(m, skydb.Device{ID: "device", Token: "down-1"})), ShouldBeTrue)
+			So(conn.deletedTokens, ShouldBeEmpty)
+		})
+	})
+}
@@ -0,0 +1,192 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package push
+
+import (
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/skygeario/skygear-server/pkg/server/skydb"
+)
+
+const (
+	defaultRetryPollInterval = 10 * time.Second
+	defaultRetryBatchSize    = 50
+	defaultRetryLease        = 5 * time.Minute
+	defaultRetention         = 7 * 24 * time.Hour
+	retentionPruneInterval   = time.Hour
+)
+
+// RetryWorker polls the database for push deliveries marked for retry
+// and sends them again with the DeliveryLog.
+//
+// A delivery claimed by the worker is locked for the lease duration. If
+// the server stops before the delivery is attempted, the delivery is
+// retried again after the lease expires.
+//
+// Deliveries not retrying are removed after the retention period, at
+// most once an hour.
+type RetryWorker struct {
+	DeliveryLog  *DeliveryLog
+	PollInterval time.Duration
+	BatchSize    int
+	Lease        time.Duration
+	Retention    time.Duration
+	stop         chan struct{}
+	stopOnce     sync.Once
+	lastPruned   time.Time
+}
+
+// NewRetryWorker returns a RetryWorker retrying the deliveries of the
+// DeliveryLog.
+func NewRetryWorker(deliveryLog *DeliveryLog) *RetryWorker {
+	return &RetryWorker{
+		DeliveryLog: deliveryLog,
+		stop:        make(chan struct{}),
+	}
+}
+
+// Run polls for deliveries due until the worker is stopped.
+func (w *RetryWorker) Run() {
+	pollInterval := w.PollInterval
+	if pollInterval <= 0 {
+		pollInterval = defaultRetryPollInterval
+	}
+
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			w.retryDueDeliveries()
+			w.pruneDeliveries()
+		case <-w.stop:
+			log.Infoln("push: stopping the retry worker")
+			return
+		}
+	}
+}
+
+// Stop stops the worker. Run returns immediately if the worker is
+// stopped before it runs.
+func (w *RetryWorker) Stop() {
+	w.stopOnce.Do(func() {
+		close(w.stop)
+	})
+}
+
+// pruneDeliveries removes deliveries older than the retention period,
+// at most once per retentionPruneInterval.
+func (w *RetryWorker) pruneDeliveries() {
+	now := timeNow()
+	if now.Sub(w.lastPruned) < retentionPruneInterval {
+		return
+	}
+	w.lastPruned = now
+
+	retention := w.Retention
+	if retention <= 0 {
+		retention = defaultRetention
+	}
+
+	conn, err := w.DeliveryLog.ConnOpener()
+	if err != nil {
+		log.WithField("error", err).Errorln("push: failed to open skydb.Conn")
+		return
+	}
+	defer conn.Close()
+
+	count, err := conn.DeletePushDeliveries(now.Add(-retention))
+	if err != nil {
+		log.WithField("error", err).Errorln("push: failed to delete push deliveries")
+		return
+	}
+	if count > 0 {
+		log.Infof("push: deleted %d push deliveries older than %v", count, retention)
+	}
+}
+
+// retryDueDeliveries claims and retries deliveries due until no more
+// deliveries are due.
+func (w *RetryWorker) retryDueDeliveries() {
+	batchSize := w.BatchSize
+	if batchSize <= 0 {
+		batchSize = defaultRetryBatchSize
+	}
+	lease := w.Lease
+	if lease <= 0 {
+		lease = defaultRetryLease
+	}
+
+	conn, err := w.DeliveryLog.ConnOpener()
+	if err != nil {
+		log.WithField("error", err).Errorln("push: failed to open skydb.Conn")
+		return
+	}
+	defer conn.Close()
+
+	for {
+		now := timeNow()
+		var deliveries []skydb.PushDelivery
+		deliveries, err = conn.ClaimRetryPushDeliveries(now, now.Add(lease), batchSize)
+		if err != nil {
+			log.WithField("error", err).Errorln("push: failed to claim push deliveries")
+			return
+		}
+
+		for _, delivery := range deliveries {
+			w.retry(conn, delivery)
+		}
+
+		if len(deliveries) < batchSize {
+			return
+		}
+	}
+}
+
+func (w *RetryWorker) retry(conn skydb.Conn, delivery skydb.PushDelivery) {
+	logger := log.WithFields(logrus.Fields{
+		"id":       delivery.ID,
+		"pushID":   delivery.PushID,
+		"deviceID": delivery.DeviceID,
+		"attempt":  delivery.Attempts + 1,
+	})
+
+	device := skydb.Device{}
+	if err := conn.GetDevice(delivery.DeviceID, &device); err == skydb.ErrDeviceNotFound {
+		// the device is unregistered after the first attempt
+		delivery.Status = skydb.PushDeliveryFailed
+		delivery.Response = err.Error()
+		delivery.NextAttemptAt = time.Time{}
+		delivery.UpdatedAt = timeNow().UTC()
+		if updateErr := conn.UpdatePushDelivery(&delivery); updateErr != nil {
+			logger.WithField("error", updateErr).Errorln("push: failed to update push delivery")
+		}
+		return
+	} else if err != nil {
+		// the delivery is retried after the lease expires
+		logger.WithField("error", err).Errorln("push: failed to get device of push delivery")
+		return
+	}
+
+	err := w.DeliveryLog.attempt(conn, &delivery, MapMapper(delivery.Payload), device)
+	if err != nil {
+		logger.WithField("error", err).Warnln("push: failed to retry push delivery")
+	} else {
+		logger.Debugln("push: retried push delivery")
+	}
+}
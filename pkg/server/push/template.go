@@ -0,0 +1,198 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package push
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"text/template"
+
+	"github.com/skygeario/skygear-server/pkg/server/skydb"
+)
+
+// ValidateTemplate checks whether all the templates in the content of
+// the PushTemplate can be parsed.
+func ValidateTemplate(t skydb.PushTemplate) error {
+	if _, ok := t.Locales[t.DefaultLocale]; !ok {
+		return fmt.Errorf("push template has no content in default locale %s", t.DefaultLocale)
+	}
+
+	for locale, content := range t.Locales {
+		r := templateRenderer{parseOnly: true}
+		r.render(content.Title)
+		r.render(content.Body)
+		r.renderValue(content.Data)
+		r.renderValue(content.APNS)
+		r.renderValue(content.FCM)
+		r.renderValue(content.Baidu)
+		r.renderValue(content.Web)
+		if r.err != nil {
+			return fmt.Errorf("push template in locale %s: %v", locale, r.err)
+		}
+	}
+	return nil
+}
+
+// RenderTemplate renders the content of a PushTemplate with data into a
+// MapMapper, which contains the payload for APNS, FCM, Baidu and Web Push.
+//
+// An error is returned if a template refers to a key not found in data.
+func RenderTemplate(content skydb.PushTemplateContent, data map[string]interface{}) (MapMapper, error) {
+	r := templateRenderer{data: data}
+	title := r.render(content.Title)
+	body := r.render(content.Body)
+	customData, _ := r.renderValue(content.Data).(map[string]interface{})
+	apnsOverride, _ := r.renderValue(content.APNS).(map[string]interface{})
+	fcmOverride, _ := r.renderValue(content.FCM).(map[string]interface{})
+	baiduOverride, _ := r.renderValue(content.Baidu).(map[string]interface{})
+	webOverride, _ := r.renderValue(content.Web).(map[string]interface{})
+	if r.err != nil {
+		return nil, r.err
+	}
+
+	alert := map[string]interface{}{"body": body}
+	if title != "" {
+		alert["title"] = title
+	}
+	aps := map[string]interface{}{"alert": alert}
+	if content.Sound != "" {
+		aps["sound"] = content.Sound
+	}
+	if content.Badge != nil {
+		aps["badge"] = *content.Badge
+	}
+	apnsMap := map[string]interface{}{"aps": aps}
+	for key, value := range customData {
+		apnsMap[key] = value
+	}
+
+	notification := map[string]interface{}{
+		"title": title,
+		"body":  body,
+	}
+	if content.Sound != "" {
+		notification["sound"] = content.Sound
+	}
+	fcmMap := map[string]interface{}{"notification": notification}
+	if len(customData) > 0 {
+		// FCM only accepts string values in data
+		fcmData := map[string]interface{}{}
+		for key, value := range customData {
+			if s, ok := value.(string); ok {
+				fcmData[key] = s
+				continue
+			}
+			encoded, err := json.Marshal(value)
+			if err != nil {
+				return nil, err
+			}
+			fcmData[key] = string(encoded)
+		}
+		fcmMap["data"] = fcmData
+	}
+
+	msg := map[string]interface{}{
+		"title":       title,
+		"description": body,
+	}
+	if len(customData) > 0 {
+		msg["custom_content"] = customData
+	}
+	baiduMap := map[string]interface{}{"msg": msg}
+
+	// the web payload is passed to showNotification() by the service worker
+	webMap := map[string]interface{}{
+		"title": title,
+		"body":  body,
+	}
+	if len(customData) > 0 {
+		webMap["data"] = customData
+	}
+
+	return MapMapper{
+		"apns":          mergeMap(apnsMap, apnsOverride),
+		"fcm":           mergeMap(fcmMap, fcmOverride),
+		"baidu-android": mergeMap(baiduMap, baiduOverride),
+		"web":           mergeMap(webMap, webOverride),
+	}, nil
+}
+
+// mergeMap copies the keys of src into dst, replacing the existing values
+// except maps, which are merged recursively.
+func mergeMap(dst, src map[string]interface{}) map[string]interface{} {
+	for key, value := range src {
+		srcMap, srcIsMap := value.(map[string]interface{})
+		dstMap, dstIsMap := dst[key].(map[string]interface{})
+		if srcIsMap && dstIsMap {
+			dst[key] = mergeMap(dstMap, srcMap)
+		} else {
+			dst[key] = value
+		}
+	}
+	return dst
+}
+
+type templateRenderer struct {
+	data      map[string]interface{}
+	parseOnly bool
+	err       error
+}
+
+func (r *templateRenderer) render(text string) string {
+	if r.err != nil || text == "" {
+		return text
+	}
+
+	t, err := template.New("").Option("missingkey=error").Parse(text)
+	if err != nil {
+		r.err = err
+		return ""
+	}
+	if r.parseOnly {
+		return text
+	}
+
+	var buf bytes.Buffer
+	if execErr := t.Execute(&buf, r.data); execErr != nil {
+		r.err = execErr
+		return ""
+	}
+	return buf.String()
+}
+
+func (r *templateRenderer) renderValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case string:
+		return r.render(v)
+	case map[string]interface{}:
+		if v == nil {
+			return v
+		}
+		rendered := map[string]interface{}{}
+		for key, elem := range v {
+			rendered[key] = r.renderValue(elem)
+		}
+		return rendered
+	case []interface{}:
+		rendered := make([]interface{}, len(v))
+		for i, elem := range v {
+			rendered[i] = r.renderValue(elem)
+		}
+		return rendered
+	default:
+		return v
+	}
+}
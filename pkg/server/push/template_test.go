@@ -0,0 +1,149 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package push
+
+import (
+	"testing"
+
+	"github.com/skygeario/skygear-server/pkg/server/skydb"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/maddevsio/fcm.v1"
+)
+
+func TestRenderTemplate(t *testing.T) {
+	Convey("RenderTemplate", t, func() {
+		badge := 1
+		content := skydb.PushTemplateContent{
+			Title: "Hello {{.name}}",
+			Body:  "You have {{.count}} messages",
+			Sound: "default",
+			Badge: &badge,
+			Data: map[string]interface{}{
+				"url":   "app://inbox/{{.name}}",
+				"count": 2,
+			},
+		}
+		data := map[string]interface{}{
+			"name":  "Faseng",
+			"count": 2,
+		}
+
+		Convey("renders payload for all platforms", func() {
+			m, err := RenderTemplate(content, data)
+			So(err, ShouldBeNil)
+			So(m.Map(), ShouldResemble, map[string]interface{}{
+				"apns": map[string]interface{}{
+					"aps": map[string]interface{}{
+						"alert": map[string]interface{}{
+							"title": "Hello Faseng",
+							"body":  "You have 2 messages",
+						},
+						"sound": "default",
+						"badge": 1,
+					},
+					"url":   "app://inbox/Faseng",
+					"count": 2,
+				},
+				"fcm": map[string]interface{}{
+					"notification": map[string]interface{}{
+						"title": "Hello Faseng",
+						"body":  "You have 2 messages",
+						"sound": "default",
+					},
+					"data": map[string]interface{}{
+						"url":   "app://inbox/Faseng",
+						"count": "2",
+					},
+				},
+				"baidu-android": map[string]interface{}{
+					"msg": map[string]interface{}{
+						"title":       "Hello Faseng",
+						"description": "You have 2 messages",
+						"custom_content": map[string]interface{}{
+							"url":   "app://inbox/Faseng",
+							"count": 2,
+						},
+					},
+				},
+				"web": map[string]interface{}{
+					"title": "Hello Faseng",
+					"body":  "You have 2 messages",
+					"data": map[string]interface{}{
+						"url":   "app://inbox/Faseng",
+						"count": 2,
+					},
+				},
+			})
+		})
+
+		Convey("renders payload accepted by senders", func() {
+			m, err := RenderTemplate(content, data)
+			So(err, ShouldBeNil)
+
+			fcmMessage := fcm.Message{}
+			So(mapFCMMessage(m, &fcmMessage), ShouldBeNil)
+			So(fcmMessage.Notification.Title, ShouldEqual, "Hello Faseng")
+
+			baiduMessage := BaiduAndroidPushMessage{}
+			So(mapBaiduMessage(m, &baiduMessage), ShouldBeNil)
+			So(baiduMessage.Msg.Description, ShouldEqual, "You have 2 messages")
+		})
+
+		Convey("merges platform dictionaries", func() {
+			content.APNS = map[string]interface{}{
+				"aps": map[string]interface{}{
+					"category": "{{.name}}",
+				},
+			}
+			m, err := RenderTemplate(content, data)
+			So(err, ShouldBeNil)
+
+			aps := m["apns"].(map[string]interface{})["aps"].(map[string]interface{})
+			So(aps["category"], ShouldEqual, "Faseng")
+			So(aps["sound"], ShouldEqual, "default")
+		})
+
+		Convey("returns error for missing data", func() {
+			_, err := RenderTemplate(content, map[string]interface{}{})
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
+
+func TestValidateTemplate(t *testing.T) {
+	Convey("ValidateTemplate", t, func() {
+		template := skydb.PushTemplate{
+			Name:          "welcome",
+			DefaultLocale: "en",
+			Locales: map[string]skydb.PushTemplateContent{
+				"en": {Body: "Hello {{.name}}"},
+			},
+		}
+
+		Convey("accepts valid template", func() {
+			So(ValidateTemplate(template), ShouldBeNil)
+		})
+
+		Convey("rejects template without default locale", func() {
+			template.DefaultLocale = "zh"
+			So(ValidateTemplate(template), ShouldNotBeNil)
+		})
+
+		Convey("rejects template with syntax error", func() {
+			template.Locales["en"] = skydb.PushTemplateContent{Body: "Hello {{.name"}
+			So(ValidateTemplate(template), ShouldNotBeNil)
+		})
+	})
+}
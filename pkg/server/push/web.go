@@ -0,0 +1,456 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package push
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/sirupsen/logrus"
+	"github.com/skygeario/skygear-server/pkg/server/skydb"
+	"golang.org/x/crypto/hkdf"
+)
+
+const (
+	// defaultWebPushTTL is the default number of seconds the push
+	// service retains a notification for an offline browser.
+	defaultWebPushTTL = 4 * 7 * 24 * 60 * 60
+
+	// webPushRecordSize is the record size of the aes128gcm content
+	// coding. The payload is encrypted as a single record.
+	webPushRecordSize = 4096
+
+	// webPushMaxBodySize is the size of body every push service must
+	// accept, which includes the header of the content coding.
+	webPushMaxBodySize = 4096
+
+	// webPushHeaderSize is the size of the aes128gcm header with a P-256
+	// public key as the key id: salt (16), rs (4), idlen (1), keyid (65).
+	webPushHeaderSize = 86
+
+	vapidTokenLifetime = 12 * time.Hour
+)
+
+// lookupIPAddr resolves the host of subscription endpoints. It is a
+// variable for mocking in test cases.
+var lookupIPAddr = net.DefaultResolver.LookupIPAddr
+
+// dialContext connects to a resolved address of a push service. It is a
+// variable for mocking in test cases.
+var dialContext = (&net.Dialer{
+	Timeout:   30 * time.Second,
+	KeepAlive: 30 * time.Second,
+	DualStack: true,
+}).DialContext
+
+// privateNetworks are the networks push services are never in, which
+// are not covered by the methods of net.IP.
+var privateNetworks = []*net.IPNet{
+	mustParseCIDR("10.0.0.0/8"),
+	mustParseCIDR("172.16.0.0/12"),
+	mustParseCIDR("192.168.0.0/16"),
+	mustParseCIDR("100.64.0.0/10"),
+	mustParseCIDR("fc00::/7"),
+}
+
+func mustParseCIDR(s string) *net.IPNet {
+	_, ipNet, err := net.ParseCIDR(s)
+	if err != nil {
+		panic(err)
+	}
+	return ipNet
+}
+
+// isPublicIP returns whether the IP is a global unicast address not in
+// a private network.
+func isPublicIP(ip net.IP) bool {
+	if !ip.IsGlobalUnicast() {
+		return false
+	}
+	for _, ipNet := range privateNetworks {
+		if ipNet.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// WebPushSubscription is the push subscription of a browser. It is stored
+// as the device token of a web device, in the JSON format returned by
+// PushSubscription.toJSON() of the Push API.
+type WebPushSubscription struct {
+	Endpoint string `json:"endpoint"`
+	Keys     struct {
+		P256dh string `json:"p256dh"`
+		Auth   string `json:"auth"`
+	} `json:"keys"`
+
+	uaPublic   []byte
+	authSecret []byte
+}
+
+// ParseWebPushSubscription parses the device token of a web device.
+//
+// The endpoint must be an https URL. Endpoints on loopback or private
+// addresses are rejected, such that the server cannot be made to send
+// requests to internal services.
+func ParseWebPushSubscription(token string) (*WebPushSubscription, error) {
+	sub := WebPushSubscription{}
+	if err := json.Unmarshal([]byte(token), &sub); err != nil {
+		return nil, fmt.Errorf("push/web: invalid subscription: %v", err)
+	}
+
+	endpoint, err := url.Parse(sub.Endpoint)
+	if err != nil || endpoint.Scheme != "https" || endpoint.Hostname() == "" {
+		return nil, errors.New("push/web: invalid subscription endpoint")
+	}
+	host := strings.ToLower(strings.TrimSuffix(endpoint.Hostname(), "."))
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return nil, errors.New("push/web: subscription endpoint is not public")
+	}
+	if ip := net.ParseIP(host); ip != nil && !isPublicIP(ip) {
+		return nil, errors.New("push/web: subscription endpoint is not public")
+	}
+
+	sub.uaPublic, err = decodeBase64URL(sub.Keys.P256dh)
+	if err != nil {
+		return nil, errors.New("push/web: invalid subscription p256dh key")
+	}
+	if x, _ := elliptic.Unmarshal(elliptic.P256(), sub.uaPublic); x == nil {
+		return nil, errors.New("push/web: subscription p256dh key is not a P-256 public key")
+	}
+
+	sub.authSecret, err = decodeBase64URL(sub.Keys.Auth)
+	if err != nil || len(sub.authSecret) != 16 {
+		return nil, errors.New("push/web: invalid subscription auth secret")
+	}
+
+	return &sub, nil
+}
+
+// dialPublic connects to the address only if its host resolves to public
+// addresses. The connection is made to the checked address, such that the
+// host cannot be resolved again to an internal address in between.
+func dialPublic(ctx context.Context, network string, addr string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+
+	addrs, err := lookupIPAddr(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	if len(addrs) == 0 {
+		return nil, fmt.Errorf("push/web: no address for host %s", host)
+	}
+	for _, ipAddr := range addrs {
+		if !isPublicIP(ipAddr.IP) {
+			return nil, fmt.Errorf("push/web: subscription endpoint resolves to %v, which is not public", ipAddr.IP)
+		}
+	}
+
+	var conn net.Conn
+	for _, ipAddr := range addrs {
+		conn, err = dialContext(ctx, network, net.JoinHostPort(ipAddr.IP.String(), port))
+		if err == nil {
+			return conn, nil
+		}
+	}
+	return nil, err
+}
+
+// newWebPushClient returns a http client which connects to public
+// addresses only. Redirects are not followed, and proxies are not used
+// since the address of a proxy is not checked.
+func newWebPushClient() *http.Client {
+	return &http.Client{
+		Transport: &http.Transport{
+			DialContext:         dialPublic,
+			TLSHandshakeTimeout: 10 * time.Second,
+			IdleConnTimeout:     90 * time.Second,
+		},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+		Timeout: 30 * time.Second,
+	}
+}
+
+// decodeBase64URL decodes base64url with or without padding, which are
+// both used by browsers and push libraries.
+func decodeBase64URL(s string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+}
+
+// WebPusher sends push notifications to browsers with the Web Push
+// protocol (RFC 8030). The application server is identified to the push
+// services with VAPID (RFC 8292), and the payload is encrypted for the
+// subscription (RFC 8291).
+//
+// The payload is the JSON encoding of the "web" dictionary of the
+// notification. Devices of subscriptions reported as gone by the push
+// service are deleted.
+type WebPusher struct {
+	ConnOpener func() (skydb.Conn, error)
+	Client     *http.Client
+	// Subject is the contact of the application server, which is a
+	// mailto: or https: URL.
+	Subject string
+	// TTL is the number of seconds the push service retains a
+	// notification for an offline browser.
+	TTL int
+
+	privateKey *ecdsa.PrivateKey
+	publicKey  string
+}
+
+// NewWebPusher returns a WebPusher with the VAPID private key, which is
+// the base64url encoded P-256 private key as generated by web-push
+// libraries. The corresponding public key is the applicationServerKey
+// used by browsers to subscribe.
+func NewWebPusher(connOpener func() (skydb.Conn, error), subject string, privateKey string) (*WebPusher, error) {
+	if subject == "" {
+		return nil, errors.New("push/web: empty VAPID subject")
+	}
+
+	d, err := decodeBase64URL(privateKey)
+	if err != nil || len(d) != 32 {
+		return nil, errors.New("push/web: invalid VAPID private key")
+	}
+
+	curve := elliptic.P256()
+	key := &ecdsa.PrivateKey{D: new(big.Int).SetBytes(d)}
+	key.PublicKey.Curve = curve
+	key.PublicKey.X, key.PublicKey.Y = curve.ScalarBaseMult(d)
+
+	return &WebPusher{
+		ConnOpener: connOpener,
+		Client:     newWebPushClient(),
+		Subject:    subject,
+		TTL:        defaultWebPushTTL,
+		privateKey: key,
+		publicKey:  base64.RawURLEncoding.EncodeToString(elliptic.Marshal(curve, key.PublicKey.X, key.PublicKey.Y)),
+	}, nil
+}
+
+// PublicKey returns the base64url encoded VAPID public key.
+func (p *WebPusher) PublicKey() string {
+	return p.publicKey
+}
+
+// Send sends the dictionary represented by m to device.
+func (p *WebPusher) Send(m Mapper, device skydb.Device) error {
+	sub, err := ParseWebPushSubscription(device.Token)
+	if err != nil {
+		return err
+	}
+
+	webMap, ok := m.Map()["web"].(map[string]interface{})
+	if !ok {
+		return errors.New("push/web: payload has no web dictionary")
+	}
+	plaintext, err := json.Marshal(webMap)
+	if err != nil {
+		return err
+	}
+
+	body, err := encryptWebPushPayload(sub, plaintext)
+	if err != nil {
+		return err
+	}
+
+	authorization, err := p.vapidAuthorization(sub.Endpoint)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest("POST", sub.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", authorization)
+	req.Header.Set("Content-Encoding", "aes128gcm")
+	req.Header.Set("Content-Type", "application/octet-stream")
+	req.Header.Set("TTL", strconv.Itoa(p.TTL))
+
+	resp, err := p.Client.Do(req)
+	if err != nil {
+		log.Errorf("push/web: failed to send notification: %v", err)
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+
+	message, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 512))
+	err = fmt.Errorf("push/web: push service responded %d: %s", resp.StatusCode, strings.TrimSpace(string(message)))
+	if resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusGone {
+		p.unregisterDevice(device)
+	} else if isTransientStatus(resp.StatusCode) {
+		return &TransientError{Err: err}
+	}
+	return err
+}
+
+// vapidAuthorization returns the Authorization header of a request to the
+// push service of the endpoint.
+func (p *WebPusher) vapidAuthorization(endpoint string) (string, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return "", err
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodES256, jwt.MapClaims{
+		"aud": u.Scheme + "://" + u.Host,
+		"exp": timeNow().Add(vapidTokenLifetime).Unix(),
+		"sub": p.Subject,
+	})
+	signed, err := token.SignedString(p.privateKey)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("vapid t=%s, k=%s", signed, p.publicKey), nil
+}
+
+// unregisterDevice deletes the devices of a subscription which no longer
+// exists, like the devices of invalid tokens reported by APNS.
+func (p *WebPusher) unregisterDevice(device skydb.Device) {
+	logger := log.WithFields(logrus.Fields{
+		"deviceID": device.ID,
+	})
+
+	if p.ConnOpener == nil {
+		return
+	}
+	conn, err := p.ConnOpener()
+	if err != nil {
+		logger.Errorf("push/web: failed to open conn to delete device: %v", err)
+		return
+	}
+	defer conn.Close()
+
+	if deleteErr := conn.DeleteDevicesByToken(device.Token, skydb.ZeroTime); deleteErr != nil && deleteErr != skydb.ErrDeviceNotFound {
+		logger.Errorf("push/web: failed to delete device of gone subscription: %v", deleteErr)
+		return
+	}
+
+	logger.Info("Unregistered device of gone subscription from skydb")
+}
+
+// encryptWebPushPayload encrypts plaintext for the subscription with the
+// aes128gcm content coding (RFC 8188) as specified by RFC 8291.
+func encryptWebPushPayload(sub *WebPushSubscription, plaintext []byte) ([]byte, error) {
+	if webPushHeaderSize+len(plaintext)+1+16 > webPushMaxBodySize {
+		return nil, errors.New("push/web: payload too large")
+	}
+
+	asPrivate, _, _, err := elliptic.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	salt := make([]byte, 16)
+	if _, err = io.ReadFull(rand.Reader, salt); err != nil {
+		return nil, err
+	}
+
+	return encryptWebPushRecord(sub, plaintext, asPrivate, salt)
+}
+
+// encryptWebPushRecord encrypts plaintext with the application server
+// private key and salt supplied.
+func encryptWebPushRecord(sub *WebPushSubscription, plaintext []byte, asPrivate []byte, salt []byte) ([]byte, error) {
+	curve := elliptic.P256()
+	asX, asY := curve.ScalarBaseMult(asPrivate)
+	asPublic := elliptic.Marshal(curve, asX, asY)
+
+	uaX, uaY := elliptic.Unmarshal(curve, sub.uaPublic)
+	if uaX == nil {
+		return nil, errors.New("push/web: invalid subscription p256dh key")
+	}
+	sharedX, _ := curve.ScalarMult(uaX, uaY, asPrivate)
+	ecdhSecret := make([]byte, 32)
+	sharedBytes := sharedX.Bytes()
+	copy(ecdhSecret[32-len(sharedBytes):], sharedBytes)
+
+	keyInfo := append([]byte("WebPush: info\x00"), sub.uaPublic...)
+	keyInfo = append(keyInfo, asPublic...)
+	ikm, err := hkdfExpand(ecdhSecret, sub.authSecret, keyInfo, 32)
+	if err != nil {
+		return nil, err
+	}
+	cek, err := hkdfExpand(ikm, salt, []byte("Content-Encoding: aes128gcm\x00"), 16)
+	if err != nil {
+		return nil, err
+	}
+	nonce, err := hkdfExpand(ikm, salt, []byte("Content-Encoding: nonce\x00"), 12)
+	if err != nil {
+		return nil, err
+	}
+
+	block, err := aes.NewCipher(cek)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	header := make([]byte, 0, webPushHeaderSize)
+	header = append(header, salt...)
+	rs := make([]byte, 4)
+	binary.BigEndian.PutUint32(rs, webPushRecordSize)
+	header = append(header, rs...)
+	header = append(header, byte(len(asPublic)))
+	header = append(header, asPublic...)
+
+	// 0x02 is the delimiter of the last record, without padding
+	record := append(append([]byte{}, plaintext...), 0x02)
+	return gcm.Seal(header, nonce, record, nil), nil
+}
+
+func hkdfExpand(secret, salt, info []byte, length int) ([]byte, error) {
+	out := make([]byte, length)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, secret, salt, info), out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+var _ Sender = &WebPusher{}
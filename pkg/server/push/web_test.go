@@ -0,0 +1,306 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package push
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/skygeario/skygear-server/pkg/server/skydb"
+	"github.com/skygeario/skygear-server/pkg/server/skydb/skydbtest"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// keys and auth secret from RFC 8291 Appendix A
+const (
+	testUAPrivateKey = "q1dXpw3UpT5VOmu_cf_v6ih07Aems3njxI-JWgLcM94"
+	testUAPublicKey  = "BCVxsr7N_eNgVRqvHtD0zTZsEc6-VV-JvLexhqUzORcxaOzi6-AYWXvTBHm4bjyPjs7Vd8pZGH6SRpkNtoIAiw4"
+	testAuthSecret   = "BTBZMqHH6r4Tts7J_aSIgg"
+)
+
+func testSubscriptionToken(endpoint string) string {
+	return `{"endpoint":"` + endpoint + `","keys":{"p256dh":"` + testUAPublicKey + `","auth":"` + testAuthSecret + `"}}`
+}
+
+// decryptWebPushPayload decrypts body as the user agent of the test
+// subscription.
+func decryptWebPushPayload(body []byte) []byte {
+	curve := elliptic.P256()
+	uaPrivate, _ := decodeBase64URL(testUAPrivateKey)
+	sub, _ := ParseWebPushSubscription(testSubscriptionToken("https://push.example.com"))
+
+	salt := body[:16]
+	asPublic := body[21:86]
+	asX, asY := elliptic.Unmarshal(curve, asPublic)
+	sharedX, _ := curve.ScalarMult(asX, asY, uaPrivate)
+	ecdhSecret := make([]byte, 32)
+	sharedBytes := sharedX.Bytes()
+	copy(ecdhSecret[32-len(sharedBytes):], sharedBytes)
+
+	keyInfo := append([]byte("WebPush: info\x00"), sub.uaPublic...)
+	keyInfo = append(keyInfo, asPublic...)
+	ikm, _ := hkdfExpand(ecdhSecret, sub.authSecret, keyInfo, 32)
+	cek, _ := hkdfExpand(ikm, salt, []byte("Content-Encoding: aes128gcm\x00"), 16)
+	nonce, _ := hkdfExpand(ikm, salt, []byte("Content-Encoding: nonce\x00"), 12)
+
+	block, _ := aes.NewCipher(cek)
+	gcm, _ := cipher.NewGCM(block)
+	record, err := gcm.Open(nil, nonce, body[86:], nil)
+	if err != nil {
+		return nil
+	}
+	return record[:len(record)-1]
+}
+
+type deleteTokenConn struct {
+	*skydbtest.MapConn
+	deletedTokens []string
+}
+
+func (conn *deleteTokenConn) DeleteDevicesByToken(token string, t time.Time) error {
+	conn.deletedTokens = append(conn.deletedTokens, token)
+	return nil
+}
+
+func TestParseWebPushSubscription(t *testing.T) {
+	Convey("ParseWebPushSubscription", t, func() {
+		Convey("parses subscription", func() {
+			sub, err := ParseWebPushSubscription(testSubscriptionToken("https://push.example.com/send/abc"))
+			So(err, ShouldBeNil)
+			So(sub.Endpoint, ShouldEqual, "https://push.example.com/send/abc")
+			So(len(sub.uaPublic), ShouldEqual, 65)
+			So(len(sub.authSecret), ShouldEqual, 16)
+		})
+
+		Convey("parses keys with padding", func() {
+			token := strings.Replace(testSubscriptionToken("https://push.example.com"), testAuthSecret, testAuthSecret+"==", 1)
+			_, err := ParseWebPushSubscription(token)
+			So(err, ShouldBeNil)
+		})
+
+		Convey("rejects invalid subscriptions", func() {
+			_, err := ParseWebPushSubscription("token")
+			So(err, ShouldNotBeNil)
+			_, err = ParseWebPushSubscription(testSubscriptionToken("push.example.com"))
+			So(err, ShouldNotBeNil)
+			_, err = ParseWebPushSubscription(`{"endpoint":"https://push.example.com","keys":{"p256dh":"BCVx","auth":"` + testAuthSecret + `"}}`)
+			So(err, ShouldNotBeNil)
+			_, err = ParseWebPushSubscription(`{"endpoint":"https://push.example.com","keys":{"p256dh":"` + testUAPublicKey + `"}}`)
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("rejects endpoints not https or not public", func() {
+			for _, endpoint := range []string{
+				"http://push.example.com",
+				"https://localhost/send",
+				"https://LOCALHOST./send",
+				"https://internal.localhost",
+				"https://127.0.0.1/send",
+				"https://10.1.2.3/send",
+				"https://172.16.0.1/send",
+				"https://192.168.1.1/send",
+				"https://169.254.169.254/latest/meta-data",
+				"https://0.0.0.0/send",
+				"https://[::1]/send",
+				"https://[fd00::1]/send",
+			} {
+				_, err := ParseWebPushSubscription(testSubscriptionToken(endpoint))
+				So(err, ShouldNotBeNil)
+			}
+
+			_, err := ParseWebPushSubscription(testSubscriptionToken("https://93.184.216.34/send"))
+			So(err, ShouldBeNil)
+		})
+	})
+}
+
+func TestEncryptWebPushPayload(t *testing.T) {
+	Convey("encryptWebPushPayload", t, func() {
+		sub, _ := ParseWebPushSubscription(testSubscriptionToken("https://push.example.com"))
+
+		Convey("encrypts as the example of RFC 8291", func() {
+			asPrivate, _ := decodeBase64URL("yfWPiYE-n46HLnH0KqZOF1fJJU3MYrct3AELtAQ-oRw")
+			salt, _ := decodeBase64URL("DGv6ra1nlYgDCS1FRnbzlw")
+			body, err := encryptWebPushRecord(sub, []byte("When I grow up, I want to be a watermelon"), asPrivate, salt)
+			So(err, ShouldBeNil)
+			So(base64.RawURLEncoding.EncodeToString(body), ShouldEqual,
+				"DGv6ra1nlYgDCS1FRnbzlwAAEABBBP4z9KsN6nGRTbVYI_c7VJSPQTBtkgcy27mlmlMoZIIgDll6e3vCYLocInmYWAmS6TlzAC8wEqKK6PBru3jl7A_yl95bQpu6cVPTpK4Mqgkf1CXztLVBSt2Ks3oZwbuwXPXLWyouBWLVWGNWQexSgSxsj_Qulcy4a-fN")
+		})
+
+		Convey("encrypts with new key and salt", func() {
+			body1, err := encryptWebPushPayload(sub, []byte("hello"))
+			So(err, ShouldBeNil)
+			body2, _ := encryptWebPushPayload(sub, []byte("hello"))
+			So(body1, ShouldNotResemble, body2)
+			So(string(decryptWebPushPayload(body1)), ShouldEqual, "hello")
+		})
+
+		Convey("rejects payload too large", func() {
+			_, err := encryptWebPushPayload(sub, make([]byte, 3993))
+			So(err, ShouldBeNil)
+			_, err = encryptWebPushPayload(sub, make([]byte, 3994))
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
+
+func TestWebPusher(t *testing.T) {
+	Convey("WebPusher", t, func() {
+		realTime := timeNow
+		timeNow = func() time.Time { return time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC) }
+		defer func() {
+			timeNow = realTime
+		}()
+
+		key, _, _, _ := elliptic.GenerateKey(elliptic.P256(), rand.Reader)
+		conn := &deleteTokenConn{MapConn: skydbtest.NewMapConn()}
+		pusher, err := NewWebPusher(func() (skydb.Conn, error) {
+			return conn, nil
+		}, "mailto:admin@example.com", base64.RawURLEncoding.EncodeToString(key))
+		So(err, ShouldBeNil)
+
+		var req *http.Request
+		var body []byte
+		requests := 0
+		status := http.StatusCreated
+		server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			req = r
+			body, _ = ioutil.ReadAll(r.Body)
+			requests++
+			if status == http.StatusFound {
+				w.Header().Set("Location", "https://example.com/internal")
+			}
+			w.WriteHeader(status)
+		}))
+		defer server.Close()
+
+		// the push service at example.com is served by the test server
+		resolved := "93.184.216.34"
+		realLookupIPAddr := lookupIPAddr
+		lookupIPAddr = func(ctx context.Context, host string) ([]net.IPAddr, error) {
+			return []net.IPAddr{{IP: net.ParseIP(resolved)}}, nil
+		}
+		defer func() {
+			lookupIPAddr = realLookupIPAddr
+		}()
+		var dialed []string
+		realDialContext := dialContext
+		dialContext = func(ctx context.Context, network string, addr string) (net.Conn, error) {
+			dialed = append(dialed, addr)
+			return net.Dial(network, server.Listener.Addr().String())
+		}
+		defer func() {
+			dialContext = realDialContext
+		}()
+		transport := pusher.Client.Transport.(*http.Transport)
+		transport.TLSClientConfig = server.Client().Transport.(*http.Transport).TLSClientConfig
+
+		device := skydb.Device{
+			ID:    "device",
+			Type:  "web",
+			Token: testSubscriptionToken("https://example.com/send/abc"),
+		}
+		m := MapMapper{
+			"web": map[string]interface{}{
+				"title": "Hello",
+				"body":  "World",
+			},
+		}
+
+		Convey("sends encrypted payload with VAPID", func() {
+			So(pusher.Send(m, device), ShouldBeNil)
+			So(dialed, ShouldResemble, []string{"93.184.216.34:443"})
+			So(req.URL.Path, ShouldEqual, "/send/abc")
+			So(req.Header.Get("Content-Encoding"), ShouldEqual, "aes128gcm")
+			So(req.Header.Get("TTL"), ShouldEqual, "2419200")
+
+			var payload map[string]interface{}
+			So(json.Unmarshal(decryptWebPushPayload(body), &payload), ShouldBeNil)
+			So(payload, ShouldResemble, map[string]interface{}{
+				"title": "Hello",
+				"body":  "World",
+			})
+
+			authorization := req.Header.Get("Authorization")
+			So(authorization, ShouldStartWith, "vapid t=")
+			So(authorization, ShouldEndWith, ", k="+pusher.PublicKey())
+			tokenString := strings.TrimSuffix(strings.TrimPrefix(authorization, "vapid t="), ", k="+pusher.PublicKey())
+			claims := jwt.MapClaims{}
+			parser := jwt.Parser{SkipClaimsValidation: true}
+			token, err := parser.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+				return &pusher.privateKey.PublicKey, nil
+			})
+			So(err, ShouldBeNil)
+			So(token.Method, ShouldEqual, jwt.SigningMethodES256)
+			So(claims["aud"], ShouldEqual, "https://example.com")
+			So(claims["sub"], ShouldEqual, "mailto:admin@example.com")
+			So(claims["exp"], ShouldEqual, float64(time.Date(2017, 1, 1, 12, 0, 0, 0, time.UTC).Unix()))
+		})
+
+		Convey("deletes device of gone subscription", func() {
+			status = http.StatusGone
+			err := pusher.Send(m, device)
+			So(err, ShouldNotBeNil)
+			So(IsTransientError(err), ShouldBeFalse)
+			So(conn.deletedTokens, ShouldResemble, []string{device.Token})
+		})
+
+		Convey("returns transient error for unavailable push service", func() {
+			status = http.StatusServiceUnavailable
+			err := pusher.Send(m, device)
+			So(IsTransientError(err), ShouldBeTrue)
+			So(conn.deletedTokens, ShouldBeEmpty)
+		})
+
+		Convey("rejects endpoint resolving to private address", func() {
+			resolved = "10.0.0.1"
+			err := pusher.Send(m, device)
+			So(err, ShouldNotBeNil)
+			So(dialed, ShouldBeEmpty)
+			So(req, ShouldBeNil)
+		})
+
+		Convey("does not follow redirect of push service", func() {
+			status = http.StatusFound
+			err := pusher.Send(m, device)
+			So(err, ShouldNotBeNil)
+			So(requests, ShouldEqual, 1)
+		})
+
+		Convey("rejects payload without web dictionary", func() {
+			err := pusher.Send(MapMapper{"apns": map[string]interface{}{}}, device)
+			So(err, ShouldNotBeNil)
+			So(req, ShouldBeNil)
+		})
+
+		Convey("rejects invalid private key", func() {
+			_, err := NewWebPusher(nil, "mailto:admin@example.com", "key")
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
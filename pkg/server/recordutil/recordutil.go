@@ -16,11 +16,17 @@ import (
 	"github.com/skygeario/skygear-server/pkg/server/skyerr"
 )
 
-func injectSigner(record *skydb.Record, store asset.Store) {
+// injectSigner injects the URL signer of the store to the assets of the
+// record, signing URLs for the user if record ACL is required
+func injectSigner(record *skydb.Record, store asset.Store, authInfo *skydb.AuthInfo) {
+	userID := ""
+	if authInfo != nil {
+		userID = authInfo.ID
+	}
 	for _, value := range record.Data {
 		switch v := value.(type) {
 		case *skydb.Asset:
-			if signer, ok := store.(asset.URLSigner); ok {
+			if signer, ok := asset.SignerForUser(store, userID); ok {
 				v.Signer = signer
 			} else {
 				logrus.Warnf("Failed to acquire asset URLSigner, please check configuration")
@@ -80,7 +86,8 @@ type RecordModifyRequest struct {
 	ModifyAt      time.Time
 
 	// Save only
-	RecordsToSave []*skydb.Record
+	RecordsToSave     []*skydb.Record
+	AssetUploadPolicy *asset.UploadPolicy
 
 	// Delete Only
 	RecordIDsToDelete []skydb.RecordID
@@ -261,7 +268,7 @@ func RecordSaveHandler(req *RecordModifyRequest, resp *RecordModifyResponse) sky
 
 		if !created {
 			origRecord := dbRecord.Copy()
-			injectSigner(&origRecord, req.AssetStore)
+			injectSigner(&origRecord, req.AssetStore, req.AuthInfo)
 			originalRecordMap[origRecord.ID] = &origRecord
 		}
 
@@ -282,7 +289,14 @@ func RecordSaveHandler(req *RecordModifyRequest, resp *RecordModifyResponse) sky
 		return nil
 	})
 
-	makeAssetsCompleteAndInjectSigner(db, req.Conn, records, req.AssetStore)
+	makeAssetsCompleteAndInjectSigner(db, req.Conn, records, req.AssetStore, req.AuthInfo)
+
+	// check assets newly saved to fields against the upload policy
+	if req.AssetUploadPolicy != nil {
+		records = executeRecordFunc(records, resp.ErrMap, func(record *skydb.Record) skyerr.Error {
+			return validateRecordAssets(req.Conn, req.AssetUploadPolicy, originalRecordMap[record.ID], record)
+		})
+	}
 
 	// execute before save hooks
 	if req.HookRegistry != nil {
@@ -313,7 +327,7 @@ func RecordSaveHandler(req *RecordModifyRequest, resp *RecordModifyResponse) sky
 		return skyerr.NewError(skyerr.UnexpectedError, "atomic operation failed")
 	}
 
-	makeAssetsCompleteAndInjectSigner(db, req.Conn, records, req.AssetStore)
+	makeAssetsCompleteAndInjectSigner(db, req.Conn, records, req.AssetStore, req.AuthInfo)
 
 	// execute after save hooks
 	if req.HookRegistry != nil {
@@ -626,6 +640,66 @@ func DoQueryEager(ctx context.Context, db skydb.Database, eagersIDs map[string][
 	return eagerRecords
 }
 
+// ExecuteFetchHooks executes afterFetch hooks registered for the record
+// types of the supplied records. Records of the same type are passed to
+// the hooks together.
+//
+// The returned records are ordered by record type in the order they first
+// appear in the supplied records. Records dropped by hooks are not returned.
+func ExecuteFetchHooks(ctx context.Context, hookRegistry *hook.Registry, records []*skydb.Record) ([]*skydb.Record, skyerr.Error) {
+	if hookRegistry == nil || len(records) == 0 {
+		return records, nil
+	}
+
+	recordTypes := []string{}
+	recordsByType := map[string][]*skydb.Record{}
+	for _, record := range records {
+		recordType := record.ID.Type
+		if _, ok := recordsByType[recordType]; !ok {
+			recordTypes = append(recordTypes, recordType)
+		}
+		recordsByType[recordType] = append(recordsByType[recordType], record)
+	}
+
+	result := make([]*skydb.Record, 0, len(records))
+	for _, recordType := range recordTypes {
+		recordsOut, err := hookRegistry.ExecuteFetchHooks(ctx, recordType, recordsByType[recordType])
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, recordsOut...)
+	}
+	return result, nil
+}
+
+// ExecuteEagerFetchHooks executes afterFetch hooks on records eager loaded
+// by DoQueryEager, such that eager loaded records are transformed in the
+// same way as records being queried.
+func ExecuteEagerFetchHooks(ctx context.Context, hookRegistry *hook.Registry, eagerRecords map[string]map[string]*skydb.Record) (map[string]map[string]*skydb.Record, skyerr.Error) {
+	if hookRegistry == nil {
+		return eagerRecords, nil
+	}
+
+	result := map[string]map[string]*skydb.Record{}
+	for keyPath, recordMap := range eagerRecords {
+		records := make([]*skydb.Record, 0, len(recordMap))
+		for _, record := range recordMap {
+			records = append(records, record)
+		}
+
+		recordsOut, err := ExecuteFetchHooks(ctx, hookRegistry, records)
+		if err != nil {
+			return nil, err
+		}
+
+		result[keyPath] = map[string]*skydb.Record{}
+		for _, record := range recordsOut {
+			result[keyPath][record.ID.Key] = record
+		}
+	}
+	return result, nil
+}
+
 func getRecordCount(db skydb.Database, query *skydb.Query, accessControlOptions *skydb.AccessControlOptions, results *skydb.Rows) (uint64, error) {
 	if results != nil {
 		recordCount := results.OverallRecordCount()
@@ -702,7 +776,7 @@ func MakeAssetsComplete(db skydb.Database, conn skydb.Conn, records []skydb.Reco
 	return nil
 }
 
-func makeAssetsCompleteAndInjectSigner(db skydb.Database, conn skydb.Conn, records []*skydb.Record, store asset.Store) error {
+func makeAssetsCompleteAndInjectSigner(db skydb.Database, conn skydb.Conn, records []*skydb.Record, store asset.Store, authInfo *skydb.AuthInfo) error {
 	recordArr := []skydb.Record{}
 	for _, v := range records {
 		recordArr = append(recordArr, *v)
@@ -712,11 +786,58 @@ func makeAssetsCompleteAndInjectSigner(db skydb.Database, conn skydb.Conn, recor
 		return err
 	}
 	for _, record := range records {
-		injectSigner(record, store)
+		injectSigner(record, store, authInfo)
 	}
 	return nil
 }
 
+func validateRecordAssets(conn skydb.Conn, policy *asset.UploadPolicy, origRecord *skydb.Record, record *skydb.Record) skyerr.Error {
+	for field, value := range record.Data {
+		thisAsset, ok := value.(*skydb.Asset)
+		if !ok || thisAsset.Name == "" {
+			continue
+		}
+		if origRecord != nil {
+			if origAsset, ok := origRecord.Get(field).(*skydb.Asset); ok && origAsset.Name == thisAsset.Name {
+				continue
+			}
+		}
+
+		// the content type and size of the asset sent by the client are
+		// not trusted, the stored asset is validated instead
+		completeAsset := skydb.Asset{}
+		if err := conn.GetAsset(thisAsset.Name, &completeAsset); err != nil {
+			return skyerr.NewInvalidArgument(
+				fmt.Sprintf(`cannot find asset "%s"`, thisAsset.Name),
+				[]string{field},
+			)
+		}
+
+		if err := policy.ValidateField(record.ID.Type, field, completeAsset.ContentType, completeAsset.Size); err != nil {
+			return MakeUploadPolicyError(err)
+		}
+	}
+	return nil
+}
+
+// MakeUploadPolicyError converts an asset.UploadPolicyError to skyerr.Error
+func MakeUploadPolicyError(err error) skyerr.Error {
+	policyErr, ok := err.(asset.UploadPolicyError)
+	if !ok {
+		return skyerr.MakeError(err)
+	}
+
+	info := map[string]interface{}{}
+	if policyErr.Field != "" {
+		info["field"] = policyErr.Field
+	}
+	if policyErr.MaxSize > 0 {
+		info["max_size"] = policyErr.MaxSize
+		return skyerr.NewErrorWithInfo(skyerr.AssetSizeTooLarge, policyErr.Error(), info)
+	}
+	return skyerr.NewErrorWithInfo(skyerr.InvalidArgument, policyErr.Error(), info)
+}
+
 // RecordResultFilter is for processing Record into results.
 //
 // 1. Apply field-based acl, remove fields that are not accessible to the
@@ -762,7 +883,7 @@ func (f *RecordResultFilter) JSONResult(record *skydb.Record) *skyconv.JSONRecor
 	if !f.BypassAccessControl {
 		scrubRecordFieldsForRead(f.AuthInfo, &recordCopy, f.FieldACL)
 	}
-	injectSigner(record, f.AssetStore)
+	injectSigner(record, f.AssetStore, f.AuthInfo)
 	return (*skyconv.JSONRecord)(&recordCopy)
 }
 
@@ -51,6 +51,7 @@ func defaultStatusCode(err skyerr.Error) int {
 		skyerr.NotConfigured:           http.StatusServiceUnavailable,
 		skyerr.UserDisabled:            http.StatusForbidden,
 		skyerr.VerificationRequired:    http.StatusForbidden,
+		skyerr.AssetSizeTooLarge:       http.StatusRequestEntityTooLarge,
 	}[err.Code()]
 	if !ok {
 		if err.Code() < 10000 {
@@ -18,6 +18,7 @@ import (
 	"errors"
 	"net/http"
 	"regexp"
+	"sync"
 
 	"github.com/skygeario/skygear-server/pkg/server/logging"
 )
@@ -36,6 +37,7 @@ type Gateway struct {
 	ParamMatch  *regexp.Regexp
 	methodPaths map[string]pathRoute
 	Tag         string
+	mutex       sync.RWMutex
 }
 
 func NewGateway(pattern string, path string, tag string, mux *http.ServeMux) *Gateway {
@@ -74,17 +76,45 @@ func (g *Gateway) Handle(method string, handler Handler, preprocessors ...Proces
 	if len(preprocessors) == 0 {
 		preprocessors = handler.GetPreprocessors()
 	}
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
 	g.methodPaths[method] = pathRoute{
 		Preprocessors: preprocessors,
 		Handler:       handler,
 	}
 }
 
+// Unhandle removes the handler registered for the method.
+func (g *Gateway) Unhandle(method string) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	delete(g.methodPaths, method)
+}
+
+// Replace replaces all the handlers of the gateway with the handlers
+// keyed by method in one step.
+func (g *Gateway) Replace(handlers map[string]Handler) {
+	methodPaths := map[string]pathRoute{}
+	for method, handler := range handlers {
+		methodPaths[method] = pathRoute{
+			Preprocessors: handler.GetPreprocessors(),
+			Handler:       handler,
+		}
+	}
+
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	g.methodPaths = methodPaths
+}
+
 func (g *Gateway) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 	g.commonRouter.ServeHTTP(w, req)
 }
 
 func (g *Gateway) matchHandler(p *Payload) (routeConfig, error) {
+	g.mutex.RLock()
+	defer g.mutex.RUnlock()
+
 	method := p.Meta["method"].(string)
 	if pathRoute, ok := g.methodPaths[method]; ok {
 		return routeConfig{
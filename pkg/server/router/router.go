@@ -71,6 +71,52 @@ func (r *Router) Map(action, tag string, handler Handler, preprocessors ...Proce
 	}
 }
 
+// Unmap removes the handler mapped to the action
+func (r *Router) Unmap(action string) {
+	r.actions.Lock()
+	defer r.actions.Unlock()
+	delete(r.actions.m, action)
+}
+
+// Route is a handler mapped to an action, see Router.Replace.
+type Route struct {
+	Action        string
+	Tag           string
+	Handler       Handler
+	Preprocessors []Processor
+}
+
+// Replace unmaps the actions and maps the routes in one step, so that
+// a request is matched either before or after all the changes.
+func (r *Router) Replace(unmapped []string, routes []Route) {
+	pipelines := map[string]pipeline{}
+	for _, route := range routes {
+		preprocessors := route.Preprocessors
+		if len(preprocessors) == 0 {
+			preprocessors = route.Handler.GetPreprocessors()
+		}
+		pipelines[route.Action] = pipeline{
+			Tag:           route.Tag,
+			Preprocessors: preprocessors,
+			Handler:       route.Handler,
+		}
+	}
+
+	r.actions.Lock()
+	defer r.actions.Unlock()
+	m := make(map[string]pipeline, len(r.actions.m)+len(pipelines))
+	for action, pipeline := range r.actions.m {
+		m[action] = pipeline
+	}
+	for _, action := range unmapped {
+		delete(m, action)
+	}
+	for action, pipeline := range pipelines {
+		m[action] = pipeline
+	}
+	r.actions.m = m
+}
+
 func (r *Router) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 	r.commonRouter.ServeHTTP(w, req)
 }
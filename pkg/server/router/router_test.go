@@ -156,6 +156,78 @@ func TestRouterMapMissing(t *testing.T) {
 	}
 }
 
+func TestRouterUnmap(t *testing.T) {
+	Convey("Router", t, func() {
+		r := NewRouter()
+		r.Map("mock:map", "tag", &MockHandler{
+			outputs: Response{Result: "ok"},
+		})
+
+		Convey("returns route unmatched after unmap", func() {
+			r.Unmap("mock:map")
+
+			req, _ := http.NewRequest(
+				"POST",
+				"http://skygear.dev/",
+				strings.NewReader(`{"action": "mock:map"}`),
+			)
+			req.Header.Set("Content-Type", "application/json")
+			resp := httptest.NewRecorder()
+			r.ServeHTTP(resp, req)
+
+			So(resp.Body.Bytes(), ShouldEqualJSON, `{
+				"error": {
+					"name": "UndefinedOperation",
+					"code": 117,
+					"message": "route unmatched"
+				}
+			}`)
+		})
+
+		Convey("ignores unmapped action", func() {
+			So(func() {
+				r.Unmap("mock:missing")
+			}, ShouldNotPanic)
+		})
+	})
+}
+
+func TestRouterReplace(t *testing.T) {
+	Convey("Router", t, func() {
+		r := NewRouter()
+		r.Map("mock:removed", "tag", &MockHandler{
+			outputs: Response{Result: "removed"},
+		})
+		r.Map("mock:kept", "tag", &MockHandler{
+			outputs: Response{Result: "kept"},
+		})
+
+		call := func(action string) string {
+			req, _ := http.NewRequest(
+				"POST",
+				"http://skygear.dev/",
+				strings.NewReader(`{"action": "`+action+`"}`),
+			)
+			req.Header.Set("Content-Type", "application/json")
+			resp := httptest.NewRecorder()
+			r.ServeHTTP(resp, req)
+			return resp.Body.String()
+		}
+
+		Convey("unmaps and maps actions", func() {
+			r.Replace([]string{"mock:removed"}, []Route{{
+				Action:  "mock:added",
+				Tag:     "tag",
+				Handler: &MockHandler{outputs: Response{Result: "added"}},
+			}})
+
+			So(call("mock:removed"), ShouldContainSubstring, "route unmatched")
+			So(call("mock:kept"), ShouldEqualJSON, `{"result": "kept"}`)
+			So(call("mock:added"), ShouldEqualJSON, `{"result": "added"}`)
+		})
+	})
+}
+
 type getPreprocessor struct {
 	Status int
 	Err    skyerr.Error
@@ -109,10 +109,33 @@ func parseAuthRecordKeys(str string) ([][]string, error) {
 	return results, nil
 }
 
+// AssetFieldPolicyConfig is the upload policy of assets saved to a record
+// field
+type AssetFieldPolicyConfig struct {
+	// MaxSize is the maximum size in bytes, no limit if it is zero
+	MaxSize int64 `json:"max_size"`
+	// ContentTypes are the allowed content types, such as image/*
+	ContentTypes []string `json:"content_types"`
+}
+
 type PluginConfig struct {
 	Transport string
 	Path      string
 	Args      []string
+
+	// Timeout is the number of seconds a call to the plugin may take
+	// before it fails. No timeout is set if it is zero.
+	Timeout int
+	// MaxConcurrency is the maximum number of calls to the plugin in flight.
+	// Calls are not limited if it is zero.
+	MaxConcurrency int
+	// CircuitBreakerErrorRate is the ratio of failed calls (from 0 to 1)
+	// to open the circuit breaker, after which calls to the plugin fail fast
+	// for CircuitBreakerCooldown seconds. Circuit breaker is disabled if
+	// it is zero.
+	CircuitBreakerErrorRate   float64
+	CircuitBreakerMinRequests int
+	CircuitBreakerCooldown    int
 }
 
 // Configuration is Skygear's configuration
@@ -133,6 +156,7 @@ type Configuration struct {
 		DevMode         bool       `json:"dev_mode"`
 		CORSHost        string     `json:"cors_host"`
 		Slave           bool       `json:"slave"`
+		LeaderElection  bool       `json:"leader_election"`
 		ResponseTimeout int64      `json:"response_timeout"`
 	} `json:"app"`
 	DB struct {
@@ -150,8 +174,10 @@ type Configuration struct {
 		CustomTokenSecret string `json:"custom_token_secret"`
 	} `json:"auth"`
 	AssetStore struct {
-		ImplName string `json:"implementation"`
-		Public   bool   `json:"public"`
+		ImplName         string `json:"implementation"`
+		Public           bool   `json:"public"`
+		RecordACL        bool   `json:"record_acl"`
+		ContentAddressed bool   `json:"content_addressed"`
 
 		FileSystemStore struct {
 			Path      string `json:"-"`
@@ -160,11 +186,18 @@ type Configuration struct {
 		} `json:"fs"`
 
 		S3Store struct {
-			AccessToken string `json:"access_key"`
-			SecretToken string `json:"secret_key"`
-			Region      string `json:"region"`
-			Bucket      string `json:"bucket"`
-			URLPrefix   string `json:"url_prefix"`
+			AccessToken          string `json:"access_key"`
+			SecretToken          string `json:"secret_key"`
+			Region               string `json:"region"`
+			Bucket               string `json:"bucket"`
+			URLPrefix            string `json:"url_prefix"`
+			Endpoint             string `json:"endpoint"`
+			ForcePathStyle       bool   `json:"force_path_style"`
+			InsecureSkipVerify   bool   `json:"insecure_skip_verify"`
+			ServerSideEncryption string `json:"server_side_encryption"`
+			SSEKMSKeyID          string `json:"sse_kms_key_id"`
+			StorageClass         string `json:"storage_class"`
+			PresignUpload        bool   `json:"presign_upload"`
 		} `json:"s3"`
 
 		CloudStore struct {
@@ -174,6 +207,30 @@ type Configuration struct {
 			PrivatePrefix string `json:"private_prefix"`
 		} `json:"cloud"`
 	} `json:"asset_store"`
+	AssetGC struct {
+		Enable      bool   `json:"enable"`
+		Schedule    string `json:"schedule"`
+		GracePeriod int    `json:"grace_period"`
+	} `json:"asset_gc"`
+	AssetPolicy struct {
+		MaxSize          int64                              `json:"max_size"`
+		ContentTypes     []string                           `json:"content_types"`
+		SniffContentType bool                               `json:"sniff_content_type"`
+		StripEXIF        string                             `json:"strip_exif"`
+		Fields           map[string]*AssetFieldPolicyConfig `json:"fields"`
+	} `json:"asset_policy"`
+	AssetScanner struct {
+		ImplName string `json:"implementation"`
+
+		Clamd struct {
+			Address string `json:"address"`
+			Timeout int    `json:"timeout"`
+		} `json:"clamd"`
+
+		Plugin struct {
+			Lambda string `json:"lambda"`
+		} `json:"plugin"`
+	} `json:"asset_scanner"`
 	APNS struct {
 		Enable    bool   `json:"enable"`
 		Type      string `json:"type"`
@@ -211,6 +268,17 @@ type Configuration struct {
 		APIKey    string `json:"api_key"`
 		SecretKey string `json:"secret_key"`
 	} `json:"baidu"`
+	WebPush struct {
+		Enable     bool   `json:"enable"`
+		Subject    string `json:"subject"`
+		PrivateKey string `json:"-"`
+		TTL        int    `json:"ttl"`
+	} `json:"web_push"`
+	PushMock struct {
+		Enable       bool   `json:"enable"`
+		Failures     string `json:"failures"`
+		CaptureLimit int    `json:"capture_limit"`
+	} `json:"push_mock"`
 	LOG struct {
 		Level           string            `json:"-"`
 		LoggersLevel    map[string]string `json:"-"`
@@ -221,6 +289,22 @@ type Configuration struct {
 		SentryDSN   string
 		SentryLevel string
 	} `json:"-"`
+	PubSub struct {
+		Backend          string   `json:"backend"`
+		RedisURL         string   `json:"redis_url"`
+		History          string   `json:"history"`
+		HistorySize      int      `json:"history_size"`
+		HistoryTTL       int64    `json:"history_ttl"`
+		HistoryChannels  []string `json:"history_channels"`
+		UserSubscribe    string   `json:"user_subscribe"`
+		UserPublish      string   `json:"user_publish"`
+		RoleSubscribe    string   `json:"role_subscribe"`
+		RolePublish      string   `json:"role_publish"`
+		PublicSubscribe  string   `json:"public_subscribe"`
+		PublicPublish    string   `json:"public_publish"`
+		DefaultSubscribe string   `json:"default_subscribe"`
+		DefaultPublish   string   `json:"default_publish"`
+	} `json:"pubsub"`
 	Zmq struct {
 		Timeout   int `json:"timeout"`
 		MaxBounce int `json:"max_bounce"`
@@ -264,11 +348,22 @@ func NewConfiguration() Configuration {
 	config.AssetStore.ImplName = "fs"
 	config.AssetStore.FileSystemStore.Path = "data/asset"
 	config.AssetStore.FileSystemStore.URLPrefix = "http://localhost:3000/files"
+	config.AssetGC.Enable = false
+	config.AssetGC.Schedule = "@daily"
+	config.AssetGC.GracePeriod = 86400
+	config.AssetPolicy.StripEXIF = "gps"
+	config.AssetPolicy.Fields = map[string]*AssetFieldPolicyConfig{}
+	config.AssetScanner.Clamd.Address = "localhost:3310"
+	config.AssetScanner.Clamd.Timeout = 60
 	config.APNS.Enable = false
 	config.APNS.Type = "cert"
 	config.APNS.Env = "sandbox"
 	config.APNS.Keepalive = 180
 	config.Baidu.Enable = false
+	config.WebPush.Enable = false
+	config.WebPush.TTL = 2419200
+	config.PushMock.Enable = false
+	config.PushMock.CaptureLimit = 1000
 	config.FCM.Enable = false
 	config.FCM.Type = "server_key"
 	config.LOG.Level = "debug"
@@ -278,6 +373,17 @@ func NewConfiguration() Configuration {
 	config.LOG.RouterByteLimit = 100000
 	config.LOG.Formatter = "text"
 	config.LogHook.SentryLevel = "error"
+	config.PubSub.Backend = "memory"
+	config.PubSub.HistorySize = 100
+	config.PubSub.HistoryTTL = 3600
+	config.PubSub.UserSubscribe = "owner"
+	config.PubSub.UserPublish = "master"
+	config.PubSub.RoleSubscribe = "owner"
+	config.PubSub.RolePublish = "master"
+	config.PubSub.PublicSubscribe = "anyone"
+	config.PubSub.PublicPublish = "anyone"
+	config.PubSub.DefaultSubscribe = "anyone"
+	config.PubSub.DefaultPublish = "anyone"
 	config.Zmq.Timeout = 30
 	config.Zmq.MaxBounce = 10
 	config.Plugin = map[string]*PluginConfig{}
@@ -313,9 +419,91 @@ func (config *Configuration) Validate() error {
 	if config.APNS.Enable && !regexp.MustCompile("^(cert|token)$").MatchString(config.APNS.Type) {
 		return fmt.Errorf("APNS_TYPE must be cert or token")
 	}
+	if config.WebPush.Enable && (config.WebPush.Subject == "" || config.WebPush.PrivateKey == "") {
+		return fmt.Errorf("WEB_PUSH_SUBJECT and WEB_PUSH_PRIVATE_KEY are required to enable web push")
+	}
+	if !regexp.MustCompile("^(AES256|aws:kms)?$").MatchString(config.AssetStore.S3Store.ServerSideEncryption) {
+		return fmt.Errorf("ASSET_STORE_S3_SSE must be AES256 or aws:kms")
+	}
+	if config.AssetStore.RecordACL && config.AssetStore.ImplName != "fs" {
+		return fmt.Errorf("ASSET_STORE_RECORD_ACL requires ASSET_STORE to be fs")
+	}
+	if !regexp.MustCompile("^(none|gps|all)?$").MatchString(config.AssetPolicy.StripEXIF) {
+		return fmt.Errorf("ASSET_STRIP_EXIF must be none, gps or all")
+	}
+	// files uploaded to s3 with presigned requests are not read by the
+	// server, so their metadata cannot be stripped
+	if config.AssetStore.ImplName == "s3" && config.AssetStore.S3Store.PresignUpload &&
+		config.AssetPolicy.StripEXIF != "none" {
+		return fmt.Errorf("ASSET_STORE_S3_PRESIGN_UPLOAD requires ASSET_STRIP_EXIF to be none")
+	}
+	if !regexp.MustCompile("^(clamd|plugin)?$").MatchString(config.AssetScanner.ImplName) {
+		return fmt.Errorf("ASSET_SCANNER must be clamd or plugin")
+	}
+	if config.AssetScanner.ImplName == "plugin" && config.AssetScanner.Plugin.Lambda == "" {
+		return fmt.Errorf("ASSET_SCANNER_LAMBDA is required to scan assets with plugin")
+	}
+	if config.App.LeaderElection && config.DB.ImplName != "pq" {
+		return fmt.Errorf("LEADER_ELECTION requires DB_IMPL_NAME to be pq")
+	}
+	if !regexp.MustCompile("^(memory|pq|redis)?$").MatchString(config.PubSub.Backend) {
+		return fmt.Errorf("PUBSUB_BACKEND must be memory, pq or redis")
+	}
+	if config.PubSub.Backend == "pq" && config.DB.ImplName != "pq" {
+		return fmt.Errorf("PUBSUB_BACKEND pq requires DB_IMPL_NAME to be pq")
+	}
+	if config.PubSub.Backend == "redis" && config.PubSub.RedisURL == "" {
+		return fmt.Errorf("PUBSUB_REDIS_URL is not set")
+	}
+	if !regexp.MustCompile("^(memory|pq)?$").MatchString(config.PubSub.History) {
+		return fmt.Errorf("PUBSUB_HISTORY must be memory or pq")
+	}
+	if config.PubSub.History == "memory" && config.PubSub.Backend != "" && config.PubSub.Backend != "memory" {
+		return fmt.Errorf("PUBSUB_HISTORY memory requires PUBSUB_BACKEND to be memory")
+	}
+	if config.PubSub.History == "pq" && config.DB.ImplName != "pq" {
+		return fmt.Errorf("PUBSUB_HISTORY pq requires DB_IMPL_NAME to be pq")
+	}
+	if config.PubSub.History != "" && config.PubSub.HistorySize <= 0 {
+		return fmt.Errorf("PUBSUB_HISTORY_SIZE must be positive")
+	}
+	if config.PubSub.History != "" && config.PubSub.HistoryTTL <= 0 {
+		return fmt.Errorf("PUBSUB_HISTORY_TTL must be positive")
+	}
+	if err := config.validatePubSubRules(); err != nil {
+		return err
+	}
 	return config.checkAuthRecordKeysDuplication()
 }
 
+func (config *Configuration) validatePubSubRules() error {
+	namespaceRule := regexp.MustCompile("^(anyone|authenticated|owner|master)?$")
+	rule := regexp.MustCompile("^(anyone|authenticated|master)?$")
+	rules := []struct {
+		name      string
+		value     string
+		namespace bool
+	}{
+		{"PUBSUB_USER_SUBSCRIBE", config.PubSub.UserSubscribe, true},
+		{"PUBSUB_USER_PUBLISH", config.PubSub.UserPublish, true},
+		{"PUBSUB_ROLE_SUBSCRIBE", config.PubSub.RoleSubscribe, true},
+		{"PUBSUB_ROLE_PUBLISH", config.PubSub.RolePublish, true},
+		{"PUBSUB_PUBLIC_SUBSCRIBE", config.PubSub.PublicSubscribe, false},
+		{"PUBSUB_PUBLIC_PUBLISH", config.PubSub.PublicPublish, false},
+		{"PUBSUB_DEFAULT_SUBSCRIBE", config.PubSub.DefaultSubscribe, false},
+		{"PUBSUB_DEFAULT_PUBLISH", config.PubSub.DefaultPublish, false},
+	}
+	for _, r := range rules {
+		if r.namespace && !namespaceRule.MatchString(r.value) {
+			return fmt.Errorf("%s must be anyone, authenticated, owner or master", r.name)
+		}
+		if !r.namespace && !rule.MatchString(r.value) {
+			return fmt.Errorf("%s must be anyone, authenticated or master", r.name)
+		}
+	}
+	return nil
+}
+
 func (config *Configuration) checkAuthRecordKeysDuplication() error {
 	check := map[string]interface{}{}
 	for _, result := range config.App.AuthRecordKeys {
@@ -385,6 +573,10 @@ func (config *Configuration) ReadFromEnv() {
 		config.App.Slave = slave
 	}
 
+	if leaderElection, err := parseBool(os.Getenv("LEADER_ELECTION")); err == nil {
+		config.App.LeaderElection = leaderElection
+	}
+
 	if timeout, err := strconv.ParseInt(os.Getenv("RESPONSE_TIMEOUT"), 10, 64); err == nil {
 		config.App.ResponseTimeout = timeout
 	}
@@ -399,10 +591,16 @@ func (config *Configuration) ReadFromEnv() {
 
 	config.readTokenStore()
 	config.readAssetStore()
+	config.readAssetGC()
+	config.readAssetPolicy()
+	config.readAssetScanner()
 	config.readAPNS()
 	config.readFCM()
 	config.readBaidu()
+	config.readWebPush()
+	config.readPushMock()
 	config.readLog()
+	config.readPubSub()
 	config.readPlugins()
 	config.readUserAudit()
 	config.readUserVerification()
@@ -459,6 +657,14 @@ func (config *Configuration) readAssetStore() {
 		config.AssetStore.Public = assetStorePublic
 	}
 
+	if recordACL, err := parseBool(os.Getenv("ASSET_STORE_RECORD_ACL")); err == nil {
+		config.AssetStore.RecordACL = recordACL
+	}
+
+	if contentAddressed, err := parseBool(os.Getenv("ASSET_STORE_CONTENT_ADDRESSED")); err == nil {
+		config.AssetStore.ContentAddressed = contentAddressed
+	}
+
 	// Local Storage related
 	assetStorePath := os.Getenv("ASSET_STORE_PATH")
 	if assetStorePath != "" {
@@ -494,6 +700,31 @@ func (config *Configuration) readAssetStore() {
 	if assetStoreS3URLPrefix != "" {
 		config.AssetStore.S3Store.URLPrefix = assetStoreS3URLPrefix
 	}
+	assetStoreS3Endpoint := os.Getenv("ASSET_STORE_S3_ENDPOINT")
+	if assetStoreS3Endpoint != "" {
+		config.AssetStore.S3Store.Endpoint = assetStoreS3Endpoint
+	}
+	if forcePathStyle, err := parseBool(os.Getenv("ASSET_STORE_S3_FORCE_PATH_STYLE")); err == nil {
+		config.AssetStore.S3Store.ForcePathStyle = forcePathStyle
+	}
+	if insecureSkipVerify, err := parseBool(os.Getenv("ASSET_STORE_S3_INSECURE_SKIP_VERIFY")); err == nil {
+		config.AssetStore.S3Store.InsecureSkipVerify = insecureSkipVerify
+	}
+	assetStoreS3SSE := os.Getenv("ASSET_STORE_S3_SSE")
+	if assetStoreS3SSE != "" {
+		config.AssetStore.S3Store.ServerSideEncryption = assetStoreS3SSE
+	}
+	assetStoreS3SSEKMSKeyID := os.Getenv("ASSET_STORE_S3_SSE_KMS_KEY_ID")
+	if assetStoreS3SSEKMSKeyID != "" {
+		config.AssetStore.S3Store.SSEKMSKeyID = assetStoreS3SSEKMSKeyID
+	}
+	assetStoreS3StorageClass := os.Getenv("ASSET_STORE_S3_STORAGE_CLASS")
+	if assetStoreS3StorageClass != "" {
+		config.AssetStore.S3Store.StorageClass = assetStoreS3StorageClass
+	}
+	if presignUpload, err := parseBool(os.Getenv("ASSET_STORE_S3_PRESIGN_UPLOAD")); err == nil {
+		config.AssetStore.S3Store.PresignUpload = presignUpload
+	}
 
 	// Cloud Asset related
 	cloudAssetHost := os.Getenv("CLOUD_ASSET_HOST")
@@ -514,6 +745,78 @@ func (config *Configuration) readAssetStore() {
 	}
 }
 
+func (config *Configuration) readAssetGC() {
+	if shouldEnableAssetGC, err := parseBool(os.Getenv("ASSET_GC_ENABLE")); err == nil {
+		config.AssetGC.Enable = shouldEnableAssetGC
+	}
+
+	if schedule := os.Getenv("ASSET_GC_SCHEDULE"); schedule != "" {
+		config.AssetGC.Schedule = schedule
+	}
+
+	if gracePeriod, err := strconv.Atoi(os.Getenv("ASSET_GC_GRACE_PERIOD")); err == nil {
+		config.AssetGC.GracePeriod = gracePeriod
+	}
+}
+
+func (config *Configuration) readAssetPolicy() {
+	if maxSize, err := strconv.ParseInt(os.Getenv("ASSET_MAX_SIZE"), 10, 64); err == nil {
+		config.AssetPolicy.MaxSize = maxSize
+	}
+
+	if contentTypes := os.Getenv("ASSET_CONTENT_TYPES"); contentTypes != "" {
+		config.AssetPolicy.ContentTypes = parseCommaSeparatedString(contentTypes)
+	}
+
+	if sniff, err := parseBool(os.Getenv("ASSET_SNIFF_CONTENT_TYPE")); err == nil {
+		config.AssetPolicy.SniffContentType = sniff
+	}
+
+	if stripEXIF := os.Getenv("ASSET_STRIP_EXIF"); stripEXIF != "" {
+		config.AssetPolicy.StripEXIF = stripEXIF
+	}
+
+	// each named policy applies to the record fields listed in <name>_FIELDS
+	policies := os.Getenv("ASSET_FIELD_POLICIES")
+	if policies == "" {
+		return
+	}
+
+	if config.AssetPolicy.Fields == nil {
+		config.AssetPolicy.Fields = map[string]*AssetFieldPolicyConfig{}
+	}
+	for _, p := range parseCommaSeparatedString(policies) {
+		policyConfig := &AssetFieldPolicyConfig{}
+		if v, err := strconv.ParseInt(os.Getenv(p+"_MAX_SIZE"), 10, 64); err == nil && v > 0 {
+			policyConfig.MaxSize = v
+		}
+		if contentTypes := os.Getenv(p + "_CONTENT_TYPES"); contentTypes != "" {
+			policyConfig.ContentTypes = parseCommaSeparatedString(contentTypes)
+		}
+		for _, field := range parseCommaSeparatedString(os.Getenv(p + "_FIELDS")) {
+			config.AssetPolicy.Fields[field] = policyConfig
+		}
+	}
+}
+
+func (config *Configuration) readAssetScanner() {
+	if scanner := os.Getenv("ASSET_SCANNER"); scanner != "" {
+		config.AssetScanner.ImplName = scanner
+	}
+
+	if address := os.Getenv("ASSET_SCANNER_CLAMD_ADDRESS"); address != "" {
+		config.AssetScanner.Clamd.Address = address
+	}
+
+	if timeout, err := strconv.Atoi(os.Getenv("ASSET_SCANNER_CLAMD_TIMEOUT")); err == nil {
+		config.AssetScanner.Clamd.Timeout = timeout
+	}
+
+	if lambda := os.Getenv("ASSET_SCANNER_LAMBDA"); lambda != "" {
+		config.AssetScanner.Plugin.Lambda = lambda
+	}
+}
+
 func (config *Configuration) readAPNS() {
 	if shouldEnableAPNS, err := parseBool(os.Getenv("APNS_ENABLE")); err == nil {
 		config.APNS.Enable = shouldEnableAPNS
@@ -653,6 +956,38 @@ func (config *Configuration) readBaidu() {
 	}
 }
 
+func (config *Configuration) readWebPush() {
+	if shouldEnableWebPush, err := parseBool(os.Getenv("WEB_PUSH_ENABLE")); err == nil {
+		config.WebPush.Enable = shouldEnableWebPush
+	}
+
+	if subject := os.Getenv("WEB_PUSH_SUBJECT"); subject != "" {
+		config.WebPush.Subject = subject
+	}
+
+	if privateKey := os.Getenv("WEB_PUSH_PRIVATE_KEY"); privateKey != "" {
+		config.WebPush.PrivateKey = privateKey
+	}
+
+	if ttl, err := strconv.Atoi(os.Getenv("WEB_PUSH_TTL")); err == nil {
+		config.WebPush.TTL = ttl
+	}
+}
+
+func (config *Configuration) readPushMock() {
+	if shouldEnablePushMock, err := parseBool(os.Getenv("PUSH_MOCK_ENABLE")); err == nil {
+		config.PushMock.Enable = shouldEnablePushMock
+	}
+
+	if failures := os.Getenv("PUSH_MOCK_FAILURES"); failures != "" {
+		config.PushMock.Failures = failures
+	}
+
+	if limit, err := strconv.Atoi(os.Getenv("PUSH_MOCK_CAPTURE_LIMIT")); err == nil {
+		config.PushMock.CaptureLimit = limit
+	}
+}
+
 func (config *Configuration) readLog() {
 	logLevel := os.Getenv("LOG_LEVEL")
 	if logLevel != "" {
@@ -689,6 +1024,39 @@ func (config *Configuration) readLog() {
 	}
 }
 
+func (config *Configuration) readPubSub() {
+	envs := map[string]*string{
+		"PUBSUB_BACKEND":           &config.PubSub.Backend,
+		"PUBSUB_REDIS_URL":         &config.PubSub.RedisURL,
+		"PUBSUB_HISTORY":           &config.PubSub.History,
+		"PUBSUB_USER_SUBSCRIBE":    &config.PubSub.UserSubscribe,
+		"PUBSUB_USER_PUBLISH":      &config.PubSub.UserPublish,
+		"PUBSUB_ROLE_SUBSCRIBE":    &config.PubSub.RoleSubscribe,
+		"PUBSUB_ROLE_PUBLISH":      &config.PubSub.RolePublish,
+		"PUBSUB_PUBLIC_SUBSCRIBE":  &config.PubSub.PublicSubscribe,
+		"PUBSUB_PUBLIC_PUBLISH":    &config.PubSub.PublicPublish,
+		"PUBSUB_DEFAULT_SUBSCRIBE": &config.PubSub.DefaultSubscribe,
+		"PUBSUB_DEFAULT_PUBLISH":   &config.PubSub.DefaultPublish,
+	}
+	for name, value := range envs {
+		if v := os.Getenv(name); v != "" {
+			*value = v
+		}
+	}
+
+	if size, err := strconv.Atoi(os.Getenv("PUBSUB_HISTORY_SIZE")); err == nil {
+		config.PubSub.HistorySize = size
+	}
+
+	if ttl, err := strconv.ParseInt(os.Getenv("PUBSUB_HISTORY_TTL"), 10, 64); err == nil {
+		config.PubSub.HistoryTTL = ttl
+	}
+
+	if channels := os.Getenv("PUBSUB_HISTORY_CHANNELS"); channels != "" {
+		config.PubSub.HistoryChannels = strings.Split(channels, ",")
+	}
+}
+
 func (config *Configuration) readPlugins() {
 	timeoutStr := os.Getenv("ZMQ_TIMEOUT")
 	timeout, err := strconv.Atoi(timeoutStr)
@@ -710,6 +1078,21 @@ func (config *Configuration) readPlugins() {
 		if args != "" {
 			pluginConfig.Args = strings.Split(args, ",")
 		}
+		if v, err := strconv.ParseInt(os.Getenv(p+"_TIMEOUT"), 10, 0); err == nil && v > 0 {
+			pluginConfig.Timeout = int(v)
+		}
+		if v, err := strconv.ParseInt(os.Getenv(p+"_MAX_CONCURRENCY"), 10, 0); err == nil && v > 0 {
+			pluginConfig.MaxConcurrency = int(v)
+		}
+		if v, err := strconv.ParseFloat(os.Getenv(p+"_CIRCUIT_BREAKER_ERROR_RATE"), 64); err == nil && v > 0 && v <= 1 {
+			pluginConfig.CircuitBreakerErrorRate = v
+		}
+		if v, err := strconv.ParseInt(os.Getenv(p+"_CIRCUIT_BREAKER_MIN_REQUESTS"), 10, 0); err == nil && v > 0 {
+			pluginConfig.CircuitBreakerMinRequests = int(v)
+		}
+		if v, err := strconv.ParseInt(os.Getenv(p+"_CIRCUIT_BREAKER_COOLDOWN"), 10, 0); err == nil && v > 0 {
+			pluginConfig.CircuitBreakerCooldown = int(v)
+		}
 		config.Plugin[p] = pluginConfig
 	}
 }
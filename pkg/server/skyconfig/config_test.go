@@ -109,6 +109,103 @@ func TestRequiredConfig(t *testing.T) {
 			os.Setenv("APNS_ENABLE", "")
 		})
 
+		Convey("Validate the LEADER_ELECTION", func() {
+			config := NewConfigurationWithKeys()
+			os.Setenv("LEADER_ELECTION", "YES")
+			config.ReadFromEnv()
+			So(config.App.LeaderElection, ShouldBeTrue)
+			So(config.Validate(), ShouldBeNil)
+
+			config.DB.ImplName = "fs"
+			So(config.Validate(), ShouldNotBeNil)
+
+			os.Setenv("LEADER_ELECTION", "")
+		})
+
+		Convey("Validate the ASSET_STORE_RECORD_ACL", func() {
+			config := NewConfigurationWithKeys()
+			config.AssetStore.RecordACL = true
+			So(config.Validate(), ShouldBeNil)
+
+			config.AssetStore.ImplName = "s3"
+			So(config.Validate(), ShouldNotBeNil)
+		})
+
+		Convey("Validate the pubsub rules", func() {
+			config := NewConfigurationWithKeys()
+			os.Setenv("PUBSUB_ROLE_PUBLISH", "owner")
+			os.Setenv("PUBSUB_PUBLIC_PUBLISH", "authenticated")
+			config.ReadFromEnv()
+			So(config.PubSub.UserSubscribe, ShouldEqual, "owner")
+			So(config.PubSub.RolePublish, ShouldEqual, "owner")
+			So(config.PubSub.PublicPublish, ShouldEqual, "authenticated")
+			So(config.Validate(), ShouldBeNil)
+
+			config.PubSub.PublicSubscribe = "owner"
+			So(config.Validate(), ShouldNotBeNil)
+
+			config.PubSub.PublicSubscribe = "everyone"
+			So(config.Validate(), ShouldNotBeNil)
+
+			os.Setenv("PUBSUB_ROLE_PUBLISH", "")
+			os.Setenv("PUBSUB_PUBLIC_PUBLISH", "")
+		})
+
+		Convey("Validate the pubsub backend", func() {
+			config := NewConfigurationWithKeys()
+			So(config.PubSub.Backend, ShouldEqual, "memory")
+
+			os.Setenv("PUBSUB_BACKEND", "redis")
+			config.ReadFromEnv()
+			So(config.PubSub.Backend, ShouldEqual, "redis")
+			So(config.Validate(), ShouldNotBeNil)
+
+			os.Setenv("PUBSUB_REDIS_URL", "redis://redis:6379")
+			config.ReadFromEnv()
+			So(config.PubSub.RedisURL, ShouldEqual, "redis://redis:6379")
+			So(config.Validate(), ShouldBeNil)
+
+			config.PubSub.Backend = "pq"
+			So(config.Validate(), ShouldBeNil)
+			config.DB.ImplName = "fs"
+			So(config.Validate(), ShouldNotBeNil)
+
+			config.PubSub.Backend = "kafka"
+			So(config.Validate(), ShouldNotBeNil)
+
+			os.Setenv("PUBSUB_BACKEND", "")
+			os.Setenv("PUBSUB_REDIS_URL", "")
+		})
+
+		Convey("Read the pubsub history", func() {
+			config := NewConfigurationWithKeys()
+			os.Setenv("PUBSUB_HISTORY", "memory")
+			os.Setenv("PUBSUB_HISTORY_SIZE", "10")
+			os.Setenv("PUBSUB_HISTORY_TTL", "60")
+			os.Setenv("PUBSUB_HISTORY_CHANNELS", "public:,user:")
+			config.ReadFromEnv()
+			So(config.PubSub.History, ShouldEqual, "memory")
+			So(config.PubSub.HistorySize, ShouldEqual, 10)
+			So(config.PubSub.HistoryTTL, ShouldEqual, 60)
+			So(config.PubSub.HistoryChannels, ShouldResemble, []string{"public:", "user:"})
+			So(config.Validate(), ShouldBeNil)
+
+			config.PubSub.Backend = "redis"
+			config.PubSub.RedisURL = "redis://redis:6379"
+			So(config.Validate(), ShouldNotBeNil)
+
+			config.PubSub.History = "pq"
+			So(config.Validate(), ShouldBeNil)
+
+			config.PubSub.HistoryTTL = 0
+			So(config.Validate(), ShouldNotBeNil)
+
+			os.Setenv("PUBSUB_HISTORY", "")
+			os.Setenv("PUBSUB_HISTORY_SIZE", "")
+			os.Setenv("PUBSUB_HISTORY_TTL", "")
+			os.Setenv("PUBSUB_HISTORY_CHANNELS", "")
+		})
+
 		Convey("Read token store config correctly", func() {
 			config := NewConfigurationWithKeys()
 			os.Setenv("TOKEN_STORE", "redis")
@@ -128,6 +225,37 @@ func TestRequiredConfig(t *testing.T) {
 			os.Setenv("TOKEN_STORE_EXPIRY", "")
 		})
 
+		Convey("Read S3 asset store config correctly", func() {
+			config := NewConfigurationWithKeys()
+			os.Setenv("ASSET_STORE_S3_ENDPOINT", "http://minio:9000")
+			os.Setenv("ASSET_STORE_S3_FORCE_PATH_STYLE", "YES")
+			os.Setenv("ASSET_STORE_S3_SSE", "aws:kms")
+			os.Setenv("ASSET_STORE_S3_SSE_KMS_KEY_ID", "key-id")
+			os.Setenv("ASSET_STORE_S3_STORAGE_CLASS", "STANDARD_IA")
+			os.Setenv("ASSET_STORE_S3_PRESIGN_UPLOAD", "YES")
+
+			config.readAssetStore()
+			So(config.Validate(), ShouldBeNil)
+			So(config.AssetStore.S3Store.Endpoint, ShouldEqual, "http://minio:9000")
+			So(config.AssetStore.S3Store.ForcePathStyle, ShouldBeTrue)
+			So(config.AssetStore.S3Store.InsecureSkipVerify, ShouldBeFalse)
+			So(config.AssetStore.S3Store.ServerSideEncryption, ShouldEqual, "aws:kms")
+			So(config.AssetStore.S3Store.SSEKMSKeyID, ShouldEqual, "key-id")
+			So(config.AssetStore.S3Store.StorageClass, ShouldEqual, "STANDARD_IA")
+			So(config.AssetStore.S3Store.PresignUpload, ShouldBeTrue)
+
+			os.Setenv("ASSET_STORE_S3_SSE", "unknown")
+			config.readAssetStore()
+			So(config.Validate(), ShouldNotBeNil)
+
+			os.Setenv("ASSET_STORE_S3_ENDPOINT", "")
+			os.Setenv("ASSET_STORE_S3_FORCE_PATH_STYLE", "")
+			os.Setenv("ASSET_STORE_S3_SSE", "")
+			os.Setenv("ASSET_STORE_S3_SSE_KMS_KEY_ID", "")
+			os.Setenv("ASSET_STORE_S3_STORAGE_CLASS", "")
+			os.Setenv("ASSET_STORE_S3_PRESIGN_UPLOAD", "")
+		})
+
 		Convey("Read plugin config correctly", func() {
 			config := NewConfigurationWithKeys()
 			os.Setenv("PLUGINS", "CAT")
@@ -137,9 +265,9 @@ func TestRequiredConfig(t *testing.T) {
 
 			config.readPlugins()
 			So(config.Plugin["CAT"], ShouldResemble, &PluginConfig{
-				"exec",
-				"py-skygear",
-				[]string{"chima", "faseng"},
+				Transport: "exec",
+				Path:      "py-skygear",
+				Args:      []string{"chima", "faseng"},
 			})
 
 			os.Setenv("PLUGINS", "")
@@ -159,15 +287,15 @@ func TestRequiredConfig(t *testing.T) {
 
 			config.readPlugins()
 			So(config.Plugin["CAT"], ShouldResemble, &PluginConfig{
-				"exec",
-				"py-skygear",
-				[]string{"chima", "faseng"},
+				Transport: "exec",
+				Path:      "py-skygear",
+				Args:      []string{"chima", "faseng"},
 			})
 
 			So(config.Plugin["BUG"], ShouldResemble, &PluginConfig{
-				"zmq",
-				"tcp://skygear:5555",
-				nil,
+				Transport: "zmq",
+				Path:      "tcp://skygear:5555",
+				Args:      nil,
 			})
 
 			os.Setenv("PLUGINS", "")
@@ -178,6 +306,38 @@ func TestRequiredConfig(t *testing.T) {
 			os.Setenv("BUG_PATH", "")
 		})
 
+		Convey("Read plugin limits config correctly", func() {
+			config := NewConfigurationWithKeys()
+			os.Setenv("PLUGINS", "CAT")
+			os.Setenv("CAT_TRANSPORT", "http")
+			os.Setenv("CAT_PATH", "http://localhost:8000")
+			os.Setenv("CAT_TIMEOUT", "5")
+			os.Setenv("CAT_MAX_CONCURRENCY", "20")
+			os.Setenv("CAT_CIRCUIT_BREAKER_ERROR_RATE", "0.5")
+			os.Setenv("CAT_CIRCUIT_BREAKER_MIN_REQUESTS", "10")
+			os.Setenv("CAT_CIRCUIT_BREAKER_COOLDOWN", "30")
+
+			config.readPlugins()
+			So(config.Plugin["CAT"], ShouldResemble, &PluginConfig{
+				Transport:                 "http",
+				Path:                      "http://localhost:8000",
+				Timeout:                   5,
+				MaxConcurrency:            20,
+				CircuitBreakerErrorRate:   0.5,
+				CircuitBreakerMinRequests: 10,
+				CircuitBreakerCooldown:    30,
+			})
+
+			os.Setenv("PLUGINS", "")
+			os.Setenv("CAT_TRANSPORT", "")
+			os.Setenv("CAT_PATH", "")
+			os.Setenv("CAT_TIMEOUT", "")
+			os.Setenv("CAT_MAX_CONCURRENCY", "")
+			os.Setenv("CAT_CIRCUIT_BREAKER_ERROR_RATE", "")
+			os.Setenv("CAT_CIRCUIT_BREAKER_MIN_REQUESTS", "")
+			os.Setenv("CAT_CIRCUIT_BREAKER_COOLDOWN", "")
+		})
+
 		Convey("User audit default values", func() {
 			config := NewConfigurationWithKeys()
 			config.readUserAudit()
@@ -247,6 +407,101 @@ func TestRequiredConfig(t *testing.T) {
 			os.Setenv("USER_AUDIT_PW_HISTORY_DAYS", "")
 			os.Setenv("USER_AUDIT_PW_EXPIRY_DAYS", "")
 		})
+
+		Convey("Read asset policy", func() {
+			config := NewConfiguration()
+			os.Setenv("ASSET_MAX_SIZE", "1048576")
+			os.Setenv("ASSET_CONTENT_TYPES", "image/*, application/pdf")
+			os.Setenv("ASSET_SNIFF_CONTENT_TYPE", "YES")
+			os.Setenv("ASSET_STRIP_EXIF", "gps")
+			os.Setenv("ASSET_FIELD_POLICIES", "AVATAR")
+			os.Setenv("AVATAR_FIELDS", "user.avatar,group.icon")
+			os.Setenv("AVATAR_MAX_SIZE", "1024")
+			os.Setenv("AVATAR_CONTENT_TYPES", "image/png")
+
+			config.readAssetPolicy()
+			So(config.AssetPolicy.MaxSize, ShouldEqual, 1048576)
+			So(config.AssetPolicy.ContentTypes, ShouldResemble, []string{
+				"image/*",
+				"application/pdf",
+			})
+			So(config.AssetPolicy.SniffContentType, ShouldBeTrue)
+			So(config.AssetPolicy.StripEXIF, ShouldEqual, "gps")
+
+			avatarPolicy := &AssetFieldPolicyConfig{
+				MaxSize:      1024,
+				ContentTypes: []string{"image/png"},
+			}
+			So(config.AssetPolicy.Fields, ShouldResemble, map[string]*AssetFieldPolicyConfig{
+				"user.avatar": avatarPolicy,
+				"group.icon":  avatarPolicy,
+			})
+
+			os.Setenv("ASSET_MAX_SIZE", "")
+			os.Setenv("ASSET_CONTENT_TYPES", "")
+			os.Setenv("ASSET_SNIFF_CONTENT_TYPE", "")
+			os.Setenv("ASSET_STRIP_EXIF", "")
+			os.Setenv("ASSET_FIELD_POLICIES", "")
+			os.Setenv("AVATAR_FIELDS", "")
+			os.Setenv("AVATAR_MAX_SIZE", "")
+			os.Setenv("AVATAR_CONTENT_TYPES", "")
+		})
+
+		Convey("Validate the EXIF stripping", func() {
+			config := NewConfigurationWithKeys()
+			So(config.Validate(), ShouldBeNil)
+
+			So(config.AssetPolicy.StripEXIF, ShouldEqual, "gps")
+
+			config.AssetPolicy.StripEXIF = "all"
+			So(config.Validate(), ShouldBeNil)
+
+			config.AssetPolicy.StripEXIF = "none"
+			So(config.Validate(), ShouldBeNil)
+
+			config.AssetPolicy.StripEXIF = "location"
+			So(config.Validate(), ShouldNotBeNil)
+		})
+
+		Convey("Validate the EXIF stripping with presigned upload", func() {
+			config := NewConfigurationWithKeys()
+			config.AssetStore.ImplName = "s3"
+			config.AssetStore.S3Store.PresignUpload = true
+			So(config.Validate(), ShouldNotBeNil)
+
+			config.AssetPolicy.StripEXIF = "none"
+			So(config.Validate(), ShouldBeNil)
+		})
+
+		Convey("Validate the asset scanner", func() {
+			config := NewConfigurationWithKeys()
+			So(config.AssetScanner.Clamd.Address, ShouldEqual, "localhost:3310")
+
+			os.Setenv("ASSET_SCANNER", "clamd")
+			os.Setenv("ASSET_SCANNER_CLAMD_ADDRESS", "clamd:3310")
+			os.Setenv("ASSET_SCANNER_CLAMD_TIMEOUT", "10")
+			config.ReadFromEnv()
+			So(config.Validate(), ShouldBeNil)
+			So(config.AssetScanner.Clamd.Address, ShouldEqual, "clamd:3310")
+			So(config.AssetScanner.Clamd.Timeout, ShouldEqual, 10)
+
+			os.Setenv("ASSET_SCANNER", "plugin")
+			config.ReadFromEnv()
+			So(config.Validate(), ShouldNotBeNil)
+
+			os.Setenv("ASSET_SCANNER_LAMBDA", "scan_asset")
+			config.ReadFromEnv()
+			So(config.Validate(), ShouldBeNil)
+
+			os.Setenv("ASSET_SCANNER", "unknown")
+			config.ReadFromEnv()
+			So(config.Validate(), ShouldNotBeNil)
+
+			os.Setenv("ASSET_SCANNER", "")
+			os.Setenv("ASSET_SCANNER_CLAMD_ADDRESS", "")
+			os.Setenv("ASSET_SCANNER_CLAMD_TIMEOUT", "")
+			os.Setenv("ASSET_SCANNER_LAMBDA", "")
+		})
 	})
 }
 
@@ -0,0 +1,28 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package skydb
+
+// AssetContent records the content of assets stored by its hash in a
+// content-addressed asset store, see asset.ContentAddressedStore.
+//
+// Assets of identical content reference the same AssetContent, and
+// RefCount is the number of such assets. The content is deleted from the
+// asset store when it is no longer referenced by any asset.
+type AssetContent struct {
+	Hash        string
+	ContentType string
+	Size        int64
+	RefCount    int
+}
@@ -0,0 +1,36 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package skydb
+
+import "time"
+
+// AssetUpload records the progress of an asset uploaded in chunks, such
+// that an interrupted upload can be resumed from Offset.
+//
+// Chunks received by the server are kept in the asset store under the
+// names in Chunks until the upload is finalized. For an upload done
+// directly to the asset store in parts, MultipartUploadID is the ID
+// assigned by the asset store and Chunks is empty.
+type AssetUpload struct {
+	ID                string
+	Name              string
+	ContentType       string
+	Length            int64
+	Offset            int64
+	Chunks            []string
+	MultipartUploadID string
+	CreatedAt         time.Time
+	UpdatedAt         time.Time
+}
@@ -37,6 +37,38 @@ var ErrRoleUpdatesFailed = errors.New("skydb: Update of user roles failed")
 // cannot be found in the current container
 var ErrDeviceNotFound = errors.New("skydb: Specific device not found")
 
+// ErrJobNotFound is returned by Conn.UpdateJob and Conn.DeleteJob if the
+// desired Job cannot be found in the current container
+var ErrJobNotFound = errors.New("skydb: Specific job not found")
+
+// ErrJobDuplicated is returned by Conn.CreateJob if a Job with the same
+// Key already exists in the current container
+var ErrJobDuplicated = errors.New("skydb: duplicated job key")
+
+// ErrPushTemplateNotFound is returned by Conn.GetPushTemplate and
+// Conn.DeletePushTemplate if the desired PushTemplate cannot be found in
+// the current container
+var ErrPushTemplateNotFound = errors.New("skydb: Specific push template not found")
+
+// ErrPushDeliveryNotFound is returned by Conn.UpdatePushDelivery if the
+// desired PushDelivery cannot be found in the current container
+var ErrPushDeliveryNotFound = errors.New("skydb: Specific push delivery not found")
+
+// ErrAssetUploadNotFound is returned by Conn.GetAssetUpload,
+// Conn.AppendAssetUploadChunk and Conn.DeleteAssetUpload if the desired
+// AssetUpload cannot be found in the current container
+var ErrAssetUploadNotFound = errors.New("skydb: Specific asset upload not found")
+
+// ErrAssetUploadOffsetMismatch is returned by Conn.AppendAssetUploadChunk
+// if the chunk does not start at the current offset of the AssetUpload,
+// or the chunk exceeds the length of the AssetUpload
+var ErrAssetUploadOffsetMismatch = errors.New("skydb: asset upload offset mismatch")
+
+// ErrAssetContentNotFound is returned by
+// Conn.ReferenceExistingAssetContent and Conn.DereferenceAssetContent if
+// the desired AssetContent cannot be found in the current container
+var ErrAssetContentNotFound = errors.New("skydb: Specific asset content not found")
+
 // ErrDatabaseIsReadOnly is returned by skydb.Database if the requested
 // operation modifies the database and the database is readonly.
 var ErrDatabaseIsReadOnly = errors.New("skydb: database is read only")
@@ -160,6 +192,22 @@ type Conn interface {
 	// be referenced by records.
 	SaveAsset(asset *Asset) error
 
+	// QueryOrphanedAssets returns at most limit Assets created before
+	// createdBefore which are not referenced by any of the asset columns,
+	// supplied as a map from record type to column names.
+	QueryOrphanedAssets(assetColumns map[string][]string, createdBefore time.Time, limit int) ([]Asset, error)
+
+	// QueryAssets returns at most limit Assets ordered by name, which are
+	// named after the specified name. All assets can be iterated by
+	// passing the name of the last returned asset as after.
+	QueryAssets(after string, limit int) ([]Asset, error)
+
+	// DeleteAsset deletes the Asset information of the named asset.
+	//
+	// DeleteAsset returns an error if the asset is still referenced
+	// by records.
+	DeleteAsset(name string) error
+
 	QueryRelation(user string, name string, direction string, config QueryConfig) []AuthInfo
 	QueryRelationCount(user string, name string, direction string) (uint64, error)
 	AddRelation(user string, name string, targetUser string) error
@@ -171,6 +219,11 @@ type Conn interface {
 	// by the specified user.
 	QueryDevicesByUser(user string) ([]Device, error)
 	QueryDevicesByUserAndTopic(user, topic string) ([]Device, error)
+
+	// QueryDevicesByTopic queries at most limit Devices subscribed to the
+	// topic with ID greater than afterID, ordered by ID. Pass the ID of
+	// the last Device returned as afterID to fetch the next batch.
+	QueryDevicesByTopic(topic string, afterID string, limit int) ([]Device, error)
 	SaveDevice(device *Device) error
 	DeleteDevice(id string) error
 
@@ -243,6 +296,16 @@ type Conn interface {
 	Close() error
 
 	CustomTokenConn
+
+	JobConn
+
+	PushTemplateConn
+
+	PushDeliveryConn
+
+	AssetUploadConn
+
+	AssetContentConn
 }
 
 type CustomTokenConn interface {
@@ -251,6 +314,169 @@ type CustomTokenConn interface {
 	DeleteCustomTokenInfo(principalID string) error
 }
 
+// JobConn encapsulates the persistent queue of scheduled jobs.
+type JobConn interface {
+	// CreateJob saves a new Job to be executed at RunAt.
+	//
+	// CreateJob returns ErrJobDuplicated if a Job with the same non-empty
+	// Key exists.
+	CreateJob(job *Job) error
+
+	// ClaimDueJobs returns at most limit jobs with RunAt before t. Jobs
+	// returned have their Attempts incremented, and RunAt postponed and
+	// ClaimedUntil set to lockUntil, such that they are not claimed again
+	// before lockUntil.
+	ClaimDueJobs(t time.Time, lockUntil time.Time, limit int) ([]Job, error)
+
+	// UpdateJob updates RunAt, Attempts and LastError of an existing Job,
+	// and releases the claim of the Job.
+	//
+	// UpdateJob returns ErrJobNotFound if such Job does not exist.
+	UpdateJob(job *Job) error
+
+	// DeleteJob removes the Job with the supplied ID.
+	//
+	// DeleteJob returns ErrJobNotFound if such Job does not exist.
+	DeleteJob(id string) error
+
+	// DeleteJobsByKeyPrefix removes all Jobs with Key starting with
+	// prefix, and returns the number of Jobs removed.
+	DeleteJobsByKeyPrefix(prefix string) (int, error)
+
+	// CancelJobsByKeyPrefix removes Jobs with Key starting with prefix
+	// which are not claimed by a worker at t. It returns the number of
+	// Jobs removed, and the number of Jobs not removed because they are
+	// being executed.
+	CancelJobsByKeyPrefix(prefix string, t time.Time) (int, int, error)
+}
+
+// PushTemplateConn encapsulates the storage of push notification templates.
+type PushTemplateConn interface {
+	// GetPushTemplate returns the PushTemplate with the supplied name.
+	//
+	// GetPushTemplate returns ErrPushTemplateNotFound if such PushTemplate
+	// does not exist.
+	GetPushTemplate(name string, template *PushTemplate) error
+
+	// QueryPushTemplates returns all PushTemplates ordered by name.
+	QueryPushTemplates() ([]PushTemplate, error)
+
+	// SavePushTemplate creates or replaces the PushTemplate with the same
+	// name.
+	SavePushTemplate(template *PushTemplate) error
+
+	// DeletePushTemplate removes the PushTemplate with the supplied name.
+	//
+	// DeletePushTemplate returns ErrPushTemplateNotFound if such
+	// PushTemplate does not exist.
+	DeletePushTemplate(name string) error
+}
+
+// PushDeliveryConn encapsulates the log of push notification deliveries.
+type PushDeliveryConn interface {
+	// CreatePushDelivery saves a new PushDelivery. ID, CreatedAt and
+	// UpdatedAt are assigned if empty.
+	CreatePushDelivery(delivery *PushDelivery) error
+
+	// UpdatePushDelivery updates Status, Attempts, Response, NextAttemptAt
+	// and UpdatedAt of an existing PushDelivery.
+	//
+	// UpdatePushDelivery returns ErrPushDeliveryNotFound if such
+	// PushDelivery does not exist.
+	UpdatePushDelivery(delivery *PushDelivery) error
+
+	// QueryPushDeliveries returns the PushDeliveries of the supplied push
+	// ID ordered by creation time.
+	QueryPushDeliveries(pushID string) ([]PushDelivery, error)
+
+	// ClaimRetryPushDeliveries returns at most limit retrying
+	// PushDeliveries with NextAttemptAt before t. NextAttemptAt of the
+	// returned PushDeliveries is set to lockUntil, such that they are not
+	// claimed again before lockUntil.
+	ClaimRetryPushDeliveries(t time.Time, lockUntil time.Time, limit int) ([]PushDelivery, error)
+
+	// DeletePushDeliveries removes PushDeliveries not retrying and not
+	// updated since updatedBefore, and returns the number removed.
+	DeletePushDeliveries(updatedBefore time.Time) (int, error)
+}
+
+// AssetUploadConn encapsulates the progress of resumable asset uploads.
+type AssetUploadConn interface {
+	// CreateAssetUpload saves a new AssetUpload. ID, CreatedAt and
+	// UpdatedAt are assigned if empty.
+	CreateAssetUpload(upload *AssetUpload) error
+
+	// GetAssetUpload returns the AssetUpload with the supplied ID.
+	//
+	// GetAssetUpload returns ErrAssetUploadNotFound if such AssetUpload
+	// does not exist.
+	GetAssetUpload(id string, upload *AssetUpload) error
+
+	// AppendAssetUploadChunk appends the named chunk of size bytes to the
+	// AssetUpload, advancing its offset. The chunk is appended only if
+	// offset is the current offset of the AssetUpload, such that
+	// concurrent uploads of the same chunk are appended at most once.
+	//
+	// AppendAssetUploadChunk returns ErrAssetUploadOffsetMismatch if the
+	// offset does not match or the chunk exceeds the length of the
+	// AssetUpload, and ErrAssetUploadNotFound if such AssetUpload does not
+	// exist.
+	AppendAssetUploadChunk(id string, offset int64, chunk string, size int64) error
+
+	// TouchAssetUpload updates the AssetUpload as if it is updated now,
+	// such that an upload in progress elsewhere is not expired.
+	//
+	// TouchAssetUpload returns ErrAssetUploadNotFound if such AssetUpload
+	// does not exist.
+	TouchAssetUpload(id string) error
+
+	// DeleteAssetUpload removes the AssetUpload with the supplied ID.
+	//
+	// DeleteAssetUpload returns ErrAssetUploadNotFound if such
+	// AssetUpload does not exist.
+	DeleteAssetUpload(id string) error
+
+	// QueryExpiredAssetUploads returns at most limit AssetUploads not
+	// updated since updatedBefore, the least recently updated first.
+	QueryExpiredAssetUploads(updatedBefore time.Time, limit int) ([]AssetUpload, error)
+}
+
+// AssetContentConn encapsulates the reference counts of asset contents
+// stored by hash.
+type AssetContentConn interface {
+	// ReferenceAssetContent increments the reference count of the
+	// AssetContent with the hash of content, which is saved with a
+	// reference count of 1 if it does not exist. content is updated with
+	// the saved AssetContent.
+	ReferenceAssetContent(content *AssetContent) error
+
+	// ReferenceExistingAssetContent increments the reference count of the
+	// AssetContent with the supplied hash, and returns the AssetContent.
+	//
+	// ReferenceExistingAssetContent returns ErrAssetContentNotFound if
+	// such AssetContent does not exist or is no longer referenced.
+	ReferenceExistingAssetContent(hash string, content *AssetContent) error
+
+	// DereferenceAssetContent decrements the reference count of the
+	// AssetContent with the supplied hash, and returns the AssetContent.
+	// The AssetContent is kept once its reference count drops to 0,
+	// until it is deleted with DeleteAssetContent.
+	//
+	// DereferenceAssetContent returns ErrAssetContentNotFound if such
+	// AssetContent does not exist or is no longer referenced.
+	DereferenceAssetContent(hash string, content *AssetContent) error
+
+	// DeleteAssetContent removes the AssetContent with the supplied hash
+	// if it is no longer referenced. deleteFile is called to delete the
+	// content from the asset store while the AssetContent is locked, such
+	// that it cannot be referenced before the content is deleted. The
+	// AssetContent is kept if deleteFile returns an error.
+	//
+	// DeleteAssetContent returns ErrAssetContentNotFound if such
+	// AssetContent does not exist or is referenced again.
+	DeleteAssetContent(hash string, deleteFile func() error) error
+}
+
 // AccessModel indicates the type of access control model while db query.
 //go:generate stringer -type=AccessModel
 type AccessModel int
@@ -280,7 +506,11 @@ const (
 // For RecordCreated or RecordUpdated event, Record is the newly
 // created / updated Record. For RecordDeleted, Record is the Record
 // being deleted.
+//
+// For RecordUpdated event, Original is the Record before the update if
+// it is known by the Conn implementation.
 type RecordEvent struct {
-	Record *Record
-	Event  RecordHookEvent
+	Record   *Record
+	Original *Record
+	Event    RecordHookEvent
 }
@@ -0,0 +1,36 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package skydb
+
+import "time"
+
+// Job represents a lambda scheduled to be executed at a later time.
+//
+// Job with a non-empty Key is unique among jobs not yet executed, such that
+// the same job would not be scheduled twice.
+type Job struct {
+	ID          string
+	Name        string
+	Args        interface{}
+	Key         string
+	RunAt       time.Time
+	Attempts    int
+	MaxAttempts int
+	LastError   string
+	CreatedAt   time.Time
+	// ClaimedUntil is the time until which the Job is claimed by a worker
+	// executing it, or zero if the Job is not claimed.
+	ClaimedUntil time.Time
+}
@@ -316,6 +316,44 @@ func (_mr *MockConnMockRecorder) SaveAsset(arg0 interface{}) *gomock.Call {
 	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "SaveAsset", reflect.TypeOf((*MockConn)(nil).SaveAsset), arg0)
 }
 
+// DeleteAsset mocks base method
+func (_m *MockConn) DeleteAsset(name string) error {
+	ret := _m.ctrl.Call(_m, "DeleteAsset", name)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteAsset indicates an expected call of DeleteAsset
+func (_mr *MockConnMockRecorder) DeleteAsset(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "DeleteAsset", reflect.TypeOf((*MockConn)(nil).DeleteAsset), arg0)
+}
+
+// QueryOrphanedAssets mocks base method
+func (_m *MockConn) QueryOrphanedAssets(assetColumns map[string][]string, createdBefore time.Time, limit int) ([]Asset, error) {
+	ret := _m.ctrl.Call(_m, "QueryOrphanedAssets", assetColumns, createdBefore, limit)
+	ret0, _ := ret[0].([]Asset)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// QueryOrphanedAssets indicates an expected call of QueryOrphanedAssets
+func (_mr *MockConnMockRecorder) QueryOrphanedAssets(arg0, arg1, arg2 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "QueryOrphanedAssets", reflect.TypeOf((*MockConn)(nil).QueryOrphanedAssets), arg0, arg1, arg2)
+}
+
+// QueryAssets mocks base method
+func (_m *MockConn) QueryAssets(after string, limit int) ([]Asset, error) {
+	ret := _m.ctrl.Call(_m, "QueryAssets", after, limit)
+	ret0, _ := ret[0].([]Asset)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// QueryAssets indicates an expected call of QueryAssets
+func (_mr *MockConnMockRecorder) QueryAssets(arg0, arg1 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "QueryAssets", reflect.TypeOf((*MockConn)(nil).QueryAssets), arg0, arg1)
+}
+
 // QueryRelation mocks base method
 func (_m *MockConn) QueryRelation(user string, name string, direction string, config QueryConfig) []AuthInfo {
 	ret := _m.ctrl.Call(_m, "QueryRelation", user, name, direction, config)
@@ -403,6 +441,19 @@ func (_mr *MockConnMockRecorder) QueryDevicesByUserAndTopic(arg0, arg1 interface
 	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "QueryDevicesByUserAndTopic", reflect.TypeOf((*MockConn)(nil).QueryDevicesByUserAndTopic), arg0, arg1)
 }
 
+// QueryDevicesByTopic mocks base method
+func (_m *MockConn) QueryDevicesByTopic(topic string, afterID string, limit int) ([]Device, error) {
+	ret := _m.ctrl.Call(_m, "QueryDevicesByTopic", topic, afterID, limit)
+	ret0, _ := ret[0].([]Device)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// QueryDevicesByTopic indicates an expected call of QueryDevicesByTopic
+func (_mr *MockConnMockRecorder) QueryDevicesByTopic(arg0, arg1, arg2 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "QueryDevicesByTopic", reflect.TypeOf((*MockConn)(nil).QueryDevicesByTopic), arg0, arg1, arg2)
+}
+
 // SaveDevice mocks base method
 func (_m *MockConn) SaveDevice(device *Device) error {
 	ret := _m.ctrl.Call(_m, "SaveDevice", device)
@@ -631,6 +682,315 @@ func (_mr *MockConnMockRecorder) DeleteCustomTokenInfo(arg0 interface{}) *gomock
 	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "DeleteCustomTokenInfo", reflect.TypeOf((*MockConn)(nil).DeleteCustomTokenInfo), arg0)
 }
 
+// CreateJob mocks base method
+func (_m *MockConn) CreateJob(job *Job) error {
+	ret := _m.ctrl.Call(_m, "CreateJob", job)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// CreateJob indicates an expected call of CreateJob
+func (_mr *MockConnMockRecorder) CreateJob(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "CreateJob", reflect.TypeOf((*MockConn)(nil).CreateJob), arg0)
+}
+
+// ClaimDueJobs mocks base method
+func (_m *MockConn) ClaimDueJobs(t time.Time, lockUntil time.Time, limit int) ([]Job, error) {
+	ret := _m.ctrl.Call(_m, "ClaimDueJobs", t, lockUntil, limit)
+	ret0, _ := ret[0].([]Job)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ClaimDueJobs indicates an expected call of ClaimDueJobs
+func (_mr *MockConnMockRecorder) ClaimDueJobs(arg0, arg1, arg2 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "ClaimDueJobs", reflect.TypeOf((*MockConn)(nil).ClaimDueJobs), arg0, arg1, arg2)
+}
+
+// UpdateJob mocks base method
+func (_m *MockConn) UpdateJob(job *Job) error {
+	ret := _m.ctrl.Call(_m, "UpdateJob", job)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UpdateJob indicates an expected call of UpdateJob
+func (_mr *MockConnMockRecorder) UpdateJob(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "UpdateJob", reflect.TypeOf((*MockConn)(nil).UpdateJob), arg0)
+}
+
+// DeleteJob mocks base method
+func (_m *MockConn) DeleteJob(id string) error {
+	ret := _m.ctrl.Call(_m, "DeleteJob", id)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteJob indicates an expected call of DeleteJob
+func (_mr *MockConnMockRecorder) DeleteJob(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "DeleteJob", reflect.TypeOf((*MockConn)(nil).DeleteJob), arg0)
+}
+
+// DeleteJobsByKeyPrefix mocks base method
+func (_m *MockConn) DeleteJobsByKeyPrefix(prefix string) (int, error) {
+	ret := _m.ctrl.Call(_m, "DeleteJobsByKeyPrefix", prefix)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// DeleteJobsByKeyPrefix indicates an expected call of DeleteJobsByKeyPrefix
+func (_mr *MockConnMockRecorder) DeleteJobsByKeyPrefix(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "DeleteJobsByKeyPrefix", reflect.TypeOf((*MockConn)(nil).DeleteJobsByKeyPrefix), arg0)
+}
+
+// CancelJobsByKeyPrefix mocks base method
+func (_m *MockConn) CancelJobsByKeyPrefix(prefix string, t time.Time) (int, int, error) {
+	ret := _m.ctrl.Call(_m, "CancelJobsByKeyPrefix", prefix, t)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(int)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// CancelJobsByKeyPrefix indicates an expected call of CancelJobsByKeyPrefix
+func (_mr *MockConnMockRecorder) CancelJobsByKeyPrefix(arg0, arg1 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "CancelJobsByKeyPrefix", reflect.TypeOf((*MockConn)(nil).CancelJobsByKeyPrefix), arg0, arg1)
+}
+
+// GetPushTemplate mocks base method
+func (_m *MockConn) GetPushTemplate(name string, template *PushTemplate) error {
+	ret := _m.ctrl.Call(_m, "GetPushTemplate", name, template)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// GetPushTemplate indicates an expected call of GetPushTemplate
+func (_mr *MockConnMockRecorder) GetPushTemplate(arg0, arg1 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "GetPushTemplate", reflect.TypeOf((*MockConn)(nil).GetPushTemplate), arg0, arg1)
+}
+
+// QueryPushTemplates mocks base method
+func (_m *MockConn) QueryPushTemplates() ([]PushTemplate, error) {
+	ret := _m.ctrl.Call(_m, "QueryPushTemplates")
+	ret0, _ := ret[0].([]PushTemplate)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// QueryPushTemplates indicates an expected call of QueryPushTemplates
+func (_mr *MockConnMockRecorder) QueryPushTemplates() *gomock.Call {
+	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "QueryPushTemplates", reflect.TypeOf((*MockConn)(nil).QueryPushTemplates))
+}
+
+// SavePushTemplate mocks base method
+func (_m *MockConn) SavePushTemplate(template *PushTemplate) error {
+	ret := _m.ctrl.Call(_m, "SavePushTemplate", template)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SavePushTemplate indicates an expected call of SavePushTemplate
+func (_mr *MockConnMockRecorder) SavePushTemplate(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "SavePushTemplate", reflect.TypeOf((*MockConn)(nil).SavePushTemplate), arg0)
+}
+
+// DeletePushTemplate mocks base method
+func (_m *MockConn) DeletePushTemplate(name string) error {
+	ret := _m.ctrl.Call(_m, "DeletePushTemplate", name)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeletePushTemplate indicates an expected call of DeletePushTemplate
+func (_mr *MockConnMockRecorder) DeletePushTemplate(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "DeletePushTemplate", reflect.TypeOf((*MockConn)(nil).DeletePushTemplate), arg0)
+}
+
+// CreatePushDelivery mocks base method
+func (_m *MockConn) CreatePushDelivery(delivery *PushDelivery) error {
+	ret := _m.ctrl.Call(_m, "CreatePushDelivery", delivery)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// CreatePushDelivery indicates an expected call of CreatePushDelivery
+func (_mr *MockConnMockRecorder) CreatePushDelivery(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "CreatePushDelivery", reflect.TypeOf((*MockConn)(nil).CreatePushDelivery), arg0)
+}
+
+// UpdatePushDelivery mocks base method
+func (_m *MockConn) UpdatePushDelivery(delivery *PushDelivery) error {
+	ret := _m.ctrl.Call(_m, "UpdatePushDelivery", delivery)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UpdatePushDelivery indicates an expected call of UpdatePushDelivery
+func (_mr *MockConnMockRecorder) UpdatePushDelivery(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "UpdatePushDelivery", reflect.TypeOf((*MockConn)(nil).UpdatePushDelivery), arg0)
+}
+
+// QueryPushDeliveries mocks base method
+func (_m *MockConn) QueryPushDeliveries(pushID string) ([]PushDelivery, error) {
+	ret := _m.ctrl.Call(_m, "QueryPushDeliveries", pushID)
+	ret0, _ := ret[0].([]PushDelivery)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// QueryPushDeliveries indicates an expected call of QueryPushDeliveries
+func (_mr *MockConnMockRecorder) QueryPushDeliveries(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "QueryPushDeliveries", reflect.TypeOf((*MockConn)(nil).QueryPushDeliveries), arg0)
+}
+
+// ClaimRetryPushDeliveries mocks base method
+func (_m *MockConn) ClaimRetryPushDeliveries(t time.Time, lockUntil time.Time, limit int) ([]PushDelivery, error) {
+	ret := _m.ctrl.Call(_m, "ClaimRetryPushDeliveries", t, lockUntil, limit)
+	ret0, _ := ret[0].([]PushDelivery)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ClaimRetryPushDeliveries indicates an expected call of ClaimRetryPushDeliveries
+func (_mr *MockConnMockRecorder) ClaimRetryPushDeliveries(arg0, arg1, arg2 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "ClaimRetryPushDeliveries", reflect.TypeOf((*MockConn)(nil).ClaimRetryPushDeliveries), arg0, arg1, arg2)
+}
+
+// DeletePushDeliveries mocks base method
+func (_m *MockConn) DeletePushDeliveries(updatedBefore time.Time) (int, error) {
+	ret := _m.ctrl.Call(_m, "DeletePushDeliveries", updatedBefore)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// DeletePushDeliveries indicates an expected call of DeletePushDeliveries
+func (_mr *MockConnMockRecorder) DeletePushDeliveries(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "DeletePushDeliveries", reflect.TypeOf((*MockConn)(nil).DeletePushDeliveries), arg0)
+}
+
+// CreateAssetUpload mocks base method
+func (_m *MockConn) CreateAssetUpload(upload *AssetUpload) error {
+	ret := _m.ctrl.Call(_m, "CreateAssetUpload", upload)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// CreateAssetUpload indicates an expected call of CreateAssetUpload
+func (_mr *MockConnMockRecorder) CreateAssetUpload(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "CreateAssetUpload", reflect.TypeOf((*MockConn)(nil).CreateAssetUpload), arg0)
+}
+
+// GetAssetUpload mocks base method
+func (_m *MockConn) GetAssetUpload(id string, upload *AssetUpload) error {
+	ret := _m.ctrl.Call(_m, "GetAssetUpload", id, upload)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// GetAssetUpload indicates an expected call of GetAssetUpload
+func (_mr *MockConnMockRecorder) GetAssetUpload(arg0, arg1 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "GetAssetUpload", reflect.TypeOf((*MockConn)(nil).GetAssetUpload), arg0, arg1)
+}
+
+// AppendAssetUploadChunk mocks base method
+func (_m *MockConn) AppendAssetUploadChunk(id string, offset int64, chunk string, size int64) error {
+	ret := _m.ctrl.Call(_m, "AppendAssetUploadChunk", id, offset, chunk, size)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// AppendAssetUploadChunk indicates an expected call of AppendAssetUploadChunk
+func (_mr *MockConnMockRecorder) AppendAssetUploadChunk(arg0, arg1, arg2, arg3 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "AppendAssetUploadChunk", reflect.TypeOf((*MockConn)(nil).AppendAssetUploadChunk), arg0, arg1, arg2, arg3)
+}
+
+// TouchAssetUpload mocks base method
+func (_m *MockConn) TouchAssetUpload(id string) error {
+	ret := _m.ctrl.Call(_m, "TouchAssetUpload", id)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// TouchAssetUpload indicates an expected call of TouchAssetUpload
+func (_mr *MockConnMockRecorder) TouchAssetUpload(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "TouchAssetUpload", reflect.TypeOf((*MockConn)(nil).TouchAssetUpload), arg0)
+}
+
+// DeleteAssetUpload mocks base method
+func (_m *MockConn) DeleteAssetUpload(id string) error {
+	ret := _m.ctrl.Call(_m, "DeleteAssetUpload", id)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteAssetUpload indicates an expected call of DeleteAssetUpload
+func (_mr *MockConnMockRecorder) DeleteAssetUpload(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "DeleteAssetUpload", reflect.TypeOf((*MockConn)(nil).DeleteAssetUpload), arg0)
+}
+
+// QueryExpiredAssetUploads mocks base method
+func (_m *MockConn) QueryExpiredAssetUploads(updatedBefore time.Time, limit int) ([]AssetUpload, error) {
+	ret := _m.ctrl.Call(_m, "QueryExpiredAssetUploads", updatedBefore, limit)
+	ret0, _ := ret[0].([]AssetUpload)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// QueryExpiredAssetUploads indicates an expected call of QueryExpiredAssetUploads
+func (_mr *MockConnMockRecorder) QueryExpiredAssetUploads(arg0, arg1 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "QueryExpiredAssetUploads", reflect.TypeOf((*MockConn)(nil).QueryExpiredAssetUploads), arg0, arg1)
+}
+
+// ReferenceAssetContent mocks base method
+func (_m *MockConn) ReferenceAssetContent(content *AssetContent) error {
+	ret := _m.ctrl.Call(_m, "ReferenceAssetContent", content)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// ReferenceAssetContent indicates an expected call of ReferenceAssetContent
+func (_mr *MockConnMockRecorder) ReferenceAssetContent(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "ReferenceAssetContent", reflect.TypeOf((*MockConn)(nil).ReferenceAssetContent), arg0)
+}
+
+// ReferenceExistingAssetContent mocks base method
+func (_m *MockConn) ReferenceExistingAssetContent(hash string, content *AssetContent) error {
+	ret := _m.ctrl.Call(_m, "ReferenceExistingAssetContent", hash, content)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// ReferenceExistingAssetContent indicates an expected call of ReferenceExistingAssetContent
+func (_mr *MockConnMockRecorder) ReferenceExistingAssetContent(arg0, arg1 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "ReferenceExistingAssetContent", reflect.TypeOf((*MockConn)(nil).ReferenceExistingAssetContent), arg0, arg1)
+}
+
+// DereferenceAssetContent mocks base method
+func (_m *MockConn) DereferenceAssetContent(hash string, content *AssetContent) error {
+	ret := _m.ctrl.Call(_m, "DereferenceAssetContent", hash, content)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DereferenceAssetContent indicates an expected call of DereferenceAssetContent
+func (_mr *MockConnMockRecorder) DereferenceAssetContent(arg0, arg1 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "DereferenceAssetContent", reflect.TypeOf((*MockConn)(nil).DereferenceAssetContent), arg0, arg1)
+}
+
+// DeleteAssetContent mocks base method
+func (_m *MockConn) DeleteAssetContent(hash string, deleteFile func() error) error {
+	ret := _m.ctrl.Call(_m, "DeleteAssetContent", hash, deleteFile)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteAssetContent indicates an expected call of DeleteAssetContent
+func (_mr *MockConnMockRecorder) DeleteAssetContent(arg0, arg1 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "DeleteAssetContent", reflect.TypeOf((*MockConn)(nil).DeleteAssetContent), arg0, arg1)
+}
+
 // MockCustomTokenConn is a mock of CustomTokenConn interface
 type MockCustomTokenConn struct {
 	ctrl     *gomock.Controller
@@ -689,3 +1049,304 @@ func (_m *MockCustomTokenConn) DeleteCustomTokenInfo(principalID string) error {
 func (_mr *MockCustomTokenConnMockRecorder) DeleteCustomTokenInfo(arg0 interface{}) *gomock.Call {
 	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "DeleteCustomTokenInfo", reflect.TypeOf((*MockCustomTokenConn)(nil).DeleteCustomTokenInfo), arg0)
 }
+
+// MockJobConn is a mock of JobConn interface
+type MockJobConn struct {
+	ctrl     *gomock.Controller
+	recorder *MockJobConnMockRecorder
+}
+
+// MockJobConnMockRecorder is the mock recorder for MockJobConn
+type MockJobConnMockRecorder struct {
+	mock *MockJobConn
+}
+
+// NewMockJobConn creates a new mock instance
+func NewMockJobConn(ctrl *gomock.Controller) *MockJobConn {
+	mock := &MockJobConn{ctrl: ctrl}
+	mock.recorder = &MockJobConnMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use
+func (_m *MockJobConn) EXPECT() *MockJobConnMockRecorder {
+	return _m.recorder
+}
+
+// CreateJob mocks base method
+func (_m *MockJobConn) CreateJob(job *Job) error {
+	ret := _m.ctrl.Call(_m, "CreateJob", job)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// CreateJob indicates an expected call of CreateJob
+func (_mr *MockJobConnMockRecorder) CreateJob(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "CreateJob", reflect.TypeOf((*MockJobConn)(nil).CreateJob), arg0)
+}
+
+// ClaimDueJobs mocks base method
+func (_m *MockJobConn) ClaimDueJobs(t time.Time, lockUntil time.Time, limit int) ([]Job, error) {
+	ret := _m.ctrl.Call(_m, "ClaimDueJobs", t, lockUntil, limit)
+	ret0, _ := ret[0].([]Job)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ClaimDueJobs indicates an expected call of ClaimDueJobs
+func (_mr *MockJobConnMockRecorder) ClaimDueJobs(arg0, arg1, arg2 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "ClaimDueJobs", reflect.TypeOf((*MockJobConn)(nil).ClaimDueJobs), arg0, arg1, arg2)
+}
+
+// UpdateJob mocks base method
+func (_m *MockJobConn) UpdateJob(job *Job) error {
+	ret := _m.ctrl.Call(_m, "UpdateJob", job)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UpdateJob indicates an expected call of UpdateJob
+func (_mr *MockJobConnMockRecorder) UpdateJob(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "UpdateJob", reflect.TypeOf((*MockJobConn)(nil).UpdateJob), arg0)
+}
+
+// DeleteJob mocks base method
+func (_m *MockJobConn) DeleteJob(id string) error {
+	ret := _m.ctrl.Call(_m, "DeleteJob", id)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteJob indicates an expected call of DeleteJob
+func (_mr *MockJobConnMockRecorder) DeleteJob(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "DeleteJob", reflect.TypeOf((*MockJobConn)(nil).DeleteJob), arg0)
+}
+
+// DeleteJobsByKeyPrefix mocks base method
+func (_m *MockJobConn) DeleteJobsByKeyPrefix(prefix string) (int, error) {
+	ret := _m.ctrl.Call(_m, "DeleteJobsByKeyPrefix", prefix)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// DeleteJobsByKeyPrefix indicates an expected call of DeleteJobsByKeyPrefix
+func (_mr *MockJobConnMockRecorder) DeleteJobsByKeyPrefix(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "DeleteJobsByKeyPrefix", reflect.TypeOf((*MockJobConn)(nil).DeleteJobsByKeyPrefix), arg0)
+}
+
+// MockPushTemplateConn is a mock of PushTemplateConn interface
+type MockPushTemplateConn struct {
+	ctrl     *gomock.Controller
+	recorder *MockPushTemplateConnMockRecorder
+}
+
+// MockPushTemplateConnMockRecorder is the mock recorder for MockPushTemplateConn
+type MockPushTemplateConnMockRecorder struct {
+	mock *MockPushTemplateConn
+}
+
+// NewMockPushTemplateConn creates a new mock instance
+func NewMockPushTemplateConn(ctrl *gomock.Controller) *MockPushTemplateConn {
+	mock := &MockPushTemplateConn{ctrl: ctrl}
+	mock.recorder = &MockPushTemplateConnMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use
+func (_m *MockPushTemplateConn) EXPECT() *MockPushTemplateConnMockRecorder {
+	return _m.recorder
+}
+
+// GetPushTemplate mocks base method
+func (_m *MockPushTemplateConn) GetPushTemplate(name string, template *PushTemplate) error {
+	ret := _m.ctrl.Call(_m, "GetPushTemplate", name, template)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// GetPushTemplate indicates an expected call of GetPushTemplate
+func (_mr *MockPushTemplateConnMockRecorder) GetPushTemplate(arg0, arg1 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "GetPushTemplate", reflect.TypeOf((*MockPushTemplateConn)(nil).GetPushTemplate), arg0, arg1)
+}
+
+// QueryPushTemplates mocks base method
+func (_m *MockPushTemplateConn) QueryPushTemplates() ([]PushTemplate, error) {
+	ret := _m.ctrl.Call(_m, "QueryPushTemplates")
+	ret0, _ := ret[0].([]PushTemplate)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// QueryPushTemplates indicates an expected call of QueryPushTemplates
+func (_mr *MockPushTemplateConnMockRecorder) QueryPushTemplates() *gomock.Call {
+	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "QueryPushTemplates", reflect.TypeOf((*MockPushTemplateConn)(nil).QueryPushTemplates))
+}
+
+// SavePushTemplate mocks base method
+func (_m *MockPushTemplateConn) SavePushTemplate(template *PushTemplate) error {
+	ret := _m.ctrl.Call(_m, "SavePushTemplate", template)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SavePushTemplate indicates an expected call of SavePushTemplate
+func (_mr *MockPushTemplateConnMockRecorder) SavePushTemplate(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "SavePushTemplate", reflect.TypeOf((*MockPushTemplateConn)(nil).SavePushTemplate), arg0)
+}
+
+// DeletePushTemplate mocks base method
+func (_m *MockPushTemplateConn) DeletePushTemplate(name string) error {
+	ret := _m.ctrl.Call(_m, "DeletePushTemplate", name)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeletePushTemplate indicates an expected call of DeletePushTemplate
+func (_mr *MockPushTemplateConnMockRecorder) DeletePushTemplate(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "DeletePushTemplate", reflect.TypeOf((*MockPushTemplateConn)(nil).DeletePushTemplate), arg0)
+}
+
+// MockPushDeliveryConn is a mock of PushDeliveryConn interface
+type MockPushDeliveryConn struct {
+	ctrl     *gomock.Controller
+	recorder *MockPushDeliveryConnMockRecorder
+}
+
+// MockPushDeliveryConnMockRecorder is the mock recorder for MockPushDeliveryConn
+type MockPushDeliveryConnMockRecorder struct {
+	mock *MockPushDeliveryConn
+}
+
+// NewMockPushDeliveryConn creates a new mock instance
+func NewMockPushDeliveryConn(ctrl *gomock.Controller) *MockPushDeliveryConn {
+	mock := &MockPushDeliveryConn{ctrl: ctrl}
+	mock.recorder = &MockPushDeliveryConnMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use
+func (_m *MockPushDeliveryConn) EXPECT() *MockPushDeliveryConnMockRecorder {
+	return _m.recorder
+}
+
+// CreatePushDelivery mocks base method
+func (_m *MockPushDeliveryConn) CreatePushDelivery(delivery *PushDelivery) error {
+	ret := _m.ctrl.Call(_m, "CreatePushDelivery", delivery)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// CreatePushDelivery indicates an expected call of CreatePushDelivery
+func (_mr *MockPushDeliveryConnMockRecorder) CreatePushDelivery(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "CreatePushDelivery", reflect.TypeOf((*MockPushDeliveryConn)(nil).CreatePushDelivery), arg0)
+}
+
+// UpdatePushDelivery mocks base method
+func (_m *MockPushDeliveryConn) UpdatePushDelivery(delivery *PushDelivery) error {
+	ret := _m.ctrl.Call(_m, "UpdatePushDelivery", delivery)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UpdatePushDelivery indicates an expected call of UpdatePushDelivery
+func (_mr *MockPushDeliveryConnMockRecorder) UpdatePushDelivery(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "UpdatePushDelivery", reflect.TypeOf((*MockPushDeliveryConn)(nil).UpdatePushDelivery), arg0)
+}
+
+// QueryPushDeliveries mocks base method
+func (_m *MockPushDeliveryConn) QueryPushDeliveries(pushID string) ([]PushDelivery, error) {
+	ret := _m.ctrl.Call(_m, "QueryPushDeliveries", pushID)
+	ret0, _ := ret[0].([]PushDelivery)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// QueryPushDeliveries indicates an expected call of QueryPushDeliveries
+func (_mr *MockPushDeliveryConnMockRecorder) QueryPushDeliveries(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "QueryPushDeliveries", reflect.TypeOf((*MockPushDeliveryConn)(nil).QueryPushDeliveries), arg0)
+}
+
+// ClaimRetryPushDeliveries mocks base method
+func (_m *MockPushDeliveryConn) ClaimRetryPushDeliveries(t time.Time, lockUntil time.Time, limit int) ([]PushDelivery, error) {
+	ret := _m.ctrl.Call(_m, "ClaimRetryPushDeliveries", t, lockUntil, limit)
+	ret0, _ := ret[0].([]PushDelivery)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ClaimRetryPushDeliveries indicates an expected call of ClaimRetryPushDeliveries
+func (_mr *MockPushDeliveryConnMockRecorder) ClaimRetryPushDeliveries(arg0, arg1, arg2 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "ClaimRetryPushDeliveries", reflect.TypeOf((*MockPushDeliveryConn)(nil).ClaimRetryPushDeliveries), arg0, arg1, arg2)
+}
+
+// MockAssetUploadConn is a mock of AssetUploadConn interface
+type MockAssetUploadConn struct {
+	ctrl     *gomock.Controller
+	recorder *MockAssetUploadConnMockRecorder
+}
+
+// MockAssetUploadConnMockRecorder is the mock recorder for MockAssetUploadConn
+type MockAssetUploadConnMockRecorder struct {
+	mock *MockAssetUploadConn
+}
+
+// NewMockAssetUploadConn creates a new mock instance
+func NewMockAssetUploadConn(ctrl *gomock.Controller) *MockAssetUploadConn {
+	mock := &MockAssetUploadConn{ctrl: ctrl}
+	mock.recorder = &MockAssetUploadConnMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use
+func (_m *MockAssetUploadConn) EXPECT() *MockAssetUploadConnMockRecorder {
+	return _m.recorder
+}
+
+// CreateAssetUpload mocks base method
+func (_m *MockAssetUploadConn) CreateAssetUpload(upload *AssetUpload) error {
+	ret := _m.ctrl.Call(_m, "CreateAssetUpload", upload)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// CreateAssetUpload indicates an expected call of CreateAssetUpload
+func (_mr *MockAssetUploadConnMockRecorder) CreateAssetUpload(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "CreateAssetUpload", reflect.TypeOf((*MockAssetUploadConn)(nil).CreateAssetUpload), arg0)
+}
+
+// GetAssetUpload mocks base method
+func (_m *MockAssetUploadConn) GetAssetUpload(id string, upload *AssetUpload) error {
+	ret := _m.ctrl.Call(_m, "GetAssetUpload", id, upload)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// GetAssetUpload indicates an expected call of GetAssetUpload
+func (_mr *MockAssetUploadConnMockRecorder) GetAssetUpload(arg0, arg1 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "GetAssetUpload", reflect.TypeOf((*MockAssetUploadConn)(nil).GetAssetUpload), arg0, arg1)
+}
+
+// AppendAssetUploadChunk mocks base method
+func (_m *MockAssetUploadConn) AppendAssetUploadChunk(id string, offset int64, chunk string, size int64) error {
+	ret := _m.ctrl.Call(_m, "AppendAssetUploadChunk", id, offset, chunk, size)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// AppendAssetUploadChunk indicates an expected call of AppendAssetUploadChunk
+func (_mr *MockAssetUploadConnMockRecorder) AppendAssetUploadChunk(arg0, arg1, arg2, arg3 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "AppendAssetUploadChunk", reflect.TypeOf((*MockAssetUploadConn)(nil).AppendAssetUploadChunk), arg0, arg1, arg2, arg3)
+}
+
+// DeleteAssetUpload mocks base method
+func (_m *MockAssetUploadConn) DeleteAssetUpload(id string) error {
+	ret := _m.ctrl.Call(_m, "DeleteAssetUpload", id)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteAssetUpload indicates an expected call of DeleteAssetUpload
+func (_mr *MockAssetUploadConnMockRecorder) DeleteAssetUpload(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "DeleteAssetUpload", reflect.TypeOf((*MockAssetUploadConn)(nil).DeleteAssetUpload), arg0)
+}
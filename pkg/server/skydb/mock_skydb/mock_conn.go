@@ -45,6 +45,18 @@ func (_mr *MockConnMockRecorder) AddRelation(arg0, arg1, arg2 interface{}) *gomo
 	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "AddRelation", reflect.TypeOf((*MockConn)(nil).AddRelation), arg0, arg1, arg2)
 }
 
+// AppendAssetUploadChunk mocks base method
+func (_m *MockConn) AppendAssetUploadChunk(_param0 string, _param1 int64, _param2 string, _param3 int64) error {
+	ret := _m.ctrl.Call(_m, "AppendAssetUploadChunk", _param0, _param1, _param2, _param3)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// AppendAssetUploadChunk indicates an expected call of AppendAssetUploadChunk
+func (_mr *MockConnMockRecorder) AppendAssetUploadChunk(arg0, arg1, arg2, arg3 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "AppendAssetUploadChunk", reflect.TypeOf((*MockConn)(nil).AppendAssetUploadChunk), arg0, arg1, arg2, arg3)
+}
+
 // AssignRoles mocks base method
 func (_m *MockConn) AssignRoles(_param0 []string, _param1 []string) error {
 	ret := _m.ctrl.Call(_m, "AssignRoles", _param0, _param1)
@@ -57,6 +69,46 @@ func (_mr *MockConnMockRecorder) AssignRoles(arg0, arg1 interface{}) *gomock.Cal
 	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "AssignRoles", reflect.TypeOf((*MockConn)(nil).AssignRoles), arg0, arg1)
 }
 
+// CancelJobsByKeyPrefix mocks base method
+func (_m *MockConn) CancelJobsByKeyPrefix(_param0 string, _param1 time.Time) (int, int, error) {
+	ret := _m.ctrl.Call(_m, "CancelJobsByKeyPrefix", _param0, _param1)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(int)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// CancelJobsByKeyPrefix indicates an expected call of CancelJobsByKeyPrefix
+func (_mr *MockConnMockRecorder) CancelJobsByKeyPrefix(arg0, arg1 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "CancelJobsByKeyPrefix", reflect.TypeOf((*MockConn)(nil).CancelJobsByKeyPrefix), arg0, arg1)
+}
+
+// ClaimDueJobs mocks base method
+func (_m *MockConn) ClaimDueJobs(_param0 time.Time, _param1 time.Time, _param2 int) ([]skydb.Job, error) {
+	ret := _m.ctrl.Call(_m, "ClaimDueJobs", _param0, _param1, _param2)
+	ret0, _ := ret[0].([]skydb.Job)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ClaimDueJobs indicates an expected call of ClaimDueJobs
+func (_mr *MockConnMockRecorder) ClaimDueJobs(arg0, arg1, arg2 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "ClaimDueJobs", reflect.TypeOf((*MockConn)(nil).ClaimDueJobs), arg0, arg1, arg2)
+}
+
+// ClaimRetryPushDeliveries mocks base method
+func (_m *MockConn) ClaimRetryPushDeliveries(_param0 time.Time, _param1 time.Time, _param2 int) ([]skydb.PushDelivery, error) {
+	ret := _m.ctrl.Call(_m, "ClaimRetryPushDeliveries", _param0, _param1, _param2)
+	ret0, _ := ret[0].([]skydb.PushDelivery)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ClaimRetryPushDeliveries indicates an expected call of ClaimRetryPushDeliveries
+func (_mr *MockConnMockRecorder) ClaimRetryPushDeliveries(arg0, arg1, arg2 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "ClaimRetryPushDeliveries", reflect.TypeOf((*MockConn)(nil).ClaimRetryPushDeliveries), arg0, arg1, arg2)
+}
+
 // Close mocks base method
 func (_m *MockConn) Close() error {
 	ret := _m.ctrl.Call(_m, "Close")
@@ -69,6 +121,18 @@ func (_mr *MockConnMockRecorder) Close() *gomock.Call {
 	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "Close", reflect.TypeOf((*MockConn)(nil).Close))
 }
 
+// CreateAssetUpload mocks base method
+func (_m *MockConn) CreateAssetUpload(_param0 *skydb.AssetUpload) error {
+	ret := _m.ctrl.Call(_m, "CreateAssetUpload", _param0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// CreateAssetUpload indicates an expected call of CreateAssetUpload
+func (_mr *MockConnMockRecorder) CreateAssetUpload(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "CreateAssetUpload", reflect.TypeOf((*MockConn)(nil).CreateAssetUpload), arg0)
+}
+
 // CreateAuth mocks base method
 func (_m *MockConn) CreateAuth(_param0 *skydb.AuthInfo) error {
 	ret := _m.ctrl.Call(_m, "CreateAuth", _param0)
@@ -93,6 +157,18 @@ func (_mr *MockConnMockRecorder) CreateCustomTokenInfo(arg0 interface{}) *gomock
 	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "CreateCustomTokenInfo", reflect.TypeOf((*MockConn)(nil).CreateCustomTokenInfo), arg0)
 }
 
+// CreateJob mocks base method
+func (_m *MockConn) CreateJob(_param0 *skydb.Job) error {
+	ret := _m.ctrl.Call(_m, "CreateJob", _param0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// CreateJob indicates an expected call of CreateJob
+func (_mr *MockConnMockRecorder) CreateJob(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "CreateJob", reflect.TypeOf((*MockConn)(nil).CreateJob), arg0)
+}
+
 // CreateOAuthInfo mocks base method
 func (_m *MockConn) CreateOAuthInfo(_param0 *skydb.OAuthInfo) error {
 	ret := _m.ctrl.Call(_m, "CreateOAuthInfo", _param0)
@@ -105,6 +181,54 @@ func (_mr *MockConnMockRecorder) CreateOAuthInfo(arg0 interface{}) *gomock.Call
 	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "CreateOAuthInfo", reflect.TypeOf((*MockConn)(nil).CreateOAuthInfo), arg0)
 }
 
+// CreatePushDelivery mocks base method
+func (_m *MockConn) CreatePushDelivery(_param0 *skydb.PushDelivery) error {
+	ret := _m.ctrl.Call(_m, "CreatePushDelivery", _param0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// CreatePushDelivery indicates an expected call of CreatePushDelivery
+func (_mr *MockConnMockRecorder) CreatePushDelivery(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "CreatePushDelivery", reflect.TypeOf((*MockConn)(nil).CreatePushDelivery), arg0)
+}
+
+// DeleteAsset mocks base method
+func (_m *MockConn) DeleteAsset(_param0 string) error {
+	ret := _m.ctrl.Call(_m, "DeleteAsset", _param0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteAsset indicates an expected call of DeleteAsset
+func (_mr *MockConnMockRecorder) DeleteAsset(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "DeleteAsset", reflect.TypeOf((*MockConn)(nil).DeleteAsset), arg0)
+}
+
+// DeleteAssetContent mocks base method
+func (_m *MockConn) DeleteAssetContent(_param0 string, _param1 func() error) error {
+	ret := _m.ctrl.Call(_m, "DeleteAssetContent", _param0, _param1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteAssetContent indicates an expected call of DeleteAssetContent
+func (_mr *MockConnMockRecorder) DeleteAssetContent(arg0, arg1 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "DeleteAssetContent", reflect.TypeOf((*MockConn)(nil).DeleteAssetContent), arg0, arg1)
+}
+
+// DeleteAssetUpload mocks base method
+func (_m *MockConn) DeleteAssetUpload(_param0 string) error {
+	ret := _m.ctrl.Call(_m, "DeleteAssetUpload", _param0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteAssetUpload indicates an expected call of DeleteAssetUpload
+func (_mr *MockConnMockRecorder) DeleteAssetUpload(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "DeleteAssetUpload", reflect.TypeOf((*MockConn)(nil).DeleteAssetUpload), arg0)
+}
+
 // DeleteAuth mocks base method
 func (_m *MockConn) DeleteAuth(_param0 string) error {
 	ret := _m.ctrl.Call(_m, "DeleteAuth", _param0)
@@ -165,6 +289,31 @@ func (_mr *MockConnMockRecorder) DeleteEmptyDevicesByTime(arg0 interface{}) *gom
 	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "DeleteEmptyDevicesByTime", reflect.TypeOf((*MockConn)(nil).DeleteEmptyDevicesByTime), arg0)
 }
 
+// DeleteJob mocks base method
+func (_m *MockConn) DeleteJob(_param0 string) error {
+	ret := _m.ctrl.Call(_m, "DeleteJob", _param0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteJob indicates an expected call of DeleteJob
+func (_mr *MockConnMockRecorder) DeleteJob(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "DeleteJob", reflect.TypeOf((*MockConn)(nil).DeleteJob), arg0)
+}
+
+// DeleteJobsByKeyPrefix mocks base method
+func (_m *MockConn) DeleteJobsByKeyPrefix(_param0 string) (int, error) {
+	ret := _m.ctrl.Call(_m, "DeleteJobsByKeyPrefix", _param0)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// DeleteJobsByKeyPrefix indicates an expected call of DeleteJobsByKeyPrefix
+func (_mr *MockConnMockRecorder) DeleteJobsByKeyPrefix(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "DeleteJobsByKeyPrefix", reflect.TypeOf((*MockConn)(nil).DeleteJobsByKeyPrefix), arg0)
+}
+
 // DeleteOAuth mocks base method
 func (_m *MockConn) DeleteOAuth(_param0 string, _param1 string) error {
 	ret := _m.ctrl.Call(_m, "DeleteOAuth", _param0, _param1)
@@ -177,6 +326,43 @@ func (_mr *MockConnMockRecorder) DeleteOAuth(arg0, arg1 interface{}) *gomock.Cal
 	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "DeleteOAuth", reflect.TypeOf((*MockConn)(nil).DeleteOAuth), arg0, arg1)
 }
 
+// DeletePushDeliveries mocks base method
+func (_m *MockConn) DeletePushDeliveries(_param0 time.Time) (int, error) {
+	ret := _m.ctrl.Call(_m, "DeletePushDeliveries", _param0)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// DeletePushDeliveries indicates an expected call of DeletePushDeliveries
+func (_mr *MockConnMockRecorder) DeletePushDeliveries(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "DeletePushDeliveries", reflect.TypeOf((*MockConn)(nil).DeletePushDeliveries), arg0)
+}
+
+// DeletePushTemplate mocks base method
+func (_m *MockConn) DeletePushTemplate(_param0 string) error {
+	ret := _m.ctrl.Call(_m, "DeletePushTemplate", _param0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeletePushTemplate indicates an expected call of DeletePushTemplate
+func (_mr *MockConnMockRecorder) DeletePushTemplate(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "DeletePushTemplate", reflect.TypeOf((*MockConn)(nil).DeletePushTemplate), arg0)
+}
+
+// DereferenceAssetContent mocks base method
+func (_m *MockConn) DereferenceAssetContent(_param0 string, _param1 *skydb.AssetContent) error {
+	ret := _m.ctrl.Call(_m, "DereferenceAssetContent", _param0, _param1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DereferenceAssetContent indicates an expected call of DereferenceAssetContent
+func (_mr *MockConnMockRecorder) DereferenceAssetContent(arg0, arg1 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "DereferenceAssetContent", reflect.TypeOf((*MockConn)(nil).DereferenceAssetContent), arg0, arg1)
+}
+
 // EnsureAuthRecordKeysExist mocks base method
 func (_m *MockConn) EnsureAuthRecordKeysExist(_param0 [][]string) error {
 	ret := _m.ctrl.Call(_m, "EnsureAuthRecordKeysExist", _param0)
@@ -226,6 +412,18 @@ func (_mr *MockConnMockRecorder) GetAsset(arg0, arg1 interface{}) *gomock.Call {
 	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "GetAsset", reflect.TypeOf((*MockConn)(nil).GetAsset), arg0, arg1)
 }
 
+// GetAssetUpload mocks base method
+func (_m *MockConn) GetAssetUpload(_param0 string, _param1 *skydb.AssetUpload) error {
+	ret := _m.ctrl.Call(_m, "GetAssetUpload", _param0, _param1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// GetAssetUpload indicates an expected call of GetAssetUpload
+func (_mr *MockConnMockRecorder) GetAssetUpload(arg0, arg1 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "GetAssetUpload", reflect.TypeOf((*MockConn)(nil).GetAssetUpload), arg0, arg1)
+}
+
 // GetAssets mocks base method
 func (_m *MockConn) GetAssets(_param0 []string) ([]skydb.Asset, error) {
 	ret := _m.ctrl.Call(_m, "GetAssets", _param0)
@@ -337,6 +535,18 @@ func (_mr *MockConnMockRecorder) GetPasswordHistory(arg0, arg1, arg2 interface{}
 	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "GetPasswordHistory", reflect.TypeOf((*MockConn)(nil).GetPasswordHistory), arg0, arg1, arg2)
 }
 
+// GetPushTemplate mocks base method
+func (_m *MockConn) GetPushTemplate(_param0 string, _param1 *skydb.PushTemplate) error {
+	ret := _m.ctrl.Call(_m, "GetPushTemplate", _param0, _param1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// GetPushTemplate indicates an expected call of GetPushTemplate
+func (_mr *MockConnMockRecorder) GetPushTemplate(arg0, arg1 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "GetPushTemplate", reflect.TypeOf((*MockConn)(nil).GetPushTemplate), arg0, arg1)
+}
+
 // GetRecordAccess mocks base method
 func (_m *MockConn) GetRecordAccess(_param0 string) (skydb.RecordACL, error) {
 	ret := _m.ctrl.Call(_m, "GetRecordAccess", _param0)
@@ -413,6 +623,32 @@ func (_mr *MockConnMockRecorder) PublicDB() *gomock.Call {
 	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "PublicDB", reflect.TypeOf((*MockConn)(nil).PublicDB))
 }
 
+// QueryAssets mocks base method
+func (_m *MockConn) QueryAssets(_param0 string, _param1 int) ([]skydb.Asset, error) {
+	ret := _m.ctrl.Call(_m, "QueryAssets", _param0, _param1)
+	ret0, _ := ret[0].([]skydb.Asset)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// QueryAssets indicates an expected call of QueryAssets
+func (_mr *MockConnMockRecorder) QueryAssets(arg0, arg1 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "QueryAssets", reflect.TypeOf((*MockConn)(nil).QueryAssets), arg0, arg1)
+}
+
+// QueryDevicesByTopic mocks base method
+func (_m *MockConn) QueryDevicesByTopic(_param0 string, _param1 string, _param2 int) ([]skydb.Device, error) {
+	ret := _m.ctrl.Call(_m, "QueryDevicesByTopic", _param0, _param1, _param2)
+	ret0, _ := ret[0].([]skydb.Device)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// QueryDevicesByTopic indicates an expected call of QueryDevicesByTopic
+func (_mr *MockConnMockRecorder) QueryDevicesByTopic(arg0, arg1, arg2 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "QueryDevicesByTopic", reflect.TypeOf((*MockConn)(nil).QueryDevicesByTopic), arg0, arg1, arg2)
+}
+
 // QueryDevicesByUser mocks base method
 func (_m *MockConn) QueryDevicesByUser(_param0 string) ([]skydb.Device, error) {
 	ret := _m.ctrl.Call(_m, "QueryDevicesByUser", _param0)
@@ -439,6 +675,58 @@ func (_mr *MockConnMockRecorder) QueryDevicesByUserAndTopic(arg0, arg1 interface
 	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "QueryDevicesByUserAndTopic", reflect.TypeOf((*MockConn)(nil).QueryDevicesByUserAndTopic), arg0, arg1)
 }
 
+// QueryExpiredAssetUploads mocks base method
+func (_m *MockConn) QueryExpiredAssetUploads(_param0 time.Time, _param1 int) ([]skydb.AssetUpload, error) {
+	ret := _m.ctrl.Call(_m, "QueryExpiredAssetUploads", _param0, _param1)
+	ret0, _ := ret[0].([]skydb.AssetUpload)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// QueryExpiredAssetUploads indicates an expected call of QueryExpiredAssetUploads
+func (_mr *MockConnMockRecorder) QueryExpiredAssetUploads(arg0, arg1 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "QueryExpiredAssetUploads", reflect.TypeOf((*MockConn)(nil).QueryExpiredAssetUploads), arg0, arg1)
+}
+
+// QueryOrphanedAssets mocks base method
+func (_m *MockConn) QueryOrphanedAssets(_param0 map[string][]string, _param1 time.Time, _param2 int) ([]skydb.Asset, error) {
+	ret := _m.ctrl.Call(_m, "QueryOrphanedAssets", _param0, _param1, _param2)
+	ret0, _ := ret[0].([]skydb.Asset)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// QueryOrphanedAssets indicates an expected call of QueryOrphanedAssets
+func (_mr *MockConnMockRecorder) QueryOrphanedAssets(arg0, arg1, arg2 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "QueryOrphanedAssets", reflect.TypeOf((*MockConn)(nil).QueryOrphanedAssets), arg0, arg1, arg2)
+}
+
+// QueryPushDeliveries mocks base method
+func (_m *MockConn) QueryPushDeliveries(_param0 string) ([]skydb.PushDelivery, error) {
+	ret := _m.ctrl.Call(_m, "QueryPushDeliveries", _param0)
+	ret0, _ := ret[0].([]skydb.PushDelivery)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// QueryPushDeliveries indicates an expected call of QueryPushDeliveries
+func (_mr *MockConnMockRecorder) QueryPushDeliveries(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "QueryPushDeliveries", reflect.TypeOf((*MockConn)(nil).QueryPushDeliveries), arg0)
+}
+
+// QueryPushTemplates mocks base method
+func (_m *MockConn) QueryPushTemplates() ([]skydb.PushTemplate, error) {
+	ret := _m.ctrl.Call(_m, "QueryPushTemplates")
+	ret0, _ := ret[0].([]skydb.PushTemplate)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// QueryPushTemplates indicates an expected call of QueryPushTemplates
+func (_mr *MockConnMockRecorder) QueryPushTemplates() *gomock.Call {
+	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "QueryPushTemplates", reflect.TypeOf((*MockConn)(nil).QueryPushTemplates))
+}
+
 // QueryRelation mocks base method
 func (_m *MockConn) QueryRelation(_param0 string, _param1 string, _param2 string, _param3 skydb.QueryConfig) []skydb.AuthInfo {
 	ret := _m.ctrl.Call(_m, "QueryRelation", _param0, _param1, _param2, _param3)
@@ -464,6 +752,30 @@ func (_mr *MockConnMockRecorder) QueryRelationCount(arg0, arg1, arg2 interface{}
 	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "QueryRelationCount", reflect.TypeOf((*MockConn)(nil).QueryRelationCount), arg0, arg1, arg2)
 }
 
+// ReferenceAssetContent mocks base method
+func (_m *MockConn) ReferenceAssetContent(_param0 *skydb.AssetContent) error {
+	ret := _m.ctrl.Call(_m, "ReferenceAssetContent", _param0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// ReferenceAssetContent indicates an expected call of ReferenceAssetContent
+func (_mr *MockConnMockRecorder) ReferenceAssetContent(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "ReferenceAssetContent", reflect.TypeOf((*MockConn)(nil).ReferenceAssetContent), arg0)
+}
+
+// ReferenceExistingAssetContent mocks base method
+func (_m *MockConn) ReferenceExistingAssetContent(_param0 string, _param1 *skydb.AssetContent) error {
+	ret := _m.ctrl.Call(_m, "ReferenceExistingAssetContent", _param0, _param1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// ReferenceExistingAssetContent indicates an expected call of ReferenceExistingAssetContent
+func (_mr *MockConnMockRecorder) ReferenceExistingAssetContent(arg0, arg1 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "ReferenceExistingAssetContent", reflect.TypeOf((*MockConn)(nil).ReferenceExistingAssetContent), arg0, arg1)
+}
+
 // RemovePasswordHistory mocks base method
 func (_m *MockConn) RemovePasswordHistory(_param0 string, _param1 int, _param2 int) error {
 	ret := _m.ctrl.Call(_m, "RemovePasswordHistory", _param0, _param1, _param2)
@@ -524,6 +836,18 @@ func (_mr *MockConnMockRecorder) SaveDevice(arg0 interface{}) *gomock.Call {
 	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "SaveDevice", reflect.TypeOf((*MockConn)(nil).SaveDevice), arg0)
 }
 
+// SavePushTemplate mocks base method
+func (_m *MockConn) SavePushTemplate(_param0 *skydb.PushTemplate) error {
+	ret := _m.ctrl.Call(_m, "SavePushTemplate", _param0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SavePushTemplate indicates an expected call of SavePushTemplate
+func (_mr *MockConnMockRecorder) SavePushTemplate(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "SavePushTemplate", reflect.TypeOf((*MockConn)(nil).SavePushTemplate), arg0)
+}
+
 // SetAdminRoles mocks base method
 func (_m *MockConn) SetAdminRoles(_param0 []string) error {
 	ret := _m.ctrl.Call(_m, "SetAdminRoles", _param0)
@@ -596,6 +920,18 @@ func (_mr *MockConnMockRecorder) Subscribe(arg0 interface{}) *gomock.Call {
 	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "Subscribe", reflect.TypeOf((*MockConn)(nil).Subscribe), arg0)
 }
 
+// TouchAssetUpload mocks base method
+func (_m *MockConn) TouchAssetUpload(_param0 string) error {
+	ret := _m.ctrl.Call(_m, "TouchAssetUpload", _param0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// TouchAssetUpload indicates an expected call of TouchAssetUpload
+func (_mr *MockConnMockRecorder) TouchAssetUpload(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "TouchAssetUpload", reflect.TypeOf((*MockConn)(nil).TouchAssetUpload), arg0)
+}
+
 // UnionDB mocks base method
 func (_m *MockConn) UnionDB() skydb.Database {
 	ret := _m.ctrl.Call(_m, "UnionDB")
@@ -620,6 +956,18 @@ func (_mr *MockConnMockRecorder) UpdateAuth(arg0 interface{}) *gomock.Call {
 	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "UpdateAuth", reflect.TypeOf((*MockConn)(nil).UpdateAuth), arg0)
 }
 
+// UpdateJob mocks base method
+func (_m *MockConn) UpdateJob(_param0 *skydb.Job) error {
+	ret := _m.ctrl.Call(_m, "UpdateJob", _param0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UpdateJob indicates an expected call of UpdateJob
+func (_mr *MockConnMockRecorder) UpdateJob(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "UpdateJob", reflect.TypeOf((*MockConn)(nil).UpdateJob), arg0)
+}
+
 // UpdateOAuthInfo mocks base method
 func (_m *MockConn) UpdateOAuthInfo(_param0 *skydb.OAuthInfo) error {
 	ret := _m.ctrl.Call(_m, "UpdateOAuthInfo", _param0)
@@ -631,3 +979,15 @@ func (_m *MockConn) UpdateOAuthInfo(_param0 *skydb.OAuthInfo) error {
 func (_mr *MockConnMockRecorder) UpdateOAuthInfo(arg0 interface{}) *gomock.Call {
 	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "UpdateOAuthInfo", reflect.TypeOf((*MockConn)(nil).UpdateOAuthInfo), arg0)
 }
+
+// UpdatePushDelivery mocks base method
+func (_m *MockConn) UpdatePushDelivery(_param0 *skydb.PushDelivery) error {
+	ret := _m.ctrl.Call(_m, "UpdatePushDelivery", _param0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UpdatePushDelivery indicates an expected call of UpdatePushDelivery
+func (_mr *MockConnMockRecorder) UpdatePushDelivery(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "UpdatePushDelivery", reflect.TypeOf((*MockConn)(nil).UpdatePushDelivery), arg0)
+}
@@ -0,0 +1,118 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pq
+
+import (
+	"context"
+	"database/sql"
+	"hash/fnv"
+	"sync"
+)
+
+// AdvisoryLock is a lock backed by a session level postgres advisory lock.
+//
+// The lock is held by a dedicated connection to the database, such that
+// the lock is released by postgres when the connection is closed, for
+// example when the instance holding the lock dies.
+type AdvisoryLock struct {
+	db    *sql.DB
+	key   int64
+	mutex sync.Mutex
+	conn  *sql.Conn
+}
+
+// NewAdvisoryLock returns an AdvisoryLock of the specified name in the
+// database specified by option.
+func NewAdvisoryLock(option string, name string) (*AdvisoryLock, error) {
+	db, err := sql.Open("postgres", option)
+	if err != nil {
+		return nil, err
+	}
+
+	return &AdvisoryLock{
+		db:  db,
+		key: advisoryLockKey(name),
+	}, nil
+}
+
+// advisoryLockKey returns the key of an advisory lock, which must be
+// a 64-bit integer, from the name of the lock.
+func advisoryLockKey(name string) int64 {
+	h := fnv.New64a()
+	h.Write([]byte(name))
+	return int64(h.Sum64())
+}
+
+// TryLock acquires the lock without waiting, and returns whether the lock
+// is acquired.
+func (l *AdvisoryLock) TryLock() (bool, error) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	ctx := context.Background()
+	if l.conn == nil {
+		conn, err := l.db.Conn(ctx)
+		if err != nil {
+			return false, err
+		}
+		l.conn = conn
+	}
+
+	var acquired bool
+	err := l.conn.QueryRowContext(ctx, "SELECT pg_try_advisory_lock($1)", l.key).
+		Scan(&acquired)
+	if err != nil {
+		l.closeConn()
+		return false, err
+	}
+	return acquired, nil
+}
+
+// Ping returns an error if the connection holding the lock is broken,
+// in which case the lock is no longer held.
+func (l *AdvisoryLock) Ping() error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if l.conn == nil {
+		return sql.ErrConnDone
+	}
+
+	var one int
+	err := l.conn.QueryRowContext(context.Background(), "SELECT 1").Scan(&one)
+	if err != nil {
+		l.closeConn()
+	}
+	return err
+}
+
+// Unlock releases the lock and closes the connection holding the lock.
+func (l *AdvisoryLock) Unlock() error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if l.conn == nil {
+		return nil
+	}
+
+	_, err := l.conn.ExecContext(context.Background(), "SELECT pg_advisory_unlock($1)", l.key)
+	l.closeConn()
+	return err
+}
+
+func (l *AdvisoryLock) closeConn() {
+	l.conn.Close()
+	l.conn = nil
+}
@@ -0,0 +1,62 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pq
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestAdvisoryLock(t *testing.T) {
+	Convey("AdvisoryLock", t, func() {
+		c := getTestConn(t)
+		defer cleanupConn(t, c)
+
+		lock1, err := NewAdvisoryLock(c.option, "skygear:test:leader")
+		So(err, ShouldBeNil)
+		lock2, err := NewAdvisoryLock(c.option, "skygear:test:leader")
+		So(err, ShouldBeNil)
+		defer lock1.Unlock()
+		defer lock2.Unlock()
+
+		Convey("is acquired by one lock at a time", func() {
+			acquired, err := lock1.TryLock()
+			So(err, ShouldBeNil)
+			So(acquired, ShouldBeTrue)
+			So(lock1.Ping(), ShouldBeNil)
+
+			acquired, err = lock2.TryLock()
+			So(err, ShouldBeNil)
+			So(acquired, ShouldBeFalse)
+		})
+
+		Convey("is acquired by another lock after unlock", func() {
+			acquired, err := lock1.TryLock()
+			So(err, ShouldBeNil)
+			So(acquired, ShouldBeTrue)
+			So(lock1.Unlock(), ShouldBeNil)
+			So(lock1.Ping(), ShouldNotBeNil)
+
+			acquired, err = lock2.TryLock()
+			So(err, ShouldBeNil)
+			So(acquired, ShouldBeTrue)
+		})
+
+		Convey("has different keys for different names", func() {
+			So(advisoryLockKey("skygear:a:leader"), ShouldNotEqual, advisoryLockKey("skygear:b:leader"))
+		})
+	})
+}
@@ -15,10 +15,17 @@
 package pq
 
 import (
+	"database/sql"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"sort"
+	"time"
 
 	sq "github.com/lann/squirrel"
+	"github.com/lib/pq"
 
+	skyAsset "github.com/skygeario/skygear-server/pkg/server/asset"
 	"github.com/skygeario/skygear-server/pkg/server/skydb"
 	"github.com/skygeario/skygear-server/pkg/server/skydb/pq/builder"
 )
@@ -45,7 +52,7 @@ func (c *conn) GetAssets(names []string) ([]skydb.Asset, error) {
 		nameArgs[idx] = interface{}(perName)
 	}
 
-	builder := psql.Select("id", "content_type", "size").
+	builder := psql.Select("id", "content_type", "size", "hash", "status", "metadata").
 		From(c.tableName("_asset")).
 		Where("id IN ("+sq.Placeholders(len(names))+")", nameArgs...)
 
@@ -58,11 +65,7 @@ func (c *conn) GetAssets(names []string) ([]skydb.Asset, error) {
 	results := []skydb.Asset{}
 	for rows.Next() {
 		a := skydb.Asset{}
-		if err := rows.Scan(
-			&a.Name,
-			&a.ContentType,
-			&a.Size); err != nil {
-
+		if err := c.doScanAsset(&a, rows); err != nil {
 			panic(err)
 		}
 		results = append(results, a)
@@ -72,14 +75,138 @@ func (c *conn) GetAssets(names []string) ([]skydb.Asset, error) {
 }
 
 func (c *conn) SaveAsset(asset *skydb.Asset) error {
+	var metadata interface{}
+	if asset.Metadata != nil {
+		data, err := json.Marshal(asset.Metadata)
+		if err != nil {
+			return err
+		}
+		metadata = data
+	}
+
 	pkData := map[string]interface{}{
 		"id": asset.Name,
 	}
 	data := map[string]interface{}{
 		"content_type": asset.ContentType,
 		"size":         asset.Size,
+		"hash":         sql.NullString{String: asset.Hash, Valid: asset.Hash != ""},
+		"status":       sql.NullString{String: string(asset.Status), Valid: asset.Status != ""},
+		"metadata":     metadata,
 	}
 	upsert := builder.UpsertQuery(c.tableName("_asset"), pkData, data)
 	_, err := c.ExecWith(upsert)
 	return err
 }
+
+func (c *conn) QueryOrphanedAssets(assetColumns map[string][]string, createdBefore time.Time, limit int) ([]skydb.Asset, error) {
+	builder := psql.Select("a.id", "a.content_type", "a.size", "a.hash", "a.status", "a.metadata").
+		From(c.tableName("_asset")+" AS a").
+		Where("a.created_at < ?", createdBefore.UTC()).
+		OrderBy("a.created_at").
+		Limit(uint64(limit))
+
+	recordTypes := []string{}
+	for recordType := range assetColumns {
+		recordTypes = append(recordTypes, recordType)
+	}
+	sort.Strings(recordTypes)
+
+	for _, recordType := range recordTypes {
+		for _, column := range assetColumns[recordType] {
+			builder = builder.Where(fmt.Sprintf(
+				"NOT EXISTS (SELECT 1 FROM %s WHERE %s = a.id)",
+				c.tableName(recordType),
+				pq.QuoteIdentifier(column),
+			))
+		}
+	}
+
+	rows, err := c.QueryWith(builder)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	results := []skydb.Asset{}
+	for rows.Next() {
+		a := skydb.Asset{}
+		if err := c.doScanAsset(&a, rows); err != nil {
+			return nil, err
+		}
+		results = append(results, a)
+	}
+
+	return results, rows.Err()
+}
+
+func (c *conn) QueryAssets(after string, limit int) ([]skydb.Asset, error) {
+	builder := psql.Select("id", "content_type", "size", "hash", "status", "metadata").
+		From(c.tableName("_asset")).
+		Where("id > ?", after).
+		OrderBy("id").
+		Limit(uint64(limit))
+
+	rows, err := c.QueryWith(builder)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	results := []skydb.Asset{}
+	for rows.Next() {
+		a := skydb.Asset{}
+		if err := c.doScanAsset(&a, rows); err != nil {
+			return nil, err
+		}
+		results = append(results, a)
+	}
+
+	return results, rows.Err()
+}
+
+func (c *conn) DeleteAsset(name string) error {
+	builder := psql.Delete(c.tableName("_asset")).
+		Where("id = ?", name)
+
+	result, err := c.ExecWith(builder)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return errors.New("asset not found")
+	}
+
+	return nil
+}
+
+func (c *conn) doScanAsset(asset *skydb.Asset, scanner sq.RowScanner) error {
+	var hash, status sql.NullString
+	var metadata []byte
+	if err := scanner.Scan(
+		&asset.Name,
+		&asset.ContentType,
+		&asset.Size,
+		&hash,
+		&status,
+		&metadata); err != nil {
+
+		return err
+	}
+	asset.Hash = hash.String
+	asset.Status = skydb.AssetStatus(status.String)
+	asset.Metadata = nil
+	if metadata != nil {
+		asset.Metadata = &skyAsset.Metadata{}
+		if err := json.Unmarshal(metadata, asset.Metadata); err != nil {
+			return err
+		}
+	}
+	return nil
+}
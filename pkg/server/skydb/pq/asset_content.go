@@ -0,0 +1,102 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pq
+
+import (
+	"database/sql"
+	"fmt"
+
+	sq "github.com/lann/squirrel"
+
+	"github.com/skygeario/skygear-server/pkg/server/skydb"
+)
+
+func (c *conn) ReferenceAssetContent(content *skydb.AssetContent) error {
+	tableName := c.tableName("_asset_content")
+	stmt := fmt.Sprintf(`
+		INSERT INTO %[1]s (hash, content_type, size, ref_count)
+		VALUES ($1, $2, $3, 1)
+		ON CONFLICT (hash) DO UPDATE SET ref_count = %[1]s.ref_count + 1
+		RETURNING hash, content_type, size, ref_count`,
+		tableName,
+	)
+
+	row := c.QueryRowx(stmt, content.Hash, content.ContentType, content.Size)
+	return c.doScanAssetContent(content, row)
+}
+
+func (c *conn) ReferenceExistingAssetContent(hash string, content *skydb.AssetContent) error {
+	builder := psql.Update(c.tableName("_asset_content")).
+		Set("ref_count", sq.Expr("ref_count + 1")).
+		Where("hash = ? AND ref_count > 0", hash).
+		Suffix("RETURNING hash, content_type, size, ref_count")
+
+	err := c.doScanAssetContent(content, c.QueryRowWith(builder))
+	if err == sql.ErrNoRows {
+		return skydb.ErrAssetContentNotFound
+	}
+	return err
+}
+
+func (c *conn) DereferenceAssetContent(hash string, content *skydb.AssetContent) error {
+	builder := psql.Update(c.tableName("_asset_content")).
+		Set("ref_count", sq.Expr("ref_count - 1")).
+		Where("hash = ? AND ref_count > 0", hash).
+		Suffix("RETURNING hash, content_type, size, ref_count")
+
+	err := c.doScanAssetContent(content, c.QueryRowWith(builder))
+	if err == sql.ErrNoRows {
+		return skydb.ErrAssetContentNotFound
+	}
+	return err
+}
+
+func (c *conn) DeleteAssetContent(hash string, deleteFile func() error) error {
+	// the row is locked until the file is deleted, such that
+	// ReferenceAssetContent of the same content waits for the deletion
+	// and stores the file again
+	return skydb.WithTransaction(c, func() error {
+		builder := psql.Select("hash").
+			From(c.tableName("_asset_content")).
+			Where("hash = ? AND ref_count = 0", hash).
+			Suffix("FOR UPDATE")
+
+		var lockedHash string
+		err := c.QueryRowWith(builder).Scan(&lockedHash)
+		if err == sql.ErrNoRows {
+			return skydb.ErrAssetContentNotFound
+		} else if err != nil {
+			return err
+		}
+
+		if err := deleteFile(); err != nil {
+			return err
+		}
+
+		deleteBuilder := psql.Delete(c.tableName("_asset_content")).
+			Where("hash = ?", hash)
+		_, err = c.ExecWith(deleteBuilder)
+		return err
+	})
+}
+
+func (c *conn) doScanAssetContent(content *skydb.AssetContent, scanner sq.RowScanner) error {
+	return scanner.Scan(
+		&content.Hash,
+		&content.ContentType,
+		&content.Size,
+		&content.RefCount,
+	)
+}
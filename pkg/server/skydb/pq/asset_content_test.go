@@ -0,0 +1,154 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pq
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/skygeario/skygear-server/pkg/server/skydb"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestAssetContentConn(t *testing.T) {
+	var c *conn
+
+	Convey("Conn", t, func() {
+		c = getTestConn(t)
+		defer cleanupConn(t, c)
+
+		const hash = "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824"
+		content := skydb.AssetContent{
+			Hash:        hash,
+			ContentType: "text/plain",
+			Size:        5,
+		}
+
+		Convey("references new asset content", func() {
+			So(c.ReferenceAssetContent(&content), ShouldBeNil)
+			So(content.RefCount, ShouldEqual, 1)
+
+			var refCount int
+			err := c.QueryRowx("SELECT ref_count FROM _asset_content WHERE hash = $1", hash).
+				Scan(&refCount)
+			So(err, ShouldBeNil)
+			So(refCount, ShouldEqual, 1)
+		})
+
+		Convey("references asset content again", func() {
+			So(c.ReferenceAssetContent(&content), ShouldBeNil)
+			So(c.ReferenceAssetContent(&skydb.AssetContent{
+				Hash:        hash,
+				ContentType: "application/octet-stream",
+				Size:        5,
+			}), ShouldBeNil)
+
+			existing := skydb.AssetContent{}
+			So(c.ReferenceExistingAssetContent(hash, &existing), ShouldBeNil)
+			So(existing, ShouldResemble, skydb.AssetContent{
+				Hash:        hash,
+				ContentType: "text/plain",
+				Size:        5,
+				RefCount:    3,
+			})
+		})
+
+		Convey("does not reference non-existent asset content", func() {
+			existing := skydb.AssetContent{}
+			err := c.ReferenceExistingAssetContent(hash, &existing)
+			So(err, ShouldEqual, skydb.ErrAssetContentNotFound)
+		})
+
+		Convey("dereferences asset content until no longer referenced", func() {
+			So(c.ReferenceAssetContent(&content), ShouldBeNil)
+			So(c.ReferenceAssetContent(&content), ShouldBeNil)
+
+			So(c.DereferenceAssetContent(hash, &content), ShouldBeNil)
+			So(content.RefCount, ShouldEqual, 1)
+			So(c.DereferenceAssetContent(hash, &content), ShouldBeNil)
+			So(content.RefCount, ShouldEqual, 0)
+
+			var refCount int
+			err := c.QueryRowx("SELECT ref_count FROM _asset_content WHERE hash = $1", hash).
+				Scan(&refCount)
+			So(err, ShouldBeNil)
+			So(refCount, ShouldEqual, 0)
+
+			err = c.DereferenceAssetContent(hash, &content)
+			So(err, ShouldEqual, skydb.ErrAssetContentNotFound)
+
+			existing := skydb.AssetContent{}
+			err = c.ReferenceExistingAssetContent(hash, &existing)
+			So(err, ShouldEqual, skydb.ErrAssetContentNotFound)
+		})
+
+		Convey("deletes asset content no longer referenced", func() {
+			So(c.ReferenceAssetContent(&content), ShouldBeNil)
+			So(c.DereferenceAssetContent(hash, &content), ShouldBeNil)
+
+			deleted := false
+			So(c.DeleteAssetContent(hash, func() error {
+				deleted = true
+				return nil
+			}), ShouldBeNil)
+			So(deleted, ShouldBeTrue)
+
+			var count int
+			err := c.QueryRowx("SELECT COUNT(*) FROM _asset_content").Scan(&count)
+			So(err, ShouldBeNil)
+			So(count, ShouldEqual, 0)
+		})
+
+		Convey("does not delete asset content referenced again", func() {
+			So(c.ReferenceAssetContent(&content), ShouldBeNil)
+			So(c.DereferenceAssetContent(hash, &content), ShouldBeNil)
+			So(c.ReferenceAssetContent(&content), ShouldBeNil)
+			So(content.RefCount, ShouldEqual, 1)
+
+			err := c.DeleteAssetContent(hash, func() error {
+				panic("file deleted")
+			})
+			So(err, ShouldEqual, skydb.ErrAssetContentNotFound)
+		})
+
+		Convey("keeps asset content if file is not deleted", func() {
+			So(c.ReferenceAssetContent(&content), ShouldBeNil)
+			So(c.DereferenceAssetContent(hash, &content), ShouldBeNil)
+
+			err := c.DeleteAssetContent(hash, func() error {
+				return errors.New("failed to delete file")
+			})
+			So(err, ShouldNotBeNil)
+
+			var count int
+			err = c.QueryRowx("SELECT COUNT(*) FROM _asset_content").Scan(&count)
+			So(err, ShouldBeNil)
+			So(count, ShouldEqual, 1)
+		})
+
+		Convey("saves asset with hash", func() {
+			So(c.SaveAsset(&skydb.Asset{
+				Name:        "hello.txt",
+				ContentType: "text/plain",
+				Size:        5,
+				Hash:        hash,
+			}), ShouldBeNil)
+
+			asset := skydb.Asset{}
+			So(c.GetAsset("hello.txt", &asset), ShouldBeNil)
+			So(asset.Hash, ShouldEqual, hash)
+		})
+	})
+}
@@ -0,0 +1,195 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pq
+
+import (
+	"testing"
+	"time"
+
+	skyAsset "github.com/skygeario/skygear-server/pkg/server/asset"
+	"github.com/skygeario/skygear-server/pkg/server/skydb"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestAssetGC(t *testing.T) {
+	var c *conn
+
+	Convey("Conn", t, func() {
+		c = getTestConn(t)
+		defer cleanupConn(t, c)
+
+		for _, name := range []string{"used.png", "orphan.png", "new.png"} {
+			So(c.SaveAsset(&skydb.Asset{
+				Name:        name,
+				ContentType: "image/png",
+				Size:        1,
+			}), ShouldBeNil)
+		}
+		_, err := c.Exec(`UPDATE _asset SET created_at = '2017-01-01 00:00:00' WHERE id != 'new.png'`)
+		So(err, ShouldBeNil)
+
+		db := c.PublicDB()
+		_, err = db.Extend("note", skydb.RecordSchema{
+			"image": skydb.FieldType{Type: skydb.TypeAsset},
+		})
+		So(err, ShouldBeNil)
+		So(db.Save(&skydb.Record{
+			ID: skydb.NewRecordID("note", "id"),
+			Data: map[string]interface{}{
+				"image": &skydb.Asset{Name: "used.png"},
+			},
+			OwnerID: "user_id",
+		}), ShouldBeNil)
+
+		assetColumns := map[string][]string{"note": []string{"image"}}
+		createdBefore := time.Date(2017, 1, 2, 0, 0, 0, 0, time.UTC)
+
+		Convey("query orphaned assets created before", func() {
+			assets, err := c.QueryOrphanedAssets(assetColumns, createdBefore, 10)
+			So(err, ShouldBeNil)
+			So(assets, ShouldResemble, []skydb.Asset{
+				{Name: "orphan.png", ContentType: "image/png", Size: 1},
+			})
+		})
+
+		Convey("delete asset", func() {
+			So(c.DeleteAsset("orphan.png"), ShouldBeNil)
+			assets, err := c.GetAssets([]string{"orphan.png"})
+			So(err, ShouldBeNil)
+			So(assets, ShouldBeEmpty)
+		})
+
+		Convey("not delete referenced asset", func() {
+			So(c.DeleteAsset("used.png"), ShouldNotBeNil)
+		})
+
+		Convey("error when deleting non-existing asset", func() {
+			So(c.DeleteAsset("notexist.png"), ShouldNotBeNil)
+		})
+	})
+}
+
+func TestAssetStatus(t *testing.T) {
+	var c *conn
+
+	Convey("Conn", t, func() {
+		c = getTestConn(t)
+		defer cleanupConn(t, c)
+
+		Convey("save and get asset status", func() {
+			So(c.SaveAsset(&skydb.Asset{
+				Name:        "pending.png",
+				ContentType: "image/png",
+				Size:        1,
+				Status:      skydb.AssetStatusPending,
+			}), ShouldBeNil)
+
+			asset := skydb.Asset{}
+			So(c.GetAsset("pending.png", &asset), ShouldBeNil)
+			So(asset.Status, ShouldEqual, skydb.AssetStatusPending)
+
+			asset.Status = skydb.AssetStatusInfected
+			So(c.SaveAsset(&asset), ShouldBeNil)
+			So(c.GetAsset("pending.png", &asset), ShouldBeNil)
+			So(asset.Status, ShouldEqual, skydb.AssetStatusInfected)
+		})
+
+		Convey("get asset without status", func() {
+			So(c.SaveAsset(&skydb.Asset{
+				Name:        "unscanned.png",
+				ContentType: "image/png",
+				Size:        1,
+			}), ShouldBeNil)
+
+			asset := skydb.Asset{}
+			So(c.GetAsset("unscanned.png", &asset), ShouldBeNil)
+			So(asset.Status, ShouldEqual, skydb.AssetStatus(""))
+			So(asset.IsServable(), ShouldBeTrue)
+		})
+	})
+}
+
+func TestQueryAssets(t *testing.T) {
+	var c *conn
+
+	Convey("Conn", t, func() {
+		c = getTestConn(t)
+		defer cleanupConn(t, c)
+
+		for _, name := range []string{"c.png", "a.png", "b.png"} {
+			So(c.SaveAsset(&skydb.Asset{
+				Name:        name,
+				ContentType: "image/png",
+				Size:        1,
+			}), ShouldBeNil)
+		}
+
+		Convey("query assets ordered by name", func() {
+			assets, err := c.QueryAssets("", 2)
+			So(err, ShouldBeNil)
+			So(assets, ShouldResemble, []skydb.Asset{
+				{Name: "a.png", ContentType: "image/png", Size: 1},
+				{Name: "b.png", ContentType: "image/png", Size: 1},
+			})
+		})
+
+		Convey("query assets after name", func() {
+			assets, err := c.QueryAssets("b.png", 2)
+			So(err, ShouldBeNil)
+			So(assets, ShouldResemble, []skydb.Asset{
+				{Name: "c.png", ContentType: "image/png", Size: 1},
+			})
+		})
+	})
+}
+
+func TestAssetMetadata(t *testing.T) {
+	var c *conn
+
+	Convey("Conn", t, func() {
+		c = getTestConn(t)
+		defer cleanupConn(t, c)
+
+		Convey("save and get asset metadata", func() {
+			So(c.SaveAsset(&skydb.Asset{
+				Name:        "photo.jpg",
+				ContentType: "image/jpeg",
+				Size:        1,
+				Metadata: &skyAsset.Metadata{
+					Width:  640,
+					Height: 480,
+					EXIF: map[string]interface{}{
+						"Make": "Skygear",
+					},
+				},
+			}), ShouldBeNil)
+
+			asset := skydb.Asset{}
+			So(c.GetAsset("photo.jpg", &asset), ShouldBeNil)
+			So(asset.Metadata, ShouldResemble, &skyAsset.Metadata{
+				Width:  640,
+				Height: 480,
+				EXIF: map[string]interface{}{
+					"Make": "Skygear",
+				},
+			})
+
+			asset.Metadata = nil
+			So(c.SaveAsset(&asset), ShouldBeNil)
+			So(c.GetAsset("photo.jpg", &asset), ShouldBeNil)
+			So(asset.Metadata, ShouldBeNil)
+		})
+	})
+}
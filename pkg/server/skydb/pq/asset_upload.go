@@ -0,0 +1,209 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pq
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	sq "github.com/lann/squirrel"
+	"github.com/skygeario/skygear-server/pkg/server/skydb"
+	"github.com/skygeario/skygear-server/pkg/server/uuid"
+)
+
+var assetUploadColumns = []string{
+	"id", "name", "content_type", "length", "upload_offset", "chunks",
+	"multipart_upload_id", "created_at", "updated_at",
+}
+
+func (c *conn) CreateAssetUpload(upload *skydb.AssetUpload) error {
+	if upload.ID == "" {
+		upload.ID = uuid.New()
+	}
+	if upload.CreatedAt.IsZero() {
+		upload.CreatedAt = time.Now().UTC()
+	}
+	if upload.UpdatedAt.IsZero() {
+		upload.UpdatedAt = upload.CreatedAt
+	}
+	if upload.Chunks == nil {
+		upload.Chunks = []string{}
+	}
+
+	chunks, err := json.Marshal(upload.Chunks)
+	if err != nil {
+		return err
+	}
+
+	builder := psql.Insert(c.tableName("_asset_upload")).Columns(assetUploadColumns...).Values(
+		upload.ID,
+		upload.Name,
+		upload.ContentType,
+		upload.Length,
+		upload.Offset,
+		chunks,
+		sql.NullString{String: upload.MultipartUploadID, Valid: upload.MultipartUploadID != ""},
+		upload.CreatedAt.UTC(),
+		upload.UpdatedAt.UTC(),
+	)
+
+	_, err = c.ExecWith(builder)
+	return err
+}
+
+func (c *conn) GetAssetUpload(id string, upload *skydb.AssetUpload) error {
+	builder := psql.Select(assetUploadColumns...).
+		From(c.tableName("_asset_upload")).
+		Where("id = ?", id)
+
+	err := c.doScanAssetUpload(upload, c.QueryRowWith(builder))
+	if err == sql.ErrNoRows {
+		return skydb.ErrAssetUploadNotFound
+	}
+	return err
+}
+
+func (c *conn) AppendAssetUploadChunk(id string, offset int64, chunk string, size int64) error {
+	chunks, err := json.Marshal([]string{chunk})
+	if err != nil {
+		return err
+	}
+
+	builder := psql.Update(c.tableName("_asset_upload")).
+		Set("upload_offset", sq.Expr("upload_offset + ?", size)).
+		Set("chunks", sq.Expr("chunks || ?::jsonb", chunks)).
+		Set("updated_at", time.Now().UTC()).
+		Where("id = ? AND upload_offset = ? AND upload_offset + ? <= length", id, offset, size)
+
+	result, err := c.ExecWith(builder)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected > 1 {
+		panic(fmt.Errorf("want 1 rows updated, got %v", rowsAffected))
+	} else if rowsAffected == 1 {
+		return nil
+	}
+
+	// tell whether the upload does not exist or the offset mismatches
+	upload := skydb.AssetUpload{}
+	if err := c.GetAssetUpload(id, &upload); err != nil {
+		return err
+	}
+	return skydb.ErrAssetUploadOffsetMismatch
+}
+
+func (c *conn) TouchAssetUpload(id string) error {
+	builder := psql.Update(c.tableName("_asset_upload")).
+		Set("updated_at", time.Now().UTC()).
+		Where("id = ?", id)
+
+	result, err := c.ExecWith(builder)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return skydb.ErrAssetUploadNotFound
+	}
+
+	return nil
+}
+
+func (c *conn) DeleteAssetUpload(id string) error {
+	builder := psql.Delete(c.tableName("_asset_upload")).
+		Where("id = ?", id)
+
+	result, err := c.ExecWith(builder)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return skydb.ErrAssetUploadNotFound
+	}
+
+	return nil
+}
+
+func (c *conn) QueryExpiredAssetUploads(updatedBefore time.Time, limit int) ([]skydb.AssetUpload, error) {
+	builder := psql.Select(assetUploadColumns...).
+		From(c.tableName("_asset_upload")).
+		Where("updated_at < ?", updatedBefore.UTC()).
+		OrderBy("updated_at").
+		Limit(uint64(limit))
+
+	rows, err := c.QueryWith(builder)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	results := []skydb.AssetUpload{}
+	for rows.Next() {
+		upload := skydb.AssetUpload{}
+		if err := c.doScanAssetUpload(&upload, rows); err != nil {
+			return nil, err
+		}
+		results = append(results, upload)
+	}
+
+	return results, rows.Err()
+}
+
+func (c *conn) doScanAssetUpload(upload *skydb.AssetUpload, scanner sq.RowScanner) error {
+	var (
+		chunks            []byte
+		multipartUploadID sql.NullString
+	)
+
+	err := scanner.Scan(
+		&upload.ID,
+		&upload.Name,
+		&upload.ContentType,
+		&upload.Length,
+		&upload.Offset,
+		&chunks,
+		&multipartUploadID,
+		&upload.CreatedAt,
+		&upload.UpdatedAt,
+	)
+	if err != nil {
+		return err
+	}
+
+	if err = json.Unmarshal(chunks, &upload.Chunks); err != nil {
+		return err
+	}
+	upload.MultipartUploadID = multipartUploadID.String
+	upload.CreatedAt = upload.CreatedAt.In(time.UTC)
+	upload.UpdatedAt = upload.UpdatedAt.In(time.UTC)
+	return nil
+}
@@ -0,0 +1,104 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pq
+
+import (
+	"testing"
+	"time"
+
+	"github.com/skygeario/skygear-server/pkg/server/skydb"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestAssetUploadConn(t *testing.T) {
+	var c *conn
+
+	Convey("Conn", t, func() {
+		c = getTestConn(t)
+		defer cleanupConn(t, c)
+
+		upload := skydb.AssetUpload{
+			ID:          "upload",
+			Name:        "movie.mp4",
+			ContentType: "video/mp4",
+			Length:      10,
+			CreatedAt:   time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC),
+			UpdatedAt:   time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC),
+		}
+
+		Convey("create and get asset upload", func() {
+			So(c.CreateAssetUpload(&upload), ShouldBeNil)
+
+			fetched := skydb.AssetUpload{}
+			So(c.GetAssetUpload("upload", &fetched), ShouldBeNil)
+			So(fetched, ShouldResemble, upload)
+		})
+
+		Convey("get non-existent asset upload", func() {
+			fetched := skydb.AssetUpload{}
+			So(c.GetAssetUpload("upload", &fetched), ShouldEqual, skydb.ErrAssetUploadNotFound)
+		})
+
+		Convey("append chunks at offset", func() {
+			So(c.CreateAssetUpload(&upload), ShouldBeNil)
+			So(c.AppendAssetUploadChunk("upload", 0, "chunk-0", 4), ShouldBeNil)
+			So(c.AppendAssetUploadChunk("upload", 0, "chunk-0", 4), ShouldEqual, skydb.ErrAssetUploadOffsetMismatch)
+			So(c.AppendAssetUploadChunk("upload", 4, "chunk-4", 7), ShouldEqual, skydb.ErrAssetUploadOffsetMismatch)
+			So(c.AppendAssetUploadChunk("upload", 4, "chunk-4", 6), ShouldBeNil)
+
+			fetched := skydb.AssetUpload{}
+			So(c.GetAssetUpload("upload", &fetched), ShouldBeNil)
+			So(fetched.Offset, ShouldEqual, 10)
+			So(fetched.Chunks, ShouldResemble, []string{"chunk-0", "chunk-4"})
+		})
+
+		Convey("append chunk to non-existent asset upload", func() {
+			So(c.AppendAssetUploadChunk("upload", 0, "chunk-0", 4), ShouldEqual, skydb.ErrAssetUploadNotFound)
+		})
+
+		Convey("delete asset upload", func() {
+			So(c.CreateAssetUpload(&upload), ShouldBeNil)
+			So(c.DeleteAssetUpload("upload"), ShouldBeNil)
+			So(c.DeleteAssetUpload("upload"), ShouldEqual, skydb.ErrAssetUploadNotFound)
+		})
+
+		Convey("touch asset upload", func() {
+			So(c.CreateAssetUpload(&upload), ShouldBeNil)
+			So(c.TouchAssetUpload("upload"), ShouldBeNil)
+
+			fetched := skydb.AssetUpload{}
+			So(c.GetAssetUpload("upload", &fetched), ShouldBeNil)
+			So(fetched.UpdatedAt, ShouldHappenAfter, upload.UpdatedAt)
+
+			So(c.TouchAssetUpload("notexist"), ShouldEqual, skydb.ErrAssetUploadNotFound)
+		})
+
+		Convey("query expired asset uploads", func() {
+			So(c.CreateAssetUpload(&upload), ShouldBeNil)
+			recent := upload
+			recent.ID = "recent"
+			recent.UpdatedAt = time.Date(2017, 1, 3, 0, 0, 0, 0, time.UTC)
+			So(c.CreateAssetUpload(&recent), ShouldBeNil)
+
+			uploads, err := c.QueryExpiredAssetUploads(time.Date(2017, 1, 2, 0, 0, 0, 0, time.UTC), 10)
+			So(err, ShouldBeNil)
+			So(uploads, ShouldResemble, []skydb.AssetUpload{upload})
+
+			uploads, err = c.QueryExpiredAssetUploads(time.Date(2017, 1, 4, 0, 0, 0, 0, time.UTC), 1)
+			So(err, ShouldBeNil)
+			So(uploads, ShouldResemble, []skydb.AssetUpload{upload})
+		})
+	})
+}
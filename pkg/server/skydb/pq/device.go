@@ -121,6 +121,41 @@ func (c *conn) QueryDevicesByUserAndTopic(user, topic string) ([]skydb.Device, e
 	return results, nil
 }
 
+func (c *conn) QueryDevicesByTopic(topic string, afterID string, limit int) ([]skydb.Device, error) {
+	builder := psql.Select("id", "type", "token", "auth_id", "topic", "last_registered_at").
+		From(c.tableName("_device")).
+		Where("topic = ? AND id > ?", topic, afterID).
+		OrderBy("id").
+		Limit(uint64(limit))
+
+	rows, err := c.QueryWith(builder)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	results := []skydb.Device{}
+	for rows.Next() {
+		var nullableToken, nullableUserID sql.NullString
+		d := skydb.Device{}
+		if err := rows.Scan(
+			&d.ID,
+			&d.Type,
+			&nullableToken,
+			&nullableUserID,
+			&d.Topic,
+			&d.LastRegisteredAt); err != nil {
+
+			return nil, err
+		}
+		d.Token = nullableToken.String
+		d.AuthInfoID = nullableUserID.String
+		d.LastRegisteredAt = d.LastRegisteredAt.UTC()
+		results = append(results, d)
+	}
+
+	return results, rows.Err()
+}
+
 func (c *conn) SaveDevice(device *skydb.Device) error {
 	if device.ID == "" || device.Type == "" || device.LastRegisteredAt.IsZero() {
 		return errors.New("invalid device: empty id, type, or last registered at")
@@ -387,5 +387,40 @@ func TestDevice(t *testing.T) {
 			So(err, ShouldBeNil)
 			So(len(devices), ShouldEqual, 0)
 		})
+
+		Convey("query devices by topic in batches", func() {
+			for _, id := range []string{"device3", "device1", "device2", "device4"} {
+				device := skydb.Device{
+					ID:               id,
+					Type:             "ios",
+					Token:            "token-" + id,
+					Topic:            "news",
+					AuthInfoID:       "userid",
+					LastRegisteredAt: time.Date(2006, 1, 2, 15, 4, 5, 0, time.UTC),
+				}
+				if id == "device4" {
+					device.Topic = "sports"
+				}
+				So(c.SaveDevice(&device), ShouldBeNil)
+			}
+
+			devices, err := c.QueryDevicesByTopic("news", "", 2)
+			So(err, ShouldBeNil)
+			So(len(devices), ShouldEqual, 2)
+			So(devices[0].ID, ShouldEqual, "device1")
+			So(devices[1], ShouldResemble, skydb.Device{
+				ID:               "device2",
+				Type:             "ios",
+				Token:            "token-device2",
+				Topic:            "news",
+				AuthInfoID:       "userid",
+				LastRegisteredAt: time.Date(2006, 1, 2, 15, 4, 5, 0, time.UTC),
+			})
+
+			devices, err = c.QueryDevicesByTopic("news", "device2", 2)
+			So(err, ShouldBeNil)
+			So(len(devices), ShouldEqual, 1)
+			So(devices[0].ID, ShouldEqual, "device3")
+		})
 	})
 }
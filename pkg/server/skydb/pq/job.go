@@ -0,0 +1,220 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pq
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	sq "github.com/lann/squirrel"
+	"github.com/lib/pq"
+	"github.com/skygeario/skygear-server/pkg/server/skydb"
+	"github.com/skygeario/skygear-server/pkg/server/uuid"
+)
+
+var jobColumns = []string{
+	"id", "name", "args", "key", "run_at", "attempts", "max_attempts",
+	"last_error", "created_at", "claimed_until",
+}
+
+func (c *conn) CreateJob(job *skydb.Job) error {
+	if job.ID == "" {
+		job.ID = uuid.New()
+	}
+	if job.CreatedAt.IsZero() {
+		job.CreatedAt = time.Now().UTC()
+	}
+
+	args, err := json.Marshal(job.Args)
+	if err != nil {
+		return err
+	}
+
+	builder := psql.Insert(c.tableName("_job")).Columns(jobColumns...).Values(
+		job.ID,
+		job.Name,
+		args,
+		sql.NullString{String: job.Key, Valid: job.Key != ""},
+		job.RunAt.UTC(),
+		job.Attempts,
+		job.MaxAttempts,
+		sql.NullString{String: job.LastError, Valid: job.LastError != ""},
+		job.CreatedAt.UTC(),
+		pq.NullTime{Time: job.ClaimedUntil.UTC(), Valid: !job.ClaimedUntil.IsZero()},
+	)
+
+	_, err = c.ExecWith(builder)
+	if isUniqueViolated(err) {
+		return skydb.ErrJobDuplicated
+	}
+	return err
+}
+
+func (c *conn) ClaimDueJobs(t time.Time, lockUntil time.Time, limit int) ([]skydb.Job, error) {
+	tableName := c.tableName("_job")
+	// subquery is built with question placeholders, which are replaced
+	// when the whole statement is built
+	subquery := sq.Select("id").From(tableName).
+		Where("run_at <= ?", t.UTC()).
+		OrderBy("run_at").
+		Limit(uint64(limit)).
+		Suffix("FOR UPDATE SKIP LOCKED")
+	subquerySQL, subqueryArgs, err := subquery.ToSql()
+	if err != nil {
+		return nil, err
+	}
+
+	builder := psql.Update(tableName).
+		Set("run_at", lockUntil.UTC()).
+		Set("claimed_until", lockUntil.UTC()).
+		Set("attempts", sq.Expr("attempts + 1")).
+		Where(fmt.Sprintf("id IN (%s)", subquerySQL), subqueryArgs...).
+		Suffix("RETURNING " + strings.Join(jobColumns, ", "))
+
+	rows, err := c.QueryWith(builder)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	jobs := []skydb.Job{}
+	for rows.Next() {
+		job := skydb.Job{}
+		if err := c.doScanJob(&job, rows); err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs, rows.Err()
+}
+
+func (c *conn) doScanJob(job *skydb.Job, scanner sq.RowScanner) error {
+	var (
+		args         nullJSON
+		key          sql.NullString
+		lastError    sql.NullString
+		claimedUntil pq.NullTime
+	)
+
+	err := scanner.Scan(
+		&job.ID,
+		&job.Name,
+		&args,
+		&key,
+		&job.RunAt,
+		&job.Attempts,
+		&job.MaxAttempts,
+		&lastError,
+		&job.CreatedAt,
+		&claimedUntil,
+	)
+	if err != nil {
+		return err
+	}
+
+	job.Args = args.JSON
+	job.Key = key.String
+	job.LastError = lastError.String
+	job.RunAt = job.RunAt.In(time.UTC)
+	job.CreatedAt = job.CreatedAt.In(time.UTC)
+	job.ClaimedUntil = time.Time{}
+	if claimedUntil.Valid {
+		job.ClaimedUntil = claimedUntil.Time.In(time.UTC)
+	}
+	return nil
+}
+
+func (c *conn) UpdateJob(job *skydb.Job) error {
+	builder := psql.Update(c.tableName("_job")).
+		Set("run_at", job.RunAt.UTC()).
+		Set("attempts", job.Attempts).
+		Set("last_error", sql.NullString{String: job.LastError, Valid: job.LastError != ""}).
+		Set("claimed_until", nil).
+		Where("id = ?", job.ID)
+
+	return c.execJobBuilder(builder)
+}
+
+func (c *conn) DeleteJob(id string) error {
+	builder := psql.Delete(c.tableName("_job")).
+		Where("id = ?", id)
+
+	return c.execJobBuilder(builder)
+}
+
+func (c *conn) DeleteJobsByKeyPrefix(prefix string) (int, error) {
+	// compare with substr instead of LIKE to avoid escaping the prefix
+	builder := psql.Delete(c.tableName("_job")).
+		Where("substr(key, 1, char_length(?)) = ?", prefix, prefix)
+
+	result, err := c.ExecWith(builder)
+	if err != nil {
+		return 0, err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	return int(rowsAffected), nil
+}
+
+func (c *conn) CancelJobsByKeyPrefix(prefix string, t time.Time) (int, int, error) {
+	// a claimed job is excluded if a worker claims it meanwhile, as the
+	// condition is evaluated again on the updated row
+	builder := psql.Delete(c.tableName("_job")).
+		Where("substr(key, 1, char_length(?)) = ?", prefix, prefix).
+		Where("(claimed_until IS NULL OR claimed_until <= ?)", t.UTC())
+
+	result, err := c.ExecWith(builder)
+	if err != nil {
+		return 0, 0, err
+	}
+	cancelled, err := result.RowsAffected()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	var claimed int
+	query := psql.Select("COUNT(*)").From(c.tableName("_job")).
+		Where("substr(key, 1, char_length(?)) = ?", prefix, prefix).
+		Where("claimed_until > ?", t.UTC())
+	if err := c.QueryRowWith(query).Scan(&claimed); err != nil {
+		return 0, 0, err
+	}
+	return int(cancelled), claimed, nil
+}
+
+func (c *conn) execJobBuilder(builder sq.Sqlizer) error {
+	result, err := c.ExecWith(builder)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return skydb.ErrJobNotFound
+	} else if rowsAffected > 1 {
+		panic(fmt.Errorf("want 1 rows updated, got %v", rowsAffected))
+	}
+
+	return nil
+}
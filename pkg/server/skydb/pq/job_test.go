@@ -0,0 +1,172 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pq
+
+import (
+	"testing"
+	"time"
+
+	"github.com/skygeario/skygear-server/pkg/server/skydb"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestJobConn(t *testing.T) {
+	var c *conn
+
+	Convey("Conn", t, func() {
+		c = getTestConn(t)
+		defer cleanupConn(t, c)
+
+		now := time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC)
+		job := skydb.Job{
+			ID:          "job-1",
+			Name:        "send_reminder",
+			Args:        map[string]interface{}{"user_id": "faseng"},
+			Key:         "reminder-faseng",
+			RunAt:       now,
+			MaxAttempts: 3,
+		}
+
+		Convey("create job", func() {
+			So(c.CreateJob(&job), ShouldBeNil)
+
+			var name string
+			err := c.QueryRowx("SELECT name FROM _job WHERE id = 'job-1'").
+				Scan(&name)
+			So(err, ShouldBeNil)
+			So(name, ShouldEqual, "send_reminder")
+		})
+
+		Convey("return ErrJobDuplicated when create job with duplicated key", func() {
+			So(c.CreateJob(&job), ShouldBeNil)
+
+			duplicated := job
+			duplicated.ID = "job-2"
+			So(c.CreateJob(&duplicated), ShouldEqual, skydb.ErrJobDuplicated)
+		})
+
+		Convey("create jobs without key", func() {
+			job.Key = ""
+			So(c.CreateJob(&job), ShouldBeNil)
+
+			another := job
+			another.ID = "job-2"
+			So(c.CreateJob(&another), ShouldBeNil)
+		})
+
+		Convey("claim due jobs", func() {
+			So(c.CreateJob(&job), ShouldBeNil)
+			future := skydb.Job{
+				ID:          "job-2",
+				Name:        "send_reminder",
+				RunAt:       now.Add(time.Hour),
+				MaxAttempts: 3,
+			}
+			So(c.CreateJob(&future), ShouldBeNil)
+
+			lockUntil := now.Add(time.Minute)
+			jobs, err := c.ClaimDueJobs(now, lockUntil, 10)
+			So(err, ShouldBeNil)
+			So(len(jobs), ShouldEqual, 1)
+			So(jobs[0].ID, ShouldEqual, "job-1")
+			So(jobs[0].Args, ShouldResemble, map[string]interface{}{"user_id": "faseng"})
+			So(jobs[0].Key, ShouldEqual, "reminder-faseng")
+			So(jobs[0].Attempts, ShouldEqual, 1)
+			So(jobs[0].RunAt, ShouldResemble, lockUntil)
+			So(jobs[0].ClaimedUntil, ShouldResemble, lockUntil)
+
+			jobs, err = c.ClaimDueJobs(now, lockUntil, 10)
+			So(err, ShouldBeNil)
+			So(jobs, ShouldBeEmpty)
+		})
+
+		Convey("update job", func() {
+			So(c.CreateJob(&job), ShouldBeNil)
+
+			job.RunAt = now.Add(time.Minute)
+			job.LastError = "plugin unavailable"
+			So(c.UpdateJob(&job), ShouldBeNil)
+
+			var lastError string
+			err := c.QueryRowx("SELECT last_error FROM _job WHERE id = 'job-1'").
+				Scan(&lastError)
+			So(err, ShouldBeNil)
+			So(lastError, ShouldEqual, "plugin unavailable")
+		})
+
+		Convey("delete job", func() {
+			So(c.CreateJob(&job), ShouldBeNil)
+			So(c.DeleteJob("job-1"), ShouldBeNil)
+			So(c.DeleteJob("job-1"), ShouldEqual, skydb.ErrJobNotFound)
+		})
+
+		Convey("delete jobs by key prefix", func() {
+			So(c.CreateJob(&job), ShouldBeNil)
+			job2 := job
+			job2.ID = "job-2"
+			job2.Key = "reminder-chima"
+			So(c.CreateJob(&job2), ShouldBeNil)
+			job3 := job
+			job3.ID = "job-3"
+			job3.Key = "remind_faseng"
+			So(c.CreateJob(&job3), ShouldBeNil)
+
+			count, err := c.DeleteJobsByKeyPrefix("reminder-")
+			So(err, ShouldBeNil)
+			So(count, ShouldEqual, 2)
+
+			count, err = c.DeleteJobsByKeyPrefix("reminder-")
+			So(err, ShouldBeNil)
+			So(count, ShouldEqual, 0)
+
+			So(c.DeleteJob("job-3"), ShouldBeNil)
+		})
+
+		Convey("cancel jobs by key prefix", func() {
+			So(c.CreateJob(&job), ShouldBeNil)
+			job2 := job
+			job2.ID = "job-2"
+			job2.Key = "reminder-chima"
+			job2.RunAt = now.Add(time.Hour)
+			So(c.CreateJob(&job2), ShouldBeNil)
+
+			jobs, err := c.ClaimDueJobs(now, now.Add(time.Minute), 10)
+			So(err, ShouldBeNil)
+			So(len(jobs), ShouldEqual, 1)
+
+			cancelled, claimed, err := c.CancelJobsByKeyPrefix("reminder-", now)
+			So(err, ShouldBeNil)
+			So(cancelled, ShouldEqual, 1)
+			So(claimed, ShouldEqual, 1)
+
+			cancelled, claimed, err = c.CancelJobsByKeyPrefix("reminder-", now.Add(time.Hour))
+			So(err, ShouldBeNil)
+			So(cancelled, ShouldEqual, 1)
+			So(claimed, ShouldEqual, 0)
+		})
+
+		Convey("release claim on update job", func() {
+			So(c.CreateJob(&job), ShouldBeNil)
+			jobs, err := c.ClaimDueJobs(now, now.Add(time.Minute), 10)
+			So(err, ShouldBeNil)
+			So(c.UpdateJob(&jobs[0]), ShouldBeNil)
+
+			cancelled, claimed, err := c.CancelJobsByKeyPrefix("reminder-", now)
+			So(err, ShouldBeNil)
+			So(cancelled, ShouldEqual, 1)
+			So(claimed, ShouldEqual, 0)
+		})
+	})
+}
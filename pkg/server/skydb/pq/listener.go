@@ -52,8 +52,9 @@ func emit(n *notification) {
 	for _, channel := range channels {
 		go func(ch chan skydb.RecordEvent) {
 			ch <- skydb.RecordEvent{
-				Record: &n.Record,
-				Event:  n.ChangeEvent,
+				Record:   &n.Record,
+				Original: n.OldRecord,
+				Event:    n.ChangeEvent,
 			}
 		}(channel)
 	}
@@ -66,6 +67,7 @@ type notification struct {
 	AppName     string
 	ChangeEvent skydb.RecordHookEvent
 	Record      skydb.Record
+	OldRecord   *skydb.Record
 }
 
 type rawNotification struct {
@@ -73,6 +75,7 @@ type rawNotification struct {
 	Op         string
 	RecordType string
 	Record     []byte
+	OldRecord  []byte `db:"old_record"`
 }
 
 type recordListener struct {
@@ -152,7 +155,7 @@ func (l *recordListener) Listen() {
 // NOTE(limouren): pending_notification.id is integer in database.
 func (l *recordListener) fetchNotification(notificationID string, n *notification) error {
 	var rawNoti rawNotification
-	err := l.db.QueryRowx("SELECT op, appname, recordtype, record FROM public.pending_notification WHERE id = $1", notificationID).
+	err := l.db.QueryRowx("SELECT op, appname, recordtype, record, old_record FROM public.pending_notification WHERE id = $1", notificationID).
 		StructScan(&rawNoti)
 	if err != nil {
 		l.logger.WithFields(logrus.Fields{
@@ -209,6 +212,14 @@ func parseNotification(raw *rawNotification, n *notification) error {
 	}
 	n.Record.ID.Type = raw.RecordType
 
+	if raw.OldRecord != nil {
+		n.OldRecord = &skydb.Record{}
+		if err := parseRecordData(raw.OldRecord, n.OldRecord); err != nil {
+			return err
+		}
+		n.OldRecord.ID.Type = raw.RecordType
+	}
+
 	return nil
 }
 
@@ -249,6 +260,17 @@ func parseRecordData(data []byte, record *skydb.Record) error {
 		return errors.New(`missing key "_id" or "_owner_id"`)
 	}
 
+	var acl skydb.RecordACL
+	if rawACL, ok := recordData["_access"]; ok && rawACL != nil {
+		aclData, err := json.Marshal(rawACL)
+		if err == nil {
+			err = json.Unmarshal(aclData, &acl)
+		}
+		if err != nil {
+			return fmt.Errorf("invalid _access: %v", err)
+		}
+	}
+
 	for key := range recordData {
 		if key[0] == '_' {
 			delete(recordData, key)
@@ -259,6 +281,7 @@ func parseRecordData(data []byte, record *skydb.Record) error {
 	record.Data = recordData
 	record.DatabaseID = rawDatabaseID
 	record.OwnerID = rawOwnerID
+	record.ACL = acl
 
 	return nil
 }
@@ -0,0 +1,43 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package migration
+
+import "github.com/jmoiron/sqlx"
+
+type revision_3f8d2c6a91b4 struct {
+}
+
+func (r *revision_3f8d2c6a91b4) Version() string {
+	return "3f8d2c6a91b4"
+}
+
+func (r *revision_3f8d2c6a91b4) Up(tx *sqlx.Tx) error {
+	stmt := `
+	ALTER TABLE _asset
+		ADD COLUMN created_at TIMESTAMP WITHOUT TIME ZONE NOT NULL
+		DEFAULT (now() AT TIME ZONE 'UTC');
+	CREATE INDEX ON _asset (created_at);
+	`
+	_, err := tx.Exec(stmt)
+	return err
+}
+
+func (r *revision_3f8d2c6a91b4) Down(tx *sqlx.Tx) error {
+	stmt := `
+	ALTER TABLE _asset DROP COLUMN created_at;
+	`
+	_, err := tx.Exec(stmt)
+	return err
+}
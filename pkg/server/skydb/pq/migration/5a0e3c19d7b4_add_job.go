@@ -0,0 +1,52 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package migration
+
+import "github.com/jmoiron/sqlx"
+
+type revision_5a0e3c19d7b4 struct {
+}
+
+func (r *revision_5a0e3c19d7b4) Version() string {
+	return "5a0e3c19d7b4"
+}
+
+func (r *revision_5a0e3c19d7b4) Up(tx *sqlx.Tx) error {
+	stmt := `
+	CREATE TABLE _job (
+		id TEXT PRIMARY KEY,
+		name TEXT NOT NULL,
+		args JSONB,
+		key TEXT,
+		run_at TIMESTAMP WITHOUT TIME ZONE NOT NULL,
+		attempts INTEGER NOT NULL DEFAULT 0,
+		max_attempts INTEGER NOT NULL,
+		last_error TEXT,
+		created_at TIMESTAMP WITHOUT TIME ZONE NOT NULL,
+		UNIQUE (key)
+	);
+	CREATE INDEX ON _job (run_at);
+	`
+	_, err := tx.Exec(stmt)
+	return err
+}
+
+func (r *revision_5a0e3c19d7b4) Down(tx *sqlx.Tx) error {
+	stmt := `
+	DROP TABLE _job;
+	`
+	_, err := tx.Exec(stmt)
+	return err
+}
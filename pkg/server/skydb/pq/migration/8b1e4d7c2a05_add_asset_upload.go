@@ -0,0 +1,50 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package migration
+
+import "github.com/jmoiron/sqlx"
+
+type revision_8b1e4d7c2a05 struct {
+}
+
+func (r *revision_8b1e4d7c2a05) Version() string {
+	return "8b1e4d7c2a05"
+}
+
+func (r *revision_8b1e4d7c2a05) Up(tx *sqlx.Tx) error {
+	stmt := `
+	CREATE TABLE _asset_upload (
+		id TEXT PRIMARY KEY,
+		name TEXT NOT NULL,
+		content_type TEXT NOT NULL,
+		length BIGINT NOT NULL,
+		upload_offset BIGINT NOT NULL DEFAULT 0,
+		chunks JSONB NOT NULL DEFAULT '[]'::jsonb,
+		multipart_upload_id TEXT,
+		created_at TIMESTAMP WITHOUT TIME ZONE NOT NULL,
+		updated_at TIMESTAMP WITHOUT TIME ZONE NOT NULL
+	);
+	`
+	_, err := tx.Exec(stmt)
+	return err
+}
+
+func (r *revision_8b1e4d7c2a05) Down(tx *sqlx.Tx) error {
+	stmt := `
+	DROP TABLE _asset_upload;
+	`
+	_, err := tx.Exec(stmt)
+	return err
+}
@@ -0,0 +1,45 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package migration
+
+import "github.com/jmoiron/sqlx"
+
+type revision_a7f3c92e5b14 struct {
+}
+
+func (r *revision_a7f3c92e5b14) Version() string {
+	return "a7f3c92e5b14"
+}
+
+func (r *revision_a7f3c92e5b14) Up(tx *sqlx.Tx) error {
+	stmt := `
+	CREATE TABLE _push_template (
+		name TEXT PRIMARY KEY,
+		default_locale TEXT NOT NULL,
+		locales JSONB NOT NULL,
+		updated_at TIMESTAMP WITHOUT TIME ZONE NOT NULL
+	);
+	`
+	_, err := tx.Exec(stmt)
+	return err
+}
+
+func (r *revision_a7f3c92e5b14) Down(tx *sqlx.Tx) error {
+	stmt := `
+	DROP TABLE _push_template;
+	`
+	_, err := tx.Exec(stmt)
+	return err
+}
@@ -0,0 +1,47 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package migration
+
+import "github.com/jmoiron/sqlx"
+
+type revision_c2e8a4f61d93 struct {
+}
+
+func (r *revision_c2e8a4f61d93) Version() string {
+	return "c2e8a4f61d93"
+}
+
+func (r *revision_c2e8a4f61d93) Up(tx *sqlx.Tx) error {
+	stmt := `
+	CREATE TABLE _pubsub_message (
+		id BIGSERIAL PRIMARY KEY,
+		channel TEXT NOT NULL,
+		data BYTEA NOT NULL,
+		created_at TIMESTAMP WITHOUT TIME ZONE NOT NULL
+	);
+	CREATE INDEX ON _pubsub_message (channel, id);
+	CREATE INDEX ON _pubsub_message (created_at);
+	`
+	_, err := tx.Exec(stmt)
+	return err
+}
+
+func (r *revision_c2e8a4f61d93) Down(tx *sqlx.Tx) error {
+	stmt := `
+	DROP TABLE _pubsub_message;
+	`
+	_, err := tx.Exec(stmt)
+	return err
+}
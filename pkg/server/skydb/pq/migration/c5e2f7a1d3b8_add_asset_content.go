@@ -0,0 +1,47 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package migration
+
+import "github.com/jmoiron/sqlx"
+
+type revision_c5e2f7a1d3b8 struct {
+}
+
+func (r *revision_c5e2f7a1d3b8) Version() string {
+	return "c5e2f7a1d3b8"
+}
+
+func (r *revision_c5e2f7a1d3b8) Up(tx *sqlx.Tx) error {
+	stmt := `
+	ALTER TABLE _asset ADD COLUMN hash TEXT;
+	CREATE TABLE _asset_content (
+		hash TEXT PRIMARY KEY,
+		content_type TEXT NOT NULL,
+		size BIGINT NOT NULL,
+		ref_count INTEGER NOT NULL
+	);
+	`
+	_, err := tx.Exec(stmt)
+	return err
+}
+
+func (r *revision_c5e2f7a1d3b8) Down(tx *sqlx.Tx) error {
+	stmt := `
+	DROP TABLE _asset_content;
+	ALTER TABLE _asset DROP COLUMN hash;
+	`
+	_, err := tx.Exec(stmt)
+	return err
+}
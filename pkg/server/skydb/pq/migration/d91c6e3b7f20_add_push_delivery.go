@@ -0,0 +1,55 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package migration
+
+import "github.com/jmoiron/sqlx"
+
+type revision_d91c6e3b7f20 struct {
+}
+
+func (r *revision_d91c6e3b7f20) Version() string {
+	return "d91c6e3b7f20"
+}
+
+func (r *revision_d91c6e3b7f20) Up(tx *sqlx.Tx) error {
+	stmt := `
+	CREATE TABLE _push_delivery (
+		id TEXT PRIMARY KEY,
+		push_id TEXT NOT NULL,
+		device_id TEXT NOT NULL,
+		user_id TEXT,
+		payload JSONB NOT NULL,
+		payload_hash TEXT NOT NULL,
+		status TEXT NOT NULL,
+		attempts INTEGER NOT NULL DEFAULT 0,
+		response TEXT,
+		next_attempt_at TIMESTAMP WITHOUT TIME ZONE,
+		created_at TIMESTAMP WITHOUT TIME ZONE NOT NULL,
+		updated_at TIMESTAMP WITHOUT TIME ZONE NOT NULL
+	);
+	CREATE INDEX ON _push_delivery (push_id);
+	CREATE INDEX ON _push_delivery (next_attempt_at) WHERE status = 'retrying';
+	`
+	_, err := tx.Exec(stmt)
+	return err
+}
+
+func (r *revision_d91c6e3b7f20) Down(tx *sqlx.Tx) error {
+	stmt := `
+	DROP TABLE _push_delivery;
+	`
+	_, err := tx.Exec(stmt)
+	return err
+}
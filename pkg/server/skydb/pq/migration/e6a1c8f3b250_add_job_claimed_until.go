@@ -0,0 +1,36 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package migration
+
+import "github.com/jmoiron/sqlx"
+
+type revision_e6a1c8f3b250 struct {
+}
+
+func (r *revision_e6a1c8f3b250) Version() string {
+	return "e6a1c8f3b250"
+}
+
+func (r *revision_e6a1c8f3b250) Up(tx *sqlx.Tx) error {
+	stmt := `ALTER TABLE _job ADD COLUMN claimed_until TIMESTAMP WITHOUT TIME ZONE;`
+	_, err := tx.Exec(stmt)
+	return err
+}
+
+func (r *revision_e6a1c8f3b250) Down(tx *sqlx.Tx) error {
+	stmt := `ALTER TABLE _job DROP COLUMN claimed_until;`
+	_, err := tx.Exec(stmt)
+	return err
+}
@@ -23,7 +23,7 @@ import (
 type fullMigration struct {
 }
 
-func (r *fullMigration) Version() string { return "7469be11899e" }
+func (r *fullMigration) Version() string { return "e6a1c8f3b250" }
 
 func (r *fullMigration) createTable(tx *sqlx.Tx) error {
 	const stmt = `
@@ -34,11 +34,20 @@ CREATE TABLE IF NOT EXISTS public.pending_notification (
 	op text NOT NULL,
 	appname text NOT NULL,
 	recordtype text NOT NULL,
-	record jsonb NOT NULL
+	record jsonb NOT NULL,
+	old_record jsonb
 );
+DO $$
+	BEGIN
+		ALTER TABLE public.pending_notification ADD COLUMN old_record jsonb;
+	EXCEPTION
+		WHEN duplicate_column THEN NULL;
+	END;
+$$;
 CREATE OR REPLACE FUNCTION public.notify_record_change() RETURNS TRIGGER AS $$
 	DECLARE
 		affected_record RECORD;
+		previous_record jsonb;
 		inserted_id integer;
 	BEGIN
 		IF (TG_OP = 'DELETE') THEN
@@ -46,8 +55,11 @@ CREATE OR REPLACE FUNCTION public.notify_record_change() RETURNS TRIGGER AS $$
 		ELSE
 			affected_record := NEW;
 		END IF;
-		INSERT INTO public.pending_notification (op, appname, recordtype, record)
-			VALUES (TG_OP, TG_TABLE_SCHEMA, TG_TABLE_NAME, row_to_json(affected_record)::jsonb)
+		IF (TG_OP = 'UPDATE') THEN
+			previous_record := row_to_json(OLD)::jsonb;
+		END IF;
+		INSERT INTO public.pending_notification (op, appname, recordtype, record, old_record)
+			VALUES (TG_OP, TG_TABLE_SCHEMA, TG_TABLE_NAME, row_to_json(affected_record)::jsonb, previous_record)
 			RETURNING id INTO inserted_id;
 		PERFORM pg_notify('record_change', inserted_id::TEXT);
 		RETURN affected_record;
@@ -80,8 +92,13 @@ CREATE TABLE _auth_role (
 CREATE TABLE _asset (
 	id text PRIMARY KEY,
 	content_type text NOT NULL,
-	size bigint NOT NULL
+	size bigint NOT NULL,
+	created_at TIMESTAMP WITHOUT TIME ZONE NOT NULL DEFAULT (now() AT TIME ZONE 'UTC'),
+	hash text,
+	status text,
+	metadata jsonb
 );
+CREATE INDEX ON _asset (created_at);
 CREATE TABLE _device (
 	id text PRIMARY KEY,
 	auth_id text REFERENCES _auth (id),
@@ -220,6 +237,68 @@ CREATE TABLE _verify_code (
 	created_at TIMESTAMP WITHOUT TIME ZONE NOT NULL
 );
 CREATE INDEX ON _verify_code (auth_id, code, consumed);
+
+CREATE TABLE _job (
+	id TEXT PRIMARY KEY,
+	name TEXT NOT NULL,
+	args JSONB,
+	key TEXT,
+	run_at TIMESTAMP WITHOUT TIME ZONE NOT NULL,
+	attempts INTEGER NOT NULL DEFAULT 0,
+	max_attempts INTEGER NOT NULL,
+	last_error TEXT,
+	created_at TIMESTAMP WITHOUT TIME ZONE NOT NULL,
+	claimed_until TIMESTAMP WITHOUT TIME ZONE,
+	UNIQUE (key)
+);
+CREATE INDEX ON _job (run_at);
+CREATE TABLE _pubsub_message (
+	id BIGSERIAL PRIMARY KEY,
+	channel TEXT NOT NULL,
+	data BYTEA NOT NULL,
+	created_at TIMESTAMP WITHOUT TIME ZONE NOT NULL
+);
+CREATE INDEX ON _pubsub_message (channel, id);
+CREATE INDEX ON _pubsub_message (created_at);
+CREATE TABLE _push_template (
+	name TEXT PRIMARY KEY,
+	default_locale TEXT NOT NULL,
+	locales JSONB NOT NULL,
+	updated_at TIMESTAMP WITHOUT TIME ZONE NOT NULL
+);
+CREATE TABLE _push_delivery (
+	id TEXT PRIMARY KEY,
+	push_id TEXT NOT NULL,
+	device_id TEXT NOT NULL,
+	user_id TEXT,
+	payload JSONB NOT NULL,
+	payload_hash TEXT NOT NULL,
+	status TEXT NOT NULL,
+	attempts INTEGER NOT NULL DEFAULT 0,
+	response TEXT,
+	next_attempt_at TIMESTAMP WITHOUT TIME ZONE,
+	created_at TIMESTAMP WITHOUT TIME ZONE NOT NULL,
+	updated_at TIMESTAMP WITHOUT TIME ZONE NOT NULL
+);
+CREATE INDEX ON _push_delivery (push_id);
+CREATE INDEX ON _push_delivery (next_attempt_at) WHERE status = 'retrying';
+CREATE TABLE _asset_upload (
+	id TEXT PRIMARY KEY,
+	name TEXT NOT NULL,
+	content_type TEXT NOT NULL,
+	length BIGINT NOT NULL,
+	upload_offset BIGINT NOT NULL DEFAULT 0,
+	chunks JSONB NOT NULL DEFAULT '[]'::jsonb,
+	multipart_upload_id TEXT,
+	created_at TIMESTAMP WITHOUT TIME ZONE NOT NULL,
+	updated_at TIMESTAMP WITHOUT TIME ZONE NOT NULL
+);
+CREATE TABLE _asset_content (
+	hash TEXT PRIMARY KEY,
+	content_type TEXT NOT NULL,
+	size BIGINT NOT NULL,
+	ref_count INTEGER NOT NULL
+);
 `
 	_, err := tx.Exec(stmt)
 	return err
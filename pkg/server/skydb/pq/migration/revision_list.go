@@ -45,4 +45,15 @@ var revisions = []Revision{
 	&revision_94ffce762644{},
 	&revision_b3163d49bd6d{},
 	&revision_7469be11899e{},
+	&revision_5a0e3c19d7b4{},
+	&revision_c2e8a4f61d93{},
+	&revision_e4b7d2a9c185{},
+	&revision_a7f3c92e5b14{},
+	&revision_d91c6e3b7f20{},
+	&revision_3f8d2c6a91b4{},
+	&revision_8b1e4d7c2a05{},
+	&revision_c5e2f7a1d3b8{},
+	&revision_f1a8d4c7e302{},
+	&revision_9c3e6b1d4a27{},
+	&revision_e6a1c8f3b250{},
 }
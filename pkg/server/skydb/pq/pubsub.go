@@ -0,0 +1,127 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pq
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"github.com/sirupsen/logrus"
+
+	"github.com/skygeario/skygear-server/pkg/server/logging"
+)
+
+// maxNotifyPayload is the maximum size of a payload of postgres NOTIFY.
+const maxNotifyPayload = 8000
+
+// ErrPubSubMessageTooLarge is returned by PubSubBackend.Publish if the
+// message cannot be sent as a postgres notification.
+var ErrPubSubMessageTooLarge = errors.New("pq/pubsub: message exceeds the size of a notification")
+
+// PubSubBackend relays pubsub messages between skygear-servers through
+// postgres LISTEN and NOTIFY.
+type PubSubBackend struct {
+	option  string
+	channel string
+	db      *sqlx.DB
+	logger  *logrus.Entry
+	done    chan struct{}
+	once    sync.Once
+}
+
+// NewPubSubBackend returns a PubSubBackend relaying messages on the
+// notification channel of the database.
+func NewPubSubBackend(option string, channel string) (*PubSubBackend, error) {
+	db, err := sqlx.Open("postgres", option)
+	if err != nil {
+		return nil, err
+	}
+
+	return &PubSubBackend{
+		option:  option,
+		channel: channel,
+		db:      db,
+		logger:  logging.LoggerEntry("skydb"),
+		done:    make(chan struct{}),
+	}, nil
+}
+
+// Publish notifies the channel with the message.
+func (b *PubSubBackend) Publish(message []byte) error {
+	if len(message) >= maxNotifyPayload {
+		return ErrPubSubMessageTooLarge
+	}
+
+	_, err := b.db.Exec("SELECT pg_notify($1, $2)", b.channel, string(message))
+	return err
+}
+
+// Listen calls the handler with the payload of each notification on the
+// channel, until the backend is closed.
+func (b *PubSubBackend) Listen(handler func(message []byte)) error {
+	eventCallback := func(event pq.ListenerEventType, err error) {
+		if err != nil {
+			b.logger.WithError(err).Errorf("pq/pubsub: Received an error")
+		} else {
+			b.logger.WithField("event", event).Infof("pq/pubsub: Received an event")
+		}
+	}
+
+	listener := pq.NewListener(
+		b.option,
+		10*time.Second,
+		time.Minute,
+		eventCallback)
+	defer listener.Close()
+
+	if err := listener.Listen(b.channel); err != nil {
+		return err
+	}
+
+	b.logger.Infof("pq/pubsub: Listening to %s...", b.channel)
+
+	for {
+		select {
+		case pqNotification := <-listener.Notify:
+			if pqNotification == nil {
+				// After reconnected db, a
+				// nil pq.Notification is sent on the Listener.Notify channel.
+				b.logger.Warnln("pq/pubsub: got nil notification")
+				continue
+			}
+
+			handler([]byte(pqNotification.Extra))
+		case <-time.After(60 * time.Second):
+			go func() {
+				if err := listener.Ping(); err != nil {
+					b.logger.WithError(err).Errorln("pq/pubsub: got an err while pinging connection")
+				}
+			}()
+		case <-b.done:
+			return nil
+		}
+	}
+}
+
+// Close stops listening to the channel.
+func (b *PubSubBackend) Close() error {
+	b.once.Do(func() {
+		close(b.done)
+	})
+	return b.db.Close()
+}
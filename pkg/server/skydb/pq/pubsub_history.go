@@ -0,0 +1,110 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pq
+
+import (
+	"sync"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"github.com/sirupsen/logrus"
+
+	"github.com/skygeario/skygear-server/pkg/server/logging"
+	"github.com/skygeario/skygear-server/pkg/server/pubsub"
+)
+
+// PubSubHistory is a pubsub.History retaining messages in the
+// _pubsub_message table of the app, such that the history is shared among
+// skygear-servers.
+type PubSubHistory struct {
+	db         *sqlx.DB
+	table      string
+	size       int
+	ttl        time.Duration
+	timeNow    func() time.Time
+	logger     *logrus.Entry
+	mutex      sync.Mutex
+	lastPruned time.Time
+}
+
+// NewPubSubHistory returns a PubSubHistory of the app. Up to size messages
+// of a channel are replayed, and messages older than ttl are removed.
+func NewPubSubHistory(option string, appName string, size int, ttl time.Duration) (*PubSubHistory, error) {
+	db, err := sqlx.Open("postgres", option)
+	if err != nil {
+		return nil, err
+	}
+
+	schema := "app_" + toLowerAndUnderscore(appName)
+	return &PubSubHistory{
+		db:      db,
+		table:   pq.QuoteIdentifier(schema) + "." + pq.QuoteIdentifier("_pubsub_message"),
+		size:    size,
+		ttl:     ttl,
+		timeNow: timeNow,
+		logger:  logging.LoggerEntry("skydb"),
+	}, nil
+}
+
+// Append implements the pubsub.History interface.
+func (h *PubSubHistory) Append(channel string, data []byte) (int64, error) {
+	now := h.timeNow().UTC()
+	h.prune(now)
+
+	var id int64
+	err := h.db.QueryRowx(
+		"INSERT INTO "+h.table+" (channel, data, created_at) VALUES ($1, $2, $3) RETURNING id",
+		channel, data, now,
+	).Scan(&id)
+	return id, err
+}
+
+// Since implements the pubsub.History interface.
+func (h *PubSubHistory) Since(channel string, id int64) ([]pubsub.Message, error) {
+	rows, err := h.db.Queryx(
+		"SELECT id, data FROM "+h.table+" WHERE channel = $1 AND id > $2 AND created_at > $3 ORDER BY id DESC LIMIT $4",
+		channel, id, h.timeNow().UTC().Add(-h.ttl), h.size,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	messages := []pubsub.Message{}
+	for rows.Next() {
+		m := pubsub.Message{Channel: channel}
+		if scanErr := rows.Scan(&m.ID, &m.Data); scanErr != nil {
+			return nil, scanErr
+		}
+		messages = append([]pubsub.Message{m}, messages...)
+	}
+	return messages, rows.Err()
+}
+
+// prune removes messages older than the TTL, at most once a minute.
+func (h *PubSubHistory) prune(now time.Time) {
+	h.mutex.Lock()
+	if now.Sub(h.lastPruned) < time.Minute {
+		h.mutex.Unlock()
+		return
+	}
+	h.lastPruned = now
+	h.mutex.Unlock()
+
+	if _, err := h.db.Exec("DELETE FROM "+h.table+" WHERE created_at < $1", now.Add(-h.ttl)); err != nil {
+		h.logger.WithError(err).Warnln("pq/pubsub: failed to prune history")
+	}
+}
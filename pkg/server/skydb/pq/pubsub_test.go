@@ -0,0 +1,94 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pq
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestPubSubBackend(t *testing.T) {
+	Convey("PubSubBackend", t, func() {
+		c := getTestConn(t)
+		defer cleanupConn(t, c)
+
+		backend, err := NewPubSubBackend(c.option, "skygear_test_pubsub")
+		So(err, ShouldBeNil)
+		defer backend.Close()
+
+		Convey("receives published messages", func() {
+			received := make(chan []byte, 1)
+			go backend.Listen(func(message []byte) {
+				received <- message
+			})
+
+			var message []byte
+			for i := 0; i < 10 && message == nil; i++ {
+				So(backend.Publish([]byte(`{"channel":"hello"}`)), ShouldBeNil)
+				select {
+				case message = <-received:
+				case <-time.After(100 * time.Millisecond):
+				}
+			}
+			So(string(message), ShouldEqual, `{"channel":"hello"}`)
+		})
+
+		Convey("rejects messages too large", func() {
+			err := backend.Publish([]byte(strings.Repeat("a", maxNotifyPayload)))
+			So(err, ShouldEqual, ErrPubSubMessageTooLarge)
+		})
+	})
+}
+
+func TestPubSubHistory(t *testing.T) {
+	Convey("PubSubHistory", t, func() {
+		c := getTestConn(t)
+		defer cleanupConn(t, c)
+
+		history, err := NewPubSubHistory(c.option, c.appName, 2, time.Hour)
+		So(err, ShouldBeNil)
+
+		Convey("returns messages since ID", func() {
+			id1, err := history.Append("chat", []byte("1"))
+			So(err, ShouldBeNil)
+			id2, err := history.Append("chat", []byte("2"))
+			So(err, ShouldBeNil)
+			_, err = history.Append("other", []byte("other"))
+			So(err, ShouldBeNil)
+			So(id2, ShouldBeGreaterThan, id1)
+
+			messages, err := history.Since("chat", id1)
+			So(err, ShouldBeNil)
+			So(len(messages), ShouldEqual, 1)
+			So(messages[0].ID, ShouldEqual, id2)
+			So(messages[0].Data, ShouldResemble, []byte("2"))
+		})
+
+		Convey("returns up to size latest messages in order", func() {
+			history.Append("chat", []byte("1"))
+			history.Append("chat", []byte("2"))
+			history.Append("chat", []byte("3"))
+
+			messages, err := history.Since("chat", 0)
+			So(err, ShouldBeNil)
+			So(len(messages), ShouldEqual, 2)
+			So(messages[0].Data, ShouldResemble, []byte("2"))
+			So(messages[1].Data, ShouldResemble, []byte("3"))
+		})
+	})
+}
@@ -0,0 +1,215 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pq
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	sq "github.com/lann/squirrel"
+	"github.com/lib/pq"
+	"github.com/skygeario/skygear-server/pkg/server/skydb"
+	"github.com/skygeario/skygear-server/pkg/server/uuid"
+)
+
+var pushDeliveryColumns = []string{
+	"id", "push_id", "device_id", "user_id", "payload", "payload_hash",
+	"status", "attempts", "response", "next_attempt_at", "created_at",
+	"updated_at",
+}
+
+func (c *conn) CreatePushDelivery(delivery *skydb.PushDelivery) error {
+	if delivery.ID == "" {
+		delivery.ID = uuid.New()
+	}
+	if delivery.CreatedAt.IsZero() {
+		delivery.CreatedAt = time.Now().UTC()
+	}
+	if delivery.UpdatedAt.IsZero() {
+		delivery.UpdatedAt = delivery.CreatedAt
+	}
+
+	payload, err := json.Marshal(delivery.Payload)
+	if err != nil {
+		return err
+	}
+
+	builder := psql.Insert(c.tableName("_push_delivery")).Columns(pushDeliveryColumns...).Values(
+		delivery.ID,
+		delivery.PushID,
+		delivery.DeviceID,
+		sql.NullString{String: delivery.UserID, Valid: delivery.UserID != ""},
+		payload,
+		delivery.PayloadHash,
+		string(delivery.Status),
+		delivery.Attempts,
+		sql.NullString{String: delivery.Response, Valid: delivery.Response != ""},
+		pq.NullTime{Time: delivery.NextAttemptAt.UTC(), Valid: !delivery.NextAttemptAt.IsZero()},
+		delivery.CreatedAt.UTC(),
+		delivery.UpdatedAt.UTC(),
+	)
+
+	_, err = c.ExecWith(builder)
+	return err
+}
+
+func (c *conn) UpdatePushDelivery(delivery *skydb.PushDelivery) error {
+	if delivery.UpdatedAt.IsZero() {
+		delivery.UpdatedAt = time.Now().UTC()
+	}
+
+	builder := psql.Update(c.tableName("_push_delivery")).
+		Set("status", string(delivery.Status)).
+		Set("attempts", delivery.Attempts).
+		Set("response", sql.NullString{String: delivery.Response, Valid: delivery.Response != ""}).
+		Set("next_attempt_at", pq.NullTime{Time: delivery.NextAttemptAt.UTC(), Valid: !delivery.NextAttemptAt.IsZero()}).
+		Set("updated_at", delivery.UpdatedAt.UTC()).
+		Where("id = ?", delivery.ID)
+
+	result, err := c.ExecWith(builder)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return skydb.ErrPushDeliveryNotFound
+	} else if rowsAffected > 1 {
+		panic(fmt.Errorf("want 1 rows updated, got %v", rowsAffected))
+	}
+
+	return nil
+}
+
+func (c *conn) QueryPushDeliveries(pushID string) ([]skydb.PushDelivery, error) {
+	builder := psql.Select(pushDeliveryColumns...).
+		From(c.tableName("_push_delivery")).
+		Where("push_id = ?", pushID).
+		OrderBy("created_at", "id")
+
+	rows, err := c.QueryWith(builder)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return c.doScanPushDeliveries(rows)
+}
+
+func (c *conn) ClaimRetryPushDeliveries(t time.Time, lockUntil time.Time, limit int) ([]skydb.PushDelivery, error) {
+	tableName := c.tableName("_push_delivery")
+	// subquery is built with question placeholders, which are replaced
+	// when the whole statement is built
+	subquery := sq.Select("id").From(tableName).
+		Where("status = ? AND next_attempt_at <= ?", string(skydb.PushDeliveryRetrying), t.UTC()).
+		OrderBy("next_attempt_at").
+		Limit(uint64(limit)).
+		Suffix("FOR UPDATE SKIP LOCKED")
+	subquerySQL, subqueryArgs, err := subquery.ToSql()
+	if err != nil {
+		return nil, err
+	}
+
+	builder := psql.Update(tableName).
+		Set("next_attempt_at", lockUntil.UTC()).
+		Where(fmt.Sprintf("id IN (%s)", subquerySQL), subqueryArgs...).
+		Suffix("RETURNING " + strings.Join(pushDeliveryColumns, ", "))
+
+	rows, err := c.QueryWith(builder)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return c.doScanPushDeliveries(rows)
+}
+
+func (c *conn) DeletePushDeliveries(updatedBefore time.Time) (int, error) {
+	builder := psql.Delete(c.tableName("_push_delivery")).
+		Where("status <> ? AND updated_at < ?", string(skydb.PushDeliveryRetrying), updatedBefore.UTC())
+
+	result, err := c.ExecWith(builder)
+	if err != nil {
+		return 0, err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	return int(rowsAffected), nil
+}
+
+func (c *conn) doScanPushDeliveries(rows *sqlx.Rows) ([]skydb.PushDelivery, error) {
+	deliveries := []skydb.PushDelivery{}
+	for rows.Next() {
+		delivery := skydb.PushDelivery{}
+		if err := c.doScanPushDelivery(&delivery, rows); err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, delivery)
+	}
+	return deliveries, rows.Err()
+}
+
+func (c *conn) doScanPushDelivery(delivery *skydb.PushDelivery, scanner sq.RowScanner) error {
+	var (
+		userID        sql.NullString
+		payload       []byte
+		status        string
+		response      sql.NullString
+		nextAttemptAt pq.NullTime
+	)
+
+	err := scanner.Scan(
+		&delivery.ID,
+		&delivery.PushID,
+		&delivery.DeviceID,
+		&userID,
+		&payload,
+		&delivery.PayloadHash,
+		&status,
+		&delivery.Attempts,
+		&response,
+		&nextAttemptAt,
+		&delivery.CreatedAt,
+		&delivery.UpdatedAt,
+	)
+	if err != nil {
+		return err
+	}
+
+	if err = json.Unmarshal(payload, &delivery.Payload); err != nil {
+		return err
+	}
+	delivery.UserID = userID.String
+	delivery.Status = skydb.PushDeliveryStatus(status)
+	delivery.Response = response.String
+	if nextAttemptAt.Valid {
+		delivery.NextAttemptAt = nextAttemptAt.Time.In(time.UTC)
+	} else {
+		delivery.NextAttemptAt = time.Time{}
+	}
+	delivery.CreatedAt = delivery.CreatedAt.In(time.UTC)
+	delivery.UpdatedAt = delivery.UpdatedAt.In(time.UTC)
+	return nil
+}
@@ -0,0 +1,125 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pq
+
+import (
+	"testing"
+	"time"
+
+	"github.com/skygeario/skygear-server/pkg/server/skydb"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestPushDeliveryConn(t *testing.T) {
+	var c *conn
+
+	Convey("Conn", t, func() {
+		c = getTestConn(t)
+		defer cleanupConn(t, c)
+
+		delivery := skydb.PushDelivery{
+			ID:          "delivery",
+			PushID:      "push",
+			DeviceID:    "device",
+			UserID:      "user",
+			Payload:     map[string]interface{}{"apns": map[string]interface{}{}},
+			PayloadHash: "hash",
+			Status:      skydb.PushDeliveryPending,
+			CreatedAt:   time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC),
+			UpdatedAt:   time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC),
+		}
+
+		Convey("create and query push deliveries", func() {
+			other := delivery
+			other.ID = "other"
+			other.PushID = "other-push"
+			So(c.CreatePushDelivery(&delivery), ShouldBeNil)
+			So(c.CreatePushDelivery(&other), ShouldBeNil)
+
+			deliveries, err := c.QueryPushDeliveries("push")
+			So(err, ShouldBeNil)
+			So(deliveries, ShouldResemble, []skydb.PushDelivery{delivery})
+		})
+
+		Convey("update push delivery", func() {
+			So(c.CreatePushDelivery(&delivery), ShouldBeNil)
+
+			delivery.Status = skydb.PushDeliveryRetrying
+			delivery.Attempts = 1
+			delivery.Response = "503 Service Unavailable"
+			delivery.NextAttemptAt = time.Date(2017, 1, 1, 0, 1, 0, 0, time.UTC)
+			delivery.UpdatedAt = time.Date(2017, 1, 1, 0, 0, 1, 0, time.UTC)
+			So(c.UpdatePushDelivery(&delivery), ShouldBeNil)
+
+			deliveries, err := c.QueryPushDeliveries("push")
+			So(err, ShouldBeNil)
+			So(deliveries, ShouldResemble, []skydb.PushDelivery{delivery})
+		})
+
+		Convey("update non-existent push delivery", func() {
+			So(c.UpdatePushDelivery(&delivery), ShouldEqual, skydb.ErrPushDeliveryNotFound)
+		})
+
+		Convey("claim retrying push deliveries", func() {
+			delivery.Status = skydb.PushDeliveryRetrying
+			delivery.NextAttemptAt = time.Date(2017, 1, 1, 0, 1, 0, 0, time.UTC)
+			So(c.CreatePushDelivery(&delivery), ShouldBeNil)
+
+			later := delivery
+			later.ID = "later"
+			later.NextAttemptAt = time.Date(2017, 1, 1, 1, 0, 0, 0, time.UTC)
+			So(c.CreatePushDelivery(&later), ShouldBeNil)
+
+			sent := delivery
+			sent.ID = "sent"
+			sent.Status = skydb.PushDeliverySent
+			So(c.CreatePushDelivery(&sent), ShouldBeNil)
+
+			now := time.Date(2017, 1, 1, 0, 2, 0, 0, time.UTC)
+			lockUntil := now.Add(5 * time.Minute)
+			deliveries, err := c.ClaimRetryPushDeliveries(now, lockUntil, 10)
+			So(err, ShouldBeNil)
+			So(len(deliveries), ShouldEqual, 1)
+			So(deliveries[0].ID, ShouldEqual, "delivery")
+			So(deliveries[0].NextAttemptAt, ShouldResemble, lockUntil)
+
+			deliveries, err = c.ClaimRetryPushDeliveries(now, lockUntil, 10)
+			So(err, ShouldBeNil)
+			So(deliveries, ShouldBeEmpty)
+		})
+
+		Convey("delete push deliveries", func() {
+			So(c.CreatePushDelivery(&delivery), ShouldBeNil)
+
+			retrying := delivery
+			retrying.ID = "retrying"
+			retrying.Status = skydb.PushDeliveryRetrying
+			So(c.CreatePushDelivery(&retrying), ShouldBeNil)
+
+			recent := delivery
+			recent.ID = "recent"
+			recent.UpdatedAt = time.Date(2017, 1, 3, 0, 0, 0, 0, time.UTC)
+			So(c.CreatePushDelivery(&recent), ShouldBeNil)
+
+			count, err := c.DeletePushDeliveries(time.Date(2017, 1, 2, 0, 0, 0, 0, time.UTC))
+			So(err, ShouldBeNil)
+			So(count, ShouldEqual, 1)
+
+			deliveries, err := c.QueryPushDeliveries("push")
+			So(err, ShouldBeNil)
+			So(len(deliveries), ShouldEqual, 2)
+		})
+	})
+}
@@ -0,0 +1,125 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pq
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	sq "github.com/lann/squirrel"
+	"github.com/skygeario/skygear-server/pkg/server/skydb"
+	"github.com/skygeario/skygear-server/pkg/server/skydb/pq/builder"
+)
+
+func (c *conn) basePushTemplateBuilder() sq.SelectBuilder {
+	return psql.Select("name", "default_locale", "locales", "updated_at").
+		From(c.tableName("_push_template"))
+}
+
+func (c *conn) GetPushTemplate(name string, template *skydb.PushTemplate) error {
+	builder := c.basePushTemplateBuilder().Where("name = ?", name)
+	err := c.doScanPushTemplate(template, c.QueryRowWith(builder))
+	if err == sql.ErrNoRows {
+		return skydb.ErrPushTemplateNotFound
+	}
+	return err
+}
+
+func (c *conn) QueryPushTemplates() ([]skydb.PushTemplate, error) {
+	builder := c.basePushTemplateBuilder().OrderBy("name")
+	rows, err := c.QueryWith(builder)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	templates := []skydb.PushTemplate{}
+	for rows.Next() {
+		template := skydb.PushTemplate{}
+		if scanErr := c.doScanPushTemplate(&template, rows); scanErr != nil {
+			return nil, scanErr
+		}
+		templates = append(templates, template)
+	}
+	return templates, rows.Err()
+}
+
+func (c *conn) doScanPushTemplate(template *skydb.PushTemplate, scanner sq.RowScanner) error {
+	var locales []byte
+	err := scanner.Scan(
+		&template.Name,
+		&template.DefaultLocale,
+		&locales,
+		&template.UpdatedAt,
+	)
+	if err != nil {
+		return err
+	}
+
+	template.Locales = map[string]skydb.PushTemplateContent{}
+	if err = json.Unmarshal(locales, &template.Locales); err != nil {
+		return err
+	}
+	template.UpdatedAt = template.UpdatedAt.In(time.UTC)
+	return nil
+}
+
+func (c *conn) SavePushTemplate(template *skydb.PushTemplate) error {
+	if template.Name == "" {
+		return fmt.Errorf("invalid push template: empty name")
+	}
+	if template.UpdatedAt.IsZero() {
+		template.UpdatedAt = time.Now().UTC()
+	}
+
+	locales, err := json.Marshal(template.Locales)
+	if err != nil {
+		return err
+	}
+
+	pkData := map[string]interface{}{"name": template.Name}
+	data := map[string]interface{}{
+		"default_locale": template.DefaultLocale,
+		"locales":        locales,
+		"updated_at":     template.UpdatedAt.UTC(),
+	}
+
+	upsert := builder.UpsertQuery(c.tableName("_push_template"), pkData, data)
+	_, err = c.ExecWith(upsert)
+	return err
+}
+
+func (c *conn) DeletePushTemplate(name string) error {
+	builder := psql.Delete(c.tableName("_push_template")).
+		Where("name = ?", name)
+	result, err := c.ExecWith(builder)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return skydb.ErrPushTemplateNotFound
+	} else if rowsAffected > 1 {
+		panic(fmt.Errorf("want 1 rows deleted, got %v", rowsAffected))
+	}
+
+	return nil
+}
@@ -0,0 +1,86 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pq
+
+import (
+	"testing"
+	"time"
+
+	"github.com/skygeario/skygear-server/pkg/server/skydb"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestPushTemplateConn(t *testing.T) {
+	var c *conn
+
+	Convey("Conn", t, func() {
+		c = getTestConn(t)
+		defer cleanupConn(t, c)
+
+		template := skydb.PushTemplate{
+			Name:          "welcome",
+			DefaultLocale: "en",
+			Locales: map[string]skydb.PushTemplateContent{
+				"en": {Title: "Welcome", Body: "Hello {{.name}}"},
+				"zh": {Title: "歡迎", Body: "你好 {{.name}}"},
+			},
+			UpdatedAt: time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC),
+		}
+
+		Convey("save and get push template", func() {
+			So(c.SavePushTemplate(&template), ShouldBeNil)
+
+			fetched := skydb.PushTemplate{}
+			So(c.GetPushTemplate("welcome", &fetched), ShouldBeNil)
+			So(fetched, ShouldResemble, template)
+		})
+
+		Convey("replace push template with the same name", func() {
+			So(c.SavePushTemplate(&template), ShouldBeNil)
+
+			template.DefaultLocale = "zh"
+			So(c.SavePushTemplate(&template), ShouldBeNil)
+
+			fetched := skydb.PushTemplate{}
+			So(c.GetPushTemplate("welcome", &fetched), ShouldBeNil)
+			So(fetched.DefaultLocale, ShouldEqual, "zh")
+		})
+
+		Convey("query push templates", func() {
+			other := template
+			other.Name = "reminder"
+			So(c.SavePushTemplate(&template), ShouldBeNil)
+			So(c.SavePushTemplate(&other), ShouldBeNil)
+
+			templates, err := c.QueryPushTemplates()
+			So(err, ShouldBeNil)
+			So(len(templates), ShouldEqual, 2)
+			So(templates[0].Name, ShouldEqual, "reminder")
+			So(templates[1].Name, ShouldEqual, "welcome")
+		})
+
+		Convey("delete push template", func() {
+			So(c.SavePushTemplate(&template), ShouldBeNil)
+			So(c.DeletePushTemplate("welcome"), ShouldBeNil)
+
+			fetched := skydb.PushTemplate{}
+			So(c.GetPushTemplate("welcome", &fetched), ShouldEqual, skydb.ErrPushTemplateNotFound)
+		})
+
+		Convey("return ErrPushTemplateNotFound when delete non-existent push template", func() {
+			So(c.DeletePushTemplate("welcome"), ShouldEqual, skydb.ErrPushTemplateNotFound)
+		})
+	})
+}
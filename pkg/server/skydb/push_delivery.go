@@ -0,0 +1,54 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package skydb
+
+import "time"
+
+// PushDeliveryStatus is the status of a PushDelivery.
+type PushDeliveryStatus string
+
+// List of PushDeliveryStatus
+const (
+	// PushDeliveryPending means the notification is being sent.
+	PushDeliveryPending PushDeliveryStatus = "pending"
+	// PushDeliverySent means the notification is accepted by the push
+	// service.
+	PushDeliverySent PushDeliveryStatus = "sent"
+	// PushDeliveryRetrying means the notification failed with a transient
+	// error and will be sent again at NextAttemptAt.
+	PushDeliveryRetrying PushDeliveryStatus = "retrying"
+	// PushDeliveryFailed means the notification is not delivered and will
+	// not be retried.
+	PushDeliveryFailed PushDeliveryStatus = "failed"
+)
+
+// PushDelivery records the delivery of a push notification to a device.
+//
+// Deliveries of the same push notification to multiple devices share the
+// same PushID.
+type PushDelivery struct {
+	ID            string
+	PushID        string
+	DeviceID      string
+	UserID        string
+	Payload       map[string]interface{}
+	PayloadHash   string
+	Status        PushDeliveryStatus
+	Attempts      int
+	Response      string
+	NextAttemptAt time.Time
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+}
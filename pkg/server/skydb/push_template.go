@@ -0,0 +1,66 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package skydb
+
+import (
+	"strings"
+	"time"
+)
+
+// PushTemplate is a named push notification with content in one or more
+// locales. The content is rendered with data when the notification is sent.
+type PushTemplate struct {
+	Name          string                         `json:"name"`
+	DefaultLocale string                         `json:"default_locale"`
+	Locales       map[string]PushTemplateContent `json:"locales"`
+	UpdatedAt     time.Time                      `json:"updated_at"`
+}
+
+// PushTemplateContent is the content of a PushTemplate in a locale.
+//
+// Title, Body and strings in Data and the platform dictionaries are
+// templates in the syntax of text/template. APNS, FCM, Baidu and Web are merged
+// into the payload generated for the corresponding platform.
+type PushTemplateContent struct {
+	Title string                 `json:"title,omitempty"`
+	Body  string                 `json:"body,omitempty"`
+	Sound string                 `json:"sound,omitempty"`
+	Badge *int                   `json:"badge,omitempty"`
+	Data  map[string]interface{} `json:"data,omitempty"`
+	APNS  map[string]interface{} `json:"apns,omitempty"`
+	FCM   map[string]interface{} `json:"fcm,omitempty"`
+	Baidu map[string]interface{} `json:"baidu-android,omitempty"`
+	Web   map[string]interface{} `json:"web,omitempty"`
+}
+
+// Content returns the content of the template in the supplied locale.
+//
+// If there is no content in the locale, content in the language of the
+// locale (e.g. "zh" for "zh-HK") is returned, then content in the default
+// locale. The returned bool is false if none of them exists.
+func (t *PushTemplate) Content(locale string) (PushTemplateContent, bool) {
+	if content, ok := t.Locales[locale]; ok {
+		return content, true
+	}
+
+	if i := strings.IndexAny(locale, "-_"); i > 0 {
+		if content, ok := t.Locales[locale[:i]]; ok {
+			return content, true
+		}
+	}
+
+	content, ok := t.Locales[t.DefaultLocale]
+	return content, ok
+}
@@ -0,0 +1,67 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package skydb
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestPushTemplateContent(t *testing.T) {
+	Convey("PushTemplate.Content", t, func() {
+		template := PushTemplate{
+			Name:          "welcome",
+			DefaultLocale: "en",
+			Locales: map[string]PushTemplateContent{
+				"en":    {Body: "Welcome"},
+				"zh":    {Body: "歡迎"},
+				"zh-HK": {Body: "歡迎你"},
+			},
+		}
+
+		Convey("returns content in the locale", func() {
+			content, ok := template.Content("zh-HK")
+			So(ok, ShouldBeTrue)
+			So(content.Body, ShouldEqual, "歡迎你")
+		})
+
+		Convey("returns content in the language of the locale", func() {
+			content, ok := template.Content("zh-TW")
+			So(ok, ShouldBeTrue)
+			So(content.Body, ShouldEqual, "歡迎")
+
+			content, ok = template.Content("zh_CN")
+			So(ok, ShouldBeTrue)
+			So(content.Body, ShouldEqual, "歡迎")
+		})
+
+		Convey("returns content in the default locale", func() {
+			content, ok := template.Content("ja")
+			So(ok, ShouldBeTrue)
+			So(content.Body, ShouldEqual, "Welcome")
+
+			content, ok = template.Content("")
+			So(ok, ShouldBeTrue)
+			So(content.Body, ShouldEqual, "Welcome")
+		})
+
+		Convey("returns false without content in the default locale", func() {
+			template.DefaultLocale = "fr"
+			_, ok := template.Content("ja")
+			So(ok, ShouldBeFalse)
+		})
+	})
+}
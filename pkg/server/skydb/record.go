@@ -71,23 +71,71 @@ func (id *RecordID) IsEmpty() bool {
 	return id.Type == "" && id.Key == ""
 }
 
+// Asset models a file uploaded to the asset store. If Hash is not empty,
+// the content of the asset is stored by its hash and shared by assets of
+// identical content, see AssetContent. Status is empty if the asset is
+// not scanned for malware. Metadata is nil if no metadata is extracted
+// from the content of the asset.
 type Asset struct {
 	Name        string
 	ContentType string
 	Size        int64
+	Hash        string
+	Status      AssetStatus
+	Metadata    *asset.Metadata
 	Public      bool
 	Signer      asset.URLSigner
 }
 
-// SignedURL will try to return a signedURL with the injected Signer.
+// AssetStatus is the malware scanning status of an asset
+type AssetStatus string
+
+const (
+	// AssetStatusPending means the asset is waiting to be scanned
+	AssetStatusPending AssetStatus = "pending"
+	// AssetStatusClean means no malware is found in the asset
+	AssetStatusClean AssetStatus = "clean"
+	// AssetStatusInfected means malware is found in the asset
+	AssetStatusInfected AssetStatus = "infected"
+)
+
+// IsServable returns whether the content of the asset can be served,
+// which is false if the asset is not yet scanned or is infected.
+func (a *Asset) IsServable() bool {
+	return a.Status != AssetStatusPending && a.Status != AssetStatusInfected
+}
+
+// ObjectName returns the name under which the content of the asset is
+// stored in the asset store.
+func (a *Asset) ObjectName() string {
+	if a.Hash == "" {
+		return a.Name
+	}
+	return asset.ContentObjectName(a.Hash)
+}
+
+// SignedURL will try to return a signedURL with the injected Signer. An
+// empty string is returned if the asset is not servable, as the signed
+// URL may be served by the asset store directly.
 func (a *Asset) SignedURL() string {
 	logger := logging.LoggerEntry("skydb")
+	if !a.IsServable() {
+		return ""
+	}
 	if a.Signer == nil {
 		logger.Warnf("Unable to generate signed url of asset because no singer is injected.")
 		return ""
 	}
 
-	url, err := a.Signer.SignedURL(a.Name)
+	var (
+		url string
+		err error
+	)
+	if store, ok := a.Signer.(asset.ContentAddressedStore); ok && a.Hash != "" {
+		url, err = store.SignedContentURL(a.Name, a.Hash)
+	} else {
+		url, err = a.Signer.SignedURL(a.Name)
+	}
 	if err != nil {
 		logger.Warnf("Unable to generate signed url: %v", err)
 	}
@@ -69,6 +69,44 @@ func TestRecord(t *testing.T) {
 	})
 }
 
+type testURLSigner struct{}
+
+func (s testURLSigner) SignedURL(name string) (string, error) {
+	return "http://skygear.test/files/" + name + "?signature=signature", nil
+}
+
+func (s testURLSigner) IsSignatureRequired() bool {
+	return true
+}
+
+func TestAssetSignedURL(t *testing.T) {
+	Convey("Asset SignedURL", t, func() {
+		asset := Asset{
+			Name:   "photo.png",
+			Signer: testURLSigner{},
+		}
+
+		Convey("signs url of clean asset", func() {
+			asset.Status = AssetStatusClean
+			So(asset.SignedURL(), ShouldEqual, "http://skygear.test/files/photo.png?signature=signature")
+		})
+
+		Convey("signs url of asset not scanned", func() {
+			So(asset.SignedURL(), ShouldEqual, "http://skygear.test/files/photo.png?signature=signature")
+		})
+
+		Convey("does not sign url of pending asset", func() {
+			asset.Status = AssetStatusPending
+			So(asset.SignedURL(), ShouldEqual, "")
+		})
+
+		Convey("does not sign url of infected asset", func() {
+			asset.Status = AssetStatusInfected
+			So(asset.SignedURL(), ShouldEqual, "")
+		})
+	})
+}
+
 func TestRecordACL(t *testing.T) {
 	Convey("Record with ACL", t, func() {
 		authinfo := &AuthInfo{
@@ -143,6 +143,9 @@ func (asset *MapAsset) ToMap(m map[string]interface{}) {
 	if asset.ContentType != "" {
 		m["$content_type"] = asset.ContentType
 	}
+	if asset.Metadata != nil {
+		m["$metadata"] = asset.Metadata
+	}
 	url := (*skydb.Asset)(asset).SignedURL()
 	if url != "" {
 		m["$url"] = url
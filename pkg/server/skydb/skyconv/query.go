@@ -0,0 +1,486 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package skyconv
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/skygeario/skygear-server/pkg/server/skydb"
+	"github.com/skygeario/skygear-server/pkg/server/skyerr"
+)
+
+// QueryParser is a context for parsing raw query to skydb.Query
+type QueryParser struct {
+	UserID string
+}
+
+// sortFromRaw parses the specified structure into a Sort struct.
+//
+// The structure takes the following form:
+//
+//     [ _expression_ , _sort_order ]
+//
+// Expression supports key path type or the function type. Literal type is
+// not supported.
+//
+// Sort Order only supports `"asc"` or `"desc"`.
+func (parser *QueryParser) sortFromRaw(rawSort []interface{}, sort *skydb.Sort) {
+	// Parse expression.
+	expr := parser.parseExpression(rawSort[0])
+	if expr.Type == skydb.Literal {
+		panic(errors.New("sort does not support literal"))
+	}
+
+	// Parse sort order.
+	var sortOrder skydb.SortOrder
+	orderStr, _ := rawSort[1].(string)
+	if orderStr == "" {
+		panic(errors.New("empty sort order in sort descriptor"))
+	}
+	switch orderStr {
+	case "asc":
+		sortOrder = skydb.Asc
+	case "desc":
+		sortOrder = skydb.Desc
+	default:
+		panic(fmt.Errorf("unknown sort order: %v", orderStr))
+	}
+
+	sort.Expression = expr
+	sort.Order = sortOrder
+}
+
+func (parser *QueryParser) sortsFromRaw(rawSorts []interface{}) []skydb.Sort {
+	length := len(rawSorts)
+	sorts := make([]skydb.Sort, length, length)
+
+	for i := range rawSorts {
+		sortSlice, _ := rawSorts[i].([]interface{})
+		if len(sortSlice) != 2 {
+			panic(fmt.Errorf("got len(sort descriptor) = %v, want 2", len(sortSlice)))
+		}
+		parser.sortFromRaw(sortSlice, &sorts[i])
+	}
+
+	return sorts
+}
+
+func (parser *QueryParser) predicateOperatorFromString(operatorString string) skydb.Operator {
+	switch operatorString {
+	case "and":
+		return skydb.And
+	case "or":
+		return skydb.Or
+	case "not":
+		return skydb.Not
+	case "eq":
+		return skydb.Equal
+	case "gt":
+		return skydb.GreaterThan
+	case "lt":
+		return skydb.LessThan
+	case "gte":
+		return skydb.GreaterThanOrEqual
+	case "lte":
+		return skydb.LessThanOrEqual
+	case "neq":
+		return skydb.NotEqual
+	case "like":
+		return skydb.Like
+	case "ilike":
+		return skydb.ILike
+	case "in":
+		return skydb.In
+	case "func":
+		return skydb.Functional
+	default:
+		panic(fmt.Errorf("unrecognized operator = %s", operatorString))
+	}
+}
+
+func (parser *QueryParser) predicateFromRaw(rawPredicate []interface{}) skydb.Predicate {
+	if len(rawPredicate) < 2 {
+		panic(fmt.Errorf("got len(predicate) = %v, want at least 2", len(rawPredicate)))
+	}
+
+	rawOperator, ok := rawPredicate[0].(string)
+	if !ok {
+		panic(fmt.Errorf("got predicate[0]'s type = %T, want string", rawPredicate[0]))
+	}
+
+	predicate := skydb.Predicate{
+		Operator: parser.predicateOperatorFromString(rawOperator),
+		Children: make([]interface{}, 0),
+	}
+	if predicate.Operator == skydb.Functional {
+		predicate.Children = append(predicate.Children, parser.parseExpression(rawPredicate))
+	} else if predicate.Operator.IsCompound() {
+		for i := 1; i < len(rawPredicate); i++ {
+			subRawPredicate, ok := rawPredicate[i].([]interface{})
+			if !ok {
+				panic(fmt.Errorf("got non-dict in subpredicate at %v", i-1))
+			}
+			predicate.Children = append(predicate.Children, parser.predicateFromRaw(subRawPredicate))
+		}
+	} else {
+		for i := 1; i < len(rawPredicate); i++ {
+			expr := parser.parseExpression(rawPredicate[i])
+			predicate.Children = append(predicate.Children, expr)
+		}
+	}
+
+	if predicate.Operator.IsBinary() && len(predicate.Children) != 2 {
+		panic(fmt.Errorf("Expected number of expressions be 2, got %v", len(predicate.Children)))
+	}
+
+	return predicate
+}
+
+// parseExpression parses the specific structure into an Expression struct.
+//
+// Accepts one of the following types:
+//
+// * { "$type": "keypath", "$val": "_key_path_name_" }    // key path
+// * [ "_func_name_" , _expression_1_ , _expression_2_ ]  // function
+// * 42                                                   // literal
+func (parser *QueryParser) parseExpression(i interface{}) skydb.Expression {
+	switch v := i.(type) {
+	case map[string]interface{}:
+		var keyPath string
+		if err := MapFrom(i, (*MapKeyPath)(&keyPath)); err == nil {
+			if keyPath == "_owner" {
+				keyPath = "_owner_id"
+			}
+			return skydb.Expression{
+				Type:  skydb.KeyPath,
+				Value: keyPath,
+			}
+		}
+	case []interface{}:
+		if len(v) > 0 {
+			if f, err := parser.parseFunc(v); err == nil {
+				return skydb.Expression{
+					Type:  skydb.Function,
+					Value: f,
+				}
+			}
+		}
+	}
+
+	return skydb.Expression{
+		Type:  skydb.Literal,
+		Value: ParseLiteral(i),
+	}
+}
+
+func (parser *QueryParser) parseFunc(s []interface{}) (f skydb.Func, err error) {
+	keyword, _ := s[0].(string)
+	if keyword != "func" {
+		return nil, errors.New("not a function")
+	}
+
+	funcName, _ := s[1].(string)
+	switch funcName {
+	case "distance":
+		f, err = parser.parseDistanceFunc(s[2:])
+	case "userRelation":
+		f, err = parser.parseUserRelationFunc(s[2:])
+	case "":
+		return nil, errors.New("empty function name")
+	default:
+		return nil, fmt.Errorf("got unrecgonized function name = %s", funcName)
+	}
+
+	return
+}
+
+func (parser *QueryParser) parseDistanceFunc(s []interface{}) (skydb.DistanceFunc, error) {
+	emptyDistanceFunc := skydb.DistanceFunc{}
+	if len(s) != 2 {
+		return emptyDistanceFunc, fmt.Errorf("want 2 arguments for distance func, got %d", len(s))
+	}
+
+	var field string
+	if err := MapFrom(s[0], (*MapKeyPath)(&field)); err != nil {
+		return emptyDistanceFunc, fmt.Errorf("invalid key path: %v", err)
+	}
+
+	var location skydb.Location
+	if err := MapFrom(s[1], (*MapLocation)(&location)); err != nil {
+		return emptyDistanceFunc, fmt.Errorf("invalid location: %v", err)
+	}
+
+	return skydb.DistanceFunc{
+		Field:    field,
+		Location: location,
+	}, nil
+}
+
+func (parser *QueryParser) parseUserRelationFunc(s []interface{}) (skydb.UserRelationFunc, error) {
+	emptyUserRelationFunc := skydb.UserRelationFunc{}
+	if len(s) != 2 {
+		return emptyUserRelationFunc, fmt.Errorf("want 2 arguments for user relation func, got %d", len(s))
+	}
+
+	var field string
+	if err := MapFrom(s[0], (*MapKeyPath)(&field)); err != nil {
+		return emptyUserRelationFunc, fmt.Errorf("invalid key path: %v", err)
+	}
+
+	var relation MapRelation
+	if err := MapFrom(s[1], (*MapRelation)(&relation)); err != nil {
+		return emptyUserRelationFunc, fmt.Errorf("invalid relation: %v", err)
+	}
+
+	return skydb.UserRelationFunc{
+		KeyPath:           field,
+		RelationName:      relation.Name,
+		RelationDirection: relation.Direction,
+		User:              parser.UserID,
+	}, nil
+
+}
+
+// QueryFromRaw parses the raw query specified in the request payload into
+// the supplied skydb.Query.
+func (parser *QueryParser) QueryFromRaw(rawQuery map[string]interface{}, query *skydb.Query) (err skyerr.Error) {
+	defer func() {
+		// use panic to escape from inner error
+		if r := recover(); r != nil {
+			switch queryErr := r.(type) {
+			case skyerr.Error:
+				err = queryErr.(skyerr.Error)
+				return
+			case error:
+				logrus.WithField("rawQuery", rawQuery).Debugln("failed to construct query")
+				err = skyerr.NewErrorf(skyerr.InvalidArgument, "failed to construct query: %v", queryErr.Error())
+			default:
+				logrus.WithField("recovered", r).Errorln("panic recovered while constructing query")
+				err = skyerr.NewError(skyerr.InvalidArgument, "error occurred while constructing query")
+			}
+		}
+	}()
+	recordType, _ := rawQuery["record_type"].(string)
+	if recordType == "" {
+		return skyerr.NewError(skyerr.InvalidArgument, "recordType cannot be empty")
+	}
+	query.Type = recordType
+
+	mustDoSlice(rawQuery, "predicate", func(rawPredicate []interface{}) skyerr.Error {
+		predicate := parser.predicateFromRaw(rawPredicate)
+		if err := predicate.Validate(); err != nil {
+			return err
+		}
+		query.Predicate = predicate
+		return nil
+	})
+
+	mustDoSlice(rawQuery, "sort", func(rawSorts []interface{}) skyerr.Error {
+		query.Sorts = parser.sortsFromRaw(rawSorts)
+		return nil
+	})
+
+	if transientIncludes, ok := rawQuery["include"].(map[string]interface{}); ok {
+		query.ComputedKeys = map[string]skydb.Expression{}
+		for key, value := range transientIncludes {
+			query.ComputedKeys[key] = parser.parseExpression(value)
+		}
+	}
+
+	mustDoSlice(rawQuery, "desired_keys", func(desiredKeys []interface{}) skyerr.Error {
+		query.DesiredKeys = make([]string, len(desiredKeys))
+		for i, key := range desiredKeys {
+			key, ok := key.(string)
+			if !ok {
+				return skyerr.NewError(skyerr.InvalidArgument, "unexpected value in desired_keys")
+			}
+			query.DesiredKeys[i] = key
+		}
+		return nil
+	})
+
+	if getCount, ok := rawQuery["count"].(bool); ok {
+		query.GetCount = getCount
+	}
+
+	if offset, _ := rawQuery["offset"].(float64); offset > 0 {
+		query.Offset = uint64(offset)
+	}
+
+	if limit, ok := rawQuery["limit"].(float64); ok {
+		query.Limit = new(uint64)
+		*query.Limit = uint64(limit)
+	}
+	return nil
+}
+
+// execute do when if the value of key in m is []interface{}. If value exists
+// for key but its type is not []interface{} or do returns an error, it panics.
+func mustDoSlice(m map[string]interface{}, key string, do func(value []interface{}) skyerr.Error) {
+	vi, ok := m[key]
+	if ok && vi != nil {
+		v, ok := vi.([]interface{})
+		if ok {
+			if err := do(v); err != nil {
+				panic(err)
+			}
+		} else {
+			panic(skyerr.NewInvalidArgument(
+				fmt.Sprintf(`expecting "%s" to be an array`, key),
+				[]string{key}))
+
+		}
+	}
+}
+
+// MapQuery is skydb.Query that can be converted to a map. The resulting map
+// is in the same format accepted by QueryParser.
+type MapQuery skydb.Query
+
+// ToMap implements ToMapper
+func (query *MapQuery) ToMap(m map[string]interface{}) {
+	m["record_type"] = query.Type
+
+	if !query.Predicate.IsEmpty() {
+		m["predicate"] = predicateToRaw(query.Predicate)
+	}
+
+	if len(query.Sorts) > 0 {
+		sorts := make([]interface{}, len(query.Sorts))
+		for i, sort := range query.Sorts {
+			order := "asc"
+			if sort.Order == skydb.Desc {
+				order = "desc"
+			}
+			sorts[i] = []interface{}{expressionToRaw(sort.Expression), order}
+		}
+		m["sort"] = sorts
+	}
+
+	if len(query.ComputedKeys) > 0 {
+		includes := map[string]interface{}{}
+		for key, expr := range query.ComputedKeys {
+			includes[key] = expressionToRaw(expr)
+		}
+		m["include"] = includes
+	}
+
+	if query.DesiredKeys != nil {
+		desiredKeys := make([]interface{}, len(query.DesiredKeys))
+		for i, key := range query.DesiredKeys {
+			desiredKeys[i] = key
+		}
+		m["desired_keys"] = desiredKeys
+	}
+
+	if query.GetCount {
+		m["count"] = true
+	}
+
+	if query.Offset > 0 {
+		m["offset"] = float64(query.Offset)
+	}
+
+	if query.Limit != nil {
+		m["limit"] = float64(*query.Limit)
+	}
+}
+
+func predicateOperatorToString(operator skydb.Operator) string {
+	switch operator {
+	case skydb.And:
+		return "and"
+	case skydb.Or:
+		return "or"
+	case skydb.Not:
+		return "not"
+	case skydb.Equal:
+		return "eq"
+	case skydb.GreaterThan:
+		return "gt"
+	case skydb.LessThan:
+		return "lt"
+	case skydb.GreaterThanOrEqual:
+		return "gte"
+	case skydb.LessThanOrEqual:
+		return "lte"
+	case skydb.NotEqual:
+		return "neq"
+	case skydb.Like:
+		return "like"
+	case skydb.ILike:
+		return "ilike"
+	case skydb.In:
+		return "in"
+	case skydb.Functional:
+		return "func"
+	default:
+		panic(fmt.Errorf("unrecognized operator = %v", operator))
+	}
+}
+
+func predicateToRaw(predicate skydb.Predicate) []interface{} {
+	if predicate.Operator == skydb.Functional {
+		// functional predicate has the function expression as the only
+		// child, and it is serialized in the same form as the function.
+		expr, _ := predicate.Children[0].(skydb.Expression)
+		rawFunc, _ := expressionToRaw(expr).([]interface{})
+		return rawFunc
+	}
+
+	raw := []interface{}{predicateOperatorToString(predicate.Operator)}
+	for _, child := range predicate.Children {
+		switch child := child.(type) {
+		case skydb.Predicate:
+			raw = append(raw, predicateToRaw(child))
+		case skydb.Expression:
+			raw = append(raw, expressionToRaw(child))
+		default:
+			panic(fmt.Errorf("unexpected predicate child of type %T", child))
+		}
+	}
+	return raw
+}
+
+func expressionToRaw(expr skydb.Expression) interface{} {
+	switch expr.Type {
+	case skydb.KeyPath:
+		return ToMap(MapKeyPath(expr.Value.(string)))
+	case skydb.Function:
+		switch f := expr.Value.(type) {
+		case skydb.DistanceFunc:
+			return []interface{}{
+				"func",
+				"distance",
+				ToMap(MapKeyPath(f.Field)),
+				ToMap(MapLocation(f.Location)),
+			}
+		case skydb.UserRelationFunc:
+			return []interface{}{
+				"func",
+				"userRelation",
+				ToMap(MapKeyPath(f.KeyPath)),
+				ToMap(&MapRelation{f.RelationName, f.RelationDirection}),
+			}
+		default:
+			panic(fmt.Errorf("unsupported function = %T", f))
+		}
+	default:
+		return ToLiteral(expr.Value)
+	}
+}
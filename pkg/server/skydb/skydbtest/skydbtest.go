@@ -17,6 +17,8 @@ package skydbtest
 import (
 	"fmt"
 	"reflect"
+	"sort"
+	"strings"
 	"time"
 
 	"github.com/skygeario/skygear-server/pkg/server/skydb"
@@ -32,6 +34,11 @@ type MapConn struct {
 	fieldAccess            skydb.FieldACL
 	OAuthMap               map[string]skydb.OAuthInfo
 	CustomTokenInfoMap     map[string]skydb.CustomTokenInfo
+	JobMap                 map[string]skydb.Job
+	PushTemplateMap        map[string]skydb.PushTemplate
+	PushDeliveryMap        map[string]skydb.PushDelivery
+	AssetUploadMap         map[string]skydb.AssetUpload
+	AssetContentMap        map[string]skydb.AssetContent
 	skydb.Conn
 }
 
@@ -45,6 +52,11 @@ func NewMapConn() *MapConn {
 		AssetMap:               map[string]skydb.Asset{},
 		OAuthMap:               map[string]skydb.OAuthInfo{},
 		CustomTokenInfoMap:     map[string]skydb.CustomTokenInfo{},
+		JobMap:                 map[string]skydb.Job{},
+		PushTemplateMap:        map[string]skydb.PushTemplate{},
+		PushDeliveryMap:        map[string]skydb.PushDelivery{},
+		AssetUploadMap:         map[string]skydb.AssetUpload{},
+		AssetContentMap:        map[string]skydb.AssetContent{},
 	}
 }
 
@@ -167,16 +179,56 @@ func (conn *MapConn) GetRecordFieldAccess() (skydb.FieldACL, error) {
 	return conn.fieldAccess, nil
 }
 
-// GetAsset is not implemented.
+// GetAsset returns the asset in AssetMap.
 func (conn *MapConn) GetAsset(name string, asset *skydb.Asset) error {
-	panic("not implemented")
+	saved, ok := conn.AssetMap[name]
+	if !ok {
+		return fmt.Errorf("asset %s not found", name)
+	}
+	*asset = saved
+	return nil
 }
 
-// SaveAsset is not implemented.
+// SaveAsset saves the asset into AssetMap.
 func (conn *MapConn) SaveAsset(asset *skydb.Asset) error {
+	conn.AssetMap[asset.Name] = *asset
+	return nil
+}
+
+// QueryOrphanedAssets is not implemented.
+func (conn *MapConn) QueryOrphanedAssets(assetColumns map[string][]string, createdBefore time.Time, limit int) ([]skydb.Asset, error) {
 	panic("not implemented")
 }
 
+// QueryAssets returns assets in AssetMap ordered by name.
+func (conn *MapConn) QueryAssets(after string, limit int) ([]skydb.Asset, error) {
+	names := []string{}
+	for name := range conn.AssetMap {
+		if name > after {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	if len(names) > limit {
+		names = names[:limit]
+	}
+
+	assets := []skydb.Asset{}
+	for _, name := range names {
+		assets = append(assets, conn.AssetMap[name])
+	}
+	return assets, nil
+}
+
+// DeleteAsset removes the asset from AssetMap.
+func (conn *MapConn) DeleteAsset(name string) error {
+	if _, ok := conn.AssetMap[name]; !ok {
+		return fmt.Errorf("asset %s not found", name)
+	}
+	delete(conn.AssetMap, name)
+	return nil
+}
+
 // GetAssets always returns empty array.
 func (conn *MapConn) GetAssets(names []string) ([]skydb.Asset, error) {
 	assets := []skydb.Asset{}
@@ -344,6 +396,331 @@ func (conn *MapConn) DeleteCustomTokenInfo(principalID string) error {
 	return nil
 }
 
+// CreateJob saves a Job in JobMap.
+func (conn *MapConn) CreateJob(job *skydb.Job) error {
+	if job.ID == "" {
+		job.ID = fmt.Sprintf("job-%d", len(conn.JobMap))
+	}
+	if _, ok := conn.JobMap[job.ID]; ok {
+		return skydb.ErrJobDuplicated
+	}
+	for _, existing := range conn.JobMap {
+		if job.Key != "" && existing.Key == job.Key {
+			return skydb.ErrJobDuplicated
+		}
+	}
+	conn.JobMap[job.ID] = *job
+	return nil
+}
+
+// ClaimDueJobs returns jobs in JobMap which are due before t.
+func (conn *MapConn) ClaimDueJobs(t time.Time, lockUntil time.Time, limit int) ([]skydb.Job, error) {
+	jobs := []skydb.Job{}
+	for id, job := range conn.JobMap {
+		if len(jobs) >= limit {
+			break
+		}
+		if job.RunAt.After(t) {
+			continue
+		}
+		job.RunAt = lockUntil
+		job.ClaimedUntil = lockUntil
+		job.Attempts++
+		conn.JobMap[id] = job
+		jobs = append(jobs, job)
+	}
+	return jobs, nil
+}
+
+// UpdateJob updates an existing Job in JobMap.
+func (conn *MapConn) UpdateJob(job *skydb.Job) error {
+	if _, ok := conn.JobMap[job.ID]; !ok {
+		return skydb.ErrJobNotFound
+	}
+	job.ClaimedUntil = time.Time{}
+	conn.JobMap[job.ID] = *job
+	return nil
+}
+
+// DeleteJob removes an existing Job from JobMap.
+func (conn *MapConn) DeleteJob(id string) error {
+	if _, ok := conn.JobMap[id]; !ok {
+		return skydb.ErrJobNotFound
+	}
+	delete(conn.JobMap, id)
+	return nil
+}
+
+// DeleteJobsByKeyPrefix removes Jobs in JobMap with Key starting with prefix.
+func (conn *MapConn) DeleteJobsByKeyPrefix(prefix string) (int, error) {
+	count := 0
+	for id, job := range conn.JobMap {
+		if job.Key != "" && strings.HasPrefix(job.Key, prefix) {
+			delete(conn.JobMap, id)
+			count++
+		}
+	}
+	return count, nil
+}
+
+// CancelJobsByKeyPrefix removes Jobs in JobMap with Key starting with
+// prefix which are not claimed at t.
+func (conn *MapConn) CancelJobsByKeyPrefix(prefix string, t time.Time) (int, int, error) {
+	cancelled := 0
+	claimed := 0
+	for id, job := range conn.JobMap {
+		if job.Key == "" || !strings.HasPrefix(job.Key, prefix) {
+			continue
+		}
+		if job.ClaimedUntil.After(t) {
+			claimed++
+			continue
+		}
+		delete(conn.JobMap, id)
+		cancelled++
+	}
+	return cancelled, claimed, nil
+}
+
+// GetPushTemplate returns a PushTemplate in PushTemplateMap.
+func (conn *MapConn) GetPushTemplate(name string, template *skydb.PushTemplate) error {
+	t, ok := conn.PushTemplateMap[name]
+	if !ok {
+		return skydb.ErrPushTemplateNotFound
+	}
+	*template = t
+	return nil
+}
+
+// QueryPushTemplates returns all PushTemplates in PushTemplateMap.
+func (conn *MapConn) QueryPushTemplates() ([]skydb.PushTemplate, error) {
+	names := []string{}
+	for name := range conn.PushTemplateMap {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	templates := []skydb.PushTemplate{}
+	for _, name := range names {
+		templates = append(templates, conn.PushTemplateMap[name])
+	}
+	return templates, nil
+}
+
+// SavePushTemplate saves a PushTemplate in PushTemplateMap.
+func (conn *MapConn) SavePushTemplate(template *skydb.PushTemplate) error {
+	conn.PushTemplateMap[template.Name] = *template
+	return nil
+}
+
+// DeletePushTemplate removes a PushTemplate from PushTemplateMap.
+func (conn *MapConn) DeletePushTemplate(name string) error {
+	if _, ok := conn.PushTemplateMap[name]; !ok {
+		return skydb.ErrPushTemplateNotFound
+	}
+	delete(conn.PushTemplateMap, name)
+	return nil
+}
+
+// CreatePushDelivery saves a PushDelivery in PushDeliveryMap.
+func (conn *MapConn) CreatePushDelivery(delivery *skydb.PushDelivery) error {
+	if delivery.ID == "" {
+		delivery.ID = fmt.Sprintf("delivery-%d", len(conn.PushDeliveryMap))
+	}
+	conn.PushDeliveryMap[delivery.ID] = *delivery
+	return nil
+}
+
+// UpdatePushDelivery updates an existing PushDelivery in PushDeliveryMap.
+func (conn *MapConn) UpdatePushDelivery(delivery *skydb.PushDelivery) error {
+	if _, ok := conn.PushDeliveryMap[delivery.ID]; !ok {
+		return skydb.ErrPushDeliveryNotFound
+	}
+	conn.PushDeliveryMap[delivery.ID] = *delivery
+	return nil
+}
+
+// QueryPushDeliveries returns PushDeliveries in PushDeliveryMap with the
+// push ID, ordered by ID.
+func (conn *MapConn) QueryPushDeliveries(pushID string) ([]skydb.PushDelivery, error) {
+	ids := []string{}
+	for id, delivery := range conn.PushDeliveryMap {
+		if delivery.PushID == pushID {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+
+	deliveries := []skydb.PushDelivery{}
+	for _, id := range ids {
+		deliveries = append(deliveries, conn.PushDeliveryMap[id])
+	}
+	return deliveries, nil
+}
+
+// ClaimRetryPushDeliveries returns retrying PushDeliveries in
+// PushDeliveryMap which are due before t.
+func (conn *MapConn) ClaimRetryPushDeliveries(t time.Time, lockUntil time.Time, limit int) ([]skydb.PushDelivery, error) {
+	deliveries := []skydb.PushDelivery{}
+	for id, delivery := range conn.PushDeliveryMap {
+		if len(deliveries) >= limit {
+			break
+		}
+		if delivery.Status != skydb.PushDeliveryRetrying || delivery.NextAttemptAt.After(t) {
+			continue
+		}
+		delivery.NextAttemptAt = lockUntil
+		conn.PushDeliveryMap[id] = delivery
+		deliveries = append(deliveries, delivery)
+	}
+	return deliveries, nil
+}
+
+// DeletePushDeliveries removes PushDeliveries in PushDeliveryMap not
+// retrying and not updated since updatedBefore.
+func (conn *MapConn) DeletePushDeliveries(updatedBefore time.Time) (int, error) {
+	count := 0
+	for id, delivery := range conn.PushDeliveryMap {
+		if delivery.Status != skydb.PushDeliveryRetrying && delivery.UpdatedAt.Before(updatedBefore) {
+			delete(conn.PushDeliveryMap, id)
+			count++
+		}
+	}
+	return count, nil
+}
+
+// CreateAssetUpload saves an AssetUpload in AssetUploadMap.
+func (conn *MapConn) CreateAssetUpload(upload *skydb.AssetUpload) error {
+	if upload.ID == "" {
+		upload.ID = fmt.Sprintf("upload-%d", len(conn.AssetUploadMap))
+	}
+	if upload.Chunks == nil {
+		upload.Chunks = []string{}
+	}
+	conn.AssetUploadMap[upload.ID] = *upload
+	return nil
+}
+
+// GetAssetUpload returns the AssetUpload in AssetUploadMap.
+func (conn *MapConn) GetAssetUpload(id string, upload *skydb.AssetUpload) error {
+	saved, ok := conn.AssetUploadMap[id]
+	if !ok {
+		return skydb.ErrAssetUploadNotFound
+	}
+	*upload = saved
+	upload.Chunks = append([]string{}, saved.Chunks...)
+	return nil
+}
+
+// AppendAssetUploadChunk appends a chunk to the AssetUpload in
+// AssetUploadMap.
+func (conn *MapConn) AppendAssetUploadChunk(id string, offset int64, chunk string, size int64) error {
+	upload, ok := conn.AssetUploadMap[id]
+	if !ok {
+		return skydb.ErrAssetUploadNotFound
+	}
+	if upload.Offset != offset || upload.Offset+size > upload.Length {
+		return skydb.ErrAssetUploadOffsetMismatch
+	}
+	upload.Offset += size
+	upload.Chunks = append(append([]string{}, upload.Chunks...), chunk)
+	conn.AssetUploadMap[id] = upload
+	return nil
+}
+
+// TouchAssetUpload sets UpdatedAt of an AssetUpload in AssetUploadMap
+// to now.
+func (conn *MapConn) TouchAssetUpload(id string) error {
+	upload, ok := conn.AssetUploadMap[id]
+	if !ok {
+		return skydb.ErrAssetUploadNotFound
+	}
+	upload.UpdatedAt = time.Now().UTC()
+	conn.AssetUploadMap[id] = upload
+	return nil
+}
+
+// DeleteAssetUpload removes an AssetUpload from AssetUploadMap.
+func (conn *MapConn) DeleteAssetUpload(id string) error {
+	if _, ok := conn.AssetUploadMap[id]; !ok {
+		return skydb.ErrAssetUploadNotFound
+	}
+	delete(conn.AssetUploadMap, id)
+	return nil
+}
+
+// QueryExpiredAssetUploads returns the AssetUploads in AssetUploadMap
+// not updated since updatedBefore.
+func (conn *MapConn) QueryExpiredAssetUploads(updatedBefore time.Time, limit int) ([]skydb.AssetUpload, error) {
+	uploads := []skydb.AssetUpload{}
+	for _, upload := range conn.AssetUploadMap {
+		if upload.UpdatedAt.Before(updatedBefore) {
+			uploads = append(uploads, upload)
+		}
+	}
+	sort.Slice(uploads, func(i, j int) bool {
+		return uploads[i].UpdatedAt.Before(uploads[j].UpdatedAt)
+	})
+	if len(uploads) > limit {
+		uploads = uploads[:limit]
+	}
+	return uploads, nil
+}
+
+// ReferenceAssetContent increments the reference count of an
+// AssetContent in AssetContentMap.
+func (conn *MapConn) ReferenceAssetContent(content *skydb.AssetContent) error {
+	saved, ok := conn.AssetContentMap[content.Hash]
+	if !ok {
+		saved = *content
+		saved.RefCount = 0
+	}
+	saved.RefCount++
+	conn.AssetContentMap[content.Hash] = saved
+	*content = saved
+	return nil
+}
+
+// ReferenceExistingAssetContent increments the reference count of an
+// AssetContent in AssetContentMap.
+func (conn *MapConn) ReferenceExistingAssetContent(hash string, content *skydb.AssetContent) error {
+	saved, ok := conn.AssetContentMap[hash]
+	if !ok || saved.RefCount <= 0 {
+		return skydb.ErrAssetContentNotFound
+	}
+	saved.RefCount++
+	conn.AssetContentMap[hash] = saved
+	*content = saved
+	return nil
+}
+
+// DereferenceAssetContent decrements the reference count of an
+// AssetContent in AssetContentMap.
+func (conn *MapConn) DereferenceAssetContent(hash string, content *skydb.AssetContent) error {
+	saved, ok := conn.AssetContentMap[hash]
+	if !ok || saved.RefCount <= 0 {
+		return skydb.ErrAssetContentNotFound
+	}
+	saved.RefCount--
+	conn.AssetContentMap[hash] = saved
+	*content = saved
+	return nil
+}
+
+// DeleteAssetContent removes an AssetContent no longer referenced from
+// AssetContentMap after calling deleteFile.
+func (conn *MapConn) DeleteAssetContent(hash string, deleteFile func() error) error {
+	saved, ok := conn.AssetContentMap[hash]
+	if !ok || saved.RefCount > 0 {
+		return skydb.ErrAssetContentNotFound
+	}
+	if err := deleteFile(); err != nil {
+		return err
+	}
+	delete(conn.AssetContentMap, hash)
+	return nil
+}
+
 // Close does nothing.
 func (conn *MapConn) Close() error {
 	// do nothing
@@ -20,6 +20,17 @@ import "errors"
 // DeleteSubscription when the specific subscription cannot be found.
 var ErrSubscriptionNotFound = errors.New("skydb: Subscription ID not found")
 
+// Types of Subscription.
+//
+// A QuerySubscriptionType subscription notifies the device that the
+// results of the query have changed. A LiveQuerySubscriptionType
+// subscription also tells the device whether the changed record is added to,
+// updated in or removed from the results, with the record content.
+const (
+	QuerySubscriptionType     = "query"
+	LiveQuerySubscriptionType = "live_query"
+)
+
 // Subscription represents a device's subscription of notification
 // triggered by changes of results from a query.
 type Subscription struct {
@@ -161,6 +161,10 @@ const (
 	// than limit
 	AssetSizeTooLarge
 
+	// PluginCircuitOpen occurs when calls to a plugin are rejected because
+	// the plugin has been failing, until the plugin is given another try
+	PluginCircuitOpen
+
 	// Error codes for expected error condition should be placed
 	// above this line.
 )
@@ -0,0 +1,183 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package subscription
+
+import (
+	"github.com/sirupsen/logrus"
+
+	"github.com/skygeario/skygear-server/pkg/server/recordutil"
+	"github.com/skygeario/skygear-server/pkg/server/skydb"
+	"github.com/skygeario/skygear-server/pkg/server/skydb/skyconv"
+)
+
+// LiveQueryEvent describes how a record event changes the results of a
+// live query subscription.
+type LiveQueryEvent string
+
+// See the definition of LiveQueryEvent
+const (
+	// LiveQueryAdded means the record is added to the results
+	LiveQueryAdded LiveQueryEvent = "added"
+	// LiveQueryUpdated means the record in the results is updated
+	LiveQueryUpdated LiveQueryEvent = "updated"
+	// LiveQueryRemoved means the record is removed from the results
+	LiveQueryRemoved LiveQueryEvent = "removed"
+)
+
+// handleLiveQuery sends notices to the live query subscriptions whose
+// results are changed by the record event.
+//
+// A record is in the results of a subscription if it matches the query
+// and is readable by the owner of the subscribed device. The results before
+// the event are evaluated against the original record of the event.
+func (s *Service) handleLiveQuery(db skydb.Database, e skydb.RecordEvent, seqNum uint64, matchingSubs []skydb.Subscription) {
+	var (
+		original   *skydb.Record
+		beforeSubs []skydb.Subscription
+		afterSubs  []skydb.Subscription
+	)
+	switch e.Event {
+	case skydb.RecordCreated:
+		afterSubs = matchingSubs
+	case skydb.RecordUpdated:
+		afterSubs = matchingSubs
+		if e.Original != nil {
+			original = e.Original
+			beforeSubs = db.GetMatchingSubscriptions(original)
+		} else {
+			// the original record is unknown, assume the update does
+			// not change whether the record matches the query
+			original = e.Record
+			beforeSubs = matchingSubs
+		}
+	case skydb.RecordDeleted:
+		original = e.Record
+		beforeSubs = matchingSubs
+	}
+
+	subscriptions, inBefore, inAfter := liveQuerySubscriptions(beforeSubs, afterSubs)
+	if len(subscriptions) == 0 {
+		return
+	}
+
+	var record *skydb.Record
+	if e.Event != skydb.RecordDeleted {
+		// the record of the event carries no type information of
+		// its values, fetch the record to send it to subscribers
+		record = &skydb.Record{}
+		if err := db.Get(e.Record.ID, record); err != nil {
+			log.WithFields(logrus.Fields{
+				"recordID": e.Record.ID,
+				"err":      err,
+			}).Errorln("subscription: failed to fetch record for live query")
+			return
+		}
+	}
+
+	conn := db.Conn()
+	fieldACL, err := conn.GetRecordFieldAccess()
+	if err != nil {
+		log.WithError(err).Errorln("subscription: failed to get field access for live query")
+		return
+	}
+
+	for _, subscription := range subscriptions {
+		device := skydb.Device{}
+		if getErr := conn.GetDevice(subscription.DeviceID, &device); getErr != nil {
+			log.WithFields(logrus.Fields{
+				"deviceID": subscription.DeviceID,
+				"err":      getErr,
+			}).Errorln("subscription: failed to get device")
+			continue
+		}
+
+		var authInfo *skydb.AuthInfo
+		if device.AuthInfoID != "" {
+			authInfo = &skydb.AuthInfo{}
+			if getErr := conn.GetAuth(device.AuthInfoID, authInfo); getErr != nil {
+				log.WithFields(logrus.Fields{
+					"authInfoID": device.AuthInfoID,
+					"err":        getErr,
+				}).Errorln("subscription: failed to get auth info of device")
+				continue
+			}
+		}
+
+		wasIn := inBefore[subscription.ID] && original.Accessible(authInfo, skydb.ReadLevel)
+		isIn := inAfter[subscription.ID] && record.Accessible(authInfo, skydb.ReadLevel)
+
+		notice := Notice{
+			SeqNum:         seqNum,
+			SubscriptionID: subscription.ID,
+			Event:          e.Event,
+			Record:         e.Record,
+		}
+		switch {
+		case wasIn && isIn:
+			notice.LiveEvent = LiveQueryUpdated
+		case isIn:
+			notice.LiveEvent = LiveQueryAdded
+		case wasIn:
+			notice.LiveEvent = LiveQueryRemoved
+		default:
+			continue
+		}
+
+		if isIn {
+			filter := recordutil.RecordResultFilter{
+				AssetStore: s.AssetStore,
+				FieldACL:   fieldACL,
+				AuthInfo:   authInfo,
+			}
+			notice.LiveRecord = filter.JSONResult(record)
+		} else {
+			// the subscriber may not be allowed to read the record
+			// anymore, only the identity of the record is sent
+			notice.LiveRecord = &skyconv.JSONRecord{
+				ID:         original.ID,
+				DatabaseID: original.DatabaseID,
+				OwnerID:    original.OwnerID,
+			}
+		}
+
+		if notifyErr := s.Notifier.Notify(device, notice); notifyErr != nil {
+			log.Errorf("subscription: failed to send live query notice to device id = %s", device.ID)
+		}
+	}
+}
+
+// liveQuerySubscriptions returns the live query subscriptions in before
+// and after without duplicates, and the IDs of subscriptions in each of them.
+func liveQuerySubscriptions(before, after []skydb.Subscription) (subscriptions []skydb.Subscription, inBefore, inAfter map[string]bool) {
+	inBefore = map[string]bool{}
+	inAfter = map[string]bool{}
+	add := func(subscription skydb.Subscription, in map[string]bool) {
+		if subscription.Type != skydb.LiveQuerySubscriptionType {
+			return
+		}
+		if !inBefore[subscription.ID] && !inAfter[subscription.ID] {
+			subscriptions = append(subscriptions, subscription)
+		}
+		in[subscription.ID] = true
+	}
+
+	for _, subscription := range after {
+		add(subscription, inAfter)
+	}
+	for _, subscription := range before {
+		add(subscription, inBefore)
+	}
+	return
+}
@@ -0,0 +1,233 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package subscription
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/skygeario/skygear-server/pkg/server/skydb"
+	"github.com/skygeario/skygear-server/pkg/server/skydb/mock_skydb"
+	. "github.com/skygeario/skygear-server/pkg/server/skytest"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestLiveQuery(t *testing.T) {
+	Convey("Subscription Service with live query", t, func() {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		conn := mock_skydb.NewMockConn(ctrl)
+		db := mock_skydb.NewMockDatabase(ctrl)
+
+		notices := []Notice{}
+		service := &Service{
+			Notifier: notifyFunc(func(device skydb.Device, notice Notice) error {
+				notices = append(notices, notice)
+				return nil
+			}),
+		}
+
+		liveSub := skydb.Subscription{
+			ID:       "live",
+			Type:     skydb.LiveQuerySubscriptionType,
+			DeviceID: "deviceid",
+		}
+		querySub := skydb.Subscription{
+			ID:       "query",
+			Type:     skydb.QuerySubscriptionType,
+			DeviceID: "deviceid",
+		}
+
+		recordID := skydb.NewRecordID("note", "1")
+		// record decoded from the db trigger
+		eventRecord := skydb.Record{
+			ID:      recordID,
+			OwnerID: "owner",
+			Data:    map[string]interface{}{"done": true},
+		}
+		originalRecord := skydb.Record{
+			ID:      recordID,
+			OwnerID: "owner",
+			Data:    map[string]interface{}{"done": false},
+		}
+		storedRecord := skydb.Record{
+			ID:      recordID,
+			OwnerID: "owner",
+			Data: map[string]interface{}{
+				"done":   true,
+				"secret": "s",
+			},
+		}
+
+		db.EXPECT().Conn().Return(conn).AnyTimes()
+		db.EXPECT().Get(recordID, gomock.Any()).
+			Do(func(id skydb.RecordID, record *skydb.Record) {
+				*record = storedRecord
+			}).
+			Return(nil).
+			AnyTimes()
+		conn.EXPECT().GetRecordFieldAccess().Return(skydb.NewFieldACL(skydb.FieldACLEntryList{
+			{
+				RecordType:  "note",
+				RecordField: "secret",
+				UserRole:    skydb.FieldUserRole{Type: skydb.OwnerFieldUserRoleType},
+				Readable:    true,
+			},
+			{
+				RecordType:  "note",
+				RecordField: "secret",
+				UserRole:    skydb.FieldUserRole{Type: skydb.PublicFieldUserRoleType},
+				Readable:    false,
+			},
+		}), nil).AnyTimes()
+		conn.EXPECT().GetDevice("deviceid", gomock.Any()).
+			SetArg(1, skydb.Device{ID: "deviceid", AuthInfoID: "user"}).
+			Return(nil).
+			AnyTimes()
+		conn.EXPECT().GetAuth("user", gomock.Any()).
+			SetArg(1, skydb.AuthInfo{ID: "user"}).
+			Return(nil).
+			AnyTimes()
+
+		Convey("sends added with filtered record on create", func() {
+			service.handleLiveQuery(db, skydb.RecordEvent{
+				Record: &eventRecord,
+				Event:  skydb.RecordCreated,
+			}, 1, []skydb.Subscription{liveSub, querySub})
+
+			So(len(notices), ShouldEqual, 1)
+			So(notices[0].SubscriptionID, ShouldEqual, "live")
+			So(notices[0].LiveEvent, ShouldEqual, LiveQueryAdded)
+
+			data, _ := json.Marshal(notices[0].LiveRecord)
+			So(data, ShouldEqualJSON, `{
+				"_id": "note/1",
+				"_type": "record",
+				"_recordID": "1",
+				"_recordType": "note",
+				"_access": null,
+				"_ownerID": "owner",
+				"done": true
+			}`)
+		})
+
+		Convey("sends added when the updated record starts matching", func() {
+			db.EXPECT().GetMatchingSubscriptions(&originalRecord).Return(nil)
+			service.handleLiveQuery(db, skydb.RecordEvent{
+				Record:   &eventRecord,
+				Original: &originalRecord,
+				Event:    skydb.RecordUpdated,
+			}, 1, []skydb.Subscription{liveSub})
+
+			So(len(notices), ShouldEqual, 1)
+			So(notices[0].LiveEvent, ShouldEqual, LiveQueryAdded)
+		})
+
+		Convey("sends updated when the record matches before and after", func() {
+			db.EXPECT().GetMatchingSubscriptions(&originalRecord).Return([]skydb.Subscription{liveSub})
+			service.handleLiveQuery(db, skydb.RecordEvent{
+				Record:   &eventRecord,
+				Original: &originalRecord,
+				Event:    skydb.RecordUpdated,
+			}, 1, []skydb.Subscription{liveSub})
+
+			So(len(notices), ShouldEqual, 1)
+			So(notices[0].LiveEvent, ShouldEqual, LiveQueryUpdated)
+			So(notices[0].LiveRecord.Data["done"], ShouldEqual, true)
+		})
+
+		Convey("sends updated when the original record is unknown", func() {
+			service.handleLiveQuery(db, skydb.RecordEvent{
+				Record: &eventRecord,
+				Event:  skydb.RecordUpdated,
+			}, 1, []skydb.Subscription{liveSub})
+
+			So(len(notices), ShouldEqual, 1)
+			So(notices[0].LiveEvent, ShouldEqual, LiveQueryUpdated)
+		})
+
+		Convey("sends removed when the updated record stops matching", func() {
+			db.EXPECT().GetMatchingSubscriptions(&originalRecord).Return([]skydb.Subscription{liveSub})
+			service.handleLiveQuery(db, skydb.RecordEvent{
+				Record:   &eventRecord,
+				Original: &originalRecord,
+				Event:    skydb.RecordUpdated,
+			}, 1, nil)
+
+			So(len(notices), ShouldEqual, 1)
+			So(notices[0].LiveEvent, ShouldEqual, LiveQueryRemoved)
+
+			data, _ := json.Marshal(notices[0].LiveRecord)
+			So(data, ShouldEqualJSON, `{
+				"_id": "note/1",
+				"_type": "record",
+				"_recordID": "1",
+				"_recordType": "note",
+				"_access": null,
+				"_ownerID": "owner"
+			}`)
+		})
+
+		Convey("sends removed when the record becomes not readable", func() {
+			storedRecord.ACL = skydb.RecordACL{
+				skydb.NewRecordACLEntryDirect("other", skydb.ReadLevel),
+			}
+			db.EXPECT().GetMatchingSubscriptions(&originalRecord).Return([]skydb.Subscription{liveSub})
+			service.handleLiveQuery(db, skydb.RecordEvent{
+				Record:   &eventRecord,
+				Original: &originalRecord,
+				Event:    skydb.RecordUpdated,
+			}, 1, []skydb.Subscription{liveSub})
+
+			So(len(notices), ShouldEqual, 1)
+			So(notices[0].LiveEvent, ShouldEqual, LiveQueryRemoved)
+			So(notices[0].LiveRecord.Data, ShouldBeEmpty)
+		})
+
+		Convey("sends removed on delete", func() {
+			service.handleLiveQuery(db, skydb.RecordEvent{
+				Record: &eventRecord,
+				Event:  skydb.RecordDeleted,
+			}, 1, []skydb.Subscription{liveSub})
+
+			So(len(notices), ShouldEqual, 1)
+			So(notices[0].LiveEvent, ShouldEqual, LiveQueryRemoved)
+			So(notices[0].LiveRecord.ID, ShouldResemble, recordID)
+		})
+
+		Convey("sends nothing for record not readable by the subscriber", func() {
+			eventRecord.ACL = skydb.RecordACL{
+				skydb.NewRecordACLEntryDirect("other", skydb.ReadLevel),
+			}
+			service.handleLiveQuery(db, skydb.RecordEvent{
+				Record: &eventRecord,
+				Event:  skydb.RecordDeleted,
+			}, 1, []skydb.Subscription{liveSub})
+
+			So(notices, ShouldBeEmpty)
+		})
+
+		Convey("does not send to query subscriptions", func() {
+			service.handleLiveQuery(db, skydb.RecordEvent{
+				Record: &eventRecord,
+				Event:  skydb.RecordCreated,
+			}, 1, []skydb.Subscription{querySub})
+
+			So(notices, ShouldBeEmpty)
+		})
+	})
+}
@@ -16,13 +16,13 @@ package subscription
 
 import (
 	"encoding/json"
-	"fmt"
 
 	"github.com/sirupsen/logrus"
 
 	"github.com/skygeario/skygear-server/pkg/server/pubsub"
 	"github.com/skygeario/skygear-server/pkg/server/push"
 	"github.com/skygeario/skygear-server/pkg/server/skydb"
+	"github.com/skygeario/skygear-server/pkg/server/skydb/skyconv"
 )
 
 // Notice encapsulates the information sent to subscribers when the content of
@@ -33,6 +33,12 @@ type Notice struct {
 	SubscriptionID string
 	Event          skydb.RecordHookEvent
 	Record         *skydb.Record
+
+	// LiveEvent and LiveRecord are set for notices of live query
+	// subscriptions only. LiveRecord is filtered by the access control
+	// of the subscriber.
+	LiveEvent  LiveQueryEvent
+	LiveRecord *skyconv.JSONRecord
 }
 
 // Notifier is the interface implemented by an object that knows how to deliver
@@ -60,6 +66,11 @@ func (notifier *pushNotifier) CanNotify(device skydb.Device) bool {
 }
 
 func (notifier *pushNotifier) Notify(device skydb.Device, notice Notice) error {
+	// notices of live query subscriptions are delivered thru pubsub only
+	if notice.LiveEvent != "" {
+		return nil
+	}
+
 	customMap := map[string]interface{}{
 		"aps": map[string]interface{}{
 			"content_available": 1,
@@ -77,6 +88,16 @@ type hubNotifier pubsub.Hub
 
 // NewHubNotifier returns an Notifier which sends Notice thru the supplied
 // hub. The notice will be sent via the channel name "_sub_[DEVICE_ID]".
+//
+// Notice of a live query subscription is sent with the event and the record,
+// for example:
+//
+//	{
+//	    "seq-num": 1,
+//	    "subscription-id": "SUBSCRIPTION_ID",
+//	    "event": "added",
+//	    "record": {"_id": "note/1", ...}
+//	}
 func NewHubNotifier(hub *pubsub.Hub) Notifier {
 	return (*hubNotifier)(hub)
 }
@@ -87,13 +108,15 @@ func (n *hubNotifier) CanNotify(device skydb.Device) bool {
 
 func (n *hubNotifier) Notify(device skydb.Device, notice Notice) error {
 	data, err := json.Marshal(struct {
-		SeqNum         uint64 `json:"seq-num"`
-		SubscriptionID string `json:"subscription-id"`
-	}{notice.SeqNum, notice.SubscriptionID})
+		SeqNum         uint64              `json:"seq-num"`
+		SubscriptionID string              `json:"subscription-id"`
+		Event          LiveQueryEvent      `json:"event,omitempty"`
+		Record         *skyconv.JSONRecord `json:"record,omitempty"`
+	}{notice.SeqNum, notice.SubscriptionID, notice.LiveEvent, notice.LiveRecord})
 
 	if err == nil {
 		(*pubsub.Hub)(n).Broadcast <- pubsub.Parcel{
-			Channel: fmt.Sprintf("_sub_%s", device.ID),
+			Channel: pubsub.DeviceChannelPrefix + device.ID,
 			Data:    data,
 		}
 	}
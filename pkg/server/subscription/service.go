@@ -18,6 +18,7 @@ import (
 	"time"
 
 	"github.com/sirupsen/logrus"
+	"github.com/skygeario/skygear-server/pkg/server/asset"
 	"github.com/skygeario/skygear-server/pkg/server/skydb"
 )
 
@@ -25,9 +26,18 @@ var timeNow = time.Now
 
 // Service is responsible to send push notification to device whenever
 // a record has been modified in db.
+//
+// If IsLeader is set, record events are handled only when IsLeader returns
+// true, such that only the elected leader among instances sends notices.
+// Events received by other instances are discarded.
+//
+// AssetStore is used to sign the URL of assets in records sent to live
+// query subscriptions.
 type Service struct {
 	ConnOpener func() (skydb.Conn, error)
 	Notifier   Notifier
+	IsLeader   func() bool
+	AssetStore asset.Store
 	stop       chan struct{}
 }
 
@@ -49,6 +59,10 @@ func (s *Service) Run() {
 	for {
 		select {
 		case event := <-recordEventCh:
+			if s.IsLeader != nil && !s.IsLeader() {
+				continue
+			}
+
 			switch event.Event {
 			case skydb.RecordCreated, skydb.RecordUpdated, skydb.RecordDeleted:
 				conn, err := s.ConnOpener()
@@ -101,6 +115,10 @@ func (s *Service) handleRecordHook(db skydb.Database, e skydb.RecordEvent, seqNu
 	subscriptions := db.GetMatchingSubscriptions(e.Record)
 	device := skydb.Device{}
 	for _, subscription := range subscriptions {
+		if subscription.Type == skydb.LiveQuerySubscriptionType {
+			continue
+		}
+
 		log.Printf("subscription: got a matching sub id = %s", subscription.ID)
 
 		conn := db.Conn()
@@ -108,11 +126,18 @@ func (s *Service) handleRecordHook(db skydb.Database, e skydb.RecordEvent, seqNu
 			log.Panicf("subscription: failed to get device with id = %v: %v", subscription.DeviceID, err)
 		}
 
-		notice := Notice{seqNum, subscription.ID, e.Event, e.Record}
+		notice := Notice{
+			SeqNum:         seqNum,
+			SubscriptionID: subscription.ID,
+			Event:          e.Event,
+			Record:         e.Record,
+		}
 		if err := s.Notifier.Notify(device, notice); err != nil {
 			log.Errorf("subscription: failed to send notice to device id = %s", device.ID)
 		}
 	}
+
+	s.handleLiveQuery(db, e, seqNum, subscriptions)
 }
 
 func getDB(conn skydb.Conn, record *skydb.Record) skydb.Database {
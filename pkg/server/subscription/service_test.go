@@ -149,5 +149,27 @@ func TestService(t *testing.T) {
 			<-done
 			So(n.SeqNum, ShouldEqual, 0x43b940e60000000)
 		})
+
+		Convey("discards events when not leader", func() {
+			var n Notice
+			done := make(chan bool)
+			service.Notifier = notifyFunc(func(device skydb.Device, notice Notice) error {
+				n = notice
+				done <- true
+				return nil
+			})
+
+			isLeader := make(chan bool, 2)
+			service.IsLeader = func() bool { return <-isLeader }
+
+			isLeader <- false
+			ch <- skydb.RecordEvent{Record: &record, Event: skydb.RecordCreated}
+
+			isLeader <- true
+			ch <- skydb.RecordEvent{Record: &record, Event: skydb.RecordUpdated}
+			<-done
+			So(n.Event, ShouldEqual, skydb.RecordUpdated)
+			So(n.SeqNum, ShouldEqual, 0x43b940e50000000)
+		})
 	})
 }